@@ -0,0 +1,52 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+	"time"
+
+	"github.com/jclem/jclem.me/internal/bench"
+	"github.com/jclem/jclem.me/internal/www/config"
+)
+
+func runBench(cfg config.Config, args []string) error {
+	if len(args) == 0 || args[0] != "fanout" {
+		return fmt.Errorf("usage: bench fanout [flags]")
+	}
+
+	return runBenchFanOut(cfg, args[1:])
+}
+
+// runBenchFanOut delivers a note to simulated followers on fake instances, and
+// prints the delivery throughput and latencies.
+func runBenchFanOut(cfg config.Config, args []string) error {
+	var opts bench.Options
+
+	flags := flag.NewFlagSet("bench fanout", flag.ContinueOnError)
+	flags.IntVar(&opts.Followers, "followers", 1000, "the number of followers")
+	flags.IntVar(&opts.Hosts, "hosts", 50, "the number of instances the followers are spread across")
+	flags.IntVar(&opts.Workers, "workers", cfg.QueueDeliveryWorkers, "the number of deliveries worked at once")
+	flags.DurationVar(&opts.Latency, "latency", 50*time.Millisecond, "how long each inbox takes to respond")
+	flags.Float64Var(&opts.FailureRate, "failure-rate", 0, "the fraction of deliveries which fail, from 0 to 1")
+
+	if err := flags.Parse(args); err != nil {
+		return fmt.Errorf("error parsing flags: %w", err)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	// Each failed delivery is logged, which would bury the result.
+	slog.SetDefault(slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelError + 1})))
+
+	result, err := bench.FanOut(ctx, cfg, opts)
+	if err != nil {
+		return fmt.Errorf("error running fan-out: %w", err)
+	}
+
+	return printJSON(result)
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/jclem/jclem.me/internal/export"
+	"github.com/jclem/jclem.me/internal/www"
+	"github.com/jclem/jclem.me/internal/www/config"
+)
+
+// runExport writes an archive of a user's data to a file, or, given
+// "followers" or "following", a list of the user's accounts.
+func runExport(cfg config.Config, args []string) error {
+	if len(args) > 0 && (args[0] == string(www.Followers) || args[0] == string(www.Following)) {
+		return runExportAccounts(cfg, www.AccountList(args[0]), args[1:])
+	}
+
+	var username, output string
+
+	flags := flag.NewFlagSet("export", flag.ContinueOnError)
+	flags.StringVar(&username, "user", cfg.DefaultUser, "the username of the user whose data to export")
+	flags.StringVar(&output, "output", "", "the path of the archive to write (default \"<user>-<time>.zip\")")
+
+	if err := flags.Parse(args); err != nil {
+		return fmt.Errorf("error parsing flags: %w", err)
+	}
+
+	if output == "" {
+		output = export.FileName(username, time.Now())
+	}
+
+	f, err := os.Create(output)
+	if err != nil {
+		return fmt.Errorf("error creating archive: %w", err)
+	}
+
+	if err := www.Export(context.Background(), cfg, f, username); err != nil {
+		f.Close()         //nolint:errcheck
+		os.Remove(output) //nolint:errcheck
+
+		return fmt.Errorf("error exporting: %w", err)
+	}
+
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("error closing archive: %w", err)
+	}
+
+	fmt.Println(output)
+
+	return nil
+}
+
+// runExportAccounts writes a list of a user's accounts as CSV, which Mastodon
+// imports, to a file or to stdout.
+func runExportAccounts(cfg config.Config, list www.AccountList, args []string) error {
+	var username, output string
+
+	flags := flag.NewFlagSet("export "+string(list), flag.ContinueOnError)
+	flags.StringVar(&username, "user", cfg.DefaultUser, "the username of the user whose accounts to export")
+	flags.StringVar(&output, "output", "", "the path of the CSV file to write (default stdout)")
+
+	if err := flags.Parse(args); err != nil {
+		return fmt.Errorf("error parsing flags: %w", err)
+	}
+
+	if output == "" {
+		if err := www.ExportAccounts(context.Background(), cfg, os.Stdout, username, list); err != nil {
+			return fmt.Errorf("error exporting %s: %w", list, err)
+		}
+
+		return nil
+	}
+
+	f, err := os.Create(output)
+	if err != nil {
+		return fmt.Errorf("error creating file: %w", err)
+	}
+
+	if err := www.ExportAccounts(context.Background(), cfg, f, username, list); err != nil {
+		f.Close()         //nolint:errcheck
+		os.Remove(output) //nolint:errcheck
+
+		return fmt.Errorf("error exporting %s: %w", list, err)
+	}
+
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("error closing file: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,248 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httputil"
+	"os"
+	"strings"
+
+	ap "github.com/jclem/jclem.me/internal/activitypub"
+	"github.com/jclem/jclem.me/internal/activitypub/identity"
+	"github.com/jclem/jclem.me/internal/database"
+	"github.com/jclem/jclem.me/internal/webfinger"
+	"github.com/jclem/jclem.me/internal/www/config"
+)
+
+func runFed(cfg config.Config, args []string) error {
+	if len(args) < 2 || args[0] != "debug" {
+		return fmt.Errorf("usage: fed debug actor|verify|deliver [flags]")
+	}
+
+	args = args[1:]
+
+	switch args[0] {
+	case "actor":
+		return runFedDebugActor(args[1:])
+	case "verify":
+		return runFedDebugVerify(args[1:])
+	case "deliver":
+		return runFedDebugDeliver(cfg, args[1:])
+	default:
+		return fmt.Errorf("unknown fed debug command: %q", args[0])
+	}
+}
+
+// runFedDebugActor fetches a remote actor, by its ID or account address, and
+// prints it.
+func runFedDebugActor(args []string) error {
+	flags := flag.NewFlagSet("fed debug actor", flag.ContinueOnError)
+
+	if err := flags.Parse(args); err != nil {
+		return fmt.Errorf("error parsing flags: %w", err)
+	}
+
+	if flags.NArg() != 1 {
+		return errors.New("usage: fed debug actor <actor ID or user@domain>")
+	}
+
+	ctx := context.Background()
+
+	actorID, err := resolveActorID(ctx, flags.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	actor, err := ap.GetActor(ctx, actorID)
+	if err != nil {
+		return fmt.Errorf("error getting actor: %w", err)
+	}
+
+	return printJSON(actor)
+}
+
+// runFedDebugVerify reads a captured HTTP request, such as a delivery to an
+// inbox, and prints how its signature was made and whether it verifies against
+// its actor's keys.
+func runFedDebugVerify(args []string) error {
+	var actorID string
+
+	flags := flag.NewFlagSet("fed debug verify", flag.ContinueOnError)
+	flags.StringVar(&actorID, "actor", "", "the ID of the actor who sent the request (default the body's actor)")
+
+	if err := flags.Parse(args); err != nil {
+		return fmt.Errorf("error parsing flags: %w", err)
+	}
+
+	if flags.NArg() > 1 {
+		return errors.New("usage: fed debug verify [-actor <ID>] [request file]")
+	}
+
+	in := io.Reader(os.Stdin)
+
+	if flags.NArg() == 1 {
+		f, err := os.Open(flags.Arg(0))
+		if err != nil {
+			return fmt.Errorf("error opening request: %w", err)
+		}
+
+		defer f.Close()
+
+		in = f
+	}
+
+	req, err := http.ReadRequest(bufio.NewReader(in))
+	if err != nil {
+		return fmt.Errorf("error reading request: %w", err)
+	}
+
+	body, err := io.ReadAll(req.Body)
+	if err != nil {
+		return fmt.Errorf("error reading request body: %w", err)
+	}
+
+	if actorID == "" {
+		var activity struct {
+			Actor string `json:"actor"`
+		}
+
+		if err := json.Unmarshal(body, &activity); err != nil || activity.Actor == "" {
+			return errors.New("request body has no actor; pass -actor")
+		}
+
+		actorID = activity.Actor
+	}
+
+	return printJSON(ap.InspectSignature(context.Background(), req, body, actorID))
+}
+
+// runFedDebugDeliver signs an activity as a user for delivery to a remote
+// actor's inbox, and prints the signed request without sending it.
+func runFedDebugDeliver(cfg config.Config, args []string) error {
+	var username, activityPath string
+
+	flags := flag.NewFlagSet("fed debug deliver", flag.ContinueOnError)
+	flags.StringVar(&username, "user", cfg.DefaultUser, "the username of the user delivering the activity")
+	flags.StringVar(&activityPath, "activity", "-", `the path of the activity's JSON, or "-" for stdin`)
+
+	if err := flags.Parse(args); err != nil {
+		return fmt.Errorf("error parsing flags: %w", err)
+	}
+
+	if flags.NArg() != 1 {
+		return errors.New("usage: fed debug deliver [-user <username>] [-activity <file>] <actor ID or user@domain>")
+	}
+
+	body, err := readActivity(activityPath)
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+
+	actorID, err := resolveActorID(ctx, flags.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	actor, err := ap.GetActor(ctx, actorID)
+	if err != nil {
+		return fmt.Errorf("error getting actor: %w", err)
+	}
+
+	if actor.Inbox == "" {
+		return fmt.Errorf("actor has no inbox: %s", actor.ID)
+	}
+
+	pool, err := database.NewPool(ctx, cfg)
+	if err != nil {
+		return fmt.Errorf("failed to connect to database: %w", err)
+	}
+
+	defer pool.Close()
+
+	id, err := identity.NewService(pool)
+	if err != nil {
+		return fmt.Errorf("error creating identity service: %w", err)
+	}
+
+	user, err := id.GetUserByUsername(ctx, username)
+	if err != nil {
+		return fmt.Errorf("error getting user: %w", err)
+	}
+
+	req, err := ap.NewSignedActivityRequest(ctx, ap.NewSite(cfg), id, user.ID, http.MethodPost, actor.Inbox, body)
+	if err != nil {
+		return fmt.Errorf("error signing request: %w", err)
+	}
+
+	dump, err := httputil.DumpRequestOut(req, true)
+	if err != nil {
+		return fmt.Errorf("error writing request: %w", err)
+	}
+
+	if _, err := os.Stdout.Write(dump); err != nil {
+		return fmt.Errorf("error writing request: %w", err)
+	}
+
+	return nil
+}
+
+// readActivity reads an activity's JSON from a file, or from stdin if path is
+// "-", and checks that it is a JSON object.
+func readActivity(path string) ([]byte, error) {
+	var (
+		b   []byte
+		err error
+	)
+
+	if path == "-" {
+		b, err = io.ReadAll(os.Stdin)
+	} else {
+		b, err = os.ReadFile(path)
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("error reading activity: %w", err)
+	}
+
+	var activity map[string]any
+	if err := json.Unmarshal(b, &activity); err != nil {
+		return nil, fmt.Errorf("activity must be a JSON object: %w", err)
+	}
+
+	return bytes.TrimSpace(b), nil
+}
+
+// resolveActorID returns an actor ID as is, or resolves an account address,
+// such as "user@example.com", to its actor's ID.
+func resolveActorID(ctx context.Context, actor string) (string, error) {
+	if strings.HasPrefix(actor, "https://") || strings.HasPrefix(actor, "http://") {
+		return actor, nil
+	}
+
+	actorID, err := webfinger.ResolveActor(ctx, actor)
+	if err != nil {
+		return "", fmt.Errorf("error resolving actor: %w", err)
+	}
+
+	return actorID, nil
+}
+
+func printJSON(v any) error {
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "\t")
+
+	if err := enc.Encode(v); err != nil {
+		return fmt.Errorf("error encoding output: %w", err)
+	}
+
+	return nil
+}
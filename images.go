@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+
+	"github.com/jclem/jclem.me/internal/images"
+	"github.com/jclem/jclem.me/internal/markdown"
+	"github.com/jclem/jclem.me/internal/posts"
+	"github.com/jclem/jclem.me/internal/storage"
+	"github.com/jclem/jclem.me/internal/www/config"
+)
+
+func runImages(cfg config.Config, args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("usage: images generate [flags]")
+	}
+
+	switch args[0] {
+	case "generate":
+		return runImagesGenerate(cfg, args[1:])
+	default:
+		return fmt.Errorf("unknown images command: %q", args[0])
+	}
+}
+
+// runImagesGenerate generates resized variants of the images in embedded
+// posts which have none, and writes the manifest of variants, which is
+// embedded in the next build.
+func runImagesGenerate(cfg config.Config, args []string) error {
+	var output string
+
+	flags := flag.NewFlagSet("images generate", flag.ContinueOnError)
+	flags.StringVar(&output, "output", "internal/images/manifest.json", "the path of the manifest to write")
+
+	if err := flags.Parse(args); err != nil {
+		return fmt.Errorf("error parsing flags: %w", err)
+	}
+
+	spaces, err := storage.New(storage.Config{
+		KeyID:        cfg.SpacesKeyID,
+		Secret:       cfg.SpacesSecret,
+		Endpoint:     cfg.SpacesEndpoint,
+		Bucket:       cfg.SpacesBucket,
+		PublicURL:    cfg.SpacesPublicURL,
+		ACL:          cfg.SpacesACL,
+		CacheControl: cfg.SpacesCacheControl,
+	})
+	if err != nil {
+		return fmt.Errorf("error creating storage client: %w", err)
+	}
+
+	svc, err := images.New(nil, spaces)
+	if err != nil {
+		return fmt.Errorf("error creating images service: %w", err)
+	}
+
+	paths, err := fs.Glob(posts.Content, "*.md")
+	if err != nil {
+		return fmt.Errorf("error globbing posts: %w", err)
+	}
+
+	var urls []string
+
+	for _, path := range paths {
+		b, err := fs.ReadFile(posts.Content, path)
+		if err != nil {
+			return fmt.Errorf("error reading post: %w", err)
+		}
+
+		postURLs, err := markdown.ImageURLs(b)
+		if err != nil {
+			return fmt.Errorf("error finding images in %s: %w", path, err)
+		}
+
+		urls = append(urls, postURLs...)
+	}
+
+	if err := svc.Prepare(context.Background(), urls); err != nil {
+		return fmt.Errorf("error generating image variants: %w", err)
+	}
+
+	b, err := json.MarshalIndent(svc.Manifest(), "", "\t")
+	if err != nil {
+		return fmt.Errorf("error encoding manifest: %w", err)
+	}
+
+	if err := os.WriteFile(output, append(b, '\n'), 0o644); err != nil { //nolint:gosec
+		return fmt.Errorf("error writing manifest: %w", err)
+	}
+
+	return nil
+}
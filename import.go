@@ -0,0 +1,235 @@
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/jclem/jclem.me/internal/www"
+	"github.com/jclem/jclem.me/internal/www/config"
+)
+
+func runImport(cfg config.Config, args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("usage: import mastodon|following [flags] ...")
+	}
+
+	switch args[0] {
+	case "mastodon":
+		return runImportMastodon(cfg, args[1:])
+	case "following":
+		return runImportFollowing(cfg, args[1:])
+	default:
+		return fmt.Errorf("unknown import command: %q", args[0])
+	}
+}
+
+// runImportMastodon imports a Mastodon archive, which is a .tar.gz or .zip
+// file or an extracted directory, and a CSV file of followers, and prints the
+// counts of what was imported. Importing the same archive again imports only
+// what is new.
+func runImportMastodon(cfg config.Config, args []string) error {
+	var username, followersPath string
+
+	flags := flag.NewFlagSet("import mastodon", flag.ContinueOnError)
+	flags.StringVar(&username, "user", cfg.DefaultUser, "the username of the user to import into")
+	flags.StringVar(&followersPath, "followers", "", "the path of a CSV file of followers' accounts to import")
+
+	if err := flags.Parse(args); err != nil {
+		return fmt.Errorf("error parsing flags: %w", err)
+	}
+
+	if flags.NArg() > 1 || (flags.NArg() == 0 && followersPath == "") {
+		return errors.New("usage: import mastodon [-user <username>] [-followers <csv>] [archive]")
+	}
+
+	var archive fs.FS
+
+	if flags.NArg() == 1 {
+		fsys, closeArchive, err := openArchive(flags.Arg(0))
+		if err != nil {
+			return err
+		}
+
+		defer closeArchive() //nolint:errcheck
+
+		archive = fsys
+	}
+
+	var followers io.Reader
+
+	if followersPath != "" {
+		f, err := os.Open(followersPath)
+		if err != nil {
+			return fmt.Errorf("error opening followers: %w", err)
+		}
+
+		defer f.Close()
+
+		followers = f
+	}
+
+	result, err := www.ImportMastodon(context.Background(), cfg, username, archive, followers)
+	if err != nil {
+		return fmt.Errorf("error importing: %w", err)
+	}
+
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "\t")
+
+	if err := enc.Encode(result); err != nil {
+		return fmt.Errorf("error encoding result: %w", err)
+	}
+
+	return nil
+}
+
+// runImportFollowing follows each account in a CSV file of follows, such as
+// one Mastodon exports, which the user does not already follow, and prints the
+// counts of what was followed. The Follows are delivered once the server works
+// its jobs.
+func runImportFollowing(cfg config.Config, args []string) error {
+	var username string
+
+	flags := flag.NewFlagSet("import following", flag.ContinueOnError)
+	flags.StringVar(&username, "user", cfg.DefaultUser, "the username of the user who follows the accounts")
+
+	if err := flags.Parse(args); err != nil {
+		return fmt.Errorf("error parsing flags: %w", err)
+	}
+
+	if flags.NArg() != 1 {
+		return errors.New("usage: import following [-user <username>] <csv>")
+	}
+
+	f, err := os.Open(flags.Arg(0))
+	if err != nil {
+		return fmt.Errorf("error opening following: %w", err)
+	}
+
+	defer f.Close()
+
+	result, err := www.ImportFollowing(context.Background(), cfg, username, f)
+	if err != nil {
+		return fmt.Errorf("error importing: %w", err)
+	}
+
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "\t")
+
+	if err := enc.Encode(result); err != nil {
+		return fmt.Errorf("error encoding result: %w", err)
+	}
+
+	return nil
+}
+
+// openArchive opens an archive as a file system. A .tar.gz archive, as Mastodon
+// exports, is extracted to a temporary directory, which close removes.
+func openArchive(name string) (fs.FS, func() error, error) {
+	switch {
+	case strings.HasSuffix(name, ".zip"):
+		r, err := zip.OpenReader(name)
+		if err != nil {
+			return nil, nil, fmt.Errorf("error opening archive: %w", err)
+		}
+
+		return r, r.Close, nil
+	case strings.HasSuffix(name, ".tar.gz"), strings.HasSuffix(name, ".tgz"):
+		dir, err := os.MkdirTemp("", "mastodon-import-")
+		if err != nil {
+			return nil, nil, fmt.Errorf("error creating directory: %w", err)
+		}
+
+		closeDir := func() error { return os.RemoveAll(dir) }
+
+		if err := extractTarGz(name, dir); err != nil {
+			closeDir() //nolint:errcheck
+			return nil, nil, err
+		}
+
+		return os.DirFS(dir), closeDir, nil
+	default:
+		info, err := os.Stat(name)
+		if err != nil {
+			return nil, nil, fmt.Errorf("error opening archive: %w", err)
+		}
+
+		if !info.IsDir() {
+			return nil, nil, fmt.Errorf("archive must be a .tar.gz or .zip file or a directory: %q", name)
+		}
+
+		return os.DirFS(name), func() error { return nil }, nil
+	}
+}
+
+// extractTarGz extracts the regular files in a .tar.gz file into dir. Entries
+// whose names would escape dir are skipped.
+func extractTarGz(name, dir string) error {
+	f, err := os.Open(name)
+	if err != nil {
+		return fmt.Errorf("error opening archive: %w", err)
+	}
+
+	defer f.Close()
+
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		return fmt.Errorf("error reading archive: %w", err)
+	}
+
+	tr := tar.NewReader(gz)
+
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+
+		if err != nil {
+			return fmt.Errorf("error reading archive: %w", err)
+		}
+
+		if hdr.Typeflag != tar.TypeReg || !filepath.IsLocal(hdr.Name) {
+			continue
+		}
+
+		path := filepath.Join(dir, hdr.Name)
+
+		if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+			return fmt.Errorf("error creating directory: %w", err)
+		}
+
+		if err := extractFile(path, tr); err != nil {
+			return err
+		}
+	}
+}
+
+func extractFile(path string, r io.Reader) error {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o600)
+	if err != nil {
+		return fmt.Errorf("error creating file: %w", err)
+	}
+
+	if _, err := io.Copy(f, r); err != nil { //nolint:gosec
+		f.Close() //nolint:errcheck
+		return fmt.Errorf("error extracting file: %w", err)
+	}
+
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("error closing file: %w", err)
+	}
+
+	return nil
+}
@@ -6,38 +6,88 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+
+	"github.com/jclem/jclem.me/internal/telemetry"
+	"github.com/jclem/jclem.me/internal/www/config"
 )
 
 // ContentType is the content type for ActivityPub requests and responses.
 const ContentType = "application/activity+json; charset=utf-8"
 
-// Domain is the domain of the server.
-const Domain = "pub.jclem.me"
+// PathPrefix is the path under which ActivityPub is served in single-domain
+// mode.
+const PathPrefix = "/pub"
+
+// A Site is where ActivityPub objects are served, from which the IDs of users'
+// actors and their objects are built.
+type Site struct {
+	// Domain is the domain of users' handles.
+	Domain string
+
+	// BaseURL is the URL under which ActivityPub objects are served.
+	BaseURL string
+
+	// DefaultUser is the username of the user whose actor is served at
+	// BaseURL.
+	DefaultUser string
+}
+
+// NewSite returns the Site configured by cfg. In single-domain mode, objects
+// are served under PathPrefix of the web domain, or of localhost in
+// development.
+func NewSite(cfg config.Config) Site {
+	site := Site{
+		Domain:      cfg.PubDomain,
+		BaseURL:     "https://" + cfg.PubDomain,
+		DefaultUser: cfg.DefaultUser,
+	}
+
+	if cfg.SingleDomain {
+		scheme := "http"
+		if cfg.URLUseHTTPS() {
+			scheme = "https"
+		}
+
+		site.Domain = cfg.URLHostname()
+		site.BaseURL = fmt.Sprintf("%s://%s%s", scheme, cfg.URLHostname(), PathPrefix)
+	}
+
+	return site
+}
 
 // GetActor requests an actor by their ID.
 func GetActor(ctx context.Context, actorID string) (Actor, error) {
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet, actorID, nil)
+	var actor Actor
+	if err := getObject(ctx, actorID, &actor); err != nil {
+		return Actor{}, err
+	}
+
+	return actor, nil
+}
+
+// getObject requests an object by its ID and decodes it into v.
+func getObject(ctx context.Context, id string, v any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, id, nil)
 	if err != nil {
-		return Actor{}, fmt.Errorf("failed to create request: %w", err)
+		return fmt.Errorf("failed to create request: %w", err)
 	}
 
 	req.Header.Set("Accept", ContentType)
 
-	resp, err := http.DefaultClient.Do(req)
+	resp, err := telemetry.HTTPClient.Do(req)
 	if err != nil {
-		return Actor{}, fmt.Errorf("failed to perform request: %w", err)
+		return fmt.Errorf("failed to perform request: %w", err)
 	}
 
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		return Actor{}, fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+		return fmt.Errorf("unexpected status code: %d", resp.StatusCode)
 	}
 
-	var actor Actor
-	if err := json.NewDecoder(resp.Body).Decode(&actor); err != nil {
-		return Actor{}, fmt.Errorf("failed to decode actor: %w", err)
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		return fmt.Errorf("failed to decode object: %w", err)
 	}
 
-	return actor, nil
+	return nil
 }
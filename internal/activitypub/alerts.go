@@ -0,0 +1,139 @@
+package activitypub
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strconv"
+
+	"github.com/jclem/jclem.me/internal/errorreport"
+	"github.com/jclem/jclem.me/internal/webhooks"
+	"github.com/riverqueue/river"
+	"github.com/riverqueue/river/rivertype"
+)
+
+// alertConfig configures alerts about failing deliveries.
+type alertConfig struct {
+	// failureRate is the share of deliveries to a host during a metrics
+	// interval which must fail for the host to be reported as failing. If it
+	// is zero, hosts are not reported.
+	failureRate float64
+
+	// minDeliveries is the least number of deliveries to a host during a
+	// metrics interval for its failure rate to be considered.
+	minDeliveries int
+}
+
+// An errorHandler reports a job's panics, and emits a webhook and reports the
+// error when a job fails for the last time. It implements the
+// river.ErrorHandler interface.
+type errorHandler struct {
+	pub *Service
+}
+
+// HandleError implements the river.ErrorHandler interface.
+func (h errorHandler) HandleError(ctx context.Context, job *rivertype.JobRow, err error) *river.ErrorHandlerResult {
+	if job.Attempt >= job.MaxAttempts {
+		errorreport.Report(jobScope(ctx, job), err, "job discarded")
+	}
+
+	h.jobFailed(ctx, job, err.Error())
+
+	return nil
+}
+
+// HandlePanic implements the river.ErrorHandler interface.
+func (h errorHandler) HandlePanic(ctx context.Context, job *rivertype.JobRow, panicVal any) *river.ErrorHandlerResult {
+	// River has already recovered the panic, so its stack is River's rather
+	// than the worker's, which River logs.
+	errorreport.ReportPanic(jobScope(ctx, job), panicVal)
+	h.jobFailed(ctx, job, fmt.Sprintf("panic: %v", panicVal))
+
+	return nil
+}
+
+// jobScope returns a context whose errors are reported with a job's kind,
+// ID, queue, and attempt.
+func jobScope(ctx context.Context, job *rivertype.JobRow) context.Context {
+	ctx = errorreport.WithScope(ctx)
+
+	errorreport.SetTag(ctx, "job.kind", job.Kind)
+	errorreport.SetTag(ctx, "job.id", strconv.FormatInt(job.ID, 10))
+	errorreport.SetTag(ctx, "job.queue", job.Queue)
+	errorreport.SetTag(ctx, "job.attempt", strconv.Itoa(job.Attempt))
+
+	return ctx
+}
+
+func (h errorHandler) jobFailed(ctx context.Context, job *rivertype.JobRow, message string) {
+	if job.Attempt < job.MaxAttempts {
+		return
+	}
+
+	slog.ErrorContext(ctx, "job discarded", "kind", job.Kind, "job_id", job.ID, "attempt", job.Attempt, "error", message)
+
+	// A webhook whose delivery was discarded is not reported with another
+	// webhook, which would likely be discarded too.
+	if job.Kind == (webhooks.DeliverArgs{}).Kind() {
+		return
+	}
+
+	if err := h.pub.emitWebhook(ctx, nil, webhooks.NewEvent(webhooks.JobDiscarded, map[string]any{
+		"job_id":  job.ID,
+		"kind":    job.Kind,
+		"queue":   job.Queue,
+		"attempt": job.Attempt,
+		"error":   message,
+	})); err != nil {
+		slog.ErrorContext(ctx, "failed to emit job discarded webhook", "error", err)
+	}
+}
+
+// reportMetrics logs the counts of jobs and deliveries during a metrics
+// interval, and emits a webhook for each host which began failing during it.
+//
+// It is only called by the metrics goroutine, which owns failingHosts.
+func (s *Service) reportMetrics(ctx context.Context, snapshot metricsSnapshot) {
+	snapshot.log(ctx)
+
+	if s.alerts.failureRate == 0 {
+		return
+	}
+
+	for host := range snapshot.Deliveries {
+		total, failed := snapshot.deliveries(host)
+		if total < s.alerts.minDeliveries {
+			continue
+		}
+
+		rate := float64(failed) / float64(total)
+
+		if rate < s.alerts.failureRate {
+			if s.failingHosts[host] {
+				slog.InfoContext(ctx, "deliveries to host recovered", "host", host, "total", total, "failed", failed)
+				delete(s.failingHosts, host)
+			}
+
+			continue
+		}
+
+		// A host is reported once, until its deliveries recover.
+		if s.failingHosts[host] {
+			continue
+		}
+
+		s.failingHosts[host] = true
+
+		slog.WarnContext(ctx, "deliveries to host are failing", "host", host, "total", total, "failed", failed)
+
+		if err := s.emitWebhook(ctx, nil, webhooks.NewEvent(webhooks.DeliveryHostFailing, map[string]any{
+			"host":         host,
+			"total":        total,
+			"failed":       failed,
+			"failure_rate": rate,
+			"statuses":     snapshot.Deliveries[host],
+		})); err != nil {
+			slog.ErrorContext(ctx, "failed to emit failing host webhook", "error", err)
+		}
+	}
+}
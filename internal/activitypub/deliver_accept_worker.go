@@ -0,0 +1,174 @@
+package activitypub
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+
+	"github.com/jclem/jclem.me/internal/activitypub/identity"
+	"github.com/jclem/jclem.me/internal/database"
+	"github.com/jclem/jclem.me/internal/queues"
+	"github.com/jclem/jclem.me/internal/telemetry"
+	"github.com/riverqueue/river"
+)
+
+// DeliverAcceptArgs are the arguments of a job which delivers an Accept of an
+// activity to the inbox of the actor who sent it.
+type DeliverAcceptArgs struct {
+	// UserRecordID is the ID of the user accepting the activity.
+	UserRecordID database.ULID `json:"user_record_id"`
+
+	// ActivityID is the object ID of the activity being accepted.
+	ActivityID string `json:"activity_id"`
+
+	// ActorID is the object ID of the actor who sent the activity.
+	ActorID string `json:"actor_id"`
+
+	// AcceptRecordID is the record ID of the Accept, which is recorded in the
+	// user's outbox when it is first delivered, so that every attempt
+	// delivers the same Accept. Jobs enqueued before Accepts were recorded
+	// have none.
+	AcceptRecordID database.ULID `json:"accept_record_id"`
+
+	// Trace is the trace context of the job which enqueued the job.
+	Trace telemetry.Carrier `json:"trace,omitempty"`
+}
+
+// Kind implements the river.JobArgs interface.
+func (a DeliverAcceptArgs) Kind() string {
+	return "deliver-accept"
+}
+
+// InsertOpts implements the river.JobArgsWithInsertOpts interface.
+func (a DeliverAcceptArgs) InsertOpts() river.InsertOpts {
+	return river.InsertOpts{Queue: queues.Delivery}
+}
+
+// enqueueAccept enqueues delivery of an Accept of an activity in the given
+// transaction, so that it is delivered only if the activity's effects are
+// committed.
+func (s *Service) enqueueAccept(ctx context.Context, tx Tx, userRecordID database.ULID, activityID, actorID string) error {
+	args := DeliverAcceptArgs{
+		UserRecordID:   userRecordID,
+		ActivityID:     activityID,
+		ActorID:        actorID,
+		AcceptRecordID: database.NewULID(),
+		Trace:          telemetry.Inject(ctx),
+	}
+
+	if err := tx.Enqueue(ctx, args, nil); err != nil {
+		return fmt.Errorf("failed to insert accept job: %w", err)
+	}
+
+	return nil
+}
+
+// A DeliverAcceptWorker delivers Accept activities.
+type DeliverAcceptWorker struct {
+	river.WorkerDefaults[DeliverAcceptArgs]
+	id  *identity.Service
+	pub *Service
+}
+
+func newDeliverAcceptWorker(pub *Service, id *identity.Service) *DeliverAcceptWorker {
+	return &DeliverAcceptWorker{id: id, pub: pub}
+}
+
+// Work implements the river.Worker interface.
+func (w *DeliverAcceptWorker) Work(ctx context.Context, job *river.Job[DeliverAcceptArgs]) (err error) {
+	ctx, span := telemetry.StartJob(ctx, job.Kind, job.Attempt, job.Args.Trace)
+	defer func() { telemetry.End(span, err) }()
+
+	user, err := w.id.GetUserByID(ctx, job.Args.UserRecordID)
+	if err != nil {
+		err = fmt.Errorf("failed to get user: %w", err)
+		if errors.Is(err, identity.ErrUserNotFound) {
+			return river.JobCancel(err) //nolint:wrapcheck
+		}
+
+		return err
+	}
+
+	actor, err := GetActor(ctx, job.Args.ActorID)
+	if err != nil {
+		return fmt.Errorf("error getting actor: %w", err)
+	}
+
+	inboxURL := actor.Inbox
+	if inboxURL == "" {
+		return river.JobCancel(fmt.Errorf("actor has no inbox: %s", actor.ID)) //nolint:wrapcheck
+	}
+
+	j, err := w.recordAccept(ctx, user, job.Args)
+	if err != nil {
+		return err
+	}
+
+	req, err := NewSignedActivityRequest(ctx, w.pub.site, w.id, job.Args.UserRecordID, http.MethodPost, inboxURL, j)
+	if err != nil {
+		return err
+	}
+
+	resp, err := telemetry.HTTPClient.Do(req)
+	w.pub.metrics.recordDelivery(req.URL.Host, resp)
+
+	if err != nil {
+		return fmt.Errorf("error posting accept: %w", err)
+	}
+
+	defer func() {
+		if err := resp.Body.Close(); err != nil {
+			slog.ErrorContext(ctx, "error closing accept response body", "error", err)
+		}
+	}()
+
+	if !(200 <= resp.StatusCode && resp.StatusCode < 300) {
+		if resp.StatusCode >= 500 {
+			return fmt.Errorf("error posting accept: %s", resp.Status)
+		}
+
+		return river.JobCancel(fmt.Errorf("error posting accept: %s", resp.Status)) //nolint:wrapcheck
+	}
+
+	return nil
+}
+
+// recordAccept returns the Accept which a job delivers, recording it in the
+// user's outbox if it has not been already.
+func (w *DeliverAcceptWorker) recordAccept(ctx context.Context, user identity.User, args DeliverAcceptArgs) ([]byte, error) {
+	recordID := args.AcceptRecordID
+	if recordID == (database.ULID{}) {
+		recordID = database.NewULID()
+	}
+
+	accept := newAcceptActivity(w.pub.site, user, recordID, args.ActivityID, args.ActorID)
+
+	ar, err := w.pub.GetActivityByID(ctx, args.UserRecordID, accept.ID)
+	if err == nil {
+		return ar.Data, nil
+	}
+
+	if !errors.Is(err, ErrActivityNotFound) {
+		return nil, fmt.Errorf("failed to get accept: %w", err)
+	}
+
+	j, err := json.Marshal(accept)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal accept: %w", err)
+	}
+
+	// The Accept is only recorded, and not delivered to followers, as the
+	// user's other activities are.
+	err = w.pub.store.Tx(ctx, func(tx Tx) error {
+		_, err := w.pub.insertActivityRecord(ctx, tx, args.UserRecordID, Outbox, ActivityStreamsContext, accept.Type, accept.ID, j)
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to record accept: %w", err)
+	}
+
+	return j, nil
+}
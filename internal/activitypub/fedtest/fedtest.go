@@ -0,0 +1,391 @@
+// Package fedtest emulates a remote ActivityPub instance, so that federation
+// can be tested without network calls.
+//
+// A Server serves one actor, its inbox, and WebFinger over TLS on a loopback
+// address. It records the activities delivered to its inbox, and sends
+// activities as its actor, such as a Follow, signed as Mastodon signs them.
+// Starting a Server makes telemetry.HTTPClient trust it until the test ends, so
+// tests which use it must not run in parallel.
+package fedtest
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-fed/httpsig"
+	ap "github.com/jclem/jclem.me/internal/activitypub"
+	"github.com/jclem/jclem.me/internal/database"
+	"github.com/jclem/jclem.me/internal/telemetry"
+	"github.com/jclem/jclem.me/internal/webfinger"
+)
+
+// A Server is a remote instance with one actor.
+type Server struct {
+	// Username is the actor's username.
+	Username string
+
+	srv *httptest.Server
+	key *rsa.PrivateKey
+
+	mu                sync.Mutex
+	deliveries        []Delivery
+	status            int
+	actorStatus       int
+	actorRequests     int
+	subscribeTemplate string
+}
+
+// A Delivery is a request made to the actor's inbox.
+type Delivery struct {
+	// Activity is the delivered activity.
+	Activity ap.Activity[json.RawMessage]
+
+	// Request is the request which delivered it. Its body has been read.
+	Request *http.Request
+	Body    []byte
+}
+
+// NewServer starts a Server whose actor has the given username. It is closed
+// when the test ends.
+func NewServer(t testing.TB, username string) *Server {
+	t.Helper()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("error generating key: %v", err)
+	}
+
+	s := &Server{Username: username, key: key, status: http.StatusAccepted}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/users/"+username, s.serveActor)
+	mux.HandleFunc("/users/"+username+"/inbox", s.serveInbox)
+	mux.HandleFunc(webfinger.Path, s.serveWebFinger)
+
+	s.srv = httptest.NewTLSServer(mux)
+	t.Cleanup(s.srv.Close)
+
+	// Every httptest server has the same certificate, so one transport trusts
+	// them all. Public requests are also let through to the server, which is
+	// on a loopback address.
+	transport, publicTransport := telemetry.HTTPClient.Transport, telemetry.PublicHTTPClient.Transport
+	telemetry.HTTPClient.Transport = s.srv.Client().Transport
+	telemetry.PublicHTTPClient.Transport = s.srv.Client().Transport
+
+	t.Cleanup(func() {
+		telemetry.HTTPClient.Transport = transport
+		telemetry.PublicHTTPClient.Transport = publicTransport
+	})
+
+	s.subscribeTemplate = s.srv.URL + "/authorize_interaction?uri={uri}"
+
+	return s
+}
+
+// Domain returns the server's host and port, as used in account addresses.
+func (s *Server) Domain() string {
+	return strings.TrimPrefix(s.srv.URL, "https://")
+}
+
+// Address returns the actor's account address, such as "bob@127.0.0.1:1234".
+func (s *Server) Address() string {
+	return s.Username + "@" + s.Domain()
+}
+
+// ActorID returns the actor's ID.
+func (s *Server) ActorID() string {
+	return s.srv.URL + "/users/" + s.Username
+}
+
+// Inbox returns the URL of the actor's inbox.
+func (s *Server) Inbox() string {
+	return s.ActorID() + "/inbox"
+}
+
+// KeyID returns the ID of the actor's key.
+func (s *Server) KeyID() string {
+	return s.ActorID() + "#main-key"
+}
+
+// Actor returns the actor which the server serves.
+func (s *Server) Actor() (ap.Actor, error) {
+	der, err := x509.MarshalPKIXPublicKey(&s.key.PublicKey)
+	if err != nil {
+		return ap.Actor{}, fmt.Errorf("error marshaling public key: %w", err)
+	}
+
+	return ap.Actor{
+		Context:           ap.NewContext(ap.ActivityStreamsContext, ap.SecurityContext),
+		Type:              "Person",
+		ID:                s.ActorID(),
+		Inbox:             s.Inbox(),
+		PreferredUsername: s.Username,
+		PublicKey: ap.PublicKeys{{
+			ID:           s.KeyID(),
+			Owner:        s.ActorID(),
+			PublicKeyPem: string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})),
+		}},
+	}, nil
+}
+
+// SetInboxStatus sets the status with which the inbox responds to deliveries,
+// such as to emulate a failing server. Deliveries are recorded regardless.
+func (s *Server) SetInboxStatus(status int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.status = status
+}
+
+// SetActorStatus sets the status with which the actor, with its key, is served,
+// such as http.StatusGone to emulate a deleted actor, or, if it is zero, serves
+// it as usual.
+func (s *Server) SetActorStatus(status int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.actorStatus = status
+}
+
+// SetSubscribeTemplate sets the template of the subscribe link of the actor's
+// WebFinger resource, at which it follows other actors.
+func (s *Server) SetSubscribeTemplate(template string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.subscribeTemplate = template
+}
+
+// ActorRequests returns how many times the actor, with its key, was requested.
+func (s *Server) ActorRequests() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.actorRequests
+}
+
+// Deliveries returns the requests made to the actor's inbox, in the order in
+// which they were made.
+func (s *Server) Deliveries() []Delivery {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]Delivery(nil), s.deliveries...)
+}
+
+// An Activity is an activity sent by the actor. Its context is usually one
+// string, as Mastodon writes it, but may be an array, as Pleroma and Misskey
+// write it.
+type Activity struct {
+	Context any    `json:"@context,omitempty"`
+	Type    string `json:"type"`
+	ID      string `json:"id"`
+	Actor   string `json:"actor"`
+	Object  any    `json:"object"`
+}
+
+// Follow sends a Follow of an actor to its inbox, returning the Follow.
+func (s *Server) Follow(ctx context.Context, inbox, actorID string) (Activity, error) {
+	follow := Activity{
+		Context: ap.ActivityStreamsContext,
+		Type:    "Follow",
+		ID:      s.newActivityID(),
+		Actor:   s.ActorID(),
+		Object:  actorID,
+	}
+
+	return follow, s.Send(ctx, inbox, follow)
+}
+
+// Unfollow sends an Undo of a Follow to the inbox of the followed actor.
+func (s *Server) Unfollow(ctx context.Context, inbox string, follow Activity) error {
+	follow.Context = nil
+
+	return s.Send(ctx, inbox, Activity{
+		Context: ap.ActivityStreamsContext,
+		Type:    "Undo",
+		ID:      s.newActivityID(),
+		Actor:   s.ActorID(),
+		Object:  follow,
+	})
+}
+
+func (s *Server) newActivityID() string {
+	return fmt.Sprintf("%s/activities/%s", s.ActorID(), database.NewULID())
+}
+
+// Send posts an activity to an inbox, signed with the actor's key. It returns
+// an error unless the inbox responds with a 2xx status.
+func (s *Server) Send(ctx context.Context, inbox string, activity Activity) error {
+	body, err := json.Marshal(activity)
+	if err != nil {
+		return fmt.Errorf("error encoding activity: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, inbox, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("error creating request: %w", err)
+	}
+
+	req.Header.Set("Content-Type", ap.ContentType)
+	req.Header.Set("Date", time.Now().UTC().Format(http.TimeFormat))
+
+	if err := s.sign(req, body); err != nil {
+		return err
+	}
+
+	resp, err := s.srv.Client().Do(req)
+	if err != nil {
+		return fmt.Errorf("error sending activity: %w", err)
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		b, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("error sending activity: %s: %s", resp.Status, b)
+	}
+
+	return nil
+}
+
+// sign signs a request as Mastodon does, with an rsa-sha256 signature of its
+// target, date, and digest.
+func (s *Server) sign(r *http.Request, body []byte) error {
+	digest := sha256.Sum256(body)
+	r.Header.Set("Digest", "SHA-256="+base64.StdEncoding.EncodeToString(digest[:]))
+
+	signed := strings.Join([]string{
+		"(request-target): " + strings.ToLower(r.Method) + " " + r.URL.RequestURI(),
+		"date: " + r.Header.Get("Date"),
+		"digest: " + r.Header.Get("Digest"),
+	}, "\n")
+
+	hashed := sha256.Sum256([]byte(signed))
+
+	signature, err := rsa.SignPKCS1v15(rand.Reader, s.key, crypto.SHA256, hashed[:])
+	if err != nil {
+		return fmt.Errorf("error signing request: %w", err)
+	}
+
+	r.Header.Set("Signature", fmt.Sprintf(`keyId="%s",algorithm="rsa-sha256",headers="(request-target) date digest",signature="%s"`,
+		s.KeyID(), base64.StdEncoding.EncodeToString(signature)))
+
+	return nil
+}
+
+// Verify returns an error unless the delivery was signed with the private key
+// of publicKeyPEM, an RSA or Ed25519 key, such as one of the sending actor's
+// keys.
+func (d Delivery) Verify(publicKeyPEM string) error {
+	block, _ := pem.Decode([]byte(publicKeyPEM))
+	if block == nil {
+		return errors.New("error decoding public key")
+	}
+
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return fmt.Errorf("error parsing public key: %w", err)
+	}
+
+	algo := httpsig.RSA_SHA256
+	if _, ok := key.(ed25519.PublicKey); ok {
+		algo = httpsig.ED25519
+	}
+
+	verifier, err := httpsig.NewVerifier(d.Request)
+	if err != nil {
+		return fmt.Errorf("error creating verifier: %w", err)
+	}
+
+	if err := verifier.Verify(key, algo); err != nil {
+		return fmt.Errorf("error verifying request: %w", err)
+	}
+
+	return nil
+}
+
+func (s *Server) serveActor(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	s.actorRequests++
+	status := s.actorStatus
+	s.mu.Unlock()
+
+	if status != 0 {
+		w.WriteHeader(status)
+		return
+	}
+
+	actor, err := s.Actor()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", ap.ContentType)
+	json.NewEncoder(w).Encode(actor) //nolint:errcheck,errchkjson
+}
+
+func (s *Server) serveInbox(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var activity ap.Activity[json.RawMessage]
+	if err := json.Unmarshal(body, &activity); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	s.mu.Lock()
+	s.deliveries = append(s.deliveries, Delivery{Activity: activity, Request: r, Body: body})
+	status := s.status
+	s.mu.Unlock()
+
+	w.WriteHeader(status)
+}
+
+func (s *Server) serveWebFinger(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Query().Get("resource") != "acct:"+s.Address() {
+		http.NotFound(w, r)
+		return
+	}
+
+	s.mu.Lock()
+	subscribeTemplate := s.subscribeTemplate
+	s.mu.Unlock()
+
+	w.Header().Set("Content-Type", webfinger.ContentType)
+	json.NewEncoder(w).Encode(webfinger.JRD{ //nolint:errcheck,errchkjson
+		Subject: "acct:" + s.Address(),
+		Links: []webfinger.Link{
+			{Rel: webfinger.SelfRel, Type: ap.ContentType, Href: s.ActorID()},
+			{Rel: webfinger.SubscribeRel, Template: subscribeTemplate},
+		},
+	})
+}
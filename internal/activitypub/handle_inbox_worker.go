@@ -6,10 +6,12 @@ import (
 	"errors"
 	"fmt"
 	"log/slog"
-	"net/http"
 
-	"github.com/jclem/jclem.me/internal/activitypub/identity"
 	"github.com/jclem/jclem.me/internal/database"
+	"github.com/jclem/jclem.me/internal/events"
+	"github.com/jclem/jclem.me/internal/queues"
+	"github.com/jclem/jclem.me/internal/telemetry"
+	"github.com/jclem/jclem.me/internal/webhooks"
 	"github.com/riverqueue/river"
 )
 
@@ -19,19 +21,29 @@ type HandleInboxArgs struct {
 
 	// UserRecordID is the ID of the user that the activity is for.
 	UserRecordID database.ULID `json:"user_record_id"`
+
+	// Trace is the trace context of the request which enqueued the job.
+	Trace telemetry.Carrier `json:"trace,omitempty"`
 }
 
 func (a HandleInboxArgs) Kind() string {
 	return "handle-inbox"
 }
 
+// InsertOpts implements the river.JobArgsWithInsertOpts interface.
+func (a HandleInboxArgs) InsertOpts() river.InsertOpts {
+	return river.InsertOpts{Queue: queues.Inbox}
+}
+
 type HandleInboxWorker struct {
 	river.WorkerDefaults[HandleInboxArgs]
 	pub *Service
-	id  *identity.Service
 }
 
-func (w *HandleInboxWorker) Work(ctx context.Context, job *river.Job[HandleInboxArgs]) error {
+func (w *HandleInboxWorker) Work(ctx context.Context, job *river.Job[HandleInboxArgs]) (err error) {
+	ctx, span := telemetry.StartJob(ctx, job.Kind, job.Attempt, job.Args.Trace)
+	defer func() { telemetry.End(span, err) }()
+
 	ar, err := w.pub.GetActivityByID(ctx, job.Args.UserRecordID, job.Args.ActivityID)
 	if err != nil {
 		err = fmt.Errorf("failed to get activity: %w", err)
@@ -57,30 +69,59 @@ func (w *HandleInboxWorker) Work(ctx context.Context, job *river.Job[HandleInbox
 	return nil
 }
 
+// handleFollow records the follower, and enqueues delivery of the Accept and
+// the follower webhook, in one transaction, so that a follower is never
+// recorded without being accepted. Once they are, it publishes an event.
 func (w *HandleInboxWorker) handleFollow(ctx context.Context, userRecordID database.ULID, ar ActivityRecord, ao Activity[any]) error {
-	if err := w.createFollower(ctx, userRecordID, ar, ao.Actor); err != nil {
-		slog.ErrorContext(ctx, "failed to create follower", "error", err)
-		return err
+	if ar.Type != followActivityType {
+		return river.JobCancel(fmt.Errorf("activity is not a follow: %s", ar.Type)) //nolint:wrapcheck
 	}
 
-	if err := w.acceptActivity(ctx, userRecordID, ar, ao.Actor); err != nil {
+	err := w.pub.store.Tx(ctx, func(tx Tx) error {
+		if _, err := w.pub.createFollower(ctx, tx, userRecordID, ao.Actor, ar.ID); err != nil {
+			return fmt.Errorf("failed to create follower: %w", err)
+		}
+
+		if err := w.pub.enqueueAccept(ctx, tx, userRecordID, ar.ID, ao.Actor); err != nil {
+			return err
+		}
+
+		return w.pub.emitWebhook(ctx, tx, webhooks.NewEvent(webhooks.FollowerCreated, map[string]any{
+			"user_id":     userRecordID,
+			"actor_id":    ao.Actor,
+			"activity_id": ar.ID,
+		}))
+	})
+	if err != nil {
 		slog.ErrorContext(ctx, "failed to accept follower", "error", err)
-		return err
+		return fmt.Errorf("failed to accept follower: %w", err)
 	}
 
+	w.pub.publishEvent(ctx, events.New(events.FollowerCreated, map[string]any{
+		"user_id":  userRecordID,
+		"actor_id": ao.Actor,
+	}))
+
 	return nil
 }
 
+// handleUndo deletes the follower who undid their follow, and enqueues
+// delivery of the Accept, in one transaction. Undos of anything but a follow
+// are ignored.
 func (w *HandleInboxWorker) handleUndo(ctx context.Context, userRecordID database.ULID, ar ActivityRecord, ao Activity[any]) error {
-	// Serialize and deserialize the activity's object to get an Activity[string] struct (the follow).
-	j, err := json.Marshal(ao.Object)
-	if err != nil {
-		return fmt.Errorf("failed to marshal object: %w", err)
+	var undo Activity[json.RawMessage]
+	if err := json.Unmarshal(ar.Data, &undo); err != nil {
+		return river.JobCancel(fmt.Errorf("failed to unmarshal activity data: %w", err)) //nolint:wrapcheck
 	}
 
-	var undoneActivity Activity[any]
-	if err := json.Unmarshal(j, &undoneActivity); err != nil {
-		return river.JobCancel(fmt.Errorf("failed to unmarshal object: %w", err)) //nolint:wrapcheck
+	undoneActivity, err := w.undoneActivity(ctx, userRecordID, undo.Object)
+	if err != nil {
+		if errors.Is(err, ErrActivityNotFound) {
+			slog.InfoContext(ctx, "ignoring undo of unknown activity", "activity_id", ar.ID, "object_id", referencedID(undo.Object))
+			return nil
+		}
+
+		return err
 	}
 
 	// Ensure the undo actor and the activity actor are the same.
@@ -89,91 +130,60 @@ func (w *HandleInboxWorker) handleUndo(ctx context.Context, userRecordID databas
 	}
 
 	if undoneActivity.Type != followActivityType {
-		return river.JobCancel(fmt.Errorf("activity is not a follow: %s", undoneActivity.Type)) //nolint:wrapcheck
+		slog.InfoContext(ctx, "ignoring undo of non-follow activity", "activity_id", ar.ID, "activity_type", undoneActivity.Type)
+		return nil
 	}
 
-	if err := w.pub.DeleteFollower(ctx, userRecordID, undoneActivity.Actor); err != nil {
-		return fmt.Errorf("failed to delete follower: %w", err)
-	}
-
-	if err := w.acceptActivity(ctx, userRecordID, ar, ao.Actor); err != nil {
-		return fmt.Errorf("failed to accept undo: %w", err)
-	}
-
-	return nil
-}
+	err = w.pub.store.Tx(ctx, func(tx Tx) error {
+		deleted, err := tx.DeleteFollower(ctx, userRecordID, undoneActivity.Actor)
+		if err != nil {
+			return fmt.Errorf("failed to delete follower: %w", err)
+		}
 
-func (w *HandleInboxWorker) createFollower(ctx context.Context, userRecordID database.ULID, activity ActivityRecord, actorID string) error {
-	if activity.Type != followActivityType {
-		return river.JobCancel(fmt.Errorf("activity is not a follow: %s", activity.Type)) //nolint:wrapcheck
-	}
+		if !deleted {
+			slog.InfoContext(ctx, "undone follow had no follower", "activity_id", ar.ID, "actor", undoneActivity.Actor)
+		}
 
-	_, err := w.pub.CreateFollower(ctx, userRecordID, actorID, activity.ID)
+		return w.pub.enqueueAccept(ctx, tx, userRecordID, ar.ID, ao.Actor)
+	})
 	if err != nil {
-		return fmt.Errorf("failed to create follower: %w", err)
+		return fmt.Errorf("failed to accept undo: %w", err)
 	}
 
 	return nil
 }
 
-func (w *HandleInboxWorker) acceptActivity(ctx context.Context, userRecordID database.ULID, activity ActivityRecord, actorID string) error {
-	user, err := w.id.GetUserByID(ctx, userRecordID)
-	if err != nil {
-		err = fmt.Errorf("failed to get user: %w", err)
-		if errors.Is(err, identity.ErrUserNotFound) {
-			return river.JobCancel(err) //nolint:wrapcheck
-		}
-
-		return err
-	}
-
-	actor, err := GetActor(ctx, actorID)
-	if err != nil {
-		return fmt.Errorf("error getting actor: %w", err)
+// undoneActivity returns the activity which an Undo's object refers to.
+// Mastodon, Pleroma, and Misskey embed the activity, but others send only its
+// ID, and some embed only its ID and type, so an activity without an actor is
+// looked up among those the user has received by its ID. It returns
+// ErrActivityNotFound if there is no such activity.
+func (w *HandleInboxWorker) undoneActivity(ctx context.Context, userRecordID database.ULID, object json.RawMessage) (Activity[json.RawMessage], error) {
+	var embedded Activity[json.RawMessage]
+	if err := json.Unmarshal(object, &embedded); err == nil && embedded.Actor != "" && embedded.Type != "" {
+		return embedded, nil
 	}
 
-	inboxURL := actor.Inbox
-	if inboxURL == "" {
-		return river.JobCancel(fmt.Errorf("actor has no inbox: %s", actor.ID)) //nolint:wrapcheck
+	id := referencedID(object)
+	if id == "" {
+		return Activity[json.RawMessage]{}, river.JobCancel(fmt.Errorf("undo has no object")) //nolint:wrapcheck
 	}
 
-	accept := newAcceptActivity(ActorID(user), activity.ID)
-
-	j, err := json.Marshal(accept)
+	ar, err := w.pub.GetActivityByID(ctx, userRecordID, id)
 	if err != nil {
-		return fmt.Errorf("failed to marshal accept: %w", err)
+		return Activity[json.RawMessage]{}, fmt.Errorf("failed to get undone activity: %w", err)
 	}
 
-	req, err := newSignedActivityRequest(ctx, w.id, userRecordID, http.MethodPost, inboxURL, j)
-	if err != nil {
-		return err
-	}
-
-	resp, err := http.DefaultClient.Do(req)
-	if err != nil {
-		return fmt.Errorf("error posting accept: %w", err)
-	}
-
-	defer func() {
-		if err := resp.Body.Close(); err != nil {
-			slog.ErrorContext(ctx, "error closing accept response body", "error", err)
-		}
-	}()
-
-	if !(200 <= resp.StatusCode && resp.StatusCode < 300) {
-		if resp.StatusCode >= 500 {
-			return fmt.Errorf("error posting accept: %s", resp.Status)
-		}
-
-		return river.JobCancel(fmt.Errorf("error posting accept: %s", resp.Status)) //nolint:wrapcheck
+	var undone Activity[json.RawMessage]
+	if err := json.Unmarshal(ar.Data, &undone); err != nil {
+		return Activity[json.RawMessage]{}, river.JobCancel(fmt.Errorf("failed to unmarshal undone activity: %w", err)) //nolint:wrapcheck
 	}
 
-	return nil
+	return undone, nil
 }
 
-func newHandleFollowWorker(pub *Service, id *identity.Service) *HandleInboxWorker {
+func newHandleFollowWorker(pub *Service) *HandleInboxWorker {
 	return &HandleInboxWorker{
-		id:  id,
 		pub: pub,
 	}
 }
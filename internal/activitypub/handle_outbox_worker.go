@@ -10,6 +10,9 @@ import (
 
 	"github.com/jclem/jclem.me/internal/activitypub/identity"
 	"github.com/jclem/jclem.me/internal/database"
+	"github.com/jclem/jclem.me/internal/queues"
+	"github.com/jclem/jclem.me/internal/telemetry"
+	"github.com/jclem/jclem.me/internal/webhooks"
 	"github.com/riverqueue/river"
 )
 
@@ -17,17 +20,30 @@ type HandleOutboxArgs struct {
 	// ActivityID is the object ID of the activity.
 	ActivityID string `json:"activity_id"`
 
-	// FollowerID is the object ID of the follower that the activity is for.
+	// FollowerID is the object ID of the actor that the activity is for,
+	// usually a follower, but, for an activity such as a Like, whoever it is
+	// addressed to.
 	FollowerID string `json:"follower_id"`
 
 	// UserRecordID is the ID of the user that the activity is for.
 	UserRecordID database.ULID `json:"user_record_id"`
+
+	// Trace is the trace context of the request which enqueued the job.
+	Trace telemetry.Carrier `json:"trace,omitempty"`
 }
 
 func (a HandleOutboxArgs) Kind() string {
 	return "handle-outbox"
 }
 
+// InsertOpts implements the river.JobArgsWithInsertOpts interface.
+func (a HandleOutboxArgs) InsertOpts() river.InsertOpts {
+	return river.InsertOpts{Queue: queues.Delivery}
+}
+
+// errJobCancelled matches any error returned by river.JobCancel.
+var errJobCancelled = river.JobCancel(nil) //nolint:gochecknoglobals
+
 type HandleOutboxWorker struct {
 	river.WorkerDefaults[HandleOutboxArgs]
 	id  *identity.Service
@@ -38,7 +54,28 @@ type HandleOutboxWorker struct {
 //
 // It functions by fetching newly-created activity and delivering it to the
 // inbox of the follower denoted in the job.
-func (w *HandleOutboxWorker) Work(ctx context.Context, job *river.Job[HandleOutboxArgs]) error {
+func (w *HandleOutboxWorker) Work(ctx context.Context, job *river.Job[HandleOutboxArgs]) (err error) {
+	ctx, span := telemetry.StartJob(ctx, job.Kind, job.Attempt, job.Args.Trace)
+	defer func() { telemetry.End(span, err) }()
+
+	err = w.deliver(ctx, job)
+
+	if err != nil && (errors.Is(err, errJobCancelled) || job.Attempt >= job.MaxAttempts) {
+		if err := w.pub.emitWebhook(ctx, nil, webhooks.NewEvent(webhooks.DeliveryFailed, map[string]any{
+			"user_id":     job.Args.UserRecordID,
+			"activity_id": job.Args.ActivityID,
+			"follower_id": job.Args.FollowerID,
+			"attempt":     job.Attempt,
+			"error":       err.Error(),
+		})); err != nil {
+			slog.ErrorContext(ctx, "failed to emit delivery failure webhook", "error", err)
+		}
+	}
+
+	return err
+}
+
+func (w *HandleOutboxWorker) deliver(ctx context.Context, job *river.Job[HandleOutboxArgs]) error {
 	activity, err := w.pub.GetActivityByID(ctx, job.Args.UserRecordID, job.Args.ActivityID)
 	if err != nil {
 		err = fmt.Errorf("failed to get activity: %w", err)
@@ -68,12 +105,14 @@ func (w *HandleOutboxWorker) Work(ctx context.Context, job *river.Job[HandleOutb
 		return fmt.Errorf("failed to marshal activity: %w", err)
 	}
 
-	req, err := newSignedActivityRequest(ctx, w.id, job.Args.UserRecordID, http.MethodPost, actor.Inbox, j)
+	req, err := NewSignedActivityRequest(ctx, w.pub.site, w.id, job.Args.UserRecordID, http.MethodPost, actor.Inbox, j)
 	if err != nil {
 		return err
 	}
 
-	resp, err := http.DefaultClient.Do(req)
+	resp, err := telemetry.HTTPClient.Do(req)
+	w.pub.metrics.recordDelivery(req.URL.Host, resp)
+
 	if err != nil {
 		return fmt.Errorf("failed to send request: %w", err)
 	}
@@ -86,10 +125,10 @@ func (w *HandleOutboxWorker) Work(ctx context.Context, job *river.Job[HandleOutb
 
 	if !(200 <= resp.StatusCode && resp.StatusCode < 300) {
 		if resp.StatusCode >= 500 {
-			return fmt.Errorf("error posting accept: %s", resp.Status)
+			return fmt.Errorf("error posting activity: %s", resp.Status)
 		}
 
-		return river.JobCancel(fmt.Errorf("error posting accept: %s", resp.Status)) //nolint:wrapcheck
+		return river.JobCancel(fmt.Errorf("error posting activity: %s", resp.Status)) //nolint:wrapcheck
 	}
 
 	return nil
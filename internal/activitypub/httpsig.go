@@ -3,21 +3,32 @@ package activitypub
 import (
 	"bytes"
 	"context"
+	"crypto"
+	"crypto/ed25519"
 	"crypto/rsa"
+	"crypto/sha256"
 	"crypto/x509"
+	"encoding/base64"
 	"encoding/pem"
 	"errors"
 	"fmt"
 	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
 	"time"
 
 	"github.com/go-fed/httpsig"
 	"github.com/jclem/jclem.me/internal/activitypub/identity"
+	"github.com/jclem/jclem.me/internal/cache"
 	"github.com/jclem/jclem.me/internal/database"
 )
 
-func newSignedActivityRequest(
+// NewSignedActivityRequest creates a request which sends an activity as the
+// user, signed with their current key, whose ID is built from site.
+func NewSignedActivityRequest(
 	ctx context.Context,
+	site Site,
 	id *identity.Service,
 	userRecordID database.ULID,
 	method string,
@@ -43,41 +54,319 @@ func newSignedActivityRequest(
 		return nil, fmt.Errorf("error getting private key: %w", err)
 	}
 
-	if err := signJSONLDRequest(user, privateKeyPEM, r, body); err != nil {
+	if err := signJSONLDRequest(site, user, privateKeyPEM, r, body); err != nil {
 		return nil, fmt.Errorf("error signing request: %w", err)
 	}
 
 	return r, nil
 }
 
-func signJSONLDRequest(user identity.User, privateKeyPEM identity.SigningKey, r *http.Request, b []byte) error {
-	prefs := []httpsig.Algorithm{httpsig.RSA_SHA256}
+func signJSONLDRequest(site Site, user identity.User, privateKeyPEM identity.SigningKey, r *http.Request, b []byte) error {
+	block, _ := pem.Decode([]byte(privateKeyPEM.PEM))
+	if block == nil {
+		return errors.New("error decoding private key")
+	}
+
+	pkey, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return fmt.Errorf("error parsing private key: %w", err)
+	}
+
+	var algo httpsig.Algorithm
+
+	switch pkey.(type) {
+	case *rsa.PrivateKey:
+		algo = httpsig.RSA_SHA256
+	case ed25519.PrivateKey:
+		algo = httpsig.ED25519
+	default:
+		return errors.New("private key is not an RSA or Ed25519 key")
+	}
+
 	digestAlgo := httpsig.DigestSha256
 	headers := []string{httpsig.RequestTarget, "date", "digest"}
 
-	signer, _, err := httpsig.NewSigner(prefs, digestAlgo, headers, httpsig.Signature, 0)
+	signer, _, err := httpsig.NewSigner([]httpsig.Algorithm{algo}, digestAlgo, headers, httpsig.Signature, 0)
 	if err != nil {
 		return fmt.Errorf("error creating signer: %w", err)
 	}
 
-	block, _ := pem.Decode([]byte(privateKeyPEM.PEM))
-	if block == nil {
-		return errors.New("error decoding private key")
+	if err := signer.SignRequest(pkey, site.ActorPublicKeyID(user, privateKeyPEM.Version), r, b); err != nil {
+		return fmt.Errorf("error signing request: %w", err)
 	}
 
-	pkey, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	return nil
+}
+
+// keyCacheTTL is how long a public key is trusted after it is fetched. A
+// cached key which does not verify a signature is fetched again at once, in
+// case it was rotated.
+const keyCacheTTL = time.Hour
+
+// publicKeys are the public keys which have verified signatures, by ID.
+var publicKeys = cache.New[string, PublicKey](keyCacheTTL) //nolint:gochecknoglobals
+
+// ErrKeyUnavailable is returned when a signature's key could not be fetched,
+// such as when its owner has been deleted, so that the signature could not be
+// checked at all.
+var ErrKeyUnavailable = errors.New("signing key is unavailable")
+
+// VerifyRequest verifies a request's HTTP signature and returns the ID of the
+// actor who owns the signing key, which is resolved from the signature's key
+// ID rather than from anything the request claims.
+func VerifyRequest(ctx context.Context, r *http.Request) (string, error) {
+	verifier, err := httpsig.NewVerifier(r)
 	if err != nil {
-		return fmt.Errorf("error parsing private key: %w", err)
+		return "", fmt.Errorf("error creating verifier: %w", err)
 	}
 
-	rsaKey, ok := pkey.(*rsa.PrivateKey)
-	if !ok {
-		return errors.New("private key is not an RSA key")
+	keyID := verifier.KeyId()
+
+	key, cached := publicKeys.Get(keyID)
+	if cached {
+		if err := verifyRequest(r, verifier, key); err == nil {
+			return key.Owner, nil
+		}
+
+		publicKeys.Delete(keyID)
 	}
 
-	if err := signer.SignRequest(rsaKey, ActorPublicKeyID(user), r, b); err != nil {
-		return fmt.Errorf("error signing request: %w", err)
+	key, err = GetPublicKey(ctx, keyID)
+	if err != nil {
+		return "", fmt.Errorf("error getting key: %w", err)
+	}
+
+	if err := verifyRequest(r, verifier, key); err != nil {
+		return "", err
+	}
+
+	publicKeys.Set(keyID, key)
+
+	return key.Owner, nil
+}
+
+// GetPublicKey requests a public key by its ID and returns it with its owner.
+//
+// A key's ID is usually its owner's ID with a fragment, so the owner is served
+// with the key, and must be served from the same host, so that one server
+// cannot claim another's actors. Otherwise, the key is served alone, and names
+// its owner, who must list it among their keys.
+func GetPublicKey(ctx context.Context, keyID string) (PublicKey, error) {
+	var doc struct {
+		ID           string     `json:"id"`
+		Owner        string     `json:"owner"`
+		PublicKeyPem string     `json:"publicKeyPem"`
+		PublicKey    PublicKeys `json:"publicKey"`
+	}
+
+	if err := getObject(ctx, keyID, &doc); err != nil {
+		return PublicKey{}, fmt.Errorf("%w: %w", ErrKeyUnavailable, err)
+	}
+
+	if doc.PublicKeyPem == "" {
+		key, ok := doc.PublicKey.Find(keyID)
+		if !ok {
+			return PublicKey{}, fmt.Errorf("actor has no key %q", keyID)
+		}
+
+		if !sameHost(doc.ID, keyID) || (key.Owner != "" && key.Owner != doc.ID) {
+			return PublicKey{}, fmt.Errorf("key %q does not belong to actor %q", keyID, doc.ID)
+		}
+
+		key.Owner = doc.ID
+
+		return key, nil
+	}
+
+	if doc.ID != keyID || doc.Owner == "" {
+		return PublicKey{}, fmt.Errorf("key %q has no owner", keyID)
+	}
+
+	owner, err := GetActor(ctx, doc.Owner)
+	if err != nil {
+		return PublicKey{}, fmt.Errorf("%w: failed to get owner: %w", ErrKeyUnavailable, err)
+	}
+
+	if key, ok := owner.PublicKey.Find(keyID); !ok || owner.ID != doc.Owner || key.PublicKeyPem != doc.PublicKeyPem {
+		return PublicKey{}, fmt.Errorf("key %q does not belong to actor %q", keyID, doc.Owner)
+	}
+
+	return PublicKey{ID: keyID, Owner: doc.Owner, PublicKeyPem: doc.PublicKeyPem}, nil
+}
+
+// sameHost returns whether two URLs have the same host.
+func sameHost(a, b string) bool {
+	ua, err := url.Parse(a)
+	if err != nil {
+		return false
+	}
+
+	ub, err := url.Parse(b)
+	if err != nil {
+		return false
+	}
+
+	return ua.Host != "" && ua.Host == ub.Host
+}
+
+// signatureAlgorithms are the signature algorithms which are verified.
+//
+//nolint:gochecknoglobals
+var signatureAlgorithms = map[string]httpsig.Algorithm{
+	"rsa-sha256": httpsig.RSA_SHA256,
+}
+
+var signatureParamRegex = regexp.MustCompile(`(\w+)="([^"]*)"`)
+
+// verifyRequest returns an error unless the request's signature was made with
+// the public key.
+func verifyRequest(r *http.Request, verifier httpsig.Verifier, publicKey PublicKey) error {
+	key, _ := pem.Decode([]byte(publicKey.PublicKeyPem))
+	if key == nil {
+		return errors.New("error decoding public key")
+	}
+
+	pkeyAny, err := x509.ParsePKIXPublicKey(key.Bytes)
+	if err != nil {
+		return fmt.Errorf("error parsing public key: %w", err)
+	}
+
+	pubKey, knownAlgo := pkeyAny.(crypto.PublicKey)
+	if !knownAlgo {
+		return errors.New("error casting public key")
+	}
+
+	algo, knownAlgo := signatureAlgorithms[strings.ToLower(signatureParams(r)["algorithm"])]
+	if !knownAlgo {
+		return errors.New("invalid algorithm")
+	}
+
+	if err := verifier.Verify(pubKey, algo); err != nil {
+		return fmt.Errorf("error verifying request: %w", err)
 	}
 
 	return nil
 }
+
+// signatureParams returns the parameters of a request's Signature header.
+func signatureParams(r *http.Request) map[string]string {
+	params := map[string]string{}
+	for _, m := range signatureParamRegex.FindAllStringSubmatch(r.Header.Get("Signature"), -1) {
+		params[m[1]] = m[2]
+	}
+
+	return params
+}
+
+// A SignatureReport describes a request's HTTP signature and whether it was
+// verified, for troubleshooting deliveries from other servers.
+type SignatureReport struct {
+	Actor     string   `json:"actor"`
+	KeyID     string   `json:"key_id"`
+	Algorithm string   `json:"algorithm"`
+	Headers   []string `json:"headers"`
+
+	// SigningString is the string which the signature signs, as rebuilt from
+	// the request.
+	SigningString string `json:"signing_string"`
+
+	// Digest is the request's Digest header, and DigestMatches is whether it
+	// is the SHA-256 digest of the body. Signature verification does not
+	// check the digest.
+	Digest        string `json:"digest"`
+	DigestMatches bool   `json:"digest_matches"`
+
+	// Date is the request's Date header, and DateAge is how long before the
+	// report it was.
+	Date    string `json:"date"`
+	DateAge string `json:"date_age,omitempty"`
+
+	// KeyFound is whether the actor has a key with the signature's key ID,
+	// and ActorKeys are the IDs of the actor's keys.
+	KeyFound  bool     `json:"key_found"`
+	ActorKeys []string `json:"actor_keys"`
+
+	// KeyOwner is the actor who owns the key, as resolved from its ID. A
+	// signature is only verified if it is the actor.
+	KeyOwner string `json:"key_owner,omitempty"`
+
+	Verified bool   `json:"verified"`
+	Error    string `json:"error,omitempty"`
+}
+
+// InspectSignature reports on the HTTP signature of a request from the actor,
+// such as one captured from an inbox, whose body has been read into body.
+func InspectSignature(ctx context.Context, r *http.Request, body []byte, actorID string) SignatureReport {
+	params := signatureParams(r)
+
+	report := SignatureReport{
+		Actor:     actorID,
+		KeyID:     params["keyId"],
+		Algorithm: params["algorithm"],
+		Headers:   strings.Fields(params["headers"]),
+		Digest:    r.Header.Get("Digest"),
+		Date:      r.Header.Get("Date"),
+	}
+
+	// Signatures without a headers parameter sign only the date.
+	if _, ok := params["headers"]; !ok {
+		report.Headers = []string{"date"}
+	}
+
+	lines := make([]string, len(report.Headers))
+	for i, h := range report.Headers {
+		if h == httpsig.RequestTarget {
+			lines[i] = fmt.Sprintf("%s: %s %s", h, strings.ToLower(r.Method), r.URL.RequestURI())
+		} else {
+			lines[i] = fmt.Sprintf("%s: %s", h, strings.Join(r.Header.Values(h), ", "))
+		}
+	}
+
+	report.SigningString = strings.Join(lines, "\n")
+
+	digest := sha256.Sum256(body)
+	report.DigestMatches = strings.EqualFold(report.Digest, "SHA-256="+base64.StdEncoding.EncodeToString(digest[:]))
+
+	if date, err := http.ParseTime(report.Date); err == nil {
+		report.DateAge = time.Since(date).Round(time.Second).String()
+	}
+
+	actor, err := GetActor(ctx, actorID)
+	if err != nil {
+		report.Error = fmt.Sprintf("error getting actor: %v", err)
+		return report
+	}
+
+	for _, key := range actor.PublicKey {
+		report.ActorKeys = append(report.ActorKeys, key.ID)
+	}
+
+	_, report.KeyFound = actor.PublicKey.Find(report.KeyID)
+
+	// The key is fetched rather than cached, so that the report reflects what
+	// the key's owner serves now.
+	key, err := GetPublicKey(ctx, report.KeyID)
+	if err != nil {
+		report.Error = fmt.Sprintf("error getting key: %v", err)
+		return report
+	}
+
+	report.KeyOwner = key.Owner
+
+	verifier, err := httpsig.NewVerifier(r)
+	if err != nil {
+		report.Error = fmt.Sprintf("error creating verifier: %v", err)
+		return report
+	}
+
+	switch err := verifyRequest(r, verifier, key); {
+	case err != nil:
+		report.Error = err.Error()
+	case key.Owner != actorID:
+		report.Error = fmt.Sprintf("key belongs to %q, not the actor", key.Owner)
+	default:
+		report.Verified = true
+	}
+
+	return report
+}
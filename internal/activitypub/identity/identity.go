@@ -3,70 +3,172 @@ package identity
 
 import (
 	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
 	"crypto/subtle"
-	"errors"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
 	"fmt"
 	"log/slog"
+	"regexp"
+	"slices"
 	"strings"
+	"sync"
 	"time"
 
-	"github.com/Masterminds/squirrel"
-	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/jclem/jclem.me/internal/activitypub/orderedmap"
+	"github.com/jclem/jclem.me/internal/cache"
 	"github.com/jclem/jclem.me/internal/database"
+	"github.com/jclem/jclem.me/internal/events"
 )
 
 // A Service handles identity requests.
+//
+// Users and signing keys are read on nearly every request, so they are cached
+// briefly. Updates made through the Service invalidate the cache immediately,
+// and, once Listen is called, updates and deletions of users made through
+// Services in other processes do too. Other updates made elsewhere are visible
+// once cached entries expire.
 type Service struct {
-	pool *pgxpool.Pool
-	sql  squirrel.StatementBuilderType
+	store Store
+	users *cache.Cache[string, User]
+	keys  *cache.Cache[signingKeyCacheKey, SigningKey]
+
+	mu     sync.RWMutex
+	events *events.Broker
+}
+
+const cacheTTL = 5 * time.Minute
+
+type signingKeyCacheKey struct {
+	userID database.ULID
+	kind   keyKind
+}
+
+func userIDCacheKey(id database.ULID) string {
+	return "id:" + id.String()
+}
+
+func usernameCacheKey(username string) string {
+	return "username:" + username
+}
+
+func (s *Service) cacheUser(user User) {
+	s.users.Set(userIDCacheKey(user.ID), user)
+	s.users.Set(usernameCacheKey(user.Username), user)
+}
+
+func (s *Service) invalidateUser(id database.ULID) {
+	s.users.DeleteFunc(func(_ string, user User) bool {
+		return user.ID == id
+	})
+}
+
+// Listen forgets cached users whenever they are updated or deleted, in this
+// process or another, as announced through broker, until ctx is done or broker
+// is closed. Changes made through the Service are announced through it from
+// then on.
+func (s *Service) Listen(ctx context.Context, broker *events.Broker) {
+	ch, unsubscribe := broker.Subscribe()
+
+	s.mu.Lock()
+	s.events = broker
+	s.mu.Unlock()
+
+	go func() {
+		defer unsubscribe()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case event, ok := <-ch:
+				if !ok {
+					return
+				}
+
+				if event.Type != events.UserChanged {
+					continue
+				}
+
+				param, _ := event.Data["id"].(string)
+
+				id, err := database.ParseULID(param)
+				if err != nil {
+					slog.ErrorContext(ctx, "ignoring change of user with invalid id", "id", param)
+					continue
+				}
+
+				s.invalidateUser(id)
+			}
+		}
+	}()
+}
+
+// userChanged forgets a user who was updated or deleted, and announces the
+// change to other processes.
+func (s *Service) userChanged(ctx context.Context, id database.ULID) {
+	s.invalidateUser(id)
+
+	s.mu.RLock()
+	broker := s.events
+	s.mu.RUnlock()
+
+	if broker == nil {
+		return
+	}
+
+	if err := broker.Publish(ctx, events.New(events.UserChanged, map[string]any{"id": id.String()})); err != nil {
+		slog.ErrorContext(ctx, "error publishing user change", "error", err)
+	}
 }
 
 // ErrUserNotFound is returned when a user is not found.
 var ErrUserNotFound = fmt.Errorf("user not found")
 
+// ErrUserDeleted is returned when a user has been deleted. It is also an
+// ErrUserNotFound, so callers which need not tell them apart do not.
+var ErrUserDeleted = fmt.Errorf("user deleted: %w", ErrUserNotFound)
+
 // GetUserByID gets a user by ID.
 func (s *Service) GetUserByID(ctx context.Context, id database.ULID) (User, error) {
-	query, args, err := s.sql.
-		Select(usersFields...).
-		From(usersTable).
-		Where(squirrel.Eq{usersIDColumn: id}).
-		ToSql()
-	if err != nil {
-		return User{}, fmt.Errorf("could not build query: %w", err)
+	if user, ok := s.users.Get(userIDCacheKey(id)); ok {
+		return liveUser(user)
 	}
 
-	var user User
-	if err := s.pool.QueryRow(ctx, query, args...).Scan(user.scannableFields()...); err != nil {
-		if errors.Is(err, pgx.ErrNoRows) {
-			return User{}, ErrUserNotFound
-		}
-
-		return User{}, fmt.Errorf("could not query row: %w", err)
+	user, err := s.store.GetUserByID(ctx, id)
+	if err != nil {
+		return User{}, err //nolint:wrapcheck
 	}
 
-	return user, nil
+	s.cacheUser(user)
+
+	return liveUser(user)
 }
 
 // GetUserByUsername gets a user by username.
 func (s *Service) GetUserByUsername(ctx context.Context, username string) (User, error) {
-	query, args, err := s.sql.
-		Select(usersFields...).
-		From(usersTable).
-		Where(squirrel.Eq{usersUsernameColumn: username}).
-		ToSql()
+	if user, ok := s.users.Get(usernameCacheKey(username)); ok {
+		return liveUser(user)
+	}
+
+	user, err := s.store.GetUserByUsername(ctx, username)
 	if err != nil {
-		return User{}, fmt.Errorf("could not build query: %w", err)
+		return User{}, err //nolint:wrapcheck
 	}
 
-	var user User
-	if err := s.pool.QueryRow(ctx, query, args...).Scan(user.scannableFields()...); err != nil {
-		if errors.Is(err, pgx.ErrNoRows) {
-			return User{}, ErrUserNotFound
-		}
+	s.cacheUser(user)
+
+	return liveUser(user)
+}
 
-		return User{}, fmt.Errorf("could not query row: %w", err)
+// liveUser returns the user, or ErrUserDeleted if they have been deleted.
+func liveUser(user User) (User, error) {
+	if user.DeletedAt != nil {
+		return User{}, ErrUserDeleted
 	}
 
 	return user, nil
@@ -82,88 +184,388 @@ const (
 // ErrSigningKeyNotFound is returned when a signing key is not found.
 var ErrSigningKeyNotFound = fmt.Errorf("signing key not found")
 
-// GetPublicKey gets a user's public signing key.
+// GetPublicKey gets a user's current public signing key.
 func (s *Service) GetPublicKey(ctx context.Context, userID database.ULID) (SigningKey, error) {
 	return s.getSigningKey(ctx, userID, keyKindPublic)
 }
 
-// GetPrivateKey gets a user's private signing key.
+// GetPublicKeys gets every unexpired version of a user's public signing key,
+// newest first: the current key, and any rotated keys which remain servable.
+func (s *Service) GetPublicKeys(ctx context.Context, userID database.ULID) ([]SigningKey, error) {
+	keys, err := s.listSigningKeys(ctx, userID, keyKindPublic)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(keys) == 0 {
+		return nil, ErrSigningKeyNotFound
+	}
+
+	return keys, nil
+}
+
+// GetPrivateKey gets a user's current private signing key.
 func (s *Service) GetPrivateKey(ctx context.Context, userID database.ULID) (SigningKey, error) {
 	return s.getSigningKey(ctx, userID, keyKindPrivate)
 }
 
+// GetPublicKeyByVersion gets a specific version of a user's public signing
+// key, so long as it has not expired.
+func (s *Service) GetPublicKeyByVersion(ctx context.Context, userID database.ULID, version int) (SigningKey, error) {
+	keys, err := s.listSigningKeys(ctx, userID, keyKindPublic)
+	if err != nil {
+		return SigningKey{}, err
+	}
+
+	i := slices.IndexFunc(keys, func(k SigningKey) bool { return k.Version == version })
+	if i < 0 {
+		return SigningKey{}, ErrSigningKeyNotFound
+	}
+
+	return keys[i], nil
+}
+
 func (s *Service) getSigningKey(ctx context.Context, userID database.ULID, kind keyKind) (SigningKey, error) {
-	query, args, err := s.sql.
-		Select(signingKeysFields...).
-		From(signingKeysTable).
-		Where(squirrel.Eq{signingKeysKindColumn: kind}).
-		Where(squirrel.Eq{signingKeysUserIDColumn: userID}).
-		ToSql()
+	cacheKey := signingKeyCacheKey{userID: userID, kind: kind}
+	if key, ok := s.keys.Get(cacheKey); ok {
+		return key, nil
+	}
+
+	keys, err := s.listSigningKeys(ctx, userID, kind)
 	if err != nil {
-		return SigningKey{}, fmt.Errorf("could not build query: %w", err)
+		return SigningKey{}, err
 	}
 
-	var key SigningKey
-	if err := s.pool.QueryRow(ctx, query, args...).Scan(key.scannableFields()...); err != nil {
-		if errors.Is(err, pgx.ErrNoRows) {
-			return SigningKey{}, ErrSigningKeyNotFound
-		}
+	if len(keys) == 0 {
+		return SigningKey{}, ErrSigningKeyNotFound
+	}
 
-		slog.InfoContext(ctx, "error", "userID", userID)
+	s.keys.Set(cacheKey, keys[0])
 
-		return SigningKey{}, fmt.Errorf("could not query row: %w", err)
+	return keys[0], nil
+}
+
+// listSigningKeys lists a user's unexpired keys of the given kind, newest
+// first.
+func (s *Service) listSigningKeys(ctx context.Context, userID database.ULID, kind keyKind) ([]SigningKey, error) {
+	keys, err := s.store.ListSigningKeys(ctx, userID, time.Now().UTC())
+	if err != nil {
+		return nil, err //nolint:wrapcheck
+	}
+
+	return slices.DeleteFunc(keys, func(k SigningKey) bool { return k.Kind != string(kind) }), nil
+}
+
+// DefaultKeyGracePeriod is the default length of time for which a rotated
+// public key remains servable.
+const DefaultKeyGracePeriod = 7 * 24 * time.Hour
+
+// RotateKeys generates a new signing keypair for a user, which becomes the
+// user's current keypair.
+//
+// The previous private key is expired immediately, so that nothing new is
+// signed with it. The previous public key remains servable by its version
+// until the grace period elapses, so that requests signed before the rotation
+// can still be verified.
+func (s *Service) RotateKeys(ctx context.Context, userID database.ULID, grace time.Duration) (SigningKey, error) {
+	publicKeyPEM, privateKeyPEM, err := generateSigningKeys(KeyAlgorithmRSA)
+	if err != nil {
+		return SigningKey{}, err
 	}
 
+	now := time.Now().UTC()
+
+	key, err := s.store.RotateSigningKeys(ctx,
+		newSigningKey(userID, keyKindPublic, publicKeyPEM, now),
+		newSigningKey(userID, keyKindPrivate, privateKeyPEM, now),
+		now.Add(grace))
+	if err != nil {
+		return SigningKey{}, err //nolint:wrapcheck
+	}
+
+	s.keys.DeleteFunc(func(k signingKeyCacheKey, _ SigningKey) bool {
+		return k.userID == userID
+	})
+
 	return key, nil
 }
 
+// ErrSigningKeysExist is returned when generating keys for a user who already
+// has them, whose keys must be rotated instead.
+var ErrSigningKeysExist = fmt.Errorf("user already has signing keys")
+
+// GenerateKeys generates a signing keypair for a user who has none, such as
+// one whose keys were removed or have all expired, and stores it as their
+// current keypair.
+func (s *Service) GenerateKeys(ctx context.Context, userID database.ULID, algorithm KeyAlgorithm) (SigningKey, error) {
+	keys, err := s.listSigningKeys(ctx, userID, keyKindPrivate)
+	if err != nil {
+		return SigningKey{}, err
+	}
+
+	if len(keys) > 0 {
+		return SigningKey{}, ErrSigningKeysExist
+	}
+
+	publicKeyPEM, privateKeyPEM, err := generateSigningKeys(algorithm)
+	if err != nil {
+		return SigningKey{}, err
+	}
+
+	now := time.Now().UTC()
+
+	// With no current keys, storing the keypair as the next version expires
+	// nothing.
+	key, err := s.store.RotateSigningKeys(ctx,
+		newSigningKey(userID, keyKindPublic, publicKeyPEM, now),
+		newSigningKey(userID, keyKindPrivate, privateKeyPEM, now),
+		now)
+	if err != nil {
+		return SigningKey{}, err //nolint:wrapcheck
+	}
+
+	s.keys.DeleteFunc(func(k signingKeyCacheKey, _ SigningKey) bool {
+		return k.userID == userID
+	})
+
+	return key, nil
+}
+
+// newSigningKey returns the first version of a new key. Its store assigns
+// later versions when keys are rotated.
+func newSigningKey(userID database.ULID, kind keyKind, pem string, now time.Time) SigningKey {
+	return SigningKey{
+		ID:        database.NewULID(),
+		UserID:    userID,
+		Kind:      string(kind),
+		PEM:       pem,
+		Version:   1,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+}
+
 // ErrInvalidAPIKey is returned when an API key is invalid.
 var ErrInvalidAPIKey = fmt.Errorf("invalid API key")
 
-// ValidateAPIKey validates an API key and returns its associated user.
+// ValidateAPIKey validates an API key and returns its associated user, along
+// with the key itself so that callers can check its scopes.
 //
 // API keys submitted by clients are of the format "$id.$value" where $id is the
 // user ID and $value is the API key value (a random string).
-func (s *Service) ValidateAPIKey(ctx context.Context, key string) (User, error) {
+func (s *Service) ValidateAPIKey(ctx context.Context, key string) (User, APIKey, error) {
 	keyparts := strings.SplitN(key, ".", 2)
 	if len(keyparts) != 2 {
-		return User{}, ErrInvalidAPIKey
+		return User{}, APIKey{}, ErrInvalidAPIKey
 	}
 
 	keyid := keyparts[0]
 	keyvalue := keyparts[1]
 
-	query, args, err := s.sql.
-		Select(apiKeysFields...).
-		From(apiKeysTable).
-		Where(squirrel.Eq{apiKeysIDColumn: keyid}).
-		ToSql()
+	apikey, err := s.store.GetAPIKey(ctx, keyid)
+	if err != nil {
+		return User{}, APIKey{}, err //nolint:wrapcheck
+	}
+
+	if subtle.ConstantTimeCompare([]byte(apikey.Value), []byte(keyvalue)) != 1 {
+		return User{}, APIKey{}, ErrInvalidAPIKey
+	}
+
+	user, err := s.GetUserByID(ctx, apikey.UserID)
+	if err != nil {
+		return User{}, APIKey{}, err
+	}
+
+	return user, apikey, nil
+}
+
+// A UserUpdate is the input for updating a user's profile. Nil fields are
+// left unchanged.
+type UserUpdate struct {
+	Email    *string                `json:"email"`
+	Name     *string                `json:"name"`
+	Summary  *string                `json:"summary"`
+	ImageURL *string                `json:"image_url"`
+	Metadata *orderedmap.OrderedMap `json:"metadata"`
+}
+
+// UpdateUser updates a user's profile.
+func (s *Service) UpdateUser(ctx context.Context, id database.ULID, update UserUpdate) (User, error) {
+	user, err := s.store.UpdateUser(ctx, id, update, time.Now().UTC())
+	if err != nil {
+		return User{}, err //nolint:wrapcheck
+	}
+
+	s.userChanged(ctx, id)
+
+	return user, nil
+}
+
+// DeleteUser deletes a user, after which they are not found. The user's data
+// is kept, and their username is not reused.
+func (s *Service) DeleteUser(ctx context.Context, id database.ULID) error {
+	if err := s.store.DeleteUser(ctx, id, time.Now().UTC()); err != nil {
+		return err //nolint:wrapcheck
+	}
+
+	s.userChanged(ctx, id)
+
+	return nil
+}
+
+// NewUser is the input for creating a new user.
+type NewUser struct {
+	Username string `json:"username"`
+	Email    string `json:"email"`
+	Name     string `json:"name"`
+	Summary  string `json:"summary"`
+	ImageURL string `json:"image_url"`
+}
+
+// ErrInvalidUsername is returned when a username is empty or contains
+// characters that are not allowed in an ActivityPub handle.
+var ErrInvalidUsername = fmt.Errorf("invalid username")
+
+// ErrUserExists is returned when creating a user whose username is taken.
+var ErrUserExists = fmt.Errorf("user already exists")
+
+var usernameRegex = regexp.MustCompile(`^[a-zA-Z0-9_]+$`)
+
+const rsaKeyBits = 2048
+
+// CreateUser provisions a new user along with their signing keys and an
+// initial API key.
+//
+// The returned string is the API key in the "$id.$value" format accepted by
+// ValidateAPIKey. It is not retrievable after creation.
+func (s *Service) CreateUser(ctx context.Context, input NewUser) (User, string, error) {
+	if !usernameRegex.MatchString(input.Username) {
+		return User{}, "", ErrInvalidUsername
+	}
+
+	publicKeyPEM, privateKeyPEM, err := generateSigningKeys(KeyAlgorithmRSA)
+	if err != nil {
+		return User{}, "", err
+	}
+
+	apiKeyValue, err := generateAPIKeyValue()
 	if err != nil {
-		return User{}, fmt.Errorf("could not build query: %w", err)
+		return User{}, "", err
+	}
+
+	now := time.Now().UTC()
+
+	user := User{
+		ID:        database.NewULID(),
+		Email:     input.Email,
+		Username:  input.Username,
+		Summary:   input.Summary,
+		Name:      input.Name,
+		ImageURL:  input.ImageURL,
+		Metadata:  orderedmap.OrderedMap{},
+		CreatedAt: now,
+		UpdatedAt: now,
 	}
 
-	var apikey APIKey
-	if err := s.pool.QueryRow(ctx, query, args...).Scan(apikey.scannableFields()...); err != nil {
-		if errors.Is(err, pgx.ErrNoRows) {
-			return User{}, ErrInvalidAPIKey
+	keys := []SigningKey{
+		newSigningKey(user.ID, keyKindPublic, publicKeyPEM, now),
+		newSigningKey(user.ID, keyKindPrivate, privateKeyPEM, now),
+	}
+
+	apiKey := APIKey{
+		ID:        database.NewULID(),
+		UserID:    user.ID,
+		Value:     apiKeyValue,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+
+	user, err = s.store.InsertUser(ctx, user, keys, apiKey)
+	if err != nil {
+		return User{}, "", err //nolint:wrapcheck
+	}
+
+	return user, apiKey.ID.String() + "." + apiKeyValue, nil
+}
+
+// A KeyAlgorithm is the algorithm of a signing keypair.
+type KeyAlgorithm string
+
+const (
+	// KeyAlgorithmRSA is a 2048-bit RSA keypair, which every server verifies.
+	KeyAlgorithmRSA KeyAlgorithm = "rsa"
+
+	// KeyAlgorithmEd25519 is an Ed25519 keypair. Mastodon and many other
+	// servers verify only RSA signatures.
+	KeyAlgorithmEd25519 KeyAlgorithm = "ed25519"
+)
+
+// ErrInvalidKeyAlgorithm is returned when generating keys of an unknown
+// algorithm.
+var ErrInvalidKeyAlgorithm = fmt.Errorf("key algorithm must be \"rsa\" or \"ed25519\"")
+
+// generateSigningKeys generates a keypair, returning the public key in PKIX
+// PEM format and the private key in PKCS #8 PEM format.
+func generateSigningKeys(algorithm KeyAlgorithm) (string, string, error) {
+	var public, private any
+
+	switch algorithm {
+	case KeyAlgorithmRSA:
+		key, err := rsa.GenerateKey(rand.Reader, rsaKeyBits)
+		if err != nil {
+			return "", "", fmt.Errorf("could not generate RSA key: %w", err)
+		}
+
+		public, private = &key.PublicKey, key
+	case KeyAlgorithmEd25519:
+		publicKey, privateKey, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			return "", "", fmt.Errorf("could not generate Ed25519 key: %w", err)
 		}
 
-		return User{}, fmt.Errorf("could not query row: %w", err)
+		public, private = publicKey, privateKey
+	default:
+		return "", "", ErrInvalidKeyAlgorithm
 	}
 
-	if subtle.ConstantTimeCompare([]byte(apikey.Value), []byte(keyvalue)) != 1 {
-		return User{}, ErrInvalidAPIKey
+	publicDER, err := x509.MarshalPKIXPublicKey(public)
+	if err != nil {
+		return "", "", fmt.Errorf("could not marshal public key: %w", err)
+	}
+
+	privateDER, err := x509.MarshalPKCS8PrivateKey(private)
+	if err != nil {
+		return "", "", fmt.Errorf("could not marshal private key: %w", err)
+	}
+
+	publicPEM := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: publicDER})
+	privatePEM := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: privateDER})
+
+	return string(publicPEM), string(privatePEM), nil
+}
+
+func generateAPIKeyValue() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("could not generate API key: %w", err)
 	}
 
-	return s.GetUserByID(ctx, apikey.UserID)
+	return hex.EncodeToString(b), nil
 }
 
 // NewService returns a new identity service.
 func NewService(pool *pgxpool.Pool) (*Service, error) {
+	return NewServiceWithStore(NewPostgresStore(pool)), nil
+}
+
+// NewServiceWithStore returns a new identity service which keeps identities in
+// the given store, such as a MemoryStore.
+func NewServiceWithStore(store Store) *Service {
 	return &Service{
-		pool: pool,
-		sql:  squirrel.StatementBuilder.PlaceholderFormat(squirrel.Dollar),
-	}, nil
+		store: store,
+		users: cache.New[string, User](cacheTTL),
+		keys:  cache.New[signingKeyCacheKey, SigningKey](cacheTTL),
+	}
 }
 
 const signingKeysTable = "key_pems"
@@ -171,6 +573,8 @@ const signingKeysIDColumn = "id"
 const signingKeysUserIDColumn = "user_id"
 const signingKeysKindColumn = "kind"
 const signingKeysPEMColumn = "pem"
+const signingKeysVersionColumn = "version"
+const signingKeysExpiresAtColumn = "expires_at"
 const signingKeysCreatedAtColumn = "created_at"
 const signingKeysUpdatedAtColumn = "updated_at"
 
@@ -179,6 +583,8 @@ var signingKeysFields = []string{ //nolint:gochecknoglobals
 	signingKeysUserIDColumn,
 	signingKeysKindColumn,
 	signingKeysPEMColumn,
+	signingKeysVersionColumn,
+	signingKeysExpiresAtColumn,
 	signingKeysCreatedAtColumn,
 	signingKeysUpdatedAtColumn,
 }
@@ -189,6 +595,8 @@ type SigningKey struct {
 	UserID    database.ULID `json:"user_id"`
 	Kind      string        `json:"kind"`
 	PEM       string        `json:"pem"`
+	Version   int           `json:"version"`
+	ExpiresAt *time.Time    `json:"expires_at"`
 	CreatedAt time.Time     `json:"created_at"`
 	UpdatedAt time.Time     `json:"updated_at"`
 }
@@ -199,6 +607,8 @@ func (k *SigningKey) scannableFields() []any {
 		&k.UserID,
 		&k.Kind,
 		&k.PEM,
+		&k.Version,
+		&k.ExpiresAt,
 		&k.CreatedAt,
 		&k.UpdatedAt,
 	}
@@ -214,6 +624,7 @@ const usersImageURLColumn = "image_url"
 const usersMetadataColumn = "metadata"
 const usersCreatedAt = "created_at"
 const usersUpdatedAt = "updated_at"
+const usersDeletedAt = "deleted_at"
 
 var usersFields = []string{ //nolint:gochecknoglobals
 	usersIDColumn,
@@ -225,6 +636,7 @@ var usersFields = []string{ //nolint:gochecknoglobals
 	usersMetadataColumn,
 	usersCreatedAt,
 	usersUpdatedAt,
+	usersDeletedAt,
 }
 
 // A User is a user of the system.
@@ -238,6 +650,7 @@ type User struct {
 	Metadata  orderedmap.OrderedMap `json:"metadata"`
 	CreatedAt time.Time             `json:"created_at"`
 	UpdatedAt time.Time             `json:"updated_at"`
+	DeletedAt *time.Time            `json:"deleted_at,omitempty"`
 }
 
 // GetUsername implements the activitypub.ActorLike interface.
@@ -276,6 +689,7 @@ func (u *User) scannableFields() []any {
 		&u.Metadata,
 		&u.CreatedAt,
 		&u.UpdatedAt,
+		&u.DeletedAt,
 	}
 }
 
@@ -283,6 +697,8 @@ const apiKeysTable = "api_keys"
 const apiKeysIDColumn = "id"
 const apiKeysUserIDColumn = "user_id"
 const apiKeysValueColumn = "value"
+const apiKeysAppIDColumn = "app_id"
+const apiKeysScopesColumn = "scopes"
 const apiKeysCreatedAtColumn = "created_at"
 const apiKeysUpdatedAtColumn = "updated_at"
 
@@ -290,17 +706,31 @@ var apiKeysFields = []string{ //nolint:gochecknoglobals
 	apiKeysIDColumn,
 	apiKeysUserIDColumn,
 	apiKeysValueColumn,
+	apiKeysAppIDColumn,
+	apiKeysScopesColumn,
 	apiKeysCreatedAtColumn,
 	apiKeysUpdatedAtColumn,
 }
 
 // An APIKey is a key used to verify a user's API requests.
+//
+// API keys which were issued to an OAuth application as access tokens have an
+// AppID and the scopes that were granted to the application.
 type APIKey struct {
-	ID        database.ULID `json:"id"`
-	UserID    database.ULID `json:"user_id"`
-	Value     string        `json:"value"`
-	CreatedAt time.Time     `json:"created_at"`
-	UpdatedAt time.Time     `json:"updated_at"`
+	ID        database.ULID  `json:"id"`
+	UserID    database.ULID  `json:"user_id"`
+	Value     string         `json:"value"`
+	AppID     *database.ULID `json:"app_id"`
+	Scopes    string         `json:"scopes"`
+	CreatedAt time.Time      `json:"created_at"`
+	UpdatedAt time.Time      `json:"updated_at"`
+}
+
+// HasScope returns true if the key may be used for the given scope. Keys which
+// were not issued to an app belong to the user themselves, and have every
+// scope.
+func (a APIKey) HasScope(scope string) bool {
+	return a.AppID == nil || slices.Contains(strings.Fields(a.Scopes), scope)
 }
 
 func (a *APIKey) scannableFields() []any {
@@ -308,6 +738,8 @@ func (a *APIKey) scannableFields() []any {
 		&a.ID,
 		&a.UserID,
 		&a.Value,
+		&a.AppID,
+		&a.Scopes,
 		&a.CreatedAt,
 		&a.UpdatedAt,
 	}
@@ -0,0 +1,253 @@
+package identity
+
+import (
+	"context"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/jclem/jclem.me/internal/database"
+)
+
+// A MemoryStore keeps identities in memory, for running handlers without
+// Postgres. Its zero value is empty and ready to use.
+type MemoryStore struct {
+	mu      sync.RWMutex
+	users   []User
+	keys    []SigningKey
+	apiKeys []APIKey
+	apps    []App
+	codes   []AuthorizationCode
+}
+
+var _ Store = (*MemoryStore)(nil)
+
+// NewMemoryStore creates a new, empty MemoryStore.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{}
+}
+
+// GetUserByID implements the Store interface.
+func (s *MemoryStore) GetUserByID(_ context.Context, id database.ULID) (User, error) {
+	return s.getUser(func(u User) bool { return u.ID == id })
+}
+
+// GetUserByUsername implements the Store interface.
+func (s *MemoryStore) GetUserByUsername(_ context.Context, username string) (User, error) {
+	return s.getUser(func(u User) bool { return u.Username == username })
+}
+
+func (s *MemoryStore) getUser(match func(User) bool) (User, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	i := slices.IndexFunc(s.users, match)
+	if i < 0 {
+		return User{}, ErrUserNotFound
+	}
+
+	return s.users[i], nil
+}
+
+// InsertUser implements the Store interface.
+func (s *MemoryStore) InsertUser(_ context.Context, user User, keys []SigningKey, apiKey APIKey) (User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if slices.ContainsFunc(s.users, func(u User) bool { return u.Username == user.Username }) {
+		return User{}, ErrUserExists
+	}
+
+	s.users = append(s.users, user)
+	s.keys = append(s.keys, keys...)
+	s.apiKeys = append(s.apiKeys, apiKey)
+
+	return user, nil
+}
+
+// UpdateUser implements the Store interface.
+func (s *MemoryStore) UpdateUser(_ context.Context, id database.ULID, update UserUpdate, at time.Time) (User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	i := slices.IndexFunc(s.users, func(u User) bool { return u.ID == id })
+	if i < 0 {
+		return User{}, ErrUserNotFound
+	}
+
+	user := s.users[i]
+
+	if update.Email != nil {
+		user.Email = *update.Email
+	}
+
+	if update.Name != nil {
+		user.Name = *update.Name
+	}
+
+	if update.Summary != nil {
+		user.Summary = *update.Summary
+	}
+
+	if update.ImageURL != nil {
+		user.ImageURL = *update.ImageURL
+	}
+
+	if update.Metadata != nil {
+		user.Metadata = *update.Metadata
+	}
+
+	user.UpdatedAt = at
+	s.users[i] = user
+
+	return user, nil
+}
+
+// DeleteUser implements the Store interface.
+func (s *MemoryStore) DeleteUser(_ context.Context, id database.ULID, at time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	i := slices.IndexFunc(s.users, func(u User) bool { return u.ID == id && u.DeletedAt == nil })
+	if i < 0 {
+		return ErrUserNotFound
+	}
+
+	s.users[i].DeletedAt = &at
+	s.users[i].UpdatedAt = at
+
+	return nil
+}
+
+// ListSigningKeys implements the Store interface.
+func (s *MemoryStore) ListSigningKeys(_ context.Context, userID database.ULID, at time.Time) ([]SigningKey, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var keys []SigningKey
+
+	for _, k := range s.keys {
+		if k.UserID == userID && (k.ExpiresAt == nil || k.ExpiresAt.After(at)) {
+			keys = append(keys, k)
+		}
+	}
+
+	sort.SliceStable(keys, func(i, j int) bool {
+		return keys[i].Version > keys[j].Version
+	})
+
+	return keys, nil
+}
+
+// RotateSigningKeys implements the Store interface.
+func (s *MemoryStore) RotateSigningKeys(_ context.Context, public, private SigningKey, publicExpiresAt time.Time) (SigningKey, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var version int
+
+	for i, k := range s.keys {
+		if k.UserID != public.UserID {
+			continue
+		}
+
+		version = max(version, k.Version)
+
+		if k.ExpiresAt == nil {
+			expiresAt := public.CreatedAt
+			if k.Kind == string(keyKindPublic) {
+				expiresAt = publicExpiresAt
+			}
+
+			s.keys[i].ExpiresAt = &expiresAt
+			s.keys[i].UpdatedAt = public.CreatedAt
+		}
+	}
+
+	public.Version = version + 1
+	private.Version = version + 1
+	s.keys = append(s.keys, public, private)
+
+	return public, nil
+}
+
+// GetAPIKey implements the Store interface.
+func (s *MemoryStore) GetAPIKey(_ context.Context, id string) (APIKey, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	i := slices.IndexFunc(s.apiKeys, func(k APIKey) bool { return k.ID.String() == id })
+	if i < 0 {
+		return APIKey{}, ErrInvalidAPIKey
+	}
+
+	return s.apiKeys[i], nil
+}
+
+// DeleteAPIKey implements the Store interface.
+func (s *MemoryStore) DeleteAPIKey(_ context.Context, id string, appID database.ULID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.apiKeys = slices.DeleteFunc(s.apiKeys, func(k APIKey) bool {
+		return k.ID.String() == id && k.AppID != nil && *k.AppID == appID
+	})
+
+	return nil
+}
+
+// InsertApp implements the Store interface.
+func (s *MemoryStore) InsertApp(_ context.Context, app App) (App, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	app.RedirectURIs = slices.Clone(app.RedirectURIs)
+	s.apps = append(s.apps, app)
+
+	return app, nil
+}
+
+// GetApp implements the Store interface.
+func (s *MemoryStore) GetApp(_ context.Context, id database.ULID) (App, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	i := slices.IndexFunc(s.apps, func(a App) bool { return a.ID == id })
+	if i < 0 {
+		return App{}, ErrAppNotFound
+	}
+
+	return s.apps[i], nil
+}
+
+// InsertAuthorizationCode implements the Store interface.
+func (s *MemoryStore) InsertAuthorizationCode(_ context.Context, code AuthorizationCode) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.codes = append(s.codes, code)
+
+	return nil
+}
+
+// RedeemAuthorizationCode implements the Store interface.
+func (s *MemoryStore) RedeemAuthorizationCode(_ context.Context, code string, redeem func(AuthorizationCode) (APIKey, error)) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	i := slices.IndexFunc(s.codes, func(c AuthorizationCode) bool { return c.Code == code })
+	if i < 0 {
+		return ErrInvalidGrant
+	}
+
+	key, err := redeem(s.codes[i])
+	if err != nil {
+		return err
+	}
+
+	s.codes = slices.Delete(s.codes, i, i+1)
+	s.apiKeys = append(s.apiKeys, key)
+
+	return nil
+}
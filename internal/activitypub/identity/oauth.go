@@ -0,0 +1,386 @@
+package identity
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/jclem/jclem.me/internal/database"
+)
+
+// An App is a third-party OAuth client.
+type App struct {
+	ID           database.ULID `json:"id"`
+	Name         string        `json:"name"`
+	Website      string        `json:"website"`
+	ClientSecret string        `json:"client_secret"`
+	RedirectURIs []string      `json:"redirect_uris"`
+	Scopes       string        `json:"scopes"`
+	CreatedAt    time.Time     `json:"created_at"`
+	UpdatedAt    time.Time     `json:"updated_at"`
+}
+
+// AllowsRedirectURI returns true if the app registered the given redirect URI.
+func (a App) AllowsRedirectURI(uri string) bool {
+	return slices.Contains(a.RedirectURIs, uri)
+}
+
+// AllowsScopes returns true if every scope in the given space-separated list
+// was registered by the app.
+func (a App) AllowsScopes(scopes string) bool {
+	allowed := strings.Fields(a.Scopes)
+
+	for _, scope := range strings.Fields(scopes) {
+		if !slices.Contains(allowed, scope) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (a *App) scannableFields() []any {
+	return []any{
+		&a.ID,
+		&a.Name,
+		&a.Website,
+		&a.ClientSecret,
+		&a.RedirectURIs,
+		&a.Scopes,
+		&a.CreatedAt,
+		&a.UpdatedAt,
+	}
+}
+
+// NewApp is the input for registering a new OAuth app.
+type NewApp struct {
+	Name         string   `json:"client_name"`
+	Website      string   `json:"website"`
+	RedirectURIs []string `json:"redirect_uris"`
+	Scopes       string   `json:"scopes"`
+}
+
+// ReadScope is the scope which allows an app to read a user's private data,
+// such as their notifications.
+const ReadScope = "read"
+
+// DefaultScopes are the scopes granted to apps which do not request any.
+const DefaultScopes = ReadScope
+
+// WriteScope is the scope which allows an app to publish on a user's behalf.
+const WriteScope = "write"
+
+// ErrInvalidApp is returned when an app registration is invalid.
+var ErrInvalidApp = fmt.Errorf("invalid app")
+
+// ErrAppNotFound is returned when an OAuth app is not found.
+var ErrAppNotFound = fmt.Errorf("app not found")
+
+// ErrInvalidGrant is returned when an authorization code cannot be exchanged
+// for an access token.
+//
+// SEE https://datatracker.ietf.org/doc/html/rfc6749#section-5.2
+var ErrInvalidGrant = fmt.Errorf("invalid grant")
+
+// ErrInvalidClient is returned when OAuth client authentication fails.
+var ErrInvalidClient = fmt.Errorf("invalid client")
+
+// CreateApp registers a new OAuth app.
+func (s *Service) CreateApp(ctx context.Context, input NewApp) (App, error) {
+	if input.Name == "" || len(input.RedirectURIs) == 0 {
+		return App{}, ErrInvalidApp
+	}
+
+	for _, uri := range input.RedirectURIs {
+		if u, err := url.Parse(uri); err != nil || u.Scheme == "" {
+			return App{}, ErrInvalidApp
+		}
+	}
+
+	scopes := input.Scopes
+	if strings.TrimSpace(scopes) == "" {
+		scopes = DefaultScopes
+	}
+
+	secret, err := generateAPIKeyValue()
+	if err != nil {
+		return App{}, err
+	}
+
+	now := time.Now().UTC()
+
+	return s.store.InsertApp(ctx, App{ //nolint:wrapcheck
+		ID:           database.NewULID(),
+		Name:         input.Name,
+		Website:      input.Website,
+		ClientSecret: secret,
+		RedirectURIs: input.RedirectURIs,
+		Scopes:       strings.Join(strings.Fields(scopes), " "),
+		CreatedAt:    now,
+		UpdatedAt:    now,
+	})
+}
+
+// GetApp gets an OAuth app by its client ID.
+func (s *Service) GetApp(ctx context.Context, clientID string) (App, error) {
+	id, err := database.ParseULID(clientID)
+	if err != nil {
+		return App{}, ErrAppNotFound
+	}
+
+	return s.store.GetApp(ctx, id) //nolint:wrapcheck
+}
+
+// An AuthorizationRequest is an approved request for an authorization code.
+type AuthorizationRequest struct {
+	App                 App
+	UserID              database.ULID
+	RedirectURI         string
+	Scopes              string
+	CodeChallenge       string
+	CodeChallengeMethod string
+}
+
+const authorizationCodeTTL = 10 * time.Minute
+
+// CreateAuthorizationCode issues a short-lived authorization code for an
+// approved authorization request.
+func (s *Service) CreateAuthorizationCode(ctx context.Context, req AuthorizationRequest) (string, error) {
+	if !req.App.AllowsRedirectURI(req.RedirectURI) || !req.App.AllowsScopes(req.Scopes) {
+		return "", ErrInvalidGrant
+	}
+
+	if !slices.Contains([]string{"", codeChallengeMethodPlain, codeChallengeMethodS256}, req.CodeChallengeMethod) {
+		return "", ErrInvalidGrant
+	}
+
+	code, err := generateAPIKeyValue()
+	if err != nil {
+		return "", err
+	}
+
+	now := time.Now().UTC()
+
+	if err := s.store.InsertAuthorizationCode(ctx, AuthorizationCode{
+		Code:                code,
+		AppID:               req.App.ID,
+		UserID:              req.UserID,
+		RedirectURI:         req.RedirectURI,
+		Scopes:              req.Scopes,
+		CodeChallenge:       req.CodeChallenge,
+		CodeChallengeMethod: req.CodeChallengeMethod,
+		ExpiresAt:           now.Add(authorizationCodeTTL),
+		CreatedAt:           now,
+		UpdatedAt:           now,
+	}); err != nil {
+		return "", err //nolint:wrapcheck
+	}
+
+	return code, nil
+}
+
+// A TokenRequest is a request to exchange an authorization code for an access
+// token.
+//
+// SEE https://datatracker.ietf.org/doc/html/rfc6749#section-4.1.3
+type TokenRequest struct {
+	ClientID     string
+	ClientSecret string
+	Code         string
+	RedirectURI  string
+	CodeVerifier string
+}
+
+// An AccessToken is an access token issued to an OAuth app.
+type AccessToken struct {
+	Token     string
+	Scopes    string
+	CreatedAt time.Time
+}
+
+// ExchangeAuthorizationCode exchanges an authorization code for an access
+// token.
+//
+// Authorization codes are single-use.
+func (s *Service) ExchangeAuthorizationCode(ctx context.Context, req TokenRequest) (AccessToken, error) {
+	app, err := s.GetApp(ctx, req.ClientID)
+	if err != nil {
+		if errors.Is(err, ErrAppNotFound) {
+			return AccessToken{}, ErrInvalidClient
+		}
+
+		return AccessToken{}, err
+	}
+
+	if subtle.ConstantTimeCompare([]byte(app.ClientSecret), []byte(req.ClientSecret)) != 1 {
+		return AccessToken{}, ErrInvalidClient
+	}
+
+	var token AccessToken
+
+	if err := s.store.RedeemAuthorizationCode(ctx, req.Code, func(code AuthorizationCode) (APIKey, error) {
+		now := time.Now().UTC()
+
+		if code.AppID != app.ID || code.RedirectURI != req.RedirectURI || now.After(code.ExpiresAt) {
+			return APIKey{}, ErrInvalidGrant
+		}
+
+		if !verifyCodeChallenge(code.CodeChallenge, code.CodeChallengeMethod, req.CodeVerifier) {
+			return APIKey{}, ErrInvalidGrant
+		}
+
+		value, err := generateAPIKeyValue()
+		if err != nil {
+			return APIKey{}, err
+		}
+
+		key := APIKey{
+			ID:        database.NewULID(),
+			UserID:    code.UserID,
+			Value:     value,
+			AppID:     &app.ID,
+			Scopes:    code.Scopes,
+			CreatedAt: now,
+			UpdatedAt: now,
+		}
+
+		token = AccessToken{Token: key.ID.String() + "." + value, Scopes: code.Scopes, CreatedAt: now}
+
+		return key, nil
+	}); err != nil {
+		return AccessToken{}, fmt.Errorf("could not exchange authorization code: %w", err)
+	}
+
+	return token, nil
+}
+
+// RevokeAccessToken revokes an access token issued to an OAuth app.
+//
+// Revoking a token which does not exist is not an error.
+//
+// SEE https://datatracker.ietf.org/doc/html/rfc7009#section-2.2
+func (s *Service) RevokeAccessToken(ctx context.Context, clientID, clientSecret, token string) error {
+	app, err := s.GetApp(ctx, clientID)
+	if err != nil {
+		if errors.Is(err, ErrAppNotFound) {
+			return ErrInvalidClient
+		}
+
+		return err
+	}
+
+	if subtle.ConstantTimeCompare([]byte(app.ClientSecret), []byte(clientSecret)) != 1 {
+		return ErrInvalidClient
+	}
+
+	keyid, _, _ := strings.Cut(token, ".")
+
+	return s.store.DeleteAPIKey(ctx, keyid, app.ID) //nolint:wrapcheck
+}
+
+const codeChallengeMethodPlain = "plain"
+const codeChallengeMethodS256 = "S256"
+
+// verifyCodeChallenge verifies a PKCE code verifier against the challenge
+// given in the authorization request.
+//
+// SEE https://datatracker.ietf.org/doc/html/rfc7636#section-4.6
+func verifyCodeChallenge(challenge, method, verifier string) bool {
+	if challenge == "" {
+		return true
+	}
+
+	switch method {
+	case codeChallengeMethodS256:
+		sum := sha256.Sum256([]byte(verifier))
+		verifier = base64.RawURLEncoding.EncodeToString(sum[:])
+	case "", codeChallengeMethodPlain:
+	default:
+		return false
+	}
+
+	return subtle.ConstantTimeCompare([]byte(challenge), []byte(verifier)) == 1
+}
+
+const oauthAppsTable = "oauth_apps"
+const oauthAppsIDColumn = "id"
+const oauthAppsNameColumn = "name"
+const oauthAppsWebsiteColumn = "website"
+const oauthAppsClientSecretColumn = "client_secret"
+const oauthAppsRedirectURIsColumn = "redirect_uris"
+const oauthAppsScopesColumn = "scopes"
+const oauthAppsCreatedAtColumn = "created_at"
+const oauthAppsUpdatedAtColumn = "updated_at"
+
+var oauthAppsFields = []string{ //nolint:gochecknoglobals
+	oauthAppsIDColumn,
+	oauthAppsNameColumn,
+	oauthAppsWebsiteColumn,
+	oauthAppsClientSecretColumn,
+	oauthAppsRedirectURIsColumn,
+	oauthAppsScopesColumn,
+	oauthAppsCreatedAtColumn,
+	oauthAppsUpdatedAtColumn,
+}
+
+const oauthCodesTable = "oauth_authorization_codes"
+const oauthCodesIDColumn = "id"
+const oauthCodesAppIDColumn = "app_id"
+const oauthCodesUserIDColumn = "user_id"
+const oauthCodesRedirectURIColumn = "redirect_uri"
+const oauthCodesScopesColumn = "scopes"
+const oauthCodesCodeChallengeColumn = "code_challenge"
+const oauthCodesCodeChallengeMethodColumn = "code_challenge_method"
+const oauthCodesExpiresAtColumn = "expires_at"
+const oauthCodesCreatedAtColumn = "created_at"
+const oauthCodesUpdatedAtColumn = "updated_at"
+
+var oauthCodesFields = []string{ //nolint:gochecknoglobals
+	oauthCodesIDColumn,
+	oauthCodesAppIDColumn,
+	oauthCodesUserIDColumn,
+	oauthCodesRedirectURIColumn,
+	oauthCodesScopesColumn,
+	oauthCodesCodeChallengeColumn,
+	oauthCodesCodeChallengeMethodColumn,
+	oauthCodesExpiresAtColumn,
+	oauthCodesCreatedAtColumn,
+	oauthCodesUpdatedAtColumn,
+}
+
+// An AuthorizationCode is an authorization code issued for an approved
+// authorization request, which an app exchanges for an access token.
+type AuthorizationCode struct {
+	Code                string
+	AppID               database.ULID
+	UserID              database.ULID
+	RedirectURI         string
+	Scopes              string
+	CodeChallenge       string
+	CodeChallengeMethod string
+	ExpiresAt           time.Time
+	CreatedAt           time.Time
+	UpdatedAt           time.Time
+}
+
+func (c *AuthorizationCode) scannableFields() []any {
+	return []any{
+		&c.Code,
+		&c.AppID,
+		&c.UserID,
+		&c.RedirectURI,
+		&c.Scopes,
+		&c.CodeChallenge,
+		&c.CodeChallengeMethod,
+		&c.ExpiresAt,
+		&c.CreatedAt,
+		&c.UpdatedAt,
+	}
+}
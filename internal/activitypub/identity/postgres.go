@@ -0,0 +1,434 @@
+package identity
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/Masterminds/squirrel"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/jclem/jclem.me/internal/database"
+)
+
+// A PostgresStore keeps identities in Postgres.
+type PostgresStore struct {
+	pool *pgxpool.Pool
+	sql  squirrel.StatementBuilderType
+}
+
+var _ Store = (*PostgresStore)(nil)
+
+// NewPostgresStore creates a new PostgresStore.
+func NewPostgresStore(pool *pgxpool.Pool) *PostgresStore {
+	return &PostgresStore{
+		pool: pool,
+		sql:  squirrel.StatementBuilder.PlaceholderFormat(squirrel.Dollar),
+	}
+}
+
+// GetUserByID implements the Store interface.
+func (s *PostgresStore) GetUserByID(ctx context.Context, id database.ULID) (User, error) {
+	return s.getUser(ctx, squirrel.Eq{usersIDColumn: id})
+}
+
+// GetUserByUsername implements the Store interface.
+func (s *PostgresStore) GetUserByUsername(ctx context.Context, username string) (User, error) {
+	return s.getUser(ctx, squirrel.Eq{usersUsernameColumn: username})
+}
+
+func (s *PostgresStore) getUser(ctx context.Context, where squirrel.Eq) (User, error) {
+	query, args, err := s.sql.
+		Select(usersFields...).
+		From(usersTable).
+		Where(where).
+		ToSql()
+	if err != nil {
+		return User{}, fmt.Errorf("could not build query: %w", err)
+	}
+
+	var user User
+	if err := s.pool.QueryRow(ctx, query, args...).Scan(user.scannableFields()...); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return User{}, ErrUserNotFound
+		}
+
+		return User{}, fmt.Errorf("could not query row: %w", err)
+	}
+
+	return user, nil
+}
+
+const uniqueViolationCode = "23505"
+
+// InsertUser implements the Store interface.
+func (s *PostgresStore) InsertUser(ctx context.Context, user User, keys []SigningKey, apiKey APIKey) (User, error) {
+	if err := pgx.BeginFunc(ctx, s.pool, func(tx pgx.Tx) error {
+		query, args, err := s.sql.
+			Insert(usersTable).
+			Columns(usersFields...).
+			Values(user.ID, user.Email, user.Username, user.Summary, user.Name, user.ImageURL, user.Metadata, user.CreatedAt, user.UpdatedAt, user.DeletedAt).
+			Suffix("RETURNING " + strings.Join(usersFields, ", ")).
+			ToSql()
+		if err != nil {
+			return fmt.Errorf("could not build query: %w", err)
+		}
+
+		if err := tx.QueryRow(ctx, query, args...).Scan(user.scannableFields()...); err != nil {
+			var pgErr *pgconn.PgError
+			if errors.As(err, &pgErr) && pgErr.Code == uniqueViolationCode {
+				return ErrUserExists
+			}
+
+			return fmt.Errorf("could not insert user: %w", err)
+		}
+
+		q := s.sql.Insert(signingKeysTable).Columns(signingKeysFields...)
+		for _, k := range keys {
+			q = q.Values(k.ID, k.UserID, k.Kind, k.PEM, k.Version, k.ExpiresAt, k.CreatedAt, k.UpdatedAt)
+		}
+
+		query, args, err = q.ToSql()
+		if err != nil {
+			return fmt.Errorf("could not build query: %w", err)
+		}
+
+		if _, err := tx.Exec(ctx, query, args...); err != nil {
+			return fmt.Errorf("could not insert signing keys: %w", err)
+		}
+
+		return s.insertAPIKey(ctx, tx, apiKey)
+	}); err != nil {
+		return User{}, fmt.Errorf("could not create user: %w", err)
+	}
+
+	return user, nil
+}
+
+// UpdateUser implements the Store interface.
+func (s *PostgresStore) UpdateUser(ctx context.Context, id database.ULID, update UserUpdate, at time.Time) (User, error) {
+	changes := map[string]any{usersUpdatedAt: at}
+
+	if update.Email != nil {
+		changes[usersEmailColumn] = *update.Email
+	}
+
+	if update.Name != nil {
+		changes[usersNameColumn] = *update.Name
+	}
+
+	if update.Summary != nil {
+		changes[usersSummaryColumn] = *update.Summary
+	}
+
+	if update.ImageURL != nil {
+		changes[usersImageURLColumn] = *update.ImageURL
+	}
+
+	if update.Metadata != nil {
+		changes[usersMetadataColumn] = *update.Metadata
+	}
+
+	query, args, err := s.sql.
+		Update(usersTable).
+		SetMap(changes).
+		Where(squirrel.Eq{usersIDColumn: id}).
+		Suffix("RETURNING " + strings.Join(usersFields, ", ")).
+		ToSql()
+	if err != nil {
+		return User{}, fmt.Errorf("could not build query: %w", err)
+	}
+
+	var user User
+	if err := s.pool.QueryRow(ctx, query, args...).Scan(user.scannableFields()...); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return User{}, ErrUserNotFound
+		}
+
+		return User{}, fmt.Errorf("could not update user: %w", err)
+	}
+
+	return user, nil
+}
+
+// DeleteUser implements the Store interface.
+func (s *PostgresStore) DeleteUser(ctx context.Context, id database.ULID, at time.Time) error {
+	query, args, err := s.sql.
+		Update(usersTable).
+		SetMap(map[string]any{usersDeletedAt: at, usersUpdatedAt: at}).
+		Where(squirrel.Eq{usersIDColumn: id, usersDeletedAt: nil}).
+		ToSql()
+	if err != nil {
+		return fmt.Errorf("could not build query: %w", err)
+	}
+
+	tag, err := s.pool.Exec(ctx, query, args...)
+	if err != nil {
+		return fmt.Errorf("could not delete user: %w", err)
+	}
+
+	if tag.RowsAffected() == 0 {
+		return ErrUserNotFound
+	}
+
+	return nil
+}
+
+// ListSigningKeys implements the Store interface.
+func (s *PostgresStore) ListSigningKeys(ctx context.Context, userID database.ULID, at time.Time) ([]SigningKey, error) {
+	query, args, err := s.sql.
+		Select(signingKeysFields...).
+		From(signingKeysTable).
+		Where(squirrel.Eq{signingKeysUserIDColumn: userID}).
+		Where(squirrel.Or{
+			squirrel.Eq{signingKeysExpiresAtColumn: nil},
+			squirrel.Gt{signingKeysExpiresAtColumn: at},
+		}).
+		OrderBy(signingKeysVersionColumn + " DESC").
+		ToSql()
+	if err != nil {
+		return nil, fmt.Errorf("could not build query: %w", err)
+	}
+
+	rows, err := s.pool.Query(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("could not query signing keys: %w", err)
+	}
+
+	defer rows.Close()
+
+	var keys []SigningKey
+
+	for rows.Next() {
+		var key SigningKey
+		if err := rows.Scan(key.scannableFields()...); err != nil {
+			return nil, fmt.Errorf("could not scan signing key: %w", err)
+		}
+
+		keys = append(keys, key)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("could not iterate signing keys: %w", err)
+	}
+
+	return keys, nil
+}
+
+// RotateSigningKeys implements the Store interface.
+//
+// Concurrent rotations are rejected by the unique index on key versions.
+func (s *PostgresStore) RotateSigningKeys(ctx context.Context, public, private SigningKey, publicExpiresAt time.Time) (SigningKey, error) {
+	now := public.CreatedAt
+
+	if err := pgx.BeginFunc(ctx, s.pool, func(tx pgx.Tx) error {
+		query, args, err := s.sql.
+			Select("COALESCE(MAX(" + signingKeysVersionColumn + "), 0)").
+			From(signingKeysTable).
+			Where(squirrel.Eq{signingKeysUserIDColumn: public.UserID}).
+			ToSql()
+		if err != nil {
+			return fmt.Errorf("could not build query: %w", err)
+		}
+
+		var version int
+		if err := tx.QueryRow(ctx, query, args...).Scan(&version); err != nil {
+			return fmt.Errorf("could not query current key version: %w", err)
+		}
+
+		for kind, expiresAt := range map[keyKind]time.Time{
+			keyKindPrivate: now,
+			keyKindPublic:  publicExpiresAt,
+		} {
+			query, args, err := s.sql.
+				Update(signingKeysTable).
+				Set(signingKeysExpiresAtColumn, expiresAt).
+				Set(signingKeysUpdatedAtColumn, now).
+				Where(squirrel.Eq{signingKeysUserIDColumn: public.UserID}).
+				Where(squirrel.Eq{signingKeysKindColumn: kind}).
+				Where(squirrel.Eq{signingKeysExpiresAtColumn: nil}).
+				ToSql()
+			if err != nil {
+				return fmt.Errorf("could not build query: %w", err)
+			}
+
+			if _, err := tx.Exec(ctx, query, args...); err != nil {
+				return fmt.Errorf("could not expire %s keys: %w", kind, err)
+			}
+		}
+
+		public.Version = version + 1
+		private.Version = version + 1
+
+		query, args, err = s.sql.
+			Insert(signingKeysTable).
+			Columns(signingKeysFields...).
+			Values(public.ID, public.UserID, public.Kind, public.PEM, public.Version, public.ExpiresAt, public.CreatedAt, public.UpdatedAt).
+			Values(private.ID, private.UserID, private.Kind, private.PEM, private.Version, private.ExpiresAt, private.CreatedAt, private.UpdatedAt).
+			ToSql()
+		if err != nil {
+			return fmt.Errorf("could not build query: %w", err)
+		}
+
+		if _, err := tx.Exec(ctx, query, args...); err != nil {
+			return fmt.Errorf("could not insert signing keys: %w", err)
+		}
+
+		return nil
+	}); err != nil {
+		return SigningKey{}, fmt.Errorf("could not rotate keys: %w", err)
+	}
+
+	return public, nil
+}
+
+// GetAPIKey implements the Store interface.
+func (s *PostgresStore) GetAPIKey(ctx context.Context, id string) (APIKey, error) {
+	query, args, err := s.sql.
+		Select(apiKeysFields...).
+		From(apiKeysTable).
+		Where(squirrel.Eq{apiKeysIDColumn: id}).
+		ToSql()
+	if err != nil {
+		return APIKey{}, fmt.Errorf("could not build query: %w", err)
+	}
+
+	var apikey APIKey
+	if err := s.pool.QueryRow(ctx, query, args...).Scan(apikey.scannableFields()...); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return APIKey{}, ErrInvalidAPIKey
+		}
+
+		return APIKey{}, fmt.Errorf("could not query row: %w", err)
+	}
+
+	return apikey, nil
+}
+
+// DeleteAPIKey implements the Store interface.
+func (s *PostgresStore) DeleteAPIKey(ctx context.Context, id string, appID database.ULID) error {
+	query, args, err := s.sql.
+		Delete(apiKeysTable).
+		Where(squirrel.Eq{apiKeysIDColumn: id}).
+		Where(squirrel.Eq{apiKeysAppIDColumn: appID}).
+		ToSql()
+	if err != nil {
+		return fmt.Errorf("could not build query: %w", err)
+	}
+
+	if _, err := s.pool.Exec(ctx, query, args...); err != nil {
+		return fmt.Errorf("could not delete access token: %w", err)
+	}
+
+	return nil
+}
+
+func (s *PostgresStore) insertAPIKey(ctx context.Context, tx pgx.Tx, key APIKey) error {
+	query, args, err := s.sql.
+		Insert(apiKeysTable).
+		Columns(apiKeysFields...).
+		Values(key.ID, key.UserID, key.Value, key.AppID, key.Scopes, key.CreatedAt, key.UpdatedAt).
+		ToSql()
+	if err != nil {
+		return fmt.Errorf("could not build query: %w", err)
+	}
+
+	if _, err := tx.Exec(ctx, query, args...); err != nil {
+		return fmt.Errorf("could not insert API key: %w", err)
+	}
+
+	return nil
+}
+
+// InsertApp implements the Store interface.
+func (s *PostgresStore) InsertApp(ctx context.Context, app App) (App, error) {
+	query, args, err := s.sql.
+		Insert(oauthAppsTable).
+		Columns(oauthAppsFields...).
+		Values(app.ID, app.Name, app.Website, app.ClientSecret, app.RedirectURIs, app.Scopes, app.CreatedAt, app.UpdatedAt).
+		Suffix("RETURNING " + strings.Join(oauthAppsFields, ", ")).
+		ToSql()
+	if err != nil {
+		return App{}, fmt.Errorf("could not build query: %w", err)
+	}
+
+	if err := s.pool.QueryRow(ctx, query, args...).Scan(app.scannableFields()...); err != nil {
+		return App{}, fmt.Errorf("could not insert app: %w", err)
+	}
+
+	return app, nil
+}
+
+// GetApp implements the Store interface.
+func (s *PostgresStore) GetApp(ctx context.Context, id database.ULID) (App, error) {
+	query, args, err := s.sql.
+		Select(oauthAppsFields...).
+		From(oauthAppsTable).
+		Where(squirrel.Eq{oauthAppsIDColumn: id}).
+		ToSql()
+	if err != nil {
+		return App{}, fmt.Errorf("could not build query: %w", err)
+	}
+
+	var app App
+	if err := s.pool.QueryRow(ctx, query, args...).Scan(app.scannableFields()...); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return App{}, ErrAppNotFound
+		}
+
+		return App{}, fmt.Errorf("could not query row: %w", err)
+	}
+
+	return app, nil
+}
+
+// InsertAuthorizationCode implements the Store interface.
+func (s *PostgresStore) InsertAuthorizationCode(ctx context.Context, c AuthorizationCode) error {
+	query, args, err := s.sql.
+		Insert(oauthCodesTable).
+		Columns(oauthCodesFields...).
+		Values(c.Code, c.AppID, c.UserID, c.RedirectURI, c.Scopes, c.CodeChallenge, c.CodeChallengeMethod, c.ExpiresAt, c.CreatedAt, c.UpdatedAt).
+		ToSql()
+	if err != nil {
+		return fmt.Errorf("could not build query: %w", err)
+	}
+
+	if _, err := s.pool.Exec(ctx, query, args...); err != nil {
+		return fmt.Errorf("could not insert authorization code: %w", err)
+	}
+
+	return nil
+}
+
+// RedeemAuthorizationCode implements the Store interface.
+func (s *PostgresStore) RedeemAuthorizationCode(ctx context.Context, code string, redeem func(AuthorizationCode) (APIKey, error)) error {
+	return pgx.BeginFunc(ctx, s.pool, func(tx pgx.Tx) error { //nolint:wrapcheck
+		query, args, err := s.sql.
+			Delete(oauthCodesTable).
+			Where(squirrel.Eq{oauthCodesIDColumn: code}).
+			Suffix("RETURNING " + strings.Join(oauthCodesFields, ", ")).
+			ToSql()
+		if err != nil {
+			return fmt.Errorf("could not build query: %w", err)
+		}
+
+		var c AuthorizationCode
+		if err := tx.QueryRow(ctx, query, args...).Scan(c.scannableFields()...); err != nil {
+			if errors.Is(err, pgx.ErrNoRows) {
+				return ErrInvalidGrant
+			}
+
+			return fmt.Errorf("could not query row: %w", err)
+		}
+
+		key, err := redeem(c)
+		if err != nil {
+			return err
+		}
+
+		return s.insertAPIKey(ctx, tx, key)
+	})
+}
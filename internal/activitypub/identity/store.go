@@ -0,0 +1,70 @@
+package identity
+
+import (
+	"context"
+	"time"
+
+	"github.com/jclem/jclem.me/internal/database"
+)
+
+// A Store keeps users, their signing keys and API keys, and OAuth apps and
+// authorization codes. The Service generates keys and checks secrets before
+// they are stored, so a Store only records what it is given.
+//
+// Methods which get a user return ErrUserNotFound if there is no such user,
+// and return deleted users as they are.
+type Store interface {
+	// GetUserByID returns the user with the given ID.
+	GetUserByID(ctx context.Context, id database.ULID) (User, error)
+
+	// GetUserByUsername returns the user with the given username.
+	GetUserByUsername(ctx context.Context, username string) (User, error)
+
+	// InsertUser stores a new user along with their signing keys and first API
+	// key, returning the user as stored. It returns ErrUserExists if the
+	// username is taken.
+	InsertUser(ctx context.Context, user User, keys []SigningKey, apiKey APIKey) (User, error)
+
+	// UpdateUser applies an update to the user with the given ID at the given
+	// time, returning the user.
+	UpdateUser(ctx context.Context, id database.ULID, update UserUpdate, at time.Time) (User, error)
+
+	// DeleteUser marks the user with the given ID deleted at the given time.
+	// It returns ErrUserNotFound if there is no such user, or they were
+	// already deleted.
+	DeleteUser(ctx context.Context, id database.ULID, at time.Time) error
+
+	// ListSigningKeys returns a user's public and private signing keys which
+	// have not expired at the given time, newest first.
+	ListSigningKeys(ctx context.Context, userID database.ULID, at time.Time) ([]SigningKey, error)
+
+	// RotateSigningKeys stores a new public and private key as the next
+	// version of a user's keys, returning the public key as stored. The
+	// previous private key expires when the new keys are created, and the
+	// previous public key expires at publicExpiresAt.
+	RotateSigningKeys(ctx context.Context, public, private SigningKey, publicExpiresAt time.Time) (SigningKey, error)
+
+	// GetAPIKey returns the API key with the given ID, or ErrInvalidAPIKey if
+	// there is none.
+	GetAPIKey(ctx context.Context, id string) (APIKey, error)
+
+	// DeleteAPIKey deletes the API key with the given ID if it was issued to
+	// the given app.
+	DeleteAPIKey(ctx context.Context, id string, appID database.ULID) error
+
+	// InsertApp stores a new OAuth app, returning it as stored.
+	InsertApp(ctx context.Context, app App) (App, error)
+
+	// GetApp returns the app with the given ID, or ErrAppNotFound if there is
+	// none.
+	GetApp(ctx context.Context, id database.ULID) (App, error)
+
+	// InsertAuthorizationCode stores a new authorization code.
+	InsertAuthorizationCode(ctx context.Context, code AuthorizationCode) error
+
+	// RedeemAuthorizationCode deletes an authorization code and stores the API
+	// key returned by redeem for it, together, so that a code is redeemed only
+	// once. It returns ErrInvalidGrant if there is no such code, and the error
+	// returned by redeem as is.
+	RedeemAuthorizationCode(ctx context.Context, code string, redeem func(AuthorizationCode) (APIKey, error)) error
+}
@@ -0,0 +1,98 @@
+package activitypub
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/jclem/jclem.me/internal/activitypub/identity"
+	"github.com/jclem/jclem.me/internal/database"
+)
+
+// An ImportedNote is a note published on another server, such as one whose
+// archive is being imported.
+type ImportedNote struct {
+	// SourceID is the note's ID on the other server. Importing a note with the
+	// same SourceID and Published time again does nothing.
+	SourceID  string
+	Content   string
+	Published time.Time
+	To        []string
+	Cc        []string
+}
+
+// ImportNote stores a note published on another server as the user's, along
+// with the Create activity which published it, as of when it was published.
+// It is not delivered to the user's followers.
+//
+// It returns false if the note had already been imported.
+func (s *Service) ImportNote(ctx context.Context, user identity.User, imported ImportedNote) (NoteRecord, bool, error) {
+	published := imported.Published.UTC()
+	noteID := database.ULIDAt(published, imported.SourceID)
+
+	existing, err := s.store.GetNote(ctx, user.ID, noteID, true)
+	if err == nil {
+		return existing, false, nil
+	}
+
+	if !errors.Is(err, ErrNoteNotFound) {
+		return NoteRecord{}, false, fmt.Errorf("failed to get note: %w", err)
+	}
+
+	note := Note{
+		Context:      NewContext(ActivityStreamsContext, MastodonContext),
+		Type:         "Note",
+		ID:           fmt.Sprintf("%s/notes/%s", s.site.ActorID(user), noteID),
+		AttributedTo: s.site.ActorID(user),
+		Content:      imported.Content,
+		Published:    published.Format(http.TimeFormat),
+		To:           imported.To,
+		Cc:           imported.Cc,
+	}
+
+	activity := NewCreateActivity(s.site, user, note, note.Published, note.To, note.Cc)
+	activityID := database.ULIDAt(published, imported.SourceID+"#create")
+	activity.ID = fmt.Sprintf("%s/outbox/%s", s.site.ActorID(user), activityID)
+
+	data, err := json.Marshal(activity)
+	if err != nil {
+		return NoteRecord{}, false, fmt.Errorf("failed to marshal activity: %w", err)
+	}
+
+	var record NoteRecord
+
+	err = s.store.Tx(ctx, func(tx Tx) error {
+		now := time.Now().UTC()
+
+		// The activity is created as of when the note was published, so that
+		// it is ordered among the user's other activities in the outbox.
+		if _, err := tx.InsertActivity(ctx, ActivityRecord{
+			RecordID:  activityID,
+			UserID:    user.ID,
+			Mailbox:   Outbox,
+			Context:   ActivityStreamsContext,
+			Type:      activity.Type,
+			ID:        activity.ID,
+			Data:      data,
+			CreatedAt: published,
+			UpdatedAt: now,
+		}); err != nil {
+			return fmt.Errorf("failed to create activity record: %w", err)
+		}
+
+		record, err = s.insertNote(ctx, tx, user.ID, activity.ID, note)
+		if err != nil {
+			return fmt.Errorf("failed to create note: %w", err)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return NoteRecord{}, false, err //nolint:wrapcheck
+	}
+
+	return record, true, nil
+}
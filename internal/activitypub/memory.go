@@ -0,0 +1,530 @@
+package activitypub
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/jclem/jclem.me/internal/activitypub/identity"
+	"github.com/jclem/jclem.me/internal/database"
+	"github.com/jclem/jclem.me/internal/webhooks"
+	"github.com/riverqueue/river"
+	"github.com/riverqueue/river/rivertype"
+)
+
+// A MemoryStore keeps activities in memory, for running handlers without
+// Postgres. Jobs are recorded rather than worked, and are listed by Jobs, or
+// taken by NextJob to be worked by Service.WorkJob. Its zero value is empty and
+// ready to use.
+type MemoryStore struct {
+	mu    sync.RWMutex
+	state memoryState
+
+	// taken is the number of jobs which NextJob has returned.
+	taken int
+}
+
+type memoryState struct {
+	activities    []ActivityRecord
+	notes         []NoteRecord
+	followers     []FollowerRecord
+	notifications []NotificationRecord
+	jobs          []river.JobArgs
+}
+
+// clone copies the state's lists, so that a transaction's changes can be
+// discarded. Records are replaced rather than changed in place, so they are
+// not copied.
+func (m memoryState) clone() memoryState {
+	return memoryState{
+		activities:    slices.Clone(m.activities),
+		notes:         slices.Clone(m.notes),
+		followers:     slices.Clone(m.followers),
+		notifications: slices.Clone(m.notifications),
+		jobs:          slices.Clone(m.jobs),
+	}
+}
+
+var _ Store = (*MemoryStore)(nil)
+
+// NewMemoryStore creates a new, empty MemoryStore.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{}
+}
+
+// Jobs returns the arguments of every job enqueued in the store, in the order
+// in which they were enqueued.
+func (s *MemoryStore) Jobs() []river.JobArgs {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return slices.Clone(s.state.jobs)
+}
+
+// NextJob returns the earliest enqueued job which it has not yet returned, or
+// false if there is none. Jobs still lists it.
+func (s *MemoryStore) NextJob() (river.JobArgs, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.taken >= len(s.state.jobs) {
+		return nil, false
+	}
+
+	s.taken++
+
+	return s.state.jobs[s.taken-1], true
+}
+
+// WorkJob works a job with the worker of its kind, as the job client would on
+// its first attempt, so that jobs recorded by a MemoryStore can be worked
+// without one. Periodic jobs and jobs registered with WithWorker are not
+// supported.
+func (s *Service) WorkJob(ctx context.Context, id *identity.Service, args river.JobArgs) error {
+	switch args := args.(type) {
+	case HandleInboxArgs:
+		return workJob(ctx, newHandleFollowWorker(s), args)
+	case DeliverAcceptArgs:
+		return workJob(ctx, newDeliverAcceptWorker(s, id), args)
+	case HandleOutboxArgs:
+		return workJob(ctx, newHandleOutboxWorker(s, id), args)
+	case webhooks.DeliverArgs:
+		return workJob(ctx, webhooks.NewDeliverWorker(s.webhooks), args)
+	default:
+		return fmt.Errorf("no worker for job kind: %q", args.Kind())
+	}
+}
+
+func workJob[T river.JobArgs](ctx context.Context, worker river.Worker[T], args T) error {
+	row := &rivertype.JobRow{Kind: args.Kind(), Attempt: 1, MaxAttempts: river.MaxAttemptsDefault}
+
+	return worker.Work(ctx, &river.Job[T]{JobRow: row, Args: args}) //nolint:wrapcheck
+}
+
+// Tx implements the Store interface. Other calls to the store block until fn
+// returns, so fn must only use the given Tx.
+func (s *MemoryStore) Tx(_ context.Context, fn func(Tx) error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tx := &memoryTx{state: s.state.clone()}
+	if err := fn(tx); err != nil {
+		return err
+	}
+
+	s.state = tx.state
+
+	return nil
+}
+
+// Enqueue implements the Store interface.
+func (s *MemoryStore) Enqueue(_ context.Context, args river.JobArgs, _ *river.InsertOpts) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.state.jobs = append(s.state.jobs, args)
+
+	return nil
+}
+
+// CheckJobs implements the Store interface.
+func (s *MemoryStore) CheckJobs(_ context.Context) error {
+	return nil
+}
+
+// GetActivity implements the Store interface.
+func (s *MemoryStore) GetActivity(_ context.Context, userID database.ULID, id string, deleted bool) (ActivityRecord, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.state.getActivity(userID, id, deleted)
+}
+
+func (m *memoryState) getActivity(userID database.ULID, id string, deleted bool) (ActivityRecord, error) {
+	i := slices.IndexFunc(m.activities, func(a ActivityRecord) bool {
+		return a.UserID == userID && a.ID == id && (deleted || a.DeletedAt == nil)
+	})
+	if i < 0 {
+		return ActivityRecord{}, ErrActivityNotFound
+	}
+
+	return m.activities[i], nil
+}
+
+// ListPublicActivities implements the Store interface.
+func (s *MemoryStore) ListPublicActivities(_ context.Context, userID database.ULID, mailbox Mailbox, typ string, limit, offset int) ([]ActivityRecord, int, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var activities []ActivityRecord
+
+	for _, a := range s.state.activities {
+		if a.UserID != userID || a.Mailbox != mailbox || a.Type != typ || a.DeletedAt != nil {
+			continue
+		}
+
+		var addressed struct {
+			To []string `json:"to"`
+		}
+
+		if json.Unmarshal(a.Data, &addressed) == nil && slices.Contains(addressed.To, PublicNS) {
+			activities = append(activities, a)
+		}
+	}
+
+	// Activities are appended as they are created, so the most recent are
+	// last.
+	slices.Reverse(activities)
+
+	total := len(activities)
+
+	if limit > 0 {
+		activities = activities[min(offset, total):min(offset+limit, total)]
+	}
+
+	return activities, total, nil
+}
+
+// GetNote implements the Store interface.
+func (s *MemoryStore) GetNote(_ context.Context, userID database.ULID, id database.ULID, deleted bool) (NoteRecord, error) {
+	return s.getNote(func(n NoteRecord) bool {
+		return n.UserID == userID && n.RecordID == id && (deleted || n.DeletedAt == nil)
+	})
+}
+
+// GetNoteByObjectID implements the Store interface.
+func (s *MemoryStore) GetNoteByObjectID(_ context.Context, userID database.ULID, objectID string, deleted bool) (NoteRecord, error) {
+	return s.getNote(func(n NoteRecord) bool {
+		return n.UserID == userID && n.ObjectID == objectID && (deleted || n.DeletedAt == nil)
+	})
+}
+
+func (s *MemoryStore) getNote(match func(NoteRecord) bool) (NoteRecord, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	i := slices.IndexFunc(s.state.notes, match)
+	if i < 0 {
+		return NoteRecord{}, ErrNoteNotFound
+	}
+
+	return s.state.notes[i], nil
+}
+
+// ListNotes implements the Store interface.
+func (s *MemoryStore) ListNotes(_ context.Context, userID database.ULID, public bool, limit int) ([]NoteRecord, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var notes []NoteRecord
+
+	for _, n := range s.state.notes {
+		if n.UserID == userID && n.DeletedAt == nil && (!public || n.IsPublic()) {
+			notes = append(notes, n)
+		}
+	}
+
+	sort.SliceStable(notes, func(i, j int) bool {
+		return notes[i].Published.After(notes[j].Published)
+	})
+
+	if limit > 0 && len(notes) > limit {
+		notes = notes[:limit]
+	}
+
+	return notes, nil
+}
+
+// ListFollowers implements the Store interface.
+func (s *MemoryStore) ListFollowers(_ context.Context, userID database.ULID) ([]FollowerRecord, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.state.listFollowers(userID), nil
+}
+
+func (m *memoryState) listFollowers(userID database.ULID) []FollowerRecord {
+	var followers []FollowerRecord
+
+	for _, f := range m.followers {
+		if f.UserID == userID {
+			followers = append(followers, f)
+		}
+	}
+
+	return followers
+}
+
+// ListFollowing implements the Store interface.
+func (s *MemoryStore) ListFollowing(_ context.Context, userID database.ULID) ([]string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var following []string
+
+	for _, a := range s.state.activities {
+		if a.UserID != userID || a.Mailbox != Outbox || a.Type != followActivityType || a.DeletedAt != nil || s.state.undone(a) {
+			continue
+		}
+
+		var follow Activity[string]
+		if err := json.Unmarshal(a.Data, &follow); err == nil && !slices.Contains(following, follow.Object) {
+			following = append(following, follow.Object)
+		}
+	}
+
+	slices.Sort(following)
+
+	return following, nil
+}
+
+// ListUnapplied implements the Store interface.
+func (s *MemoryStore) ListUnapplied(_ context.Context, from, to time.Time) ([]HandleInboxArgs, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	type inboxActivity struct {
+		Actor  string          `json:"actor"`
+		Object json.RawMessage `json:"object"`
+	}
+
+	isFollower := func(match func(FollowerRecord) bool) bool {
+		return slices.ContainsFunc(s.state.followers, match)
+	}
+
+	var unapplied []HandleInboxArgs
+
+	for _, a := range s.state.activities {
+		if a.Mailbox != Inbox || a.DeletedAt != nil || a.CreatedAt.Before(from) || a.CreatedAt.After(to) {
+			continue
+		}
+
+		var data inboxActivity
+		_ = json.Unmarshal(a.Data, &data)
+
+		switch a.Type {
+		case followActivityType:
+			if isFollower(func(f FollowerRecord) bool { return f.UserID == a.UserID && f.ActorID == data.Actor }) {
+				continue
+			}
+
+			if s.state.undone(a) {
+				continue
+			}
+		case undoActivityType:
+			if !isFollower(func(f FollowerRecord) bool { return f.UserID == a.UserID && f.ActivityID == referencedID(data.Object) }) {
+				continue
+			}
+		default:
+			continue
+		}
+
+		unapplied = append(unapplied, HandleInboxArgs{UserRecordID: a.UserID, ActivityID: a.ID})
+	}
+
+	return unapplied, nil
+}
+
+// undone returns true if an activity was undone by another in its mailbox.
+func (m *memoryState) undone(activity ActivityRecord) bool {
+	return slices.ContainsFunc(m.activities, func(a ActivityRecord) bool {
+		if a.UserID != activity.UserID || a.Mailbox != activity.Mailbox || a.Type != undoActivityType {
+			return false
+		}
+
+		var undo struct {
+			Object json.RawMessage `json:"object"`
+		}
+
+		return json.Unmarshal(a.Data, &undo) == nil && referencedID(undo.Object) == activity.ID
+	})
+}
+
+// ListNotifications implements the Store interface.
+func (s *MemoryStore) ListNotifications(_ context.Context, userID database.ULID, unread bool, limit, offset int) ([]NotificationRecord, int, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var notifications []NotificationRecord
+
+	for _, n := range s.state.notifications {
+		if n.UserID == userID && (!unread || n.ReadAt == nil) {
+			notifications = append(notifications, n)
+		}
+	}
+
+	// Notifications are appended as they are created, so the most recent are
+	// last.
+	slices.Reverse(notifications)
+
+	total := len(notifications)
+
+	if limit > 0 {
+		notifications = notifications[min(offset, total):min(offset+limit, total)]
+	}
+
+	return notifications, total, nil
+}
+
+// MarkNotificationsRead implements the Store interface.
+func (s *MemoryStore) MarkNotificationsRead(_ context.Context, userID database.ULID, ids []database.ULID, at time.Time) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	marked := 0
+
+	for i, n := range s.state.notifications {
+		if n.UserID != userID || n.ReadAt != nil || (len(ids) > 0 && !slices.Contains(ids, n.RecordID)) {
+			continue
+		}
+
+		s.state.notifications[i].ReadAt = &at
+		marked++
+	}
+
+	return marked, nil
+}
+
+// PurgeDeleted implements the Store interface.
+func (s *MemoryStore) PurgeDeleted(_ context.Context, before time.Time) (notes, activities int64, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	n, a := len(s.state.notes), len(s.state.activities)
+
+	s.state.notes = slices.DeleteFunc(s.state.notes, func(n NoteRecord) bool {
+		return n.DeletedAt != nil && n.DeletedAt.Before(before)
+	})
+
+	s.state.activities = slices.DeleteFunc(s.state.activities, func(a ActivityRecord) bool {
+		return a.DeletedAt != nil && a.DeletedAt.Before(before)
+	})
+
+	return int64(n - len(s.state.notes)), int64(a - len(s.state.activities)), nil
+}
+
+// A memoryTx changes a copy of a MemoryStore's state, which replaces the
+// store's state if the transaction succeeds.
+type memoryTx struct {
+	state memoryState
+}
+
+// InsertActivity implements the Tx interface.
+func (t *memoryTx) InsertActivity(_ context.Context, a ActivityRecord) (ActivityRecord, error) {
+	t.state.activities = append(t.state.activities, a)
+
+	return a, nil
+}
+
+// InsertNote implements the Tx interface.
+func (t *memoryTx) InsertNote(_ context.Context, n NoteRecord) (NoteRecord, error) {
+	t.state.notes = append(t.state.notes, n)
+
+	return n, nil
+}
+
+// UpdateNote implements the Tx interface.
+func (t *memoryTx) UpdateNote(_ context.Context, userID database.ULID, objectID, content string, at time.Time) error {
+	i := t.noteIndex(userID, objectID)
+	if i < 0 {
+		return ErrNoteNotFound
+	}
+
+	t.state.notes[i].Content = content
+	t.state.notes[i].UpdatedAt = at
+
+	return nil
+}
+
+// DeleteNote implements the Tx interface.
+func (t *memoryTx) DeleteNote(_ context.Context, userID database.ULID, objectID string, at time.Time) error {
+	i := t.noteIndex(userID, objectID)
+	if i < 0 {
+		return ErrNoteNotFound
+	}
+
+	t.state.notes[i].DeletedAt = &at
+
+	for j, a := range t.state.activities {
+		if a.UserID == userID && a.ID == t.state.notes[i].ActivityID && a.DeletedAt == nil {
+			t.state.activities[j].DeletedAt = &at
+		}
+	}
+
+	return nil
+}
+
+// HasNote implements the Tx interface.
+func (t *memoryTx) HasNote(_ context.Context, userID database.ULID, objectID string) (bool, error) {
+	return t.noteIndex(userID, objectID) >= 0, nil
+}
+
+// noteIndex returns the index of a user's undeleted note, or -1.
+func (t *memoryTx) noteIndex(userID database.ULID, objectID string) int {
+	return slices.IndexFunc(t.state.notes, func(n NoteRecord) bool {
+		return n.UserID == userID && n.ObjectID == objectID && n.DeletedAt == nil
+	})
+}
+
+// CreateFollower implements the Tx interface.
+func (t *memoryTx) CreateFollower(_ context.Context, f FollowerRecord) (FollowerRecord, error) {
+	i := slices.IndexFunc(t.state.followers, func(existing FollowerRecord) bool {
+		return existing.UserID == f.UserID && existing.ActorID == f.ActorID
+	})
+	if i >= 0 {
+		t.state.followers[i].ActivityID = f.ActivityID
+		t.state.followers[i].UpdatedAt = f.UpdatedAt
+
+		return t.state.followers[i], nil
+	}
+
+	f.RecordID = database.NewULID()
+	t.state.followers = append(t.state.followers, f)
+
+	return f, nil
+}
+
+// DeleteFollower implements the Tx interface.
+func (t *memoryTx) DeleteFollower(_ context.Context, userID database.ULID, actorID string) (bool, error) {
+	n := len(t.state.followers)
+
+	t.state.followers = slices.DeleteFunc(t.state.followers, func(f FollowerRecord) bool {
+		return f.UserID == userID && f.ActorID == actorID
+	})
+
+	return len(t.state.followers) < n, nil
+}
+
+// GetActivity implements the Tx interface.
+func (t *memoryTx) GetActivity(_ context.Context, userID database.ULID, id string) (ActivityRecord, error) {
+	return t.state.getActivity(userID, id, false)
+}
+
+// ListFollowers implements the Tx interface.
+func (t *memoryTx) ListFollowers(_ context.Context, userID database.ULID) ([]FollowerRecord, error) {
+	return t.state.listFollowers(userID), nil
+}
+
+// InsertNotification implements the Tx interface.
+func (t *memoryTx) InsertNotification(_ context.Context, n NotificationRecord) error {
+	if slices.ContainsFunc(t.state.notifications, func(existing NotificationRecord) bool {
+		return existing.UserID == n.UserID && existing.ActivityID == n.ActivityID
+	}) {
+		return nil
+	}
+
+	t.state.notifications = append(t.state.notifications, n)
+
+	return nil
+}
+
+// Enqueue implements the Tx interface.
+func (t *memoryTx) Enqueue(_ context.Context, args river.JobArgs, _ *river.InsertOpts) error {
+	t.state.jobs = append(t.state.jobs, args)
+
+	return nil
+}
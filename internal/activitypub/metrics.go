@@ -0,0 +1,215 @@
+package activitypub
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/riverqueue/river"
+	"github.com/riverqueue/river/rivertype"
+)
+
+// metricsInterval is how often a summary of jobs and deliveries is logged.
+const metricsInterval = time.Minute
+
+// jobStats summarizes the jobs of one kind worked during an interval.
+type jobStats struct {
+	// Completed jobs succeeded.
+	Completed int
+
+	// Retried jobs failed, and will be retried.
+	Retried int
+
+	// Discarded jobs failed for the last time.
+	Discarded int
+
+	// Cancelled jobs failed, and will not be retried.
+	Cancelled int
+
+	// Snoozed jobs asked to be worked later.
+	Snoozed int
+
+	// TotalRun and MaxRun are the total and longest time spent working jobs,
+	// and MaxWait is the longest time a job waited to be worked.
+	TotalRun time.Duration
+	MaxRun   time.Duration
+	MaxWait  time.Duration
+}
+
+// worked returns the number of jobs worked.
+func (s jobStats) worked() int {
+	return s.Completed + s.Retried + s.Discarded + s.Cancelled + s.Snoozed
+}
+
+// deliveryError is the status recorded for deliveries which received no
+// response.
+const deliveryError = "error"
+
+// A metricsSnapshot holds the jobs worked, by kind, and the deliveries made,
+// by inbox host and response status code, during an interval.
+type metricsSnapshot struct {
+	Jobs       map[string]jobStats
+	Deliveries map[string]map[string]int
+}
+
+// metrics counts jobs worked and activities delivered by this instance.
+type metrics struct {
+	mu       sync.Mutex
+	snapshot metricsSnapshot
+}
+
+func newMetrics() *metrics {
+	m := &metrics{}
+	m.reset()
+
+	return m
+}
+
+// reset clears the counts. The lock must be held.
+func (m *metrics) reset() {
+	m.snapshot = metricsSnapshot{Jobs: map[string]jobStats{}, Deliveries: map[string]map[string]int{}}
+}
+
+// recordJob counts a job event.
+func (m *metrics) recordJob(event *river.Event) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stats := m.snapshot.Jobs[event.Job.Kind]
+
+	switch event.Kind {
+	case river.EventKindJobCompleted:
+		stats.Completed++
+	case river.EventKindJobCancelled:
+		stats.Cancelled++
+	case river.EventKindJobSnoozed:
+		stats.Snoozed++
+	case river.EventKindJobFailed:
+		if event.Job.State == rivertype.JobStateDiscarded {
+			stats.Discarded++
+		} else {
+			stats.Retried++
+		}
+	}
+
+	if event.JobStats != nil {
+		stats.TotalRun += event.JobStats.RunDuration
+		stats.MaxRun = max(stats.MaxRun, event.JobStats.RunDuration)
+		stats.MaxWait = max(stats.MaxWait, event.JobStats.QueueWaitDuration)
+	}
+
+	m.snapshot.Jobs[event.Job.Kind] = stats
+}
+
+// recordDelivery counts a delivery to an inbox on host, given its response,
+// which is nil if the request failed.
+func (m *metrics) recordDelivery(host string, resp *http.Response) {
+	status := deliveryError
+	if resp != nil {
+		status = strconv.Itoa(resp.StatusCode)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.snapshot.Deliveries[host] == nil {
+		m.snapshot.Deliveries[host] = map[string]int{}
+	}
+
+	m.snapshot.Deliveries[host][status]++
+}
+
+// flush returns the counts since the last flush and clears them.
+func (m *metrics) flush() metricsSnapshot {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	snapshot := m.snapshot
+	m.reset()
+
+	return snapshot
+}
+
+// deliveries returns the number of deliveries to host, and how many of them
+// failed.
+func (s metricsSnapshot) deliveries(host string) (total, failed int) {
+	for status, count := range s.Deliveries[host] {
+		total += count
+
+		if code, err := strconv.Atoi(status); err != nil || code < 200 || code >= 300 {
+			failed += count
+		}
+	}
+
+	return total, failed
+}
+
+// log logs a line for each kind of job worked, and for each host to which
+// activities were delivered.
+func (s metricsSnapshot) log(ctx context.Context) {
+	for kind, stats := range s.Jobs {
+		slog.InfoContext(ctx, "jobs worked",
+			"kind", kind,
+			"worked", stats.worked(),
+			"completed", stats.Completed,
+			"retried", stats.Retried,
+			"discarded", stats.Discarded,
+			"cancelled", stats.Cancelled,
+			"snoozed", stats.Snoozed,
+			"avg_run", stats.TotalRun/time.Duration(max(stats.worked(), 1)),
+			"max_run", stats.MaxRun,
+			"max_wait", stats.MaxWait,
+		)
+	}
+
+	for host, statuses := range s.Deliveries {
+		total, failed := s.deliveries(host)
+
+		attrs := make([]any, 0, len(statuses))
+		for _, status := range sortedKeys(statuses) {
+			attrs = append(attrs, slog.Int(status, statuses[status]))
+		}
+
+		slog.InfoContext(ctx, "activities delivered",
+			"host", host,
+			"total", total,
+			"failed", failed,
+			slog.Group("status", attrs...),
+		)
+	}
+}
+
+// run records events until ctx is done, flushing the counts to report every
+// interval and once more when it stops.
+func (m *metrics) run(ctx context.Context, events <-chan *river.Event, interval time.Duration, report func(context.Context, metricsSnapshot)) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case event := <-events:
+			m.recordJob(event)
+		case <-ticker.C:
+			report(ctx, m.flush())
+		case <-ctx.Done():
+			report(context.Background(), m.flush()) //nolint:contextcheck
+
+			return
+		}
+	}
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+
+	slices.Sort(keys)
+
+	return keys
+}
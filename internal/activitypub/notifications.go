@@ -0,0 +1,152 @@
+package activitypub
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/jclem/jclem.me/internal/database"
+)
+
+// A NotificationType is what a notification tells a user about.
+type NotificationType = string
+
+const (
+	// NotificationFollow is a remote actor following the user.
+	NotificationFollow NotificationType = "follow"
+
+	// NotificationMention is a remote actor's note addressed to, or
+	// mentioning, the user.
+	NotificationMention NotificationType = "mention"
+
+	// NotificationReply is a remote actor's reply to one of the user's notes.
+	NotificationReply NotificationType = "reply"
+
+	// NotificationLike is a remote actor liking one of the user's notes.
+	NotificationLike NotificationType = "like"
+
+	// NotificationBoost is a remote actor announcing one of the user's notes.
+	NotificationBoost NotificationType = "boost"
+)
+
+const notificationsTable = "notifications"
+const notificationsRecordIDColumn = "id"
+const notificationsUserIDColumn = "user_id"
+const notificationsTypeColumn = "notification_type"
+const notificationsActorIDColumn = "actor_id"
+const notificationsActivityIDColumn = "activity_id"
+const notificationsObjectIDColumn = "object_id"
+const notificationsReadAtColumn = "read_at"
+const notificationsCreatedAtColumn = "created_at"
+
+var notificationsFields = []string{ //nolint:gochecknoglobals
+	notificationsRecordIDColumn,
+	notificationsUserIDColumn,
+	notificationsTypeColumn,
+	notificationsActorIDColumn,
+	notificationsActivityIDColumn,
+	notificationsObjectIDColumn,
+	notificationsReadAtColumn,
+	notificationsCreatedAtColumn}
+
+// A NotificationRecord is a database record of a notification derived from an
+// activity received in a user's inbox.
+type NotificationRecord struct {
+	RecordID database.ULID    `json:"id"`
+	UserID   database.ULID    `json:"user_id"`
+	Type     NotificationType `json:"type"`
+
+	// ActorID is the remote actor who sent the activity, and ActivityID is
+	// its ID.
+	ActorID    string `json:"actor_id"`
+	ActivityID string `json:"activity_id"`
+
+	// ObjectID is the note the notification is about: the user's note which
+	// was replied to, liked, or boosted, or the note which mentions the user.
+	// It is empty for follows.
+	ObjectID string `json:"object_id,omitempty"`
+
+	// ReadAt is when the user marked the notification read, or nil if it is
+	// unread.
+	ReadAt    *time.Time `json:"read_at"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+func (n *NotificationRecord) scannableFields() []any {
+	return []any{
+		&n.RecordID,
+		&n.UserID,
+		&n.Type,
+		&n.ActorID,
+		&n.ActivityID,
+		&n.ObjectID,
+		&n.ReadAt,
+		&n.CreatedAt,
+	}
+}
+
+// notify records a notification of an inbox activity in tx.
+func (s *Service) notify(ctx context.Context, tx Tx, userRecordID database.ULID, typ NotificationType, ar ActivityRecord, actorID, objectID string) error {
+	if err := tx.InsertNotification(ctx, NotificationRecord{
+		RecordID:   database.NewULID(),
+		UserID:     userRecordID,
+		Type:       typ,
+		ActorID:    actorID,
+		ActivityID: ar.ID,
+		ObjectID:   objectID,
+		CreatedAt:  time.Now().UTC(),
+	}); err != nil {
+		return fmt.Errorf("failed to insert notification: %w", err)
+	}
+
+	return nil
+}
+
+// handleInboxReaction notifies the user of a Like or Announce of one of their
+// notes. Those of other objects are ignored.
+func (s *Service) handleInboxReaction(ctx context.Context, tx Tx, userRecordID database.ULID, ar ActivityRecord) error {
+	var ao Activity[json.RawMessage]
+	if err := json.Unmarshal(ar.Data, &ao); err != nil {
+		slog.InfoContext(ctx, "ignoring activity with unexpected data", "activity_id", ar.ID, "error", err)
+		return nil
+	}
+
+	// The object is the note's ID, or the note itself.
+	objectID := referencedID(ao.Object)
+	if objectID == "" {
+		slog.InfoContext(ctx, "ignoring activity with unexpected object", "activity_id", ar.ID)
+		return nil
+	}
+
+	isNote, err := tx.HasNote(ctx, userRecordID, objectID)
+	if err != nil {
+		return err //nolint:wrapcheck
+	}
+
+	if !isNote {
+		return nil
+	}
+
+	typ := NotificationLike
+	if ar.Type == announceActivityType {
+		typ = NotificationBoost
+	}
+
+	return s.notify(ctx, tx, userRecordID, typ, ar, ao.Actor, objectID)
+}
+
+// ListNotifications lists a page of a user's notifications, most recent first,
+// and returns how many there are in all. If unread is true, only unread
+// notifications are listed and counted. If limit is zero, every notification
+// is listed.
+func (s *Service) ListNotifications(ctx context.Context, userRecordID database.ULID, unread bool, limit, offset int) ([]NotificationRecord, int, error) {
+	return s.store.ListNotifications(ctx, userRecordID, unread, limit, offset) //nolint:wrapcheck
+}
+
+// MarkNotificationsRead marks a user's unread notifications with the given IDs
+// read, or, if there are none, all of them, and returns how many were marked.
+func (s *Service) MarkNotificationsRead(ctx context.Context, userRecordID database.ULID, ids []database.ULID) (int, error) {
+	return s.store.MarkNotificationsRead(ctx, userRecordID, ids, time.Now().UTC()) //nolint:wrapcheck
+}
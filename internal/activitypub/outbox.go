@@ -0,0 +1,113 @@
+package activitypub
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/jclem/jclem.me/internal/database"
+	"github.com/jclem/jclem.me/internal/telemetry"
+)
+
+// undoableActivities are the types of the user's activities which they may
+// undo.
+var undoableActivities = []string{announceActivityType, likeActivityType, followActivityType} //nolint:gochecknoglobals
+
+// validateOutboxActivity checks an Announce, Like, Follow, or Undo which the
+// user sends. Announces and Likes must refer to an object, and Follows to
+// another actor, by their IDs, and Undos must undo one of the user's own
+// Announces, Likes, or Follows.
+func validateOutboxActivity(ctx context.Context, tx Tx, userRecordID database.ULID, ar ActivityRecord) (Activity[json.RawMessage], error) {
+	var ao Activity[json.RawMessage]
+	if err := json.Unmarshal(ar.Data, &ao); err != nil {
+		return ao, fmt.Errorf("failed to unmarshal activity data: %w", err)
+	}
+
+	if ao.Actor == "" {
+		return ao, fmt.Errorf("%s has no actor", ar.Type)
+	}
+
+	if len(ao.To) == 0 && len(ao.Cc) == 0 {
+		return ao, fmt.Errorf("%s is not addressed to anyone", ar.Type)
+	}
+
+	objectID := referencedID(ao.Object)
+	if objectID == "" {
+		return ao, fmt.Errorf("%s has no object", ar.Type)
+	}
+
+	switch ar.Type {
+	case followActivityType:
+		if objectID == ao.Actor {
+			return ao, errors.New("actors may not follow themselves")
+		}
+	case undoActivityType:
+		undone, err := tx.GetActivity(ctx, userRecordID, objectID)
+		if err != nil {
+			return ao, fmt.Errorf("failed to get undone activity: %w", err)
+		}
+
+		if undone.Mailbox != Outbox || !slices.Contains(undoableActivities, undone.Type) {
+			return ao, fmt.Errorf("activity may not be undone: %s", undone.Type)
+		}
+
+		var undoneActivity Activity[json.RawMessage]
+		if err := json.Unmarshal(undone.Data, &undoneActivity); err != nil {
+			return ao, fmt.Errorf("failed to unmarshal undone activity: %w", err)
+		}
+
+		if undoneActivity.Actor != ao.Actor {
+			return ao, fmt.Errorf("actor and undone actor are not the same: %s != %s", ao.Actor, undoneActivity.Actor)
+		}
+	}
+
+	return ao, nil
+}
+
+// addressees returns the actors an activity is delivered to: each it is
+// addressed to, and, if it is addressed to the public or to the actor's
+// followers, each of the user's followers.
+func addressees(ctx context.Context, tx Tx, userRecordID database.ULID, ao Activity[json.RawMessage]) ([]string, error) {
+	var (
+		recipients  []string
+		toFollowers bool
+	)
+
+	for _, id := range append(slices.Clone(ao.To), ao.Cc...) {
+		switch id {
+		case PublicNS, ao.Actor + "/followers":
+			toFollowers = true
+		case ao.Actor:
+		default:
+			recipients = append(recipients, id)
+		}
+	}
+
+	if toFollowers {
+		followers, err := tx.ListFollowers(ctx, userRecordID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list followers: %w", err)
+		}
+
+		for _, follower := range followers {
+			recipients = append(recipients, follower.ActorID)
+		}
+	}
+
+	slices.Sort(recipients)
+
+	return slices.Compact(recipients), nil
+}
+
+// enqueueDeliveries enqueues delivery of an activity to each recipient.
+func enqueueDeliveries(ctx context.Context, tx Tx, userRecordID database.ULID, ar ActivityRecord, recipients []string) error {
+	for _, recipient := range recipients {
+		if err := tx.Enqueue(ctx, HandleOutboxArgs{ActivityID: ar.ID, FollowerID: recipient, UserRecordID: userRecordID, Trace: telemetry.Inject(ctx)}, nil); err != nil {
+			return fmt.Errorf("failed to insert outbox job: %w", err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,729 @@
+package activitypub
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/Masterminds/squirrel"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/jclem/jclem.me/internal/database"
+	"github.com/riverqueue/river"
+)
+
+// A PostgresStore keeps activities in Postgres, and enqueues jobs with River
+// in the same database.
+type PostgresStore struct {
+	pool  *pgxpool.Pool
+	sql   squirrel.StatementBuilderType
+	river *river.Client[pgx.Tx]
+}
+
+var _ Store = (*PostgresStore)(nil)
+
+// newPostgresStore creates a new PostgresStore which enqueues jobs with the
+// given client.
+func newPostgresStore(pool *pgxpool.Pool, client *river.Client[pgx.Tx]) *PostgresStore {
+	return &PostgresStore{
+		pool:  pool,
+		sql:   squirrel.StatementBuilder.PlaceholderFormat(squirrel.Dollar),
+		river: client,
+	}
+}
+
+// Tx implements the Store interface.
+func (s *PostgresStore) Tx(ctx context.Context, fn func(Tx) error) error {
+	return database.WithTx(ctx, s.pool, func(tx pgx.Tx) error { //nolint:wrapcheck
+		return fn(&postgresTx{s: s, tx: tx})
+	})
+}
+
+// Enqueue implements the Store interface.
+func (s *PostgresStore) Enqueue(ctx context.Context, args river.JobArgs, opts *river.InsertOpts) error {
+	if _, err := s.river.Insert(ctx, args, opts); err != nil {
+		return fmt.Errorf("failed to insert %s job: %w", args.Kind(), err)
+	}
+
+	return nil
+}
+
+// CheckJobs implements the Store interface.
+func (s *PostgresStore) CheckJobs(ctx context.Context) error {
+	query, args, err := s.sql.Select("1").From("river_job").Limit(1).ToSql()
+	if err != nil {
+		return fmt.Errorf("failed to build query: %w", err)
+	}
+
+	if _, err := s.pool.Exec(ctx, query, args...); err != nil {
+		return fmt.Errorf("failed to query jobs: %w", err)
+	}
+
+	return nil
+}
+
+// GetActivity implements the Store interface.
+func (s *PostgresStore) GetActivity(ctx context.Context, userID database.ULID, id string, deleted bool) (ActivityRecord, error) {
+	return getActivity(ctx, s.pool, s.sql, userID, id, deleted)
+}
+
+func getActivity(ctx context.Context, db querier, sql squirrel.StatementBuilderType, userID database.ULID, id string, deleted bool) (ActivityRecord, error) {
+	q := sql.
+		Select(activitiesFields...).
+		From(activitiesTable).
+		Where(squirrel.Eq{activitiesUserIDColumn: userID}).
+		Where(squirrel.Eq{activitiesIDColumn: id})
+
+	if !deleted {
+		q = q.Where(squirrel.Eq{activitiesDeletedAtColumn: nil})
+	}
+
+	query, args, err := q.ToSql()
+	if err != nil {
+		return ActivityRecord{}, fmt.Errorf("failed to build query: %w", err)
+	}
+
+	var a ActivityRecord
+	if err := db.QueryRow(ctx, query, args...).Scan(a.scannableFields()...); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return ActivityRecord{}, ErrActivityNotFound
+		}
+
+		return ActivityRecord{}, fmt.Errorf("failed to get activity by ID: %w", err)
+	}
+
+	return a, nil
+}
+
+// ListPublicActivities implements the Store interface.
+func (s *PostgresStore) ListPublicActivities(ctx context.Context, userID database.ULID, mailbox Mailbox, typ string, limit, offset int) ([]ActivityRecord, int, error) {
+	// The containment predicate is served by the activities_public_idx index.
+	where := squirrel.And{
+		squirrel.Eq{activitiesUserIDColumn: userID},
+		squirrel.Eq{activitiesMailboxColumn: mailbox},
+		squirrel.Eq{activitiesTypeColumn: typ},
+		squirrel.Eq{activitiesDeletedAtColumn: nil},
+		squirrel.Expr(activitiesDataColumn+" @> ?::jsonb", publicAddressing),
+	}
+
+	countQuery, countArgs, err := s.sql.Select("count(*)").From(activitiesTable).Where(where).ToSql()
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to build query: %w", err)
+	}
+
+	var total int
+	if err := s.pool.QueryRow(ctx, countQuery, countArgs...).Scan(&total); err != nil {
+		return nil, 0, fmt.Errorf("failed to count activities: %w", err)
+	}
+
+	q := s.sql.
+		Select(activitiesFields...).
+		From(activitiesTable).
+		Where(where).
+		OrderBy(activitiesCreatedAtColumn+" DESC", activitiesRecordIDColumn+" DESC")
+
+	if limit > 0 {
+		q = q.Limit(uint64(limit)).Offset(uint64(offset))
+	}
+
+	query, args, err := q.ToSql()
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to build query: %w", err)
+	}
+
+	rows, err := s.pool.Query(ctx, query, args...)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to query activities: %w", err)
+	}
+
+	defer rows.Close()
+
+	var activities []ActivityRecord
+
+	for rows.Next() {
+		var a ActivityRecord
+		if err := rows.Scan(a.scannableFields()...); err != nil {
+			return nil, 0, fmt.Errorf("failed to scan activity: %w", err)
+		}
+
+		activities = append(activities, a)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, 0, fmt.Errorf("failed to iterate activities: %w", err)
+	}
+
+	return activities, total, nil
+}
+
+// publicAddressing matches an activity addressed to the public.
+const publicAddressing = `{"to": ["` + PublicNS + `"]}`
+
+// GetNote implements the Store interface.
+func (s *PostgresStore) GetNote(ctx context.Context, userID database.ULID, id database.ULID, deleted bool) (NoteRecord, error) {
+	return s.getNote(ctx, squirrel.Eq{notesUserIDColumn: userID, notesRecordIDColumn: id}, deleted)
+}
+
+// GetNoteByObjectID implements the Store interface.
+func (s *PostgresStore) GetNoteByObjectID(ctx context.Context, userID database.ULID, objectID string, deleted bool) (NoteRecord, error) {
+	return s.getNote(ctx, squirrel.Eq{notesUserIDColumn: userID, notesObjectIDColumn: objectID}, deleted)
+}
+
+func (s *PostgresStore) getNote(ctx context.Context, where squirrel.Eq, deleted bool) (NoteRecord, error) {
+	q := s.sql.
+		Select(notesFields...).
+		From(notesTable).
+		Where(where)
+
+	if !deleted {
+		q = q.Where(squirrel.Eq{notesDeletedAtColumn: nil})
+	}
+
+	query, args, err := q.ToSql()
+	if err != nil {
+		return NoteRecord{}, fmt.Errorf("failed to build query: %w", err)
+	}
+
+	var n NoteRecord
+	if err := s.pool.QueryRow(ctx, query, args...).Scan(n.scannableFields()...); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return NoteRecord{}, ErrNoteNotFound
+		}
+
+		return NoteRecord{}, fmt.Errorf("failed to get note: %w", err)
+	}
+
+	return n, nil
+}
+
+// ListNotes implements the Store interface.
+func (s *PostgresStore) ListNotes(ctx context.Context, userID database.ULID, public bool, limit int) ([]NoteRecord, error) {
+	q := s.sql.
+		Select(notesFields...).
+		From(notesTable).
+		Where(squirrel.Eq{notesUserIDColumn: userID}).
+		Where(squirrel.Eq{notesDeletedAtColumn: nil}).
+		OrderBy(notesPublishedColumn + " DESC")
+
+	if public {
+		q = q.Where(squirrel.Or{
+			squirrel.Expr("? = ANY("+notesToColumn+")", PublicNS),
+			squirrel.Expr("? = ANY("+notesCcColumn+")", PublicNS),
+		})
+	}
+
+	if limit > 0 {
+		q = q.Limit(uint64(limit))
+	}
+
+	query, args, err := q.ToSql()
+	if err != nil {
+		return nil, fmt.Errorf("failed to build query: %w", err)
+	}
+
+	rows, err := s.pool.Query(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query notes: %w", err)
+	}
+
+	defer rows.Close()
+
+	var notes []NoteRecord
+
+	for rows.Next() {
+		var n NoteRecord
+		if err := rows.Scan(n.scannableFields()...); err != nil {
+			return nil, fmt.Errorf("failed to scan note: %w", err)
+		}
+
+		notes = append(notes, n)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate notes: %w", err)
+	}
+
+	return notes, nil
+}
+
+// ListFollowers implements the Store interface.
+func (s *PostgresStore) ListFollowers(ctx context.Context, userID database.ULID) ([]FollowerRecord, error) {
+	return listFollowers(ctx, s.pool, s.sql, userID)
+}
+
+// querier is satisfied by both pools and transactions.
+type querier interface {
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+}
+
+func listFollowers(ctx context.Context, db querier, sql squirrel.StatementBuilderType, userID database.ULID) ([]FollowerRecord, error) {
+	query, args, err := sql.
+		Select(followersFields...).
+		From(followersTable).
+		Where(squirrel.Eq{followersUserIDColumn: userID}).
+		ToSql()
+	if err != nil {
+		return nil, fmt.Errorf("failed to build query: %w", err)
+	}
+
+	rows, err := db.Query(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query followers: %w", err)
+	}
+
+	defer rows.Close()
+
+	var followers []FollowerRecord
+
+	for rows.Next() {
+		var f FollowerRecord
+		if err := rows.Scan(f.scannableFields()...); err != nil {
+			return nil, fmt.Errorf("failed to scan follower: %w", err)
+		}
+
+		followers = append(followers, f)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate followers: %w", err)
+	}
+
+	return followers, nil
+}
+
+// ListFollowing implements the Store interface.
+func (s *PostgresStore) ListFollowing(ctx context.Context, userID database.ULID) ([]string, error) {
+	rows, err := s.pool.Query(ctx, followingSQL, userID, Outbox)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query following: %w", err)
+	}
+
+	following, err := pgx.CollectRows(rows, pgx.RowTo[string])
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan following: %w", err)
+	}
+
+	return following, nil
+}
+
+// followingSQL selects the objects of a user's Follows which were not undone.
+const followingSQL = `SELECT DISTINCT a.` + activitiesDataColumn + `->>'object'
+FROM ` + activitiesTable + ` a
+WHERE a.` + activitiesUserIDColumn + ` = $1
+	AND a.` + activitiesMailboxColumn + ` = $2
+	AND a.` + activitiesTypeColumn + ` = '` + followActivityType + `'
+	AND a.` + activitiesDeletedAtColumn + ` IS NULL
+	AND NOT EXISTS (
+		SELECT 1 FROM ` + activitiesTable + ` u
+		WHERE u.` + activitiesUserIDColumn + ` = a.` + activitiesUserIDColumn + `
+			AND u.` + activitiesMailboxColumn + ` = $2
+			AND u.` + activitiesTypeColumn + ` = '` + undoActivityType + `'
+			AND ` + undoneIDSQL + ` = a.` + activitiesIDColumn + `
+	)
+ORDER BY 1`
+
+// ListUnapplied implements the Store interface.
+func (s *PostgresStore) ListUnapplied(ctx context.Context, from, to time.Time) ([]HandleInboxArgs, error) {
+	var unapplied []HandleInboxArgs
+
+	for _, query := range []string{unfollowedFollowsSQL, unappliedUndosSQL} {
+		rows, err := s.pool.Query(ctx, query, Inbox, from, to)
+		if err != nil {
+			return nil, fmt.Errorf("failed to query activities: %w", err)
+		}
+
+		for rows.Next() {
+			var args HandleInboxArgs
+			if err := rows.Scan(&args.UserRecordID, &args.ActivityID); err != nil {
+				rows.Close()
+				return nil, fmt.Errorf("failed to scan activity: %w", err)
+			}
+
+			unapplied = append(unapplied, args)
+		}
+
+		rows.Close()
+
+		if err := rows.Err(); err != nil {
+			return nil, fmt.Errorf("failed to iterate activities: %w", err)
+		}
+	}
+
+	return unapplied, nil
+}
+
+// undoneIDSQL is the ID of the activity which an Undo, u, undoes, whose object
+// may be the activity itself or only its ID.
+const undoneIDSQL = `COALESCE(u.` + activitiesDataColumn + `->'object'->>'id', u.` + activitiesDataColumn + `->>'object')`
+
+// unfollowedFollowsSQL selects follows whose actor is not a follower, and which
+// were not undone.
+const unfollowedFollowsSQL = `SELECT a.` + activitiesUserIDColumn + `, a.` + activitiesIDColumn + `
+FROM ` + activitiesTable + ` a
+WHERE a.` + activitiesMailboxColumn + ` = $1
+	AND a.` + activitiesTypeColumn + ` = '` + followActivityType + `'
+	AND a.` + activitiesDeletedAtColumn + ` IS NULL
+	AND a.` + activitiesCreatedAtColumn + ` BETWEEN $2 AND $3
+	AND NOT EXISTS (
+		SELECT 1 FROM ` + followersTable + ` f
+		WHERE f.` + followersUserIDColumn + ` = a.` + activitiesUserIDColumn + `
+			AND f.` + followersActorIDColumn + ` = a.` + activitiesDataColumn + `->>'actor'
+	)
+	AND NOT EXISTS (
+		SELECT 1 FROM ` + activitiesTable + ` u
+		WHERE u.` + activitiesUserIDColumn + ` = a.` + activitiesUserIDColumn + `
+			AND u.` + activitiesMailboxColumn + ` = $1
+			AND u.` + activitiesTypeColumn + ` = '` + undoActivityType + `'
+			AND ` + undoneIDSQL + ` = a.` + activitiesIDColumn + `
+	)`
+
+// unappliedUndosSQL selects undone follows whose follower remains.
+const unappliedUndosSQL = `SELECT u.` + activitiesUserIDColumn + `, u.` + activitiesIDColumn + `
+FROM ` + activitiesTable + ` u
+JOIN ` + followersTable + ` f
+	ON f.` + followersUserIDColumn + ` = u.` + activitiesUserIDColumn + `
+	AND f.` + followersActivityIDColumn + ` = ` + undoneIDSQL + `
+WHERE u.` + activitiesMailboxColumn + ` = $1
+	AND u.` + activitiesTypeColumn + ` = '` + undoActivityType + `'
+	AND u.` + activitiesDeletedAtColumn + ` IS NULL
+	AND u.` + activitiesCreatedAtColumn + ` BETWEEN $2 AND $3`
+
+// ListNotifications implements the Store interface.
+func (s *PostgresStore) ListNotifications(ctx context.Context, userID database.ULID, unread bool, limit, offset int) ([]NotificationRecord, int, error) {
+	where := squirrel.And{squirrel.Eq{notificationsUserIDColumn: userID}}
+	if unread {
+		where = append(where, squirrel.Eq{notificationsReadAtColumn: nil})
+	}
+
+	countQuery, countArgs, err := s.sql.Select("count(*)").From(notificationsTable).Where(where).ToSql()
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to build query: %w", err)
+	}
+
+	var total int
+	if err := s.pool.QueryRow(ctx, countQuery, countArgs...).Scan(&total); err != nil {
+		return nil, 0, fmt.Errorf("failed to count notifications: %w", err)
+	}
+
+	q := s.sql.
+		Select(notificationsFields...).
+		From(notificationsTable).
+		Where(where).
+		OrderBy(notificationsRecordIDColumn + " DESC")
+
+	if limit > 0 {
+		q = q.Limit(uint64(limit)).Offset(uint64(offset))
+	}
+
+	query, args, err := q.ToSql()
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to build query: %w", err)
+	}
+
+	rows, err := s.pool.Query(ctx, query, args...)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to query notifications: %w", err)
+	}
+
+	defer rows.Close()
+
+	var notifications []NotificationRecord
+
+	for rows.Next() {
+		var n NotificationRecord
+		if err := rows.Scan(n.scannableFields()...); err != nil {
+			return nil, 0, fmt.Errorf("failed to scan notification: %w", err)
+		}
+
+		notifications = append(notifications, n)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, 0, fmt.Errorf("failed to iterate notifications: %w", err)
+	}
+
+	return notifications, total, nil
+}
+
+// MarkNotificationsRead implements the Store interface.
+func (s *PostgresStore) MarkNotificationsRead(ctx context.Context, userID database.ULID, ids []database.ULID, at time.Time) (int, error) {
+	q := s.sql.
+		Update(notificationsTable).
+		Set(notificationsReadAtColumn, at).
+		Where(squirrel.Eq{notificationsUserIDColumn: userID}).
+		Where(squirrel.Eq{notificationsReadAtColumn: nil})
+
+	if len(ids) > 0 {
+		q = q.Where(squirrel.Eq{notificationsRecordIDColumn: ids})
+	}
+
+	query, args, err := q.ToSql()
+	if err != nil {
+		return 0, fmt.Errorf("failed to build query: %w", err)
+	}
+
+	tag, err := s.pool.Exec(ctx, query, args...)
+	if err != nil {
+		return 0, fmt.Errorf("failed to mark notifications read: %w", err)
+	}
+
+	return int(tag.RowsAffected()), nil
+}
+
+// PurgeDeleted implements the Store interface.
+func (s *PostgresStore) PurgeDeleted(ctx context.Context, before time.Time) (notes, activities int64, err error) {
+	err = database.WithTx(ctx, s.pool, func(tx pgx.Tx) error {
+		query, args, err := s.sql.
+			Delete(notesTable).
+			Where(squirrel.Lt{notesDeletedAtColumn: before}).
+			ToSql()
+		if err != nil {
+			return fmt.Errorf("failed to build query: %w", err)
+		}
+
+		tag, err := tx.Exec(ctx, query, args...)
+		if err != nil {
+			return fmt.Errorf("failed to purge notes: %w", err)
+		}
+
+		notes = tag.RowsAffected()
+
+		query, args, err = s.sql.
+			Delete(activitiesTable).
+			Where(squirrel.Lt{activitiesDeletedAtColumn: before}).
+			ToSql()
+		if err != nil {
+			return fmt.Errorf("failed to build query: %w", err)
+		}
+
+		tag, err = tx.Exec(ctx, query, args...)
+		if err != nil {
+			return fmt.Errorf("failed to purge activities: %w", err)
+		}
+
+		activities = tag.RowsAffected()
+
+		return nil
+	})
+	if err != nil {
+		return 0, 0, err //nolint:wrapcheck
+	}
+
+	return notes, activities, nil
+}
+
+// A postgresTx changes a PostgresStore within a transaction.
+type postgresTx struct {
+	s  *PostgresStore
+	tx pgx.Tx
+}
+
+// InsertActivity implements the Tx interface.
+func (t *postgresTx) InsertActivity(ctx context.Context, a ActivityRecord) (ActivityRecord, error) {
+	query, args, err := t.s.sql.
+		Insert(activitiesTable).
+		Columns(activitiesFieldsWritable...).
+		Values(a.RecordID, a.UserID, a.Mailbox, a.Context, a.Type, a.ID, a.Data, a.CreatedAt, a.UpdatedAt).
+		Suffix("RETURNING " + strings.Join(activitiesFields, ", ")).
+		ToSql()
+	if err != nil {
+		return ActivityRecord{}, fmt.Errorf("failed to build query: %w", err)
+	}
+
+	if err := t.tx.QueryRow(ctx, query, args...).Scan(a.scannableFields()...); err != nil {
+		return ActivityRecord{}, fmt.Errorf("failed to insert activity: %w", err)
+	}
+
+	return a, nil
+}
+
+// InsertNote implements the Tx interface.
+func (t *postgresTx) InsertNote(ctx context.Context, n NoteRecord) (NoteRecord, error) {
+	query, args, err := t.s.sql.
+		Insert(notesTable).
+		Columns(notesFieldsWritable...).
+		Values(n.RecordID, n.UserID, n.ActivityID, n.ObjectID, n.Content, n.Published, n.To, n.Cc, n.CreatedAt, n.UpdatedAt).
+		Suffix("RETURNING " + strings.Join(notesFields, ", ")).
+		ToSql()
+	if err != nil {
+		return NoteRecord{}, fmt.Errorf("failed to build query: %w", err)
+	}
+
+	if err := t.tx.QueryRow(ctx, query, args...).Scan(n.scannableFields()...); err != nil {
+		return NoteRecord{}, fmt.Errorf("failed to insert note: %w", err)
+	}
+
+	return n, nil
+}
+
+// UpdateNote implements the Tx interface.
+func (t *postgresTx) UpdateNote(ctx context.Context, userID database.ULID, objectID, content string, at time.Time) error {
+	query, args, err := t.s.sql.
+		Update(notesTable).
+		Set(notesContentColumn, content).
+		Set(notesUpdatedAtColumn, at).
+		Where(squirrel.Eq{notesUserIDColumn: userID}).
+		Where(squirrel.Eq{notesObjectIDColumn: objectID}).
+		Where(squirrel.Eq{notesDeletedAtColumn: nil}).
+		ToSql()
+	if err != nil {
+		return fmt.Errorf("failed to build query: %w", err)
+	}
+
+	tag, err := t.tx.Exec(ctx, query, args...)
+	if err != nil {
+		return fmt.Errorf("failed to update note: %w", err)
+	}
+
+	if tag.RowsAffected() == 0 {
+		return ErrNoteNotFound
+	}
+
+	return nil
+}
+
+// DeleteNote implements the Tx interface.
+func (t *postgresTx) DeleteNote(ctx context.Context, userID database.ULID, objectID string, at time.Time) error {
+	query, args, err := t.s.sql.
+		Update(notesTable).
+		Set(notesDeletedAtColumn, at).
+		Where(squirrel.Eq{notesUserIDColumn: userID}).
+		Where(squirrel.Eq{notesObjectIDColumn: objectID}).
+		Where(squirrel.Eq{notesDeletedAtColumn: nil}).
+		Suffix("RETURNING " + notesActivityIDColumn).
+		ToSql()
+	if err != nil {
+		return fmt.Errorf("failed to build query: %w", err)
+	}
+
+	var activityID string
+	if err := t.tx.QueryRow(ctx, query, args...).Scan(&activityID); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return ErrNoteNotFound
+		}
+
+		return fmt.Errorf("failed to delete note: %w", err)
+	}
+
+	query, args, err = t.s.sql.
+		Update(activitiesTable).
+		Set(activitiesDeletedAtColumn, at).
+		Where(squirrel.Eq{activitiesUserIDColumn: userID}).
+		Where(squirrel.Eq{activitiesIDColumn: activityID}).
+		Where(squirrel.Eq{activitiesDeletedAtColumn: nil}).
+		ToSql()
+	if err != nil {
+		return fmt.Errorf("failed to build query: %w", err)
+	}
+
+	if _, err := t.tx.Exec(ctx, query, args...); err != nil {
+		return fmt.Errorf("failed to delete note activity: %w", err)
+	}
+
+	return nil
+}
+
+// HasNote implements the Tx interface.
+func (t *postgresTx) HasNote(ctx context.Context, userID database.ULID, objectID string) (bool, error) {
+	query, args, err := t.s.sql.
+		Select("1").
+		From(notesTable).
+		Where(squirrel.Eq{notesUserIDColumn: userID}).
+		Where(squirrel.Eq{notesObjectIDColumn: objectID}).
+		Where(squirrel.Eq{notesDeletedAtColumn: nil}).
+		Prefix("SELECT EXISTS (").
+		Suffix(")").
+		ToSql()
+	if err != nil {
+		return false, fmt.Errorf("failed to build query: %w", err)
+	}
+
+	var exists bool
+	if err := t.tx.QueryRow(ctx, query, args...).Scan(&exists); err != nil {
+		return false, fmt.Errorf("failed to query note: %w", err)
+	}
+
+	return exists, nil
+}
+
+// CreateFollower implements the Tx interface.
+func (t *postgresTx) CreateFollower(ctx context.Context, f FollowerRecord) (FollowerRecord, error) {
+	query, args, err := t.s.sql.
+		Insert(followersTable).
+		Columns(followersFieldsWritable...).
+		Values(f.UserID, f.ActorID, f.ActivityID, f.CreatedAt, f.UpdatedAt).
+		Suffix("ON CONFLICT (" + followersUserIDColumn + ", " + followersActorIDColumn + ") DO UPDATE SET " +
+			followersActivityIDColumn + " = EXCLUDED." + followersActivityIDColumn + ", " +
+			followersUpdatedAtColumn + " = EXCLUDED." + followersUpdatedAtColumn).
+		Suffix("RETURNING " + strings.Join(followersFields, ", ")).
+		ToSql()
+	if err != nil {
+		return FollowerRecord{}, fmt.Errorf("failed to build query: %w", err)
+	}
+
+	if err := t.tx.QueryRow(ctx, query, args...).Scan(f.scannableFields()...); err != nil {
+		return FollowerRecord{}, fmt.Errorf("failed to upsert follower: %w", err)
+	}
+
+	return f, nil
+}
+
+// DeleteFollower implements the Tx interface.
+func (t *postgresTx) DeleteFollower(ctx context.Context, userID database.ULID, actorID string) (bool, error) {
+	query, args, err := t.s.sql.
+		Delete(followersTable).
+		Where(squirrel.Eq{followersUserIDColumn: userID}).
+		Where(squirrel.Eq{followersActorIDColumn: actorID}).
+		ToSql()
+	if err != nil {
+		return false, fmt.Errorf("failed to build query: %w", err)
+	}
+
+	tag, err := t.tx.Exec(ctx, query, args...)
+	if err != nil {
+		return false, fmt.Errorf("failed to delete follower: %w", err)
+	}
+
+	return tag.RowsAffected() > 0, nil
+}
+
+// GetActivity implements the Tx interface.
+func (t *postgresTx) GetActivity(ctx context.Context, userID database.ULID, id string) (ActivityRecord, error) {
+	return getActivity(ctx, t.tx, t.s.sql, userID, id, false)
+}
+
+// ListFollowers implements the Tx interface.
+func (t *postgresTx) ListFollowers(ctx context.Context, userID database.ULID) ([]FollowerRecord, error) {
+	return listFollowers(ctx, t.tx, t.s.sql, userID)
+}
+
+// InsertNotification implements the Tx interface.
+func (t *postgresTx) InsertNotification(ctx context.Context, n NotificationRecord) error {
+	query, args, err := t.s.sql.
+		Insert(notificationsTable).
+		Columns(notificationsFields...).
+		Values(n.RecordID, n.UserID, n.Type, n.ActorID, n.ActivityID, n.ObjectID, n.ReadAt, n.CreatedAt).
+		Suffix("ON CONFLICT (" + notificationsUserIDColumn + ", " + notificationsActivityIDColumn + ") DO NOTHING").
+		ToSql()
+	if err != nil {
+		return fmt.Errorf("failed to build query: %w", err)
+	}
+
+	if _, err := t.tx.Exec(ctx, query, args...); err != nil {
+		return fmt.Errorf("failed to insert notification: %w", err)
+	}
+
+	return nil
+}
+
+// Enqueue implements the Tx interface.
+func (t *postgresTx) Enqueue(ctx context.Context, args river.JobArgs, opts *river.InsertOpts) error {
+	if _, err := t.s.river.InsertTx(ctx, t.tx, args, opts); err != nil {
+		return fmt.Errorf("failed to insert %s job: %w", args.Kind(), err)
+	}
+
+	return nil
+}
@@ -0,0 +1,65 @@
+package activitypub
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/jclem/jclem.me/internal/queues"
+	"github.com/jclem/jclem.me/internal/telemetry"
+	"github.com/riverqueue/river"
+)
+
+// purgeInterval is how often deleted notes and activities are purged.
+const purgeInterval = 24 * time.Hour
+
+// PurgeDeletedArgs are the arguments of a job which permanently deletes notes
+// and activities which were deleted longer ago than the retention window.
+type PurgeDeletedArgs struct{}
+
+// Kind implements the river.JobArgs interface.
+func (a PurgeDeletedArgs) Kind() string {
+	return "purge-deleted"
+}
+
+// InsertOpts implements the river.JobArgsWithInsertOpts interface.
+func (a PurgeDeletedArgs) InsertOpts() river.InsertOpts {
+	return river.InsertOpts{Queue: queues.Periodic}
+}
+
+func purgeDeletedPeriodicJob() *river.PeriodicJob {
+	return river.NewPeriodicJob(
+		river.PeriodicInterval(purgeInterval),
+		func() (river.JobArgs, *river.InsertOpts) {
+			return PurgeDeletedArgs{}, nil
+		},
+		&river.PeriodicJobOpts{RunOnStart: true},
+	)
+}
+
+// A PurgeDeletedWorker purges deleted notes and activities.
+type PurgeDeletedWorker struct {
+	river.WorkerDefaults[PurgeDeletedArgs]
+	pub       *Service
+	retention time.Duration
+}
+
+func newPurgeDeletedWorker(pub *Service, retention time.Duration) *PurgeDeletedWorker {
+	return &PurgeDeletedWorker{pub: pub, retention: retention}
+}
+
+// Work implements the river.Worker interface.
+func (w *PurgeDeletedWorker) Work(ctx context.Context, job *river.Job[PurgeDeletedArgs]) (err error) {
+	ctx, span := telemetry.StartJob(ctx, job.Kind, job.Attempt, nil)
+	defer func() { telemetry.End(span, err) }()
+
+	notes, activities, err := w.pub.PurgeDeleted(ctx, time.Now().UTC().Add(-w.retention))
+	if err != nil {
+		return fmt.Errorf("failed to purge deleted records: %w", err)
+	}
+
+	slog.InfoContext(ctx, "purged deleted records", "notes", notes, "activities", activities)
+
+	return nil
+}
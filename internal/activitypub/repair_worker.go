@@ -0,0 +1,104 @@
+package activitypub
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/jclem/jclem.me/internal/queues"
+	"github.com/jclem/jclem.me/internal/telemetry"
+	"github.com/riverqueue/river"
+)
+
+// repairInterval is how often federation state is checked for repair.
+const repairInterval = time.Hour
+
+// repairGrace is how long an activity is left to be handled by its own job
+// before it is repaired.
+const repairGrace = time.Hour
+
+// repairWindow is how far back activities are repaired. Activities older than
+// this whose effects are missing are assumed to have failed for good.
+const repairWindow = 7 * 24 * time.Hour
+
+// RepairArgs are the arguments of a job which checks that each inbox activity
+// has had its effect, and re-enqueues those which have not.
+type RepairArgs struct{}
+
+// Kind implements the river.JobArgs interface.
+func (a RepairArgs) Kind() string {
+	return "repair-federation"
+}
+
+// InsertOpts implements the river.JobArgsWithInsertOpts interface.
+func (a RepairArgs) InsertOpts() river.InsertOpts {
+	return river.InsertOpts{Queue: queues.Periodic}
+}
+
+func repairPeriodicJob() *river.PeriodicJob {
+	return river.NewPeriodicJob(
+		river.PeriodicInterval(repairInterval),
+		func() (river.JobArgs, *river.InsertOpts) {
+			return RepairArgs{}, nil
+		},
+		nil,
+	)
+}
+
+// A RepairWorker repairs federation state.
+type RepairWorker struct {
+	river.WorkerDefaults[RepairArgs]
+	pub *Service
+}
+
+func newRepairWorker(pub *Service) *RepairWorker {
+	return &RepairWorker{pub: pub}
+}
+
+// Work implements the river.Worker interface.
+func (w *RepairWorker) Work(ctx context.Context, job *river.Job[RepairArgs]) (err error) {
+	ctx, span := telemetry.StartJob(ctx, job.Kind, job.Attempt, nil)
+	defer func() { telemetry.End(span, err) }()
+
+	repaired, err := w.pub.Repair(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to repair federation state: %w", err)
+	}
+
+	if repaired > 0 {
+		slog.WarnContext(ctx, "repaired federation state", "activities", repaired)
+	}
+
+	return nil
+}
+
+// Repair re-enqueues the handling of inbox activities whose effects are
+// missing: follows by actors who are not followers, and undone follows by
+// actors who still are. It returns how many activities were re-enqueued.
+//
+// Handling an activity records its effect and enqueues its side effects in
+// one transaction, so this only finds activities whose job was lost, such as
+// activities handled before that was so.
+func (s *Service) Repair(ctx context.Context) (int, error) {
+	now := time.Now().UTC()
+
+	jobs, err := s.store.ListUnapplied(ctx, now.Add(-repairWindow), now.Add(-repairGrace))
+	if err != nil {
+		return 0, err //nolint:wrapcheck
+	}
+
+	for _, args := range jobs {
+		// A unique job is not inserted again while one is pending, so that a
+		// slow job is not repaired more than once.
+		opts := &river.InsertOpts{UniqueOpts: river.UniqueOpts{ByArgs: true}}
+
+		if err := s.store.Enqueue(ctx, args, opts); err != nil {
+			return 0, fmt.Errorf("failed to insert inbox job: %w", err)
+		}
+
+		slog.InfoContext(ctx, "repairing inbox activity", "user_id", args.UserRecordID, "activity_id", args.ActivityID)
+	}
+
+	return len(jobs), nil
+}
@@ -6,15 +6,20 @@ import (
 	"errors"
 	"fmt"
 	"log/slog"
+	"net/http"
 	"slices"
 	"strings"
+	"sync/atomic"
 	"time"
 
-	"github.com/Masterminds/squirrel"
 	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/jclem/jclem.me/internal/activitypub/identity"
 	"github.com/jclem/jclem.me/internal/database"
+	"github.com/jclem/jclem.me/internal/events"
+	"github.com/jclem/jclem.me/internal/queues"
+	"github.com/jclem/jclem.me/internal/telemetry"
+	"github.com/jclem/jclem.me/internal/webhooks"
 	"github.com/jclem/jclem.me/internal/www/config"
 	"github.com/riverqueue/river"
 	"github.com/riverqueue/river/riverdriver/riverpgxv5"
@@ -22,9 +27,32 @@ import (
 
 // A Service handles requests to read or modify ActivityPub data.
 type Service struct {
-	pool  *pgxpool.Pool
-	sql   squirrel.StatementBuilderType
+	store    Store
+	site     Site
+	webhooks webhooks.Config
+
+	// events publishes notifications of new notes, followers, and replies.
+	events *events.Broker
+
+	// river works jobs. It is nil if the Service was created with a Store
+	// which does not work them.
 	river *river.Client[pgx.Tx]
+
+	// runWorkers is true if this instance works jobs.
+	runWorkers bool
+
+	// running is true while the job client is started.
+	running atomic.Bool
+
+	// metrics counts jobs worked and activities delivered, and stopMetrics
+	// stops counting them once the job client has stopped.
+	metrics     *metrics
+	stopMetrics func()
+
+	// alerts configures when hosts are reported as failing, and failingHosts
+	// holds those which have been reported and not yet recovered.
+	alerts       alertConfig
+	failingHosts map[string]bool
 }
 
 // A Mailbox refers to a specific activity inbox or outbox.
@@ -39,31 +67,40 @@ const (
 )
 
 // CreateInboxActivity creates a new ActivityPub activity record.
-func (s *Service) CreateActivity(ctx context.Context, userRecordID database.ULID, mailbox Mailbox, context, typ, id string, data []byte) (ar ActivityRecord, err error) {
-	tx, err := s.pool.BeginTx(ctx, pgx.TxOptions{})
-	if err != nil {
-		return ActivityRecord{}, fmt.Errorf("failed to begin transaction: %w", err)
-	}
+func (s *Service) CreateActivity(ctx context.Context, userRecordID database.ULID, mailbox Mailbox, context, typ, id string, data []byte) (ActivityRecord, error) {
+	var (
+		ar    ActivityRecord
+		event *events.Event
+	)
 
-	defer func() {
-		if terr := endTransaction(ctx, tx, err); terr != nil {
-			err = terr
+	err := s.store.Tx(ctx, func(tx Tx) error {
+		var err error
+
+		ar, err = s.insertActivityRecord(ctx, tx, userRecordID, mailbox, context, typ, id, data)
+		if err != nil {
+			return fmt.Errorf("failed to create activity record: %w", err)
 		}
-	}()
 
-	ar, err = s.insertActivityRecord(ctx, tx, userRecordID, mailbox, context, typ, id, data)
+		if mailbox == Inbox {
+			if event, err = s.handleInbox(ctx, tx, userRecordID, ar); err != nil {
+				return fmt.Errorf("failed to handle inbox: %w", err)
+			}
+		} else {
+			if event, err = s.handleOutbox(ctx, tx, userRecordID, ar); err != nil {
+				return fmt.Errorf("failed to handle outbox: %w", err)
+			}
+		}
+
+		return nil
+	})
 	if err != nil {
-		return ActivityRecord{}, fmt.Errorf("failed to create activity record: %w", err)
+		return ActivityRecord{}, err //nolint:wrapcheck
 	}
 
-	if mailbox == Inbox {
-		if err := s.handleInbox(ctx, tx, userRecordID, ar); err != nil {
-			return ActivityRecord{}, fmt.Errorf("failed to handle inbox: %w", err)
-		}
-	} else {
-		if err := s.handleOutbox(ctx, tx, userRecordID, ar); err != nil {
-			return ActivityRecord{}, fmt.Errorf("failed to handle outbox: %w", err)
-		}
+	// The event is published once the activity is committed, so that its
+	// subscribers can see what it describes.
+	if event != nil {
+		s.publishEvent(ctx, *event)
 	}
 
 	return ar, nil
@@ -71,62 +108,239 @@ func (s *Service) CreateActivity(ctx context.Context, userRecordID database.ULID
 
 var acceptableActivities = []string{followActivityType, undoActivityType} //nolint:gochecknoglobals
 
-func (s *Service) handleInbox(ctx context.Context, tx pgx.Tx, userRecordID database.ULID, ar ActivityRecord) error {
+// handleInbox handles an activity received in the user's inbox, notifying the
+// user of it if it is meant for them, and returns an event to publish once it
+// is committed, if there is one.
+func (s *Service) handleInbox(ctx context.Context, tx Tx, userRecordID database.ULID, ar ActivityRecord) (*events.Event, error) {
+	switch ar.Type {
+	case createActivityType:
+		return s.handleInboxCreate(ctx, tx, userRecordID, ar)
+	case likeActivityType, announceActivityType:
+		return nil, s.handleInboxReaction(ctx, tx, userRecordID, ar)
+	}
+
 	if !slices.Contains(acceptableActivities, ar.Type) {
 		slog.InfoContext(ctx, "ignoring non-follow activity", "activity_id", ar, "activity_type", ar.Type)
-		return nil
+		return nil, nil //nolint:nilnil
+	}
+
+	if ar.Type == followActivityType {
+		var ao Activity[any]
+		if err := json.Unmarshal(ar.Data, &ao); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal activity data: %w", err)
+		}
+
+		if err := s.notify(ctx, tx, userRecordID, NotificationFollow, ar, ao.Actor, ""); err != nil {
+			return nil, err
+		}
 	}
 
-	if _, err := s.river.InsertTx(ctx, tx, HandleInboxArgs{UserRecordID: userRecordID, ActivityID: ar.ID}, nil); err != nil {
-		return fmt.Errorf("failed to insert follow job: %w", err)
+	if err := tx.Enqueue(ctx, HandleInboxArgs{UserRecordID: userRecordID, ActivityID: ar.ID, Trace: telemetry.Inject(ctx)}, nil); err != nil {
+		return nil, fmt.Errorf("failed to insert follow job: %w", err)
 	}
 
-	return nil
+	return nil, nil //nolint:nilnil
 }
 
-func (s *Service) handleOutbox(ctx context.Context, tx pgx.Tx, userRecordID database.ULID, ar ActivityRecord) error {
-	if ar.Type != createActivityType {
-		return fmt.Errorf("invalid activity type: %s", ar.Type)
+// handleInboxCreate notifies the user of a remote actor's note. When it
+// replies to one of the user's notes, it also emits a webhook, and returns an
+// event. Users follow no one, so any other note delivered to their inbox is
+// one which addresses or mentions them.
+func (s *Service) handleInboxCreate(ctx context.Context, tx Tx, userRecordID database.ULID, ar ActivityRecord) (*events.Event, error) {
+	type reply struct {
+		ID        string `json:"id"`
+		InReplyTo string `json:"inReplyTo"`
+		Content   string `json:"content"`
 	}
 
-	var ao Activity[Note]
+	var ao Activity[reply]
 	if err := json.Unmarshal(ar.Data, &ao); err != nil {
-		return fmt.Errorf("failed to unmarshal activity data: %w", err)
+		slog.InfoContext(ctx, "ignoring create activity with unexpected object", "activity_id", ar.ID, "error", err)
+		return nil, nil //nolint:nilnil
+	}
+
+	isReply := false
+
+	if ao.Object.InReplyTo != "" {
+		var err error
+		if isReply, err = tx.HasNote(ctx, userRecordID, ao.Object.InReplyTo); err != nil {
+			return nil, err //nolint:wrapcheck
+		}
+	}
+
+	if !isReply {
+		return nil, s.notify(ctx, tx, userRecordID, NotificationMention, ar, ao.Actor, ao.Object.ID)
 	}
 
-	if ao.Object.Type != "Note" {
-		return fmt.Errorf("invalid object type: %s", ao.Object.Type)
+	if err := s.notify(ctx, tx, userRecordID, NotificationReply, ar, ao.Actor, ao.Object.InReplyTo); err != nil {
+		return nil, err
+	}
+
+	if err := s.emitWebhook(ctx, tx, webhooks.NewEvent(webhooks.ReplyReceived, map[string]any{
+		"user_id":     userRecordID,
+		"actor_id":    ao.Actor,
+		"activity_id": ao.ID,
+		"object_id":   ao.Object.ID,
+		"in_reply_to": ao.Object.InReplyTo,
+		"content":     ao.Object.Content,
+	})); err != nil {
+		return nil, err
+	}
+
+	// The reply's content is left out of the event, whose notification must
+	// be small, and which is a signal to look at the reply.
+	event := events.New(events.ReplyReceived, map[string]any{
+		"user_id":     userRecordID,
+		"actor_id":    ao.Actor,
+		"object_id":   ao.Object.ID,
+		"in_reply_to": ao.Object.InReplyTo,
+	})
+
+	return &event, nil
+}
+
+// Site returns the Site from which the IDs of users' actors and objects are
+// built.
+func (s *Service) Site() Site {
+	return s.site
+}
+
+// Events returns the broker through which notifications of new content are
+// published, to which other services publish theirs, and from which they may
+// be subscribed to.
+func (s *Service) Events() *events.Broker {
+	return s.events
+}
+
+// publishEvent publishes an event, logging rather than returning an error,
+// since the content it describes was created regardless.
+func (s *Service) publishEvent(ctx context.Context, event events.Event) {
+	if err := s.events.Publish(ctx, event); err != nil {
+		slog.ErrorContext(ctx, "failed to publish event", "type", event.Type, "error", err)
+	}
+}
+
+// EmitWebhook enqueues delivery of an event of another service, if events of
+// its type are enabled.
+func (s *Service) EmitWebhook(ctx context.Context, event webhooks.Event) error {
+	return s.emitWebhook(ctx, nil, event)
+}
+
+// emitWebhook enqueues delivery of a webhook event, if the event is enabled.
+//
+// If tx is nil, the delivery job is enqueued outside of a transaction.
+func (s *Service) emitWebhook(ctx context.Context, tx Tx, event webhooks.Event) error {
+	if !s.webhooks.Enabled(event.Type) {
+		return nil
+	}
+
+	args := webhooks.DeliverArgs{Event: event, Trace: telemetry.Inject(ctx)}
+
+	var err error
+	if tx != nil {
+		err = tx.Enqueue(ctx, args, nil)
+	} else {
+		err = s.store.Enqueue(ctx, args, nil)
 	}
 
-	_, err := s.insertNote(ctx, tx, userRecordID, ao.ID, ao.Object)
 	if err != nil {
-		return fmt.Errorf("failed to create note: %w", err)
+		return fmt.Errorf("failed to insert webhook job: %w", err)
 	}
 
-	followers, err := s.ListFollowers(ctx, userRecordID)
+	return nil
+}
+
+// handleOutbox handles an activity posted to the user's outbox, enqueueing
+// its delivery to their followers, or, for Announces, Likes, Follows, and
+// Undos, to those it is addressed to, and returns an event to publish once it
+// is committed, if there is one.
+func (s *Service) handleOutbox(ctx context.Context, tx Tx, userRecordID database.ULID, ar ActivityRecord) (*events.Event, error) {
+	var event *events.Event
+
+	switch ar.Type {
+	case createActivityType:
+		var ao Activity[Note]
+		if err := json.Unmarshal(ar.Data, &ao); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal activity data: %w", err)
+		}
+
+		if ao.Object.Type != "Note" {
+			return nil, fmt.Errorf("invalid object type: %s", ao.Object.Type)
+		}
+
+		note, err := s.insertNote(ctx, tx, userRecordID, ao.ID, ao.Object)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create note: %w", err)
+		}
+
+		created := events.New(events.NoteCreated, map[string]any{
+			"user_id":   userRecordID,
+			"note_id":   note.RecordID,
+			"object_id": note.ObjectID,
+			"public":    slices.Contains(note.To, PublicNS),
+		})
+		event = &created
+	case updateActivityType:
+		var ao Activity[Note]
+		if err := json.Unmarshal(ar.Data, &ao); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal activity data: %w", err)
+		}
+
+		if ao.Object.Type != "Note" {
+			return nil, fmt.Errorf("invalid object type: %s", ao.Object.Type)
+		}
+
+		if err := tx.UpdateNote(ctx, userRecordID, ao.Object.ID, ao.Object.Content, time.Now().UTC()); err != nil {
+			return nil, fmt.Errorf("failed to update note: %w", err)
+		}
+	case deleteActivityType:
+		var ao Activity[Tombstone]
+		if err := json.Unmarshal(ar.Data, &ao); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal activity data: %w", err)
+		}
+
+		// The note and the activity which created it are purged by a
+		// PurgeDeletedWorker once the retention window has passed.
+		if err := tx.DeleteNote(ctx, userRecordID, ao.Object.ID, time.Now().UTC()); err != nil {
+			return nil, fmt.Errorf("failed to delete note: %w", err)
+		}
+	case announceActivityType, likeActivityType, followActivityType, undoActivityType:
+		ao, err := validateOutboxActivity(ctx, tx, userRecordID, ar)
+		if err != nil {
+			return nil, err
+		}
+
+		recipients, err := addressees(ctx, tx, userRecordID, ao)
+		if err != nil {
+			return nil, err
+		}
+
+		return nil, enqueueDeliveries(ctx, tx, userRecordID, ar, recipients)
+	default:
+		return nil, fmt.Errorf("invalid activity type: %s", ar.Type)
+	}
+
+	followers, err := tx.ListFollowers(ctx, userRecordID)
 	if err != nil {
-		return fmt.Errorf("failed to list followers: %w", err)
+		return nil, fmt.Errorf("failed to list followers: %w", err)
 	}
 
+	recipients := make([]string, 0, len(followers))
 	for _, follower := range followers {
-		if _, err := s.river.InsertTx(ctx, tx, HandleOutboxArgs{ActivityID: ao.ID, FollowerID: follower.ActorID, UserRecordID: userRecordID}, nil); err != nil {
-			return fmt.Errorf("failed to insert outbox job: %w", err)
-		}
+		recipients = append(recipients, follower.ActorID)
 	}
 
-	return nil
+	return event, enqueueDeliveries(ctx, tx, userRecordID, ar, recipients)
 }
 
-func (s *Service) insertActivityRecord(ctx context.Context, tx pgx.Tx, userRecordID database.ULID, mailbox Mailbox, context, typ, id string, data []byte) (ActivityRecord, error) {
+func (s *Service) insertActivityRecord(ctx context.Context, tx Tx, userRecordID database.ULID, mailbox Mailbox, context, typ, id string, data []byte) (ActivityRecord, error) {
 	now := time.Now().UTC()
 
 	var activityRecordID database.ULID
 	if mailbox == Outbox {
 		// Extract generated ULID from the activity object's object ID, which is a URL.
 		// The ULID is the last segment of the URL.
-		parts := strings.Split(id, "/")
-		activityRecordIDStr := parts[len(parts)-1]
-		rid, err := database.ParseULID(activityRecordIDStr)
+		rid, err := lastULID(id)
 		if err != nil {
 			return ActivityRecord{}, fmt.Errorf("failed to parse activity record ID: %w", err)
 		}
@@ -135,72 +349,94 @@ func (s *Service) insertActivityRecord(ctx context.Context, tx pgx.Tx, userRecor
 		activityRecordID = database.NewULID()
 	}
 
-	query, args, err := s.sql.
-		Insert(activitiesTable).
-		Columns(activitiesFieldsWritable...).
-		Values(activityRecordID, userRecordID, mailbox, context, typ, id, data, now, now).
-		Suffix("RETURNING " + strings.Join(activitiesFields, ", ")).
-		ToSql()
+	return tx.InsertActivity(ctx, ActivityRecord{ //nolint:wrapcheck
+		RecordID:  activityRecordID,
+		UserID:    userRecordID,
+		Mailbox:   mailbox,
+		Context:   context,
+		Type:      typ,
+		ID:        id,
+		Data:      data,
+		CreatedAt: now,
+		UpdatedAt: now,
+	})
+}
+
+func (s *Service) insertNote(ctx context.Context, tx Tx, userRecordID database.ULID, activityID string, note Note) (NoteRecord, error) {
+	now := time.Now().UTC()
+
+	// Extract generated ULID from the note object's object ID, which is a URL.
+	// The ULID is the last segment of the URL.
+	noteRecordID, err := lastULID(note.ID)
 	if err != nil {
-		return ActivityRecord{}, fmt.Errorf("failed to build query: %w", err)
+		return NoteRecord{}, fmt.Errorf("failed to parse note record ID: %w", err)
 	}
 
-	var a ActivityRecord
-	if err := tx.QueryRow(ctx, query, args...).Scan(a.scannableFields()...); err != nil {
-		return ActivityRecord{}, fmt.Errorf("failed to insert activity: %w", err)
-	}
+	// Notes are published in the HTTP time format by NewNote.
+	published, err := http.ParseTime(note.Published)
+	if err != nil {
+		return NoteRecord{}, fmt.Errorf("failed to parse note published time: %w", err)
+	}
+
+	return tx.InsertNote(ctx, NoteRecord{ //nolint:wrapcheck
+		RecordID:   noteRecordID,
+		UserID:     userRecordID,
+		ActivityID: activityID,
+		ObjectID:   note.ID,
+		Content:    note.Content,
+		Published:  published,
+		To:         note.To,
+		Cc:         note.Cc,
+		CreatedAt:  now,
+		UpdatedAt:  now,
+	})
+}
 
-	return a, nil
+// lastULID parses the last segment of a URL as a ULID.
+func lastULID(url string) (database.ULID, error) {
+	parts := strings.Split(url, "/")
+
+	return database.ParseULID(parts[len(parts)-1]) //nolint:wrapcheck
 }
 
-func (s *Service) insertNote(ctx context.Context, tx pgx.Tx, userRecordID database.ULID, activityID string, note Note) (NoteRecord, error) {
-	now := time.Now().UTC()
+// PurgeDeleted permanently deletes notes and activities which were deleted
+// before the given time, returning how many of each were purged.
+func (s *Service) PurgeDeleted(ctx context.Context, before time.Time) (notes, activities int64, err error) {
+	return s.store.PurgeDeleted(ctx, before) //nolint:wrapcheck
+}
 
-	var n NoteRecord
+// A GetOpt changes which records a Get method finds.
+type GetOpt func(*getOpts)
 
-	// Extract generated ULID from the note object's object ID, which is a URL.
-	// The ULID is the last segment of the URL.
-	parts := strings.Split(note.ID, "/")
-	noteRecordID := parts[len(parts)-1]
-
-	query, args, err := s.sql.
-		Insert(notesTable).
-		Columns(notesFieldsWritable...).
-		Values(noteRecordID, userRecordID, activityID, note.ID, note.Content, note.Published, note.To, note.Cc, now, now).
-		Suffix("RETURNING " + strings.Join(notesFields, ", ")).
-		ToSql()
-	if err != nil {
-		return NoteRecord{}, fmt.Errorf("failed to build query: %w", err)
+type getOpts struct {
+	deleted bool
+}
+
+// WithDeleted finds records which have been deleted but not yet purged, such
+// as to serve a Tombstone for a deleted note.
+func WithDeleted() GetOpt {
+	return func(o *getOpts) {
+		o.deleted = true
 	}
+}
 
-	if err := tx.QueryRow(ctx, query, args...).Scan(n.scannableFields()...); err != nil {
-		return NoteRecord{}, fmt.Errorf("failed to insert note: %w", err)
+func newGetOpts(opts []GetOpt) getOpts {
+	var o getOpts
+	for _, opt := range opts {
+		opt(&o)
 	}
 
-	return n, nil
+	return o
 }
 
 // ErrNoteNotFound is returned when a note is not found.
 var ErrNoteNotFound = errors.New("note not found")
 
-// GetNoteByID gets a note by its record ID.
-func (s *Service) GetNoteByID(ctx context.Context, id database.ULID) (NoteRecord, error) {
-	query, args, err := s.sql.
-		Select(notesFields...).
-		From(notesTable).
-		Where(squirrel.Eq{notesRecordIDColumn: id}).
-		ToSql()
+// GetNoteByID gets a user's note by its record ID.
+func (s *Service) GetNoteByID(ctx context.Context, userRecordID database.ULID, id database.ULID, opts ...GetOpt) (NoteRecord, error) {
+	n, err := s.store.GetNote(ctx, userRecordID, id, newGetOpts(opts).deleted)
 	if err != nil {
-		return NoteRecord{}, fmt.Errorf("failed to build query: %w", err)
-	}
-
-	var n NoteRecord
-	if err := s.pool.QueryRow(ctx, query, args...).Scan(n.scannableFields()...); err != nil {
-		if errors.Is(err, pgx.ErrNoRows) {
-			return NoteRecord{}, ErrNoteNotFound
-		}
-
-		return NoteRecord{}, fmt.Errorf("failed to get note by ID: %w", err)
+		return NoteRecord{}, err //nolint:wrapcheck
 	}
 
 	if !n.IsPublic() {
@@ -210,195 +446,294 @@ func (s *Service) GetNoteByID(ctx context.Context, id database.ULID) (NoteRecord
 	return n, nil
 }
 
+// GetNoteByObjectID gets a user's note by its object ID.
+func (s *Service) GetNoteByObjectID(ctx context.Context, userRecordID database.ULID, objectID string, opts ...GetOpt) (NoteRecord, error) {
+	return s.store.GetNoteByObjectID(ctx, userRecordID, objectID, newGetOpts(opts).deleted) //nolint:wrapcheck
+}
+
 // ErrActivityNotFound is returned when an activity is not found.
 var ErrActivityNotFound = errors.New("activity not found")
 
 // GetActivityByID gets an activity by its object ID.
-func (s *Service) GetActivityByID(ctx context.Context, userRecordID database.ULID, id string) (ActivityRecord, error) {
-	query, args, err := s.sql.
-		Select(activitiesFields...).
-		From(activitiesTable).
-		Where(squirrel.Eq{activitiesUserIDColumn: userRecordID}).
-		Where(squirrel.Eq{activitiesIDColumn: id}).
-		ToSql()
-	if err != nil {
-		return ActivityRecord{}, fmt.Errorf("failed to build query: %w", err)
-	}
+func (s *Service) GetActivityByID(ctx context.Context, userRecordID database.ULID, id string, opts ...GetOpt) (ActivityRecord, error) {
+	return s.store.GetActivity(ctx, userRecordID, id, newGetOpts(opts).deleted) //nolint:wrapcheck
+}
 
-	var a ActivityRecord
-	if err := s.pool.QueryRow(ctx, query, args...).Scan(a.scannableFields()...); err != nil {
-		if errors.Is(err, pgx.ErrNoRows) {
-			return ActivityRecord{}, ErrActivityNotFound
-		}
+// CreateFollower creates a new follower record. If the actor already follows
+// the user, such as when a Follow is delivered again, the existing record is
+// updated to refer to the new Follow and returned.
+func (s *Service) CreateFollower(ctx context.Context, userRecordID database.ULID, actorID, activityID string) (FollowerRecord, error) {
+	var f FollowerRecord
+
+	err := s.store.Tx(ctx, func(tx Tx) error {
+		var err error
+		f, err = s.createFollower(ctx, tx, userRecordID, actorID, activityID)
 
-		return ActivityRecord{}, fmt.Errorf("failed to get activity by ID: %w", err)
+		return err
+	})
+	if err != nil {
+		return FollowerRecord{}, err //nolint:wrapcheck
 	}
 
-	return a, nil
+	return f, nil
 }
 
-// CreateFollower creates a new follower record.
-func (s *Service) CreateFollower(ctx context.Context, userRecordID database.ULID, actorID, activityID string) (FollowerRecord, error) {
+// createFollower creates a follower in tx. A follow may be handled more than
+// once, such as when its job is retried or repaired, so an existing follower
+// is updated rather than duplicated.
+func (s *Service) createFollower(ctx context.Context, tx Tx, userRecordID database.ULID, actorID, activityID string) (FollowerRecord, error) {
 	now := time.Now().UTC()
 
-	var f FollowerRecord
+	return tx.CreateFollower(ctx, FollowerRecord{ //nolint:wrapcheck
+		UserID:     userRecordID,
+		ActorID:    actorID,
+		ActivityID: activityID,
+		CreatedAt:  now,
+		UpdatedAt:  now,
+	})
+}
+
+// DeleteFollower deletes a follower record, and reports whether the actor was
+// a follower.
+func (s *Service) DeleteFollower(ctx context.Context, userRecordID database.ULID, actorID string) (bool, error) {
+	var deleted bool
 
-	query, args, err := s.sql.
-		Insert(followersTable).
-		Columns(followersFieldsWritable...).
-		Values(userRecordID, actorID, activityID, now, now).
-		Suffix("RETURNING " + strings.Join(followersFields, ", ")).
-		ToSql()
+	err := s.store.Tx(ctx, func(tx Tx) error {
+		var err error
+		deleted, err = tx.DeleteFollower(ctx, userRecordID, actorID)
+
+		return err
+	})
 	if err != nil {
-		return FollowerRecord{}, fmt.Errorf("failed to build query: %w", err)
+		return false, err //nolint:wrapcheck
 	}
 
-	if err := s.pool.QueryRow(ctx, query, args...).Scan(f.scannableFields()...); err != nil {
-		return FollowerRecord{}, fmt.Errorf("failed to insert follower: %w", err)
-	}
+	return deleted, nil
+}
 
-	return f, nil
+// ListPublicOutbox lists a page of the public Create activities in a user's
+// outbox, most recent first, and returns how many there are in all. If limit
+// is zero, every activity is listed.
+func (s *Service) ListPublicOutbox(ctx context.Context, userRecordID database.ULID, limit, offset int) ([]ActivityRecord, int, error) {
+	return s.store.ListPublicActivities(ctx, userRecordID, Outbox, createActivityType, limit, offset) //nolint:wrapcheck
 }
 
-// DeleteFollower deletes a follower record.
-func (s *Service) DeleteFollower(ctx context.Context, userRecordID database.ULID, actorID string) error {
-	query, args, err := s.sql.
-		Delete(followersTable).
-		Where(squirrel.Eq{followersUserIDColumn: userRecordID}).
-		Where(squirrel.Eq{followersActorIDColumn: actorID}).
-		ToSql()
-	if err != nil {
-		return fmt.Errorf("failed to build query: %w", err)
+// ListPublicNotes lists the given user's most recent public notes, most recent
+// first.
+func (s *Service) ListPublicNotes(ctx context.Context, userRecordID database.ULID, limit int) ([]NoteRecord, error) {
+	return s.store.ListNotes(ctx, userRecordID, true, limit) //nolint:wrapcheck
+}
+
+// ListNotes lists all of the given user's notes, public or not, most recent
+// first.
+func (s *Service) ListNotes(ctx context.Context, userRecordID database.ULID) ([]NoteRecord, error) {
+	return s.store.ListNotes(ctx, userRecordID, false, 0) //nolint:wrapcheck
+}
+
+// ListFollowers lists all followers.
+func (s *Service) ListFollowers(ctx context.Context, userRecordID database.ULID) ([]FollowerRecord, error) {
+	return s.store.ListFollowers(ctx, userRecordID) //nolint:wrapcheck
+}
+
+// ListFollowing lists the IDs of the actors the user follows: those they have
+// sent Follows to and not undone, whether or not the Follows were accepted.
+func (s *Service) ListFollowing(ctx context.Context, userRecordID database.ULID) ([]string, error) {
+	return s.store.ListFollowing(ctx, userRecordID) //nolint:wrapcheck
+}
+
+type jobConfig struct {
+	workers  *river.Workers
+	periodic []*river.PeriodicJob
+	run      bool
+}
+
+// A JobOpt adds jobs to those worked by the Service's job client.
+type JobOpt func(*jobConfig)
+
+// WithWorker registers a worker for jobs of another kind.
+func WithWorker[T river.JobArgs](worker river.Worker[T]) JobOpt {
+	return func(c *jobConfig) {
+		river.AddWorker(c.workers, worker)
 	}
+}
 
-	if _, err := s.pool.Exec(ctx, query, args...); err != nil {
-		return fmt.Errorf("failed to delete follower: %w", err)
+// WithPeriodicJob schedules a periodic job. Its kind must have a worker.
+func WithPeriodicJob(job *river.PeriodicJob) JobOpt {
+	return func(c *jobConfig) {
+		c.periodic = append(c.periodic, job)
 	}
+}
 
-	return nil
+// WithoutWorkers creates the Service without working jobs, regardless of
+// configuration, for processes which only read, such as exports. Jobs may
+// still be enqueued.
+func WithoutWorkers() JobOpt {
+	return func(c *jobConfig) {
+		c.run = false
+	}
 }
 
-// ListPublicOutbox lists all public outbox activity.
-func (s *Service) ListPublicOutbox(ctx context.Context, userRecordID database.ULID) ([]ActivityRecord, error) {
-	query, args, err := s.sql.
-		Select(activitiesFields...).
-		From(activitiesTable).
-		Where(squirrel.Eq{activitiesUserIDColumn: userRecordID}).
-		Where(squirrel.Eq{activitiesMailboxColumn: Outbox}).
-		Where(squirrel.Eq{activitiesTypeColumn: createActivityType}).
-		ToSql()
-	if err != nil {
-		return nil, fmt.Errorf("failed to build query: %w", err)
+// NewService creates a new Service. If the configuration says to, it works
+// jobs once it is started.
+func NewService(cfg config.Config, pool *pgxpool.Pool, id *identity.Service, opts ...JobOpt) (*Service, error) {
+	s := NewServiceWithStore(cfg, nil)
+
+	workers := river.NewWorkers()
+	river.AddWorker(workers, newHandleFollowWorker(s))
+	river.AddWorker(workers, newDeliverAcceptWorker(s, id))
+	river.AddWorker(workers, newHandleOutboxWorker(s, id))
+	river.AddWorker(workers, webhooks.NewDeliverWorker(s.webhooks))
+	river.AddWorker(workers, newPurgeDeletedWorker(s, cfg.DeletedRetention))
+	river.AddWorker(workers, newRepairWorker(s))
+
+	jobs := jobConfig{workers: workers, periodic: []*river.PeriodicJob{purgeDeletedPeriodicJob(), repairPeriodicJob()}, run: cfg.WorksJobs()}
+	for _, opt := range opts {
+		opt(&jobs)
 	}
 
-	rows, err := s.pool.Query(ctx, query, args...)
+	riverClient, err := river.NewClient(riverpgxv5.New(pool), &river.Config{
+		Queues: map[string]river.QueueConfig{
+			// Jobs inserted before queues were split remain in the default
+			// queue until they are worked.
+			river.QueueDefault: {MaxWorkers: 1},
+			queues.Inbox:       {MaxWorkers: cfg.QueueInboxWorkers},
+			queues.Delivery:    {MaxWorkers: cfg.QueueDeliveryWorkers},
+			queues.Media:       {MaxWorkers: cfg.QueueMediaWorkers},
+			queues.Periodic:    {MaxWorkers: cfg.QueuePeriodicWorkers},
+		},
+		FetchPollInterval: cfg.JobFetchPollInterval,
+		FetchCooldown:     cfg.JobFetchCooldown,
+		ErrorHandler:      errorHandler{pub: s},
+		Workers:           workers,
+		PeriodicJobs:      jobs.periodic,
+	})
 	if err != nil {
-		return nil, fmt.Errorf("failed to query activities: %w", err)
+		return nil, fmt.Errorf("failed to create river client: %w", err)
 	}
 
-	var activities []ActivityRecord
+	s.store = newPostgresStore(pool, riverClient)
+	s.events = events.NewBroker(pool)
+	s.river = riverClient
+	s.runWorkers = jobs.run
 
-	for rows.Next() {
-		var a ActivityRecord
-		if err := rows.Scan(a.scannableFields()...); err != nil {
-			return nil, fmt.Errorf("failed to scan activity: %w", err)
-		}
+	return s, nil
+}
 
-		activities = append(activities, a)
+// Start starts working jobs, if this instance works them. It fails if the job
+// queue's tables are missing, such as when migrations have not been applied.
+//
+// Jobs are worked with contexts derived from ctx, so cancelling it cancels
+// them; use Stop to let them finish.
+func (s *Service) Start(ctx context.Context) error {
+	if !s.runWorkers {
+		return nil
 	}
 
-	if err := rows.Err(); err != nil {
-		return nil, fmt.Errorf("failed to iterate activities: %w", err)
+	if err := s.store.CheckJobs(ctx); err != nil {
+		return fmt.Errorf("job queue is unavailable: %w", err)
 	}
 
-	var publicActivities []ActivityRecord
+	events, unsubscribe := s.river.Subscribe(
+		river.EventKindJobCompleted,
+		river.EventKindJobFailed,
+		river.EventKindJobCancelled,
+		river.EventKindJobSnoozed,
+	)
 
-	for _, a := range activities {
-		type publicActivity struct {
-			To []string `json:"to"`
-		}
+	metricsCtx, cancel := context.WithCancel(context.Background())
+	go s.metrics.run(metricsCtx, events, metricsInterval, s.reportMetrics) //nolint:contextcheck
 
-		var pa publicActivity
-		if err := json.Unmarshal(a.Data, &pa); err != nil {
-			return nil, fmt.Errorf("failed to unmarshal activity: %w", err)
-		}
+	s.stopMetrics = func() {
+		cancel()
+		unsubscribe()
+	}
 
-		if len(pa.To) == 0 {
-			continue
-		}
+	if err := s.river.Start(ctx); err != nil {
+		s.stopMetrics()
 
-		if slices.Contains(pa.To, ActivityStreamsContext+"#Public") {
-			publicActivities = append(publicActivities, a)
-		}
+		return fmt.Errorf("failed to start river client: %w", err)
 	}
 
-	return publicActivities, nil
-}
+	s.running.Store(true)
 
-// ListFollowers lists all followers.
-func (s *Service) ListFollowers(ctx context.Context, userRecordID database.ULID) ([]FollowerRecord, error) {
-	query, args, err := s.sql.
-		Select(followersFields...).
-		From(followersTable).
-		Where(squirrel.Eq{followersUserIDColumn: userRecordID}).
-		ToSql()
-	if err != nil {
-		return nil, fmt.Errorf("failed to build query: %w", err)
-	}
+	return nil
+}
 
-	rows, err := s.pool.Query(ctx, query, args...)
-	if err != nil {
-		return nil, fmt.Errorf("failed to query followers: %w", err)
+// NewServiceWithStore creates a new Service which keeps activities in the
+// given store, such as a MemoryStore. Jobs are enqueued in the store, but the
+// Service does not work them.
+func NewServiceWithStore(cfg config.Config, store Store) *Service {
+	return &Service{
+		store:   store,
+		site:    NewSite(cfg),
+		metrics: newMetrics(),
+		alerts: alertConfig{
+			failureRate:   cfg.AlertDeliveryFailureRate,
+			minDeliveries: cfg.AlertDeliveryMinimum,
+		},
+		failingHosts: map[string]bool{},
+		events:       events.NewBroker(nil),
+		webhooks: webhooks.Config{
+			URL:    cfg.WebhookURL,
+			Secret: cfg.WebhookSecret,
+			Events: cfg.WebhookEvents,
+		},
 	}
+}
 
-	var followers []FollowerRecord
-
-	for rows.Next() {
-		var f FollowerRecord
-		if err := rows.Scan(f.scannableFields()...); err != nil {
-			return nil, fmt.Errorf("failed to scan follower: %w", err)
-		}
+// InsertJob enqueues a job of a kind whose worker was registered with
+// WithWorker.
+func (s *Service) InsertJob(ctx context.Context, args river.JobArgs) error {
+	return s.store.Enqueue(ctx, args, nil) //nolint:wrapcheck
+}
 
-		followers = append(followers, f)
-	}
+// ErrJobsNotRunning is returned by CheckJobs when this instance should work
+// jobs but its job client is not running.
+var ErrJobsNotRunning = errors.New("job client is not running")
 
-	if err := rows.Err(); err != nil {
-		return nil, fmt.Errorf("failed to iterate followers: %w", err)
+// CheckJobs returns an error if jobs cannot be enqueued or, when this instance
+// works jobs, if the job client is not running.
+func (s *Service) CheckJobs(ctx context.Context) error {
+	if s.runWorkers && !s.running.Load() {
+		return ErrJobsNotRunning
 	}
 
-	return followers, nil
+	return s.store.CheckJobs(ctx) //nolint:wrapcheck
 }
 
-// NewService creates a new Service.
-func NewService(ctx context.Context, pool *pgxpool.Pool, id *identity.Service) (*Service, error) {
-	s := Service{
-		pool: pool,
-		sql:  squirrel.StatementBuilder.PlaceholderFormat(squirrel.Dollar),
+// Stop stops the job client, waiting for running jobs to finish until ctx is
+// done, after which they are cancelled and left to be retried.
+func (s *Service) Stop(ctx context.Context) error {
+	// The client blocks forever when stopped if it was never started.
+	if !s.running.Swap(false) {
+		return nil
 	}
 
-	workers := river.NewWorkers()
-	river.AddWorker(workers, newHandleFollowWorker(&s, id))
-	river.AddWorker(workers, newHandleOutboxWorker(&s, id))
+	defer s.stopMetrics()
 
-	riverClient, err := river.NewClient(riverpgxv5.New(pool), &river.Config{
-		Queues: map[string]river.QueueConfig{
-			river.QueueDefault: {MaxWorkers: 10},
-		},
-		Workers: workers,
-	})
-	if err != nil {
-		return nil, fmt.Errorf("failed to create river client: %w", err)
-	}
+	stopped := make(chan error, 1)
+
+	go func() {
+		stopped <- s.river.Stop(context.Background()) //nolint:contextcheck
+	}()
 
-	if config.RunWorkers() {
-		if err := riverClient.Start(ctx); err != nil {
-			return nil, fmt.Errorf("failed to start river client: %w", err)
+	select {
+	case err := <-stopped:
+		if err != nil {
+			return fmt.Errorf("failed to stop river client: %w", err)
 		}
+
+		return nil
+	case <-ctx.Done():
 	}
 
-	s.river = riverClient
+	slog.WarnContext(ctx, "timed out waiting for jobs to finish, cancelling them")
+
+	if err := s.river.StopAndCancel(context.Background()); err != nil { //nolint:contextcheck
+		return fmt.Errorf("failed to stop river client: %w", err)
+	}
 
-	return &s, nil
+	return nil
 }
 
 const activitiesTable = "activities"
@@ -411,6 +746,7 @@ const activitiesIDColumn = "activity_id"
 const activitiesDataColumn = "data"
 const activitiesCreatedAtColumn = "created_at"
 const activitiesUpdatedAtColumn = "updated_at"
+const activitiesDeletedAtColumn = "deleted_at"
 
 var activitiesFields = []string{ //nolint:gochecknoglobals
 	activitiesRecordIDColumn,
@@ -421,9 +757,19 @@ var activitiesFields = []string{ //nolint:gochecknoglobals
 	activitiesIDColumn,
 	activitiesDataColumn,
 	activitiesCreatedAtColumn,
-	activitiesUpdatedAtColumn}
+	activitiesUpdatedAtColumn,
+	activitiesDeletedAtColumn}
 
-var activitiesFieldsWritable = activitiesFields //nolint:gochecknoglobals
+var activitiesFieldsWritable = []string{ //nolint:gochecknoglobals
+	activitiesRecordIDColumn,
+	activitiesUserIDColumn,
+	activitiesMailboxColumn,
+	activitiesContextColumn,
+	activitiesTypeColumn,
+	activitiesIDColumn,
+	activitiesDataColumn,
+	activitiesCreatedAtColumn,
+	activitiesUpdatedAtColumn}
 
 // An ActivityRecord is a database record containing an ActivityPub activity.
 // SEE: https://www.w3.org/TR/activitystreams-vocabulary/#dfn-activity
@@ -437,6 +783,7 @@ type ActivityRecord struct {
 	Data      []byte        `json:"data"`
 	CreatedAt time.Time     `json:"created_at"`
 	UpdatedAt time.Time     `json:"updated_at"`
+	DeletedAt *time.Time    `json:"deleted_at,omitempty"`
 }
 
 func (a *ActivityRecord) scannableFields() []any {
@@ -450,6 +797,7 @@ func (a *ActivityRecord) scannableFields() []any {
 		&a.Data,
 		&a.CreatedAt,
 		&a.UpdatedAt,
+		&a.DeletedAt,
 	}
 }
 
@@ -517,6 +865,7 @@ const notesToColumn = "to_iri"
 const notesCcColumn = "cc_iri"
 const notesCreatedAtColumn = "created_at"
 const notesUpdatedAtColumn = "updated_at"
+const notesDeletedAtColumn = "deleted_at"
 
 var notesFields = []string{ //nolint:gochecknoglobals
 	notesRecordIDColumn,
@@ -528,9 +877,20 @@ var notesFields = []string{ //nolint:gochecknoglobals
 	notesToColumn,
 	notesCcColumn,
 	notesCreatedAtColumn,
-	notesUpdatedAtColumn}
+	notesUpdatedAtColumn,
+	notesDeletedAtColumn}
 
-var notesFieldsWritable = notesFields //nolint:gochecknoglobals
+var notesFieldsWritable = []string{ //nolint:gochecknoglobals
+	notesRecordIDColumn,
+	notesUserIDColumn,
+	notesActivityIDColumn,
+	notesObjectIDColumn,
+	notesContentColumn,
+	notesPublishedColumn,
+	notesToColumn,
+	notesCcColumn,
+	notesCreatedAtColumn,
+	notesUpdatedAtColumn}
 
 // An NoteRecord is a database record containing a note.
 type NoteRecord struct {
@@ -544,6 +904,7 @@ type NoteRecord struct {
 	Cc         []string      `json:"cc"`
 	CreatedAt  time.Time     `json:"created_at"`
 	UpdatedAt  time.Time     `json:"updated_at"`
+	DeletedAt  *time.Time    `json:"deleted_at,omitempty"`
 }
 
 func (n *NoteRecord) ToNote(user Actor) *Note {
@@ -587,24 +948,6 @@ func (n *NoteRecord) scannableFields() []any {
 		&n.Cc,
 		&n.CreatedAt,
 		&n.UpdatedAt,
+		&n.DeletedAt,
 	}
 }
-
-func endTransaction(ctx context.Context, tx pgx.Tx, err error) error {
-	if err != nil {
-		if rerr := tx.Rollback(ctx); rerr != nil {
-			// On a failed rollback, we don't want to return the rollback error,
-			// but the original error will instead be used as the cause by the
-			// caller.
-			slog.Error("failed to rollback transaction", "error", rerr)
-		}
-	} else {
-		if cerr := tx.Commit(ctx); cerr != nil {
-			slog.Error("failed to commit transaction", "error", cerr)
-
-			return fmt.Errorf("failed to commit transaction: %w", cerr)
-		}
-	}
-
-	return nil
-}
@@ -0,0 +1,118 @@
+package activitypub
+
+import (
+	"context"
+	"time"
+
+	"github.com/jclem/jclem.me/internal/database"
+	"github.com/riverqueue/river"
+)
+
+// A Store keeps activities, notes, and followers, and enqueues the jobs which
+// federate them. The Service decides what an activity does before it is
+// stored, so a Store only records what it is given.
+//
+// Methods which get a note or an activity return ErrNoteNotFound or
+// ErrActivityNotFound if there is no such record. Deleted records are only
+// found if deleted is true.
+type Store interface {
+	// Tx calls fn with a Tx whose changes, and the jobs enqueued through it,
+	// are kept only if fn returns nil.
+	Tx(ctx context.Context, fn func(Tx) error) error
+
+	// Enqueue enqueues a job outside of a transaction.
+	Enqueue(ctx context.Context, args river.JobArgs, opts *river.InsertOpts) error
+
+	// CheckJobs returns an error if jobs cannot be enqueued.
+	CheckJobs(ctx context.Context) error
+
+	// GetActivity returns a user's activity by its object ID.
+	GetActivity(ctx context.Context, userID database.ULID, id string, deleted bool) (ActivityRecord, error)
+
+	// ListPublicActivities returns a page of a user's activities of the given
+	// type in a mailbox which are addressed to the public, most recent first,
+	// and how many there are in all. If limit is positive, at most that many
+	// are returned, after skipping offset.
+	ListPublicActivities(ctx context.Context, userID database.ULID, mailbox Mailbox, typ string, limit, offset int) ([]ActivityRecord, int, error)
+
+	// GetNote returns a user's note by its record ID.
+	GetNote(ctx context.Context, userID database.ULID, id database.ULID, deleted bool) (NoteRecord, error)
+
+	// GetNoteByObjectID returns a user's note by its object ID.
+	GetNoteByObjectID(ctx context.Context, userID database.ULID, objectID string, deleted bool) (NoteRecord, error)
+
+	// ListNotes returns a user's notes, most recently published first. If
+	// public is true, only notes addressed to the public are returned, and if
+	// limit is positive, at most that many are returned.
+	ListNotes(ctx context.Context, userID database.ULID, public bool, limit int) ([]NoteRecord, error)
+
+	// ListFollowers returns a user's followers.
+	ListFollowers(ctx context.Context, userID database.ULID) ([]FollowerRecord, error)
+
+	// ListFollowing returns the IDs of the actors a user has sent Follows to,
+	// and not undone, in order.
+	ListFollowing(ctx context.Context, userID database.ULID) ([]string, error)
+
+	// ListUnapplied returns the inbox follows and undos received between from
+	// and to whose effect on the user's followers is missing.
+	ListUnapplied(ctx context.Context, from, to time.Time) ([]HandleInboxArgs, error)
+
+	// ListNotifications returns a page of a user's notifications, most recent
+	// first, and how many there are in all. If unread is true, only unread
+	// notifications are returned and counted. If limit is positive, at most
+	// that many are returned, after skipping offset.
+	ListNotifications(ctx context.Context, userID database.ULID, unread bool, limit, offset int) ([]NotificationRecord, int, error)
+
+	// MarkNotificationsRead marks a user's unread notifications with the given
+	// IDs, or, if there are none, all of them, read at the given time, and
+	// returns how many were marked.
+	MarkNotificationsRead(ctx context.Context, userID database.ULID, ids []database.ULID, at time.Time) (int, error)
+
+	// PurgeDeleted permanently deletes notes and activities which were
+	// deleted before the given time, returning how many of each were purged.
+	PurgeDeleted(ctx context.Context, before time.Time) (notes, activities int64, err error)
+}
+
+// A Tx changes a Store within a transaction.
+type Tx interface {
+	// InsertActivity stores a new activity, returning it as stored.
+	InsertActivity(ctx context.Context, activity ActivityRecord) (ActivityRecord, error)
+
+	// InsertNote stores a new note, returning it as stored.
+	InsertNote(ctx context.Context, note NoteRecord) (NoteRecord, error)
+
+	// UpdateNote sets the content of a user's note at the given time.
+	UpdateNote(ctx context.Context, userID database.ULID, objectID, content string, at time.Time) error
+
+	// DeleteNote marks a user's note deleted at the given time, along with the
+	// activity which created it.
+	DeleteNote(ctx context.Context, userID database.ULID, objectID string, at time.Time) error
+
+	// HasNote returns true if the user has an undeleted note with the given
+	// object ID.
+	HasNote(ctx context.Context, userID database.ULID, objectID string) (bool, error)
+
+	// CreateFollower stores a new follower. If the actor already follows the
+	// user, the existing follower's activity ID and update time are replaced
+	// and it is returned instead.
+	CreateFollower(ctx context.Context, follower FollowerRecord) (FollowerRecord, error)
+
+	// DeleteFollower deletes a user's follower, if there is one, and reports
+	// whether there was.
+	DeleteFollower(ctx context.Context, userID database.ULID, actorID string) (bool, error)
+
+	// GetActivity returns a user's undeleted activity by its object ID, or
+	// ErrActivityNotFound if there is none.
+	GetActivity(ctx context.Context, userID database.ULID, id string) (ActivityRecord, error)
+
+	// ListFollowers returns a user's followers.
+	ListFollowers(ctx context.Context, userID database.ULID) ([]FollowerRecord, error)
+
+	// InsertNotification stores a new notification, unless the user has
+	// already been notified of its activity, such as when it was delivered
+	// more than once.
+	InsertNotification(ctx context.Context, notification NotificationRecord) error
+
+	// Enqueue enqueues a job to be worked once the transaction is committed.
+	Enqueue(ctx context.Context, args river.JobArgs, opts *river.InsertOpts) error
+}
@@ -62,6 +62,19 @@ func (c Context) Contains(context any) bool {
 	return slices.Contains(c.rawValues, context)
 }
 
+// Base returns the context's first value if it is an IRI, as the ActivityStreams
+// context is in any activity, whether or not other servers extend it, or ""
+// otherwise.
+func (c Context) Base() string {
+	if len(c.rawValues) == 0 {
+		return ""
+	}
+
+	base, _ := c.rawValues[0].(string)
+
+	return base
+}
+
 // UnmarshalJSON implements the json.Unmarshaler interface.
 func (c *Context) UnmarshalJSON(data []byte) error {
 	var rawValuesArray []any
@@ -99,6 +112,11 @@ func NewContext(rawValues ...any) Context {
 const followActivityType = "Follow"
 const undoActivityType = "Undo"
 const createActivityType = "Create"
+const updateActivityType = "Update"
+const deleteActivityType = "Delete"
+const likeActivityType = "Like"
+const announceActivityType = "Announce"
+const acceptActivityType = "Accept"
 
 // A PublicKey is a public key definition as defined by the Security Vocabulary
 // (https://w3c.github.io/vc-data-integrity/vocab/security/vocabulary.html#publicKey).
@@ -113,6 +131,59 @@ type PublicKey struct {
 	PublicKeyPem string `json:"publicKeyPem"`
 }
 
+// PublicKeys are an actor's public keys, newest first.
+//
+// An actor usually has one key, which is written as a single object since that
+// is what most servers expect. While a rotated key is still valid, it is
+// published too, and the keys are written as an array. Servers which only read
+// one key read the first, which is the newest.
+type PublicKeys []PublicKey
+
+// Find returns the key with the given ID.
+func (k PublicKeys) Find(id string) (PublicKey, bool) {
+	for _, key := range k {
+		if key.ID == id {
+			return key, true
+		}
+	}
+
+	return PublicKey{}, false
+}
+
+// UnmarshalJSON implements the json.Unmarshaler interface.
+func (k *PublicKeys) UnmarshalJSON(data []byte) error {
+	var keys []PublicKey
+	if err := json.Unmarshal(data, &keys); err == nil {
+		*k = keys
+
+		return nil
+	}
+
+	var key PublicKey
+	if err := json.Unmarshal(data, &key); err != nil {
+		return fmt.Errorf("unmarshal public key: %w", err)
+	}
+
+	*k = PublicKeys{key}
+
+	return nil
+}
+
+// MarshalJSON implements the json.Marshaler interface.
+func (k PublicKeys) MarshalJSON() ([]byte, error) {
+	var v any = []PublicKey(k)
+	if len(k) == 1 {
+		v = k[0]
+	}
+
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, fmt.Errorf("marshal public keys: %w", err)
+	}
+
+	return b, nil
+}
+
 // An Image is an ActivityStreams Image used to identify a user.
 //
 // SEE https://www.w3.org/TR/activitystreams-vocabulary/#dfn-image
@@ -150,6 +221,36 @@ func NewCollection[T any](id string, items []T) OrderedCollection[T] {
 	}
 }
 
+// An OrderedCollectionPage is a page of an ActivityStreams OrderedCollection.
+//
+// SEE https://www.w3.org/TR/activitystreams-vocabulary/#dfn-orderedcollectionpage
+type OrderedCollectionPage[T any] struct {
+	Context      Context `json:"@context"`
+	ID           string  `json:"id"`
+	Type         string  `json:"type"`
+	PartOf       string  `json:"partOf"`
+	TotalItems   int     `json:"totalItems"`
+	Next         string  `json:"next,omitempty"`
+	Prev         string  `json:"prev,omitempty"`
+	OrderedItems []T     `json:"orderedItems"`
+}
+
+// NewCollectionPage creates a new OrderedCollectionPage, part of the given
+// collection, containing the given items.
+func NewCollectionPage[T any](id, partOf string, totalItems int, items []T) OrderedCollectionPage[T] {
+	return OrderedCollectionPage[T]{
+		Context: NewContext(
+			ActivityStreamsContext,
+			MastodonContext,
+		),
+		Type:         "OrderedCollectionPage",
+		ID:           id,
+		PartOf:       partOf,
+		TotalItems:   totalItems,
+		OrderedItems: items,
+	}
+}
+
 // An Activity is an ActivityStreams Activity.
 //
 // SEE https://www.w3.org/TR/activitystreams-vocabulary/#dfn-activity
@@ -164,22 +265,46 @@ type Activity[T any] struct {
 	Cc        []string `json:"cc,omitempty"`
 }
 
-func newAcceptActivity(actorID string, activityID string) Activity[string] {
+// referencedID returns the ID of an activity's object, which may be the object
+// itself or only its ID, or "" if it is neither.
+func referencedID(object json.RawMessage) string {
+	var id string
+	if err := json.Unmarshal(object, &id); err == nil {
+		return id
+	}
+
+	var embedded struct {
+		ID string `json:"id"`
+	}
+
+	if err := json.Unmarshal(object, &embedded); err == nil {
+		return embedded.ID
+	}
+
+	return ""
+}
+
+// newAcceptActivity creates an Accept of an activity, addressed to the actor
+// who sent it, whose ID is in the accepting actor's outbox.
+func newAcceptActivity(site Site, actor ActorLike, recordID database.ULID, activityID, actorID string) Activity[string] {
 	return Activity[string]{
-		Context: NewContext(ActivityStreamsContext),
-		Type:    "Accept",
-		Actor:   actorID,
-		Object:  activityID,
+		Context:   NewContext(ActivityStreamsContext),
+		Type:      acceptActivityType,
+		ID:        fmt.Sprintf("%s/outbox/%s", site.ActorID(actor), recordID),
+		Actor:     site.ActorID(actor),
+		Object:    activityID,
+		Published: time.Now().UTC().Format(http.TimeFormat),
+		To:        []string{actorID},
 	}
 }
 
 // NewCreateActivity creates a new Create activity.
-func NewCreateActivity[T any](actor ActorLike, object T, published string, to, cc []string) Activity[T] {
+func NewCreateActivity[T any](site Site, actor ActorLike, object T, published string, to, cc []string) Activity[T] {
 	return Activity[T]{
 		Context:   NewContext(ActivityStreamsContext),
 		Type:      createActivityType,
-		ID:        fmt.Sprintf("%s/outbox/%s", ActorID(actor), database.NewULID()),
-		Actor:     ActorID(actor),
+		ID:        fmt.Sprintf("%s/outbox/%s", site.ActorID(actor), database.NewULID()),
+		Actor:     site.ActorID(actor),
 		Object:    object,
 		Published: published,
 		To:        to,
@@ -187,6 +312,102 @@ func NewCreateActivity[T any](actor ActorLike, object T, published string, to, c
 	}
 }
 
+// NewUpdateActivity creates a new Update activity.
+func NewUpdateActivity[T any](site Site, actor ActorLike, object T, to, cc []string) Activity[T] {
+	return Activity[T]{
+		Context:   NewContext(ActivityStreamsContext),
+		Type:      updateActivityType,
+		ID:        fmt.Sprintf("%s/outbox/%s", site.ActorID(actor), database.NewULID()),
+		Actor:     site.ActorID(actor),
+		Object:    object,
+		Published: time.Now().UTC().Format(http.TimeFormat),
+		To:        to,
+		Cc:        cc,
+	}
+}
+
+// NewDeleteActivity creates a new Delete activity, whose object is a
+// Tombstone in place of the deleted object.
+func NewDeleteActivity(site Site, actor ActorLike, objectID string, to, cc []string) Activity[Tombstone] {
+	return Activity[Tombstone]{
+		Context:   NewContext(ActivityStreamsContext),
+		Type:      deleteActivityType,
+		ID:        fmt.Sprintf("%s/outbox/%s", site.ActorID(actor), database.NewULID()),
+		Actor:     site.ActorID(actor),
+		Object:    Tombstone{Type: "Tombstone", ID: objectID},
+		Published: time.Now().UTC().Format(http.TimeFormat),
+		To:        to,
+		Cc:        cc,
+	}
+}
+
+// NewAnnounceActivity creates a new Announce, or boost, of an object, which is
+// addressed to the public and the actor's followers, and to the object's
+// author, so that they are told of it.
+func NewAnnounceActivity(site Site, actor ActorLike, objectID, authorID string) Activity[string] {
+	return Activity[string]{
+		Context:   NewContext(ActivityStreamsContext),
+		Type:      announceActivityType,
+		ID:        fmt.Sprintf("%s/outbox/%s", site.ActorID(actor), database.NewULID()),
+		Actor:     site.ActorID(actor),
+		Object:    objectID,
+		Published: time.Now().UTC().Format(http.TimeFormat),
+		To:        []string{PublicNS},
+		Cc:        []string{site.ActorFollowers(actor), authorID},
+	}
+}
+
+// NewLikeActivity creates a new Like of an object, which is addressed only to
+// the object's author.
+func NewLikeActivity(site Site, actor ActorLike, objectID, authorID string) Activity[string] {
+	return Activity[string]{
+		Context:   NewContext(ActivityStreamsContext),
+		Type:      likeActivityType,
+		ID:        fmt.Sprintf("%s/outbox/%s", site.ActorID(actor), database.NewULID()),
+		Actor:     site.ActorID(actor),
+		Object:    objectID,
+		Published: time.Now().UTC().Format(http.TimeFormat),
+		To:        []string{authorID},
+	}
+}
+
+// NewFollowActivity creates a new Follow of another actor, which is addressed
+// to them.
+func NewFollowActivity(site Site, actor ActorLike, followeeID string) Activity[string] {
+	return Activity[string]{
+		Context:   NewContext(ActivityStreamsContext),
+		Type:      followActivityType,
+		ID:        fmt.Sprintf("%s/outbox/%s", site.ActorID(actor), database.NewULID()),
+		Actor:     site.ActorID(actor),
+		Object:    followeeID,
+		Published: time.Now().UTC().Format(http.TimeFormat),
+		To:        []string{followeeID},
+	}
+}
+
+// NewUndoActivity creates a new Undo of one of the actor's activities, which
+// embeds it and is addressed as it was.
+func NewUndoActivity[T any](site Site, actor ActorLike, undone Activity[T]) Activity[Activity[T]] {
+	return Activity[Activity[T]]{
+		Context:   NewContext(ActivityStreamsContext),
+		Type:      undoActivityType,
+		ID:        fmt.Sprintf("%s/outbox/%s", site.ActorID(actor), database.NewULID()),
+		Actor:     site.ActorID(actor),
+		Object:    undone,
+		Published: time.Now().UTC().Format(http.TimeFormat),
+		To:        undone.To,
+		Cc:        undone.Cc,
+	}
+}
+
+// A Tombstone stands in for a deleted object.
+//
+// SEE https://www.w3.org/TR/activitystreams-vocabulary/#dfn-tombstone
+type Tombstone struct {
+	Type string `json:"type"`
+	ID   string `json:"id"`
+}
+
 // A Note is an ActivityStreams Note.
 //
 // SEE https://www.w3.org/TR/activitystreams-vocabulary/#dfn-note
@@ -203,12 +424,12 @@ type Note struct {
 }
 
 // NewNote creates a new Note.
-func NewNote(actor ActorLike, content string, to, cc []string) Note {
+func NewNote(site Site, actor ActorLike, content string, to, cc []string) Note {
 	return Note{
 		Context:      NewContext(ActivityStreamsContext, MastodonContext),
 		Type:         "Note",
-		ID:           fmt.Sprintf("%s/notes/%s", ActorID(actor), database.NewULID()),
-		AttributedTo: ActorID(actor),
+		ID:           fmt.Sprintf("%s/notes/%s", site.ActorID(actor), database.NewULID()),
+		AttributedTo: site.ActorID(actor),
 		Content:      content,
 		Published:    time.Now().UTC().Format(http.TimeFormat),
 		To:           to,
@@ -240,7 +461,7 @@ type Actor struct {
 	ManuallyApprovesFollowers bool               `json:"manuallyApprovesFollowers"`
 	Icon                      Image              `json:"icon,omitempty"`
 	Attachment                []SchemaAttachment `json:"attachment,omitempty"`
-	PublicKey                 PublicKey          `json:"publicKey,omitempty"`
+	PublicKey                 PublicKeys         `json:"publicKey,omitempty"`
 }
 
 // An ActorLike is an interface for types that can be actors (they have
@@ -254,37 +475,50 @@ type ActorLike interface {
 }
 
 // ActorID gets the ID of the actor.
-func ActorID(_ ActorLike) string {
-	return fmt.Sprintf("https://%s", Domain)
+//
+// The default user's actor lives at the root of the domain, which is where it
+// lived before multiple users were supported. Other users' actors live at
+// "/~{username}".
+func (s Site) ActorID(actor ActorLike) string {
+	if actor.GetUsername() == s.DefaultUser {
+		return s.BaseURL
+	}
+
+	return fmt.Sprintf("%s/~%s", s.BaseURL, actor.GetUsername())
 }
 
 // ActorOutbox gets the outbox of the actor.
-func ActorOutbox(_ ActorLike) string {
-	return fmt.Sprintf("https://%s/outbox", Domain)
+func (s Site) ActorOutbox(actor ActorLike) string {
+	return s.ActorID(actor) + "/outbox"
 }
 
 // ActorFollowers gets the followers collection of the actor.
-func ActorFollowers(_ ActorLike) string {
-	return fmt.Sprintf("https://%s/followers", Domain)
+func (s Site) ActorFollowers(actor ActorLike) string {
+	return s.ActorID(actor) + "/followers"
 }
 
 // ActorFollowing gets the following collection of the actor.
-func ActorFollowing(_ ActorLike) string {
-	return fmt.Sprintf("https://%s/following", Domain)
+func (s Site) ActorFollowing(actor ActorLike) string {
+	return s.ActorID(actor) + "/following"
 }
 
 // ActorInbox gets the inbox of the actor.
-func ActorInbox(_ ActorLike) string {
-	return fmt.Sprintf("https://%s/inbox", Domain)
+func (s Site) ActorInbox(actor ActorLike) string {
+	return s.ActorID(actor) + "/inbox"
 }
 
-// ActorPublicKeyID gets the ID of the public key of the actor.
-func ActorPublicKeyID(actor ActorLike) string {
-	return ActorID(actor) + "#main-key"
+// ActorPublicKeyID gets the ID of the given version of the public key of the
+// actor.
+//
+// Each key version has its own dereferenceable ID, so that requests signed with
+// a key that has since been rotated can still be verified.
+func (s Site) ActorPublicKeyID(actor ActorLike, version int) string {
+	return fmt.Sprintf("%s/keys/%d", s.ActorID(actor), version)
 }
 
-// ActorFromUser gets an actor from a system user.
-func ActorFromUser(user ActorLike, pubKey identity.SigningKey) (Actor, error) {
+// ActorFromUser gets an actor from a system user, with the given public keys,
+// newest first.
+func (s Site) ActorFromUser(user ActorLike, pubKeys ...identity.SigningKey) (Actor, error) {
 	username := user.GetUsername()
 
 	var icon Image
@@ -311,29 +545,40 @@ func ActorFromUser(user ActorLike, pubKey identity.SigningKey) (Actor, error) {
 		}
 	}
 
+	publicKeys := make(PublicKeys, len(pubKeys))
+	for i, pubKey := range pubKeys {
+		publicKeys[i] = s.NewPublicKey(user, pubKey)
+	}
+
 	return Actor{
 		Context:                   NewContext(ActivityStreamsContext, SecurityContext),
 		Type:                      "Person",
-		ID:                        ActorID(user),
-		Inbox:                     ActorInbox(user),
-		Outbox:                    ActorOutbox(user),
-		Followers:                 ActorFollowers(user),
-		Following:                 ActorFollowing(user),
+		ID:                        s.ActorID(user),
+		Inbox:                     s.ActorInbox(user),
+		Outbox:                    s.ActorOutbox(user),
+		Followers:                 s.ActorFollowers(user),
+		Following:                 s.ActorFollowing(user),
 		PreferredUsername:         username,
 		Name:                      user.GetName(),
 		Summary:                   user.GetSummary(),
+		URL:                       s.ActorID(user), // Browsers are shown a profile page at the actor's ID.
 		Icon:                      icon,
 		Discoverable:              true,
 		ManuallyApprovesFollowers: false,
 		Attachment:                attachment,
-		PublicKey: PublicKey{
-			ID:           ActorPublicKeyID(user),
-			Owner:        ActorID(user),
-			PublicKeyPem: pubKey.PEM,
-		},
+		PublicKey:                 publicKeys,
 	}, nil
 }
 
+// NewPublicKey creates a new PublicKey for the given actor's signing key.
+func (s Site) NewPublicKey(actor ActorLike, pubKey identity.SigningKey) PublicKey {
+	return PublicKey{
+		ID:           s.ActorPublicKeyID(actor, pubKey.Version),
+		Owner:        s.ActorID(actor),
+		PublicKeyPem: pubKey.PEM,
+	}
+}
+
 // A SchemaAttachment is a http://schema.org#PropertyValue.
 type SchemaAttachment struct {
 	Type  string `json:"type"`
@@ -0,0 +1,52 @@
+package activitypub
+
+import (
+	"errors"
+	"fmt"
+)
+
+// A Visibility describes who may see a note, as in Mastodon, and determines
+// how the note is addressed.
+type Visibility string
+
+const (
+	// VisibilityPublic notes are addressed to everyone, and are listed in the
+	// public outbox.
+	VisibilityPublic Visibility = "public"
+
+	// VisibilityUnlisted notes are addressed to followers, and may be seen by
+	// anyone, but are not listed in the public outbox.
+	VisibilityUnlisted Visibility = "unlisted"
+
+	// VisibilityFollowers notes are addressed only to followers.
+	VisibilityFollowers Visibility = "followers"
+
+	// VisibilityDirect notes are addressed only to the mentioned actors.
+	VisibilityDirect Visibility = "direct"
+)
+
+// ErrNoMentions is returned by Addressing for a direct note which mentions no
+// one.
+var ErrNoMentions = errors.New("direct notes must mention at least one actor")
+
+// Addressing returns the "to" and "cc" of a note with the visibility by the
+// actor whose followers collection is followers, which is also addressed to
+// each of the mentioned actor IDs.
+func (v Visibility) Addressing(followers string, mentions []string) (to, cc []string, err error) {
+	switch v {
+	case VisibilityPublic:
+		return []string{PublicNS}, append([]string{followers}, mentions...), nil
+	case VisibilityUnlisted:
+		return []string{followers}, append([]string{PublicNS}, mentions...), nil
+	case VisibilityFollowers:
+		return []string{followers}, mentions, nil
+	case VisibilityDirect:
+		if len(mentions) == 0 {
+			return nil, nil, ErrNoMentions
+		}
+
+		return mentions, nil, nil
+	default:
+		return nil, nil, fmt.Errorf("unknown visibility: %q", v)
+	}
+}
@@ -0,0 +1,247 @@
+// Package analytics records page views without cookies or personal data.
+//
+// Each view is reduced to its path and the host of its referrer, and views
+// are counted per day rather than stored individually, so no view can be
+// traced back to a visitor.
+package analytics
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Masterminds/squirrel"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// flushInterval is how often counted views are written to Postgres.
+const flushInterval = 30 * time.Second
+
+// botPatterns identify crawlers by their user agent.
+var botPatterns = []string{"bot", "crawler", "spider", "slurp", "preview", "fetch", "curl", "wget"} //nolint:gochecknoglobals
+
+type viewKey struct {
+	day      time.Time
+	path     string
+	referrer string
+}
+
+// A Recorder counts page views and periodically writes the counts to
+// Postgres.
+type Recorder struct {
+	pool *pgxpool.Pool
+	sql  squirrel.StatementBuilderType
+	host string
+
+	mu      sync.Mutex
+	pending map[viewKey]int
+}
+
+// New returns a new Recorder. Referrers from the given host are not recorded,
+// since they are navigation within the site.
+func New(pool *pgxpool.Pool, host string) *Recorder {
+	return &Recorder{
+		pool:    pool,
+		sql:     squirrel.StatementBuilder.PlaceholderFormat(squirrel.Dollar),
+		host:    host,
+		pending: make(map[viewKey]int),
+	}
+}
+
+// Middleware counts successful GET requests for HTML pages by visitors other
+// than crawlers.
+func (rec *Recorder) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet || IsBot(r.UserAgent()) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+		next.ServeHTTP(ww, r)
+
+		if ww.Status() != http.StatusOK || !strings.HasPrefix(ww.Header().Get("Content-Type"), "text/html") {
+			return
+		}
+
+		rec.count(viewKey{
+			day:      time.Now().UTC().Truncate(24 * time.Hour),
+			path:     r.URL.Path,
+			referrer: rec.referrer(r),
+		})
+	})
+}
+
+func (rec *Recorder) count(key viewKey) {
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+
+	rec.pending[key]++
+}
+
+// referrer returns the host of the request's referrer, if it is another site.
+func (rec *Recorder) referrer(r *http.Request) string {
+	u, err := url.Parse(r.Referer())
+	if err != nil || u.Host == rec.host {
+		return ""
+	}
+
+	return strings.TrimPrefix(u.Hostname(), "www.")
+}
+
+// IsBot returns true if a user agent is a crawler's, or is missing, as
+// crawlers' often are.
+func IsBot(userAgent string) bool {
+	if userAgent == "" {
+		return true
+	}
+
+	userAgent = strings.ToLower(userAgent)
+
+	for _, pattern := range botPatterns {
+		if strings.Contains(userAgent, pattern) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Run writes counted views to Postgres periodically until ctx is done. Views
+// counted since the last write should then be written with Flush.
+func (rec *Recorder) Run(ctx context.Context) {
+	ticker := time.NewTicker(flushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if err := rec.Flush(ctx); err != nil {
+				slog.ErrorContext(ctx, "error recording page views", "error", err)
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// Flush writes the views counted since the last write to Postgres.
+func (rec *Recorder) Flush(ctx context.Context) error {
+	rec.mu.Lock()
+	pending := rec.pending
+	rec.pending = make(map[viewKey]int)
+	rec.mu.Unlock()
+
+	if len(pending) == 0 {
+		return nil
+	}
+
+	insert := rec.sql.
+		Insert(pageViewsTable).
+		Columns(pageViewsDayColumn, pageViewsPathColumn, pageViewsReferrerColumn, pageViewsViewsColumn).
+		Suffix("ON CONFLICT (" + pageViewsDayColumn + ", " + pageViewsPathColumn + ", " + pageViewsReferrerColumn + ") " +
+			"DO UPDATE SET " + pageViewsViewsColumn + " = " + pageViewsTable + "." + pageViewsViewsColumn + " + EXCLUDED." + pageViewsViewsColumn)
+
+	for key, views := range pending {
+		insert = insert.Values(key.day, key.path, key.referrer, views)
+	}
+
+	query, args, err := insert.ToSql()
+	if err != nil {
+		return fmt.Errorf("could not build query: %w", err)
+	}
+
+	if _, err := rec.pool.Exec(ctx, query, args...); err != nil {
+		return fmt.Errorf("could not insert page views: %w", err)
+	}
+
+	return nil
+}
+
+// A Count is the number of views of a path, or from a referrer.
+type Count struct {
+	Name  string `json:"name"`
+	Views int    `json:"views"`
+}
+
+// A Summary totals the views recorded in a period.
+type Summary struct {
+	Since     time.Time `json:"since"`
+	Views     int       `json:"views"`
+	Paths     []Count   `json:"paths"`
+	Referrers []Count   `json:"referrers"`
+}
+
+// Summarize totals the views recorded on or after the given day, most viewed
+// first. Views which have not yet been written are not included.
+func (rec *Recorder) Summarize(ctx context.Context, since time.Time) (Summary, error) {
+	summary := Summary{Since: since.UTC().Truncate(24 * time.Hour)}
+
+	for column, counts := range map[string]*[]Count{
+		pageViewsPathColumn:     &summary.Paths,
+		pageViewsReferrerColumn: &summary.Referrers,
+	} {
+		list, err := rec.countBy(ctx, column, summary.Since)
+		if err != nil {
+			return Summary{}, err
+		}
+
+		*counts = list
+	}
+
+	for _, count := range summary.Paths {
+		summary.Views += count.Views
+	}
+
+	return summary, nil
+}
+
+func (rec *Recorder) countBy(ctx context.Context, column string, since time.Time) ([]Count, error) {
+	query, args, err := rec.sql.
+		Select(column, "SUM("+pageViewsViewsColumn+")").
+		From(pageViewsTable).
+		Where(squirrel.GtOrEq{pageViewsDayColumn: since}).
+		Where(squirrel.NotEq{column: ""}).
+		GroupBy(column).
+		OrderBy("2 DESC", column).
+		ToSql()
+	if err != nil {
+		return nil, fmt.Errorf("could not build query: %w", err)
+	}
+
+	rows, err := rec.pool.Query(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("could not query page views: %w", err)
+	}
+
+	defer rows.Close()
+
+	counts := []Count{}
+
+	for rows.Next() {
+		var count Count
+		if err := rows.Scan(&count.Name, &count.Views); err != nil {
+			return nil, fmt.Errorf("could not scan page views: %w", err)
+		}
+
+		counts = append(counts, count)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("could not read page views: %w", err)
+	}
+
+	return counts, nil
+}
+
+const pageViewsTable = "page_views"
+const pageViewsDayColumn = "day"
+const pageViewsPathColumn = "path"
+const pageViewsReferrerColumn = "referrer"
+const pageViewsViewsColumn = "views"
@@ -0,0 +1,376 @@
+// Package bench measures how quickly a note is delivered to many followers, so
+// that the delivery queue's worker pool can be sized before there are that
+// many followers.
+//
+// FanOut starts fake instances on loopback addresses, each hosting some of the
+// followers' actors and inboxes, publishes a note to them, and works the
+// delivery jobs with a pool of workers, as the delivery queue would. Users,
+// notes, and jobs are kept in memory, so the database's share of the queue's
+// overhead is not measured, and failed deliveries are not retried.
+package bench
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	ap "github.com/jclem/jclem.me/internal/activitypub"
+	"github.com/jclem/jclem.me/internal/activitypub/identity"
+	"github.com/jclem/jclem.me/internal/telemetry"
+	"github.com/jclem/jclem.me/internal/www/config"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+)
+
+// Options configure a fan-out.
+type Options struct {
+	// Followers is the number of followers, spread evenly across Hosts fake
+	// instances.
+	Followers int
+	Hosts     int
+
+	// Workers is the number of deliveries worked at once, as the delivery
+	// queue's QueueDeliveryWorkers.
+	Workers int
+
+	// Latency is how long each inbox takes to respond, and FailureRate is the
+	// fraction of deliveries to which it responds with 503 Service
+	// Unavailable.
+	Latency     time.Duration
+	FailureRate float64
+}
+
+// ErrInvalidOptions is returned by FanOut if there are no followers, hosts, or
+// workers, or if the failure rate is not between 0 and 1.
+var ErrInvalidOptions = errors.New("invalid fan-out options")
+
+// A Result reports how a fan-out went. Durations are in milliseconds.
+type Result struct {
+	Followers int `json:"followers"`
+	Hosts     int `json:"hosts"`
+	Workers   int `json:"workers"`
+
+	// Delivered counts deliveries to which an inbox responded with 2xx, and
+	// Failed counts the others.
+	Delivered int `json:"delivered"`
+	Failed    int `json:"failed"`
+
+	// EnqueueMillis is how long publishing the note, which enqueues a delivery
+	// for each follower, took. ElapsedMillis is how long it took from then
+	// until the last delivery finished.
+	EnqueueMillis float64 `json:"enqueue_ms"`
+	ElapsedMillis float64 `json:"elapsed_ms"`
+
+	// Throughput is the number of deliveries finished per second.
+	Throughput float64 `json:"deliveries_per_second"`
+
+	// QueueLatency is how long deliveries waited, from when the note was
+	// published until a worker started them. DeliveryLatency is how long
+	// working them took.
+	QueueLatency    Latency `json:"queue_latency"`
+	DeliveryLatency Latency `json:"delivery_latency"`
+
+	// Requests counts the requests each fake instance received, by its host,
+	// which are the fetches of its followers' actors and the deliveries to
+	// their inboxes.
+	Requests map[string]Requests `json:"requests"`
+
+	// SharedInboxRequests is the number of deliveries which would have been
+	// made if each instance had been delivered to once, at its shared inbox,
+	// rather than once for each follower.
+	SharedInboxRequests int `json:"shared_inbox_requests"`
+}
+
+// Requests count the requests which a fake instance received.
+type Requests struct {
+	Actors  int `json:"actors"`
+	Inboxes int `json:"inboxes"`
+}
+
+// Latency summarizes the distribution of a latency, in milliseconds.
+type Latency struct {
+	P50 float64 `json:"p50_ms"`
+	P90 float64 `json:"p90_ms"`
+	P99 float64 `json:"p99_ms"`
+	Max float64 `json:"max_ms"`
+}
+
+// FanOut publishes a note by a new user to followers on fake instances, and
+// works its deliveries, returning how long they took.
+//
+// While it runs, telemetry.HTTPClient trusts the fake instances, so it must not
+// run alongside anything else which makes requests with it.
+func FanOut(ctx context.Context, cfg config.Config, opts Options) (Result, error) {
+	if opts.Followers < 1 || opts.Hosts < 1 || opts.Workers < 1 || opts.FailureRate < 0 || opts.FailureRate > 1 {
+		return Result{}, ErrInvalidOptions
+	}
+
+	hosts := make([]*host, min(opts.Hosts, opts.Followers))
+	for i := range hosts {
+		hosts[i] = newHost(opts)
+		defer hosts[i].srv.Close()
+	}
+
+	restore := trust(hosts[0].srv)
+	defer restore()
+
+	// Deliveries which fail for the last time would emit webhooks.
+	cfg.WebhookURL = ""
+	cfg.WebhookEvents = nil
+
+	id := identity.NewServiceWithStore(identity.NewMemoryStore())
+	store := ap.NewMemoryStore()
+	pub := ap.NewServiceWithStore(cfg, store)
+
+	user, _, err := id.CreateUser(ctx, identity.NewUser{Username: "bench", Name: "Bench"})
+	if err != nil {
+		return Result{}, fmt.Errorf("error creating user: %w", err)
+	}
+
+	for i := 0; i < opts.Followers; i++ {
+		actorID := hosts[i%len(hosts)].actorID(i)
+		if _, err := pub.CreateFollower(ctx, user.ID, actorID, actorID+"#follow"); err != nil {
+			return Result{}, fmt.Errorf("error creating follower: %w", err)
+		}
+	}
+
+	started := time.Now()
+
+	if err := publish(ctx, pub, user); err != nil {
+		return Result{}, err
+	}
+
+	enqueued := time.Now()
+	workers := work(ctx, pub, id, store, started, opts.Workers)
+	finished := time.Now()
+
+	result := Result{
+		Followers:           opts.Followers,
+		Hosts:               len(hosts),
+		Workers:             opts.Workers,
+		EnqueueMillis:       millis(enqueued.Sub(started)),
+		ElapsedMillis:       millis(finished.Sub(started)),
+		Requests:            map[string]Requests{},
+		SharedInboxRequests: len(hosts),
+	}
+
+	var waits, durations []time.Duration
+
+	for _, w := range workers {
+		result.Delivered += w.delivered
+		result.Failed += w.failed
+		waits = append(waits, w.waits...)
+		durations = append(durations, w.durations...)
+	}
+
+	result.Throughput = float64(result.Delivered+result.Failed) / finished.Sub(started).Seconds()
+	result.QueueLatency = summarize(waits)
+	result.DeliveryLatency = summarize(durations)
+
+	for _, h := range hosts {
+		result.Requests[h.domain()] = h.requests()
+	}
+
+	return result, nil
+}
+
+// publish publishes a public note by the user, which enqueues its delivery to
+// each of the user's followers.
+func publish(ctx context.Context, pub *ap.Service, user identity.User) error {
+	site := pub.Site()
+	note := ap.NewNote(site, user, "<p>Hello, followers</p>", []string{ap.PublicNS}, []string{site.ActorFollowers(user)})
+	activity := ap.NewCreateActivity(site, user, note, note.Published, note.To, note.Cc)
+
+	data, err := json.Marshal(activity)
+	if err != nil {
+		return fmt.Errorf("error encoding activity: %w", err)
+	}
+
+	if _, err := pub.CreateActivity(ctx, user.ID, ap.Outbox, ap.ActivityStreamsContext, activity.Type, activity.ID, data); err != nil {
+		return fmt.Errorf("error publishing note: %w", err)
+	}
+
+	return nil
+}
+
+// A worker records the deliveries it worked.
+type worker struct {
+	delivered int
+	failed    int
+	waits     []time.Duration
+	durations []time.Duration
+}
+
+// work works the store's delivery jobs with n workers at once, until there are
+// none left.
+func work(ctx context.Context, pub *ap.Service, id *identity.Service, store *ap.MemoryStore, enqueued time.Time, n int) []*worker {
+	workers := make([]*worker, n)
+
+	var wg sync.WaitGroup
+
+	for i := range workers {
+		w := &worker{}
+		workers[i] = w
+
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			for {
+				args, ok := store.NextJob()
+				if !ok {
+					return
+				}
+
+				if _, ok := args.(ap.HandleOutboxArgs); !ok {
+					continue
+				}
+
+				start := time.Now()
+				err := pub.WorkJob(ctx, id, args)
+
+				w.waits = append(w.waits, start.Sub(enqueued))
+				w.durations = append(w.durations, time.Since(start))
+
+				if err != nil {
+					w.failed++
+				} else {
+					w.delivered++
+				}
+			}
+		}()
+	}
+
+	wg.Wait()
+
+	return workers
+}
+
+// summarize returns the percentiles of the given durations.
+func summarize(durations []time.Duration) Latency {
+	if len(durations) == 0 {
+		return Latency{}
+	}
+
+	slices.Sort(durations)
+
+	at := func(p float64) float64 {
+		return millis(durations[int(p*float64(len(durations)-1))])
+	}
+
+	return Latency{P50: at(0.5), P90: at(0.9), P99: at(0.99), Max: at(1)}
+}
+
+func millis(d time.Duration) float64 {
+	return float64(d.Microseconds()) / 1000
+}
+
+// trust makes telemetry.HTTPClient trust the fake instances, which share a
+// certificate, returning a function which restores its transport. Its
+// connection pool is otherwise configured as in production.
+func trust(srv *httptest.Server) func() {
+	roots := x509.NewCertPool()
+	roots.AddCert(srv.Certificate())
+
+	transport := http.DefaultTransport.(*http.Transport).Clone() //nolint:forcetypeassert
+	transport.TLSClientConfig.RootCAs = roots
+
+	previous := telemetry.HTTPClient.Transport
+	telemetry.HTTPClient.Transport = otelhttp.NewTransport(transport)
+
+	return func() { telemetry.HTTPClient.Transport = previous }
+}
+
+// A host is a fake instance, which serves followers' actors and inboxes.
+type host struct {
+	srv  *httptest.Server
+	opts Options
+
+	mu     sync.Mutex
+	counts Requests
+}
+
+func newHost(opts Options) *host {
+	h := &host{opts: opts}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/users/", h.serveUser)
+	mux.HandleFunc("/inbox", h.serveInbox)
+
+	h.srv = httptest.NewTLSServer(mux)
+
+	return h
+}
+
+func (h *host) domain() string {
+	return strings.TrimPrefix(h.srv.URL, "https://")
+}
+
+func (h *host) actorID(i int) string {
+	return fmt.Sprintf("%s/users/follower-%d", h.srv.URL, i)
+}
+
+func (h *host) requests() Requests {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	return h.counts
+}
+
+// serveUser serves a follower's actor, or its inbox.
+func (h *host) serveUser(w http.ResponseWriter, r *http.Request) {
+	if strings.HasSuffix(r.URL.Path, "/inbox") {
+		h.serveInbox(w, r)
+		return
+	}
+
+	h.mu.Lock()
+	h.counts.Actors++
+	h.mu.Unlock()
+
+	actorID := h.srv.URL + r.URL.Path
+
+	w.Header().Set("Content-Type", ap.ContentType)
+	json.NewEncoder(w).Encode(map[string]any{ //nolint:errcheck,errchkjson
+		"@context":  ap.ActivityStreamsContext,
+		"type":      "Person",
+		"id":        actorID,
+		"inbox":     actorID + "/inbox",
+		"endpoints": map[string]string{"sharedInbox": h.srv.URL + "/inbox"},
+	})
+}
+
+// serveInbox accepts a delivery after the configured latency, or fails it at
+// the configured rate.
+func (h *host) serveInbox(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	h.mu.Lock()
+	h.counts.Inboxes++
+	h.mu.Unlock()
+
+	select {
+	case <-time.After(h.opts.Latency):
+	case <-r.Context().Done():
+		return
+	}
+
+	if rand.Float64() < h.opts.FailureRate { //nolint:gosec
+		w.WriteHeader(http.StatusServiceUnavailable)
+		return
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+}
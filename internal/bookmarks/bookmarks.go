@@ -0,0 +1,228 @@
+// Package bookmarks stores annotated links to other sites, which are shared
+// on the site's link blog.
+package bookmarks
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"html/template"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/Masterminds/squirrel"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/jclem/jclem.me/internal/database"
+	"github.com/jclem/jclem.me/internal/markdown"
+)
+
+// DefaultLimit is the number of bookmarks listed if no limit is given.
+const DefaultLimit = 50
+
+// ErrInvalidURL is returned when creating a bookmark of a URL which is not an
+// absolute HTTP(S) URL.
+var ErrInvalidURL = errors.New("invalid url")
+
+// ErrMissingTitle is returned when creating a bookmark without a title.
+var ErrMissingTitle = errors.New("missing title")
+
+// ErrBookmarkNotFound is returned when a bookmark is not found.
+var ErrBookmarkNotFound = errors.New("bookmark not found")
+
+// A Bookmark is a link to another site with a comment about it.
+type Bookmark struct {
+	ID     database.ULID `json:"id"`
+	Author string        `json:"author"`
+	URL    string        `json:"url"`
+	Title  string        `json:"title"`
+
+	// Comment is the Markdown source of the comment, and Content is the
+	// comment rendered to HTML.
+	Comment string        `json:"comment"`
+	Content template.HTML `json:"content"`
+
+	Tags []string `json:"tags"`
+
+	// NoteID is the ID of the ActivityPub note which shared the bookmark, if
+	// it was federated.
+	NoteID string `json:"note_id,omitempty"`
+
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Host returns the host of the bookmarked URL, without any "www." prefix.
+func (b Bookmark) Host() string {
+	u, err := url.Parse(b.URL)
+	if err != nil {
+		return ""
+	}
+
+	return strings.TrimPrefix(u.Hostname(), "www.")
+}
+
+// NewBookmark is the input for creating a bookmark. The comment is Markdown.
+type NewBookmark struct {
+	Author  string   `json:"author"`
+	URL     string   `json:"url"`
+	Title   string   `json:"title"`
+	Comment string   `json:"comment"`
+	Tags    []string `json:"tags"`
+}
+
+// A Service stores bookmarks in Postgres.
+type Service struct {
+	pool *pgxpool.Pool
+	sql  squirrel.StatementBuilderType
+}
+
+// New creates a new Service.
+func New(pool *pgxpool.Pool) *Service {
+	return &Service{
+		pool: pool,
+		sql:  squirrel.StatementBuilder.PlaceholderFormat(squirrel.Dollar),
+	}
+}
+
+// Create creates a bookmark.
+func (s *Service) Create(ctx context.Context, input NewBookmark) (Bookmark, error) {
+	if u, err := url.Parse(input.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return Bookmark{}, ErrInvalidURL
+	}
+
+	if strings.TrimSpace(input.Title) == "" {
+		return Bookmark{}, ErrMissingTitle
+	}
+
+	doc, err := markdown.Render([]byte(input.Comment))
+	if err != nil {
+		return Bookmark{}, fmt.Errorf("could not render comment: %w", err)
+	}
+
+	tags := make([]string, 0, len(input.Tags))
+	for _, tag := range input.Tags {
+		if tag = strings.ToLower(strings.TrimSpace(tag)); tag != "" {
+			tags = append(tags, tag)
+		}
+	}
+
+	query, args, err := s.sql.
+		Insert(bookmarksTable).
+		Columns(bookmarksIDColumn, bookmarksAuthorColumn, bookmarksURLColumn, bookmarksTitleColumn, bookmarksCommentColumn, bookmarksContentColumn, bookmarksTagsColumn).
+		Values(database.NewULID(), input.Author, input.URL, input.Title, input.Comment, doc.Content, tags).
+		Suffix("RETURNING " + strings.Join(bookmarksFields, ", ")).
+		ToSql()
+	if err != nil {
+		return Bookmark{}, fmt.Errorf("could not build query: %w", err)
+	}
+
+	rows, err := s.pool.Query(ctx, query, args...)
+	if err != nil {
+		return Bookmark{}, fmt.Errorf("could not create bookmark: %w", err)
+	}
+
+	bookmark, err := pgx.CollectExactlyOneRow(rows, scanBookmark)
+	if err != nil {
+		return Bookmark{}, fmt.Errorf("could not create bookmark: %w", err)
+	}
+
+	return bookmark, nil
+}
+
+// SetNoteID records the ID of the note which shared a bookmark.
+func (s *Service) SetNoteID(ctx context.Context, id database.ULID, noteID string) error {
+	query, args, err := s.sql.
+		Update(bookmarksTable).
+		Set(bookmarksNoteIDColumn, noteID).
+		Where(squirrel.Eq{bookmarksIDColumn: id}).
+		ToSql()
+	if err != nil {
+		return fmt.Errorf("could not build query: %w", err)
+	}
+
+	tag, err := s.pool.Exec(ctx, query, args...)
+	if err != nil {
+		return fmt.Errorf("could not update bookmark: %w", err)
+	}
+
+	if tag.RowsAffected() == 0 {
+		return ErrBookmarkNotFound
+	}
+
+	return nil
+}
+
+// List returns the most recent bookmarks by the given author, most recent
+// first.
+func (s *Service) List(ctx context.Context, author string, limit int) ([]Bookmark, error) {
+	if limit <= 0 {
+		limit = DefaultLimit
+	}
+
+	query, args, err := s.sql.
+		Select(bookmarksFields...).
+		From(bookmarksTable).
+		Where(squirrel.Eq{bookmarksAuthorColumn: author}).
+		OrderBy(bookmarksIDColumn + " DESC").
+		Limit(uint64(limit)).
+		ToSql()
+	if err != nil {
+		return nil, fmt.Errorf("could not build query: %w", err)
+	}
+
+	rows, err := s.pool.Query(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("could not query bookmarks: %w", err)
+	}
+
+	bookmarks, err := pgx.CollectRows(rows, scanBookmark)
+	if err != nil {
+		return nil, fmt.Errorf("could not scan bookmarks: %w", err)
+	}
+
+	return bookmarks, nil
+}
+
+func scanBookmark(row pgx.CollectableRow) (Bookmark, error) {
+	var (
+		b       Bookmark
+		content string
+		noteID  *string
+	)
+
+	if err := row.Scan(&b.ID, &b.Author, &b.URL, &b.Title, &b.Comment, &content, &b.Tags, &noteID, &b.CreatedAt); err != nil {
+		return Bookmark{}, fmt.Errorf("could not scan bookmark: %w", err)
+	}
+
+	b.Content = template.HTML(content) //nolint:gosec
+
+	if noteID != nil {
+		b.NoteID = *noteID
+	}
+
+	return b, nil
+}
+
+const bookmarksTable = "bookmarks"
+const bookmarksIDColumn = "id"
+const bookmarksAuthorColumn = "author"
+const bookmarksURLColumn = "url"
+const bookmarksTitleColumn = "title"
+const bookmarksCommentColumn = "comment"
+const bookmarksContentColumn = "content"
+const bookmarksTagsColumn = "tags"
+const bookmarksNoteIDColumn = "note_id"
+const bookmarksCreatedAtColumn = "created_at"
+
+var bookmarksFields = []string{ //nolint:gochecknoglobals
+	bookmarksIDColumn,
+	bookmarksAuthorColumn,
+	bookmarksURLColumn,
+	bookmarksTitleColumn,
+	bookmarksCommentColumn,
+	bookmarksContentColumn,
+	bookmarksTagsColumn,
+	bookmarksNoteIDColumn,
+	bookmarksCreatedAtColumn,
+}
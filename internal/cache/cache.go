@@ -0,0 +1,78 @@
+// Package cache provides a simple in-memory cache with expiring entries.
+package cache
+
+import (
+	"sync"
+	"time"
+)
+
+// A Cache is a concurrency-safe map whose entries expire after a fixed TTL.
+type Cache[K comparable, V any] struct {
+	mu    sync.RWMutex
+	ttl   time.Duration
+	items map[K]entry[V]
+}
+
+type entry[V any] struct {
+	value     V
+	expiresAt time.Time
+}
+
+// New creates a new Cache whose entries expire after the given TTL.
+func New[K comparable, V any](ttl time.Duration) *Cache[K, V] {
+	return &Cache[K, V]{
+		ttl:   ttl,
+		items: make(map[K]entry[V]),
+	}
+}
+
+// Get returns the value for the given key, if it is present and unexpired.
+func (c *Cache[K, V]) Get(key K) (V, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	e, ok := c.items[key]
+	if !ok || time.Now().After(e.expiresAt) {
+		var zero V
+		return zero, false
+	}
+
+	return e.value, true
+}
+
+// Set sets the value for the given key.
+func (c *Cache[K, V]) Set(key K, value V) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+
+	// Expired entries are only removed on writes, which keeps reads cheap.
+	for k, e := range c.items {
+		if now.After(e.expiresAt) {
+			delete(c.items, k)
+		}
+	}
+
+	c.items[key] = entry[V]{value: value, expiresAt: now.Add(c.ttl)}
+}
+
+// Delete removes the value for the given key.
+func (c *Cache[K, V]) Delete(key K) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	delete(c.items, key)
+}
+
+// DeleteFunc removes every entry for which del returns true.
+func (c *Cache[K, V]) DeleteFunc(del func(K, V) bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for k, e := range c.items {
+		if del(k, e.value) {
+			delete(c.items, k)
+		}
+	}
+}
@@ -0,0 +1,110 @@
+// Package client calls the site's authenticated ActivityPub API, such as to
+// post notes from a terminal.
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	ap "github.com/jclem/jclem.me/internal/activitypub"
+	"github.com/jclem/jclem.me/internal/telemetry"
+)
+
+// maxErrorBody is the most of an error response's body which is read.
+const maxErrorBody = 64 << 10
+
+// A Client calls the API as the user whose API key it has.
+type Client struct {
+	// baseURL is the URL under which ActivityPub is served, such as
+	// "https://pub.jclem.me" or "http://localhost:8080/pub".
+	baseURL string
+	apiKey  string
+	http    *http.Client
+
+	// site is the Site from which the server builds actor IDs, which may be
+	// served under a different base URL than baseURL.
+	site ap.Site
+}
+
+// New creates a Client which calls the API served under baseURL with apiKey,
+// on behalf of actors of site.
+func New(site ap.Site, baseURL, apiKey string) *Client {
+	return &Client{baseURL: strings.TrimSuffix(baseURL, "/"), apiKey: apiKey, http: telemetry.HTTPClient, site: site}
+}
+
+// An Error is an error response from the API.
+type Error struct {
+	Status int
+	Title  string `json:"title"`
+	Detail string `json:"detail"`
+	Errors []struct {
+		Field   string `json:"field"`
+		Message string `json:"message"`
+	} `json:"errors"`
+}
+
+func (e *Error) Error() string {
+	msg := fmt.Sprintf("%d %s", e.Status, e.Title)
+	if e.Detail != "" {
+		msg += ": " + e.Detail
+	}
+
+	for _, fe := range e.Errors {
+		msg += fmt.Sprintf("; %s: %s", fe.Field, fe.Message)
+	}
+
+	return msg
+}
+
+// PostNote publishes a note by the actor, addressed by its To and Cc, and
+// returns the activity which created it.
+func (c *Client) PostNote(ctx context.Context, actor ap.ActorLike, note ap.Note) (*ap.Activity[ap.Note], error) {
+	note.Context = ap.NewContext(ap.ActivityStreamsContext, ap.MastodonContext)
+	note.Type = "Note"
+
+	body, err := json.Marshal(note)
+	if err != nil {
+		return nil, fmt.Errorf("error encoding note: %w", err)
+	}
+
+	// Paths are the same under every base URL, but actor IDs use the
+	// configured one.
+	path := strings.TrimPrefix(c.site.ActorOutbox(actor), c.site.BaseURL)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.baseURL+path, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("error creating request: %w", err)
+	}
+
+	req.Header.Set("Content-Type", ap.ContentType)
+	req.Header.Set("Accept", ap.ContentType)
+	req.Header.Set("Authorization", "Bearer "+c.apiKey)
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("error posting note: %w", err)
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusCreated {
+		apiErr := &Error{Status: resp.StatusCode, Title: http.StatusText(resp.StatusCode)}
+
+		b, _ := io.ReadAll(io.LimitReader(resp.Body, maxErrorBody))
+		_ = json.Unmarshal(b, apiErr)
+
+		return nil, apiErr
+	}
+
+	var activity ap.Activity[ap.Note]
+	if err := json.NewDecoder(resp.Body).Decode(&activity); err != nil {
+		return nil, fmt.Errorf("error decoding activity: %w", err)
+	}
+
+	return &activity, nil
+}
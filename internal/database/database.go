@@ -1,17 +1,22 @@
 package database
 
 import (
+	"crypto/sha256"
 	"database/sql/driver"
 	"encoding/json"
 	"fmt"
 	"strings"
+	"time"
 
+	"github.com/jackc/pgx/v5/pgtype"
 	"github.com/oklog/ulid/v2"
 )
 
 // A ULID is a wrapper around ulid.ULID that implements the sql.Scanner and
 // driver.Valuer interfaces, as well as the json.Marshaler and json.Unmarshaler
-// interfaces.
+// interfaces. It also implements pgx's pgtype.TextScanner and
+// pgtype.TextValuer interfaces, so that pgx reads and writes ULIDs, and
+// slices of them, as text directly, in either format.
 type ULID ulid.ULID
 
 // Scan implements the sql.Scanner interface.
@@ -31,6 +36,38 @@ func (u ULID) Value() (driver.Value, error) {
 	return u.String(), nil
 }
 
+// ScanText implements the pgtype.TextScanner interface. A NULL is scanned as
+// the zero ULID.
+func (u *ULID) ScanText(v pgtype.Text) error {
+	if !v.Valid {
+		*u = ULID{}
+
+		return nil
+	}
+
+	uu, err := ParseULID(v.String)
+	if err != nil {
+		return fmt.Errorf("could not scan ULID: %w", err)
+	}
+
+	*u = uu
+
+	return nil
+}
+
+// TextValue implements the pgtype.TextValuer interface.
+func (u ULID) TextValue() (pgtype.Text, error) {
+	return pgtype.Text{String: u.String(), Valid: true}, nil
+}
+
+// RegisterTypes registers ULID, and slices of ULIDs, with a connection's type
+// map, so that they are encoded as text even where pgx cannot tell a
+// parameter's type, such as with the simple protocol.
+func RegisterTypes(m *pgtype.Map) {
+	m.RegisterDefaultPgType(ULID{}, "text")
+	m.RegisterDefaultPgType([]ULID{}, "_text")
+}
+
 // MarshalJSON implements the json.Marshaler interface.
 func (u ULID) MarshalJSON() ([]byte, error) {
 	return []byte(`"` + u.String() + `"`), nil
@@ -72,3 +109,18 @@ func ParseULID(s string) (ULID, error) {
 func NewULID() ULID {
 	return ULID(ulid.Make())
 }
+
+// ULIDAt returns a ULID with the given time whose entropy is derived from key,
+// so that the same time and key always give the same ULID, such as for a
+// record imported more than once.
+func ULIDAt(t time.Time, key string) ULID {
+	var u ulid.ULID
+
+	// The time is only out of range after the year 10889.
+	_ = u.SetTime(ulid.Timestamp(t))
+
+	sum := sha256.Sum256([]byte(key))
+	_ = u.SetEntropy(sum[:10])
+
+	return ULID(u)
+}
@@ -0,0 +1,262 @@
+package database
+
+import (
+	"context"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/riverqueue/river/riverdriver/riverpgxv5"
+	"github.com/riverqueue/river/rivermigrate"
+)
+
+// migrationFiles holds the schema migrations, named "NNN_name.sql", where NNN
+// is the migration's version.
+//
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+var migrationNameRegex = regexp.MustCompile(`^(\d+)_(\w+)\.sql$`)
+
+// migrationLockID is the key of the advisory lock held while migrating, so that
+// machines which boot at once do not migrate concurrently.
+const migrationLockID = 0x6a636c656d // "jclem"
+
+// ErrInvalidMigration is returned when an embedded migration is misnamed, or
+// shares its version with another.
+var ErrInvalidMigration = errors.New("invalid migration")
+
+// A Migration is a change to the schema. Migrations are applied in order of
+// version, each in its own transaction.
+type Migration struct {
+	Version int    `json:"version"`
+	Name    string `json:"name"`
+	SQL     string `json:"-"`
+}
+
+// A MigrationStatus is a migration and when it was applied, if it has been.
+type MigrationStatus struct {
+	Migration
+	AppliedAt *time.Time `json:"applied_at"`
+}
+
+// Migrations returns the embedded migrations, in order of version.
+func Migrations() ([]Migration, error) {
+	entries, err := fs.ReadDir(migrationFiles, "migrations")
+	if err != nil {
+		return nil, fmt.Errorf("could not read migrations: %w", err)
+	}
+
+	migrations := make([]Migration, 0, len(entries))
+	versions := make(map[int]bool, len(entries))
+
+	for _, entry := range entries {
+		match := migrationNameRegex.FindStringSubmatch(entry.Name())
+		if match == nil {
+			return nil, fmt.Errorf("%w: %s", ErrInvalidMigration, entry.Name())
+		}
+
+		version, err := strconv.Atoi(match[1])
+		if err != nil || versions[version] {
+			return nil, fmt.Errorf("%w: %s", ErrInvalidMigration, entry.Name())
+		}
+
+		versions[version] = true
+
+		sql, err := fs.ReadFile(migrationFiles, path.Join("migrations", entry.Name()))
+		if err != nil {
+			return nil, fmt.Errorf("could not read migration %s: %w", entry.Name(), err)
+		}
+
+		migrations = append(migrations, Migration{Version: version, Name: match[2], SQL: string(sql)})
+	}
+
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+
+	return migrations, nil
+}
+
+// Migrate creates or updates River's job queue tables, and then applies each
+// migration which has not been applied, returning those it applied.
+func Migrate(ctx context.Context, pool *pgxpool.Pool) ([]Migration, error) {
+	var applied []Migration
+
+	err := withMigrationLock(ctx, pool, func(conn *pgxpool.Conn) error {
+		if _, err := rivermigrate.New(riverpgxv5.New(pool), nil).Migrate(ctx, rivermigrate.DirectionUp, nil); err != nil {
+			return fmt.Errorf("could not migrate job queue: %w", err)
+		}
+
+		statuses, err := migrationStatuses(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		for _, status := range statuses {
+			if status.AppliedAt != nil {
+				continue
+			}
+
+			if err := applyMigration(ctx, conn, status.Migration); err != nil {
+				return err
+			}
+
+			applied = append(applied, status.Migration)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return applied, nil
+}
+
+// Baseline records every migration up to and including the given version as
+// applied, without applying it, for databases whose schema was changed by hand
+// before migrations were tracked.
+func Baseline(ctx context.Context, pool *pgxpool.Pool, version int) error {
+	return withMigrationLock(ctx, pool, func(conn *pgxpool.Conn) error {
+		statuses, err := migrationStatuses(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		for _, status := range statuses {
+			if status.Version > version || status.AppliedAt != nil {
+				continue
+			}
+
+			if _, err := conn.Exec(ctx, insertMigrationSQL, status.Version, status.Name); err != nil {
+				return fmt.Errorf("could not record migration %d: %w", status.Version, err)
+			}
+		}
+
+		return nil
+	})
+}
+
+// Status returns every migration and when it was applied, if it has been.
+func Status(ctx context.Context, pool *pgxpool.Pool) ([]MigrationStatus, error) {
+	var statuses []MigrationStatus
+
+	err := withMigrationLock(ctx, pool, func(conn *pgxpool.Conn) error {
+		var err error
+		statuses, err = migrationStatuses(ctx, conn)
+
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return statuses, nil
+}
+
+func withMigrationLock(ctx context.Context, pool *pgxpool.Pool, fn func(*pgxpool.Conn) error) (err error) {
+	conn, err := pool.Acquire(ctx)
+	if err != nil {
+		return fmt.Errorf("could not acquire connection: %w", err)
+	}
+
+	defer conn.Release()
+
+	if _, err := conn.Exec(ctx, "SELECT pg_advisory_lock($1)", migrationLockID); err != nil {
+		return fmt.Errorf("could not lock migrations: %w", err)
+	}
+
+	defer func() {
+		if _, uerr := conn.Exec(context.Background(), "SELECT pg_advisory_unlock($1)", migrationLockID); uerr != nil && err == nil { //nolint:contextcheck
+			err = fmt.Errorf("could not unlock migrations: %w", uerr)
+		}
+	}()
+
+	if _, err := conn.Exec(ctx, createMigrationsTableSQL); err != nil {
+		return fmt.Errorf("could not create migrations table: %w", err)
+	}
+
+	return fn(conn)
+}
+
+func migrationStatuses(ctx context.Context, conn *pgxpool.Conn) ([]MigrationStatus, error) {
+	migrations, err := Migrations()
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := conn.Query(ctx, "SELECT "+migrationsVersionColumn+", "+migrationsAppliedAtColumn+" FROM "+migrationsTable)
+	if err != nil {
+		return nil, fmt.Errorf("could not query migrations: %w", err)
+	}
+
+	defer rows.Close()
+
+	appliedAt := make(map[int]time.Time)
+
+	for rows.Next() {
+		var (
+			version int
+			at      time.Time
+		)
+
+		if err := rows.Scan(&version, &at); err != nil {
+			return nil, fmt.Errorf("could not scan migration: %w", err)
+		}
+
+		appliedAt[version] = at
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("could not read migrations: %w", err)
+	}
+
+	statuses := make([]MigrationStatus, 0, len(migrations))
+
+	for _, m := range migrations {
+		status := MigrationStatus{Migration: m}
+		if at, ok := appliedAt[m.Version]; ok {
+			status.AppliedAt = &at
+		}
+
+		statuses = append(statuses, status)
+	}
+
+	return statuses, nil
+}
+
+func applyMigration(ctx context.Context, conn *pgxpool.Conn, m Migration) error {
+	return WithTx(ctx, conn, func(tx pgx.Tx) error {
+		if _, err := tx.Exec(ctx, m.SQL); err != nil {
+			return fmt.Errorf("could not apply migration %d_%s: %w", m.Version, m.Name, err)
+		}
+
+		if _, err := tx.Exec(ctx, insertMigrationSQL, m.Version, m.Name); err != nil {
+			return fmt.Errorf("could not record migration %d: %w", m.Version, err)
+		}
+
+		return nil
+	})
+}
+
+const createMigrationsTableSQL = `CREATE TABLE IF NOT EXISTS ` + migrationsTable + ` (
+	` + migrationsVersionColumn + ` integer PRIMARY KEY,
+	` + migrationsNameColumn + ` text NOT NULL,
+	` + migrationsAppliedAtColumn + ` timestamptz NOT NULL DEFAULT now()
+)`
+
+const insertMigrationSQL = `INSERT INTO ` + migrationsTable + ` (` + migrationsVersionColumn + `, ` + migrationsNameColumn + `) VALUES ($1, $2)`
+
+const migrationsTable = "schema_migrations"
+const migrationsVersionColumn = "version"
+const migrationsNameColumn = "name"
+const migrationsAppliedAtColumn = "applied_at"
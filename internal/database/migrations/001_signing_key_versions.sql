@@ -0,0 +1,6 @@
+-- Signing keys are versioned so that they can be rotated. Keys that have been
+-- rotated out remain servable until they expire.
+ALTER TABLE key_pems ADD COLUMN version integer NOT NULL DEFAULT 1;
+ALTER TABLE key_pems ADD COLUMN expires_at timestamptz;
+
+CREATE UNIQUE INDEX key_pems_user_id_kind_version_idx ON key_pems (user_id, kind, version);
@@ -0,0 +1,30 @@
+-- OAuth applications registered by third-party clients.
+CREATE TABLE oauth_apps (
+    id text PRIMARY KEY,
+    name text NOT NULL,
+    website text NOT NULL DEFAULT '',
+    client_secret text NOT NULL,
+    redirect_uris text[] NOT NULL,
+    scopes text NOT NULL DEFAULT '',
+    created_at timestamptz NOT NULL,
+    updated_at timestamptz NOT NULL
+);
+
+-- Short-lived authorization codes issued by the authorize endpoint.
+CREATE TABLE oauth_authorization_codes (
+    id text PRIMARY KEY,
+    app_id text NOT NULL REFERENCES oauth_apps (id) ON DELETE CASCADE,
+    user_id text NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    redirect_uri text NOT NULL,
+    scopes text NOT NULL DEFAULT '',
+    code_challenge text NOT NULL DEFAULT '',
+    code_challenge_method text NOT NULL DEFAULT '',
+    expires_at timestamptz NOT NULL,
+    created_at timestamptz NOT NULL,
+    updated_at timestamptz NOT NULL
+);
+
+-- Access tokens issued to OAuth applications are API keys which belong to an
+-- application.
+ALTER TABLE api_keys ADD COLUMN app_id text REFERENCES oauth_apps (id) ON DELETE CASCADE;
+ALTER TABLE api_keys ADD COLUMN scopes text NOT NULL DEFAULT '';
@@ -0,0 +1,18 @@
+-- Posts written through the authoring API. Their Markdown source is rendered
+-- to HTML when it is written. They take precedence over embedded posts with
+-- the same slug.
+CREATE TABLE posts (
+    id text PRIMARY KEY,
+    slug text NOT NULL UNIQUE,
+    author text NOT NULL,
+    title text NOT NULL,
+    summary text NOT NULL DEFAULT '',
+    source text NOT NULL,
+    content text NOT NULL,
+    tags text[] NOT NULL DEFAULT '{}',
+    has_math boolean NOT NULL DEFAULT false,
+    published boolean NOT NULL DEFAULT false,
+    published_at timestamptz,
+    created_at timestamptz NOT NULL,
+    updated_at timestamptz NOT NULL
+);
@@ -0,0 +1,2 @@
+-- Word counts are computed when a post's Markdown is rendered.
+ALTER TABLE posts ADD COLUMN word_count integer NOT NULL DEFAULT 0;
@@ -0,0 +1,4 @@
+-- Tables of contents are computed when a post's Markdown is rendered, and are
+-- only shown on posts which enable them.
+ALTER TABLE posts ADD COLUMN toc jsonb NOT NULL DEFAULT '[]';
+ALTER TABLE posts ADD COLUMN show_toc boolean NOT NULL DEFAULT false;
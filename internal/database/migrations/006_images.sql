@@ -0,0 +1,6 @@
+-- Resized variants of images in posts written through the authoring API.
+-- Variants of images in embedded posts are listed in an embedded manifest.
+CREATE TABLE images (
+    source_url text PRIMARY KEY,
+    image jsonb NOT NULL
+);
@@ -0,0 +1,8 @@
+-- Reports of broken links in posts, written by the periodic link check job.
+CREATE TABLE link_reports (
+    id bigserial PRIMARY KEY,
+    checked_at timestamptz NOT NULL,
+    report jsonb NOT NULL
+);
+
+CREATE INDEX link_reports_checked_at_idx ON link_reports (checked_at DESC);
@@ -0,0 +1,10 @@
+-- Daily counts of page views. Views are aggregated as they are recorded, so
+-- no row describes a single visit.
+CREATE TABLE page_views (
+    day date NOT NULL,
+    path text NOT NULL,
+    referrer text NOT NULL DEFAULT '',
+    country text NOT NULL DEFAULT '',
+    views integer NOT NULL,
+    PRIMARY KEY (day, path, referrer, country)
+);
@@ -0,0 +1,6 @@
+CREATE TABLE short_links (
+    code text PRIMARY KEY,
+    url text NOT NULL,
+    clicks integer NOT NULL DEFAULT 0,
+    created_at timestamptz NOT NULL DEFAULT now()
+);
@@ -0,0 +1,15 @@
+-- Annotated links shared on the link blog. IDs are ULIDs, so they sort by
+-- creation time.
+CREATE TABLE bookmarks (
+    id text PRIMARY KEY,
+    author text NOT NULL,
+    url text NOT NULL,
+    title text NOT NULL,
+    comment text NOT NULL DEFAULT '',
+    content text NOT NULL DEFAULT '',
+    tags text[] NOT NULL DEFAULT '{}',
+    note_id text,
+    created_at timestamptz NOT NULL DEFAULT now()
+);
+
+CREATE INDEX bookmarks_author_id_idx ON bookmarks (author, id DESC);
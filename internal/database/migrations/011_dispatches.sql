@@ -0,0 +1,13 @@
+-- Short, dated updates, which may carry an image. IDs are ULIDs, so they sort
+-- by creation time and serve as pagination cursors.
+CREATE TABLE dispatches (
+    id text PRIMARY KEY,
+    author text NOT NULL,
+    url text NOT NULL DEFAULT '',
+    alt text NOT NULL DEFAULT '',
+    body text NOT NULL DEFAULT '',
+    content text NOT NULL DEFAULT '',
+    inserted_at timestamptz NOT NULL DEFAULT now()
+);
+
+CREATE INDEX dispatches_author_id_idx ON dispatches (author, id DESC);
@@ -0,0 +1,2 @@
+-- The resized variants and thumbnail of an uploaded dispatch image.
+ALTER TABLE dispatches ADD COLUMN image jsonb;
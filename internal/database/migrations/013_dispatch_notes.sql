@@ -0,0 +1,2 @@
+-- The ActivityPub note which shared a dispatch, if it was federated.
+ALTER TABLE dispatches ADD COLUMN note_id text;
@@ -0,0 +1,2 @@
+-- Dispatches are filtered by date range as well as paginated by ID.
+CREATE INDEX dispatches_author_inserted_at_idx ON dispatches (author, inserted_at DESC);
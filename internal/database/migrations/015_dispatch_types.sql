@@ -0,0 +1,8 @@
+-- Each dispatch has a type. Data specific to a type, other than an image, such
+-- as a shared link or a checkin's place, is stored as JSON.
+ALTER TABLE dispatches ADD COLUMN type text NOT NULL DEFAULT 'text';
+ALTER TABLE dispatches ADD COLUMN data jsonb;
+
+UPDATE dispatches SET type = 'image' WHERE url <> '';
+
+CREATE INDEX dispatches_type_id_idx ON dispatches (type, id DESC);
@@ -0,0 +1,3 @@
+-- Whether a dispatch's image has been processed. Images are processed by a
+-- job, so a dispatch is pending until its job finishes.
+ALTER TABLE dispatches ADD COLUMN status text NOT NULL DEFAULT 'ready';
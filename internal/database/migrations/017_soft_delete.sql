@@ -0,0 +1,8 @@
+-- When a note, or the activity which created it, was deleted. Deleted rows
+-- are hidden, and are purged by a job once they have been deleted for longer
+-- than the retention window.
+ALTER TABLE notes ADD COLUMN deleted_at timestamptz;
+ALTER TABLE activities ADD COLUMN deleted_at timestamptz;
+
+CREATE INDEX notes_deleted_at_idx ON notes (deleted_at) WHERE deleted_at IS NOT NULL;
+CREATE INDEX activities_deleted_at_idx ON activities (deleted_at) WHERE deleted_at IS NOT NULL;
@@ -0,0 +1,4 @@
+-- Public outbox activities are found by containment of the public collection
+-- in their addressing, and listed most recent first.
+CREATE INDEX activities_public_idx ON activities USING gin (data jsonb_path_ops) WHERE deleted_at IS NULL;
+CREATE INDEX activities_user_id_mailbox_type_created_at_idx ON activities (user_id, mailbox, activity_type, created_at DESC) WHERE deleted_at IS NULL;
@@ -0,0 +1,8 @@
+-- An actor follows a user at most once. Duplicates inserted by follows which
+-- were delivered more than once are removed, keeping the most recent.
+DELETE FROM followers a USING followers b
+WHERE a.user_id = b.user_id
+	AND a.actor_id = b.actor_id
+	AND a.id < b.id;
+
+CREATE UNIQUE INDEX followers_user_id_actor_id_idx ON followers (user_id, actor_id);
@@ -0,0 +1,17 @@
+-- Notifications derived from activities received in users' inboxes, such as
+-- follows and replies. IDs are ULIDs, so they sort by creation time. An
+-- activity delivered more than once is notified once.
+CREATE TABLE notifications (
+    id text PRIMARY KEY,
+    user_id text NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    notification_type text NOT NULL,
+    actor_id text NOT NULL,
+    activity_id text NOT NULL,
+    object_id text NOT NULL DEFAULT '',
+    read_at timestamptz,
+    created_at timestamptz NOT NULL
+);
+
+CREATE UNIQUE INDEX notifications_user_id_activity_id_idx ON notifications (user_id, activity_id);
+CREATE INDEX notifications_user_id_id_idx ON notifications (user_id, id DESC);
+CREATE INDEX notifications_unread_idx ON notifications (user_id, id DESC) WHERE read_at IS NULL;
@@ -0,0 +1,4 @@
+-- When a user was deleted. A deleted user's actor and inbox respond 410 Gone,
+-- so their row is kept, and their username is not reused, since other servers
+-- remember the actor by it.
+ALTER TABLE users ADD COLUMN deleted_at timestamptz;
@@ -0,0 +1,20 @@
+-- Page views are no longer counted by country, which was read from headers
+-- that the proxy in front of the server does not set. Views which were counted
+-- by country are merged.
+CREATE TABLE page_views_by_referrer (
+    day date NOT NULL,
+    path text NOT NULL,
+    referrer text NOT NULL DEFAULT '',
+    views integer NOT NULL,
+    PRIMARY KEY (day, path, referrer)
+);
+
+INSERT INTO page_views_by_referrer (day, path, referrer, views)
+SELECT day, path, referrer, SUM(views)
+FROM page_views
+GROUP BY day, path, referrer;
+
+DROP TABLE page_views;
+
+ALTER TABLE page_views_by_referrer RENAME TO page_views;
+ALTER INDEX page_views_by_referrer_pkey RENAME TO page_views_pkey;
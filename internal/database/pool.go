@@ -0,0 +1,73 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/jclem/jclem.me/internal/telemetry"
+	"github.com/jclem/jclem.me/internal/www/config"
+)
+
+// NewPool creates a new connection pool for the configured database URL,
+// tracing each query. The pool is sized and recycled as configured. Settings
+// given in the URL, such as pool_max_conns, take precedence.
+//
+// A process should create one pool and share it, since the job queue and every
+// service draw from it.
+func NewPool(ctx context.Context, c config.Config) (*pgxpool.Pool, error) {
+	cfg, err := pgxpool.ParseConfig(c.DatabaseURL)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse database URL: %w", err)
+	}
+
+	cfg.ConnConfig.Tracer = telemetry.QueryTracer{}
+	cfg.AfterConnect = func(_ context.Context, conn *pgx.Conn) error {
+		RegisterTypes(conn.TypeMap())
+
+		return nil
+	}
+	configurePool(cfg, c)
+
+	pool, err := pgxpool.NewWithConfig(ctx, cfg)
+	if err != nil {
+		return nil, fmt.Errorf("could not create pool: %w", err)
+	}
+
+	return pool, nil
+}
+
+// configurePool applies the configured pool settings which are not set in the
+// database URL.
+func configurePool(cfg *pgxpool.Config, c config.Config) {
+	set := func(param string) bool {
+		return strings.Contains(c.DatabaseURL, param+"=")
+	}
+
+	if n := c.DatabaseMaxConns; n > 0 && !set("pool_max_conns") {
+		cfg.MaxConns = n
+	}
+
+	if n := c.DatabaseMinConns; n > 0 && !set("pool_min_conns") {
+		cfg.MinConns = min(n, cfg.MaxConns)
+	}
+
+	if d := c.DatabaseHealthCheckPeriod; d > 0 && !set("pool_health_check_period") {
+		cfg.HealthCheckPeriod = d
+	}
+
+	if d := c.DatabaseMaxConnLifetime; d > 0 && !set("pool_max_conn_lifetime") {
+		cfg.MaxConnLifetime = d
+	}
+
+	if d := c.DatabaseMaxConnIdleTime; d > 0 && !set("pool_max_conn_idle_time") {
+		cfg.MaxConnIdleTime = d
+	}
+
+	if d := c.DatabaseStatementTimeout; d > 0 && !set("statement_timeout") {
+		cfg.ConnConfig.RuntimeParams["statement_timeout"] = strconv.FormatInt(d.Milliseconds(), 10)
+	}
+}
@@ -0,0 +1,62 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// A Beginner begins transactions, such as a *pgxpool.Pool, a *pgxpool.Conn, or
+// a pgx.Tx. A transaction begun in a pgx.Tx is a savepoint.
+type Beginner interface {
+	Begin(ctx context.Context) (pgx.Tx, error)
+}
+
+// WithTx runs fn in a transaction begun in db, committing it if fn returns nil
+// and rolling it back if fn returns an error or panics. If db is itself a
+// transaction, fn runs in a savepoint, so that only its own changes are rolled
+// back.
+//
+// The transaction is rolled back, rather than committed, if ctx is done by the
+// time fn returns. The error returned by fn is returned as is.
+func WithTx(ctx context.Context, db Beginner, fn func(tx pgx.Tx) error) (err error) {
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("could not begin transaction: %w", err)
+	}
+
+	defer func() {
+		if p := recover(); p != nil {
+			rollback(ctx, tx)
+			panic(p)
+		}
+	}()
+
+	if err := fn(tx); err != nil {
+		rollback(ctx, tx)
+
+		return err
+	}
+
+	if err := ctx.Err(); err != nil {
+		rollback(ctx, tx)
+
+		return fmt.Errorf("could not commit transaction: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("could not commit transaction: %w", err)
+	}
+
+	return nil
+}
+
+// rollback rolls back a transaction, even if ctx is done. A failed rollback is
+// only logged, since the caller returns the error which caused it.
+func rollback(ctx context.Context, tx pgx.Tx) {
+	if err := tx.Rollback(context.WithoutCancel(ctx)); err != nil {
+		slog.ErrorContext(ctx, "could not roll back transaction", "error", err)
+	}
+}
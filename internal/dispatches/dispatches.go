@@ -0,0 +1,524 @@
+// Package dispatches stores dispatches: short, dated updates of one of a few
+// types, such as a photo with a caption, a plain status, a link, or a checkin
+// at a place.
+package dispatches
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"html/template"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/jclem/jclem.me/internal/database"
+	"github.com/jclem/jclem.me/internal/images"
+	"github.com/jclem/jclem.me/internal/markdown"
+)
+
+// DefaultLimit is the number of dispatches listed if no limit is given.
+const DefaultLimit = 24
+
+// ErrInvalidURL is returned when creating a dispatch with an image URL which
+// is not an absolute HTTP(S) URL.
+var ErrInvalidURL = errors.New("invalid url")
+
+// ErrInvalidLink is returned when creating a link dispatch whose link or
+// preview image URL is not an absolute HTTP(S) URL.
+var ErrInvalidLink = errors.New("invalid link")
+
+// ErrMissingPlace is returned when creating a checkin dispatch without the
+// name of the place.
+var ErrMissingPlace = errors.New("missing place name")
+
+// ErrInvalidCoordinates is returned when creating a checkin dispatch whose
+// latitude or longitude is out of range.
+var ErrInvalidCoordinates = errors.New("invalid coordinates")
+
+// ErrUnexpectedData is returned when creating a dispatch with data which does
+// not belong to its type, such as a text dispatch with an image.
+var ErrUnexpectedData = errors.New("data does not match dispatch type")
+
+// ErrMissingAlt is returned when creating a dispatch with an image but no
+// alternative text.
+var ErrMissingAlt = errors.New("missing alt text")
+
+// ErrDispatchNotFound is returned when a dispatch is not found.
+var ErrDispatchNotFound = errors.New("dispatch not found")
+
+// ErrEmptyDispatch is returned when creating a text dispatch without a body.
+var ErrEmptyDispatch = errors.New("empty dispatch")
+
+// A Dispatch is a short, dated update.
+type Dispatch struct {
+	ID     database.ULID `json:"id"`
+	Author string        `json:"author"`
+	Type   Type          `json:"type"`
+
+	// URL is the URL of an image dispatch's image, and Alt is its alternative
+	// text. Both are empty for other types.
+	URL string `json:"url,omitempty"`
+	Alt string `json:"alt,omitempty"`
+
+	// Image holds the resized variants and thumbnail of the dispatch's image,
+	// if it was uploaded rather than linked.
+	Image *images.Image `json:"image,omitempty"`
+
+	// Link is the link shared by a link dispatch.
+	Link *Link `json:"link,omitempty"`
+
+	// Checkin is the place checked in at by a checkin dispatch.
+	Checkin *Checkin `json:"checkin,omitempty"`
+
+	// Body is the Markdown source of the dispatch's text, and Content is the
+	// text rendered to HTML.
+	Body    string        `json:"body"`
+	Content template.HTML `json:"content"`
+
+	// NoteID is the ID of the ActivityPub note which shared the dispatch, if
+	// it was federated.
+	NoteID string `json:"note_id,omitempty"`
+
+	// Status is whether the dispatch's image has been processed. Only ready
+	// dispatches are listed publicly.
+	Status Status `json:"status"`
+
+	InsertedAt time.Time `json:"inserted_at"`
+}
+
+// A Status is the state of processing of a dispatch's image.
+type Status string
+
+const (
+	// StatusPending is the status of an image dispatch whose image is yet to
+	// be processed. Its URL is empty.
+	StatusPending Status = "pending"
+
+	// StatusReady is the status of a dispatch which is ready to be shown.
+	StatusReady Status = "ready"
+
+	// StatusFailed is the status of an image dispatch whose image could not be
+	// processed.
+	StatusFailed Status = "failed"
+)
+
+// HasImage reports whether the dispatch has an image.
+func (d Dispatch) HasImage() bool {
+	return d.Type == TypeImage && d.URL != ""
+}
+
+// A Link is a link shared by a dispatch, with a preview of the linked page.
+type Link struct {
+	URL         string `json:"url"`
+	Title       string `json:"title,omitempty"`
+	Description string `json:"description,omitempty"`
+
+	// Image is the URL of the linked page's preview image, if it has one.
+	Image string `json:"image,omitempty"`
+}
+
+// Host returns the host of the link's URL.
+func (l Link) Host() string {
+	u, err := url.Parse(l.URL)
+	if err != nil {
+		return ""
+	}
+
+	return u.Host
+}
+
+// Label returns the link's title, or its URL if it has no title.
+func (l Link) Label() string {
+	if l.Title != "" {
+		return l.Title
+	}
+
+	return l.URL
+}
+
+// A Checkin is a place at which a dispatch was posted.
+type Checkin struct {
+	Name      string  `json:"name"`
+	Address   string  `json:"address,omitempty"`
+	Latitude  float64 `json:"latitude"`
+	Longitude float64 `json:"longitude"`
+}
+
+// MapURL returns the URL of a map of the place.
+func (c Checkin) MapURL() string {
+	return fmt.Sprintf("https://www.openstreetmap.org/?mlat=%[1]f&mlon=%[2]f#map=17/%[1]f/%[2]f", c.Latitude, c.Longitude)
+}
+
+// Thumbnail returns the URL of the thumbnail of the dispatch's image, or of
+// the image itself if it has no thumbnail.
+func (d Dispatch) Thumbnail() string {
+	if d.Image != nil && d.Image.Thumbnail != "" {
+		return d.Image.Thumbnail
+	}
+
+	return d.URL
+}
+
+// SrcSet returns the srcset of the dispatch's image, or an empty string if it
+// has no resized variants.
+func (d Dispatch) SrcSet() string {
+	if d.Image == nil || len(d.Image.Variants) == 0 {
+		return ""
+	}
+
+	srcset := make([]string, 0, len(d.Image.Variants)+1)
+	for _, v := range d.Image.Variants {
+		srcset = append(srcset, fmt.Sprintf("%s %dw", v.URL, v.Width))
+	}
+
+	srcset = append(srcset, fmt.Sprintf("%s %dw", d.URL, d.Image.Width))
+
+	return strings.Join(srcset, ", ")
+}
+
+// NewDispatch is the input for creating a dispatch. The body is Markdown.
+//
+// If the type is empty, it is inferred from the data given: an image URL, a
+// link, or a checkin. A dispatch with none of these is a text dispatch.
+type NewDispatch struct {
+	Author  string   `json:"author"`
+	Type    Type     `json:"type"`
+	URL     string   `json:"url"`
+	Alt     string   `json:"alt"`
+	Link    *Link    `json:"link"`
+	Checkin *Checkin `json:"checkin"`
+	Body    string   `json:"body"`
+
+	// Image is set when the image at URL was uploaded and processed.
+	Image *images.Image `json:"-"`
+
+	// Pending is set when the dispatch's image has been uploaded but is yet to
+	// be processed, in which case URL is empty until it is.
+	Pending bool `json:"-"`
+}
+
+func (n NewDispatch) dispatchType() Type {
+	switch {
+	case n.Type != "":
+		return n.Type
+	case n.URL != "":
+		return TypeImage
+	case n.Link != nil:
+		return TypeLink
+	case n.Checkin != nil:
+		return TypeCheckin
+	default:
+		return TypeText
+	}
+}
+
+// A Service creates, validates, and renders dispatches, which it keeps in a
+// Store.
+type Service struct {
+	store Store
+}
+
+// New creates a new Service which keeps dispatches in Postgres.
+func New(pool *pgxpool.Pool) *Service {
+	return NewWithStore(NewPostgresStore(pool))
+}
+
+// NewWithStore creates a new Service which keeps dispatches in the given store,
+// such as a MemoryStore.
+func NewWithStore(store Store) *Service {
+	return &Service{store: store}
+}
+
+// Create creates a dispatch.
+func (s *Service) Create(ctx context.Context, input NewDispatch) (Dispatch, error) {
+	d := Dispatch{
+		Author:  input.Author,
+		Type:    input.dispatchType(),
+		URL:     input.URL,
+		Alt:     input.Alt,
+		Image:   input.Image,
+		Link:    input.Link,
+		Checkin: input.Checkin,
+		Body:    input.Body,
+		Status:  StatusReady,
+	}
+
+	if input.Pending {
+		d.Status = StatusPending
+	}
+
+	if err := d.validate(); err != nil {
+		return Dispatch{}, err
+	}
+
+	doc, err := markdown.Render([]byte(d.Body))
+	if err != nil {
+		return Dispatch{}, fmt.Errorf("could not render body: %w", err)
+	}
+
+	d.ID = database.NewULID()
+	d.Content = template.HTML(doc.Content) //nolint:gosec
+
+	dispatch, err := s.store.Insert(ctx, d)
+	if err != nil {
+		return Dispatch{}, fmt.Errorf("could not create dispatch: %w", err)
+	}
+
+	return dispatch, nil
+}
+
+// validators check the data of each type of dispatch.
+var validators = map[Type]func(Dispatch) error{ //nolint:gochecknoglobals
+	TypeImage:   validateImage,
+	TypeText:    validateText,
+	TypeLink:    validateLink,
+	TypeCheckin: validateCheckin,
+}
+
+func (d Dispatch) validate() error {
+	validate, ok := validators[d.Type]
+	if !ok {
+		return ErrInvalidType
+	}
+
+	return validate(d)
+}
+
+func validateImage(d Dispatch) error {
+	if d.Link != nil || d.Checkin != nil {
+		return ErrUnexpectedData
+	}
+
+	// The image of a pending dispatch has no URL until it is processed.
+	if d.Status != StatusPending && !isHTTPURL(d.URL) {
+		return ErrInvalidURL
+	}
+
+	if strings.TrimSpace(d.Alt) == "" {
+		return ErrMissingAlt
+	}
+
+	return nil
+}
+
+func validateText(d Dispatch) error {
+	if d.URL != "" || d.Image != nil || d.Link != nil || d.Checkin != nil {
+		return ErrUnexpectedData
+	}
+
+	if strings.TrimSpace(d.Body) == "" {
+		return ErrEmptyDispatch
+	}
+
+	return nil
+}
+
+func validateLink(d Dispatch) error {
+	if d.URL != "" || d.Image != nil || d.Checkin != nil {
+		return ErrUnexpectedData
+	}
+
+	if d.Link == nil || !isHTTPURL(d.Link.URL) || (d.Link.Image != "" && !isHTTPURL(d.Link.Image)) {
+		return ErrInvalidLink
+	}
+
+	return nil
+}
+
+func validateCheckin(d Dispatch) error {
+	if d.URL != "" || d.Image != nil || d.Link != nil {
+		return ErrUnexpectedData
+	}
+
+	if d.Checkin == nil || strings.TrimSpace(d.Checkin.Name) == "" {
+		return ErrMissingPlace
+	}
+
+	if d.Checkin.Latitude < -90 || d.Checkin.Latitude > 90 || d.Checkin.Longitude < -180 || d.Checkin.Longitude > 180 {
+		return ErrInvalidCoordinates
+	}
+
+	return nil
+}
+
+func isHTTPURL(s string) bool {
+	u, err := url.Parse(s)
+
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
+
+// data returns the type-specific data stored in the data column, or nil if
+// the dispatch's type has none.
+func (d Dispatch) data() any {
+	switch d.Type {
+	case TypeLink:
+		return d.Link
+	case TypeCheckin:
+		return d.Checkin
+	default:
+		return nil
+	}
+}
+
+// Get returns the dispatch with the given ID.
+func (s *Service) Get(ctx context.Context, id database.ULID) (Dispatch, error) {
+	dispatch, err := s.store.Get(ctx, id)
+	if err != nil {
+		if errors.Is(err, ErrDispatchNotFound) {
+			return Dispatch{}, err
+		}
+
+		return Dispatch{}, fmt.Errorf("could not get dispatch: %w", err)
+	}
+
+	return dispatch, nil
+}
+
+// A DispatchUpdate changes the text or data of a dispatch. Nil fields are left
+// unchanged. A dispatch's type cannot be changed.
+type DispatchUpdate struct {
+	Alt     *string  `json:"alt"`
+	Body    *string  `json:"body"`
+	Link    *Link    `json:"link"`
+	Checkin *Checkin `json:"checkin"`
+}
+
+// Update changes the alternative text, body, link, or checkin of a dispatch.
+func (s *Service) Update(ctx context.Context, id database.ULID, update DispatchUpdate) (Dispatch, error) {
+	dispatch, err := s.Get(ctx, id)
+	if err != nil {
+		return Dispatch{}, err
+	}
+
+	if update.Alt != nil {
+		dispatch.Alt = *update.Alt
+	}
+
+	if update.Body != nil {
+		dispatch.Body = *update.Body
+	}
+
+	if update.Link != nil {
+		dispatch.Link = update.Link
+	}
+
+	if update.Checkin != nil {
+		dispatch.Checkin = update.Checkin
+	}
+
+	if err := dispatch.validate(); err != nil {
+		return Dispatch{}, err
+	}
+
+	doc, err := markdown.Render([]byte(dispatch.Body))
+	if err != nil {
+		return Dispatch{}, fmt.Errorf("could not render body: %w", err)
+	}
+
+	content := template.HTML(doc.Content) //nolint:gosec
+
+	return s.update(ctx, id, Patch{
+		Alt:     &dispatch.Alt,
+		Body:    &dispatch.Body,
+		Content: &content,
+		Link:    dispatch.Link,
+		Checkin: dispatch.Checkin,
+	})
+}
+
+// SetNoteID records the ID of the note which shared a dispatch.
+func (s *Service) SetNoteID(ctx context.Context, id database.ULID, noteID string) error {
+	_, err := s.update(ctx, id, Patch{NoteID: &noteID})
+
+	return err
+}
+
+// SetImage records the processed image of a pending dispatch, making it ready.
+func (s *Service) SetImage(ctx context.Context, id database.ULID, url string, img images.Image) (Dispatch, error) {
+	status := StatusReady
+
+	return s.update(ctx, id, Patch{URL: &url, Image: &img, Status: &status})
+}
+
+// SetStatus sets the status of a dispatch.
+func (s *Service) SetStatus(ctx context.Context, id database.ULID, status Status) error {
+	_, err := s.update(ctx, id, Patch{Status: &status})
+
+	return err
+}
+
+func (s *Service) update(ctx context.Context, id database.ULID, patch Patch) (Dispatch, error) {
+	dispatch, err := s.store.Update(ctx, id, patch)
+	if err != nil {
+		if errors.Is(err, ErrDispatchNotFound) {
+			return Dispatch{}, err
+		}
+
+		return Dispatch{}, fmt.Errorf("could not update dispatch: %w", err)
+	}
+
+	return dispatch, nil
+}
+
+// Delete deletes a dispatch, returning it.
+func (s *Service) Delete(ctx context.Context, id database.ULID) (Dispatch, error) {
+	dispatch, err := s.store.Delete(ctx, id)
+	if err != nil {
+		if errors.Is(err, ErrDispatchNotFound) {
+			return Dispatch{}, err
+		}
+
+		return Dispatch{}, fmt.Errorf("could not delete dispatch: %w", err)
+	}
+
+	return dispatch, nil
+}
+
+// A Type is a kind of dispatch.
+type Type string
+
+const (
+	// TypeImage is a dispatch with an image, and perhaps some text.
+	TypeImage Type = "image"
+
+	// TypeText is a dispatch with only text, such as a status.
+	TypeText Type = "text"
+
+	// TypeLink is a dispatch sharing a link, and perhaps some text about it.
+	TypeLink Type = "link"
+
+	// TypeCheckin is a dispatch checking in at a place, and perhaps some text
+	// about it.
+	TypeCheckin Type = "checkin"
+)
+
+// ErrInvalidType is returned when parsing an unknown dispatch type.
+var ErrInvalidType = errors.New("invalid dispatch type")
+
+// ParseType parses a dispatch type.
+func ParseType(s string) (Type, error) {
+	switch t := Type(s); t {
+	case TypeImage, TypeText, TypeLink, TypeCheckin:
+		return t, nil
+	default:
+		return "", ErrInvalidType
+	}
+}
+
+// List returns dispatches matching the given options, most recent first. Only
+// ready dispatches are listed unless WithAnyStatus is given.
+func (s *Service) List(ctx context.Context, opts ...ListOpt) ([]Dispatch, error) {
+	filter := Filter{Limit: DefaultLimit}
+	for _, opt := range opts {
+		opt(&filter)
+	}
+
+	dispatches, err := s.store.List(ctx, filter)
+	if err != nil {
+		return nil, fmt.Errorf("could not list dispatches: %w", err)
+	}
+
+	return dispatches, nil
+}
@@ -0,0 +1,191 @@
+package dispatches
+
+import (
+	"context"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/jclem/jclem.me/internal/database"
+)
+
+// A MemoryStore keeps dispatches in memory, for running handlers without
+// Postgres. Its zero value is empty and ready to use.
+type MemoryStore struct {
+	mu         sync.RWMutex
+	dispatches map[database.ULID]Dispatch
+}
+
+var _ Store = (*MemoryStore)(nil)
+
+// NewMemoryStore creates a new MemoryStore holding the given dispatches, which
+// must have IDs.
+func NewMemoryStore(dispatches ...Dispatch) *MemoryStore {
+	s := &MemoryStore{dispatches: make(map[database.ULID]Dispatch, len(dispatches))}
+	for _, d := range dispatches {
+		s.dispatches[d.ID] = d.clone()
+	}
+
+	return s
+}
+
+// Insert implements the Store interface.
+func (s *MemoryStore) Insert(_ context.Context, d Dispatch) (Dispatch, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.dispatches == nil {
+		s.dispatches = make(map[database.ULID]Dispatch)
+	}
+
+	d.InsertedAt = time.Now().UTC()
+	s.dispatches[d.ID] = d.clone()
+
+	return d.clone(), nil
+}
+
+// Get implements the Store interface.
+func (s *MemoryStore) Get(_ context.Context, id database.ULID) (Dispatch, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	d, ok := s.dispatches[id]
+	if !ok {
+		return Dispatch{}, ErrDispatchNotFound
+	}
+
+	return d.clone(), nil
+}
+
+// Update implements the Store interface.
+func (s *MemoryStore) Update(_ context.Context, id database.ULID, patch Patch) (Dispatch, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	d, ok := s.dispatches[id]
+	if !ok {
+		return Dispatch{}, ErrDispatchNotFound
+	}
+
+	if patch.Alt != nil {
+		d.Alt = *patch.Alt
+	}
+
+	if patch.Body != nil {
+		d.Body = *patch.Body
+	}
+
+	if patch.Content != nil {
+		d.Content = *patch.Content
+	}
+
+	if patch.Link != nil {
+		d.Link = patch.Link
+	}
+
+	if patch.Checkin != nil {
+		d.Checkin = patch.Checkin
+	}
+
+	if patch.URL != nil {
+		d.URL = *patch.URL
+	}
+
+	if patch.Image != nil {
+		d.Image = patch.Image
+	}
+
+	if patch.Status != nil {
+		d.Status = *patch.Status
+	}
+
+	if patch.NoteID != nil {
+		d.NoteID = *patch.NoteID
+	}
+
+	s.dispatches[id] = d.clone()
+
+	return d.clone(), nil
+}
+
+// Delete implements the Store interface.
+func (s *MemoryStore) Delete(_ context.Context, id database.ULID) (Dispatch, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	d, ok := s.dispatches[id]
+	if !ok {
+		return Dispatch{}, ErrDispatchNotFound
+	}
+
+	delete(s.dispatches, id)
+
+	return d, nil
+}
+
+// List implements the Store interface.
+func (s *MemoryStore) List(_ context.Context, f Filter) ([]Dispatch, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	dispatches := make([]Dispatch, 0, len(s.dispatches))
+
+	for _, d := range s.dispatches {
+		if f.matches(d) {
+			dispatches = append(dispatches, d.clone())
+		}
+	}
+
+	// ULIDs sort in the order in which they were created.
+	sort.Slice(dispatches, func(i, j int) bool {
+		return dispatches[i].ID.String() > dispatches[j].ID.String()
+	})
+
+	if f.Limit > 0 && len(dispatches) > f.Limit {
+		dispatches = dispatches[:f.Limit]
+	}
+
+	return dispatches, nil
+}
+
+func (f Filter) matches(d Dispatch) bool {
+	switch {
+	case f.Author != "" && d.Author != f.Author:
+		return false
+	case f.Type != "" && d.Type != f.Type:
+		return false
+	case !f.AnyStatus && d.Status != StatusReady:
+		return false
+	case f.Before != nil && d.ID.String() >= f.Before.String():
+		return false
+	case !f.Since.IsZero() && d.InsertedAt.Before(f.Since):
+		return false
+	case !f.Until.IsZero() && !d.InsertedAt.Before(f.Until):
+		return false
+	default:
+		return true
+	}
+}
+
+// clone copies a dispatch's data, so that a stored dispatch is not changed
+// through one which was returned.
+func (d Dispatch) clone() Dispatch {
+	if d.Image != nil {
+		img := *d.Image
+		img.Variants = slices.Clone(img.Variants)
+		d.Image = &img
+	}
+
+	if d.Link != nil {
+		link := *d.Link
+		d.Link = &link
+	}
+
+	if d.Checkin != nil {
+		checkin := *d.Checkin
+		d.Checkin = &checkin
+	}
+
+	return d
+}
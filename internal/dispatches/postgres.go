@@ -0,0 +1,270 @@
+package dispatches
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"strings"
+
+	"github.com/Masterminds/squirrel"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/jclem/jclem.me/internal/database"
+)
+
+// A PostgresStore keeps dispatches in Postgres.
+type PostgresStore struct {
+	pool *pgxpool.Pool
+	sql  squirrel.StatementBuilderType
+}
+
+var _ Store = (*PostgresStore)(nil)
+
+// NewPostgresStore creates a new PostgresStore.
+func NewPostgresStore(pool *pgxpool.Pool) *PostgresStore {
+	return &PostgresStore{
+		pool: pool,
+		sql:  squirrel.StatementBuilder.PlaceholderFormat(squirrel.Dollar),
+	}
+}
+
+// Insert implements the Store interface.
+func (s *PostgresStore) Insert(ctx context.Context, d Dispatch) (Dispatch, error) {
+	query, args, err := s.sql.
+		Insert(dispatchesTable).
+		Columns(dispatchesIDColumn, dispatchesAuthorColumn, dispatchesTypeColumn, dispatchesURLColumn, dispatchesAltColumn, dispatchesImageColumn, dispatchesDataColumn, dispatchesBodyColumn, dispatchesContentColumn, dispatchesStatusColumn).
+		Values(d.ID, d.Author, d.Type, d.URL, d.Alt, d.Image, d.data(), d.Body, string(d.Content), d.Status).
+		Suffix("RETURNING " + strings.Join(dispatchesFields, ", ")).
+		ToSql()
+	if err != nil {
+		return Dispatch{}, fmt.Errorf("could not build query: %w", err)
+	}
+
+	return s.queryOne(ctx, query, args...)
+}
+
+// Get implements the Store interface.
+func (s *PostgresStore) Get(ctx context.Context, id database.ULID) (Dispatch, error) {
+	query, args, err := s.sql.
+		Select(dispatchesFields...).
+		From(dispatchesTable).
+		Where(squirrel.Eq{dispatchesIDColumn: id}).
+		ToSql()
+	if err != nil {
+		return Dispatch{}, fmt.Errorf("could not build query: %w", err)
+	}
+
+	return s.queryOne(ctx, query, args...)
+}
+
+// Update implements the Store interface.
+func (s *PostgresStore) Update(ctx context.Context, id database.ULID, patch Patch) (Dispatch, error) {
+	set := make(map[string]any)
+
+	if patch.Alt != nil {
+		set[dispatchesAltColumn] = *patch.Alt
+	}
+
+	if patch.Body != nil {
+		set[dispatchesBodyColumn] = *patch.Body
+	}
+
+	if patch.Content != nil {
+		set[dispatchesContentColumn] = string(*patch.Content)
+	}
+
+	// A dispatch's type cannot change, so at most one of these is given.
+	if patch.Link != nil {
+		set[dispatchesDataColumn] = patch.Link
+	}
+
+	if patch.Checkin != nil {
+		set[dispatchesDataColumn] = patch.Checkin
+	}
+
+	if patch.URL != nil {
+		set[dispatchesURLColumn] = *patch.URL
+	}
+
+	if patch.Image != nil {
+		set[dispatchesImageColumn] = *patch.Image
+	}
+
+	if patch.Status != nil {
+		set[dispatchesStatusColumn] = *patch.Status
+	}
+
+	if patch.NoteID != nil {
+		set[dispatchesNoteIDColumn] = *patch.NoteID
+	}
+
+	if len(set) == 0 {
+		return s.Get(ctx, id)
+	}
+
+	query, args, err := s.sql.
+		Update(dispatchesTable).
+		SetMap(set).
+		Where(squirrel.Eq{dispatchesIDColumn: id}).
+		Suffix("RETURNING " + strings.Join(dispatchesFields, ", ")).
+		ToSql()
+	if err != nil {
+		return Dispatch{}, fmt.Errorf("could not build query: %w", err)
+	}
+
+	return s.queryOne(ctx, query, args...)
+}
+
+// Delete implements the Store interface.
+func (s *PostgresStore) Delete(ctx context.Context, id database.ULID) (Dispatch, error) {
+	query, args, err := s.sql.
+		Delete(dispatchesTable).
+		Where(squirrel.Eq{dispatchesIDColumn: id}).
+		Suffix("RETURNING " + strings.Join(dispatchesFields, ", ")).
+		ToSql()
+	if err != nil {
+		return Dispatch{}, fmt.Errorf("could not build query: %w", err)
+	}
+
+	return s.queryOne(ctx, query, args...)
+}
+
+// List implements the Store interface.
+func (s *PostgresStore) List(ctx context.Context, f Filter) ([]Dispatch, error) {
+	q := s.sql.
+		Select(dispatchesFields...).
+		From(dispatchesTable).
+		OrderBy(dispatchesIDColumn + " DESC")
+
+	if f.Limit > 0 {
+		q = q.Limit(uint64(f.Limit))
+	}
+
+	if f.Author != "" {
+		q = q.Where(squirrel.Eq{dispatchesAuthorColumn: f.Author})
+	}
+
+	if f.Type != "" {
+		q = q.Where(squirrel.Eq{dispatchesTypeColumn: f.Type})
+	}
+
+	if !f.AnyStatus {
+		q = q.Where(squirrel.Eq{dispatchesStatusColumn: StatusReady})
+	}
+
+	if f.Before != nil {
+		q = q.Where(squirrel.Lt{dispatchesIDColumn: *f.Before})
+	}
+
+	if !f.Since.IsZero() {
+		q = q.Where(squirrel.GtOrEq{dispatchesInsertedAtColumn: f.Since})
+	}
+
+	if !f.Until.IsZero() {
+		q = q.Where(squirrel.Lt{dispatchesInsertedAtColumn: f.Until})
+	}
+
+	query, args, err := q.ToSql()
+	if err != nil {
+		return nil, fmt.Errorf("could not build query: %w", err)
+	}
+
+	rows, err := s.pool.Query(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("could not query dispatches: %w", err)
+	}
+
+	dispatches, err := pgx.CollectRows(rows, scanDispatch)
+	if err != nil {
+		return nil, fmt.Errorf("could not scan dispatches: %w", err)
+	}
+
+	return dispatches, nil
+}
+
+// queryOne runs a query which returns one dispatch, or ErrDispatchNotFound if
+// it returns none.
+func (s *PostgresStore) queryOne(ctx context.Context, query string, args ...any) (Dispatch, error) {
+	rows, err := s.pool.Query(ctx, query, args...)
+	if err != nil {
+		return Dispatch{}, fmt.Errorf("could not query dispatch: %w", err)
+	}
+
+	dispatch, err := pgx.CollectExactlyOneRow(rows, scanDispatch)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return Dispatch{}, ErrDispatchNotFound
+		}
+
+		return Dispatch{}, fmt.Errorf("could not scan dispatch: %w", err)
+	}
+
+	return dispatch, nil
+}
+
+func scanDispatch(row pgx.CollectableRow) (Dispatch, error) {
+	var (
+		d       Dispatch
+		data    []byte
+		content string
+		noteID  *string
+	)
+
+	if err := row.Scan(&d.ID, &d.Author, &d.Type, &d.URL, &d.Alt, &d.Image, &data, &d.Body, &content, &noteID, &d.Status, &d.InsertedAt); err != nil {
+		return Dispatch{}, fmt.Errorf("could not scan dispatch: %w", err)
+	}
+
+	if data != nil {
+		var err error
+
+		switch d.Type {
+		case TypeLink:
+			err = json.Unmarshal(data, &d.Link)
+		case TypeCheckin:
+			err = json.Unmarshal(data, &d.Checkin)
+		}
+
+		if err != nil {
+			return Dispatch{}, fmt.Errorf("could not unmarshal dispatch data: %w", err)
+		}
+	}
+
+	d.Content = template.HTML(content) //nolint:gosec
+
+	if noteID != nil {
+		d.NoteID = *noteID
+	}
+
+	return d, nil
+}
+
+const dispatchesTable = "dispatches"
+const dispatchesIDColumn = "id"
+const dispatchesAuthorColumn = "author"
+const dispatchesTypeColumn = "type"
+const dispatchesURLColumn = "url"
+const dispatchesAltColumn = "alt"
+const dispatchesImageColumn = "image"
+const dispatchesDataColumn = "data"
+const dispatchesBodyColumn = "body"
+const dispatchesContentColumn = "content"
+const dispatchesNoteIDColumn = "note_id"
+const dispatchesStatusColumn = "status"
+const dispatchesInsertedAtColumn = "inserted_at"
+
+var dispatchesFields = []string{ //nolint:gochecknoglobals
+	dispatchesIDColumn,
+	dispatchesAuthorColumn,
+	dispatchesTypeColumn,
+	dispatchesURLColumn,
+	dispatchesAltColumn,
+	dispatchesImageColumn,
+	dispatchesDataColumn,
+	dispatchesBodyColumn,
+	dispatchesContentColumn,
+	dispatchesNoteIDColumn,
+	dispatchesStatusColumn,
+	dispatchesInsertedAtColumn,
+}
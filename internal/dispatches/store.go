@@ -0,0 +1,121 @@
+package dispatches
+
+import (
+	"context"
+	"html/template"
+	"time"
+
+	"github.com/jclem/jclem.me/internal/database"
+	"github.com/jclem/jclem.me/internal/images"
+)
+
+// A Store keeps dispatches. The Service validates and renders dispatches before
+// they are stored, so a Store only records what it is given.
+//
+// Get, Update, and Delete return ErrDispatchNotFound if there is no dispatch
+// with the given ID.
+type Store interface {
+	// Insert stores a new dispatch, returning it as stored.
+	Insert(ctx context.Context, dispatch Dispatch) (Dispatch, error)
+
+	// Get returns the dispatch with the given ID.
+	Get(ctx context.Context, id database.ULID) (Dispatch, error)
+
+	// Update applies a patch to the dispatch with the given ID, returning it.
+	Update(ctx context.Context, id database.ULID, patch Patch) (Dispatch, error)
+
+	// Delete deletes the dispatch with the given ID, returning it.
+	Delete(ctx context.Context, id database.ULID) (Dispatch, error)
+
+	// List returns the dispatches matching a filter, most recent first.
+	List(ctx context.Context, filter Filter) ([]Dispatch, error)
+}
+
+// A Patch changes some fields of a stored dispatch. Nil fields are left
+// unchanged.
+type Patch struct {
+	Alt     *string
+	Body    *string
+	Content *template.HTML
+	Link    *Link
+	Checkin *Checkin
+	URL     *string
+	Image   *images.Image
+	Status  *Status
+	NoteID  *string
+}
+
+// A Filter selects the dispatches returned by List. Zero fields do not filter.
+type Filter struct {
+	Author string
+	Type   Type
+
+	// Before selects dispatches created before the one with the given ID.
+	Before *database.ULID
+
+	// Since and Until select dispatches inserted at or after, and before, the
+	// given times.
+	Since time.Time
+	Until time.Time
+
+	// Limit is the most dispatches returned.
+	Limit int
+
+	// AnyStatus selects pending and failed dispatches, as well as those which
+	// are ready.
+	AnyStatus bool
+}
+
+// A ListOpt filters the dispatches returned by List.
+type ListOpt func(*Filter)
+
+// WithAuthor lists only dispatches by the given author.
+func WithAuthor(author string) ListOpt {
+	return func(f *Filter) {
+		f.Author = author
+	}
+}
+
+// WithType lists only dispatches of the given type.
+func WithType(typ Type) ListOpt {
+	return func(f *Filter) {
+		f.Type = typ
+	}
+}
+
+// WithBefore lists only dispatches created before the one with the given ID,
+// for paginating through dispatches.
+func WithBefore(id database.ULID) ListOpt {
+	return func(f *Filter) {
+		f.Before = &id
+	}
+}
+
+// WithSince lists only dispatches created at or after the given time.
+func WithSince(t time.Time) ListOpt {
+	return func(f *Filter) {
+		f.Since = t
+	}
+}
+
+// WithUntil lists only dispatches created before the given time.
+func WithUntil(t time.Time) ListOpt {
+	return func(f *Filter) {
+		f.Until = t
+	}
+}
+
+// WithAnyStatus lists pending and failed dispatches, as well as those which are
+// ready.
+func WithAnyStatus() ListOpt {
+	return func(f *Filter) {
+		f.AnyStatus = true
+	}
+}
+
+// WithLimit lists at most the given number of dispatches.
+func WithLimit(limit int) ListOpt {
+	return func(f *Filter) {
+		f.Limit = limit
+	}
+}
@@ -0,0 +1,152 @@
+package dispatches
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/jclem/jclem.me/internal/database"
+	"github.com/jclem/jclem.me/internal/images"
+	"github.com/jclem/jclem.me/internal/queues"
+	"github.com/jclem/jclem.me/internal/telemetry"
+	"github.com/riverqueue/river"
+)
+
+// ProcessImageArgs are the arguments of a job which processes the uploaded
+// image of a pending dispatch.
+type ProcessImageArgs struct {
+	DispatchID database.ULID `json:"dispatch_id"`
+
+	// UploadKey is the key under which the unprocessed image was uploaded.
+	UploadKey string `json:"upload_key"`
+
+	// Federate shares the dispatch once it is ready.
+	Federate bool `json:"federate"`
+
+	// Trace is the trace context of the request which enqueued the job.
+	Trace telemetry.Carrier `json:"trace,omitempty"`
+}
+
+// Kind implements the river.JobArgs interface.
+func (a ProcessImageArgs) Kind() string {
+	return "process-dispatch-image"
+}
+
+// InsertOpts implements the river.JobArgsWithInsertOpts interface.
+func (a ProcessImageArgs) InsertOpts() river.InsertOpts {
+	return river.InsertOpts{Queue: queues.Media}
+}
+
+// ImageKey returns the key under which a dispatch's processed image is stored,
+// without an extension.
+func ImageKey(id database.ULID) string {
+	return "dispatches/" + id.String()
+}
+
+// A ReadyFunc is called once a dispatch's image is processed, with whether
+// the dispatch should be federated.
+type ReadyFunc func(ctx context.Context, dispatch Dispatch, federate bool) error
+
+// A ProcessImageWorker processes the images of pending dispatches.
+type ProcessImageWorker struct {
+	river.WorkerDefaults[ProcessImageArgs]
+	dispatches *Service
+	images     *images.Service
+	ready      ReadyFunc
+}
+
+// NewProcessImageWorker creates a new ProcessImageWorker, which calls ready
+// once each dispatch is ready.
+func NewProcessImageWorker(dispatches *Service, images *images.Service, ready ReadyFunc) *ProcessImageWorker {
+	return &ProcessImageWorker{dispatches: dispatches, images: images, ready: ready}
+}
+
+// Timeout implements the river.Worker interface. Large images take a while to
+// download, resize, and upload.
+func (w *ProcessImageWorker) Timeout(*river.Job[ProcessImageArgs]) time.Duration {
+	return 5 * time.Minute
+}
+
+// Work implements the river.Worker interface.
+//
+// If the image cannot be processed, the dispatch is marked failed. Other errors
+// are retried, and the dispatch is marked failed once it runs out of attempts.
+func (w *ProcessImageWorker) Work(ctx context.Context, job *river.Job[ProcessImageArgs]) (err error) {
+	ctx, span := telemetry.StartJob(ctx, job.Kind, job.Attempt, job.Args.Trace)
+	defer func() { telemetry.End(span, err) }()
+
+	dispatch, err := w.dispatches.Get(ctx, job.Args.DispatchID)
+	if err != nil {
+		if errors.Is(err, ErrDispatchNotFound) {
+			// The dispatch was deleted while it was pending, so its image is
+			// no longer needed.
+			if err := w.images.DiscardUpload(ctx, job.Args.UploadKey); err != nil {
+				return fmt.Errorf("failed to discard dispatch upload: %w", err)
+			}
+
+			return river.JobCancel(ErrDispatchNotFound) //nolint:wrapcheck
+		}
+
+		return fmt.Errorf("failed to get dispatch: %w", err)
+	}
+
+	// A retried job may find its image already processed, if only the ready
+	// function failed.
+	if dispatch.Status != StatusReady {
+		dispatch, err = w.process(ctx, job)
+		if err != nil {
+			return err
+		}
+	}
+
+	if err := w.ready(ctx, dispatch, job.Args.Federate); err != nil {
+		return fmt.Errorf("failed to finish dispatch: %w", err)
+	}
+
+	slog.InfoContext(ctx, "processed dispatch image", "dispatch_id", dispatch.ID, "url", dispatch.URL)
+
+	return nil
+}
+
+func (w *ProcessImageWorker) process(ctx context.Context, job *river.Job[ProcessImageArgs]) (Dispatch, error) {
+	url, img, err := w.images.ProcessUpload(ctx, job.Args.UploadKey, ImageKey(job.Args.DispatchID))
+	if err != nil {
+		if errors.Is(err, images.ErrUploadNotFound) || errors.Is(err, images.ErrInvalidImage) || errors.Is(err, images.ErrTooLarge) {
+			return Dispatch{}, w.fail(ctx, job, err, true)
+		}
+
+		return Dispatch{}, w.fail(ctx, job, fmt.Errorf("failed to process image: %w", err), false)
+	}
+
+	dispatch, err := w.dispatches.SetImage(ctx, job.Args.DispatchID, url, img)
+	if err != nil {
+		return Dispatch{}, fmt.Errorf("failed to set dispatch image: %w", err)
+	}
+
+	if err := w.images.DiscardUpload(ctx, job.Args.UploadKey); err != nil {
+		slog.ErrorContext(ctx, "failed to discard dispatch upload", "error", err, "key", job.Args.UploadKey)
+	}
+
+	return dispatch, nil
+}
+
+// fail marks a dispatch failed if its job will not be retried, because err is
+// permanent or the job has no attempts left. It returns the error for the job
+// to return.
+func (w *ProcessImageWorker) fail(ctx context.Context, job *river.Job[ProcessImageArgs], err error, permanent bool) error {
+	if !permanent && job.Attempt < job.MaxAttempts {
+		return err
+	}
+
+	if serr := w.dispatches.SetStatus(ctx, job.Args.DispatchID, StatusFailed); serr != nil {
+		return fmt.Errorf("failed to mark dispatch failed: %w", serr)
+	}
+
+	if permanent {
+		return river.JobCancel(err) //nolint:wrapcheck
+	}
+
+	return err
+}
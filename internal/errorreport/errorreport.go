@@ -0,0 +1,285 @@
+// Package errorreport reports unexpected errors and panics, such as those in
+// request handlers and jobs, to an error tracker, with the request and user
+// which they affected, so that they are seen without searching logs.
+package errorreport
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"maps"
+	"runtime"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jclem/jclem.me/internal/www/config"
+)
+
+// An Event is an error or panic to report.
+type Event struct {
+	ID        string            `json:"event_id"`
+	Timestamp time.Time         `json:"timestamp"`
+	Level     string            `json:"level"`
+	Message   string            `json:"message"`
+	ErrorType string            `json:"error_type"`
+	Error     string            `json:"error"`
+	Stack     []Frame           `json:"stack"`
+	Request   *Request          `json:"request,omitempty"`
+	User      *User             `json:"user,omitempty"`
+	Tags      map[string]string `json:"tags,omitempty"`
+}
+
+const (
+	levelError = "error"
+	levelFatal = "fatal"
+)
+
+// A Frame is a function call in an event's stack, outermost first.
+type Frame struct {
+	Function string `json:"function"`
+	File     string `json:"file"`
+	Line     int    `json:"line"`
+}
+
+// A Request is the HTTP request during which an event occurred. Its query is
+// not kept, since it may hold secrets, such as authorization codes.
+type Request struct {
+	ID     string `json:"id"`
+	Method string `json:"method"`
+	Host   string `json:"host"`
+	Path   string `json:"path"`
+}
+
+// A User is the user on whose behalf an event occurred.
+type User struct {
+	ID       string `json:"id"`
+	Username string `json:"username"`
+}
+
+// A Reporter sends events to an error tracker. Report must not block on the
+// tracker, since it is called while handling requests.
+type Reporter interface {
+	Report(event Event)
+}
+
+type nopReporter struct{}
+
+func (nopReporter) Report(Event) {}
+
+// reporter is the reporter to which events are sent, which does nothing until
+// one is set.
+//
+//nolint:gochecknoglobals
+var (
+	reporterMu sync.RWMutex
+	reporter   Reporter = nopReporter{}
+)
+
+// SetReporter sets the reporter to which events are sent, and returns a
+// function which restores the previous one, such as at the end of a test.
+func SetReporter(r Reporter) func() {
+	reporterMu.Lock()
+	defer reporterMu.Unlock()
+
+	prev := reporter
+	reporter = r
+
+	return func() {
+		reporterMu.Lock()
+		defer reporterMu.Unlock()
+
+		reporter = prev
+	}
+}
+
+func currentReporter() Reporter {
+	reporterMu.RLock()
+	defer reporterMu.RUnlock()
+
+	return reporter
+}
+
+// Setup sets the reporter to send events to the Sentry-compatible tracker
+// whose DSN is configured, if one is. The returned function sends any events
+// which have not yet been sent, and stops the reporter.
+func Setup(c config.Config) (func(context.Context) error, error) {
+	if c.ErrorReportingDSN == "" {
+		return func(context.Context) error { return nil }, nil
+	}
+
+	r, err := newSentryReporter(c.ErrorReportingDSN, string(c.AppEnv))
+	if err != nil {
+		return nil, err
+	}
+
+	restore := SetReporter(r)
+
+	return func(ctx context.Context) error {
+		restore()
+		return r.close(ctx)
+	}, nil
+}
+
+// Report reports an unexpected error, with message describing what failed,
+// from the function which calls it.
+func Report(ctx context.Context, err error, message string) {
+	report(ctx, levelError, message, errorType(err), err.Error())
+}
+
+// ReportPanic reports a recovered panic. It must be called by the deferred
+// function which recovered it, so that its stack is the panicking one.
+func ReportPanic(ctx context.Context, value any) {
+	typ := fmt.Sprintf("%T", value)
+	if err, ok := value.(error); ok {
+		typ = errorType(err)
+	}
+
+	report(ctx, levelFatal, "panic", typ, fmt.Sprint(value))
+}
+
+func report(ctx context.Context, level, message, typ, value string) {
+	event := Event{
+		ID:        newEventID(),
+		Timestamp: time.Now().UTC(),
+		Level:     level,
+		Message:   message,
+		ErrorType: typ,
+		Error:     value,
+		Stack:     callers(),
+	}
+
+	if s := scopeFrom(ctx); s != nil {
+		s.apply(&event)
+	}
+
+	currentReporter().Report(event)
+}
+
+// errorType names the innermost error which err wraps, such as
+// "*pgconn.PgError", since the types of wrapping errors say little.
+func errorType(err error) string {
+	for {
+		inner := errors.Unwrap(err)
+		if inner == nil {
+			return fmt.Sprintf("%T", err)
+		}
+
+		err = inner
+	}
+}
+
+func newEventID() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+
+	return hex.EncodeToString(b)
+}
+
+// maxFrames is the most frames of an event's stack which are reported.
+const maxFrames = 64
+
+// callers returns the stack of the function which reported an event, without
+// this package's frames, or, for a panic, the runtime's.
+func callers() []Frame {
+	pcs := make([]uintptr, maxFrames)
+	n := runtime.Callers(1, pcs)
+	frames := runtime.CallersFrames(pcs[:n])
+
+	var stack []Frame
+
+	for {
+		frame, more := frames.Next()
+
+		if !strings.HasPrefix(frame.Function, "github.com/jclem/jclem.me/internal/errorreport.") &&
+			!strings.HasPrefix(frame.Function, "runtime.") {
+			stack = append(stack, Frame{Function: frame.Function, File: frame.File, Line: frame.Line})
+		}
+
+		if !more {
+			slices.Reverse(stack)
+			return stack
+		}
+	}
+}
+
+// A scope holds what is known of the request or job during which an event may
+// occur. It is shared by the contexts derived from the one which holds it, so
+// that middleware which learns of the request's user sets it for handlers
+// which report errors, and for the middleware which reports their panics.
+type scope struct {
+	mu      sync.Mutex
+	request *Request
+	user    *User
+	tags    map[string]string
+}
+
+type scopeContextKey struct{}
+
+// WithScope returns a context which holds a new scope for events, in which
+// the scope of ctx, if it has one, is copied.
+func WithScope(ctx context.Context) context.Context {
+	s := &scope{tags: map[string]string{}}
+
+	if parent := scopeFrom(ctx); parent != nil {
+		parent.mu.Lock()
+		s.request, s.user, s.tags = parent.request, parent.user, maps.Clone(parent.tags)
+		parent.mu.Unlock()
+	}
+
+	return context.WithValue(ctx, scopeContextKey{}, s)
+}
+
+func scopeFrom(ctx context.Context) *scope {
+	s, _ := ctx.Value(scopeContextKey{}).(*scope)
+	return s
+}
+
+// SetRequest sets the request of the scope of ctx, if it has one.
+func SetRequest(ctx context.Context, request Request) {
+	if s := scopeFrom(ctx); s != nil {
+		s.mu.Lock()
+		s.request = &request
+		s.mu.Unlock()
+	}
+}
+
+// SetUser sets the user of the scope of ctx, if it has one.
+func SetUser(ctx context.Context, user User) {
+	if s := scopeFrom(ctx); s != nil {
+		s.mu.Lock()
+		s.user = &user
+		s.mu.Unlock()
+	}
+}
+
+// SetTag sets a tag of the scope of ctx, if it has one, by which events may be
+// searched, such as a job's kind.
+func SetTag(ctx context.Context, key, value string) {
+	if s := scopeFrom(ctx); s != nil {
+		s.mu.Lock()
+		s.tags[key] = value
+		s.mu.Unlock()
+	}
+}
+
+func (s *scope) apply(event *Event) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	event.Request, event.User = s.request, s.user
+
+	if len(s.tags) > 0 {
+		event.Tags = maps.Clone(s.tags)
+	}
+}
+
+// logDropped logs an event which could not be sent, so that it is not lost
+// entirely.
+func logDropped(event Event, err error) {
+	slog.Error("error reporting error", "event_id", event.ID, "message", event.Message, "error", event.Error, "reason", err)
+}
@@ -0,0 +1,222 @@
+package errorreport
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// sentryQueueSize is how many events may wait to be sent before further
+	// events are dropped, so that a burst of errors cannot pile up in memory.
+	sentryQueueSize = 64
+
+	// sentryTimeout is the longest sending an event may take.
+	sentryTimeout = 10 * time.Second
+
+	sentryClient = "jclem.me/1.0"
+)
+
+// A sentryReporter sends events, one at a time and in the background, to a
+// tracker which accepts Sentry's envelopes, such as Sentry or GlitchTip.
+//
+// SEE https://develop.sentry.dev/sdk/envelopes/
+type sentryReporter struct {
+	dsn         string
+	endpoint    string
+	auth        string
+	environment string
+	client      *http.Client
+
+	queue     chan Event
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// newSentryReporter creates a reporter for a DSN, such as
+// "https://KEY@o0.ingest.sentry.io/PROJECT", and starts sending its events.
+func newSentryReporter(dsn, environment string) (*sentryReporter, error) {
+	u, err := url.Parse(dsn)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing error reporting DSN: %w", err)
+	}
+
+	projectID := path.Base(u.Path)
+	if u.User == nil || u.User.Username() == "" || projectID == "." || projectID == "/" {
+		return nil, errors.New("error reporting DSN must have a key and a project ID")
+	}
+
+	endpoint := url.URL{
+		Scheme: u.Scheme,
+		Host:   u.Host,
+		Path:   path.Join(path.Dir(u.Path), "api", projectID, "envelope") + "/",
+	}
+
+	r := &sentryReporter{
+		dsn:         dsn,
+		endpoint:    endpoint.String(),
+		auth:        fmt.Sprintf("Sentry sentry_version=7, sentry_client=%s, sentry_key=%s", sentryClient, u.User.Username()),
+		environment: environment,
+		client:      &http.Client{},
+		queue:       make(chan Event, sentryQueueSize),
+		done:        make(chan struct{}),
+	}
+
+	go r.run()
+
+	return r, nil
+}
+
+// Report queues an event to be sent, or, if too many are queued, logs it.
+func (r *sentryReporter) Report(event Event) {
+	select {
+	case r.queue <- event:
+	default:
+		logDropped(event, errors.New("queue is full"))
+	}
+}
+
+func (r *sentryReporter) run() {
+	defer close(r.done)
+
+	for event := range r.queue {
+		if err := r.send(event); err != nil {
+			logDropped(event, err)
+		}
+	}
+}
+
+// close sends the events which are queued, until ctx is done, and stops the
+// reporter.
+func (r *sentryReporter) close(ctx context.Context) error {
+	r.closeOnce.Do(func() { close(r.queue) })
+
+	select {
+	case <-r.done:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("error sending queued error reports: %w", ctx.Err())
+	}
+}
+
+func (r *sentryReporter) send(event Event) error {
+	body, err := r.envelope(event)
+	if err != nil {
+		return err
+	}
+
+	// Events are sent after the requests and jobs which reported them end, so
+	// they are only given their own deadline.
+	ctx, cancel := context.WithTimeout(context.Background(), sentryTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, r.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("error creating request: %w", err)
+	}
+
+	req.Header.Set("Content-Type", "application/x-sentry-envelope")
+	req.Header.Set("X-Sentry-Auth", r.auth)
+
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("error sending event: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= http.StatusBadRequest {
+		return fmt.Errorf("error sending event: %s", resp.Status)
+	}
+
+	return nil
+}
+
+// envelope encodes an event as an envelope of one item, in Sentry's event
+// format.
+//
+// SEE https://develop.sentry.dev/sdk/event-payloads/
+func (r *sentryReporter) envelope(event Event) ([]byte, error) {
+	frames := make([]map[string]any, 0, len(event.Stack))
+	for _, f := range event.Stack {
+		frames = append(frames, map[string]any{
+			"function": f.Function,
+			"abs_path": f.File,
+			"lineno":   f.Line,
+			"in_app":   strings.HasPrefix(f.Function, "github.com/jclem/jclem.me/"),
+		})
+	}
+
+	payload := map[string]any{
+		"event_id":    event.ID,
+		"timestamp":   event.Timestamp.Format(time.RFC3339Nano),
+		"platform":    "go",
+		"level":       event.Level,
+		"environment": r.environment,
+		"message":     event.Message,
+		"tags":        event.Tags,
+		"exception": map[string]any{
+			"values": []map[string]any{{
+				"type":       event.ErrorType,
+				"value":      event.Error,
+				"stacktrace": map[string]any{"frames": frames},
+			}},
+		},
+	}
+
+	if event.Request != nil {
+		payload["request"] = map[string]any{
+			"method":  event.Request.Method,
+			"url":     event.Request.Path,
+			"headers": map[string]string{"Host": event.Request.Host},
+		}
+		payload["tags"] = withTag(event.Tags, "request_id", event.Request.ID)
+	}
+
+	if event.User != nil {
+		payload["user"] = map[string]any{"id": event.User.ID, "username": event.User.Username}
+	}
+
+	item, err := json.Marshal(payload)
+	if err != nil {
+		return nil, fmt.Errorf("error encoding event: %w", err)
+	}
+
+	var buf bytes.Buffer
+
+	//nolint:errchkjson
+	_ = json.NewEncoder(&buf).Encode(map[string]any{
+		"event_id": event.ID,
+		"sent_at":  time.Now().UTC().Format(time.RFC3339Nano),
+		"dsn":      r.dsn,
+	})
+	_ = json.NewEncoder(&buf).Encode(map[string]any{"type": "event", "length": len(item)}) //nolint:errchkjson
+
+	buf.Write(item)
+	buf.WriteByte('\n')
+
+	return buf.Bytes(), nil
+}
+
+func withTag(tags map[string]string, key, value string) map[string]string {
+	if value == "" {
+		return tags
+	}
+
+	tagged := maps.Clone(tags)
+	if tagged == nil {
+		tagged = map[string]string{}
+	}
+
+	tagged[key] = value
+
+	return tagged
+}
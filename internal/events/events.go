@@ -0,0 +1,232 @@
+// Package events publishes notifications of new content, such as notes and
+// followers, to subscribers in this process and, through Postgres, in others,
+// such as streams of server-sent events.
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// A Type identifies a kind of event.
+type Type = string
+
+const (
+	// NoteCreated is published when a user posts a note.
+	NoteCreated Type = "note.created"
+
+	// DispatchCreated is published when a dispatch is ready to be shown.
+	DispatchCreated Type = "dispatch.created"
+
+	// FollowerCreated is published when a remote actor follows a user.
+	FollowerCreated Type = "follower.created"
+
+	// ReplyReceived is published when a remote actor replies to a user's note.
+	ReplyReceived Type = "reply.received"
+
+	// UserChanged is published when a user is updated or deleted, so that
+	// every process forgets the copy of them it has cached.
+	UserChanged Type = "user.changed"
+
+	// PostChanged is published when a stored post is created, updated, or
+	// published, so that every process serving posts reloads them.
+	PostChanged Type = "post.changed"
+)
+
+// An Event notifies subscribers of new content.
+type Event struct {
+	Type      Type           `json:"type"`
+	CreatedAt time.Time      `json:"created_at"`
+	Data      map[string]any `json:"data"`
+}
+
+// New creates a new event of the given type.
+func New(typ Type, data map[string]any) Event {
+	return Event{
+		Type:      typ,
+		CreatedAt: time.Now().UTC(),
+		Data:      data,
+	}
+}
+
+// Public returns true if anyone may be shown the event, such as on a live
+// timeline: dispatches, and notes which are listed publicly, as their "public"
+// data says. Followers and replies are only shown to the site's owner.
+func (e Event) Public() bool {
+	switch e.Type {
+	case DispatchCreated:
+		return true
+	case NoteCreated:
+		return e.Data["public"] == true
+	default:
+		return false
+	}
+}
+
+// channel is the Postgres channel on which events are notified.
+const channel = "events"
+
+// subscriberBuffer is how many events a subscriber may fall behind by before
+// further events are dropped for it, so that one slow subscriber cannot hold
+// up the others.
+const subscriberBuffer = 16
+
+// listenRetryDelay is how long Listen waits to listen again after its
+// connection fails.
+const listenRetryDelay = 5 * time.Second
+
+// A Broker delivers events to its subscribers. With a database, events are
+// notified through Postgres, so that they reach subscribers in every process
+// which listens, such as web processes, when they are published by another,
+// such as a worker. Without one, they reach only this process's subscribers.
+type Broker struct {
+	pool *pgxpool.Pool
+
+	mu          sync.Mutex
+	subscribers map[chan Event]struct{}
+	closed      bool
+}
+
+// NewBroker creates a new Broker which notifies events through Postgres, or,
+// if pool is nil, only within this process.
+func NewBroker(pool *pgxpool.Pool) *Broker {
+	return &Broker{pool: pool, subscribers: map[chan Event]struct{}{}}
+}
+
+// Subscribe returns a channel of events published from now on, and a function
+// which unsubscribes it, after which it receives none. The channel is closed
+// when it is unsubscribed or the broker is closed.
+func (b *Broker) Subscribe() (<-chan Event, func()) {
+	ch := make(chan Event, subscriberBuffer)
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.closed {
+		close(ch)
+		return ch, func() {}
+	}
+
+	b.subscribers[ch] = struct{}{}
+
+	return ch, func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+
+		if _, ok := b.subscribers[ch]; ok {
+			delete(b.subscribers, ch)
+			close(ch)
+		}
+	}
+}
+
+// Close closes every subscriber's channel, so that subscribers such as event
+// streams end, for example when the server shuts down. Channels subscribed
+// afterward are already closed, and events published afterward are delivered
+// to no one in this process.
+func (b *Broker) Close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.closed = true
+
+	for ch := range b.subscribers {
+		delete(b.subscribers, ch)
+		close(ch)
+	}
+}
+
+// Publish delivers an event to subscribers. Events are notifications, so a
+// caller which fails to publish one should log the error rather than fail.
+func (b *Broker) Publish(ctx context.Context, event Event) error {
+	if b.pool == nil {
+		b.deliver(event)
+		return nil
+	}
+
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to marshal event: %w", err)
+	}
+
+	if _, err := b.pool.Exec(ctx, "SELECT pg_notify($1, $2)", channel, string(payload)); err != nil {
+		return fmt.Errorf("failed to notify event: %w", err)
+	}
+
+	return nil
+}
+
+// deliver sends an event to this process's subscribers, skipping those which
+// have fallen behind.
+func (b *Broker) deliver(event Event) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for ch := range b.subscribers {
+		select {
+		case ch <- event:
+		default:
+		}
+	}
+}
+
+// Listen delivers events notified through Postgres to this process's
+// subscribers until ctx is done. If its connection fails, it listens again
+// after a delay. Without a database, it does nothing.
+func (b *Broker) Listen(ctx context.Context) {
+	if b.pool == nil {
+		return
+	}
+
+	for {
+		err := b.listen(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+
+		slog.ErrorContext(ctx, "error listening for events", "error", err)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(listenRetryDelay):
+		}
+	}
+}
+
+func (b *Broker) listen(ctx context.Context) error {
+	conn, err := b.pool.Acquire(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to acquire connection: %w", err)
+	}
+
+	// The connection is taken from the pool, and closed rather than returned
+	// to it, so that it does not go on listening.
+	pgConn := conn.Hijack()
+	defer pgConn.Close(context.Background()) //nolint:errcheck
+
+	if _, err := pgConn.Exec(ctx, "LISTEN "+channel); err != nil {
+		return fmt.Errorf("failed to listen: %w", err)
+	}
+
+	for {
+		n, err := pgConn.WaitForNotification(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to wait for notification: %w", err)
+		}
+
+		var event Event
+		if err := json.Unmarshal([]byte(n.Payload), &event); err != nil {
+			slog.ErrorContext(ctx, "ignoring malformed event", "error", err)
+			continue
+		}
+
+		b.deliver(event)
+	}
+}
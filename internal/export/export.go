@@ -0,0 +1,247 @@
+// Package export writes portable archives of a user's data.
+//
+// An archive is a zip file laid out like the archives other ActivityPub
+// servers export, such as Mastodon's: the actor and its outbox are ActivityPub
+// documents, so that they may be imported elsewhere. The site's own data, such
+// as posts and dispatches, is written alongside them as JSON. Media is listed
+// in a manifest of URLs rather than copied into the archive.
+package export
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"time"
+
+	ap "github.com/jclem/jclem.me/internal/activitypub"
+	"github.com/jclem/jclem.me/internal/activitypub/identity"
+	"github.com/jclem/jclem.me/internal/database"
+	"github.com/jclem/jclem.me/internal/dispatches"
+	"github.com/jclem/jclem.me/internal/images"
+	"github.com/jclem/jclem.me/internal/posts"
+)
+
+// The files in an archive.
+const (
+	ActorFile      = "actor.json"
+	OutboxFile     = "outbox.json"
+	FollowersFile  = "followers.json"
+	NotesFile      = "notes.json"
+	PostsFile      = "posts.json"
+	DispatchesFile = "dispatches.json"
+	MediaFile      = "media.json"
+)
+
+// An Exporter writes archives of users' data.
+type Exporter struct {
+	id         *identity.Service
+	pub        *ap.Service
+	dispatches *dispatches.Service
+	posts      *posts.Service
+	images     *images.Service
+}
+
+// New creates a new Exporter. The dispatches service may be nil, in which case
+// archives contain no dispatches.
+func New(id *identity.Service, pub *ap.Service, dispatches *dispatches.Service, posts *posts.Service, images *images.Service) *Exporter {
+	return &Exporter{id: id, pub: pub, dispatches: dispatches, posts: posts, images: images}
+}
+
+// FileName returns the name under which an archive of a user's data, written
+// at the given time, should be saved.
+func FileName(username string, at time.Time) string {
+	return fmt.Sprintf("%s-%s.zip", username, at.UTC().Format("20060102-150405"))
+}
+
+// A MediaItem is an image referenced by the user's data, and its variants.
+type MediaItem struct {
+	URL string `json:"url"`
+	images.Image
+}
+
+// Write writes an archive of the given user's data to w.
+func (e *Exporter) Write(ctx context.Context, w io.Writer, user identity.User) error {
+	pubKey, err := e.id.GetPublicKey(ctx, user.ID)
+	if err != nil {
+		return fmt.Errorf("error getting public key: %w", err)
+	}
+
+	actor, err := e.pub.Site().ActorFromUser(user, pubKey)
+	if err != nil {
+		return fmt.Errorf("error getting actor: %w", err)
+	}
+
+	outbox, err := e.outbox(ctx, user)
+	if err != nil {
+		return err
+	}
+
+	followers, err := e.followers(ctx, user)
+	if err != nil {
+		return err
+	}
+
+	notes, err := e.notes(ctx, user, actor)
+	if err != nil {
+		return err
+	}
+
+	dispatchList, err := e.listDispatches(ctx, user)
+	if err != nil {
+		return err
+	}
+
+	postList := e.posts.List(posts.WithDrafts(), posts.WithAuthor(user.Username))
+
+	archive := zip.NewWriter(w)
+
+	files := []struct {
+		name string
+		v    any
+	}{
+		{ActorFile, actor},
+		{OutboxFile, outbox},
+		{FollowersFile, followers},
+		{NotesFile, notes},
+		{PostsFile, postList},
+		{DispatchesFile, dispatchList},
+		{MediaFile, e.media(dispatchList)},
+	}
+
+	for _, f := range files {
+		if err := writeJSON(archive, f.name, f.v); err != nil {
+			return err
+		}
+	}
+
+	if err := archive.Close(); err != nil {
+		return fmt.Errorf("error closing archive: %w", err)
+	}
+
+	return nil
+}
+
+func (e *Exporter) outbox(ctx context.Context, user identity.User) (ap.OrderedCollection[json.RawMessage], error) {
+	records, _, err := e.pub.ListPublicOutbox(ctx, user.ID, 0, 0)
+	if err != nil {
+		return ap.OrderedCollection[json.RawMessage]{}, fmt.Errorf("error listing outbox: %w", err)
+	}
+
+	// Activities are exported as they were stored, so that nothing is lost in
+	// decoding them.
+	items := make([]json.RawMessage, 0, len(records))
+	for _, r := range records {
+		items = append(items, json.RawMessage(r.Data))
+	}
+
+	return ap.NewCollection(e.pub.Site().ActorOutbox(user), items), nil
+}
+
+func (e *Exporter) followers(ctx context.Context, user identity.User) (ap.OrderedCollection[string], error) {
+	records, err := e.pub.ListFollowers(ctx, user.ID)
+	if err != nil {
+		return ap.OrderedCollection[string]{}, fmt.Errorf("error listing followers: %w", err)
+	}
+
+	ids := make([]string, 0, len(records))
+	for _, r := range records {
+		ids = append(ids, r.ActorID)
+	}
+
+	return ap.NewCollection(e.pub.Site().ActorFollowers(user), ids), nil
+}
+
+func (e *Exporter) notes(ctx context.Context, user identity.User, actor ap.Actor) (ap.OrderedCollection[*ap.Note], error) {
+	records, err := e.pub.ListNotes(ctx, user.ID)
+	if err != nil {
+		return ap.OrderedCollection[*ap.Note]{}, fmt.Errorf("error listing notes: %w", err)
+	}
+
+	notes := make([]*ap.Note, 0, len(records))
+	for _, r := range records {
+		notes = append(notes, r.ToNote(actor))
+	}
+
+	// Notes are not served as a collection, so the collection is identified by
+	// its file.
+	return ap.NewCollection(NotesFile, notes), nil
+}
+
+// listDispatches lists all of the user's dispatches, in any status, a page at
+// a time.
+func (e *Exporter) listDispatches(ctx context.Context, user identity.User) ([]dispatches.Dispatch, error) {
+	if e.dispatches == nil {
+		return []dispatches.Dispatch{}, nil
+	}
+
+	const pageSize = 100
+
+	all := []dispatches.Dispatch{}
+
+	var before *database.ULID
+
+	for {
+		opts := []dispatches.ListOpt{dispatches.WithAuthor(user.Username), dispatches.WithAnyStatus(), dispatches.WithLimit(pageSize)}
+		if before != nil {
+			opts = append(opts, dispatches.WithBefore(*before))
+		}
+
+		page, err := e.dispatches.List(ctx, opts...)
+		if err != nil {
+			return nil, fmt.Errorf("error listing dispatches: %w", err)
+		}
+
+		all = append(all, page...)
+
+		if len(page) < pageSize {
+			return all, nil
+		}
+
+		before = &page[len(page)-1].ID
+	}
+}
+
+// media lists the images in posts and dispatches, sorted by URL.
+func (e *Exporter) media(dispatchList []dispatches.Dispatch) []MediaItem {
+	byURL := make(map[string]images.Image)
+
+	for url, img := range e.images.Manifest() {
+		byURL[url] = img
+	}
+
+	for _, d := range dispatchList {
+		if d.Image != nil {
+			byURL[d.URL] = *d.Image
+		}
+	}
+
+	items := make([]MediaItem, 0, len(byURL))
+	for url, img := range byURL {
+		items = append(items, MediaItem{URL: url, Image: img})
+	}
+
+	sort.Slice(items, func(i, j int) bool {
+		return items[i].URL < items[j].URL
+	})
+
+	return items
+}
+
+func writeJSON(archive *zip.Writer, name string, v any) error {
+	f, err := archive.Create(name)
+	if err != nil {
+		return fmt.Errorf("error creating %s: %w", name, err)
+	}
+
+	enc := json.NewEncoder(f)
+	enc.SetIndent("", "\t")
+
+	if err := enc.Encode(v); err != nil {
+		return fmt.Errorf("error writing %s: %w", name, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,126 @@
+package images
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/jclem/jclem.me/internal/storage"
+)
+
+// DirectUploadExpiry is how long a presigned direct upload URL is accepted.
+const DirectUploadExpiry = 15 * time.Minute
+
+// MaxUploadBytes is the size of the largest image which may be uploaded.
+const MaxUploadBytes = MaxSourceBytes
+
+// ErrUnsupportedType is returned when presigning an upload of something which
+// is not a GIF, JPEG, or PNG image.
+var ErrUnsupportedType = errors.New("unsupported image type")
+
+// ErrUploadNotFound is returned when processing an upload which was never
+// made, or which has already been discarded.
+var ErrUploadNotFound = errors.New("upload not found")
+
+// uploadTypes are the content types of images which may be uploaded directly.
+var uploadTypes = map[string]bool{ //nolint:gochecknoglobals
+	"image/gif":  true,
+	"image/jpeg": true,
+	"image/png":  true,
+}
+
+// PresignUpload returns a request with which a client may upload an image of
+// the given content type and size directly to storage under the given key.
+//
+// The uploaded image is private and unprocessed until it is processed with
+// ProcessUpload.
+func (s *Service) PresignUpload(ctx context.Context, key, contentType string, size int64) (storage.PresignedPut, error) {
+	if s.storage == nil {
+		return storage.PresignedPut{}, ErrNoProcessor
+	}
+
+	if !uploadTypes[contentType] {
+		return storage.PresignedPut{}, ErrUnsupportedType
+	}
+
+	if size <= 0 || size > MaxUploadBytes {
+		return storage.PresignedPut{}, ErrTooLarge
+	}
+
+	put, err := s.storage.PresignPut(ctx, key, contentType, size, DirectUploadExpiry)
+	if err != nil {
+		return storage.PresignedPut{}, fmt.Errorf("error presigning upload: %w", err)
+	}
+
+	return put, nil
+}
+
+// Stage stores an image under the given key, unprocessed and private, so that
+// it may be processed later with ProcessUpload. It only checks that the image
+// is not too large and looks like a GIF, JPEG, or PNG image.
+func (s *Service) Stage(ctx context.Context, key string, r io.Reader) error {
+	if s.storage == nil {
+		return ErrNoProcessor
+	}
+
+	b, err := io.ReadAll(io.LimitReader(r, MaxSourceBytes+1))
+	if err != nil {
+		return fmt.Errorf("error reading image: %w", err)
+	}
+
+	if len(b) > MaxSourceBytes {
+		return ErrTooLarge
+	}
+
+	contentType := http.DetectContentType(b)
+	if !uploadTypes[contentType] {
+		return ErrInvalidImage
+	}
+
+	if err := s.storage.PutPrivate(ctx, key, contentType, bytes.NewReader(b)); err != nil {
+		return fmt.Errorf("error staging image: %w", err)
+	}
+
+	return nil
+}
+
+// ProcessUpload processes an image uploaded directly to storage, or staged,
+// under the given upload key, storing it under the given key as Upload does.
+//
+// The unprocessed upload is left in place, so that processing may be retried,
+// until it is deleted with DiscardUpload.
+func (s *Service) ProcessUpload(ctx context.Context, uploadKey, key string) (string, Image, error) {
+	if s.storage == nil {
+		return "", Image{}, ErrNoProcessor
+	}
+
+	body, err := s.storage.Get(ctx, uploadKey)
+	if err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			return "", Image{}, ErrUploadNotFound
+		}
+
+		return "", Image{}, fmt.Errorf("error getting upload: %w", err)
+	}
+
+	defer body.Close()
+
+	return s.Upload(ctx, key, body)
+}
+
+// DiscardUpload deletes an unprocessed upload.
+func (s *Service) DiscardUpload(ctx context.Context, uploadKey string) error {
+	if s.storage == nil {
+		return ErrNoProcessor
+	}
+
+	if err := s.storage.Delete(ctx, uploadKey); err != nil {
+		return fmt.Errorf("error deleting upload: %w", err)
+	}
+
+	return nil
+}
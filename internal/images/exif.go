@@ -0,0 +1,140 @@
+package images
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+
+	"golang.org/x/image/draw"
+)
+
+// exifOrientationTag is the EXIF tag which records how a camera was held when
+// it took a photo.
+const exifOrientationTag = 0x0112
+
+// orientation returns the EXIF orientation of the given JPEG, from 1 to 8, or
+// 1 if it has none.
+//
+// SEE https://www.cipa.jp/std/documents/e/DC-008-2012_E.pdf
+func orientation(b []byte) int {
+	if len(b) < 4 || b[0] != 0xFF || b[1] != 0xD8 {
+		return 1
+	}
+
+	for i := 2; i+4 <= len(b); {
+		if b[i] != 0xFF {
+			return 1
+		}
+
+		marker := b[i+1]
+		size := int(binary.BigEndian.Uint16(b[i+2:]))
+
+		// Start of scan: the metadata segments are over.
+		if marker == 0xDA || size < 2 || i+2+size > len(b) {
+			return 1
+		}
+
+		segment := b[i+4 : i+2+size]
+
+		if marker == 0xE1 && bytes.HasPrefix(segment, []byte("Exif\x00\x00")) {
+			return tiffOrientation(segment[6:])
+		}
+
+		i += 2 + size
+	}
+
+	return 1
+}
+
+// tiffOrientation reads the orientation from the first IFD of the TIFF
+// structure in an EXIF segment.
+func tiffOrientation(tiff []byte) int {
+	if len(tiff) < 8 {
+		return 1
+	}
+
+	var order binary.ByteOrder
+
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return 1
+	}
+
+	ifd := int(order.Uint32(tiff[4:]))
+	if ifd+2 > len(tiff) {
+		return 1
+	}
+
+	count := int(order.Uint16(tiff[ifd:]))
+
+	for i := 0; i < count; i++ {
+		entry := ifd + 2 + i*12
+		if entry+12 > len(tiff) {
+			return 1
+		}
+
+		if order.Uint16(tiff[entry:]) != exifOrientationTag {
+			continue
+		}
+
+		if o := int(order.Uint16(tiff[entry+8:])); o >= 1 && o <= 8 {
+			return o
+		}
+
+		return 1
+	}
+
+	return 1
+}
+
+// orient transforms an image so that it displays upright given its EXIF
+// orientation.
+func orient(src image.Image, o int) image.Image {
+	if o <= 1 || o > 8 {
+		return src
+	}
+
+	b := src.Bounds()
+	rgba := image.NewRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+	draw.Draw(rgba, rgba.Bounds(), src, b.Min, draw.Src)
+
+	w, h := b.Dx(), b.Dy()
+
+	dw, dh := w, h
+	if o >= 5 {
+		dw, dh = h, w
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			var dx, dy int
+
+			switch o {
+			case 2: // Mirrored horizontally.
+				dx, dy = w-1-x, y
+			case 3: // Rotated 180°.
+				dx, dy = w-1-x, h-1-y
+			case 4: // Mirrored vertically.
+				dx, dy = x, h-1-y
+			case 5: // Transposed.
+				dx, dy = y, x
+			case 6: // Rotated 90° clockwise.
+				dx, dy = h-1-y, x
+			case 7: // Transversed.
+				dx, dy = h-1-y, w-1-x
+			case 8: // Rotated 90° counterclockwise.
+				dx, dy = y, w-1-x
+			}
+
+			copy(dst.Pix[dst.PixOffset(dx, dy):][:4], rgba.Pix[rgba.PixOffset(x, y):][:4])
+		}
+	}
+
+	return dst
+}
@@ -0,0 +1,336 @@
+// Package images generates and tracks resized variants of images, so that
+// pages can serve images at the size they are displayed.
+package images
+
+import (
+	"bytes"
+	"context"
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	_ "image/gif" // Register the GIF decoder.
+	"image/jpeg"
+	"image/png"
+	"io"
+	"net/http"
+	"path"
+	"strings"
+	"sync"
+
+	"github.com/Masterminds/squirrel"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/jclem/jclem.me/internal/storage"
+	"github.com/jclem/jclem.me/internal/telemetry"
+	"golang.org/x/image/draw"
+)
+
+// Widths are the widths of the variants generated for each image. Variants
+// are only generated at widths smaller than the original.
+var Widths = []int{480, 960, 1440} //nolint:gochecknoglobals
+
+// MaxSourceBytes is the largest image which will be downloaded for resizing,
+// or accepted as an upload.
+const MaxSourceBytes = 32 << 20
+
+// An Image is an image and its resized variants.
+type Image struct {
+	Width    int       `json:"width"`
+	Height   int       `json:"height"`
+	Variants []Variant `json:"variants"`
+
+	// Thumbnail is the URL of a small, square crop of the image. Only uploaded
+	// images have thumbnails.
+	Thumbnail string `json:"thumbnail,omitempty"`
+}
+
+// A Variant is a resized copy of an image.
+type Variant struct {
+	URL   string `json:"url"`
+	Width int    `json:"width"`
+}
+
+// A Manifest maps the URLs of original images to their variants.
+type Manifest map[string]Image
+
+// manifestFile holds the variants of images in embedded content. It is written
+// by the "images generate" command.
+//
+//go:embed manifest.json
+var manifestFile []byte
+
+// ErrNoProcessor is returned when processing images without storage
+// configured.
+var ErrNoProcessor = errors.New("image processing is not configured")
+
+// A Service looks up the variants of images, and generates variants of new
+// images.
+//
+// Variants of embedded images are read from the embedded manifest. Variants of
+// images generated at runtime are stored in Postgres, if a pool is given.
+type Service struct {
+	pool    *pgxpool.Pool
+	sql     squirrel.StatementBuilderType
+	storage *storage.Client
+
+	mu       sync.RWMutex
+	manifest Manifest
+}
+
+// New returns a new images service. The pool and storage client may be nil, in
+// which case no variants are generated at runtime.
+func New(pool *pgxpool.Pool, storage *storage.Client) (*Service, error) {
+	manifest := make(Manifest)
+	if err := json.Unmarshal(manifestFile, &manifest); err != nil {
+		return nil, fmt.Errorf("error unmarshaling image manifest: %w", err)
+	}
+
+	return &Service{
+		pool:     pool,
+		sql:      squirrel.StatementBuilder.PlaceholderFormat(squirrel.Dollar),
+		storage:  storage,
+		manifest: manifest,
+	}, nil
+}
+
+// Start loads the variants of images generated at runtime.
+func (s *Service) Start(ctx context.Context) error {
+	if s.pool == nil {
+		return nil
+	}
+
+	query, args, err := s.sql.
+		Select(imagesSourceColumn, imagesImageColumn).
+		From(imagesTable).
+		ToSql()
+	if err != nil {
+		return fmt.Errorf("could not build query: %w", err)
+	}
+
+	rows, err := s.pool.Query(ctx, query, args...)
+	if err != nil {
+		return fmt.Errorf("could not query images: %w", err)
+	}
+
+	defer rows.Close()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for rows.Next() {
+		var (
+			source string
+			img    Image
+		)
+
+		if err := rows.Scan(&source, &img); err != nil {
+			return fmt.Errorf("could not scan image: %w", err)
+		}
+
+		s.manifest[source] = img
+	}
+
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("could not read images: %w", err)
+	}
+
+	return nil
+}
+
+// Lookup returns the variants of the image at the given URL, if any have been
+// generated.
+func (s *Service) Lookup(url string) (Image, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	img, ok := s.manifest[url]
+
+	return img, ok
+}
+
+// Manifest returns a copy of the known image variants.
+func (s *Service) Manifest() Manifest {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	manifest := make(Manifest, len(s.manifest))
+	for url, img := range s.manifest {
+		manifest[url] = img
+	}
+
+	return manifest
+}
+
+// Prepare generates variants of each of the given images which has none,
+// storing them so that they are known after a restart. Images which are not in
+// the storage bucket are skipped, since their variants could not be served
+// from the same place.
+func (s *Service) Prepare(ctx context.Context, urls []string) error {
+	if s.storage == nil {
+		return ErrNoProcessor
+	}
+
+	for _, url := range urls {
+		if _, ok := s.Lookup(url); ok {
+			continue
+		}
+
+		if _, ok := s.storage.Key(url); !ok {
+			continue
+		}
+
+		img, err := s.Process(ctx, url)
+		if err != nil {
+			return err
+		}
+
+		if err := s.save(ctx, url, img); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (s *Service) save(ctx context.Context, url string, img Image) error {
+	if s.pool != nil {
+		query, args, err := s.sql.
+			Insert(imagesTable).
+			Columns(imagesSourceColumn, imagesImageColumn).
+			Values(url, img).
+			Suffix("ON CONFLICT (" + imagesSourceColumn + ") DO UPDATE SET " + imagesImageColumn + " = EXCLUDED." + imagesImageColumn).
+			ToSql()
+		if err != nil {
+			return fmt.Errorf("could not build query: %w", err)
+		}
+
+		if _, err := s.pool.Exec(ctx, query, args...); err != nil {
+			return fmt.Errorf("could not save image: %w", err)
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.manifest[url] = img
+
+	return nil
+}
+
+// Process downloads the image at the given URL, which must be in the storage
+// bucket, and uploads resized variants of it alongside the original.
+func (s *Service) Process(ctx context.Context, url string) (Image, error) {
+	if s.storage == nil {
+		return Image{}, ErrNoProcessor
+	}
+
+	key, ok := s.storage.Key(url)
+	if !ok {
+		return Image{}, fmt.Errorf("image is not in storage: %s", url)
+	}
+
+	src, format, err := download(ctx, url)
+	if err != nil {
+		return Image{}, err
+	}
+
+	bounds := src.Bounds()
+	img := Image{Width: bounds.Dx(), Height: bounds.Dy()}
+
+	img.Variants, err = s.putVariants(ctx, strings.TrimSuffix(key, path.Ext(key)), src, format)
+	if err != nil {
+		return Image{}, err
+	}
+
+	return img, nil
+}
+
+// putVariants uploads resized variants of an image at each of Widths smaller
+// than it. Their keys are the given base key with a width suffix.
+func (s *Service) putVariants(ctx context.Context, base string, src image.Image, format string) ([]Variant, error) {
+	bounds := src.Bounds()
+
+	var variants []Variant
+
+	for _, width := range Widths {
+		if width >= bounds.Dx() {
+			break
+		}
+
+		height := bounds.Dy() * width / bounds.Dx()
+		dst := image.NewRGBA(image.Rect(0, 0, width, height))
+		draw.CatmullRom.Scale(dst, dst.Bounds(), src, bounds, draw.Src, nil)
+
+		body, contentType, variantExt, err := encode(dst, format)
+		if err != nil {
+			return nil, err
+		}
+
+		variantURL, err := s.storage.Put(ctx, fmt.Sprintf("%s-%dw%s", base, width, variantExt), contentType, bytes.NewReader(body))
+		if err != nil {
+			return nil, fmt.Errorf("error uploading %dw variant of %s: %w", width, base, err)
+		}
+
+		variants = append(variants, Variant{URL: variantURL, Width: width})
+	}
+
+	return variants, nil
+}
+
+func download(ctx context.Context, url string) (image.Image, string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, "", fmt.Errorf("error creating request: %w", err)
+	}
+
+	resp, err := telemetry.HTTPClient.Do(req)
+	if err != nil {
+		return nil, "", fmt.Errorf("error downloading image: %w", err)
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, "", fmt.Errorf("error downloading image %s: %s", url, resp.Status)
+	}
+
+	b, err := io.ReadAll(io.LimitReader(resp.Body, MaxSourceBytes))
+	if err != nil {
+		return nil, "", fmt.Errorf("error reading image: %w", err)
+	}
+
+	img, format, err := image.Decode(bytes.NewReader(b))
+	if err != nil {
+		return nil, "", fmt.Errorf("error decoding image %s: %w", url, err)
+	}
+
+	return img, format, nil
+}
+
+// encode encodes a variant in the format of its original. GIFs are encoded as
+// PNGs, since resizing would discard their animation anyway.
+//
+// It returns the encoded image, its content type, and its file extension.
+func encode(img image.Image, format string) ([]byte, string, string, error) {
+	var buf bytes.Buffer
+
+	switch format {
+	case "jpeg":
+		if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: 85}); err != nil {
+			return nil, "", "", fmt.Errorf("error encoding jpeg: %w", err)
+		}
+
+		return buf.Bytes(), "image/jpeg", ".jpg", nil
+	default:
+		if err := png.Encode(&buf, img); err != nil {
+			return nil, "", "", fmt.Errorf("error encoding png: %w", err)
+		}
+
+		return buf.Bytes(), "image/png", ".png", nil
+	}
+}
+
+const imagesTable = "images"
+const imagesSourceColumn = "source_url"
+const imagesImageColumn = "image"
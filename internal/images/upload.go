@@ -0,0 +1,155 @@
+package images
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"io"
+
+	"github.com/Masterminds/squirrel"
+	"golang.org/x/image/draw"
+)
+
+// ThumbnailSize is the width and height of the square thumbnail of each
+// uploaded image.
+const ThumbnailSize = 400
+
+// ErrTooLarge is returned when uploading an image larger than the largest
+// image which may be processed.
+var ErrTooLarge = errors.New("image is too large")
+
+// ErrInvalidImage is returned when uploading something which is not a GIF,
+// JPEG, or PNG image.
+var ErrInvalidImage = errors.New("invalid image")
+
+// Upload stores an image under the given key, which has no extension, and
+// returns its public URL along with its resized variants and thumbnail.
+//
+// The image is decoded, turned upright according to its EXIF orientation, and
+// re-encoded before it is stored, so that none of its metadata (such as the
+// location at which a photo was taken) is published with it.
+func (s *Service) Upload(ctx context.Context, key string, r io.Reader) (string, Image, error) {
+	if s.storage == nil {
+		return "", Image{}, ErrNoProcessor
+	}
+
+	b, err := io.ReadAll(io.LimitReader(r, MaxSourceBytes+1))
+	if err != nil {
+		return "", Image{}, fmt.Errorf("error reading image: %w", err)
+	}
+
+	if len(b) > MaxSourceBytes {
+		return "", Image{}, ErrTooLarge
+	}
+
+	src, format, err := image.Decode(bytes.NewReader(b))
+	if err != nil {
+		return "", Image{}, fmt.Errorf("%w: %w", ErrInvalidImage, err)
+	}
+
+	if format == "jpeg" {
+		src = orient(src, orientation(b))
+	}
+
+	body, contentType, ext, err := encode(src, format)
+	if err != nil {
+		return "", Image{}, err
+	}
+
+	url, err := s.storage.Put(ctx, key+ext, contentType, bytes.NewReader(body))
+	if err != nil {
+		return "", Image{}, fmt.Errorf("error uploading %s: %w", key, err)
+	}
+
+	bounds := src.Bounds()
+	img := Image{Width: bounds.Dx(), Height: bounds.Dy()}
+
+	img.Variants, err = s.putVariants(ctx, key, src, format)
+	if err != nil {
+		return "", Image{}, err
+	}
+
+	thumb, _, thumbExt, err := encode(thumbnail(src), format)
+	if err != nil {
+		return "", Image{}, err
+	}
+
+	img.Thumbnail, err = s.storage.Put(ctx, key+"-thumb"+thumbExt, contentType, bytes.NewReader(thumb))
+	if err != nil {
+		return "", Image{}, fmt.Errorf("error uploading thumbnail of %s: %w", key, err)
+	}
+
+	if err := s.save(ctx, url, img); err != nil {
+		return "", Image{}, err
+	}
+
+	return url, img, nil
+}
+
+// thumbnail crops the center square of an image and scales it to
+// ThumbnailSize.
+func thumbnail(src image.Image) image.Image {
+	b := src.Bounds()
+
+	side := min(b.Dx(), b.Dy())
+	x := b.Min.X + (b.Dx()-side)/2
+	y := b.Min.Y + (b.Dy()-side)/2
+
+	size := min(side, ThumbnailSize)
+	dst := image.NewRGBA(image.Rect(0, 0, size, size))
+	draw.CatmullRom.Scale(dst, dst.Bounds(), src, image.Rect(x, y, x+side, y+side), draw.Src, nil)
+
+	return dst
+}
+
+// Remove deletes an image, along with the given variants and thumbnail of it,
+// from storage. Any of them which are not in the storage bucket are left
+// alone.
+func (s *Service) Remove(ctx context.Context, url string, img Image) error {
+	if s.storage == nil {
+		return ErrNoProcessor
+	}
+
+	urls := []string{url}
+	for _, v := range img.Variants {
+		urls = append(urls, v.URL)
+	}
+
+	if img.Thumbnail != "" {
+		urls = append(urls, img.Thumbnail)
+	}
+
+	for _, u := range urls {
+		key, ok := s.storage.Key(u)
+		if !ok {
+			continue
+		}
+
+		if err := s.storage.Delete(ctx, key); err != nil {
+			return fmt.Errorf("error deleting %s: %w", u, err)
+		}
+	}
+
+	if s.pool != nil {
+		query, args, err := s.sql.
+			Delete(imagesTable).
+			Where(squirrel.Eq{imagesSourceColumn: url}).
+			ToSql()
+		if err != nil {
+			return fmt.Errorf("could not build query: %w", err)
+		}
+
+		if _, err := s.pool.Exec(ctx, query, args...); err != nil {
+			return fmt.Errorf("could not delete image: %w", err)
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.manifest, url)
+
+	return nil
+}
@@ -0,0 +1,234 @@
+// Package linkcheck finds broken links in rendered pages.
+//
+// Internal links are resolved by serving them from the site's own handler, so
+// checking them makes no network requests. External links are requested over
+// HTTP.
+package linkcheck
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/jclem/jclem.me/internal/telemetry"
+)
+
+// concurrency is the number of external links requested at once.
+const concurrency = 8
+
+// requestTimeout is how long an external link is given to respond.
+const requestTimeout = 10 * time.Second
+
+var linkRegex = regexp.MustCompile(`(?i)<(?:a|img)\s[^>]*?(?:href|src)="([^"]+)"`)
+
+// A Page is a rendered page whose links are checked.
+type Page struct {
+	// Path is the path of the page on the site, such as "/writing/my-post".
+	Path string
+
+	// Content is the page's rendered HTML.
+	Content string
+}
+
+// A Result is the outcome of checking a link.
+type Result struct {
+	URL      string   `json:"url"`
+	Internal bool     `json:"internal"`
+	Status   int      `json:"status,omitempty"`
+	Error    string   `json:"error,omitempty"`
+	Pages    []string `json:"pages"`
+}
+
+// A Report lists the broken links found in a set of pages.
+type Report struct {
+	CheckedAt time.Time `json:"checked_at"`
+	Checked   int       `json:"checked"`
+	Broken    []Result  `json:"broken"`
+}
+
+// A Checker checks the links in pages of a site.
+type Checker struct {
+	site   http.Handler
+	host   string
+	client *http.Client
+}
+
+// NewChecker returns a Checker which resolves internal links with the given
+// handler. Links to the given host are internal, as are relative links.
+func NewChecker(site http.Handler, host string) *Checker {
+	return &Checker{
+		site:   site,
+		host:   host,
+		client: telemetry.HTTPClient,
+	}
+}
+
+// Check checks every link in the given pages, returning a report of those
+// which are broken.
+func (c *Checker) Check(ctx context.Context, pages []Page) Report {
+	links := c.collect(pages)
+
+	urls := make([]string, 0, len(links))
+	for u := range links {
+		urls = append(urls, u)
+	}
+
+	sort.Strings(urls)
+
+	var (
+		mu     sync.Mutex
+		wg     sync.WaitGroup
+		broken []Result
+		sem    = make(chan struct{}, concurrency)
+	)
+
+	for _, u := range urls {
+		link := links[u]
+
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			if link.Internal {
+				link.Status = c.checkInternal(ctx, link.URL)
+			} else {
+				link.Status, link.Error = c.checkExternal(ctx, link.URL)
+			}
+
+			if link.Error == "" && link.Status < http.StatusBadRequest {
+				return
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+
+			broken = append(broken, *link)
+		}()
+	}
+
+	wg.Wait()
+
+	sort.Slice(broken, func(i, j int) bool {
+		return broken[i].URL < broken[j].URL
+	})
+
+	return Report{
+		CheckedAt: time.Now().UTC(),
+		Checked:   len(urls),
+		Broken:    broken,
+	}
+}
+
+// collect finds the links in the given pages, keyed by their absolute URL or,
+// for internal links, their path.
+func (c *Checker) collect(pages []Page) map[string]*Result {
+	links := make(map[string]*Result)
+
+	for _, page := range pages {
+		base := &url.URL{Path: page.Path}
+
+		for _, m := range linkRegex.FindAllStringSubmatch(page.Content, -1) {
+			href, err := url.Parse(m[1])
+			if err != nil {
+				links[m[1]] = &Result{URL: m[1], Error: "invalid URL", Pages: []string{page.Path}}
+				continue
+			}
+
+			href = base.ResolveReference(href)
+			href.Fragment = ""
+
+			var (
+				key      string
+				internal bool
+			)
+
+			switch {
+			case href.Scheme != "" && href.Scheme != "http" && href.Scheme != "https":
+				// Links such as "mailto:" can't be checked.
+				continue
+			case href.Host == "" || href.Host == c.host:
+				if href.Path == page.Path && href.RawQuery == "" {
+					// A link to a fragment of the page itself.
+					continue
+				}
+
+				key, internal = href.RequestURI(), true
+			default:
+				key = href.String()
+			}
+
+			link, ok := links[key]
+			if !ok {
+				link = &Result{URL: key, Internal: internal}
+				links[key] = link
+			}
+
+			if !slices.Contains(link.Pages, page.Path) {
+				link.Pages = append(link.Pages, page.Path)
+			}
+		}
+	}
+
+	return links
+}
+
+func (c *Checker) checkInternal(ctx context.Context, path string) int {
+	req := httptest.NewRequest(http.MethodGet, path, nil).WithContext(ctx)
+	req.Host = c.host
+	req.Header.Set("Accept", "text/html")
+
+	rec := httptest.NewRecorder()
+	c.site.ServeHTTP(rec, req)
+
+	return rec.Code
+}
+
+func (c *Checker) checkExternal(ctx context.Context, u string) (int, string) {
+	status, err := c.request(ctx, http.MethodHead, u)
+
+	// Some servers don't support HEAD requests, or reject them outright.
+	if err == nil && (status == http.StatusMethodNotAllowed || status == http.StatusForbidden || status == http.StatusNotFound) {
+		status, err = c.request(ctx, http.MethodGet, u)
+	}
+
+	if err != nil {
+		return 0, err.Error()
+	}
+
+	return status, ""
+}
+
+func (c *Checker) request(ctx context.Context, method, u string) (int, error) {
+	ctx, cancel := context.WithTimeout(ctx, requestTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, method, u, nil)
+	if err != nil {
+		return 0, fmt.Errorf("error creating request: %w", err)
+	}
+
+	req.Header.Set("User-Agent", "jclem.me link checker")
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return 0, fmt.Errorf("error requesting link: %w", err)
+	}
+
+	defer resp.Body.Close()
+
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 1<<16))
+
+	return resp.StatusCode, nil
+}
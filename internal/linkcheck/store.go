@@ -0,0 +1,76 @@
+package linkcheck
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/Masterminds/squirrel"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// ErrNoReport is returned when no links have been checked yet.
+var ErrNoReport = errors.New("no link report")
+
+// A Store stores link reports in Postgres.
+type Store struct {
+	pool *pgxpool.Pool
+	sql  squirrel.StatementBuilderType
+}
+
+// NewStore returns a new Store.
+func NewStore(pool *pgxpool.Pool) *Store {
+	return &Store{
+		pool: pool,
+		sql:  squirrel.StatementBuilder.PlaceholderFormat(squirrel.Dollar),
+	}
+}
+
+// Save stores a report.
+func (s *Store) Save(ctx context.Context, report Report) error {
+	query, args, err := s.sql.
+		Insert(linkReportsTable).
+		Columns(linkReportsCheckedAtColumn, linkReportsReportColumn).
+		Values(report.CheckedAt, report).
+		ToSql()
+	if err != nil {
+		return fmt.Errorf("could not build query: %w", err)
+	}
+
+	if _, err := s.pool.Exec(ctx, query, args...); err != nil {
+		return fmt.Errorf("could not save link report: %w", err)
+	}
+
+	return nil
+}
+
+// Latest returns the most recent report.
+//
+// If no report has been saved, ErrNoReport is returned.
+func (s *Store) Latest(ctx context.Context) (Report, error) {
+	query, args, err := s.sql.
+		Select(linkReportsReportColumn).
+		From(linkReportsTable).
+		OrderBy(linkReportsCheckedAtColumn + " DESC").
+		Limit(1).
+		ToSql()
+	if err != nil {
+		return Report{}, fmt.Errorf("could not build query: %w", err)
+	}
+
+	var report Report
+	if err := s.pool.QueryRow(ctx, query, args...).Scan(&report); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return Report{}, ErrNoReport
+		}
+
+		return Report{}, fmt.Errorf("could not query link report: %w", err)
+	}
+
+	return report, nil
+}
+
+const linkReportsTable = "link_reports"
+const linkReportsCheckedAtColumn = "checked_at"
+const linkReportsReportColumn = "report"
@@ -0,0 +1,73 @@
+package linkcheck
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/jclem/jclem.me/internal/queues"
+	"github.com/jclem/jclem.me/internal/telemetry"
+	"github.com/riverqueue/river"
+)
+
+// checkInterval is how often links are checked.
+const checkInterval = 24 * time.Hour
+
+// CheckArgs are the arguments of a link check job.
+type CheckArgs struct{}
+
+// Kind implements the river.JobArgs interface.
+func (a CheckArgs) Kind() string {
+	return "check-links"
+}
+
+// InsertOpts implements the river.JobArgsWithInsertOpts interface.
+func (a CheckArgs) InsertOpts() river.InsertOpts {
+	return river.InsertOpts{Queue: queues.Periodic}
+}
+
+// PeriodicJob returns a periodic job which checks links daily.
+func PeriodicJob() *river.PeriodicJob {
+	return river.NewPeriodicJob(
+		river.PeriodicInterval(checkInterval),
+		func() (river.JobArgs, *river.InsertOpts) {
+			return CheckArgs{}, nil
+		},
+		&river.PeriodicJobOpts{RunOnStart: true},
+	)
+}
+
+// A Worker checks links and saves the report.
+type Worker struct {
+	river.WorkerDefaults[CheckArgs]
+	check func(context.Context) Report
+	store *Store
+}
+
+// NewWorker creates a new Worker, which checks links by calling check.
+func NewWorker(check func(context.Context) Report, store *Store) *Worker {
+	return &Worker{check: check, store: store}
+}
+
+// Timeout implements the river.Worker interface. Checking external links can
+// take much longer than River's default job timeout.
+func (w *Worker) Timeout(*river.Job[CheckArgs]) time.Duration {
+	return 10 * time.Minute
+}
+
+// Work implements the river.Worker interface.
+func (w *Worker) Work(ctx context.Context, job *river.Job[CheckArgs]) (err error) {
+	ctx, span := telemetry.StartJob(ctx, job.Kind, job.Attempt, nil)
+	defer func() { telemetry.End(span, err) }()
+
+	report := w.check(ctx)
+
+	if err := w.store.Save(ctx, report); err != nil {
+		return fmt.Errorf("failed to save link report: %w", err)
+	}
+
+	slog.InfoContext(ctx, "checked links", "checked", report.Checked, "broken", len(report.Broken))
+
+	return nil
+}
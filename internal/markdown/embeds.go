@@ -0,0 +1,282 @@
+package markdown
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/renderer"
+	"github.com/yuin/goldmark/text"
+	"github.com/yuin/goldmark/util"
+)
+
+// KindCallout is the kind of Callout nodes.
+var KindCallout = ast.NewNodeKind("Callout") //nolint:gochecknoglobals
+
+// A Callout is a blockquote which highlights a note or warning, written as:
+//
+//	> [!NOTE]
+//	> Callout content.
+type Callout struct {
+	ast.BaseBlock
+
+	// Variant is the lowercase type of the callout, such as "note".
+	Variant string
+}
+
+// Kind implements the ast.Node interface.
+func (n *Callout) Kind() ast.NodeKind {
+	return KindCallout
+}
+
+// Dump implements the ast.Node interface.
+func (n *Callout) Dump(source []byte, level int) {
+	ast.DumpHelper(n, source, level, map[string]string{"Variant": n.Variant}, nil)
+}
+
+// KindEmbed is the kind of Embed nodes.
+var KindEmbed = ast.NewNodeKind("Embed") //nolint:gochecknoglobals
+
+// An Embed is a link to embeddable media, such as a video, written as a bare
+// URL in a paragraph of its own.
+type Embed struct {
+	ast.BaseBlock
+
+	// Provider is the host of the media, such as "youtube".
+	Provider string
+
+	// ID identifies the media to the provider.
+	ID string
+
+	// URL is the URL of the media.
+	URL string
+}
+
+// Kind implements the ast.Node interface.
+func (n *Embed) Kind() ast.NodeKind {
+	return KindEmbed
+}
+
+// Dump implements the ast.Node interface.
+func (n *Embed) Dump(source []byte, level int) {
+	ast.DumpHelper(n, source, level, map[string]string{"Provider": n.Provider, "ID": n.ID}, nil)
+}
+
+// calloutTitles are the supported callout types and their titles.
+var calloutTitles = map[string]string{ //nolint:gochecknoglobals
+	"note":      "Note",
+	"tip":       "Tip",
+	"important": "Important",
+	"warning":   "Warning",
+	"caution":   "Caution",
+}
+
+var calloutMarkerRegex = regexp.MustCompile(`^\[!([A-Za-z]+)\]\s*$`)
+
+var (
+	youTubeIDRegex = regexp.MustCompile(`^[A-Za-z0-9_-]{11}$`)
+	gistPathRegex  = regexp.MustCompile(`^/[A-Za-z0-9-]+/[0-9a-f]+$`)
+)
+
+// embedTransformer replaces callout blockquotes with Callout nodes and
+// embeddable links with Embed nodes.
+type embedTransformer struct{}
+
+// Transform implements the parser.ASTTransformer interface.
+func (t *embedTransformer) Transform(doc *ast.Document, reader text.Reader, _ parser.Context) {
+	source := reader.Source()
+
+	var (
+		callouts []*ast.Blockquote
+		embeds   []*ast.Paragraph
+	)
+
+	//nolint:errcheck // The walker never returns an error.
+	ast.Walk(doc, func(node ast.Node, entering bool) (ast.WalkStatus, error) {
+		if !entering {
+			return ast.WalkContinue, nil
+		}
+
+		switch n := node.(type) {
+		case *ast.Blockquote:
+			callouts = append(callouts, n)
+		case *ast.Paragraph:
+			if _, ok := n.Parent().(*ast.Document); ok {
+				embeds = append(embeds, n)
+			}
+
+			return ast.WalkSkipChildren, nil
+		}
+
+		return ast.WalkContinue, nil
+	})
+
+	for _, bq := range callouts {
+		transformCallout(bq, source)
+	}
+
+	for _, p := range embeds {
+		transformEmbed(p, source)
+	}
+}
+
+func transformCallout(bq *ast.Blockquote, source []byte) {
+	para, ok := bq.FirstChild().(*ast.Paragraph)
+	if !ok || para.Lines().Len() == 0 {
+		return
+	}
+
+	line := para.Lines().At(0)
+
+	m := calloutMarkerRegex.FindSubmatch(line.Value(source))
+	if m == nil {
+		return
+	}
+
+	typ := strings.ToLower(string(m[1]))
+	if _, ok := calloutTitles[typ]; !ok {
+		return
+	}
+
+	// Remove the inline nodes of the marker line.
+	for c := para.FirstChild(); c != nil; {
+		next := c.NextSibling()
+
+		t, ok := c.(*ast.Text)
+		if !ok || t.Segment.Start >= line.Stop {
+			break
+		}
+
+		para.RemoveChild(para, c)
+		c = next
+	}
+
+	if !para.HasChildren() {
+		bq.RemoveChild(bq, para)
+	}
+
+	callout := &Callout{Variant: typ}
+
+	for c := bq.FirstChild(); c != nil; {
+		next := c.NextSibling()
+		callout.AppendChild(callout, c)
+		c = next
+	}
+
+	bq.Parent().ReplaceChild(bq.Parent(), bq, callout)
+}
+
+func transformEmbed(p *ast.Paragraph, source []byte) {
+	if p.ChildCount() != 1 {
+		return
+	}
+
+	link, ok := p.FirstChild().(*ast.AutoLink)
+	if !ok || link.AutoLinkType != ast.AutoLinkURL {
+		return
+	}
+
+	embed := parseEmbed(string(link.URL(source)))
+	if embed == nil {
+		return
+	}
+
+	p.Parent().ReplaceChild(p.Parent(), p, embed)
+}
+
+// parseEmbed returns an Embed for the given URL, or nil if it is not for
+// embeddable media.
+func parseEmbed(rawURL string) *Embed {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil
+	}
+
+	switch strings.TrimPrefix(u.Host, "www.") {
+	case "youtube.com", "m.youtube.com":
+		if id := u.Query().Get("v"); u.Path == "/watch" && youTubeIDRegex.MatchString(id) {
+			return &Embed{Provider: "youtube", ID: id, URL: rawURL}
+		}
+	case "youtu.be":
+		if id := strings.TrimPrefix(u.Path, "/"); youTubeIDRegex.MatchString(id) {
+			return &Embed{Provider: "youtube", ID: id, URL: rawURL}
+		}
+	case "gist.github.com":
+		if gistPathRegex.MatchString(u.Path) {
+			return &Embed{Provider: "gist", ID: strings.TrimPrefix(u.Path, "/"), URL: rawURL}
+		}
+	}
+
+	return nil
+}
+
+type embedRenderer struct {
+	templates *template.Template
+}
+
+func (r *embedRenderer) RegisterFuncs(reg renderer.NodeRendererFuncRegisterer) {
+	reg.Register(KindCallout, r.renderCallout)
+	reg.Register(KindEmbed, r.renderEmbed)
+}
+
+func (r *embedRenderer) renderCallout(w util.BufWriter, _ []byte, node ast.Node, entering bool) (ast.WalkStatus, error) {
+	n, ok := node.(*Callout)
+	if !ok {
+		return ast.WalkStop, &WrongNodeError{Expected: "callout", Node: node}
+	}
+
+	name := "callout-end"
+	if entering {
+		name = "callout-start"
+	}
+
+	if err := r.execute(w, name, struct {
+		Variant string
+		Title   string
+	}{
+		Variant: n.Variant,
+		Title:   calloutTitles[n.Variant],
+	}); err != nil {
+		return ast.WalkStop, err
+	}
+
+	return ast.WalkContinue, nil
+}
+
+func (r *embedRenderer) renderEmbed(w util.BufWriter, _ []byte, node ast.Node, entering bool) (ast.WalkStatus, error) {
+	n, ok := node.(*Embed)
+	if !ok {
+		return ast.WalkStop, &WrongNodeError{Expected: "embed", Node: node}
+	}
+
+	if !entering {
+		return ast.WalkContinue, nil
+	}
+
+	if err := r.execute(w, "embed-"+n.Provider, n); err != nil {
+		return ast.WalkStop, err
+	}
+
+	return ast.WalkSkipChildren, nil
+}
+
+func (r *embedRenderer) execute(w util.BufWriter, name string, data any) error {
+	tmpl := r.templates.Lookup(name)
+	if tmpl == nil {
+		return ErrTemplateNotFound
+	}
+
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return fmt.Errorf("error executing %s template: %w", name, err)
+	}
+
+	_, _ = w.Write(buf.Bytes())
+
+	return nil
+}
@@ -37,11 +37,13 @@ func (r *figureRenderer) renderFigure(w util.BufWriter, source []byte, node ast.
 			_, _ = w.Write(util.EscapeHTML(n.Title))
 		}
 
+		_, _ = w.WriteString(`"`)
+
 		if n.Attributes() != nil {
 			html.RenderAttributes(w, n, html.ImageAttributeFilter)
 		}
 
-		_, _ = w.WriteString(`" />`)
+		_, _ = w.WriteString(` />`)
 
 		_, _ = w.WriteString("<figcaption>")
 		_, _ = w.Write(util.EscapeHTML(n.Text(source)))
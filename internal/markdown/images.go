@@ -0,0 +1,74 @@
+package markdown
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/jclem/jclem.me/internal/images"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/text"
+)
+
+// imageSizes tells browsers how wide post images are displayed: the full
+// width of the viewport on small screens, and the width of the content column
+// otherwise.
+const imageSizes = "(max-width: 768px) 100vw, 768px"
+
+// setImageVariants sets the srcset, sizes, and dimensions of each image in a
+// document which has resized variants.
+func setImageVariants(doc ast.Node, lookup func(url string) (images.Image, bool)) {
+	//nolint:errcheck // The walker never returns an error.
+	ast.Walk(doc, func(node ast.Node, entering bool) (ast.WalkStatus, error) {
+		n, ok := node.(*ast.Image)
+		if !ok || !entering {
+			return ast.WalkContinue, nil
+		}
+
+		img, ok := lookup(string(n.Destination))
+		if !ok {
+			return ast.WalkSkipChildren, nil
+		}
+
+		if len(img.Variants) > 0 {
+			srcset := make([]string, 0, len(img.Variants)+1)
+			for _, v := range img.Variants {
+				srcset = append(srcset, fmt.Sprintf("%s %dw", v.URL, v.Width))
+			}
+
+			srcset = append(srcset, fmt.Sprintf("%s %dw", n.Destination, img.Width))
+
+			n.SetAttributeString("srcset", []byte(strings.Join(srcset, ", ")))
+			n.SetAttributeString("sizes", []byte(imageSizes))
+		}
+
+		n.SetAttributeString("width", []byte(fmt.Sprint(img.Width)))
+		n.SetAttributeString("height", []byte(fmt.Sprint(img.Height)))
+		n.SetAttributeString("loading", []byte("lazy"))
+		n.SetAttributeString("decoding", []byte("async"))
+
+		return ast.WalkSkipChildren, nil
+	})
+}
+
+// ImageURLs returns the URLs of the images in a Markdown document.
+func ImageURLs(source []byte) ([]string, error) {
+	gm, err := converter()
+	if err != nil {
+		return nil, err
+	}
+
+	var urls []string
+
+	doc := gm.Parser().Parse(text.NewReader(source))
+
+	//nolint:errcheck // The walker never returns an error.
+	ast.Walk(doc, func(node ast.Node, entering bool) (ast.WalkStatus, error) {
+		if n, ok := node.(*ast.Image); ok && entering {
+			urls = append(urls, string(n.Destination))
+		}
+
+		return ast.WalkContinue, nil
+	})
+
+	return urls, nil
+}
@@ -1,5 +1,5 @@
 // Package markdown provides a general service for loading Markdown documents
-// from an embed.FS.
+// from a file system.
 package markdown
 
 import (
@@ -8,12 +8,15 @@ import (
 	"fmt"
 	"html/template"
 	"io/fs"
+	"sync"
 
+	"github.com/jclem/jclem.me/internal/images"
 	"github.com/yuin/goldmark"
 	"github.com/yuin/goldmark/extension"
 	"github.com/yuin/goldmark/parser"
 	"github.com/yuin/goldmark/renderer"
 	"github.com/yuin/goldmark/renderer/html"
+	"github.com/yuin/goldmark/text"
 	"github.com/yuin/goldmark/util"
 	"go.abhg.dev/goldmark/frontmatter"
 )
@@ -44,22 +47,48 @@ var renderTemplates embed.FS
 type Document struct {
 	Frontmatter *frontmatter.Data
 	Content     string
+
+	// WordCount is the number of words in the document's prose.
+	WordCount int
+
+	// TOC is the document's table of contents.
+	TOC []Heading
 }
 
 // A service provides access to Markdown documents.
 type Service struct {
-	fs   embed.FS
+	fs   fs.FS
+	opts []RenderOpt
 	Data map[string]Document
 }
 
-// New creates a new Markdown service with the given embed.FS.
-func New(content embed.FS) *Service {
+// New creates a new Markdown service which reads documents from the root of
+// the given file system. Documents are rendered with the given options when
+// they are loaded.
+func New(content fs.FS, opts ...RenderOpt) *Service {
 	return &Service{
 		fs:   content,
+		opts: opts,
 		Data: make(map[string]Document),
 	}
 }
 
+type renderOpts struct {
+	images func(url string) (images.Image, bool)
+}
+
+// A RenderOpt configures how a document is rendered.
+type RenderOpt func(*renderOpts)
+
+// WithImages renders images which have resized variants with a srcset, so
+// that browsers download the smallest suitable variant, and with their
+// dimensions, so that the page does not shift as they load.
+func WithImages(lookup func(url string) (images.Image, bool)) RenderOpt {
+	return func(o *renderOpts) {
+		o.images = lookup
+	}
+}
+
 // DocumentNotFoundError is returned when a document is not found.
 type DocumentNotFoundError struct {
 	Path string
@@ -82,19 +111,57 @@ func (s *Service) Get(path string) (Document, error) {
 	return doc, nil
 }
 
+// Load reads and renders every document in the file system, replacing any
+// previously loaded documents.
 func (s *Service) Load() error {
+	m, err := fs.Glob(s.fs, "*.md")
+	if err != nil {
+		return fmt.Errorf("error globbing markdown files: %w", err)
+	}
+
+	data := make(map[string]Document, len(m))
+
+	for _, path := range m {
+		b, err := fs.ReadFile(s.fs, path)
+		if err != nil {
+			return fmt.Errorf("error reading markdown file: %w", err)
+		}
+
+		doc, err := Render(b, s.opts...)
+		if err != nil {
+			return err
+		}
+
+		data[path] = doc
+	}
+
+	s.Data = data
+
+	return nil
+}
+
+// converter builds the Markdown converter once, on first use.
+var converter = sync.OnceValues(newConverter) //nolint:gochecknoglobals
+
+func newConverter() (goldmark.Markdown, error) {
 	tmpl, err := template.ParseFS(renderTemplates, "templates/*.html.tmpl")
 	if err != nil {
-		return fmt.Errorf("error parsing Markdown rendering templates: %w", err)
+		return nil, fmt.Errorf("error parsing Markdown rendering templates: %w", err)
 	}
 
-	gm := goldmark.New(
+	return goldmark.New(
 		goldmark.WithExtensions(
 			extension.NewFootnote(),
 			extension.NewTypographer(),
 			extension.NewLinkify(),
 			&frontmatter.Extender{},
 		),
+		goldmark.WithParserOptions(
+			parser.WithAutoHeadingID(),
+			parser.WithASTTransformers(
+				util.Prioritized(&embedTransformer{}, 100),
+			),
+		),
 		goldmark.WithRendererOptions(
 			html.WithUnsafe(),
 			renderer.WithNodeRenderers(
@@ -107,35 +174,44 @@ func (s *Service) Load() error {
 					&figureRenderer{
 						writer: html.DefaultWriter,
 					}, 200),
+				util.Prioritized(
+					&embedRenderer{
+						templates: tmpl,
+					}, 200),
 			),
 		),
-	)
+	), nil
+}
 
-	m, err := fs.Glob(s.fs, "*.md")
-	if err != nil {
-		return fmt.Errorf("error globbing markdown files: %w", err)
+// Render converts a Markdown document, which may begin with frontmatter, to
+// HTML.
+func Render(source []byte, opts ...RenderOpt) (Document, error) {
+	var o renderOpts
+	for _, opt := range opts {
+		opt(&o)
 	}
 
-	for _, path := range m {
-		pctx := parser.NewContext()
-
-		b, err := fs.ReadFile(s.fs, path)
-		if err != nil {
-			return fmt.Errorf("error reading markdown file: %w", err)
-		}
+	gm, err := converter()
+	if err != nil {
+		return Document{}, err
+	}
 
-		var buf bytes.Buffer
-		if err := gm.Convert(b, &buf, parser.WithContext(pctx)); err != nil {
-			return fmt.Errorf("error converting markdown: %w", err)
-		}
+	pctx := parser.NewContext()
+	doc := gm.Parser().Parse(text.NewReader(source), parser.WithContext(pctx))
 
-		fm := frontmatter.Get(pctx)
+	if o.images != nil {
+		setImageVariants(doc, o.images)
+	}
 
-		s.Data[path] = Document{
-			Frontmatter: fm,
-			Content:     buf.String(),
-		}
+	var buf bytes.Buffer
+	if err := gm.Renderer().Render(&buf, source, doc); err != nil {
+		return Document{}, fmt.Errorf("error converting markdown: %w", err)
 	}
 
-	return nil
+	return Document{
+		Frontmatter: frontmatter.Get(pctx),
+		Content:     buf.String(),
+		WordCount:   countWords(doc, source),
+		TOC:         tableOfContents(doc, source),
+	}, nil
 }
@@ -0,0 +1,45 @@
+package markdown
+
+import (
+	"math"
+	"strings"
+
+	"github.com/yuin/goldmark/ast"
+)
+
+// wordsPerMinute is the reading speed used to estimate reading time.
+const wordsPerMinute = 230
+
+// countWords counts the words in the text of a document, excluding code blocks
+// and raw HTML.
+func countWords(doc ast.Node, source []byte) int {
+	var count int
+
+	//nolint:errcheck // The walker never returns an error.
+	ast.Walk(doc, func(node ast.Node, entering bool) (ast.WalkStatus, error) {
+		if !entering {
+			return ast.WalkContinue, nil
+		}
+
+		switch n := node.(type) {
+		case *ast.FencedCodeBlock, *ast.CodeBlock, *ast.HTMLBlock, *ast.RawHTML:
+			return ast.WalkSkipChildren, nil
+		case *ast.Text:
+			count += len(strings.Fields(string(n.Segment.Value(source))))
+		}
+
+		return ast.WalkContinue, nil
+	})
+
+	return count
+}
+
+// ReadingMinutes estimates the number of minutes it takes to read the given
+// number of words. Any non-empty document takes at least a minute.
+func ReadingMinutes(words int) int {
+	if words == 0 {
+		return 0
+	}
+
+	return int(math.Ceil(float64(words) / wordsPerMinute))
+}
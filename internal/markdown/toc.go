@@ -0,0 +1,91 @@
+package markdown
+
+import (
+	"github.com/yuin/goldmark/ast"
+)
+
+// A Heading is an entry in a document's table of contents.
+type Heading struct {
+	Level    int       `json:"level"`
+	ID       string    `json:"id"`
+	Title    string    `json:"title"`
+	Children []Heading `json:"children,omitempty"`
+}
+
+// tableOfContents collects the headings of a document into a tree, in which
+// each heading's children are the deeper headings which follow it.
+//
+// Heading IDs are assigned by the parser from the heading text, so they are
+// stable as long as the heading text does not change.
+func tableOfContents(doc ast.Node, source []byte) []Heading {
+	var flat []Heading
+
+	//nolint:errcheck // The walker never returns an error.
+	ast.Walk(doc, func(node ast.Node, entering bool) (ast.WalkStatus, error) {
+		if !entering {
+			return ast.WalkContinue, nil
+		}
+
+		heading, ok := node.(*ast.Heading)
+		if !ok {
+			return ast.WalkContinue, nil
+		}
+
+		id, ok := heading.AttributeString("id")
+		if !ok {
+			return ast.WalkSkipChildren, nil
+		}
+
+		idBytes, ok := id.([]byte)
+		if !ok {
+			return ast.WalkSkipChildren, nil
+		}
+
+		flat = append(flat, Heading{
+			Level: heading.Level,
+			ID:    string(idBytes),
+			Title: string(heading.Text(source)),
+		})
+
+		return ast.WalkSkipChildren, nil
+	})
+
+	var toc []Heading
+
+	// A document may begin with deeper headings than follow them, so nesting
+	// may stop before the end of the list.
+	for i := 0; i < len(flat); {
+		var tree []Heading
+		tree, i = nestHeadings(flat, i)
+		toc = append(toc, tree...)
+	}
+
+	return toc
+}
+
+// nestHeadings builds a tree from the headings starting at index i, returning
+// the tree and the index of the first heading which does not belong in it.
+func nestHeadings(flat []Heading, i int) ([]Heading, int) {
+	var tree []Heading
+
+	if i >= len(flat) {
+		return tree, i
+	}
+
+	level := flat[i].Level
+
+	for i < len(flat) && flat[i].Level >= level {
+		if flat[i].Level > level && len(tree) > 0 {
+			var children []Heading
+			children, i = nestHeadings(flat, i)
+			tree[len(tree)-1].Children = append(tree[len(tree)-1].Children, children...)
+
+			continue
+		}
+
+		tree = append(tree, flat[i])
+		i++
+	}
+
+	return tree, i
+}
@@ -0,0 +1,170 @@
+package mastodon
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/url"
+	"slices"
+	"strings"
+
+	ap "github.com/jclem/jclem.me/internal/activitypub"
+	"github.com/jclem/jclem.me/internal/activitypub/identity"
+)
+
+// An AddressFunc returns the account address of an actor ID, such as
+// "user@example.com". It is the inverse of a ResolveFunc.
+type AddressFunc func(ctx context.Context, actorID string) (string, error)
+
+// followingHeader is the header of the CSV file in which Mastodon exports the
+// accounts a user follows, and followersHeader that of a list of followers.
+//
+//nolint:gochecknoglobals
+var (
+	followingHeader = []string{"Account address", "Show boosts", "Notify on new posts", "Languages"}
+	followersHeader = []string{"Account address"}
+)
+
+// ImportFollowing sends a Follow to each account listed in a CSV file which
+// the user does not already follow, other than the user. The Follows are
+// delivered by the server's jobs.
+func (i *Importer) ImportFollowing(ctx context.Context, user identity.User, r io.Reader) (Result, error) {
+	var result Result
+
+	following, err := i.pub.ListFollowing(ctx, user.ID)
+	if err != nil {
+		return result, fmt.Errorf("error listing following: %w", err)
+	}
+
+	result.UnresolvedFollowing, err = i.readAccounts(ctx, r, func(actorID string) error {
+		if actorID == i.pub.Site().ActorID(user) || slices.Contains(following, actorID) {
+			result.ExistingFollowing++
+			return nil
+		}
+
+		follow := ap.NewFollowActivity(i.pub.Site(), user, actorID)
+
+		j, err := json.Marshal(follow)
+		if err != nil {
+			return fmt.Errorf("error encoding follow: %w", err)
+		}
+
+		if _, err := i.pub.CreateActivity(ctx, user.ID, ap.Outbox, ap.ActivityStreamsContext, follow.Type, follow.ID, j); err != nil {
+			return fmt.Errorf("error following %q: %w", actorID, err)
+		}
+
+		following = append(following, actorID)
+		result.Following++
+
+		return nil
+	})
+
+	return result, err
+}
+
+// readAccounts calls fn with the actor ID of each account listed in a CSV
+// file, in the format in which Mastodon exports accounts, and returns how many
+// could not be resolved. The first column of each row is an account's
+// address, such as "user@example.com", or its actor ID. A header row is
+// skipped.
+func (i *Importer) readAccounts(ctx context.Context, r io.Reader, fn func(actorID string) error) (int, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+
+	rows, err := reader.ReadAll()
+	if err != nil {
+		return 0, fmt.Errorf("error reading accounts: %w", err)
+	}
+
+	var unresolved int
+
+	for n, row := range rows {
+		account := strings.TrimPrefix(strings.TrimSpace(row[0]), "@")
+		if account == "" || (n == 0 && strings.Contains(account, " ")) {
+			continue
+		}
+
+		actorID := account
+		if !strings.HasPrefix(account, "https://") {
+			actorID, err = i.resolve(ctx, account)
+			if err != nil {
+				slog.WarnContext(ctx, "could not resolve account", "account", account, "error", err)
+				unresolved++
+
+				continue
+			}
+		}
+
+		if err := fn(actorID); err != nil {
+			return unresolved, err
+		}
+	}
+
+	return unresolved, nil
+}
+
+// WriteFollowing writes the accounts with the given actor IDs as a CSV file of
+// follows, which Mastodon imports.
+func WriteFollowing(ctx context.Context, w io.Writer, actorIDs []string, address AddressFunc) error {
+	return writeAccounts(ctx, w, followingHeader, actorIDs, address, "true", "false", "")
+}
+
+// WriteFollowers writes the accounts with the given actor IDs as a CSV file of
+// followers, in the same format.
+func WriteFollowers(ctx context.Context, w io.Writer, actorIDs []string, address AddressFunc) error {
+	return writeAccounts(ctx, w, followersHeader, actorIDs, address)
+}
+
+// writeAccounts writes a CSV file whose rows are each account's address and
+// the given columns. An account whose address cannot be found is written as
+// its actor ID, which this server imports, but Mastodon does not.
+func writeAccounts(ctx context.Context, w io.Writer, header, actorIDs []string, address AddressFunc, columns ...string) error {
+	cw := csv.NewWriter(w)
+
+	if err := cw.Write(header); err != nil {
+		return fmt.Errorf("error writing accounts: %w", err)
+	}
+
+	for _, actorID := range actorIDs {
+		account, err := address(ctx, actorID)
+		if err != nil {
+			slog.WarnContext(ctx, "could not find account address", "actor_id", actorID, "error", err)
+			account = actorID
+		}
+
+		if err := cw.Write(append([]string{account}, columns...)); err != nil {
+			return fmt.Errorf("error writing accounts: %w", err)
+		}
+	}
+
+	cw.Flush()
+
+	if err := cw.Error(); err != nil {
+		return fmt.Errorf("error writing accounts: %w", err)
+	}
+
+	return nil
+}
+
+// Address returns the account address of an actor ID from the actor's
+// preferred username and the host of its ID, as Mastodon addresses accounts.
+func Address(ctx context.Context, actorID string) (string, error) {
+	u, err := url.Parse(actorID)
+	if err != nil {
+		return "", fmt.Errorf("invalid actor ID: %w", err)
+	}
+
+	actor, err := ap.GetActor(ctx, actorID)
+	if err != nil {
+		return "", fmt.Errorf("error getting actor: %w", err)
+	}
+
+	if actor.PreferredUsername == "" {
+		return "", fmt.Errorf("actor has no username: %q", actorID)
+	}
+
+	return actor.PreferredUsername + "@" + u.Host, nil
+}
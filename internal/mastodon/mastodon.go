@@ -0,0 +1,285 @@
+// Package mastodon imports the archives which Mastodon exports, so that a
+// user's post history moves to this server, and imports and exports lists of
+// accounts in Mastodon's CSV format, so that followers and follows move in
+// either direction.
+//
+// An archive's outbox.json holds the user's activities. Each public, unlisted,
+// or followers-only note is imported as one of the user's notes, as of when it
+// was published, and its media, under media_attachments, is uploaded and shown
+// below its content. Boosts and direct messages are skipped. Nothing imported
+// is delivered to followers.
+//
+// Mastodon exports the accounts a user follows, but not their followers, as
+// CSV. A list of followers in the same format may be imported as followers,
+// and each account in a list of follows is sent a Follow.
+package mastodon
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"io/fs"
+	"log/slog"
+	"mime"
+	"path"
+	"slices"
+	"strings"
+	"time"
+
+	ap "github.com/jclem/jclem.me/internal/activitypub"
+	"github.com/jclem/jclem.me/internal/activitypub/identity"
+	"github.com/jclem/jclem.me/internal/database"
+)
+
+// OutboxFile is the file in an archive which holds the user's activities.
+const OutboxFile = "outbox.json"
+
+// An Uploader stores media, returning its public URL. It is implemented by
+// storage.Client.
+type Uploader interface {
+	Put(ctx context.Context, key, contentType string, body io.Reader) (string, error)
+}
+
+// A ResolveFunc returns the actor ID of an account address, such as
+// "user@example.com".
+type ResolveFunc func(ctx context.Context, address string) (string, error)
+
+// An Importer imports archives into a user's notes and followers.
+type Importer struct {
+	pub     *ap.Service
+	media   Uploader
+	resolve ResolveFunc
+}
+
+// New creates a new Importer. If media is nil, media is not imported.
+func New(pub *ap.Service, media Uploader, resolve ResolveFunc) *Importer {
+	return &Importer{pub: pub, media: media, resolve: resolve}
+}
+
+// A Result counts what was imported.
+type Result struct {
+	// Notes were imported, and Existing notes had been imported before.
+	Notes    int `json:"notes"`
+	Existing int `json:"existing"`
+
+	// Skipped activities were not notes, or were direct messages.
+	Skipped int `json:"skipped"`
+
+	// Media was uploaded, and MissingMedia was referred to by a note but was
+	// not in the archive or could not be uploaded.
+	Media        int `json:"media"`
+	MissingMedia int `json:"missing_media"`
+
+	// Followers were imported, and UnresolvedFollowers could not be found.
+	Followers           int `json:"followers"`
+	UnresolvedFollowers int `json:"unresolved_followers"`
+
+	// Following were sent Follows, ExistingFollowing were already followed,
+	// and UnresolvedFollowing could not be found.
+	Following           int `json:"following"`
+	ExistingFollowing   int `json:"existing_following"`
+	UnresolvedFollowing int `json:"unresolved_following"`
+}
+
+// An outbox is the part of an archive's outbox which is imported.
+type outbox struct {
+	OrderedItems []json.RawMessage `json:"orderedItems"`
+}
+
+type activity struct {
+	ID     string          `json:"id"`
+	Type   string          `json:"type"`
+	Actor  string          `json:"actor"`
+	Object json.RawMessage `json:"object"`
+}
+
+type note struct {
+	ID         string       `json:"id"`
+	Type       string       `json:"type"`
+	Summary    string       `json:"summary"`
+	Content    string       `json:"content"`
+	Published  time.Time    `json:"published"`
+	To         []string     `json:"to"`
+	Cc         []string     `json:"cc"`
+	Attachment []attachment `json:"attachment"`
+}
+
+type attachment struct {
+	MediaType string `json:"mediaType"`
+	URL       string `json:"url"`
+	Name      string `json:"name"`
+}
+
+// Import imports the notes in an archive, such as an extracted Mastodon
+// export, and the followers listed in a CSV file as the user's. Either may be
+// nil.
+func (i *Importer) Import(ctx context.Context, user identity.User, archive fs.FS, followers io.Reader) (Result, error) {
+	var result Result
+
+	if archive != nil {
+		if err := i.importOutbox(ctx, user, archive, &result); err != nil {
+			return result, err
+		}
+	}
+
+	if followers != nil {
+		if err := i.importFollowers(ctx, user, followers, &result); err != nil {
+			return result, err
+		}
+	}
+
+	return result, nil
+}
+
+func (i *Importer) importOutbox(ctx context.Context, user identity.User, archive fs.FS, result *Result) error {
+	b, err := fs.ReadFile(archive, OutboxFile)
+	if err != nil {
+		return fmt.Errorf("error reading outbox: %w", err)
+	}
+
+	var box outbox
+	if err := json.Unmarshal(b, &box); err != nil {
+		return fmt.Errorf("error decoding outbox: %w", err)
+	}
+
+	for _, raw := range box.OrderedItems {
+		var a activity
+		if err := json.Unmarshal(raw, &a); err != nil {
+			return fmt.Errorf("error decoding activity: %w", err)
+		}
+
+		var n note
+		if a.Type != "Create" || json.Unmarshal(a.Object, &n) != nil || n.Type != "Note" {
+			result.Skipped++
+			continue
+		}
+
+		to, cc, ok := address(a.Actor+"/followers", i.pub.Site().ActorFollowers(user), n.To, n.Cc)
+		if !ok {
+			result.Skipped++
+			continue
+		}
+
+		content := n.Content
+		if n.Summary != "" {
+			content = "<p>" + html.EscapeString(n.Summary) + "</p>" + content
+		}
+
+		noteID := database.ULIDAt(n.Published, n.ID)
+
+		for _, att := range n.Attachment {
+			url, err := i.uploadMedia(ctx, archive, noteID, att)
+			if err != nil {
+				slog.WarnContext(ctx, "could not import media", "note_id", n.ID, "url", att.URL, "error", err)
+				result.MissingMedia++
+
+				continue
+			}
+
+			content += fmt.Sprintf(`<p><img src="%s" alt="%s"></p>`, html.EscapeString(url), html.EscapeString(att.Name))
+			result.Media++
+		}
+
+		_, created, err := i.pub.ImportNote(ctx, user, ap.ImportedNote{
+			SourceID:  n.ID,
+			Content:   content,
+			Published: n.Published,
+			To:        to,
+			Cc:        cc,
+		})
+		if err != nil {
+			return fmt.Errorf("error importing note %q: %w", n.ID, err)
+		}
+
+		if created {
+			result.Notes++
+		} else {
+			result.Existing++
+		}
+	}
+
+	return nil
+}
+
+// address returns a note's addressing with the source actor's followers
+// collection replaced by the user's. It returns false for direct messages,
+// which are addressed neither to the public nor to followers.
+func address(sourceFollowers, followers string, to, cc []string) ([]string, []string, bool) {
+	replace := func(ids []string) []string {
+		out := make([]string, len(ids))
+		for i, id := range ids {
+			if id == sourceFollowers {
+				id = followers
+			}
+
+			out[i] = id
+		}
+
+		return out
+	}
+
+	to, cc = replace(to), replace(cc)
+
+	all := append(slices.Clone(to), cc...)
+	if !slices.Contains(all, ap.PublicNS) && !slices.Contains(all, followers) {
+		return nil, nil, false
+	}
+
+	return to, cc, true
+}
+
+// errNoMedia is returned by uploadMedia if media is not imported.
+var errNoMedia = errors.New("media storage is not configured")
+
+// uploadMedia uploads an attachment from the archive, returning its URL.
+func (i *Importer) uploadMedia(ctx context.Context, archive fs.FS, noteID database.ULID, att attachment) (string, error) {
+	if i.media == nil {
+		return "", errNoMedia
+	}
+
+	name := strings.TrimPrefix(att.URL, "/")
+	if !fs.ValidPath(name) {
+		return "", fmt.Errorf("invalid media path: %q", att.URL)
+	}
+
+	f, err := archive.Open(name)
+	if err != nil {
+		return "", fmt.Errorf("error opening media: %w", err)
+	}
+
+	defer f.Close()
+
+	contentType := att.MediaType
+	if contentType == "" {
+		contentType = mime.TypeByExtension(path.Ext(name))
+	}
+
+	url, err := i.media.Put(ctx, fmt.Sprintf("imports/%s/%s", noteID, path.Base(name)), contentType, f)
+	if err != nil {
+		return "", fmt.Errorf("error uploading media: %w", err)
+	}
+
+	return url, nil
+}
+
+// importFollowers imports the accounts listed in a CSV file as the user's
+// followers.
+func (i *Importer) importFollowers(ctx context.Context, user identity.User, r io.Reader, result *Result) error {
+	unresolved, err := i.readAccounts(ctx, r, func(actorID string) error {
+		// There is no Follow activity, so one is named after the actor.
+		if _, err := i.pub.CreateFollower(ctx, user.ID, actorID, actorID+"#imported-follow"); err != nil {
+			return fmt.Errorf("error creating follower %q: %w", actorID, err)
+		}
+
+		result.Followers++
+
+		return nil
+	})
+
+	result.UnresolvedFollowers += unresolved
+
+	return err
+}
@@ -0,0 +1,405 @@
+// Package openapi describes HTTP APIs as OpenAPI 3.1 documents, with schemas
+// generated from the Go types which requests and responses are decoded into
+// and encoded from.
+//
+// SEE https://spec.openapis.org/oas/v3.1.0
+package openapi
+
+import (
+	"cmp"
+	"encoding"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Version is the version of the OpenAPI specification which documents follow.
+const Version = "3.1.0"
+
+// A Document is an OpenAPI document.
+type Document struct {
+	OpenAPI    string                `json:"openapi"`
+	Info       Info                  `json:"info"`
+	Servers    []Server              `json:"servers,omitempty"`
+	Paths      map[string]*PathItem  `json:"paths"`
+	Components Components            `json:"components"`
+	Security   []SecurityRequirement `json:"security,omitempty"`
+
+	// types maps the names of schema components to the types they describe.
+	types map[string]reflect.Type
+}
+
+// Info describes the API.
+type Info struct {
+	Title       string `json:"title"`
+	Description string `json:"description,omitempty"`
+	Version     string `json:"version"`
+}
+
+// A Server is a URL at which the API, or some of its paths, are served.
+type Server struct {
+	URL         string `json:"url"`
+	Description string `json:"description,omitempty"`
+}
+
+// A PathItem lists the operations on a path, by lowercase method.
+type PathItem struct {
+	Servers    []Server              `json:"servers,omitempty"`
+	Operations map[string]*Operation `json:"-"`
+}
+
+// MarshalJSON implements the json.Marshaler interface. Operations are written
+// as members of the path item, as the specification requires.
+func (p PathItem) MarshalJSON() ([]byte, error) {
+	m := make(map[string]any, len(p.Operations)+1)
+	for method, op := range p.Operations {
+		m[method] = op
+	}
+
+	if len(p.Servers) > 0 {
+		m["servers"] = p.Servers
+	}
+
+	return json.Marshal(m) //nolint:wrapcheck
+}
+
+// An Operation is one method on a path.
+type Operation struct {
+	OperationID string                `json:"operationId"`
+	Summary     string                `json:"summary"`
+	Description string                `json:"description,omitempty"`
+	Tags        []string              `json:"tags,omitempty"`
+	Parameters  []Parameter           `json:"parameters,omitempty"`
+	RequestBody *RequestBody          `json:"requestBody,omitempty"`
+	Responses   map[string]Response   `json:"responses"`
+	Security    []SecurityRequirement `json:"security,omitempty"`
+}
+
+// A Parameter is a path or query parameter.
+type Parameter struct {
+	Name        string  `json:"name"`
+	In          string  `json:"in"`
+	Description string  `json:"description,omitempty"`
+	Required    bool    `json:"required,omitempty"`
+	Schema      *Schema `json:"schema"`
+}
+
+// A RequestBody is an operation's request body, by media type.
+type RequestBody struct {
+	Required bool                 `json:"required,omitempty"`
+	Content  map[string]MediaType `json:"content"`
+}
+
+// A Response is a response to an operation, by media type.
+type Response struct {
+	Description string               `json:"description"`
+	Content     map[string]MediaType `json:"content,omitempty"`
+}
+
+// A MediaType is the schema of a body of one media type.
+type MediaType struct {
+	Schema *Schema `json:"schema"`
+}
+
+// Components holds the schemas which others refer to, and the security
+// schemes.
+type Components struct {
+	Schemas         map[string]*Schema        `json:"schemas"`
+	SecuritySchemes map[string]SecurityScheme `json:"securitySchemes,omitempty"`
+}
+
+// A SecurityScheme is a way of authenticating requests.
+type SecurityScheme struct {
+	Type        string `json:"type"`
+	Scheme      string `json:"scheme,omitempty"`
+	Description string `json:"description,omitempty"`
+}
+
+// A SecurityRequirement names the security schemes, and their scopes, which
+// an operation accepts.
+type SecurityRequirement map[string][]string
+
+// A Schema is a JSON Schema.
+type Schema struct {
+	Ref                  string             `json:"$ref,omitempty"`
+	Type                 any                `json:"type,omitempty"`
+	Format               string             `json:"format,omitempty"`
+	Description          string             `json:"description,omitempty"`
+	Enum                 []any              `json:"enum,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+	AdditionalProperties *Schema            `json:"additionalProperties,omitempty"`
+}
+
+// String describes the schema briefly, such as "array of Note", for
+// documentation.
+func (s *Schema) String() string {
+	switch {
+	case s == nil:
+		return ""
+	case s.Ref != "":
+		return s.ComponentName()
+	case s.Type == "array":
+		return "array of " + s.Items.String()
+	case s.Type == "object" && s.AdditionalProperties != nil:
+		return "map of " + s.AdditionalProperties.String()
+	case s.Type == nil:
+		return "any"
+	case s.Format != "":
+		return fmt.Sprintf("%v (%s)", s.Type, s.Format)
+	default:
+		return fmt.Sprint(s.Type)
+	}
+}
+
+// ComponentName returns the name of the component to which the schema refers,
+// if it refers to one.
+func (s *Schema) ComponentName() string {
+	return strings.TrimPrefix(s.Ref, "#/components/schemas/")
+}
+
+// New creates an empty Document.
+func New(info Info) *Document {
+	return &Document{
+		OpenAPI:    Version,
+		Info:       info,
+		Paths:      map[string]*PathItem{},
+		Components: Components{Schemas: map[string]*Schema{}},
+		types:      map[string]reflect.Type{},
+	}
+}
+
+// Add adds an operation on a path, such as "/users/{username}".
+func (d *Document) Add(method, path string, op *Operation) {
+	item, ok := d.Paths[path]
+	if !ok {
+		item = &PathItem{Operations: map[string]*Operation{}}
+		d.Paths[path] = item
+	}
+
+	item.Operations[strings.ToLower(method)] = op
+}
+
+// A MethodOperation is an operation with the method and path on which it is
+// served.
+type MethodOperation struct {
+	Method string
+	Path   string
+	*Operation
+}
+
+// Operations returns the document's operations, ordered by path and then by
+// method.
+func (d *Document) Operations() []MethodOperation {
+	var ops []MethodOperation
+
+	for path, item := range d.Paths {
+		for method, op := range item.Operations {
+			ops = append(ops, MethodOperation{Method: strings.ToUpper(method), Path: path, Operation: op})
+		}
+	}
+
+	slices.SortFunc(ops, func(a, b MethodOperation) int {
+		if c := cmp.Compare(a.Path, b.Path); c != 0 {
+			return c
+		}
+
+		return cmp.Compare(methodOrder(a.Method), methodOrder(b.Method))
+	})
+
+	return ops
+}
+
+// methodOrder orders methods as they are usually listed.
+func methodOrder(method string) int {
+	return slices.Index([]string{"GET", "POST", "PUT", "PATCH", "DELETE"}, method)
+}
+
+// Require replaces the required properties of the schema of v's type, a named
+// struct, such as to require fewer of a request's fields than are always
+// encoded.
+func (d *Document) Require(v any, properties ...string) {
+	if s, ok := d.Components.Schemas[d.Schema(v).ComponentName()]; ok {
+		s.Required = properties
+	}
+}
+
+// JSON returns a body of the given value's type, as JSON.
+func (d *Document) JSON(v any) map[string]MediaType {
+	return d.Content("application/json", v)
+}
+
+// Content returns a body of the given value's type, of the given media type.
+func (d *Document) Content(mediaType string, v any) map[string]MediaType {
+	return map[string]MediaType{mediaType: {Schema: d.Schema(v)}}
+}
+
+// Schema returns the schema of the given value's type. Named struct types are
+// added to the document's components and referred to.
+func (d *Document) Schema(v any) *Schema {
+	return d.schema(reflect.TypeOf(v))
+}
+
+//nolint:gochecknoglobals
+var (
+	timeType            = reflect.TypeOf(time.Time{})
+	rawMessageType      = reflect.TypeOf(json.RawMessage{})
+	jsonMarshalerType   = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+	textMarshalerType   = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+	typeArgumentPattern = regexp.MustCompile(`\[[^\]]*\]`)
+)
+
+func (d *Document) schema(t reflect.Type) *Schema {
+	if t == nil {
+		return &Schema{}
+	}
+
+	if t.Kind() == reflect.Pointer {
+		return d.schema(t.Elem())
+	}
+
+	switch {
+	case t == timeType:
+		return &Schema{Type: "string", Format: "date-time"}
+	case t == rawMessageType:
+		return &Schema{}
+	case implements(t, jsonMarshalerType):
+		// A type which encodes itself may be encoded as anything.
+		return &Schema{}
+	case implements(t, textMarshalerType):
+		return &Schema{Type: "string"}
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return &Schema{Type: "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return &Schema{Type: "integer"}
+	case reflect.Float32, reflect.Float64:
+		return &Schema{Type: "number"}
+	case reflect.String:
+		return &Schema{Type: "string"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return &Schema{Type: "string", Format: "byte"}
+		}
+
+		return &Schema{Type: "array", Items: d.schema(t.Elem())}
+	case reflect.Map:
+		return &Schema{Type: "object", AdditionalProperties: d.schema(t.Elem())}
+	case reflect.Struct:
+		return d.structSchema(t)
+	default:
+		return &Schema{}
+	}
+}
+
+func implements(t reflect.Type, iface reflect.Type) bool {
+	return t.Implements(iface) || reflect.PointerTo(t).Implements(iface)
+}
+
+// structSchema adds a named struct type to the components, if it is not there
+// yet, and refers to it. Anonymous structs are written in place.
+func (d *Document) structSchema(t reflect.Type) *Schema {
+	if t.Name() == "" {
+		return d.objectSchema(t)
+	}
+
+	name := d.componentName(t)
+	ref := &Schema{Ref: "#/components/schemas/" + name}
+
+	if _, ok := d.Components.Schemas[name]; ok {
+		return ref
+	}
+
+	// The name is reserved first, so that recursive types refer to
+	// themselves.
+	d.Components.Schemas[name] = &Schema{}
+	*d.Components.Schemas[name] = *d.objectSchema(t)
+
+	return ref
+}
+
+// componentName names a struct type's component after the type, or, if
+// another type of the same name is already a component, after its package
+// too. Type arguments are named by their own names.
+func (d *Document) componentName(t reflect.Type) string {
+	name := typeArgumentPattern.ReplaceAllStringFunc(t.Name(), func(args string) string {
+		var names []string
+		for _, arg := range strings.Split(strings.Trim(args, "[]"), ",") {
+			names = append(names, arg[strings.LastIndex(arg, ".")+1:])
+		}
+
+		return "_" + strings.Join(names, "_")
+	})
+
+	// Unexported types, such as request types, are named as if exported.
+	name = strings.ToUpper(name[:1]) + name[1:]
+
+	if other, ok := d.types[name]; ok && other != t {
+		pkg := t.PkgPath()[strings.LastIndex(t.PkgPath(), "/")+1:]
+		name = pkg + "." + name
+	}
+
+	d.types[name] = t
+
+	return name
+}
+
+// objectSchema describes a struct's JSON fields. Fields of embedded structs
+// are promoted, as encoding/json promotes them, and fields without omitempty
+// are required.
+func (d *Document) objectSchema(t reflect.Type) *Schema {
+	s := &Schema{Type: "object", Properties: map[string]*Schema{}}
+
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+
+		tag := f.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+
+		name, opts, _ := strings.Cut(tag, ",")
+
+		if f.Anonymous && name == "" {
+			ft := f.Type
+			if ft.Kind() == reflect.Pointer {
+				ft = ft.Elem()
+			}
+
+			if ft.Kind() == reflect.Struct && !implements(ft, jsonMarshalerType) {
+				embedded := d.objectSchema(ft)
+				for prop, schema := range embedded.Properties {
+					s.Properties[prop] = schema
+				}
+
+				s.Required = append(s.Required, embedded.Required...)
+
+				continue
+			}
+		}
+
+		if !f.IsExported() {
+			continue
+		}
+
+		if name == "" {
+			name = f.Name
+		}
+
+		s.Properties[name] = d.schema(f.Type)
+
+		if !strings.Contains(opts, "omitempty") && f.Type.Kind() != reflect.Pointer {
+			s.Required = append(s.Required, name)
+		}
+	}
+
+	return s
+}
@@ -4,6 +4,8 @@ import (
 	"embed"
 	"fmt"
 	"html/template"
+	"io/fs"
+	"sync"
 
 	"github.com/jclem/jclem.me/internal/markdown"
 )
@@ -19,15 +21,24 @@ type Page struct {
 var Content embed.FS
 
 type Service struct {
-	md    *markdown.Service
+	md *markdown.Service
+
+	mu    sync.RWMutex
 	pages []Page
 }
 
 func (s *Service) Start() error {
+	return s.Reload()
+}
+
+// Reload reads and renders the pages again, replacing those previously loaded.
+func (s *Service) Reload() error {
 	if err := s.md.Load(); err != nil {
 		return fmt.Errorf("error loading pages markdown: %w", err)
 	}
 
+	pages := make([]Page, 0, len(s.md.Data))
+
 	for _, document := range s.md.Data {
 		var page Page
 
@@ -37,9 +48,14 @@ func (s *Service) Start() error {
 
 		page.Content = template.HTML(document.Content) //nolint:gosec
 
-		s.pages = append(s.pages, page)
+		pages = append(pages, page)
 	}
 
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.pages = pages
+
 	return nil
 }
 
@@ -52,6 +68,9 @@ func (e PageNotFoundError) Error() string {
 }
 
 func (s *Service) Get(slug string) (Page, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
 	for _, page := range s.pages {
 		if page.Slug == slug {
 			return page, nil
@@ -61,11 +80,8 @@ func (s *Service) Get(slug string) (Page, error) {
 	return Page{}, PageNotFoundError{}
 }
 
-func New() *Service {
-	md := markdown.New(Content)
-
-	return &Service{
-		md:    md,
-		pages: make([]Page, 0, len(md.Data)),
-	}
+// New creates a new pages service which reads pages from the given file
+// system, such as Content.
+func New(content fs.FS) *Service {
+	return &Service{md: markdown.New(content)}
 }
@@ -1,47 +1,203 @@
 package posts
 
 import (
+	"context"
 	"embed"
+	"errors"
 	"fmt"
 	"html/template"
+	"io/fs"
+	"log/slog"
+	"slices"
 	"sort"
+	"strings"
+	"sync"
 	"time"
 
+	"github.com/jclem/jclem.me/internal/events"
+	"github.com/jclem/jclem.me/internal/images"
 	"github.com/jclem/jclem.me/internal/markdown"
+	"gopkg.in/yaml.v3"
 )
 
 type Post struct {
-	Title       string `yaml:"title"`
-	Slug        string `yaml:"slug"`
-	Content     template.HTML
-	PublishedAt time.Time `yaml:"published_at"`
-	Published   bool      `yaml:"published"`
-	HasMath     bool      `yaml:"has_math"`
-	Summary     string    `yaml:"summary"`
+	Title       string        `yaml:"title"        json:"title"`
+	Slug        string        `yaml:"slug"         json:"slug"`
+	Content     template.HTML `yaml:"-"            json:"content"`
+	PublishedAt time.Time     `yaml:"published_at" json:"published_at"`
+	Published   bool          `yaml:"published"    json:"published"`
+	HasMath     bool          `yaml:"has_math"     json:"has_math"`
+	Summary     string        `yaml:"summary"      json:"summary"`
+	Author      string        `yaml:"author"       json:"author"`
+
+	// UpdatedAt is when the post was last revised after it was published, if
+	// ever.
+	UpdatedAt time.Time `yaml:"updated_at" json:"updated_at"`
+
+	// Aliases are previous slugs of the post, which redirect to it.
+	Aliases []string `yaml:"aliases" json:"aliases"`
+
+	// Tags are the topics of the post, normalized to lowercase.
+	Tags []string `yaml:"tags" json:"tags"`
+
+	// ShowTOC enables rendering the post's table of contents.
+	ShowTOC bool `yaml:"toc" json:"show_toc"`
+
+	// TOC is the post's table of contents.
+	TOC []markdown.Heading `yaml:"-" json:"toc"`
+
+	// WordCount and ReadingMinutes are computed when the post is rendered.
+	WordCount      int `yaml:"-" json:"word_count"`
+	ReadingMinutes int `yaml:"-" json:"reading_minutes"`
 }
 
-//go:embed *.md
+// A Tag is a topic and the number of posts tagged with it.
+type Tag struct {
+	Name  string
+	Count int
+}
+
+// Content holds the embedded posts and the redirects file.
+//
+//go:embed *.md redirects.yml
 var Content embed.FS
 
+// redirectsFile is the name of the file which declares redirects between
+// slugs.
+const redirectsFile = "redirects.yml"
+
+// ErrRedirectLoop is returned when a chain of redirects returns to a slug it
+// has already visited.
+var ErrRedirectLoop = errors.New("redirect loop")
+
+// A Service provides access to posts.
+//
+// Posts are read from a file system, usually embedded in the binary, and, if a
+// Store is configured, written through the authoring API. Stored posts take
+// precedence over embedded posts with the same slug. Posts are held in memory, and are reloaded from the
+// Store whenever they are written through the Service or Refresh is called,
+// and, once Listen is called, whenever they are written in another process.
 type Service struct {
-	md    *markdown.Service
-	posts []Post
+	content       fs.FS
+	md            *markdown.Service
+	store         store
+	defaultAuthor string
+	events        *events.Broker
+
+	mu              sync.RWMutex
+	embedded        []Post
+	redirectsSource []byte
+	posts           []Post
+	redirects       map[string]string
+	related         map[string][]string
 }
 
-func New() *Service {
-	md := markdown.New(Content)
+// ErrNoStore is returned when writing a post without a configured Store.
+var ErrNoStore = errors.New("posts store is not configured")
 
-	return &Service{
-		md:    md,
-		posts: make([]Post, 0, len(md.Data)),
+// New creates a new posts service.
+//
+// Posts and redirects are read from the given file system, such as Content.
+// Posts which do not name an author in their frontmatter are attributed to
+// the given default author. The store may be nil, in which case only embedded
+// posts are served. Images are rendered with the variants known to the images
+// service.
+func New(content fs.FS, defaultAuthor string, store *Store, images *images.Service) *Service {
+	s := &Service{
+		content:       content,
+		md:            markdown.New(content, markdown.WithImages(images.Lookup)),
+		defaultAuthor: defaultAuthor,
 	}
+
+	if store != nil {
+		s.store = store
+	}
+
+	return s
 }
 
-func (s *Service) Start() error {
+// A store persists posts written through the authoring API, such as a Store.
+type store interface {
+	List(ctx context.Context) ([]Post, error)
+	Create(ctx context.Context, input NewPost) (Post, error)
+	Update(ctx context.Context, slug string, update PostUpdate) (Post, error)
+	Publish(ctx context.Context, slug string) (Post, error)
+}
+
+// Listen refreshes stored posts whenever they are changed, in this process or
+// another, as announced through broker, until ctx is done or broker is closed.
+// Changes made through the Service are announced through it from then on.
+func (s *Service) Listen(ctx context.Context, broker *events.Broker) {
+	ch, unsubscribe := broker.Subscribe()
+
+	s.mu.Lock()
+	s.events = broker
+	s.mu.Unlock()
+
+	go func() {
+		defer unsubscribe()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case event, ok := <-ch:
+				if !ok {
+					return
+				}
+
+				if event.Type != events.PostChanged {
+					continue
+				}
+
+				if err := s.Refresh(ctx); err != nil {
+					slog.ErrorContext(ctx, "error refreshing posts", "error", err)
+				}
+			}
+		}
+	}()
+}
+
+// changed refreshes stored posts after one is written, and announces the
+// change to other processes.
+func (s *Service) changed(ctx context.Context, slug string) error {
+	if err := s.Refresh(ctx); err != nil {
+		return err
+	}
+
+	s.mu.RLock()
+	broker := s.events
+	s.mu.RUnlock()
+
+	if broker == nil {
+		return nil
+	}
+
+	if err := broker.Publish(ctx, events.New(events.PostChanged, map[string]any{"slug": slug})); err != nil {
+		slog.ErrorContext(ctx, "error publishing post change", "error", err)
+	}
+
+	return nil
+}
+
+func (s *Service) Start(ctx context.Context) error {
+	return s.Reload(ctx)
+}
+
+// Reload reads and renders the posts and redirects in the file system again,
+// and then refreshes stored posts.
+func (s *Service) Reload(ctx context.Context) error {
 	if err := s.md.Load(); err != nil {
 		return fmt.Errorf("error loading posts markdown: %w", err)
 	}
 
+	redirectsSource, err := fs.ReadFile(s.content, redirectsFile)
+	if err != nil {
+		return fmt.Errorf("error reading redirects: %w", err)
+	}
+
+	embedded := make([]Post, 0, len(s.md.Data))
+
 	for _, document := range s.md.Data {
 		var post Post
 
@@ -50,15 +206,222 @@ func (s *Service) Start() error {
 		}
 
 		post.Content = template.HTML(document.Content) //nolint:gosec
+		post.WordCount = document.WordCount
+		post.TOC = document.TOC
+		post.ReadingMinutes = markdown.ReadingMinutes(document.WordCount)
+
+		if post.Author == "" {
+			post.Author = s.defaultAuthor
+		}
+
+		for i, tag := range post.Tags {
+			post.Tags[i] = normalizeTag(tag)
+		}
 
-		s.posts = append(s.posts, post)
+		embedded = append(embedded, post)
 	}
 
+	s.mu.Lock()
+	s.embedded = embedded
+	s.redirectsSource = redirectsSource
+	s.mu.Unlock()
+
+	return s.Refresh(ctx)
+}
+
+// Refresh reloads stored posts and merges them with embedded posts.
+func (s *Service) Refresh(ctx context.Context) error {
+	s.mu.RLock()
+	embedded := s.embedded
+	redirectsSource := s.redirectsSource
+	s.mu.RUnlock()
+
+	posts := make([]Post, 0, len(embedded))
+
+	stored := make(map[string]bool)
+
+	if s.store != nil {
+		list, err := s.store.List(ctx)
+		if err != nil {
+			return fmt.Errorf("error loading stored posts: %w", err)
+		}
+
+		for _, post := range list {
+			stored[post.Slug] = true
+			posts = append(posts, post)
+		}
+	}
+
+	for _, post := range embedded {
+		if !stored[post.Slug] {
+			posts = append(posts, post)
+		}
+	}
+
+	redirects, err := loadRedirects(redirectsSource, posts)
+	if err != nil {
+		return err
+	}
+
+	related := computeRelated(posts)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.posts = posts
+	s.redirects = redirects
+	s.related = related
+
 	return nil
 }
 
+// Create creates an unpublished post in the Store.
+func (s *Service) Create(ctx context.Context, input NewPost) (Post, error) {
+	if s.store == nil {
+		return Post{}, ErrNoStore
+	}
+
+	if input.Author == "" {
+		input.Author = s.defaultAuthor
+	}
+
+	// A slug which redirects elsewhere would be shadowed by the new post.
+	if _, ok := s.Redirect(input.Slug); ok {
+		return Post{}, ErrPostExists
+	}
+
+	post, err := s.store.Create(ctx, input)
+	if err != nil {
+		return Post{}, err
+	}
+
+	return post, s.changed(ctx, post.Slug)
+}
+
+// Update updates a post in the Store.
+func (s *Service) Update(ctx context.Context, slug string, update PostUpdate) (Post, error) {
+	if s.store == nil {
+		return Post{}, ErrNoStore
+	}
+
+	post, err := s.store.Update(ctx, slug, update)
+	if err != nil {
+		return Post{}, err
+	}
+
+	return post, s.changed(ctx, slug)
+}
+
+// Publish publishes a post in the Store.
+func (s *Service) Publish(ctx context.Context, slug string) (Post, error) {
+	if s.store == nil {
+		return Post{}, ErrNoStore
+	}
+
+	post, err := s.store.Publish(ctx, slug)
+	if err != nil {
+		return Post{}, err
+	}
+
+	return post, s.changed(ctx, slug)
+}
+
+// loadRedirects collects the redirects declared in post aliases and the
+// redirects file, and resolves each to the canonical slug at the end of its
+// chain.
+func loadRedirects(source []byte, posts []Post) (map[string]string, error) {
+	redirects := make(map[string]string)
+	if err := yaml.Unmarshal(source, &redirects); err != nil {
+		return nil, fmt.Errorf("error unmarshaling redirects: %w", err)
+	}
+
+	for _, post := range posts {
+		for _, alias := range post.Aliases {
+			if to, ok := redirects[alias]; ok && to != post.Slug {
+				return nil, fmt.Errorf("conflicting redirects from %q to %q and %q", alias, to, post.Slug)
+			}
+
+			redirects[alias] = post.Slug
+		}
+	}
+
+	resolved := make(map[string]string, len(redirects))
+
+	for from := range redirects {
+		if _, err := find(posts, from); err == nil {
+			return nil, fmt.Errorf("redirect from %q shadows an existing post", from)
+		}
+
+		to, err := resolveRedirect(redirects, from)
+		if err != nil {
+			return nil, err
+		}
+
+		if _, err := find(posts, to); err != nil {
+			return nil, fmt.Errorf("redirect from %q: %w", from, err)
+		}
+
+		resolved[from] = to
+	}
+
+	return resolved, nil
+}
+
+// resolveRedirect follows the chain of redirects from the given slug to its
+// end.
+func resolveRedirect(redirects map[string]string, from string) (string, error) {
+	seen := map[string]bool{from: true}
+	slug := from
+
+	for {
+		to, ok := redirects[slug]
+		if !ok {
+			return slug, nil
+		}
+
+		if seen[to] {
+			return "", fmt.Errorf("%w: from %q", ErrRedirectLoop, from)
+		}
+
+		seen[to] = true
+		slug = to
+	}
+}
+
+// Redirect returns the canonical slug of the post which the given slug
+// redirects to, if any.
+func (s *Service) Redirect(slug string) (string, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	to, ok := s.redirects[slug]
+
+	return to, ok
+}
+
+// Related returns the published posts most similar to the post with the given
+// slug, most similar first.
+func (s *Service) Related(slug string) []Post {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	related := make([]Post, 0, len(s.related[slug]))
+
+	for _, slug := range s.related[slug] {
+		if post, err := find(s.posts, slug); err == nil {
+			related = append(related, post)
+		}
+	}
+
+	return related
+}
+
 type listOpts struct {
 	withDrafts bool
+	author     string
+	tag        string
+	year       int
+	month      time.Month
 }
 
 type ListOpt func(*listOpts)
@@ -69,6 +432,33 @@ func WithDrafts() ListOpt {
 	}
 }
 
+// WithAuthor limits the list to posts by the given author.
+func WithAuthor(author string) ListOpt {
+	return func(o *listOpts) {
+		o.author = author
+	}
+}
+
+// WithTag limits the list to posts with the given tag.
+func WithTag(tag string) ListOpt {
+	return func(o *listOpts) {
+		o.tag = normalizeTag(tag)
+	}
+}
+
+// WithPublishedIn limits the list to posts published in the given year, and,
+// if month is not zero, the given month of that year.
+func WithPublishedIn(year int, month time.Month) ListOpt {
+	return func(o *listOpts) {
+		o.year = year
+		o.month = month
+	}
+}
+
+func normalizeTag(tag string) string {
+	return strings.ToLower(strings.TrimSpace(tag))
+}
+
 type PostNotFoundError struct {
 	Slug string
 }
@@ -78,7 +468,14 @@ func (e PostNotFoundError) Error() string {
 }
 
 func (s *Service) Get(slug string) (Post, error) {
-	for _, post := range s.posts {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return find(s.posts, slug)
+}
+
+func find(posts []Post, slug string) (Post, error) {
+	for _, post := range posts {
 		if post.Slug == slug {
 			return post, nil
 		}
@@ -93,6 +490,9 @@ func (s *Service) List(opts ...ListOpt) []Post {
 		opt(&o)
 	}
 
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
 	posts := make([]Post, 0, len(s.posts))
 
 	for _, post := range s.posts {
@@ -100,6 +500,22 @@ func (s *Service) List(opts ...ListOpt) []Post {
 			continue
 		}
 
+		if o.author != "" && post.Author != o.author {
+			continue
+		}
+
+		if o.tag != "" && !slices.Contains(post.Tags, o.tag) {
+			continue
+		}
+
+		if o.year != 0 && post.PublishedAt.Year() != o.year {
+			continue
+		}
+
+		if o.month != 0 && post.PublishedAt.Month() != o.month {
+			continue
+		}
+
 		posts = append(posts, post)
 	}
 
@@ -109,3 +525,52 @@ func (s *Service) List(opts ...ListOpt) []Post {
 
 	return posts
 }
+
+// Tags returns the tags of the posts matching the given options, sorted by
+// name.
+func (s *Service) Tags(opts ...ListOpt) []Tag {
+	counts := make(map[string]int)
+
+	for _, post := range s.List(opts...) {
+		for _, tag := range post.Tags {
+			counts[tag]++
+		}
+	}
+
+	tags := make([]Tag, 0, len(counts))
+	for name, count := range counts {
+		tags = append(tags, Tag{Name: name, Count: count})
+	}
+
+	sort.Slice(tags, func(i, j int) bool {
+		return tags[i].Name < tags[j].Name
+	})
+
+	return tags
+}
+
+// A Year is a year of the archive and the posts published in it.
+type Year struct {
+	Year  int
+	Posts []Post
+}
+
+// Archive returns the posts matching the given options grouped by the year in
+// which they were published, most recent first.
+func (s *Service) Archive(opts ...ListOpt) []Year {
+	var years []Year
+
+	// List sorts posts by publication time, so each year's posts are
+	// contiguous.
+	for _, post := range s.List(opts...) {
+		year := post.PublishedAt.Year()
+
+		if len(years) == 0 || years[len(years)-1].Year != year {
+			years = append(years, Year{Year: year})
+		}
+
+		years[len(years)-1].Posts = append(years[len(years)-1].Posts, post)
+	}
+
+	return years
+}
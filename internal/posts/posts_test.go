@@ -0,0 +1,126 @@
+package posts
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jclem/jclem.me/internal/events"
+	"github.com/jclem/jclem.me/internal/images"
+)
+
+// memoryStore is a store which keeps posts in memory.
+type memoryStore struct {
+	mu    sync.Mutex
+	posts map[string]Post
+}
+
+func (m *memoryStore) List(context.Context) ([]Post, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	list := make([]Post, 0, len(m.posts))
+	for _, post := range m.posts {
+		list = append(list, post)
+	}
+
+	return list, nil
+}
+
+func (m *memoryStore) Create(_ context.Context, input NewPost) (Post, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	post := Post{Slug: input.Slug, Title: input.Title, Author: input.Author}
+	m.posts[post.Slug] = post
+
+	return post, nil
+}
+
+func (m *memoryStore) Update(_ context.Context, slug string, update PostUpdate) (Post, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	post := m.posts[slug]
+	if update.Title != nil {
+		post.Title = *update.Title
+	}
+
+	m.posts[slug] = post
+
+	return post, nil
+}
+
+func (m *memoryStore) Publish(_ context.Context, slug string) (Post, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	post := m.posts[slug]
+	post.Published = true
+	post.PublishedAt = time.Now()
+	m.posts[slug] = post
+
+	return post, nil
+}
+
+func TestListenRefreshesChangesFromOtherServices(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	imgs, err := images.New(nil, nil)
+	if err != nil {
+		t.Fatalf("error creating images service: %v", err)
+	}
+
+	// Two services, as in two processes, share a store and a broker.
+	store := &memoryStore{posts: map[string]Post{}}
+	broker := events.NewBroker(nil)
+
+	services := make([]*Service, 2)
+	for i := range services {
+		services[i] = New(Content, "jclem", nil, imgs)
+		services[i].store = store
+
+		if err := services[i].Start(ctx); err != nil {
+			t.Fatalf("error starting service: %v", err)
+		}
+
+		services[i].Listen(ctx, broker)
+	}
+
+	writer, reader := services[0], services[1]
+
+	if _, err := writer.Create(ctx, NewPost{Slug: "new-post", Title: "New post"}); err != nil {
+		t.Fatalf("error creating post: %v", err)
+	}
+
+	if _, err := writer.Publish(ctx, "new-post"); err != nil {
+		t.Fatalf("error publishing post: %v", err)
+	}
+
+	// The writer sees its post at once, and the reader once it is announced.
+	if post, err := writer.Get("new-post"); err != nil || !post.Published {
+		t.Errorf("expected the writer to get the published post, got %+v, %v", post, err)
+	}
+
+	deadline := time.Now().Add(time.Second)
+
+	for {
+		post, err := reader.Get("new-post")
+		if err == nil && post.Published {
+			break
+		}
+
+		if time.Now().After(deadline) {
+			t.Fatalf("expected the reader to get the published post, got %+v, %v", post, err)
+		}
+
+		if err != nil && !errors.As(err, new(PostNotFoundError)) {
+			t.Fatalf("error getting post: %v", err)
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -0,0 +1,162 @@
+package posts
+
+import (
+	"math"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// relatedCount is the number of related posts computed for each post.
+const relatedCount = 3
+
+// tagWeight is how much each shared tag contributes to the similarity of two
+// posts, relative to the cosine similarity of their content, which is at most
+// 1.
+const tagWeight = 0.25
+
+var (
+	htmlTagRegex = regexp.MustCompile(`<[^>]*>`)
+	wordRegex    = regexp.MustCompile(`[a-z][a-z0-9']+`)
+)
+
+// stopWords are common words which say nothing about a post's topic.
+var stopWords = map[string]bool{ //nolint:gochecknoglobals
+	"a": true, "about": true, "after": true, "all": true, "also": true, "an": true, "and": true,
+	"any": true, "are": true, "as": true, "at": true, "be": true, "because": true, "been": true,
+	"but": true, "by": true, "can": true, "could": true, "do": true, "does": true, "for": true,
+	"from": true, "get": true, "had": true, "has": true, "have": true, "he": true, "her": true,
+	"his": true, "how": true, "i": true, "if": true, "in": true, "into": true, "is": true,
+	"it": true, "it's": true, "its": true, "just": true, "like": true, "more": true, "my": true,
+	"no": true, "not": true, "of": true, "on": true, "one": true, "only": true, "or": true,
+	"our": true, "out": true, "so": true, "some": true, "than": true, "that": true, "the": true,
+	"their": true, "them": true, "then": true, "there": true, "these": true, "they": true,
+	"this": true, "to": true, "up": true, "use": true, "was": true, "we": true, "what": true,
+	"when": true, "which": true, "who": true, "will": true, "with": true, "would": true,
+	"you": true, "your": true,
+}
+
+// computeRelated finds, for each post, the published posts which are most
+// similar to it by shared tags and the TF-IDF cosine similarity of their
+// content. It returns a map of slugs to the slugs of related posts, most
+// similar first.
+func computeRelated(posts []Post) map[string][]string {
+	vectors := make([]map[string]float64, len(posts))
+	docFreq := make(map[string]int)
+
+	for i, post := range posts {
+		tf := termFrequencies(string(post.Content))
+		vectors[i] = tf
+
+		for term := range tf {
+			docFreq[term]++
+		}
+	}
+
+	for _, vec := range vectors {
+		var norm float64
+
+		for term, tf := range vec {
+			w := tf * math.Log(float64(len(posts))/float64(docFreq[term]))
+			vec[term] = w
+			norm += w * w
+		}
+
+		norm = math.Sqrt(norm)
+		if norm == 0 {
+			continue
+		}
+
+		for term := range vec {
+			vec[term] /= norm
+		}
+	}
+
+	related := make(map[string][]string, len(posts))
+
+	type candidate struct {
+		slug  string
+		score float64
+	}
+
+	for i, post := range posts {
+		candidates := make([]candidate, 0, len(posts))
+
+		for j, other := range posts {
+			if i == j || !other.Published || other.Author != post.Author {
+				continue
+			}
+
+			score := cosine(vectors[i], vectors[j]) + tagWeight*float64(sharedTags(post, other))
+			if score > 0 {
+				candidates = append(candidates, candidate{slug: other.Slug, score: score})
+			}
+		}
+
+		sort.Slice(candidates, func(a, b int) bool {
+			if candidates[a].score == candidates[b].score {
+				return candidates[a].slug < candidates[b].slug
+			}
+
+			return candidates[a].score > candidates[b].score
+		})
+
+		for k := 0; k < len(candidates) && k < relatedCount; k++ {
+			related[post.Slug] = append(related[post.Slug], candidates[k].slug)
+		}
+	}
+
+	return related
+}
+
+// termFrequencies returns the frequency of each term in the text of an HTML
+// document, relative to the number of terms in it.
+func termFrequencies(content string) map[string]float64 {
+	text := strings.ToLower(htmlTagRegex.ReplaceAllString(content, " "))
+	counts := make(map[string]float64)
+
+	var total float64
+
+	for _, word := range wordRegex.FindAllString(text, -1) {
+		if stopWords[word] {
+			continue
+		}
+
+		counts[word]++
+		total++
+	}
+
+	for term := range counts {
+		counts[term] /= total
+	}
+
+	return counts
+}
+
+// cosine returns the cosine similarity of two normalized vectors.
+func cosine(a, b map[string]float64) float64 {
+	if len(b) < len(a) {
+		a, b = b, a
+	}
+
+	var dot float64
+	for term, w := range a {
+		dot += w * b[term]
+	}
+
+	return dot
+}
+
+func sharedTags(a, b Post) int {
+	var n int
+
+	for _, tag := range a.Tags {
+		for _, other := range b.Tags {
+			if tag == other {
+				n++
+			}
+		}
+	}
+
+	return n
+}
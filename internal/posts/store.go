@@ -0,0 +1,370 @@
+package posts
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"html/template"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/Masterminds/squirrel"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/jclem/jclem.me/internal/database"
+	"github.com/jclem/jclem.me/internal/images"
+	"github.com/jclem/jclem.me/internal/markdown"
+)
+
+// A Store persists posts written through the authoring API in Postgres.
+//
+// Markdown is rendered to HTML when a post is written, so reading posts does
+// no rendering.
+type Store struct {
+	pool   *pgxpool.Pool
+	sql    squirrel.StatementBuilderType
+	images *images.Service
+}
+
+// NewStore returns a new posts store.
+func NewStore(pool *pgxpool.Pool, images *images.Service) *Store {
+	return &Store{
+		pool:   pool,
+		sql:    squirrel.StatementBuilder.PlaceholderFormat(squirrel.Dollar),
+		images: images,
+	}
+}
+
+// ErrPostExists is returned when creating a post whose slug is taken by
+// another stored post or a redirect.
+var ErrPostExists = errors.New("post already exists")
+
+// ErrInvalidSlug is returned when a post's slug is not URL-safe.
+var ErrInvalidSlug = errors.New("invalid slug")
+
+// ErrMissingTitle is returned when a post has no title.
+var ErrMissingTitle = errors.New("missing title")
+
+var slugRegex = regexp.MustCompile(`^[a-z0-9]+(?:-[a-z0-9]+)*$`)
+
+const uniqueViolationCode = "23505"
+
+// NewPost is the input for creating a post. The body is Markdown without
+// frontmatter.
+type NewPost struct {
+	Slug    string   `json:"slug"`
+	Title   string   `json:"title"`
+	Summary string   `json:"summary"`
+	Author  string   `json:"author"`
+	Body    string   `json:"body"`
+	Tags    []string `json:"tags"`
+	HasMath bool     `json:"has_math"`
+	ShowTOC bool     `json:"show_toc"`
+}
+
+// PostUpdate is the input for updating a post. Nil fields are unchanged.
+type PostUpdate struct {
+	Title   *string   `json:"title"`
+	Summary *string   `json:"summary"`
+	Body    *string   `json:"body"`
+	Tags    *[]string `json:"tags"`
+	HasMath *bool     `json:"has_math"`
+	ShowTOC *bool     `json:"show_toc"`
+}
+
+// List lists all stored posts, including drafts.
+func (s *Store) List(ctx context.Context) ([]Post, error) {
+	query, args, err := s.sql.
+		Select(postsFields...).
+		From(postsTable).
+		ToSql()
+	if err != nil {
+		return nil, fmt.Errorf("could not build query: %w", err)
+	}
+
+	rows, err := s.pool.Query(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("could not query posts: %w", err)
+	}
+
+	posts, err := pgx.CollectRows(rows, scanPost)
+	if err != nil {
+		return nil, fmt.Errorf("could not scan posts: %w", err)
+	}
+
+	return posts, nil
+}
+
+// Create creates an unpublished post.
+func (s *Store) Create(ctx context.Context, input NewPost) (Post, error) {
+	if !slugRegex.MatchString(input.Slug) {
+		return Post{}, ErrInvalidSlug
+	}
+
+	if strings.TrimSpace(input.Title) == "" {
+		return Post{}, ErrMissingTitle
+	}
+
+	doc, err := s.render(input.Body)
+	if err != nil {
+		return Post{}, err
+	}
+
+	now := time.Now().UTC()
+
+	query, args, err := s.sql.
+		Insert(postsTable).
+		Columns(postsFields...).
+		Values(database.NewULID(), input.Slug, input.Author, input.Title, input.Summary, input.Body, doc.Content, normalizeTags(input.Tags), input.HasMath, false, nil, now, now, doc.WordCount, doc.TOC, input.ShowTOC).
+		Suffix("RETURNING " + strings.Join(postsFields, ", ")).
+		ToSql()
+	if err != nil {
+		return Post{}, fmt.Errorf("could not build query: %w", err)
+	}
+
+	rows, err := s.pool.Query(ctx, query, args...)
+	if err != nil {
+		return Post{}, fmt.Errorf("could not insert post: %w", err)
+	}
+
+	post, err := pgx.CollectExactlyOneRow(rows, scanPost)
+	if err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == uniqueViolationCode {
+			return Post{}, ErrPostExists
+		}
+
+		return Post{}, fmt.Errorf("could not insert post: %w", err)
+	}
+
+	return post, nil
+}
+
+// Update updates a post, re-rendering its content if the body changed.
+func (s *Store) Update(ctx context.Context, slug string, update PostUpdate) (Post, error) {
+	changes := map[string]any{postsUpdatedAtColumn: time.Now().UTC()}
+
+	if update.Title != nil {
+		if strings.TrimSpace(*update.Title) == "" {
+			return Post{}, ErrMissingTitle
+		}
+
+		changes[postsTitleColumn] = *update.Title
+	}
+
+	if update.Summary != nil {
+		changes[postsSummaryColumn] = *update.Summary
+	}
+
+	if update.Body != nil {
+		doc, err := s.render(*update.Body)
+		if err != nil {
+			return Post{}, err
+		}
+
+		changes[postsSourceColumn] = *update.Body
+		changes[postsContentColumn] = doc.Content
+		changes[postsWordCountColumn] = doc.WordCount
+		changes[postsTOCColumn] = doc.TOC
+	}
+
+	if update.Tags != nil {
+		changes[postsTagsColumn] = normalizeTags(*update.Tags)
+	}
+
+	if update.HasMath != nil {
+		changes[postsHasMathColumn] = *update.HasMath
+	}
+
+	if update.ShowTOC != nil {
+		changes[postsShowTOCColumn] = *update.ShowTOC
+	}
+
+	return s.update(ctx, slug, changes)
+}
+
+// Publish publishes a post. A post which was published before keeps its
+// original publication time.
+//
+// Resized variants of the post's images are generated before it is published,
+// and its content is rendered again to use them.
+func (s *Store) Publish(ctx context.Context, slug string) (Post, error) {
+	now := time.Now().UTC()
+	changes := map[string]any{
+		postsPublishedColumn:   true,
+		postsPublishedAtColumn: squirrel.Expr("COALESCE("+postsPublishedAtColumn+", ?)", now),
+		postsUpdatedAtColumn:   now,
+	}
+
+	source, err := s.source(ctx, slug)
+	if err != nil {
+		return Post{}, err
+	}
+
+	urls, err := markdown.ImageURLs([]byte(source))
+	if err != nil {
+		return Post{}, fmt.Errorf("could not find post images: %w", err)
+	}
+
+	if err := s.images.Prepare(ctx, urls); err != nil && !errors.Is(err, images.ErrNoProcessor) {
+		return Post{}, fmt.Errorf("could not prepare post images: %w", err)
+	}
+
+	doc, err := s.render(source)
+	if err != nil {
+		return Post{}, err
+	}
+
+	changes[postsContentColumn] = doc.Content
+
+	return s.update(ctx, slug, changes)
+}
+
+// source returns the Markdown source of a post.
+func (s *Store) source(ctx context.Context, slug string) (string, error) {
+	query, args, err := s.sql.
+		Select(postsSourceColumn).
+		From(postsTable).
+		Where(squirrel.Eq{postsSlugColumn: slug}).
+		ToSql()
+	if err != nil {
+		return "", fmt.Errorf("could not build query: %w", err)
+	}
+
+	var source string
+	if err := s.pool.QueryRow(ctx, query, args...).Scan(&source); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return "", PostNotFoundError{Slug: slug}
+		}
+
+		return "", fmt.Errorf("could not get post source: %w", err)
+	}
+
+	return source, nil
+}
+
+func (s *Store) update(ctx context.Context, slug string, changes map[string]any) (Post, error) {
+	query, args, err := s.sql.
+		Update(postsTable).
+		SetMap(changes).
+		Where(squirrel.Eq{postsSlugColumn: slug}).
+		Suffix("RETURNING " + strings.Join(postsFields, ", ")).
+		ToSql()
+	if err != nil {
+		return Post{}, fmt.Errorf("could not build query: %w", err)
+	}
+
+	rows, err := s.pool.Query(ctx, query, args...)
+	if err != nil {
+		return Post{}, fmt.Errorf("could not update post: %w", err)
+	}
+
+	post, err := pgx.CollectExactlyOneRow(rows, scanPost)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return Post{}, PostNotFoundError{Slug: slug}
+		}
+
+		return Post{}, fmt.Errorf("could not update post: %w", err)
+	}
+
+	return post, nil
+}
+
+func (s *Store) render(body string) (markdown.Document, error) {
+	doc, err := markdown.Render([]byte(body), markdown.WithImages(s.images.Lookup))
+	if err != nil {
+		return markdown.Document{}, fmt.Errorf("could not render post: %w", err)
+	}
+
+	return doc, nil
+}
+
+func normalizeTags(tags []string) []string {
+	normalized := make([]string, 0, len(tags))
+	for _, tag := range tags {
+		normalized = append(normalized, normalizeTag(tag))
+	}
+
+	return normalized
+}
+
+func scanPost(row pgx.CollectableRow) (Post, error) {
+	var (
+		post        Post
+		id          database.ULID
+		source      string
+		content     string
+		publishedAt *time.Time
+		createdAt   time.Time
+	)
+
+	if err := row.Scan(
+		&id,
+		&post.Slug,
+		&post.Author,
+		&post.Title,
+		&post.Summary,
+		&source,
+		&content,
+		&post.Tags,
+		&post.HasMath,
+		&post.Published,
+		&publishedAt,
+		&createdAt,
+		&post.UpdatedAt,
+		&post.WordCount,
+		&post.TOC,
+		&post.ShowTOC,
+	); err != nil {
+		return Post{}, fmt.Errorf("could not scan post: %w", err)
+	}
+
+	post.Content = template.HTML(content) //nolint:gosec
+	post.ReadingMinutes = markdown.ReadingMinutes(post.WordCount)
+
+	if publishedAt != nil {
+		post.PublishedAt = *publishedAt
+	}
+
+	return post, nil
+}
+
+const postsTable = "posts"
+const postsIDColumn = "id"
+const postsSlugColumn = "slug"
+const postsAuthorColumn = "author"
+const postsTitleColumn = "title"
+const postsSummaryColumn = "summary"
+const postsSourceColumn = "source"
+const postsContentColumn = "content"
+const postsTagsColumn = "tags"
+const postsHasMathColumn = "has_math"
+const postsPublishedColumn = "published"
+const postsPublishedAtColumn = "published_at"
+const postsCreatedAtColumn = "created_at"
+const postsUpdatedAtColumn = "updated_at"
+const postsWordCountColumn = "word_count"
+const postsTOCColumn = "toc"
+const postsShowTOCColumn = "show_toc"
+
+var postsFields = []string{ //nolint:gochecknoglobals
+	postsIDColumn,
+	postsSlugColumn,
+	postsAuthorColumn,
+	postsTitleColumn,
+	postsSummaryColumn,
+	postsSourceColumn,
+	postsContentColumn,
+	postsTagsColumn,
+	postsHasMathColumn,
+	postsPublishedColumn,
+	postsPublishedAtColumn,
+	postsCreatedAtColumn,
+	postsUpdatedAtColumn,
+	postsWordCountColumn,
+	postsTOCColumn,
+	postsShowTOCColumn,
+}
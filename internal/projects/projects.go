@@ -0,0 +1,112 @@
+// Package projects provides the projects listed on the site, which are
+// declared in a YAML file.
+package projects
+
+import (
+	"embed"
+	"fmt"
+	"io/fs"
+	"regexp"
+	"sync"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Content holds the embedded projects file.
+//
+//go:embed projects.yml
+var Content embed.FS
+
+// projectsFile is the name of the file which declares projects.
+const projectsFile = "projects.yml"
+
+// Project statuses.
+const (
+	StatusActive     = "active"
+	StatusMaintained = "maintained"
+	StatusArchived   = "archived"
+)
+
+var slugRegex = regexp.MustCompile(`^[a-z0-9]+(?:-[a-z0-9]+)*$`)
+
+// A Project is something I have built.
+type Project struct {
+	Name        string `yaml:"name"`
+	Slug        string `yaml:"slug"`
+	Description string `yaml:"description"`
+	Status      string `yaml:"status"`
+	Links       []Link `yaml:"links"`
+}
+
+// A Link is a labeled link to a project's source, website, or similar.
+type Link struct {
+	Label string `yaml:"label"`
+	URL   string `yaml:"url"`
+}
+
+// A Service provides access to projects.
+type Service struct {
+	content fs.FS
+
+	mu       sync.RWMutex
+	projects []Project
+}
+
+// New creates a new projects service which reads projects from the given file
+// system, such as Content.
+func New(content fs.FS) *Service {
+	return &Service{content: content}
+}
+
+func (s *Service) Start() error {
+	return s.Reload()
+}
+
+// Reload reads the projects file again, replacing the projects previously
+// loaded.
+func (s *Service) Reload() error {
+	b, err := fs.ReadFile(s.content, projectsFile)
+	if err != nil {
+		return fmt.Errorf("error reading projects: %w", err)
+	}
+
+	var projects []Project
+	if err := yaml.Unmarshal(b, &projects); err != nil {
+		return fmt.Errorf("error unmarshaling projects: %w", err)
+	}
+
+	seen := make(map[string]bool, len(projects))
+
+	for _, project := range projects {
+		if !slugRegex.MatchString(project.Slug) {
+			return fmt.Errorf("invalid project slug: %q", project.Slug)
+		}
+
+		if seen[project.Slug] {
+			return fmt.Errorf("duplicate project slug: %q", project.Slug)
+		}
+
+		seen[project.Slug] = true
+
+		switch project.Status {
+		case StatusActive, StatusMaintained, StatusArchived:
+		default:
+			return fmt.Errorf("invalid status for project %q: %q", project.Slug, project.Status)
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.projects = projects
+
+	return nil
+}
+
+// List returns the projects in the order they are declared.
+func (s *Service) List() []Project {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.projects
+}
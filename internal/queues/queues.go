@@ -0,0 +1,21 @@
+// Package queues names the job queues. Jobs of each kind are inserted into one
+// of them, and each queue has its own workers, so that a burst of jobs in one
+// queue, such as deliveries to many followers, doesn't delay jobs in another.
+package queues
+
+const (
+	// Inbox is the queue of jobs which handle activities and mentions sent to
+	// the site.
+	Inbox = "inbox"
+
+	// Delivery is the queue of jobs which send activities and webhooks to other
+	// servers.
+	Delivery = "delivery"
+
+	// Media is the queue of jobs which process uploaded images.
+	Media = "media"
+
+	// Periodic is the queue of jobs which run on a schedule, such as purging
+	// deleted notes.
+	Periodic = "periodic"
+)
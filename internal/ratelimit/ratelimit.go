@@ -0,0 +1,113 @@
+// Package ratelimit provides in-memory token bucket rate limiting.
+package ratelimit
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// A Limiter limits the rate of events per key using a token bucket for each
+// key.
+//
+// Each bucket holds up to limit tokens and refills at a rate of limit tokens
+// per period.
+type Limiter struct {
+	mu      sync.Mutex
+	limit   int
+	period  time.Duration
+	buckets map[string]*bucket
+	now     func() time.Time
+	swept   time.Time
+}
+
+type bucket struct {
+	tokens  float64
+	updated time.Time
+}
+
+// A Result is the outcome of taking a token from a bucket.
+type Result struct {
+	// Allowed is true if a token was available.
+	Allowed bool
+
+	// Limit is the capacity of the bucket.
+	Limit int
+
+	// Remaining is the number of whole tokens left in the bucket.
+	Remaining int
+
+	// Reset is the time until the bucket is full again.
+	Reset time.Duration
+
+	// RetryAfter is the time until a token will next be available. It is zero
+	// if the event was allowed.
+	RetryAfter time.Duration
+}
+
+// New creates a new Limiter which allows limit events per period for each key.
+func New(limit int, period time.Duration) *Limiter {
+	return &Limiter{
+		limit:   limit,
+		period:  period,
+		buckets: make(map[string]*bucket),
+		now:     time.Now,
+	}
+}
+
+// Allow takes a token from the bucket for the given key, if one is available.
+func (l *Limiter) Allow(key string) Result {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	l.sweep(now)
+
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{tokens: float64(l.limit), updated: now}
+		l.buckets[key] = b
+	}
+
+	b.tokens = math.Min(float64(l.limit), b.tokens+now.Sub(b.updated).Seconds()*l.rate())
+	b.updated = now
+
+	res := Result{Limit: l.limit}
+
+	if b.tokens >= 1 {
+		b.tokens--
+		res.Allowed = true
+	} else {
+		res.RetryAfter = l.durationFor(1 - b.tokens)
+	}
+
+	res.Remaining = int(b.tokens)
+	res.Reset = l.durationFor(float64(l.limit) - b.tokens)
+
+	return res
+}
+
+// rate returns the refill rate in tokens per second.
+func (l *Limiter) rate() float64 {
+	return float64(l.limit) / l.period.Seconds()
+}
+
+func (l *Limiter) durationFor(tokens float64) time.Duration {
+	return time.Duration(tokens / l.rate() * float64(time.Second))
+}
+
+// sweep removes buckets which would have refilled completely, at most once
+// per period, so that the number of buckets does not grow without bound.
+func (l *Limiter) sweep(now time.Time) {
+	if now.Sub(l.swept) < l.period {
+		return
+	}
+
+	for key, b := range l.buckets {
+		if now.Sub(b.updated) >= l.period {
+			delete(l.buckets, key)
+		}
+	}
+
+	l.swept = now
+}
@@ -0,0 +1,210 @@
+// Package shortlinks provides short URLs which redirect to longer ones and
+// count how often they are followed.
+package shortlinks
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/url"
+	"regexp"
+	"time"
+
+	"github.com/Masterminds/squirrel"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// codeLength is the length of generated codes.
+const codeLength = 6
+
+// codeAlphabet excludes characters which are easily confused with others.
+const codeAlphabet = "23456789abcdefghjkmnpqrstuvwxyzABCDEFGHJKLMNPQRSTUVWXYZ"
+
+// maxAttempts is the number of generated codes tried before giving up, in
+// case of collisions.
+const maxAttempts = 5
+
+// uniqueViolationCode is the Postgres error code for unique constraint
+// violations.
+const uniqueViolationCode = "23505"
+
+var codeRegex = regexp.MustCompile(`^[A-Za-z0-9_-]{1,32}$`)
+
+// ErrInvalidCode is returned when creating a link with an invalid code.
+var ErrInvalidCode = errors.New("invalid code")
+
+// ErrInvalidURL is returned when creating a link to a URL which is not an
+// absolute HTTP(S) URL.
+var ErrInvalidURL = errors.New("invalid url")
+
+// ErrLinkExists is returned when creating a link with a code which is taken.
+var ErrLinkExists = errors.New("link exists")
+
+// ErrLinkNotFound is returned when a link is not found.
+var ErrLinkNotFound = errors.New("link not found")
+
+// A Link is a short code for a URL.
+type Link struct {
+	Code      string    `json:"code"`
+	URL       string    `json:"url"`
+	Clicks    int       `json:"clicks"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// A Service creates and resolves short links.
+type Service struct {
+	pool *pgxpool.Pool
+	sql  squirrel.StatementBuilderType
+}
+
+// New creates a new Service.
+func New(pool *pgxpool.Pool) *Service {
+	return &Service{
+		pool: pool,
+		sql:  squirrel.StatementBuilder.PlaceholderFormat(squirrel.Dollar),
+	}
+}
+
+// Create creates a link to the given URL. If code is empty, a random code is
+// generated.
+func (s *Service) Create(ctx context.Context, code, target string) (Link, error) {
+	if u, err := url.Parse(target); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return Link{}, ErrInvalidURL
+	}
+
+	if code != "" {
+		if !codeRegex.MatchString(code) {
+			return Link{}, ErrInvalidCode
+		}
+
+		return s.insert(ctx, code, target)
+	}
+
+	for i := 0; i < maxAttempts; i++ {
+		code, err := generateCode()
+		if err != nil {
+			return Link{}, err
+		}
+
+		link, err := s.insert(ctx, code, target)
+		if errors.Is(err, ErrLinkExists) {
+			continue
+		}
+
+		return link, err
+	}
+
+	return Link{}, fmt.Errorf("could not generate a unique code after %d attempts", maxAttempts)
+}
+
+func (s *Service) insert(ctx context.Context, code, target string) (Link, error) {
+	query, args, err := s.sql.
+		Insert(shortLinksTable).
+		Columns(shortLinksCodeColumn, shortLinksURLColumn).
+		Values(code, target).
+		Suffix("RETURNING " + shortLinksColumns).
+		ToSql()
+	if err != nil {
+		return Link{}, fmt.Errorf("could not build query: %w", err)
+	}
+
+	link, err := scanLink(s.pool.QueryRow(ctx, query, args...))
+	if err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == uniqueViolationCode {
+			return Link{}, ErrLinkExists
+		}
+
+		return Link{}, fmt.Errorf("could not create link: %w", err)
+	}
+
+	return link, nil
+}
+
+// Get returns the link with the given code.
+//
+// If no link is found, ErrLinkNotFound is returned.
+func (s *Service) Get(ctx context.Context, code string) (Link, error) {
+	query, args, err := s.sql.
+		Select(shortLinksColumns).
+		From(shortLinksTable).
+		Where(squirrel.Eq{shortLinksCodeColumn: code}).
+		ToSql()
+	if err != nil {
+		return Link{}, fmt.Errorf("could not build query: %w", err)
+	}
+
+	link, err := scanLink(s.pool.QueryRow(ctx, query, args...))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return Link{}, ErrLinkNotFound
+		}
+
+		return Link{}, fmt.Errorf("could not get link: %w", err)
+	}
+
+	return link, nil
+}
+
+// Follow returns the URL of the link with the given code, and counts a click
+// on it.
+//
+// If no link is found, ErrLinkNotFound is returned.
+func (s *Service) Follow(ctx context.Context, code string) (string, error) {
+	query, args, err := s.sql.
+		Update(shortLinksTable).
+		Set(shortLinksClicksColumn, squirrel.Expr(shortLinksClicksColumn+" + 1")).
+		Where(squirrel.Eq{shortLinksCodeColumn: code}).
+		Suffix("RETURNING " + shortLinksURLColumn).
+		ToSql()
+	if err != nil {
+		return "", fmt.Errorf("could not build query: %w", err)
+	}
+
+	var target string
+	if err := s.pool.QueryRow(ctx, query, args...).Scan(&target); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return "", ErrLinkNotFound
+		}
+
+		return "", fmt.Errorf("could not follow link: %w", err)
+	}
+
+	return target, nil
+}
+
+func generateCode() (string, error) {
+	code := make([]byte, codeLength)
+	max := big.NewInt(int64(len(codeAlphabet)))
+
+	for i := range code {
+		n, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return "", fmt.Errorf("could not generate code: %w", err)
+		}
+
+		code[i] = codeAlphabet[n.Int64()]
+	}
+
+	return string(code), nil
+}
+
+func scanLink(row pgx.Row) (Link, error) {
+	var link Link
+	if err := row.Scan(&link.Code, &link.URL, &link.Clicks, &link.CreatedAt); err != nil {
+		return Link{}, err //nolint:wrapcheck
+	}
+
+	return link, nil
+}
+
+const shortLinksTable = "short_links"
+const shortLinksCodeColumn = "code"
+const shortLinksURLColumn = "url"
+const shortLinksClicksColumn = "clicks"
+const shortLinksCreatedAtColumn = "created_at"
+const shortLinksColumns = shortLinksCodeColumn + ", " + shortLinksURLColumn + ", " + shortLinksClicksColumn + ", " + shortLinksCreatedAtColumn
@@ -0,0 +1,255 @@
+// Package storage uploads and deletes public objects in DigitalOcean Spaces.
+//
+// Spaces implements the S3 API, so objects are stored with the AWS SDK.
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/feature/s3/manager"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/jclem/jclem.me/internal/telemetry"
+)
+
+// ErrNotConfigured is returned when creating a client without credentials.
+var ErrNotConfigured = errors.New("storage is not configured")
+
+// ErrNotFound is returned when getting an object which does not exist.
+var ErrNotFound = errors.New("object not found")
+
+// Defaults for the optional parts of a Config.
+const (
+	DefaultACL          = "public-read"
+	DefaultCacheControl = "public, max-age=31536000, immutable"
+	DefaultTimeout      = 2 * time.Minute
+)
+
+// maxAttempts is the number of times a request is attempted before it fails.
+const maxAttempts = 5
+
+// partSize is the size of each part of a multipart upload. Objects smaller
+// than this are uploaded in a single request.
+const partSize = 8 << 20
+
+// A Client uploads and deletes objects in a Spaces bucket.
+type Client struct {
+	s3           *s3.Client
+	uploader     *manager.Uploader
+	bucket       string
+	publicURL    string
+	acl          types.ObjectCannedACL
+	cacheControl string
+	timeout      time.Duration
+}
+
+// Config configures a Client.
+type Config struct {
+	// KeyID and Secret are the Spaces access key.
+	KeyID  string
+	Secret string
+
+	// Endpoint is the regional Spaces endpoint, such as
+	// "nyc3.digitaloceanspaces.com".
+	Endpoint string
+
+	// Bucket is the name of the Space.
+	Bucket string
+
+	// PublicURL is the URL at which objects are publicly served, such as the
+	// Space's CDN endpoint. If it is empty, objects are served from the
+	// Space's origin.
+	PublicURL string
+
+	// ACL is the canned ACL of uploaded objects. It defaults to DefaultACL.
+	ACL string
+
+	// CacheControl is the Cache-Control header of uploaded objects. It
+	// defaults to DefaultCacheControl.
+	CacheControl string
+
+	// Timeout limits each upload or deletion, including its retries. It
+	// defaults to DefaultTimeout.
+	Timeout time.Duration
+}
+
+// New returns a new client.
+func New(cfg Config) (*Client, error) {
+	if cfg.KeyID == "" || cfg.Secret == "" || cfg.Endpoint == "" || cfg.Bucket == "" {
+		return nil, ErrNotConfigured
+	}
+
+	publicURL := cfg.PublicURL
+	if publicURL == "" {
+		publicURL = fmt.Sprintf("https://%s.%s", cfg.Bucket, cfg.Endpoint)
+	}
+
+	acl := cfg.ACL
+	if acl == "" {
+		acl = DefaultACL
+	}
+
+	cacheControl := cfg.CacheControl
+	if cacheControl == "" {
+		cacheControl = DefaultCacheControl
+	}
+
+	timeout := cfg.Timeout
+	if timeout == 0 {
+		timeout = DefaultTimeout
+	}
+
+	client := s3.New(s3.Options{
+		Region:           strings.SplitN(cfg.Endpoint, ".", 2)[0],
+		BaseEndpoint:     aws.String("https://" + cfg.Endpoint),
+		Credentials:      credentials.NewStaticCredentialsProvider(cfg.KeyID, cfg.Secret, ""),
+		HTTPClient:       telemetry.HTTPClient,
+		RetryMaxAttempts: maxAttempts,
+	})
+
+	return &Client{
+		s3: client,
+		uploader: manager.NewUploader(client, func(u *manager.Uploader) {
+			u.PartSize = partSize
+		}),
+		bucket:       cfg.Bucket,
+		publicURL:    strings.TrimSuffix(publicURL, "/"),
+		acl:          types.ObjectCannedACL(acl),
+		cacheControl: cacheControl,
+		timeout:      timeout,
+	}, nil
+}
+
+// URL returns the public URL of the object with the given key.
+func (c *Client) URL(key string) string {
+	return c.publicURL + "/" + key
+}
+
+// Key returns the key of the object at the given public URL, if it is in the
+// bucket.
+func (c *Client) Key(publicURL string) (string, bool) {
+	key, ok := strings.CutPrefix(publicURL, c.publicURL+"/")
+	if !ok || key == "" {
+		return "", false
+	}
+
+	return key, true
+}
+
+// Put uploads an object, returning its public URL. The body is streamed, and
+// uploaded in parts if it is large.
+func (c *Client) Put(ctx context.Context, key, contentType string, body io.Reader) (string, error) {
+	if err := c.put(ctx, key, contentType, body, c.acl); err != nil {
+		return "", err
+	}
+
+	return c.URL(key), nil
+}
+
+// PutPrivate uploads an object which is not publicly readable, such as an
+// upload which has yet to be processed.
+func (c *Client) PutPrivate(ctx context.Context, key, contentType string, body io.Reader) error {
+	return c.put(ctx, key, contentType, body, types.ObjectCannedACLPrivate)
+}
+
+func (c *Client) put(ctx context.Context, key, contentType string, body io.Reader, acl types.ObjectCannedACL) error {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	if _, err := c.uploader.Upload(ctx, &s3.PutObjectInput{
+		Bucket:       aws.String(c.bucket),
+		Key:          aws.String(key),
+		Body:         body,
+		ContentType:  aws.String(contentType),
+		CacheControl: aws.String(c.cacheControl),
+		ACL:          acl,
+	}); err != nil {
+		return fmt.Errorf("could not upload object: %w", err)
+	}
+
+	return nil
+}
+
+// Delete deletes the object with the given key. Deleting an object which does
+// not exist is not an error.
+func (c *Client) Delete(ctx context.Context, key string) error {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	if _, err := c.s3.DeleteObject(ctx, &s3.DeleteObjectInput{
+		Bucket: aws.String(c.bucket),
+		Key:    aws.String(key),
+	}); err != nil {
+		return fmt.Errorf("could not delete object: %w", err)
+	}
+
+	return nil
+}
+
+// Get returns the body of the object with the given key, which the caller must
+// close.
+func (c *Client) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	out, err := c.s3.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(c.bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		var noSuchKey *types.NoSuchKey
+		if errors.As(err, &noSuchKey) {
+			return nil, ErrNotFound
+		}
+
+		return nil, fmt.Errorf("could not get object: %w", err)
+	}
+
+	return out.Body, nil
+}
+
+// A PresignedPut is a request which uploads an object without credentials.
+type PresignedPut struct {
+	// URL is the URL to which the object is uploaded.
+	URL string `json:"url"`
+
+	// Method is the HTTP method of the request.
+	Method string `json:"method"`
+
+	// Headers are the headers which the request must be sent with, such as its
+	// content type and length.
+	Headers http.Header `json:"headers"`
+
+	// ExpiresAt is when the URL stops being accepted.
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+// PresignPut returns a request which uploads an object of the given content
+// type and size within the given duration. The uploaded object is private.
+func (c *Client) PresignPut(ctx context.Context, key, contentType string, size int64, expires time.Duration) (PresignedPut, error) {
+	req, err := s3.NewPresignClient(c.s3).PresignPutObject(ctx, &s3.PutObjectInput{
+		Bucket:        aws.String(c.bucket),
+		Key:           aws.String(key),
+		ContentType:   aws.String(contentType),
+		ContentLength: aws.Int64(size),
+		ACL:           types.ObjectCannedACLPrivate,
+	}, s3.WithPresignExpires(expires))
+	if err != nil {
+		return PresignedPut{}, fmt.Errorf("could not presign upload: %w", err)
+	}
+
+	headers := req.SignedHeader.Clone()
+	headers.Del("Host")
+
+	return PresignedPut{
+		URL:       req.URL,
+		Method:    req.Method,
+		Headers:   headers,
+		ExpiresAt: time.Now().Add(expires),
+	}, nil
+}
@@ -0,0 +1,227 @@
+// Package telemetry provides OpenTelemetry tracing for HTTP handlers, outbound
+// HTTP requests, database queries, and background jobs.
+package telemetry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"slices"
+	"syscall"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/jackc/pgx/v5"
+	"github.com/jclem/jclem.me/internal/www/config"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.21.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	instrumentationName = "github.com/jclem/jclem.me"
+	serviceName         = "jclem.me"
+)
+
+// Setup configures the global tracer provider and propagator.
+//
+// Spans are exported over OTLP/HTTP only when tracing is enabled, in which
+// case the exporter is configured by the standard OTEL_EXPORTER_OTLP_*
+// environment variables. The returned function flushes and stops the exporter.
+func Setup(ctx context.Context, c config.Config) (func(context.Context) error, error) {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(
+		propagation.TraceContext{},
+		propagation.Baggage{},
+	))
+
+	if !c.TracingEnabled {
+		return func(context.Context) error { return nil }, nil
+	}
+
+	exporter, err := otlptracehttp.New(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("error creating trace exporter: %w", err)
+	}
+
+	res, err := resource.Merge(resource.Default(), resource.NewWithAttributes(
+		semconv.SchemaURL,
+		semconv.ServiceName(serviceName),
+		semconv.DeploymentEnvironment(string(c.AppEnv)),
+	))
+	if err != nil {
+		return nil, fmt.Errorf("error creating trace resource: %w", err)
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+	)
+
+	otel.SetTracerProvider(provider)
+
+	return provider.Shutdown, nil
+}
+
+// Tracer returns the tracer used for the application's own spans.
+func Tracer() trace.Tracer {
+	return otel.Tracer(instrumentationName)
+}
+
+// Middleware starts a server span for each request, continuing any trace
+// propagated by the client. Once the request has been routed, the span is
+// renamed after the matched route pattern.
+func Middleware(next http.Handler) http.Handler {
+	named := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		next.ServeHTTP(w, r)
+
+		if rctx := chi.RouteContext(r.Context()); rctx != nil {
+			if pattern := rctx.RoutePattern(); pattern != "" {
+				span := trace.SpanFromContext(r.Context())
+				span.SetName(r.Method + " " + pattern)
+				span.SetAttributes(semconv.HTTPRoute(pattern))
+			}
+		}
+	})
+
+	return otelhttp.NewHandler(named, "http.request")
+}
+
+// HTTPClient is an HTTP client which creates a client span for each request
+// and propagates the trace to the remote server. Requests are cancelled with
+// their contexts, such as a job's, which has a deadline. Its timeout is a
+// backstop for those whose contexts have none.
+var HTTPClient = &http.Client{ //nolint:gochecknoglobals
+	Transport: otelhttp.NewTransport(http.DefaultTransport),
+	Timeout:   HTTPClientTimeout,
+}
+
+// PublicHTTPClient is like HTTPClient, but connects only to public addresses,
+// refusing loopback, private, link-local, and other special-use ones when it
+// dials, after hostnames are resolved. It is for requests to hosts which
+// anonymous visitors choose, so that they cannot make the server reach its own
+// network.
+var PublicHTTPClient = &http.Client{ //nolint:gochecknoglobals
+	Transport: otelhttp.NewTransport(publicTransport()),
+	Timeout:   HTTPClientTimeout,
+}
+
+// ErrNonPublicAddress is returned by PublicHTTPClient for requests to hosts
+// which are not at public addresses.
+var ErrNonPublicAddress = errors.New("refusing to connect to a non-public address")
+
+// nonPublicPrefixes are special-use IP ranges which are neither private,
+// loopback, nor link-local, but are no more public.
+//
+//nolint:gochecknoglobals
+var nonPublicPrefixes = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),
+	netip.MustParsePrefix("100.64.0.0/10"),
+}
+
+// publicTransport returns a transport which dials only public addresses, and
+// not through a proxy, which would dial for it.
+func publicTransport() *http.Transport {
+	transport := http.DefaultTransport.(*http.Transport).Clone() //nolint:forcetypeassert
+	transport.Proxy = nil
+
+	dialer := &net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second, Control: refuseNonPublic}
+	transport.DialContext = dialer.DialContext
+
+	return transport
+}
+
+// refuseNonPublic refuses to dial addresses which are not public.
+func refuseNonPublic(_, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return fmt.Errorf("invalid address: %w", err)
+	}
+
+	ip, err := netip.ParseAddr(host)
+	if err != nil {
+		return fmt.Errorf("invalid address: %w", err)
+	}
+
+	ip = ip.Unmap()
+
+	if !ip.IsGlobalUnicast() || ip.IsPrivate() || slices.ContainsFunc(nonPublicPrefixes, func(p netip.Prefix) bool { return p.Contains(ip) }) {
+		return fmt.Errorf("%w: %s", ErrNonPublicAddress, ip)
+	}
+
+	return nil
+}
+
+// HTTPClientTimeout is the longest any request made with HTTPClient may take.
+const HTTPClientTimeout = time.Minute
+
+// A QueryTracer creates a span for each database query. It implements the
+// pgx.QueryTracer interface.
+type QueryTracer struct{}
+
+// TraceQueryStart implements the pgx.QueryTracer interface.
+func (QueryTracer) TraceQueryStart(ctx context.Context, _ *pgx.Conn, data pgx.TraceQueryStartData) context.Context {
+	ctx, _ = Tracer().Start(ctx, "db.query",
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			semconv.DBSystemPostgreSQL,
+			semconv.DBStatement(data.SQL),
+		),
+	)
+
+	return ctx
+}
+
+// TraceQueryEnd implements the pgx.QueryTracer interface.
+func (QueryTracer) TraceQueryEnd(ctx context.Context, _ *pgx.Conn, data pgx.TraceQueryEndData) {
+	span := trace.SpanFromContext(ctx)
+	span.SetAttributes(attribute.Int64("db.rows_affected", data.CommandTag.RowsAffected()))
+	End(span, data.Err)
+}
+
+// A Carrier holds trace context propagated through a job's arguments so that a
+// job's span continues the trace of the request which enqueued it.
+type Carrier = propagation.MapCarrier
+
+// Inject returns a Carrier containing the trace context of ctx.
+func Inject(ctx context.Context) Carrier {
+	carrier := Carrier{}
+	otel.GetTextMapPropagator().Inject(ctx, carrier)
+
+	return carrier
+}
+
+// StartJob starts a span for working a job, continuing the trace propagated in
+// carrier.
+func StartJob(ctx context.Context, kind string, attempt int, carrier Carrier) (context.Context, trace.Span) {
+	if carrier != nil {
+		ctx = otel.GetTextMapPropagator().Extract(ctx, carrier)
+	}
+
+	return Tracer().Start(ctx, "job "+kind, //nolint:spancheck
+		trace.WithSpanKind(trace.SpanKindConsumer),
+		trace.WithAttributes(
+			attribute.String("job.kind", kind),
+			attribute.Int("job.attempt", attempt),
+		),
+	)
+}
+
+// End records err on span, if it is not nil, and ends the span.
+func End(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+
+	span.End()
+}
@@ -0,0 +1,248 @@
+// Package timeline interleaves the site's kinds of content—posts, notes,
+// dispatches, and bookmarks—into a single timeline, most recent first.
+package timeline
+
+import (
+	"context"
+	"fmt"
+	"html"
+	"html/template"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	ap "github.com/jclem/jclem.me/internal/activitypub"
+	"github.com/jclem/jclem.me/internal/bookmarks"
+	"github.com/jclem/jclem.me/internal/dispatches"
+	"github.com/jclem/jclem.me/internal/posts"
+)
+
+// A Kind is a kind of content in the timeline.
+type Kind string
+
+const (
+	KindPost     Kind = "post"
+	KindNote     Kind = "note"
+	KindDispatch Kind = "dispatch"
+	KindBookmark Kind = "bookmark"
+)
+
+// Kinds lists every kind of content, in the order in which they are offered as
+// filters.
+//
+//nolint:gochecknoglobals
+var Kinds = []Kind{KindPost, KindNote, KindDispatch, KindBookmark}
+
+// DefaultLimit is the number of items listed if no limit is given.
+const DefaultLimit = 50
+
+// searchWindow is the number of items requested from each source when
+// searching, since matching items may be older than the most recent few.
+const searchWindow = 1000
+
+// An Item is a piece of content in the timeline.
+type Item interface {
+	// Kind returns the kind of content the item is.
+	Kind() Kind
+
+	// Date returns when the item was published.
+	Date() time.Time
+
+	// Text returns the plain text of the item, which is what search matches.
+	Text() string
+}
+
+// A Source lists the most recent items of one kind, most recent first.
+type Source func(ctx context.Context, limit int) ([]Item, error)
+
+// A Service lists items from its sources.
+type Service struct {
+	mu      sync.RWMutex
+	sources []Source
+}
+
+// New creates a new timeline service which lists items from the given sources.
+func New(sources ...Source) *Service {
+	return &Service{sources: sources}
+}
+
+// AddSource adds a source to the timeline.
+func (s *Service) AddSource(source Source) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.sources = append(s.sources, source)
+}
+
+type listOpts struct {
+	query  string
+	kind   Kind
+	limit  int
+	offset int
+}
+
+// A ListOpt filters the items returned by List.
+type ListOpt func(*listOpts)
+
+// WithQuery lists only items whose text contains every word of the given
+// query, ignoring case.
+func WithQuery(query string) ListOpt {
+	return func(o *listOpts) {
+		o.query = strings.TrimSpace(query)
+	}
+}
+
+// WithKind lists only items of the given kind. Every kind is listed if kind is
+// empty.
+func WithKind(kind Kind) ListOpt {
+	return func(o *listOpts) {
+		o.kind = kind
+	}
+}
+
+// WithOffset skips the given number of the most recent items, such as to list
+// a page of items after the first.
+func WithOffset(offset int) ListOpt {
+	return func(o *listOpts) {
+		o.offset = offset
+	}
+}
+
+// WithLimit lists at most the given number of items.
+func WithLimit(limit int) ListOpt {
+	return func(o *listOpts) {
+		o.limit = limit
+	}
+}
+
+// List returns items from every source matching the given options, most recent
+// first.
+func (s *Service) List(ctx context.Context, opts ...ListOpt) ([]Item, error) {
+	o := listOpts{limit: DefaultLimit}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	window := o.offset + o.limit
+	if o.query != "" {
+		window = max(window, searchWindow)
+	}
+
+	terms := strings.Fields(strings.ToLower(o.query))
+
+	s.mu.RLock()
+	sources := s.sources
+	s.mu.RUnlock()
+
+	var items []Item
+
+	for _, source := range sources {
+		list, err := source(ctx, window)
+		if err != nil {
+			return nil, fmt.Errorf("error listing timeline items: %w", err)
+		}
+
+		for _, item := range list {
+			if (o.kind == "" || item.Kind() == o.kind) && matches(item, terms) {
+				items = append(items, item)
+			}
+		}
+	}
+
+	sort.SliceStable(items, func(i, j int) bool {
+		return items[i].Date().After(items[j].Date())
+	})
+
+	items = items[min(o.offset, len(items)):]
+
+	if len(items) > o.limit {
+		items = items[:o.limit]
+	}
+
+	return items, nil
+}
+
+func matches(item Item, terms []string) bool {
+	if len(terms) == 0 {
+		return true
+	}
+
+	text := strings.ToLower(item.Text())
+
+	for _, term := range terms {
+		if !strings.Contains(text, term) {
+			return false
+		}
+	}
+
+	return true
+}
+
+var tagRegex = regexp.MustCompile(`<[^>]*>`)
+
+// plainText strips tags from the given HTML and unescapes its entities.
+func plainText(s string) string {
+	return html.UnescapeString(tagRegex.ReplaceAllString(s, " "))
+}
+
+// A Post is a post in the timeline.
+type Post struct {
+	posts.Post
+}
+
+func (p Post) Kind() Kind      { return KindPost }
+func (p Post) Date() time.Time { return p.PublishedAt }
+
+func (p Post) Text() string {
+	return strings.Join([]string{p.Title, p.Summary, strings.Join(p.Tags, " "), plainText(string(p.Content))}, " ")
+}
+
+// A Note is a public ActivityPub note in the timeline.
+type Note struct {
+	ap.NoteRecord
+}
+
+func (n Note) Kind() Kind      { return KindNote }
+func (n Note) Date() time.Time { return n.Published }
+func (n Note) Text() string    { return plainText(n.Content) }
+
+// HTML returns the note's content, which is HTML.
+func (n Note) HTML() template.HTML {
+	return template.HTML(n.Content) //nolint:gosec
+}
+
+// A Dispatch is a dispatch in the timeline.
+type Dispatch struct {
+	dispatches.Dispatch
+}
+
+func (d Dispatch) Kind() Kind      { return KindDispatch }
+func (d Dispatch) Date() time.Time { return d.InsertedAt }
+
+func (d Dispatch) Text() string {
+	text := []string{d.Body, d.Alt}
+
+	if d.Link != nil {
+		text = append(text, d.Link.URL, d.Link.Title, d.Link.Description)
+	}
+
+	if d.Checkin != nil {
+		text = append(text, d.Checkin.Name, d.Checkin.Address)
+	}
+
+	return strings.Join(text, " ")
+}
+
+// A Bookmark is a bookmark in the timeline.
+type Bookmark struct {
+	bookmarks.Bookmark
+}
+
+func (b Bookmark) Kind() Kind      { return KindBookmark }
+func (b Bookmark) Date() time.Time { return b.CreatedAt }
+
+func (b Bookmark) Text() string {
+	return strings.Join([]string{b.Title, b.URL, b.Comment, strings.Join(b.Tags, " ")}, " ")
+}
@@ -0,0 +1,66 @@
+// Package watch reloads content when files on disk change.
+package watch
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// debounce is how long to wait after a change for further changes, so that an
+// editor saving several files causes a single reload.
+const debounce = 100 * time.Millisecond
+
+// Watch calls reload whenever files in the given directories change, until
+// ctx is done. Errors from reload are logged rather than returned, so that a
+// malformed file being edited does not stop the watcher.
+func Watch(ctx context.Context, reload func(context.Context) error, dirs ...string) error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return fmt.Errorf("error creating watcher: %w", err)
+	}
+
+	defer watcher.Close()
+
+	for _, dir := range dirs {
+		if err := watcher.Add(dir); err != nil {
+			return fmt.Errorf("error watching %s: %w", dir, err)
+		}
+	}
+
+	timer := time.NewTimer(debounce)
+	timer.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return nil
+			}
+
+			if event.Has(fsnotify.Chmod) && !event.Has(fsnotify.Write) {
+				continue
+			}
+
+			timer.Reset(debounce)
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return nil
+			}
+
+			slog.Error("error watching files", "error", err)
+		case <-timer.C:
+			if err := reload(ctx); err != nil {
+				slog.Error("error reloading content", "error", err, "dirs", dirs)
+				continue
+			}
+
+			slog.Info("reloaded content", "dirs", dirs)
+		}
+	}
+}
@@ -4,9 +4,16 @@ package webfinger
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"net"
 	"net/http"
 	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/jclem/jclem.me/internal/telemetry"
 )
 
 // A JRD is a JSON Resource Descriptor.
@@ -26,10 +33,52 @@ type Link struct {
 	Rel        string            `json:"rel,omitempty"`
 	Type       string            `json:"type,omitempty"`
 	Href       string            `json:"href,omitempty"`
+	Template   string            `json:"template,omitempty"`
 	Titles     map[string]string `json:"titles,omitempty"`
 	Properties map[string]any    `json:"properties,omitempty"`
 }
 
+// Link relations which are served.
+//
+// SEE https://webfinger.net/rel/
+const (
+	// SelfRel links to an account's ActivityPub actor.
+	SelfRel = "self"
+
+	// ProfilePageRel links to an account's profile page.
+	ProfilePageRel = "http://webfinger.net/rel/profile-page"
+
+	// AvatarRel links to an account's avatar image.
+	AvatarRel = "http://webfinger.net/rel/avatar"
+
+	// SubscribeRel links to a template for the URL at which an account follows
+	// another, whose URI replaces "{uri}".
+	SubscribeRel = "http://ostatus.org/schema/1.0/subscribe"
+)
+
+// FilterLinks returns the JRD with only the links whose relation is one of
+// rels, as a request's rel parameters ask for, or with all links if there are
+// no rels.
+//
+// SEE https://datatracker.ietf.org/doc/html/rfc7033#section-4.3
+func (j JRD) FilterLinks(rels []string) JRD {
+	if len(rels) == 0 {
+		return j
+	}
+
+	links := make([]Link, 0, len(j.Links))
+
+	for _, link := range j.Links {
+		if slices.Contains(rels, link.Rel) {
+			links = append(links, link)
+		}
+	}
+
+	j.Links = links
+
+	return j
+}
+
 // Path is the universal WebFinger path.
 const Path = "/.well-known/webfinger"
 
@@ -40,6 +89,16 @@ const ContentType = "application/jrd+json"
 //
 // SEE https://datatracker.ietf.org/doc/html/rfc7033#section-4
 func Request(ctx context.Context, domain string, resource string) (JRD, error) {
+	return request(ctx, telemetry.HTTPClient, domain, resource)
+}
+
+func request(ctx context.Context, client *http.Client, domain string, resource string) (JRD, error) {
+	// The domain is interpolated into the URL, so it must not add a path,
+	// query, or user to it.
+	if !validDomain(domain) {
+		return JRD{}, fmt.Errorf("invalid domain: %q", domain)
+	}
+
 	url := fmt.Sprintf("https://%s%s?resource=%s", domain, Path, url.QueryEscape(resource))
 
 	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
@@ -49,7 +108,7 @@ func Request(ctx context.Context, domain string, resource string) (JRD, error) {
 
 	req.Header.Set("Accept", ContentType)
 
-	resp, err := http.DefaultClient.Do(req)
+	resp, err := client.Do(req)
 	if err != nil {
 		return JRD{}, fmt.Errorf("failed to perform request: %w", err)
 	}
@@ -68,3 +127,103 @@ func Request(ctx context.Context, domain string, resource string) (JRD, error) {
 
 	return jrd, nil
 }
+
+// validDomain returns true if a domain is a hostname, with an optional port,
+// and nothing else.
+func validDomain(domain string) bool {
+	host := domain
+
+	if h, port, err := net.SplitHostPort(domain); err == nil {
+		if _, err := strconv.ParseUint(port, 10, 16); err != nil {
+			return false
+		}
+
+		host = h
+	}
+
+	if host == "" || len(host) > 253 {
+		return false
+	}
+
+	for _, c := range host {
+		if c != '-' && c != '.' && (c < '0' || c > '9') && (c < 'a' || c > 'z') && (c < 'A' || c > 'Z') {
+			return false
+		}
+	}
+
+	return true
+}
+
+// ErrInvalidAddress is returned for account addresses which are not a username
+// and a domain, which is a hostname with an optional port.
+var ErrInvalidAddress = errors.New("invalid account address")
+
+// splitAddress returns the WebFinger resource and domain of an account address,
+// such as "user@example.com", with or without a leading "@".
+func splitAddress(address string) (string, string, error) {
+	address = strings.TrimPrefix(address, "@")
+
+	user, domain, ok := strings.Cut(address, "@")
+	if !ok || user == "" || !validDomain(domain) {
+		return "", "", fmt.Errorf("%w: %q", ErrInvalidAddress, address)
+	}
+
+	return "acct:" + address, domain, nil
+}
+
+// ResolveActor returns the ActivityPub actor ID of an account address, such as
+// "user@example.com", from the "self" link of its WebFinger resource.
+func ResolveActor(ctx context.Context, address string) (string, error) {
+	resource, domain, err := splitAddress(address)
+	if err != nil {
+		return "", err
+	}
+
+	jrd, err := Request(ctx, domain, resource)
+	if err != nil {
+		return "", err
+	}
+
+	for _, link := range jrd.Links {
+		if link.Rel == SelfRel && link.Href != "" {
+			return link.Href, nil
+		}
+	}
+
+	return "", fmt.Errorf("no actor found for %q", address)
+}
+
+// SubscribeURL returns the URL at which the account with an address, such as
+// "user@example.com", follows the account with a URI, from the "subscribe"
+// link of its WebFinger resource. This is how servers such as Mastodon take
+// follows started on other servers' profile pages.
+//
+// Anyone may ask for this, so the resource is requested only from a public
+// address, and the URL must be on the account's domain, lest this redirect
+// visitors elsewhere.
+func SubscribeURL(ctx context.Context, address string, uri string) (string, error) {
+	resource, domain, err := splitAddress(address)
+	if err != nil {
+		return "", err
+	}
+
+	jrd, err := request(ctx, telemetry.PublicHTTPClient, domain, resource)
+	if err != nil {
+		return "", err
+	}
+
+	for _, link := range jrd.Links {
+		if link.Rel != SubscribeRel || link.Template == "" {
+			continue
+		}
+
+		target, err := url.Parse(strings.ReplaceAll(link.Template, "{uri}", url.QueryEscape(uri)))
+		if err != nil || (target.Scheme != "https" && target.Scheme != "http") || !strings.EqualFold(target.Host, domain) {
+			return "", fmt.Errorf("invalid subscribe template for %q: %q", address, link.Template)
+		}
+
+		return target.String(), nil
+	}
+
+	return "", fmt.Errorf("no subscribe template found for %q", address)
+}
@@ -0,0 +1,181 @@
+// Package webhooks provides delivery of signed event notifications to a
+// configured HTTP endpoint.
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/jclem/jclem.me/internal/queues"
+	"github.com/jclem/jclem.me/internal/telemetry"
+	"github.com/riverqueue/river"
+)
+
+// An EventType identifies a kind of event.
+type EventType = string
+
+const (
+	// FollowerCreated is emitted when a remote actor follows a user.
+	FollowerCreated EventType = "follower.created"
+
+	// ReplyReceived is emitted when a remote actor replies to a user's note.
+	ReplyReceived EventType = "reply.received"
+
+	// DeliveryFailed is emitted when an activity could not be delivered to a
+	// remote inbox and will not be retried.
+	DeliveryFailed EventType = "delivery.failed"
+
+	// DeliveryHostFailing is emitted when many of the activities delivered to a
+	// host during a metrics interval fail. It is not emitted again for the host
+	// until its deliveries recover.
+	DeliveryHostFailing EventType = "delivery.host_failing"
+
+	// JobDiscarded is emitted when a job fails for the last time.
+	JobDiscarded EventType = "job.discarded"
+
+	// WebmentionReceived is emitted when another site's page is verified to
+	// link to a page on this one.
+	WebmentionReceived EventType = "webmention.received"
+)
+
+// SignatureHeader is the header containing the hex-encoded HMAC-SHA256
+// signature of the request body, prefixed with "sha256=".
+const SignatureHeader = "X-Webhook-Signature"
+
+// EventHeader is the header containing the event type.
+const EventHeader = "X-Webhook-Event"
+
+// An Event is the payload of a webhook.
+type Event struct {
+	Type      EventType      `json:"type"`
+	CreatedAt time.Time      `json:"created_at"`
+	Data      map[string]any `json:"data"`
+}
+
+// NewEvent creates a new event of the given type.
+func NewEvent(typ EventType, data map[string]any) Event {
+	return Event{
+		Type:      typ,
+		CreatedAt: time.Now().UTC(),
+		Data:      data,
+	}
+}
+
+// A Config configures webhook delivery.
+type Config struct {
+	// URL is the endpoint to which events are delivered. If it is empty, no
+	// events are delivered.
+	URL string
+
+	// Secret is the key used to sign payloads.
+	Secret string
+
+	// Events is the list of event types to deliver. If it is empty, all events
+	// are delivered.
+	Events []EventType
+}
+
+// Enabled returns true if events of the given type should be delivered.
+func (c Config) Enabled(typ EventType) bool {
+	if c.URL == "" {
+		return false
+	}
+
+	return len(c.Events) == 0 || slices.Contains(c.Events, typ)
+}
+
+// Sign returns the value of the signature header for the given body.
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// DeliverArgs are the arguments of a webhook delivery job.
+type DeliverArgs struct {
+	Event Event `json:"event"`
+
+	// Trace is the trace context of the request which enqueued the job.
+	Trace telemetry.Carrier `json:"trace,omitempty"`
+}
+
+// Kind implements the river.JobArgs interface.
+func (a DeliverArgs) Kind() string {
+	return "deliver-webhook"
+}
+
+// InsertOpts implements the river.JobArgsWithInsertOpts interface.
+func (a DeliverArgs) InsertOpts() river.InsertOpts {
+	return river.InsertOpts{Queue: queues.Delivery}
+}
+
+// A DeliverWorker delivers webhooks.
+type DeliverWorker struct {
+	river.WorkerDefaults[DeliverArgs]
+	config Config
+}
+
+// NewDeliverWorker creates a new DeliverWorker.
+func NewDeliverWorker(config Config) *DeliverWorker {
+	return &DeliverWorker{config: config}
+}
+
+const deliveryTimeout = 10 * time.Second
+
+// Work implements the river.Worker interface.
+func (w *DeliverWorker) Work(ctx context.Context, job *river.Job[DeliverArgs]) (err error) {
+	ctx, span := telemetry.StartJob(ctx, job.Kind, job.Attempt, job.Args.Trace)
+	defer func() { telemetry.End(span, err) }()
+
+	if w.config.URL == "" {
+		return nil
+	}
+
+	body, err := json.Marshal(job.Args.Event)
+	if err != nil {
+		return river.JobCancel(fmt.Errorf("failed to marshal event: %w", err)) //nolint:wrapcheck
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, deliveryTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.config.URL, bytes.NewReader(body))
+	if err != nil {
+		return river.JobCancel(fmt.Errorf("failed to create request: %w", err)) //nolint:wrapcheck
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(EventHeader, job.Args.Event.Type)
+	req.Header.Set(SignatureHeader, Sign(w.config.Secret, body))
+
+	resp, err := telemetry.HTTPClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send webhook: %w", err)
+	}
+
+	defer func() {
+		if err := resp.Body.Close(); err != nil {
+			slog.ErrorContext(ctx, "failed to close response body", "error", err)
+		}
+	}()
+
+	if !(200 <= resp.StatusCode && resp.StatusCode < 300) {
+		if resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests {
+			return fmt.Errorf("error sending webhook: %s", resp.Status)
+		}
+
+		return river.JobCancel(fmt.Errorf("error sending webhook: %s", resp.Status)) //nolint:wrapcheck
+	}
+
+	return nil
+}
@@ -0,0 +1,164 @@
+// Package webmention receives Webmentions: notifications that a page on
+// another site links to a page on this one.
+//
+// A mention is verified in a job, by fetching its source and checking that it
+// links to its target, before anyone is notified of it.
+//
+// SEE https://www.w3.org/TR/webmention/
+package webmention
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"regexp"
+	"time"
+
+	"github.com/jclem/jclem.me/internal/queues"
+	"github.com/jclem/jclem.me/internal/telemetry"
+	"github.com/riverqueue/river"
+)
+
+// ErrInvalidSource is returned when a mention's source is not an absolute http
+// or https URL.
+var ErrInvalidSource = errors.New("invalid source")
+
+// ErrInvalidTarget is returned when a mention's target is not a page on this
+// site, or is its source.
+var ErrInvalidTarget = errors.New("invalid target")
+
+// A Mention is a link from a source page to a target page on this site.
+type Mention struct {
+	Source string `json:"source"`
+	Target string `json:"target"`
+}
+
+// Validate checks that a mention's source is a web page, and that its target is
+// a different page on the site with the given host.
+func (m Mention) Validate(host string) error {
+	source, err := url.Parse(m.Source)
+	if err != nil || (source.Scheme != "http" && source.Scheme != "https") || source.Host == "" {
+		return ErrInvalidSource
+	}
+
+	target, err := url.Parse(m.Target)
+	if err != nil || (target.Scheme != "http" && target.Scheme != "https") || target.Host != host {
+		return ErrInvalidTarget
+	}
+
+	if m.Source == m.Target {
+		return ErrInvalidTarget
+	}
+
+	return nil
+}
+
+// fetchTimeout is how long a mention's source is given to respond.
+const fetchTimeout = 10 * time.Second
+
+// maxSourceBytes is how much of a mention's source is searched for its target.
+const maxSourceBytes = 1 << 20
+
+var linkRegex = regexp.MustCompile(`(?i)<(?:a|img|link)\s[^>]*?(?:href|src)="([^"]+)"`)
+
+// linksTo returns true if the given HTML links to target.
+func linksTo(body string, target string) bool {
+	for _, match := range linkRegex.FindAllStringSubmatch(body, -1) {
+		if html.UnescapeString(match[1]) == target {
+			return true
+		}
+	}
+
+	return false
+}
+
+// VerifyArgs are the arguments of a job which verifies a mention.
+type VerifyArgs struct {
+	Mention Mention `json:"mention"`
+
+	// Trace is the trace context of the request which enqueued the job.
+	Trace telemetry.Carrier `json:"trace,omitempty"`
+}
+
+// Kind implements the river.JobArgs interface.
+func (a VerifyArgs) Kind() string {
+	return "verify-webmention"
+}
+
+// InsertOpts implements the river.JobArgsWithInsertOpts interface.
+func (a VerifyArgs) InsertOpts() river.InsertOpts {
+	return river.InsertOpts{Queue: queues.Inbox}
+}
+
+// A NotifyFunc is called with each mention once it is verified.
+type NotifyFunc func(context.Context, Mention) error
+
+// A VerifyWorker verifies mentions.
+type VerifyWorker struct {
+	river.WorkerDefaults[VerifyArgs]
+	notify NotifyFunc
+}
+
+// NewVerifyWorker creates a new VerifyWorker, which calls notify with each
+// mention it verifies.
+func NewVerifyWorker(notify NotifyFunc) *VerifyWorker {
+	return &VerifyWorker{notify: notify}
+}
+
+// Work implements the river.Worker interface.
+func (w *VerifyWorker) Work(ctx context.Context, job *river.Job[VerifyArgs]) (err error) {
+	ctx, span := telemetry.StartJob(ctx, job.Kind, job.Attempt, job.Args.Trace)
+	defer func() { telemetry.End(span, err) }()
+
+	mention := job.Args.Mention
+
+	fetchCtx, cancel := context.WithTimeout(ctx, fetchTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(fetchCtx, http.MethodGet, mention.Source, nil)
+	if err != nil {
+		return river.JobCancel(fmt.Errorf("failed to create request: %w", err)) //nolint:wrapcheck
+	}
+
+	req.Header.Set("Accept", "text/html")
+
+	resp, err := telemetry.HTTPClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to fetch source: %w", err)
+	}
+
+	defer func() {
+		if err := resp.Body.Close(); err != nil {
+			slog.ErrorContext(ctx, "failed to close response body", "error", err)
+		}
+	}()
+
+	if !(200 <= resp.StatusCode && resp.StatusCode < 300) {
+		if resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests {
+			return fmt.Errorf("error fetching source: %s", resp.Status)
+		}
+
+		return river.JobCancel(fmt.Errorf("error fetching source: %s", resp.Status)) //nolint:wrapcheck
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxSourceBytes))
+	if err != nil {
+		return fmt.Errorf("failed to read source: %w", err)
+	}
+
+	if !linksTo(string(body), mention.Target) {
+		slog.InfoContext(ctx, "webmention source does not link to target", "source", mention.Source, "target", mention.Target)
+		return nil
+	}
+
+	if err := w.notify(ctx, mention); err != nil {
+		return fmt.Errorf("failed to notify of webmention: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,51 @@
+// Package websub provides simple WebSub publisher support.
+package websub
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// DefaultHub is a public WebSub hub which accepts publish pings for any topic.
+const DefaultHub = "https://pubsubhubbub.appspot.com/"
+
+// Publish notifies a hub, using the given client, that the content at the given
+// topic URL has changed.
+//
+// SEE https://www.w3.org/TR/websub/#publishing
+func Publish(ctx context.Context, client *http.Client, hub string, topic string) error {
+	form := url.Values{}
+	form.Set("hub.mode", "publish")
+	form.Set("hub.url", topic)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, hub, strings.NewReader(form.Encode()))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to perform request: %w", err)
+	}
+
+	defer resp.Body.Close()
+
+	if !(200 <= resp.StatusCode && resp.StatusCode < 300) {
+		return fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+	}
+
+	return nil
+}
+
+// LinkHeader returns the value of a Link header advertising the hub and the
+// canonical topic URL, for discovery by subscribers.
+//
+// SEE https://www.w3.org/TR/websub/#discovery
+func LinkHeader(hub string, topic string) string {
+	return fmt.Sprintf(`<%s>; rel="hub", <%s>; rel="self"`, hub, topic)
+}
@@ -0,0 +1,1121 @@
+package www
+
+import (
+	"bytes"
+	"context"
+	"crypto/subtle"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html"
+	"mime"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	ap "github.com/jclem/jclem.me/internal/activitypub"
+	"github.com/jclem/jclem.me/internal/activitypub/identity"
+	"github.com/jclem/jclem.me/internal/analytics"
+	"github.com/jclem/jclem.me/internal/bookmarks"
+	"github.com/jclem/jclem.me/internal/database"
+	"github.com/jclem/jclem.me/internal/dispatches"
+	"github.com/jclem/jclem.me/internal/errorreport"
+	"github.com/jclem/jclem.me/internal/export"
+	"github.com/jclem/jclem.me/internal/images"
+	"github.com/jclem/jclem.me/internal/linkcheck"
+	"github.com/jclem/jclem.me/internal/mastodon"
+	"github.com/jclem/jclem.me/internal/posts"
+	"github.com/jclem/jclem.me/internal/shortlinks"
+	"github.com/jclem/jclem.me/internal/storage"
+	"github.com/jclem/jclem.me/internal/telemetry"
+	"github.com/jclem/jclem.me/internal/webfinger"
+	"github.com/jclem/jclem.me/internal/www/config"
+	"github.com/jclem/jclem.me/internal/www/view"
+)
+
+type adminRouter struct {
+	*chi.Mux
+	cfg        config.Config
+	id         *identity.Service
+	pub        *ap.Service
+	posts      *posts.Service
+	view       *view.Service
+	short      *shortlinks.Service
+	bookmarks  *bookmarks.Service
+	dispatches *dispatches.Service
+	images     *images.Service
+	links      *linkcheck.Store
+	feeds      *feedPublisher
+
+	// analytics is nil if analytics are disabled.
+	analytics *analytics.Recorder
+}
+
+func newAdminRouter(cfg config.Config, pub *pubRouter, web *webRouter, links *linkcheck.Store, recorder *analytics.Recorder) *adminRouter {
+	r := chi.NewRouter()
+	a := &adminRouter{
+		Mux:        r,
+		cfg:        cfg,
+		id:         pub.id,
+		pub:        pub.pub,
+		posts:      web.posts,
+		view:       web.view,
+		short:      web.shortLinks,
+		bookmarks:  web.bookmarks,
+		dispatches: web.dispatches,
+		images:     web.images,
+		links:      links,
+		feeds:      web.feeds,
+		analytics:  recorder,
+	}
+	r.Use(problemDomain(cfg.WebDomain))
+	r.Use(verifyAdminToken(cfg.APIKey))
+
+	// Exports and uploads take longer than other requests, and uploads are
+	// larger.
+	r.With(extendDeadlines(exportTimeout)).Get("/users/{username}/export", a.exportUser)
+	r.With(extendDeadlines(exportTimeout)).Get("/users/{username}/followers.csv", a.exportAccounts(Followers))
+	r.With(extendDeadlines(exportTimeout)).Get("/users/{username}/following.csv", a.exportAccounts(Following))
+	r.With(extendDeadlines(exportTimeout), limitBody(maxBodyBytes)).Post("/users/{username}/following", a.importFollowing)
+	r.With(extendDeadlines(uploadTimeout), limitBody(maxUploadBytes)).Post("/dispatches", a.createDispatch)
+
+	r.Group(func(r chi.Router) {
+		r.Use(limitBody(maxBodyBytes))
+		r.Post("/users", a.createUser)
+		r.Patch("/users/{username}", a.updateUser)
+		r.Delete("/users/{username}", a.deleteUser)
+		r.Post("/users/{username}/keys/rotate", a.rotateKeys)
+		r.Post("/posts", a.createPost)
+		r.Patch("/posts/{slug}", a.updatePost)
+		r.Post("/posts/{slug}/publish", a.publishPost)
+		r.Post("/short-links", a.createShortLink)
+		r.Get("/short-links/{code}", a.getShortLink)
+		r.Post("/bookmarks", a.createBookmark)
+		r.Get("/dispatches", a.listDispatches)
+		r.Post("/dispatches/uploads", a.createDispatchUpload)
+		r.Post("/dispatches/uploads/{id}/confirm", a.confirmDispatchUpload)
+		r.Patch("/dispatches/{id}", a.updateDispatch)
+		r.Delete("/dispatches/{id}", a.deleteDispatch)
+		r.Get("/links", a.getLinkReport)
+		r.Get("/analytics", a.getAnalytics)
+		r.Get(eventsPath, streamEvents(a.pub.Events(), allEvents))
+	})
+
+	return a
+}
+
+type createUserResponse struct {
+	User   identity.User `json:"user"`
+	APIKey string        `json:"api_key"`
+}
+
+func (a *adminRouter) createUser(w http.ResponseWriter, r *http.Request) {
+	var input identity.NewUser
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		returnBodyError(r.Context(), w, err, "invalid request body")
+		return
+	}
+
+	user, apiKey, err := a.id.CreateUser(r.Context(), input)
+	if err != nil {
+		if errors.Is(err, identity.ErrInvalidUsername) {
+			returnValidationError(r.Context(), w, "invalid user", fieldError{Field: "username", Message: "must be alphanumeric"})
+			return
+		}
+
+		if errors.Is(err, identity.ErrUserExists) {
+			returnCodeError(r.Context(), w, http.StatusConflict, "username is taken")
+			return
+		}
+
+		returnError(r.Context(), w, err, "error creating user")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+
+	writeResponse(w, r, createUserResponse{User: user, APIKey: apiKey})
+}
+
+func (a *adminRouter) updateUser(w http.ResponseWriter, r *http.Request) {
+	username := chi.URLParam(r, "username")
+
+	user, err := a.id.GetUserByUsername(r.Context(), username)
+	if err != nil {
+		if errors.Is(err, identity.ErrUserNotFound) {
+			returnNotFound(r.Context(), w, fmt.Sprintf("user not found: %q", username))
+			return
+		}
+
+		returnError(r.Context(), w, err, "error getting user")
+		return
+	}
+
+	var update identity.UserUpdate
+	if err := json.NewDecoder(r.Body).Decode(&update); err != nil {
+		returnBodyError(r.Context(), w, err, "invalid request body")
+		return
+	}
+
+	user, err = a.id.UpdateUser(r.Context(), user.ID, update)
+	if err != nil {
+		returnError(r.Context(), w, err, "error updating user")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	writeResponse(w, r, user)
+}
+
+// deleteUser deletes a user. Their actor and inbox are then gone, and their
+// data is kept.
+func (a *adminRouter) deleteUser(w http.ResponseWriter, r *http.Request) {
+	username := chi.URLParam(r, "username")
+
+	user, err := a.id.GetUserByUsername(r.Context(), username)
+	if err != nil {
+		if errors.Is(err, identity.ErrUserNotFound) {
+			returnNotFound(r.Context(), w, fmt.Sprintf("user not found: %q", username))
+			return
+		}
+
+		returnError(r.Context(), w, err, "error getting user")
+		return
+	}
+
+	if err := a.id.DeleteUser(r.Context(), user.ID); err != nil {
+		returnError(r.Context(), w, err, "error deleting user")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (a *adminRouter) rotateKeys(w http.ResponseWriter, r *http.Request) {
+	username := chi.URLParam(r, "username")
+
+	user, err := a.id.GetUserByUsername(r.Context(), username)
+	if err != nil {
+		if errors.Is(err, identity.ErrUserNotFound) {
+			returnNotFound(r.Context(), w, fmt.Sprintf("user not found: %q", username))
+			return
+		}
+
+		returnError(r.Context(), w, err, "error getting user")
+		return
+	}
+
+	pubKey, err := a.id.RotateKeys(r.Context(), user.ID, identity.DefaultKeyGracePeriod)
+	if err != nil {
+		returnError(r.Context(), w, err, "error rotating keys")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+
+	writeResponse(w, r, a.pub.Site().NewPublicKey(user, pubKey))
+}
+
+// exportTimeout is how long building and downloading an archive may take. It
+// replaces the server's write timeout, which is far too short for an archive.
+const exportTimeout = 10 * time.Minute
+
+// exportUser downloads an archive of a user's data.
+func (a *adminRouter) exportUser(w http.ResponseWriter, r *http.Request) {
+	username := chi.URLParam(r, "username")
+
+	user, err := a.id.GetUserByUsername(r.Context(), username)
+	if err != nil {
+		if errors.Is(err, identity.ErrUserNotFound) {
+			returnNotFound(r.Context(), w, fmt.Sprintf("user not found: %q", username))
+			return
+		}
+
+		returnError(r.Context(), w, err, "error getting user")
+		return
+	}
+
+	exporter := export.New(a.id, a.pub, a.dispatches, a.posts, a.images)
+
+	// The archive is built in a temporary file, so that a failure is reported
+	// as an error rather than as a truncated download.
+	f, err := os.CreateTemp("", "export-*.zip")
+	if err != nil {
+		returnError(r.Context(), w, err, "error creating archive")
+		return
+	}
+
+	defer os.Remove(f.Name()) //nolint:errcheck
+	defer f.Close()
+
+	if err := exporter.Write(r.Context(), f, user); err != nil {
+		returnError(r.Context(), w, err, "error writing archive")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", export.FileName(user.Username, time.Now())))
+
+	http.ServeContent(w, r, "", time.Time{}, f)
+}
+
+// exportAccounts downloads a list of a user's accounts as CSV, which Mastodon
+// imports.
+func (a *adminRouter) exportAccounts(list AccountList) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		username := chi.URLParam(r, "username")
+
+		user, err := a.id.GetUserByUsername(r.Context(), username)
+		if err != nil {
+			if errors.Is(err, identity.ErrUserNotFound) {
+				returnNotFound(r.Context(), w, fmt.Sprintf("user not found: %q", username))
+				return
+			}
+
+			returnError(r.Context(), w, err, "error getting user")
+			return
+		}
+
+		// Each account's address is looked up from its server, so the list is
+		// written to a buffer, so that a failure is reported as an error rather
+		// than as a truncated download.
+		var buf bytes.Buffer
+		if err := writeAccounts(r.Context(), &buf, a.pub, user, list); err != nil {
+			returnError(r.Context(), w, err, "error writing accounts")
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", fmt.Sprintf("%s-%s.csv", user.Username, list)))
+
+		w.Write(buf.Bytes()) //nolint:errcheck
+	}
+}
+
+// importFollowing follows each account listed in a CSV file of follows, such
+// as one Mastodon exports, which the user does not already follow.
+func (a *adminRouter) importFollowing(w http.ResponseWriter, r *http.Request) {
+	username := chi.URLParam(r, "username")
+
+	user, err := a.id.GetUserByUsername(r.Context(), username)
+	if err != nil {
+		if errors.Is(err, identity.ErrUserNotFound) {
+			returnNotFound(r.Context(), w, fmt.Sprintf("user not found: %q", username))
+			return
+		}
+
+		returnError(r.Context(), w, err, "error getting user")
+		return
+	}
+
+	result, err := mastodon.New(a.pub, nil, webfinger.ResolveActor).ImportFollowing(r.Context(), user, r.Body)
+	if err != nil {
+		if errors.As(err, new(*csv.ParseError)) {
+			returnBadRequest(r.Context(), w, err.Error())
+			return
+		}
+
+		returnError(r.Context(), w, err, "error importing following")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	writeResponse(w, r, result)
+}
+
+func (a *adminRouter) createPost(w http.ResponseWriter, r *http.Request) {
+	var input posts.NewPost
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		returnBodyError(r.Context(), w, err, "invalid request body")
+		return
+	}
+
+	post, err := a.posts.Create(r.Context(), input)
+	if err != nil {
+		returnPostError(w, r, err, "error creating post")
+		return
+	}
+
+	if post.Published {
+		a.feeds.publish(rssPath)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+
+	writeResponse(w, r, post)
+}
+
+func (a *adminRouter) updatePost(w http.ResponseWriter, r *http.Request) {
+	var update posts.PostUpdate
+	if err := json.NewDecoder(r.Body).Decode(&update); err != nil {
+		returnBodyError(r.Context(), w, err, "invalid request body")
+		return
+	}
+
+	post, err := a.posts.Update(r.Context(), chi.URLParam(r, "slug"), update)
+	if err != nil {
+		returnPostError(w, r, err, "error updating post")
+		return
+	}
+
+	if post.Published {
+		a.feeds.publish(rssPath)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	writeResponse(w, r, post)
+}
+
+func (a *adminRouter) publishPost(w http.ResponseWriter, r *http.Request) {
+	post, err := a.posts.Publish(r.Context(), chi.URLParam(r, "slug"))
+	if err != nil {
+		returnPostError(w, r, err, "error publishing post")
+		return
+	}
+
+	a.feeds.publish(rssPath)
+
+	w.Header().Set("Content-Type", "application/json")
+
+	writeResponse(w, r, post)
+}
+
+// returnPostError responds to an error from the posts service.
+func returnPostError(w http.ResponseWriter, r *http.Request, err error, message string) {
+	switch {
+	case errors.Is(err, posts.ErrNoStore):
+		returnCodeError(r.Context(), w, http.StatusNotImplemented, "database posts are not enabled")
+	case errors.Is(err, posts.ErrInvalidSlug):
+		returnValidationError(r.Context(), w, "invalid post", fieldError{Field: "slug", Message: "must be lowercase alphanumeric words separated by hyphens"})
+	case errors.Is(err, posts.ErrMissingTitle):
+		returnValidationError(r.Context(), w, "invalid post", fieldError{Field: "title", Message: "must not be empty"})
+	case errors.Is(err, posts.ErrPostExists):
+		returnCodeError(r.Context(), w, http.StatusConflict, "slug is taken")
+	case errors.As(err, &posts.PostNotFoundError{}):
+		returnNotFound(r.Context(), w, err.Error())
+	default:
+		returnError(r.Context(), w, err, message)
+	}
+}
+
+type createShortLinkRequest struct {
+	// Code is the link's code. If it is empty, a code is generated.
+	Code string `json:"code"`
+
+	// URL is the URL to link to. Alternatively, Post is the slug of a post to
+	// link to.
+	URL  string `json:"url"`
+	Post string `json:"post"`
+}
+
+type shortLinkResponse struct {
+	shortlinks.Link
+	ShortURL string `json:"short_url"`
+}
+
+func (a *adminRouter) createShortLink(w http.ResponseWriter, r *http.Request) {
+	if a.short == nil {
+		returnCodeError(r.Context(), w, http.StatusNotImplemented, "short links require a database")
+		return
+	}
+
+	var input createShortLinkRequest
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		returnBodyError(r.Context(), w, err, "invalid request body")
+		return
+	}
+
+	if input.Post != "" {
+		post, err := a.posts.Get(input.Post)
+		if err != nil {
+			returnPostError(w, r, err, "error getting post")
+			return
+		}
+
+		input.URL = a.view.URL("/writing/" + post.Slug)
+	}
+
+	link, err := a.short.Create(r.Context(), input.Code, input.URL)
+	if err != nil {
+		switch {
+		case errors.Is(err, shortlinks.ErrInvalidURL):
+			returnValidationError(r.Context(), w, "invalid short link", fieldError{Field: "url", Message: "must be an absolute http or https URL"})
+		case errors.Is(err, shortlinks.ErrInvalidCode):
+			returnValidationError(r.Context(), w, "invalid short link", fieldError{Field: "code", Message: "must be up to 32 letters, digits, hyphens, or underscores"})
+		case errors.Is(err, shortlinks.ErrLinkExists):
+			returnCodeError(r.Context(), w, http.StatusConflict, "code is taken")
+		default:
+			returnError(r.Context(), w, err, "error creating short link")
+		}
+
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+
+	writeResponse(w, r, shortLinkResponse{Link: link, ShortURL: a.view.URL("/s/" + link.Code)})
+}
+
+func (a *adminRouter) getShortLink(w http.ResponseWriter, r *http.Request) {
+	if a.short == nil {
+		returnCodeError(r.Context(), w, http.StatusNotImplemented, "short links require a database")
+		return
+	}
+
+	link, err := a.short.Get(r.Context(), chi.URLParam(r, "code"))
+	if err != nil {
+		if errors.Is(err, shortlinks.ErrLinkNotFound) {
+			returnNotFound(r.Context(), w, err.Error())
+			return
+		}
+
+		returnError(r.Context(), w, err, "error getting short link")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	writeResponse(w, r, shortLinkResponse{Link: link, ShortURL: a.view.URL("/s/" + link.Code)})
+}
+
+type createBookmarkRequest struct {
+	bookmarks.NewBookmark
+
+	// Federate shares the bookmark with the author's followers as a note.
+	Federate bool `json:"federate"`
+}
+
+func (a *adminRouter) createBookmark(w http.ResponseWriter, r *http.Request) {
+	if a.bookmarks == nil {
+		returnCodeError(r.Context(), w, http.StatusNotImplemented, "bookmarks require a database")
+		return
+	}
+
+	var input createBookmarkRequest
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		returnBodyError(r.Context(), w, err, "invalid request body")
+		return
+	}
+
+	if input.Author == "" {
+		input.Author = a.cfg.DefaultUser
+	}
+
+	user, err := a.id.GetUserByUsername(r.Context(), input.Author)
+	if err != nil {
+		if errors.Is(err, identity.ErrUserNotFound) {
+			returnValidationError(r.Context(), w, "invalid bookmark", fieldError{Field: "author", Message: "must be an existing user"})
+			return
+		}
+
+		returnError(r.Context(), w, err, "error getting user")
+		return
+	}
+
+	bookmark, err := a.bookmarks.Create(r.Context(), input.NewBookmark)
+	if err != nil {
+		switch {
+		case errors.Is(err, bookmarks.ErrInvalidURL):
+			returnValidationError(r.Context(), w, "invalid bookmark", fieldError{Field: "url", Message: "must be an absolute http or https URL"})
+		case errors.Is(err, bookmarks.ErrMissingTitle):
+			returnValidationError(r.Context(), w, "invalid bookmark", fieldError{Field: "title", Message: "must not be empty"})
+		default:
+			returnError(r.Context(), w, err, "error creating bookmark")
+		}
+
+		return
+	}
+
+	if input.Federate {
+		content := fmt.Sprintf(`<p><a href="%s">%s</a></p>%s`,
+			html.EscapeString(bookmark.URL), html.EscapeString(bookmark.Title), bookmark.Content)
+
+		activity, err := publishNote(r.Context(), a.pub, user, content, []string{ap.PublicNS}, []string{a.pub.Site().ActorFollowers(user)})
+		if err != nil {
+			returnError(r.Context(), w, err, "error federating bookmark")
+			return
+		}
+
+		if err := a.bookmarks.SetNoteID(r.Context(), bookmark.ID, activity.Object.ID); err != nil {
+			returnError(r.Context(), w, err, "error updating bookmark")
+			return
+		}
+
+		bookmark.NoteID = activity.Object.ID
+	}
+
+	a.feeds.publish(linksRSSPath)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+
+	writeResponse(w, r, bookmark)
+}
+
+// maxDispatchesLimit is the most dispatches which may be listed at once.
+const maxDispatchesLimit = 100
+
+type listDispatchesResponse struct {
+	Dispatches []dispatches.Dispatch `json:"dispatches"`
+
+	// Next is the cursor of the next page of older dispatches, if there is
+	// one.
+	Next string `json:"next,omitempty"`
+}
+
+// listDispatches lists dispatches, filtered as the web page's are, and also by
+// "author" and "limit".
+func (a *adminRouter) listDispatches(w http.ResponseWriter, r *http.Request) {
+	opts, err := dispatchListOpts(r.URL.Query())
+	if err != nil {
+		returnBadRequest(r.Context(), w, err.Error())
+		return
+	}
+
+	if author := r.URL.Query().Get("author"); author != "" {
+		opts = append(opts, dispatches.WithAuthor(author))
+	}
+
+	limit := dispatches.DefaultLimit
+
+	if l := r.URL.Query().Get("limit"); l != "" {
+		limit, err = strconv.Atoi(l)
+		if err != nil || limit < 1 || limit > maxDispatchesLimit {
+			returnValidationError(r.Context(), w, "invalid query", fieldError{Field: "limit", Message: fmt.Sprintf("must be between 1 and %d", maxDispatchesLimit)})
+			return
+		}
+	}
+
+	list, err := a.dispatches.List(r.Context(), append(opts, dispatches.WithAnyStatus(), dispatches.WithLimit(limit+1))...)
+	if err != nil {
+		returnError(r.Context(), w, err, "error listing dispatches")
+		return
+	}
+
+	resp := listDispatchesResponse{Dispatches: list}
+
+	if len(list) > limit {
+		resp.Dispatches = list[:limit]
+		resp.Next = resp.Dispatches[limit-1].ID.String()
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	writeResponse(w, r, resp)
+}
+
+type createDispatchRequest struct {
+	dispatches.NewDispatch
+
+	// Federate shares the dispatch with the author's followers as a note.
+	Federate bool `json:"federate"`
+
+	// uploadKey is the key of the dispatch's unprocessed image, if it is
+	// pending.
+	uploadKey string
+}
+
+// createDispatch creates a dispatch from a JSON body, or from a multipart form
+// with the image to upload in its "image" field.
+func (a *adminRouter) createDispatch(w http.ResponseWriter, r *http.Request) {
+	var input createDispatchRequest
+
+	if mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mediaType == "multipart/form-data" {
+		if !a.uploadDispatchImage(w, r, &input) {
+			return
+		}
+	} else if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		returnBodyError(r.Context(), w, err, "invalid request body")
+		return
+	}
+
+	a.finishCreateDispatch(w, r, input)
+}
+
+// finishCreateDispatch creates a dispatch and federates it if requested.
+//
+// If the dispatch is pending, its image is processed by a job, which federates
+// it once it is ready, and the pending dispatch is returned with 202 Accepted.
+func (a *adminRouter) finishCreateDispatch(w http.ResponseWriter, r *http.Request, input createDispatchRequest) {
+	if input.Author == "" {
+		input.Author = a.cfg.DefaultUser
+	}
+
+	var user identity.User
+
+	if input.Federate {
+		var err error
+
+		user, err = a.id.GetUserByUsername(r.Context(), input.Author)
+		if err != nil {
+			if errors.Is(err, identity.ErrUserNotFound) {
+				returnValidationError(r.Context(), w, "invalid dispatch", fieldError{Field: "author", Message: "must be an existing user to federate"})
+				return
+			}
+
+			returnError(r.Context(), w, err, "error getting user")
+			return
+		}
+	}
+
+	dispatch, err := a.dispatches.Create(r.Context(), input.NewDispatch)
+	if err != nil {
+		returnDispatchError(w, r, err, "error creating dispatch")
+		return
+	}
+
+	if dispatch.Status == dispatches.StatusPending {
+		if err := a.pub.InsertJob(r.Context(), dispatches.ProcessImageArgs{
+			DispatchID: dispatch.ID,
+			UploadKey:  input.uploadKey,
+			Federate:   input.Federate,
+			Trace:      telemetry.Inject(r.Context()),
+		}); err != nil {
+			if serr := a.dispatches.SetStatus(r.Context(), dispatch.ID, dispatches.StatusFailed); serr != nil {
+				err = errors.Join(err, serr)
+			}
+
+			returnError(r.Context(), w, err, "error enqueueing image processing")
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusAccepted)
+
+		writeResponse(w, r, dispatch)
+		return
+	}
+
+	if input.Federate {
+		dispatch, err = federateDispatch(r.Context(), a.pub, a.dispatches, user, dispatch)
+		if err != nil {
+			returnError(r.Context(), w, err, "error federating dispatch")
+			return
+		}
+	}
+
+	a.feeds.publish(dispatchesRSSPath)
+	publishDispatchCreated(r.Context(), a.pub.Events(), dispatch)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+
+	writeResponse(w, r, dispatch)
+}
+
+// federateDispatch shares a dispatch with the user's followers as a note, and
+// records the note on the dispatch.
+func federateDispatch(ctx context.Context, pub *ap.Service, ds *dispatches.Service, user identity.User, dispatch dispatches.Dispatch) (dispatches.Dispatch, error) {
+	activity, err := publishNote(ctx, pub, user, dispatchNoteContent(dispatch), []string{ap.PublicNS}, []string{pub.Site().ActorFollowers(user)})
+	if err != nil {
+		return dispatches.Dispatch{}, err
+	}
+
+	if err := ds.SetNoteID(ctx, dispatch.ID, activity.Object.ID); err != nil {
+		return dispatches.Dispatch{}, fmt.Errorf("error updating dispatch: %w", err)
+	}
+
+	dispatch.NoteID = activity.Object.ID
+
+	return dispatch, nil
+}
+
+// dispatchNoteContent returns the content of the note which shares a
+// dispatch: its text, followed by a link to its image, link, or place.
+func dispatchNoteContent(dispatch dispatches.Dispatch) string {
+	content := string(dispatch.Content)
+
+	switch {
+	case dispatch.HasImage():
+		content += fmt.Sprintf(`<p><a href="%s">%s</a></p>`,
+			html.EscapeString(dispatch.URL), html.EscapeString(dispatch.Alt))
+	case dispatch.Link != nil:
+		content += fmt.Sprintf(`<p><a href="%s">%s</a></p>`,
+			html.EscapeString(dispatch.Link.URL), html.EscapeString(dispatch.Link.Label()))
+	case dispatch.Checkin != nil:
+		content += fmt.Sprintf(`<p>At <a href="%s">%s</a></p>`,
+			html.EscapeString(dispatch.Checkin.MapURL()), html.EscapeString(dispatch.Checkin.Name))
+	}
+
+	return content
+}
+
+func (a *adminRouter) updateDispatch(w http.ResponseWriter, r *http.Request) {
+	id, err := database.ParseULID(chi.URLParam(r, "id"))
+	if err != nil {
+		returnNotFound(r.Context(), w, "dispatch not found")
+		return
+	}
+
+	var update dispatches.DispatchUpdate
+	if err := json.NewDecoder(r.Body).Decode(&update); err != nil {
+		returnBodyError(r.Context(), w, err, "invalid request body")
+		return
+	}
+
+	dispatch, err := a.dispatches.Update(r.Context(), id, update)
+	if err != nil {
+		returnDispatchError(w, r, err, "error updating dispatch")
+		return
+	}
+
+	if dispatch.NoteID != "" {
+		if err := a.federateDispatchChange(r, dispatch, false); err != nil {
+			returnError(r.Context(), w, err, "error federating dispatch update")
+			return
+		}
+	}
+
+	a.feeds.publish(dispatchesRSSPath)
+
+	w.Header().Set("Content-Type", "application/json")
+
+	writeResponse(w, r, dispatch)
+}
+
+// deleteDispatch deletes a dispatch and its uploaded image.
+func (a *adminRouter) deleteDispatch(w http.ResponseWriter, r *http.Request) {
+	id, err := database.ParseULID(chi.URLParam(r, "id"))
+	if err != nil {
+		returnNotFound(r.Context(), w, "dispatch not found")
+		return
+	}
+
+	dispatch, err := a.dispatches.Get(r.Context(), id)
+	if err != nil {
+		returnDispatchError(w, r, err, "error getting dispatch")
+		return
+	}
+
+	// Only uploaded images have variants, and only they are removed from
+	// storage. Linked images are left alone.
+	if dispatch.Image != nil {
+		if err := a.images.Remove(r.Context(), dispatch.URL, *dispatch.Image); err != nil {
+			returnError(r.Context(), w, err, "error removing dispatch image")
+			return
+		}
+	}
+
+	if _, err := a.dispatches.Delete(r.Context(), id); err != nil {
+		returnDispatchError(w, r, err, "error deleting dispatch")
+		return
+	}
+
+	if dispatch.NoteID != "" {
+		if err := a.federateDispatchChange(r, dispatch, true); err != nil {
+			returnError(r.Context(), w, err, "error federating dispatch deletion")
+			return
+		}
+	}
+
+	a.feeds.publish(dispatchesRSSPath)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// federateDispatchChange publishes an Update, or if deleted is true, a Delete
+// of the note which shared a dispatch. It does nothing if the note no longer
+// exists.
+func (a *adminRouter) federateDispatchChange(r *http.Request, dispatch dispatches.Dispatch, deleted bool) error {
+	user, err := a.id.GetUserByUsername(r.Context(), dispatch.Author)
+	if err != nil {
+		return fmt.Errorf("error getting user: %w", err)
+	}
+
+	note, err := a.pub.GetNoteByObjectID(r.Context(), user.ID, dispatch.NoteID)
+	if err != nil {
+		if errors.Is(err, ap.ErrNoteNotFound) {
+			return nil
+		}
+
+		return fmt.Errorf("error getting note: %w", err)
+	}
+
+	if deleted {
+		return publishNoteDelete(r.Context(), a.pub, user, note)
+	}
+
+	return publishNoteUpdate(r.Context(), a.pub, user, note, dispatchNoteContent(dispatch))
+}
+
+// returnDispatchError responds to an error from the dispatches service.
+func returnDispatchError(w http.ResponseWriter, r *http.Request, err error, message string) {
+	switch {
+	case errors.Is(err, dispatches.ErrDispatchNotFound):
+		returnNotFound(r.Context(), w, "dispatch not found")
+	case errors.Is(err, dispatches.ErrInvalidType):
+		returnValidationError(r.Context(), w, "invalid dispatch", fieldError{Field: "type", Message: "must be image, text, link, or checkin"})
+	case errors.Is(err, dispatches.ErrUnexpectedData):
+		returnValidationError(r.Context(), w, "invalid dispatch", fieldError{Field: "type", Message: "must match the dispatch's url, link, or checkin"})
+	case errors.Is(err, dispatches.ErrEmptyDispatch):
+		returnValidationError(r.Context(), w, "invalid dispatch", fieldError{Field: "body", Message: "must not be empty for a text dispatch"})
+	case errors.Is(err, dispatches.ErrInvalidURL):
+		returnValidationError(r.Context(), w, "invalid dispatch", fieldError{Field: "url", Message: "must be an absolute http or https URL"})
+	case errors.Is(err, dispatches.ErrMissingAlt):
+		returnValidationError(r.Context(), w, "invalid dispatch", fieldError{Field: "alt", Message: "must not be empty if there is an image"})
+	case errors.Is(err, dispatches.ErrInvalidLink):
+		returnValidationError(r.Context(), w, "invalid dispatch", fieldError{Field: "link", Message: "must have an absolute http or https url, and image if any"})
+	case errors.Is(err, dispatches.ErrMissingPlace):
+		returnValidationError(r.Context(), w, "invalid dispatch", fieldError{Field: "checkin.name", Message: "must not be empty"})
+	case errors.Is(err, dispatches.ErrInvalidCoordinates):
+		returnValidationError(r.Context(), w, "invalid dispatch", fieldError{Field: "checkin", Message: "must have a latitude within ±90 and a longitude within ±180"})
+	default:
+		returnError(r.Context(), w, err, message)
+	}
+}
+
+// maxUploadMemory is the most of a multipart upload which is held in memory
+// rather than in temporary files.
+const maxUploadMemory = 8 << 20
+
+// maxUploadBytes is the largest multipart upload which is read: the largest
+// image, and room for the form's other fields.
+const maxUploadBytes = images.MaxSourceBytes + 1<<20
+
+// uploadTimeout is how long reading a multipart upload, and responding to it,
+// may take. It replaces the server's read and write timeouts, which are far too
+// short for an image.
+const uploadTimeout = 2 * time.Minute
+
+// uploadDispatchImage reads a dispatch from a multipart form, staging its image
+// to be processed by a job. The body is limited to maxUploadBytes. It responds
+// with an error and returns false if it fails.
+func (a *adminRouter) uploadDispatchImage(w http.ResponseWriter, r *http.Request, input *createDispatchRequest) bool {
+	if err := r.ParseMultipartForm(maxUploadMemory); err != nil {
+		if errors.As(err, new(*http.MaxBytesError)) {
+			returnValidationError(r.Context(), w, "invalid dispatch", fieldError{Field: "image", Message: "must not be larger than 32 MB"})
+			return false
+		}
+
+		returnBadRequest(r.Context(), w, "invalid multipart form")
+		return false
+	}
+
+	input.Author = r.FormValue("author")
+	input.Alt = r.FormValue("alt")
+	input.Body = r.FormValue("body")
+
+	if federate := r.FormValue("federate"); federate != "" {
+		v, err := strconv.ParseBool(federate)
+		if err != nil {
+			returnValidationError(r.Context(), w, "invalid dispatch", fieldError{Field: "federate", Message: "must be a boolean"})
+			return false
+		}
+
+		input.Federate = v
+	}
+
+	// Check the alternative text before uploading, so that an invalid dispatch
+	// does not leave an orphaned image in storage.
+	if strings.TrimSpace(input.Alt) == "" {
+		returnValidationError(r.Context(), w, "invalid dispatch", fieldError{Field: "alt", Message: "must not be empty if there is an image"})
+		return false
+	}
+
+	file, _, err := r.FormFile("image")
+	if err != nil {
+		if errors.Is(err, http.ErrMissingFile) {
+			returnValidationError(r.Context(), w, "invalid dispatch", fieldError{Field: "image", Message: "must be present in a multipart form"})
+			return false
+		}
+
+		returnBadRequest(r.Context(), w, "invalid image")
+		return false
+	}
+
+	defer file.Close()
+
+	key := dispatchUploadKey(database.NewULID())
+
+	if err := a.images.Stage(r.Context(), key, file); err != nil {
+		returnImageError(w, r, err, "error uploading image")
+		return false
+	}
+
+	input.Type = dispatches.TypeImage
+	input.Pending = true
+	input.uploadKey = key
+
+	return true
+}
+
+// returnImageError responds to an error from uploading a dispatch's image.
+func returnImageError(w http.ResponseWriter, r *http.Request, err error, message string) {
+	switch {
+	case errors.Is(err, images.ErrNoProcessor):
+		returnCodeError(r.Context(), w, http.StatusNotImplemented, "image uploads are not configured")
+	case errors.Is(err, images.ErrUploadNotFound):
+		returnNotFound(r.Context(), w, "upload not found")
+	case errors.Is(err, images.ErrInvalidImage), errors.Is(err, images.ErrUnsupportedType):
+		returnValidationError(r.Context(), w, "invalid dispatch", fieldError{Field: "image", Message: "must be a GIF, JPEG, or PNG image"})
+	case errors.Is(err, images.ErrTooLarge):
+		returnValidationError(r.Context(), w, "invalid dispatch", fieldError{Field: "image", Message: "must not be larger than 32 MB"})
+	default:
+		returnError(r.Context(), w, err, message)
+	}
+}
+
+// dispatchUploadKey is the key under which the image of a dispatch is uploaded
+// directly to storage, before it is confirmed.
+func dispatchUploadKey(id database.ULID) string {
+	return "uploads/dispatches/" + id.String()
+}
+
+type createDispatchUploadRequest struct {
+	ContentType string `json:"contentType"`
+	Size        int64  `json:"size"`
+}
+
+type createDispatchUploadResponse struct {
+	storage.PresignedPut
+
+	// ID identifies the upload when confirming it.
+	ID string `json:"id"`
+}
+
+// createDispatchUpload presigns a request with which a client uploads a
+// dispatch's image straight to storage, rather than through this server. Once
+// the image is uploaded, the dispatch is created by confirming the upload.
+func (a *adminRouter) createDispatchUpload(w http.ResponseWriter, r *http.Request) {
+	var input createDispatchUploadRequest
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		returnBodyError(r.Context(), w, err, "invalid request body")
+		return
+	}
+
+	id := database.NewULID()
+
+	put, err := a.images.PresignUpload(r.Context(), dispatchUploadKey(id), input.ContentType, input.Size)
+	if err != nil {
+		switch {
+		case errors.Is(err, images.ErrUnsupportedType):
+			returnValidationError(r.Context(), w, "invalid upload", fieldError{Field: "contentType", Message: "must be image/gif, image/jpeg, or image/png"})
+		case errors.Is(err, images.ErrTooLarge):
+			returnValidationError(r.Context(), w, "invalid upload", fieldError{Field: "size", Message: "must be between 1 byte and 32 MB"})
+		default:
+			returnImageError(w, r, err, "error presigning upload")
+		}
+
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+
+	writeResponse(w, r, createDispatchUploadResponse{PresignedPut: put, ID: id.String()})
+}
+
+// confirmDispatchUpload creates a pending dispatch from a JSON body with the
+// image uploaded directly to storage with the given upload ID. The image is
+// processed by a job, as an image uploaded through this server is.
+func (a *adminRouter) confirmDispatchUpload(w http.ResponseWriter, r *http.Request) {
+	id, err := database.ParseULID(chi.URLParam(r, "id"))
+	if err != nil {
+		returnNotFound(r.Context(), w, "upload not found")
+		return
+	}
+
+	var input createDispatchRequest
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		returnBodyError(r.Context(), w, err, "invalid request body")
+		return
+	}
+
+	input.Type = dispatches.TypeImage
+	input.URL = ""
+	input.Pending = true
+	input.uploadKey = dispatchUploadKey(id)
+
+	a.finishCreateDispatch(w, r, input)
+}
+
+// getLinkReport returns the report of the most recent link check.
+func (a *adminRouter) getLinkReport(w http.ResponseWriter, r *http.Request) {
+	if a.links == nil {
+		returnCodeError(r.Context(), w, http.StatusNotImplemented, "link reports require a database")
+		return
+	}
+
+	report, err := a.links.Latest(r.Context())
+	if err != nil {
+		if errors.Is(err, linkcheck.ErrNoReport) {
+			returnNotFound(r.Context(), w, "links have not been checked yet")
+			return
+		}
+
+		returnError(r.Context(), w, err, "error getting link report")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	writeResponse(w, r, report)
+}
+
+// defaultAnalyticsDays is the number of days of views summarized if the
+// request does not specify a number.
+const defaultAnalyticsDays = 30
+
+// getAnalytics summarizes the page views recorded in the last "days" days.
+func (a *adminRouter) getAnalytics(w http.ResponseWriter, r *http.Request) {
+	if a.analytics == nil {
+		returnCodeError(r.Context(), w, http.StatusNotImplemented, "analytics are not enabled")
+		return
+	}
+
+	days := defaultAnalyticsDays
+
+	if param := r.URL.Query().Get("days"); param != "" {
+		n, err := strconv.Atoi(param)
+		if err != nil || n < 1 {
+			returnValidationError(r.Context(), w, "invalid query", fieldError{Field: "days", Message: "must be a positive integer"})
+			return
+		}
+
+		days = n
+	}
+
+	summary, err := a.analytics.Summarize(r.Context(), time.Now().AddDate(0, 0, 1-days))
+	if err != nil {
+		returnError(r.Context(), w, err, "error summarizing page views")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	writeResponse(w, r, summary)
+}
+
+// verifyAdminToken requires that the request bear the given API key.
+//
+// If the API key is empty, all admin requests are rejected.
+func verifyAdminToken(apiKey string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			parts := bearerTokenRegex.FindStringSubmatch(r.Header.Get("Authorization"))
+			if len(parts) != 2 {
+				returnUnauthorized(r.Context(), w, "invalid authorization header")
+				return
+			}
+
+			if apiKey == "" || subtle.ConstantTimeCompare([]byte(apiKey), []byte(parts[1])) != 1 {
+				returnUnauthorized(r.Context(), w, "invalid authorization header")
+				return
+			}
+
+			errorreport.SetTag(r.Context(), "auth", "admin")
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
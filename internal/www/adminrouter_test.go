@@ -0,0 +1,87 @@
+package www
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/jclem/jclem.me/internal/dispatches"
+)
+
+func newTestAdmin(t *testing.T) (*adminRouter, testPub) {
+	t.Helper()
+
+	p := newTestPub(t)
+	web := &webRouter{cfg: testConfig, dispatches: dispatches.NewWithStore(dispatches.NewMemoryStore())}
+
+	return newAdminRouter(testConfig, p.pubRouter, web, nil, nil), p
+}
+
+func TestAdminRequiresToken(t *testing.T) {
+	a, _ := newTestAdmin(t)
+
+	for _, token := range []string{"", "wrong-key"} {
+		if w := serve(a, http.MethodGet, "/dispatches", token, ""); w.Code != http.StatusUnauthorized {
+			t.Errorf("expected status 401 for token %q, got %d", token, w.Code)
+		}
+	}
+}
+
+func TestCreateUser(t *testing.T) {
+	a, _ := newTestAdmin(t)
+
+	w := serve(a, http.MethodPost, "/users", "admin-key", `{"username":"bob"}`)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("expected status 201, got %d: %s", w.Code, w.Body)
+	}
+
+	if resp := decode[createUserResponse](t, w); resp.User.Username != "bob" || resp.APIKey == "" {
+		t.Errorf("unexpected response: %+v", resp)
+	}
+
+	for body, status := range map[string]int{
+		`{"username":"bob"}`:     http.StatusConflict,
+		`{"username":"not ok!"}`: http.StatusUnprocessableEntity,
+	} {
+		if w := serve(a, http.MethodPost, "/users", "admin-key", body); w.Code != status {
+			t.Errorf("%s: expected status %d, got %d", body, status, w.Code)
+		}
+	}
+}
+
+func TestCreateDispatch(t *testing.T) {
+	a, p := newTestAdmin(t)
+
+	w := serve(a, http.MethodPost, "/dispatches", "admin-key", `{"body":"Hello, *world*","federate":true}`)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("expected status 201, got %d: %s", w.Code, w.Body)
+	}
+
+	created := decode[dispatches.Dispatch](t, w)
+
+	if created.Author != "alice" || created.Type != dispatches.TypeText {
+		t.Errorf("unexpected dispatch: %+v", created)
+	}
+
+	if created.NoteID == "" {
+		t.Fatal("expected the dispatch to be federated")
+	}
+
+	note, err := p.pub.GetNoteByObjectID(context.Background(), p.user.ID, created.NoteID)
+	if err != nil {
+		t.Fatalf("error getting note: %v", err)
+	}
+
+	if note.Content != string(created.Content) {
+		t.Errorf("expected note content %q, got %q", created.Content, note.Content)
+	}
+
+	if w := serve(a, http.MethodPost, "/dispatches", "admin-key", `{"body":""}`); w.Code != http.StatusUnprocessableEntity {
+		t.Errorf("expected status 422 for an empty dispatch, got %d: %s", w.Code, w.Body)
+	}
+
+	list := decode[listDispatchesResponse](t, serve(a, http.MethodGet, "/dispatches", "admin-key", ""))
+	if len(list.Dispatches) != 1 || list.Dispatches[0].ID != created.ID || list.Dispatches[0].NoteID != created.NoteID {
+		t.Errorf("unexpected dispatches: %+v", list.Dispatches)
+	}
+}
@@ -0,0 +1,142 @@
+package www
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/jclem/jclem.me/internal/www/config"
+)
+
+// A cachePolicy describes how long responses for a class of routes may be
+// cached.
+type cachePolicy struct {
+	// maxAge is how long browsers may cache a response.
+	maxAge time.Duration
+
+	// sharedMaxAge is how long shared caches, such as CDNs, may cache a
+	// response. If it is zero, shared caches use maxAge.
+	sharedMaxAge time.Duration
+
+	// immutable indicates that a response will never change, so it need not
+	// be revalidated while it is fresh.
+	immutable bool
+}
+
+//nolint:gochecknoglobals
+var (
+	// assetCachePolicy is for fingerprinted assets, whose URLs change
+	// whenever their content does.
+	assetCachePolicy = cachePolicy{maxAge: 365 * 24 * time.Hour, immutable: true}
+
+	// staticCachePolicy is for public files which are not fingerprinted.
+	staticCachePolicy = cachePolicy{maxAge: time.Hour}
+
+	// htmlCachePolicy is for rendered pages, which change on deploy.
+	htmlCachePolicy = cachePolicy{maxAge: 5 * time.Minute}
+
+	// feedCachePolicy is for feeds, which feed readers poll frequently. Shared
+	// caches may hold them longer, since publishing is announced to WebSub.
+	feedCachePolicy = cachePolicy{maxAge: 5 * time.Minute, sharedMaxAge: time.Hour}
+
+	// activityPubCachePolicy is for ActivityPub objects and collections,
+	// which change whenever a user posts or is followed. Shared caches may hold
+	// them a little longer, since remote servers fetch them constantly.
+	activityPubCachePolicy = cachePolicy{maxAge: time.Minute, sharedMaxAge: 2 * time.Minute}
+)
+
+func (p cachePolicy) String() string {
+	directives := []string{"public", fmt.Sprintf("max-age=%d", int(p.maxAge.Seconds()))}
+
+	if p.sharedMaxAge != 0 {
+		directives = append(directives, fmt.Sprintf("s-maxage=%d", int(p.sharedMaxAge.Seconds())))
+	}
+
+	if p.immutable {
+		directives = append(directives, "immutable")
+	}
+
+	return strings.Join(directives, ", ")
+}
+
+// cacheControl sets the Cache-Control header of GET and HEAD responses
+// according to the given policy.
+//
+// In development, responses are always revalidated so that changes are visible
+// immediately.
+func cacheControl(cfg config.Config, policy cachePolicy) func(http.Handler) http.Handler {
+	value := cacheControlValue(cfg, policy.String())
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method == http.MethodGet || r.Method == http.MethodHead {
+				w.Header().Set("Cache-Control", value)
+			}
+
+			next.ServeHTTP(&uncachedErrorWriter{ResponseWriter: w}, r)
+		})
+	}
+}
+
+// fingerprintRegex matches the content hash inserted into asset filenames by
+// the public package's manifest.
+var fingerprintRegex = regexp.MustCompile(`\.[0-9a-f]{64}\.[a-z]+$`)
+
+// assetCacheControl sets the Cache-Control header of public files, treating
+// fingerprinted assets as immutable.
+func assetCacheControl(cfg config.Config) func(http.Handler) http.Handler {
+	asset := cacheControlValue(cfg, assetCachePolicy.String())
+	static := cacheControlValue(cfg, staticCachePolicy.String())
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if fingerprintRegex.MatchString(r.URL.Path) {
+				w.Header().Set("Cache-Control", asset)
+			} else {
+				w.Header().Set("Cache-Control", static)
+			}
+
+			next.ServeHTTP(&uncachedErrorWriter{ResponseWriter: w}, r)
+		})
+	}
+}
+
+// An uncachedErrorWriter replaces the Cache-Control header of error responses
+// with no-store, so that errors, such as a 404 for a page which is about to
+// be published, are not cached under the route's policy.
+type uncachedErrorWriter struct {
+	http.ResponseWriter
+	wroteHeader bool
+}
+
+func (w *uncachedErrorWriter) WriteHeader(code int) {
+	if !w.wroteHeader && code >= http.StatusBadRequest {
+		w.Header().Set("Cache-Control", "no-store")
+	}
+
+	w.wroteHeader = true
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *uncachedErrorWriter) Write(b []byte) (int, error) {
+	w.wroteHeader = true
+
+	return w.ResponseWriter.Write(b) //nolint:wrapcheck
+}
+
+// Unwrap returns the underlying writer, for http.ResponseController.
+func (w *uncachedErrorWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// cacheControlValue returns the Cache-Control header value, which in
+// development is always no-cache.
+func cacheControlValue(cfg config.Config, value string) string {
+	if cfg.IsDev() {
+		return "no-cache"
+	}
+
+	return value
+}
@@ -0,0 +1,50 @@
+package www
+
+import (
+	"net/http"
+	"strings"
+)
+
+// canonicalPath permanently redirects requests for a page by a path with a
+// trailing slash or capital letters to the same path without them, so that
+// each page has one URL. Short links and assets are named case-sensitively,
+// so their paths are only trimmed.
+func canonicalPath(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		path := r.URL.Path
+
+		canonical := strings.TrimRight(path, "/")
+		if canonical == "" {
+			canonical = "/"
+		}
+
+		if !strings.HasPrefix(canonical, "/s/") && !strings.HasPrefix(canonical, "/public/") {
+			canonical = strings.ToLower(canonical)
+		}
+
+		if canonical == path {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		u := *r.URL
+		u.Path = canonical
+		u.RawPath = ""
+
+		http.Redirect(w, r, u.RequestURI(), http.StatusMovedPermanently)
+	})
+}
+
+// noIndex asks search engines not to index responses, such as those of the
+// pub domain, whose actors and notes are shown on the web domain.
+func noIndex(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Robots-Tag", "noindex")
+		next.ServeHTTP(w, r)
+	})
+}
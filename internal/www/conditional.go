@@ -0,0 +1,159 @@
+package www
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"time"
+
+	"github.com/jclem/jclem.me/internal/cache"
+	"github.com/jclem/jclem.me/internal/posts"
+)
+
+// conditionalGet buffers successful GET and HEAD responses, tags them with a
+// strong ETag derived from a hash of the body, and answers If-None-Match and
+// If-Modified-Since requests with 304 Not Modified when the content is
+// unchanged.
+//
+// Handlers may set a Last-Modified header to support If-Modified-Since.
+func conditionalGet(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		rec := &bufferedResponse{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(rec, r)
+
+		if rec.status != http.StatusOK {
+			w.WriteHeader(rec.status)
+			w.Write(rec.body.Bytes()) //nolint:errcheck
+
+			return
+		}
+
+		sum := sha256.Sum256(rec.body.Bytes())
+		w.Header().Set("ETag", `"`+hex.EncodeToString(sum[:16])+`"`)
+
+		var modtime time.Time
+		if lm := w.Header().Get("Last-Modified"); lm != "" {
+			if t, err := http.ParseTime(lm); err == nil {
+				modtime = t
+			}
+		}
+
+		// ServeContent evaluates the preconditions against the ETag and
+		// modification time and writes either the body or a 304.
+		http.ServeContent(w, r, "", modtime, bytes.NewReader(rec.body.Bytes()))
+	})
+}
+
+// A cachedResponse is a successful response held by cacheResponses.
+type cachedResponse struct {
+	header http.Header
+	body   []byte
+}
+
+// cachedHeaders are the headers set by handlers which are served with their
+// responses from the cache. Others, such as Cache-Control, are set by
+// middleware for each request.
+//
+//nolint:gochecknoglobals
+var cachedHeaders = []string{"Content-Type", "Last-Modified"}
+
+// cacheResponses serves successful GET and HEAD responses from c, if it is not
+// nil, until they expire, so that a response which remote servers fetch many
+// times a minute, such as an actor, is only read from the database once.
+// Responses are keyed by their host, URL, and Accept header. It must follow
+// conditionalGet, which tags and revalidates them.
+func cacheResponses(c *cache.Cache[string, cachedResponse]) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if c == nil {
+			return next
+		}
+
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method != http.MethodGet && r.Method != http.MethodHead {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			key := r.Host + r.URL.RequestURI() + "\n" + r.Header.Get("Accept")
+
+			if res, ok := c.Get(key); ok {
+				for name, values := range res.header {
+					w.Header()[name] = values
+				}
+
+				w.Write(res.body) //nolint:errcheck
+
+				return
+			}
+
+			rec := &bufferedResponse{ResponseWriter: w, status: http.StatusOK}
+			next.ServeHTTP(rec, r)
+
+			if rec.status == http.StatusOK {
+				header := http.Header{}
+				for _, name := range cachedHeaders {
+					if values := w.Header().Values(name); len(values) > 0 {
+						header[name] = values
+					}
+				}
+
+				c.Set(key, cachedResponse{header: header, body: rec.body.Bytes()})
+			}
+
+			w.WriteHeader(rec.status)
+			w.Write(rec.body.Bytes()) //nolint:errcheck
+		})
+	}
+}
+
+// A bufferedResponse holds a response's status and body so that they can be
+// inspected before being written.
+type bufferedResponse struct {
+	http.ResponseWriter
+	status      int
+	body        bytes.Buffer
+	wroteHeader bool
+}
+
+func (b *bufferedResponse) WriteHeader(status int) {
+	if b.wroteHeader {
+		return
+	}
+
+	b.status = status
+	b.wroteHeader = true
+}
+
+func (b *bufferedResponse) Write(p []byte) (int, error) {
+	b.wroteHeader = true
+
+	return b.body.Write(p) //nolint:wrapcheck
+}
+
+// setLastModified sets the Last-Modified header to the given time, if it is
+// not zero.
+func setLastModified(w http.ResponseWriter, t time.Time) {
+	if !t.IsZero() {
+		w.Header().Set("Last-Modified", t.UTC().Format(http.TimeFormat))
+	}
+}
+
+// lastPublished returns the publication time of the most recent post, or the
+// zero time if there are no posts.
+func lastPublished(list []posts.Post) time.Time {
+	var t time.Time
+
+	for _, post := range list {
+		if post.PublishedAt.After(t) {
+			t = post.PublishedAt
+		}
+	}
+
+	return t
+}
@@ -3,8 +3,11 @@ package config
 import (
 	"errors"
 	"fmt"
-	"os"
+	"slices"
+	"strings"
+	"time"
 
+	"github.com/jclem/jclem.me/internal/websub"
 	"github.com/spf13/viper"
 )
 
@@ -15,42 +18,191 @@ const (
 	Production  AppEnv = "production"
 )
 
+// A RunMode selects what a process does, so that processes which serve
+// requests and processes which work jobs can be scaled independently.
+type RunMode string
+
+const (
+	// RunAll serves requests and works jobs.
+	RunAll RunMode = "all"
+
+	// RunWeb serves requests, and only enqueues jobs.
+	RunWeb RunMode = "web"
+
+	// RunWorker works jobs without serving requests.
+	RunWorker RunMode = "worker"
+)
+
 type Config struct {
-	Port           string `mapstructure:"port"`
-	AppEnv         AppEnv `mapstructure:"app_env"`
-	DatabaseURL    string `mapstructure:"database_url"`
-	APIKey         string `mapstructure:"api_key"`
-	RunWorkers     bool   `mapstructure:"run_workers"`
-	SpacesSecret   string `mapstructure:"do_spaces_secret"`
-	SpacesKeyID    string `mapstructure:"do_spaces_key_id"`
-	SpacesEndpoint string `mapstructure:"do_spaces_endpoint"`
-	SpacesBucket   string `mapstructure:"do_spaces_bucket"`
-}
+	Port           string   `mapstructure:"port"`
+	AppEnv         AppEnv   `mapstructure:"app_env"`
+	DatabaseURL    string   `mapstructure:"database_url"`
+	APIKey         string   `mapstructure:"api_key"`
+	RunWorkers     bool     `mapstructure:"run_workers"`
+	SpacesSecret   string   `mapstructure:"do_spaces_secret"`
+	SpacesKeyID    string   `mapstructure:"do_spaces_key_id"`
+	SpacesEndpoint string   `mapstructure:"do_spaces_endpoint"`
+	SpacesBucket   string   `mapstructure:"do_spaces_bucket"`
+	WebSubHub      string   `mapstructure:"websub_hub"`
+	WebhookURL     string   `mapstructure:"webhook_url"`
+	WebhookSecret  string   `mapstructure:"webhook_secret"`
+	WebhookEvents  []string `mapstructure:"webhook_events"`
+	WebDomain      string   `mapstructure:"web_domain"`
+	PubDomain      string   `mapstructure:"pub_domain"`
+	DefaultUser    string   `mapstructure:"default_user"`
 
-var GlobalConfig Config //nolint:gochecknoglobals
+	// RunMode is what the "start" command runs. Jobs are only worked if
+	// RunWorkers is also true.
+	RunMode RunMode `mapstructure:"run_mode"`
 
-func (c Config) IsDev() bool {
-	return c.AppEnv == Development
+	// ClientURL and ClientAPIKey are the URL under which the ActivityPub API
+	// is served and a user's API key, with which commands such as "post note"
+	// call the API. If ClientURL is empty, the configured pub domain is used.
+	ClientURL    string `mapstructure:"client_url"`
+	ClientAPIKey string `mapstructure:"client_api_key"`
+
+	// DebugPort is the port on which profiling endpoints are served. If it is
+	// empty, they are not served.
+	DebugPort string `mapstructure:"debug_port"`
+
+	// SingleDomain serves ActivityPub under "/pub" on the web domain rather
+	// than on its own domain, which is useful for staging deployments.
+	SingleDomain bool `mapstructure:"single_domain"`
+
+	// SpacesPublicURL is the URL at which objects in the Space are served.
+	SpacesPublicURL string `mapstructure:"do_spaces_public_url"`
+
+	// SpacesACL and SpacesCacheControl are the canned ACL and Cache-Control
+	// header of objects uploaded to the Space. If they are empty, the storage
+	// package's defaults are used.
+	SpacesACL          string `mapstructure:"do_spaces_acl"`
+	SpacesCacheControl string `mapstructure:"do_spaces_cache_control"`
+
+	// The database connection pool is shared by every service and the job
+	// queue. Zero values use pgx's defaults.
+	DatabaseMaxConns          int32         `mapstructure:"database_max_conns"`
+	DatabaseMinConns          int32         `mapstructure:"database_min_conns"`
+	DatabaseHealthCheckPeriod time.Duration `mapstructure:"database_health_check_period"`
+	DatabaseMaxConnLifetime   time.Duration `mapstructure:"database_max_conn_lifetime"`
+	DatabaseMaxConnIdleTime   time.Duration `mapstructure:"database_max_conn_idle_time"`
+
+	// DatabaseStatementTimeout, if positive, is the longest a query may run,
+	// enforced by Postgres, for queries whose contexts have no deadline, such
+	// as those of commands. Queries are otherwise cancelled with their
+	// contexts.
+	DatabaseStatementTimeout time.Duration `mapstructure:"database_statement_timeout"`
+
+	// Each job queue (see the queues package) has its own number of workers,
+	// so that a burst of jobs in one queue doesn't delay jobs in another.
+	QueueInboxWorkers    int `mapstructure:"queue_inbox_workers"`
+	QueueDeliveryWorkers int `mapstructure:"queue_delivery_workers"`
+	QueueMediaWorkers    int `mapstructure:"queue_media_workers"`
+	QueuePeriodicWorkers int `mapstructure:"queue_periodic_workers"`
+
+	// JobFetchPollInterval is how often each queue is polled for new jobs, in
+	// addition to when jobs are inserted, and JobFetchCooldown is the least
+	// time between fetches. Zero values use River's defaults.
+	JobFetchPollInterval time.Duration `mapstructure:"job_fetch_poll_interval"`
+	JobFetchCooldown     time.Duration `mapstructure:"job_fetch_cooldown"`
+
+	// When at least AlertDeliveryMinimum activities are delivered to a host
+	// in a minute and at least AlertDeliveryFailureRate of them fail, a
+	// "delivery.host_failing" webhook is emitted. A zero rate disables it.
+	AlertDeliveryFailureRate float64 `mapstructure:"alert_delivery_failure_rate"`
+	AlertDeliveryMinimum     int     `mapstructure:"alert_delivery_minimum"`
+
+	// DeletedRetention is how long deleted notes and activities are kept,
+	// hidden, before they are purged.
+	DeletedRetention time.Duration `mapstructure:"deleted_retention"`
+
+	// AutoMigrate applies pending database migrations when the server starts.
+	// Otherwise, they are applied with the "migrate up" command.
+	AutoMigrate bool `mapstructure:"auto_migrate"`
+
+	// DatabasePosts serves posts written through the authoring API in
+	// addition to embedded posts.
+	DatabasePosts bool `mapstructure:"database_posts"`
+
+	// ContentDir, in development, is a directory containing the "posts" and
+	// "pages" directories, such as "internal". Content is read from it rather
+	// than from the binary, and is reloaded whenever it changes.
+	ContentDir string `mapstructure:"content_dir"`
+
+	// TemplateDir, in development, is the directory containing the HTML and
+	// XML templates, such as "internal/www/view/templates". Templates are read
+	// from it rather than from the binary, and are reloaded whenever they
+	// change. Errors are shown on the page rather than as an error page.
+	TemplateDir string `mapstructure:"template_dir"`
+
+	// AssetDir, in development, is the directory containing the built
+	// stylesheets and scripts, such as "internal/www/public". Assets are read
+	// from it rather than from the binary, and are fingerprinted again
+	// whenever they are rebuilt.
+	AssetDir string `mapstructure:"asset_dir"`
+
+	// Analytics records page views. See the analytics package for what is
+	// recorded.
+	Analytics bool `mapstructure:"analytics"`
+
+	// RobotsDisallowAI disallows AI training crawlers in robots.txt.
+	RobotsDisallowAI bool `mapstructure:"robots_disallow_ai"`
+
+	// TracingEnabled enables exporting traces over OTLP, configured by the
+	// standard OTEL_EXPORTER_OTLP_* environment variables.
+	TracingEnabled bool `mapstructure:"tracing_enabled"`
+
+	// LogRequestBodies logs the bodies of requests to the pub domain, such as
+	// activities delivered to inboxes, to debug federation.
+	LogRequestBodies bool `mapstructure:"log_request_bodies"`
+
+	// LogCrawlerSampleRate is the share of crawlers' requests which are
+	// logged. Those which fail with a server error are always logged.
+	LogCrawlerSampleRate float64 `mapstructure:"log_crawler_sample_rate"`
+
+	// ErrorReportingDSN is the DSN of a Sentry-compatible tracker to which
+	// unexpected errors and panics are reported. If it is empty, they are
+	// only logged.
+	ErrorReportingDSN string `mapstructure:"error_reporting_dsn"`
+
+	// Rate limits are in requests per minute. Zero disables a limit.
+	// RateLimitInboxActor limits the activities delivered to inboxes from each
+	// actor, rather than from each IP address.
+	RateLimitInbox      int `mapstructure:"rate_limit_inbox"`
+	RateLimitInboxActor int `mapstructure:"rate_limit_inbox_actor"`
+	RateLimitOutbox     int `mapstructure:"rate_limit_outbox"`
+	RateLimitWebfinger  int `mapstructure:"rate_limit_webfinger"`
+
+	// PubCacheTTL is how long actors, objects, and collections served from the
+	// pub domain are cached in memory. Zero disables the cache.
+	PubCacheTTL time.Duration `mapstructure:"pub_cache_ttl"`
+
+	// An IP address whose requests to inboxes are rejected InboxBanThreshold
+	// times within ten minutes, such as for bad signatures or rate limits, is
+	// banned from inboxes for InboxBanDuration. Zero disables bans.
+	InboxBanThreshold int           `mapstructure:"inbox_ban_threshold"`
+	InboxBanDuration  time.Duration `mapstructure:"inbox_ban_duration"`
 }
 
-func IsDev() bool {
-	return GlobalConfig.IsDev()
+func (c Config) IsDev() bool {
+	return c.AppEnv == Development
 }
 
 func (c Config) IsProd() bool {
 	return c.AppEnv == Production
 }
 
-func IsProd() bool {
-	return GlobalConfig.IsProd()
+// ServesHTTP reports whether the process serves requests.
+func (c Config) ServesHTTP() bool {
+	return c.RunMode != RunWorker
 }
 
-func (c Config) URLUseHTTPS() bool {
-	return c.IsProd()
+// WorksJobs reports whether the process works jobs.
+func (c Config) WorksJobs() bool {
+	return c.RunWorkers && c.RunMode != RunWeb
 }
 
-func URLUseHTTPS() bool {
-	return GlobalConfig.URLUseHTTPS()
+func (c Config) URLUseHTTPS() bool {
+	return c.IsProd()
 }
 
 func (c Config) URLPort() string {
@@ -61,50 +213,176 @@ func (c Config) URLPort() string {
 	return c.Port
 }
 
-func URLPort() string {
-	return GlobalConfig.URLPort()
-}
-
 func (c Config) URLHostname() string {
 	if c.IsProd() {
-		return os.Getenv("HOSTNAME")
+		return c.WebDomain
 	}
 
 	return "localhost:" + c.URLPort()
 }
 
-func URLHostname() string {
-	return GlobalConfig.URLHostname()
-}
+// maxQueueWorkers is the most workers River allows for a queue.
+const maxQueueWorkers = 10_000
 
-func APIKey() string {
-	return GlobalConfig.APIKey
-}
+// Validate returns an error listing each setting which is missing or invalid.
+// A database and the domains are only required in production, since the
+// development server can keep data in memory and serves on localhost.
+func (c Config) Validate() error {
+	var errs []error
 
-func DatabaseURL() string {
-	return GlobalConfig.DatabaseURL
-}
+	if c.Port == "" {
+		errs = append(errs, errors.New("port is required"))
+	}
 
-func Port() string {
-	return GlobalConfig.Port
-}
+	if c.AppEnv != Development && c.AppEnv != Production {
+		errs = append(errs, fmt.Errorf("app_env must be %q or %q, got %q", Development, Production, c.AppEnv))
+	}
+
+	switch c.RunMode {
+	case RunAll, RunWeb:
+	case RunWorker:
+		if !c.RunWorkers {
+			errs = append(errs, errors.New("run_workers must be true when run_mode is \"worker\""))
+		}
+
+		if c.DatabaseURL == "" {
+			errs = append(errs, errors.New("database_url is required when run_mode is \"worker\""))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("run_mode must be %q, %q, or %q, got %q", RunAll, RunWeb, RunWorker, c.RunMode))
+	}
+
+	if c.DefaultUser == "" {
+		errs = append(errs, errors.New("default_user is required"))
+	}
+
+	if c.IsProd() {
+		for name, value := range map[string]string{
+			"database_url": c.DatabaseURL,
+			"api_key":      c.APIKey,
+			"web_domain":   c.WebDomain,
+			"pub_domain":   c.PubDomain,
+		} {
+			if value == "" {
+				errs = append(errs, fmt.Errorf("%s is required in production", name))
+			}
+		}
+	}
+
+	if c.WebhookURL != "" && c.WebhookSecret == "" {
+		errs = append(errs, errors.New("webhook_secret is required when webhook_url is set"))
+	}
 
-func RunWorkers() bool {
-	return GlobalConfig.RunWorkers
+	for name, limit := range map[string]int{
+		"rate_limit_inbox":       c.RateLimitInbox,
+		"rate_limit_inbox_actor": c.RateLimitInboxActor,
+		"rate_limit_outbox":      c.RateLimitOutbox,
+		"rate_limit_webfinger":   c.RateLimitWebfinger,
+		"inbox_ban_threshold":    c.InboxBanThreshold,
+	} {
+		if limit < 0 {
+			errs = append(errs, fmt.Errorf("%s must not be negative", name))
+		}
+	}
+
+	for name, workers := range map[string]int{
+		"queue_inbox_workers":    c.QueueInboxWorkers,
+		"queue_delivery_workers": c.QueueDeliveryWorkers,
+		"queue_media_workers":    c.QueueMediaWorkers,
+		"queue_periodic_workers": c.QueuePeriodicWorkers,
+	} {
+		if workers < 1 || workers > maxQueueWorkers {
+			errs = append(errs, fmt.Errorf("%s must be between 1 and %d", name, maxQueueWorkers))
+		}
+	}
+
+	if c.JobFetchPollInterval < 0 || c.JobFetchCooldown < 0 {
+		errs = append(errs, errors.New("job_fetch_poll_interval and job_fetch_cooldown must not be negative"))
+	} else if c.JobFetchPollInterval != 0 && c.JobFetchPollInterval < c.JobFetchCooldown {
+		errs = append(errs, errors.New("job_fetch_poll_interval must not be shorter than job_fetch_cooldown"))
+	}
+
+	if c.AlertDeliveryFailureRate < 0 || c.AlertDeliveryFailureRate > 1 {
+		errs = append(errs, errors.New("alert_delivery_failure_rate must be between 0 and 1"))
+	}
+
+	if c.LogCrawlerSampleRate < 0 || c.LogCrawlerSampleRate > 1 {
+		errs = append(errs, errors.New("log_crawler_sample_rate must be between 0 and 1"))
+	}
+
+	if c.AlertDeliveryMinimum < 0 {
+		errs = append(errs, errors.New("alert_delivery_minimum must not be negative"))
+	}
+
+	// Map iteration is unordered, so errors are sorted to be reported
+	// consistently.
+	slices.SortFunc(errs, func(a, b error) int {
+		return strings.Compare(a.Error(), b.Error())
+	})
+
+	return errors.Join(errs...)
 }
 
-// LoadConfig loads the configuration from flags and configuration files into
-// the given context.
+// LoadConfig loads the configuration from the environment, configuration
+// files, and secret files (see loadSecrets), and validates it.
 func LoadConfig() (Config, error) {
 	viper.SetDefault("port", "8080")
+	viper.SetDefault("debug_port", "")
 	viper.SetDefault("app_env", Development)
 	viper.SetDefault("database_url", "")
+	viper.SetDefault("database_max_conns", 10)
+	viper.SetDefault("database_min_conns", 2)
+	viper.SetDefault("database_health_check_period", time.Minute)
+	viper.SetDefault("database_max_conn_lifetime", time.Hour)
+	viper.SetDefault("database_max_conn_idle_time", 5*time.Minute)
 	viper.SetDefault("api_key", "")
 	viper.SetDefault("do_spaces_secret", "")
 	viper.SetDefault("do_spaces_key_id", "")
 	viper.SetDefault("do_spaces_endpoint", "")
 	viper.SetDefault("do_spaces_bucket", "")
+	viper.SetDefault("do_spaces_public_url", "https://jclem.nyc3.cdn.digitaloceanspaces.com")
+	viper.SetDefault("do_spaces_acl", "")
+	viper.SetDefault("do_spaces_cache_control", "")
 	viper.SetDefault("run_workers", true)
+	viper.SetDefault("run_mode", RunAll)
+	viper.SetDefault("websub_hub", websub.DefaultHub)
+	viper.SetDefault("web_domain", "www.jclem.me")
+	viper.SetDefault("pub_domain", "pub.jclem.me")
+	viper.SetDefault("single_domain", false)
+	viper.SetDefault("default_user", "jclem")
+	viper.SetDefault("webhook_url", "")
+	viper.SetDefault("webhook_secret", "")
+	viper.SetDefault("webhook_events", []string{})
+	viper.SetDefault("rate_limit_inbox", 120)
+	viper.SetDefault("rate_limit_inbox_actor", 60)
+	viper.SetDefault("inbox_ban_threshold", 50)
+	viper.SetDefault("inbox_ban_duration", time.Hour)
+	viper.SetDefault("pub_cache_ttl", 10*time.Second)
+	viper.SetDefault("rate_limit_outbox", 30)
+	viper.SetDefault("rate_limit_webfinger", 60)
+	viper.SetDefault("tracing_enabled", false)
+	viper.SetDefault("log_request_bodies", false)
+	viper.SetDefault("log_crawler_sample_rate", 0.1)
+	viper.SetDefault("error_reporting_dsn", "")
+	viper.SetDefault("robots_disallow_ai", false)
+	viper.SetDefault("queue_inbox_workers", 10)
+	viper.SetDefault("queue_delivery_workers", 10)
+	viper.SetDefault("queue_media_workers", 2)
+	viper.SetDefault("queue_periodic_workers", 2)
+	viper.SetDefault("job_fetch_poll_interval", time.Second)
+	viper.SetDefault("job_fetch_cooldown", 100*time.Millisecond)
+	viper.SetDefault("alert_delivery_failure_rate", 0.5)
+	viper.SetDefault("alert_delivery_minimum", 10)
+	viper.SetDefault("deleted_retention", 30*24*time.Hour)
+	viper.SetDefault("auto_migrate", false)
+	viper.SetDefault("database_posts", false)
+	viper.SetDefault("content_dir", "")
+	viper.SetDefault("template_dir", "")
+	viper.SetDefault("asset_dir", "")
+	viper.SetDefault("analytics", false)
+	viper.SetDefault("secrets_dir", "")
+	viper.SetDefault("client_url", "")
+	viper.SetDefault("client_api_key", "")
 
 	viper.AddConfigPath(".")
 	viper.SetConfigName("config")
@@ -117,9 +395,18 @@ func LoadConfig() (Config, error) {
 		}
 	}
 
-	if err := viper.Unmarshal(&GlobalConfig); err != nil {
+	if err := loadSecrets(viper.GetViper()); err != nil {
+		return Config{}, fmt.Errorf("could not load secrets: %w", err)
+	}
+
+	var c Config
+	if err := viper.Unmarshal(&c); err != nil {
 		return Config{}, fmt.Errorf("could not unmarshal config: %w", err)
 	}
 
-	return GlobalConfig, nil
+	if err := c.Validate(); err != nil {
+		return Config{}, fmt.Errorf("invalid config:\n%w", err)
+	}
+
+	return c, nil
 }
@@ -0,0 +1,76 @@
+package config
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestValidate(t *testing.T) {
+	dev := Config{
+		AppEnv:               Development,
+		Port:                 "8080",
+		RunMode:              RunAll,
+		DefaultUser:          "alice",
+		QueueInboxWorkers:    1,
+		QueueDeliveryWorkers: 1,
+		QueueMediaWorkers:    1,
+		QueuePeriodicWorkers: 1,
+	}
+
+	if err := dev.Validate(); err != nil {
+		t.Errorf("expected development config without a database to be valid, got %v", err)
+	}
+
+	prod := dev
+	prod.AppEnv = Production
+	prod.WebhookURL = "https://hooks.example.com"
+	prod.RateLimitInbox = -1
+	prod.QueueMediaWorkers = 0
+	prod.AlertDeliveryFailureRate = 2
+	prod.LogCrawlerSampleRate = -1
+	prod.JobFetchPollInterval = time.Millisecond
+	prod.JobFetchCooldown = time.Second
+
+	err := prod.Validate()
+	if err == nil {
+		t.Fatal("expected production config to be invalid")
+	}
+
+	for _, want := range []string{
+		"api_key is required in production",
+		"database_url is required in production",
+		"pub_domain is required in production",
+		"web_domain is required in production",
+		"webhook_secret is required when webhook_url is set",
+		"rate_limit_inbox must not be negative",
+		"queue_media_workers must be between 1 and 10000",
+		"alert_delivery_failure_rate must be between 0 and 1",
+		"log_crawler_sample_rate must be between 0 and 1",
+		"job_fetch_poll_interval must not be shorter than job_fetch_cooldown",
+	} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("expected error to contain %q, got %q", want, err)
+		}
+	}
+
+	staging := dev
+	staging.AppEnv = "staging"
+
+	if err := staging.Validate(); err == nil || !strings.Contains(err.Error(), "app_env") {
+		t.Errorf("expected an invalid app_env error, got %v", err)
+	}
+
+	worker := dev
+	worker.RunMode = RunWorker
+
+	err = worker.Validate()
+	for _, want := range []string{
+		"database_url is required when run_mode is \"worker\"",
+		"run_workers must be true when run_mode is \"worker\"",
+	} {
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("expected error to contain %q, got %v", want, err)
+		}
+	}
+}
@@ -0,0 +1,78 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/viper"
+)
+
+// secretKeys are the settings which may be read from files rather than from
+// the environment or the config file.
+//
+//nolint:gochecknoglobals
+var secretKeys = []string{
+	"database_url",
+	"api_key",
+	"do_spaces_key_id",
+	"do_spaces_secret",
+	"webhook_secret",
+	"client_api_key",
+}
+
+// loadSecrets sets each secret which is not set directly from a file.
+//
+// A secret is read from the file named by its "_file" setting, such as
+// DATABASE_URL_FILE, or else from the file named after it in the secrets
+// directory, such as /run/secrets/database_url. Setting a secret both directly
+// and with its "_file" setting is an error. Surrounding whitespace, such as a
+// trailing newline, is trimmed.
+func loadSecrets(v *viper.Viper) error {
+	dir := v.GetString("secrets_dir")
+
+	for _, key := range secretKeys {
+		file := v.GetString(key + "_file")
+
+		if v.GetString(key) != "" {
+			if file != "" {
+				return fmt.Errorf("only one of %s and %s_file may be set", key, key)
+			}
+
+			continue
+		}
+
+		if file == "" && dir != "" {
+			file = findSecret(dir, key)
+		}
+
+		if file == "" {
+			continue
+		}
+
+		b, err := os.ReadFile(file)
+		if err != nil {
+			return fmt.Errorf("could not read %s: %w", key, err)
+		}
+
+		v.Set(key, strings.TrimSpace(string(b)))
+	}
+
+	return nil
+}
+
+// findSecret returns the path of the file in dir named after the secret, in
+// lower or upper case, or an empty string if there is none.
+func findSecret(dir, key string) string {
+	for _, name := range []string{key, strings.ToUpper(key)} {
+		path := filepath.Join(dir, name)
+		if _, err := os.Stat(path); !errors.Is(err, fs.ErrNotExist) {
+			return path
+		}
+	}
+
+	return ""
+}
@@ -0,0 +1,54 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+func TestLoadSecrets(t *testing.T) {
+	dir := t.TempDir()
+
+	write := func(name, content string) string {
+		t.Helper()
+
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatalf("error writing secret: %v", err)
+		}
+
+		return path
+	}
+
+	v := viper.New()
+	v.Set("database_url_file", write("db", "postgres://from-file\n"))
+	v.Set("webhook_secret", "direct")
+	v.Set("secrets_dir", dir)
+	write("API_KEY", "from-dir")
+	write("webhook_secret", "ignored")
+
+	if err := loadSecrets(v); err != nil {
+		t.Fatalf("error loading secrets: %v", err)
+	}
+
+	for key, want := range map[string]string{
+		"database_url":     "postgres://from-file",
+		"api_key":          "from-dir",
+		"webhook_secret":   "direct",
+		"do_spaces_secret": "",
+	} {
+		if got := v.GetString(key); got != want {
+			t.Errorf("%s: expected %q, got %q", key, want, got)
+		}
+	}
+
+	v = viper.New()
+	v.Set("webhook_secret", "direct")
+	v.Set("webhook_secret_file", filepath.Join(dir, "webhook_secret"))
+
+	if err := loadSecrets(v); err == nil {
+		t.Error("expected an error when a secret is set both directly and with a file")
+	}
+}
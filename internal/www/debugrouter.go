@@ -0,0 +1,52 @@
+package www
+
+import (
+	"net/http"
+	"runtime/debug"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+)
+
+// newDebugRouter creates a router serving runtime profiles, expvar variables,
+// and build information.
+//
+// It is served on its own port, since the main server's write timeout is
+// shorter than a typical CPU profile.
+func newDebugRouter(apiKey string) *chi.Mux {
+	r := chi.NewRouter()
+	r.Use(verifyAdminToken(apiKey))
+	r.Get("/debug/build", getBuildInfo)
+	r.Mount("/debug", middleware.Profiler())
+
+	return r
+}
+
+type buildInfoResponse struct {
+	GoVersion string            `json:"go_version"`
+	Path      string            `json:"path"`
+	Version   string            `json:"version"`
+	Settings  map[string]string `json:"settings"`
+}
+
+func getBuildInfo(w http.ResponseWriter, r *http.Request) {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		returnNotFound(r.Context(), w, "build info is not available")
+		return
+	}
+
+	settings := make(map[string]string, len(info.Settings))
+	for _, s := range info.Settings {
+		settings[s.Key] = s.Value
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	writeResponse(w, r, buildInfoResponse{
+		GoVersion: info.GoVersion,
+		Path:      info.Main.Path,
+		Version:   info.Main.Version,
+		Settings:  settings,
+	})
+}
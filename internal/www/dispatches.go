@@ -0,0 +1,275 @@
+package www
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"sync/atomic"
+	"time"
+
+	"github.com/jclem/jclem.me/internal/database"
+	"github.com/jclem/jclem.me/internal/dispatches"
+	"github.com/jclem/jclem.me/internal/events"
+	"github.com/jclem/jclem.me/internal/websub"
+	"github.com/jclem/jclem.me/internal/www/view"
+)
+
+const dispatchesRSSPath = "/dispatches/rss.xml"
+
+// dispatchesPerPage is the number of dispatches on each page of /dispatches.
+const dispatchesPerPage = 20
+
+// A dispatchQueryError is an invalid parameter in a request for a list of
+// dispatches.
+type dispatchQueryError struct {
+	Param string
+}
+
+func (e dispatchQueryError) Error() string {
+	return fmt.Sprintf("invalid %s parameter", e.Param)
+}
+
+// dispatchDateLayout is the layout of the "since" and "until" parameters.
+const dispatchDateLayout = time.DateOnly
+
+// dispatchListOpts parses the filters in a request for a list of dispatches:
+// "type", the dispatch type; "since" and "until", an inclusive range of dates;
+// and "before", the pagination cursor.
+func dispatchListOpts(q url.Values) ([]dispatches.ListOpt, error) {
+	var opts []dispatches.ListOpt
+
+	if typ := q.Get("type"); typ != "" {
+		t, err := dispatches.ParseType(typ)
+		if err != nil {
+			return nil, dispatchQueryError{Param: "type"}
+		}
+
+		opts = append(opts, dispatches.WithType(t))
+	}
+
+	if since := q.Get("since"); since != "" {
+		t, err := time.Parse(dispatchDateLayout, since)
+		if err != nil {
+			return nil, dispatchQueryError{Param: "since"}
+		}
+
+		opts = append(opts, dispatches.WithSince(t))
+	}
+
+	if until := q.Get("until"); until != "" {
+		t, err := time.Parse(dispatchDateLayout, until)
+		if err != nil {
+			return nil, dispatchQueryError{Param: "until"}
+		}
+
+		// The range includes the whole of its last day.
+		opts = append(opts, dispatches.WithUntil(t.AddDate(0, 0, 1)))
+	}
+
+	if before := q.Get("before"); before != "" {
+		id, err := database.ParseULID(before)
+		if err != nil {
+			return nil, dispatchQueryError{Param: "before"}
+		}
+
+		opts = append(opts, dispatches.WithBefore(id))
+	}
+
+	return opts, nil
+}
+
+// listDispatchPage lists a page of the default user's dispatches, filtered by
+// the request's query (see dispatchListOpts) and then by the given options.
+// It also returns the URL of the next page, if there is one. There are no
+// dispatches if there is no database.
+func (wr *webRouter) listDispatchPage(r *http.Request, perPage int, opts ...dispatches.ListOpt) ([]dispatches.Dispatch, string, error) {
+	if wr.dispatches == nil {
+		return nil, "", nil
+	}
+
+	query, err := dispatchListOpts(r.URL.Query())
+	if err != nil {
+		return nil, "", err
+	}
+
+	opts = append(query, opts...)
+	opts = append(opts,
+		dispatches.WithAuthor(wr.cfg.DefaultUser),
+		dispatches.WithLimit(perPage+1),
+	)
+
+	list, err := wr.dispatches.List(r.Context(), opts...)
+	if err != nil {
+		return nil, "", fmt.Errorf("error listing dispatches: %w", err)
+	}
+
+	var next string
+
+	if len(list) > perPage {
+		list = list[:perPage]
+
+		q := r.URL.Query()
+		q.Set("before", list[len(list)-1].ID.String())
+		next = r.URL.Path + "?" + q.Encode()
+	}
+
+	return list, next, nil
+}
+
+type dispatchesData struct {
+	Dispatches []dispatches.Dispatch
+
+	// Next is the URL of the next page of older dispatches, if there is one.
+	Next string
+
+	// Type, Since, and Until are the filters applied to the list.
+	Type  string
+	Since string
+	Until string
+}
+
+func (wr *webRouter) listDispatches(w http.ResponseWriter, r *http.Request) {
+	list, next, err := wr.listDispatchPage(r, dispatchesPerPage)
+	if err != nil {
+		var qerr dispatchQueryError
+		if errors.As(err, &qerr) {
+			wr.renderCodeError(w, r, http.StatusBadRequest, qerr.Error())
+
+			return
+		}
+
+		wr.renderError(w, r, err, "error listing dispatches")
+
+		return
+	}
+
+	if len(list) > 0 && r.URL.RawQuery == "" {
+		setLastModified(w, list[0].InsertedAt)
+	}
+
+	data := dispatchesData{
+		Dispatches: list,
+		Next:       next,
+		Type:       r.URL.Query().Get("type"),
+		Since:      r.URL.Query().Get("since"),
+		Until:      r.URL.Query().Get("until"),
+	}
+
+	if err := wr.view.RenderHTML(w, "dispatches/index", data,
+		view.WithTitle("Dispatches"),
+		view.WithTheme(view.RequestTheme(r)),
+		view.WithDescription("Dispatches from Jonathan Clem"),
+		view.WithLayout("dispatches/layout/index"),
+		view.WithCanonical("/dispatches"),
+	); err != nil {
+		wr.renderError(w, r, err, "error rendering page")
+
+		return
+	}
+}
+
+type dispatchesRSSData struct {
+	BuildDate  time.Time
+	Hub        string
+	Dispatches []dispatches.Dispatch
+}
+
+func (wr *webRouter) dispatchesRSS(w http.ResponseWriter, r *http.Request) {
+	var list []dispatches.Dispatch
+
+	if wr.dispatches != nil {
+		var err error
+
+		list, err = wr.dispatches.List(r.Context(), dispatches.WithAuthor(wr.cfg.DefaultUser))
+		if err != nil {
+			wr.renderError(w, r, err, "error listing dispatches")
+
+			return
+		}
+	}
+
+	// As with the posts feed, the build date is the date of the latest
+	// dispatch so that the feed only changes when a dispatch is added.
+	buildDate := time.Now()
+	if len(list) > 0 {
+		buildDate = list[0].InsertedAt
+	}
+
+	w.Header().Set("Content-Type", "application/xml")
+	setLastModified(w, buildDate)
+
+	if hub := wr.cfg.WebSubHub; hub != "" {
+		w.Header().Set("Link", websub.LinkHeader(hub, wr.view.URL(dispatchesRSSPath)))
+	}
+
+	if err := wr.view.RenderXML(w, "dispatches.xml", dispatchesRSSData{
+		BuildDate:  buildDate,
+		Hub:        wr.cfg.WebSubHub,
+		Dispatches: list,
+	}); err != nil {
+		wr.renderError(w, r, err, "error rendering rss")
+
+		return
+	}
+}
+
+// errFederatorNotReady is returned when federating a dispatch before the pub
+// router exists.
+var errFederatorNotReady = errors.New("dispatch federation is not ready")
+
+// A dispatchFederator federates dispatches once their images are processed.
+//
+// The pub router is set once it is created, which is after the job client
+// which works the processing jobs; until then, jobs which federate fail and
+// are retried.
+type dispatchFederator struct {
+	dispatches *dispatches.Service
+	feeds      *feedPublisher
+	pub        atomic.Pointer[pubRouter]
+}
+
+// ready implements dispatches.ReadyFunc.
+func (f *dispatchFederator) ready(ctx context.Context, dispatch dispatches.Dispatch, federate bool) error {
+	f.feeds.publish(dispatchesRSSPath)
+
+	pub := f.pub.Load()
+	if pub != nil {
+		publishDispatchCreated(ctx, pub.pub.Events(), dispatch)
+	}
+
+	if !federate || dispatch.NoteID != "" {
+		return nil
+	}
+
+	if pub == nil {
+		return errFederatorNotReady
+	}
+
+	user, err := pub.id.GetUserByUsername(ctx, dispatch.Author)
+	if err != nil {
+		return fmt.Errorf("error getting user: %w", err)
+	}
+
+	if _, err := federateDispatch(ctx, pub.pub, f.dispatches, user, dispatch); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// publishDispatchCreated publishes that a dispatch is ready to be shown. As
+// events are only notifications, failing to publish one is logged.
+func publishDispatchCreated(ctx context.Context, broker *events.Broker, dispatch dispatches.Dispatch) {
+	event := events.New(events.DispatchCreated, map[string]any{
+		"id":     dispatch.ID.String(),
+		"author": dispatch.Author,
+		"type":   dispatch.Type,
+	})
+
+	if err := broker.Publish(ctx, event); err != nil {
+		slog.ErrorContext(ctx, "error publishing dispatch event", "error", err)
+	}
+}
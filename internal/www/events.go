@@ -0,0 +1,93 @@
+package www
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/jclem/jclem.me/internal/events"
+)
+
+const (
+	eventsPath        = "/events"
+	eventStreamType   = "text/event-stream"
+	eventRetry        = 5 * time.Second
+	eventKeepAlive    = 30 * time.Second
+	eventStreamPrefix = "retry: %d\n\n"
+)
+
+// streamEvents streams events as they are published, as server-sent events
+// named by their types, whose data is the event as JSON. Only events for which
+// include returns true are sent, such as only public ones to anyone who asks.
+// An idle stream is sent a comment every so often, so that proxies keep it
+// open, and browsers reconnect to a closed one after a few seconds.
+//
+// SEE https://html.spec.whatwg.org/multipage/server-sent-events.html
+func streamEvents(broker *events.Broker, include func(events.Event) bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		rc := http.NewResponseController(w)
+
+		// The server's write timeout would otherwise end the stream.
+		if err := rc.SetWriteDeadline(time.Time{}); err != nil && !errors.Is(err, http.ErrNotSupported) {
+			logError(r.Context(), err, "error clearing write deadline")
+		}
+
+		ch, unsubscribe := broker.Subscribe()
+		defer unsubscribe()
+
+		w.Header().Set("Content-Type", eventStreamType)
+		w.Header().Set("Cache-Control", "no-store")
+		w.Header().Set("X-Accel-Buffering", "no")
+		w.WriteHeader(http.StatusOK)
+
+		fmt.Fprintf(w, eventStreamPrefix, eventRetry.Milliseconds())
+
+		keepAlive := time.NewTicker(eventKeepAlive)
+		defer keepAlive.Stop()
+
+		for {
+			if err := rc.Flush(); err != nil {
+				slog.DebugContext(r.Context(), "event stream closed", "error", err)
+				return
+			}
+
+			select {
+			case <-r.Context().Done():
+				return
+			case <-keepAlive.C:
+				fmt.Fprint(w, ": keep-alive\n\n")
+			case event, ok := <-ch:
+				// The broker is closed when the server shuts down, which
+				// would otherwise wait for streams until it times out.
+				if !ok {
+					return
+				}
+
+				if !include(event) {
+					continue
+				}
+
+				data, err := json.Marshal(event)
+				if err != nil {
+					logError(r.Context(), err, "error encoding event")
+					continue
+				}
+
+				fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event.Type, data)
+			}
+		}
+	}
+}
+
+// publicEvents includes only events which anyone may be shown.
+func publicEvents(event events.Event) bool {
+	return event.Public()
+}
+
+// allEvents includes every event.
+func allEvents(events.Event) bool {
+	return true
+}
@@ -0,0 +1,86 @@
+package www
+
+import (
+	"bufio"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/jclem/jclem.me/internal/events"
+)
+
+func TestStreamEvents(t *testing.T) {
+	broker := events.NewBroker(nil)
+
+	srv := httptest.NewServer(streamEvents(broker, publicEvents))
+	defer srv.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, srv.URL, nil)
+	if err != nil {
+		t.Fatalf("error creating request: %v", err)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("error requesting events: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if ct := resp.Header.Get("Content-Type"); ct != eventStreamType {
+		t.Fatalf("expected content type %s, got %s", eventStreamType, ct)
+	}
+
+	lines := bufio.NewScanner(resp.Body)
+
+	// The retry interval is sent once the stream is subscribed.
+	if !lines.Scan() || !strings.HasPrefix(lines.Text(), "retry: ") {
+		t.Fatalf("expected a retry interval, got %q", lines.Text())
+	}
+
+	for _, event := range []events.Event{
+		events.New(events.FollowerCreated, map[string]any{"actor": "https://example.com/bob"}),
+		events.New(events.NoteCreated, map[string]any{"note_id": "1", "public": false}),
+		events.New(events.DispatchCreated, map[string]any{"id": "2"}),
+	} {
+		if err := broker.Publish(ctx, event); err != nil {
+			t.Fatalf("error publishing event: %v", err)
+		}
+	}
+
+	var got []string
+
+	for len(got) < 2 && lines.Scan() {
+		if line := lines.Text(); line != "" {
+			got = append(got, line)
+		}
+	}
+
+	if len(got) != 2 || got[0] != "event: dispatch.created" || !strings.HasPrefix(got[1], `data: {"type":"dispatch.created"`) {
+		t.Errorf("expected only the public dispatch event, got %q", got)
+	}
+}
+
+func TestCreateDispatchPublishesEvent(t *testing.T) {
+	a, p := newTestAdmin(t)
+
+	ch, unsubscribe := p.pub.Events().Subscribe()
+	defer unsubscribe()
+
+	if w := serve(a, http.MethodPost, "/dispatches", "admin-key", `{"body":"Hello"}`); w.Code != http.StatusCreated {
+		t.Fatalf("expected status 201, got %d: %s", w.Code, w.Body)
+	}
+
+	select {
+	case event := <-ch:
+		if event.Type != events.DispatchCreated || event.Data["author"] != "alice" {
+			t.Errorf("unexpected event: %+v", event)
+		}
+	default:
+		t.Error("expected a dispatch event")
+	}
+}
@@ -0,0 +1,227 @@
+package www
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+
+	"github.com/go-chi/httplog/v2"
+	"github.com/jclem/jclem.me/internal/activitypub/identity"
+	"github.com/jclem/jclem.me/internal/dispatches"
+	"github.com/jclem/jclem.me/internal/posts"
+	"github.com/jclem/jclem.me/internal/timeline"
+	"github.com/jclem/jclem.me/internal/www/view"
+)
+
+// recentActivityLimit is the number of timeline items shown on the home page.
+const recentActivityLimit = 5
+
+// everythingPageSize is the number of timeline items on each page of
+// /everything.
+const everythingPageSize = timeline.DefaultLimit
+
+// newTimeline creates a timeline of the default user's posts, bookmarks, and
+// dispatches. Notes are added by the pub router, which serves them.
+func (wr *webRouter) newTimeline() *timeline.Service {
+	tl := timeline.New(wr.postsSource)
+
+	if wr.bookmarks != nil {
+		tl.AddSource(wr.bookmarksSource)
+	}
+
+	if wr.dispatches != nil {
+		tl.AddSource(wr.dispatchesSource)
+	}
+
+	return tl
+}
+
+func (wr *webRouter) postsSource(_ context.Context, limit int) ([]timeline.Item, error) {
+	list := wr.posts.List(posts.WithAuthor(wr.cfg.DefaultUser))
+	if len(list) > limit {
+		list = list[:limit]
+	}
+
+	items := make([]timeline.Item, 0, len(list))
+	for _, post := range list {
+		items = append(items, timeline.Post{Post: post})
+	}
+
+	return items, nil
+}
+
+func (wr *webRouter) bookmarksSource(ctx context.Context, limit int) ([]timeline.Item, error) {
+	list, err := wr.bookmarks.List(ctx, wr.cfg.DefaultUser, limit)
+	if err != nil {
+		return nil, fmt.Errorf("error listing bookmarks: %w", err)
+	}
+
+	items := make([]timeline.Item, 0, len(list))
+	for _, bookmark := range list {
+		items = append(items, timeline.Bookmark{Bookmark: bookmark})
+	}
+
+	return items, nil
+}
+
+func (wr *webRouter) dispatchesSource(ctx context.Context, limit int) ([]timeline.Item, error) {
+	list, err := wr.dispatches.List(ctx, dispatches.WithAuthor(wr.cfg.DefaultUser), dispatches.WithLimit(limit))
+	if err != nil {
+		return nil, fmt.Errorf("error listing dispatches: %w", err)
+	}
+
+	items := make([]timeline.Item, 0, len(list))
+	for _, dispatch := range list {
+		items = append(items, timeline.Dispatch{Dispatch: dispatch})
+	}
+
+	return items, nil
+}
+
+// notesSource lists the default user's public notes. There are none if the
+// user does not exist.
+func (p *pubRouter) notesSource(ctx context.Context, limit int) ([]timeline.Item, error) {
+	user, err := p.id.GetUserByUsername(ctx, p.cfg.DefaultUser)
+	if err != nil {
+		if errors.Is(err, identity.ErrUserNotFound) {
+			return nil, nil
+		}
+
+		return nil, fmt.Errorf("error getting user: %w", err)
+	}
+
+	list, err := p.pub.ListPublicNotes(ctx, user.ID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("error listing notes: %w", err)
+	}
+
+	items := make([]timeline.Item, 0, len(list))
+	for _, note := range list {
+		items = append(items, timeline.Note{NoteRecord: note})
+	}
+
+	return items, nil
+}
+
+type everythingData struct {
+	Query string
+	Kind  timeline.Kind
+	Kinds []timeline.Kind
+	Items []timeline.Item
+
+	// Next is the URL of the next page of items, if there is one.
+	Next string
+}
+
+// listEverything lists a page of the timeline, which may be searched or
+// filtered to one kind of content. Asked for a fragment, it renders only the
+// page's items and a link to the next page, so that searching, or loading more
+// items, replaces part of the page.
+func (wr *webRouter) listEverything(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	data := everythingData{Query: query.Get("q"), Kind: timeline.Kind(query.Get("kind")), Kinds: timeline.Kinds}
+
+	if data.Kind != "" && !slices.Contains(timeline.Kinds, data.Kind) {
+		wr.renderCodeError(w, r, http.StatusNotFound, "unknown kind")
+
+		return
+	}
+
+	page := 1
+
+	if param := query.Get("page"); param != "" {
+		var err error
+
+		page, err = strconv.Atoi(param)
+		if err != nil || page < 1 {
+			wr.renderCodeError(w, r, http.StatusNotFound, "invalid page")
+
+			return
+		}
+	}
+
+	// One more item than fits on the page is listed, to learn whether there is
+	// a next page.
+	items, err := wr.timeline.List(r.Context(),
+		timeline.WithQuery(data.Query),
+		timeline.WithKind(data.Kind),
+		timeline.WithOffset((page-1)*everythingPageSize),
+		timeline.WithLimit(everythingPageSize+1),
+	)
+	if err != nil {
+		wr.renderError(w, r, err, "error listing timeline")
+
+		return
+	}
+
+	if len(items) > everythingPageSize {
+		items = items[:everythingPageSize]
+		data.Next = everythingURL(data.Query, data.Kind, page+1)
+	}
+
+	data.Items = items
+
+	if data.Query == "" && page == 1 && len(items) > 0 {
+		setLastModified(w, items[0].Date())
+	}
+
+	if wantsFragment(w, r) {
+		if err := wr.view.RenderFragment(w, "everything/page", data); err != nil {
+			wr.renderError(w, r, err, "error rendering fragment")
+		}
+
+		return
+	}
+
+	// Searches are the pages they search, but each kind and page is its own.
+	canonical := "/everything"
+	if data.Kind != "" || page > 1 {
+		canonical = everythingURL("", data.Kind, page)
+	}
+
+	if err := wr.view.RenderHTML(w, "everything/index", data,
+		view.WithTitle("Everything"),
+		view.WithTheme(view.RequestTheme(r)),
+		view.WithDescription("Everything by Jonathan Clem"),
+		view.WithLayout("writing/layout/index"),
+		view.WithCanonical(canonical),
+	); err != nil {
+		wr.renderError(w, r, err, "error rendering page")
+
+		return
+	}
+}
+
+// everythingURL returns the URL of a page of the timeline.
+func everythingURL(q string, kind timeline.Kind, page int) string {
+	params := url.Values{"page": {strconv.Itoa(page)}}
+
+	if q != "" {
+		params.Set("q", q)
+	}
+
+	if kind != "" {
+		params.Set("kind", string(kind))
+	}
+
+	return "/everything?" + params.Encode()
+}
+
+// recentActivity lists the most recent timeline items for the home page. The
+// home page does not depend on the database otherwise, so if listing fails,
+// the error is logged and no items are listed.
+func (wr *webRouter) recentActivity(ctx context.Context) []timeline.Item {
+	items, err := wr.timeline.List(ctx, timeline.WithLimit(recentActivityLimit))
+	if err != nil {
+		oplog := httplog.LogEntry(ctx)
+		oplog.ErrorContext(ctx, "error listing recent activity", "error", err)
+
+		return nil
+	}
+
+	return items
+}
@@ -0,0 +1,130 @@
+package www
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	ap "github.com/jclem/jclem.me/internal/activitypub"
+	"github.com/jclem/jclem.me/internal/activitypub/identity"
+	"github.com/jclem/jclem.me/internal/database"
+	"github.com/jclem/jclem.me/internal/dispatches"
+	"github.com/jclem/jclem.me/internal/export"
+	"github.com/jclem/jclem.me/internal/mastodon"
+	"github.com/jclem/jclem.me/internal/www/config"
+)
+
+// Export writes an archive of the given user's data to w without starting the
+// server.
+//
+// Only the services which the archive reads are created, so that exporting
+// neither works jobs nor serves or publishes anything.
+func Export(ctx context.Context, cfg config.Config, w io.Writer, username string) error {
+	pool, err := database.NewPool(ctx, cfg)
+	if err != nil {
+		return fmt.Errorf("failed to connect to database: %w", err)
+	}
+
+	defer pool.Close()
+
+	id, err := identity.NewService(pool)
+	if err != nil {
+		return fmt.Errorf("error creating identity service: %w", err)
+	}
+
+	pub, err := ap.NewService(cfg, pool, id, ap.WithoutWorkers())
+	if err != nil {
+		return fmt.Errorf("error creating activitypub service: %w", err)
+	}
+
+	images, err := newImages(ctx, cfg, pool)
+	if err != nil {
+		return err
+	}
+
+	posts, err := newPosts(ctx, cfg, pool, images)
+	if err != nil {
+		return err
+	}
+
+	user, err := id.GetUserByUsername(ctx, username)
+	if err != nil {
+		return fmt.Errorf("error getting user: %w", err)
+	}
+
+	exporter := export.New(id, pub, dispatches.New(pool), posts, images)
+
+	if err := exporter.Write(ctx, w, user); err != nil {
+		return fmt.Errorf("error writing archive: %w", err)
+	}
+
+	return nil
+}
+
+// An AccountList is a list of accounts related to a user which is exported as
+// CSV.
+type AccountList string
+
+const (
+	// Followers are the accounts which follow the user.
+	Followers AccountList = "followers"
+
+	// Following are the accounts which the user follows.
+	Following AccountList = "following"
+)
+
+// ExportAccounts writes a list of the given user's accounts to w as CSV, in
+// the format in which Mastodon exports and imports them, without starting the
+// server.
+func ExportAccounts(ctx context.Context, cfg config.Config, w io.Writer, username string, list AccountList) error {
+	pool, err := database.NewPool(ctx, cfg)
+	if err != nil {
+		return fmt.Errorf("failed to connect to database: %w", err)
+	}
+
+	defer pool.Close()
+
+	id, err := identity.NewService(pool)
+	if err != nil {
+		return fmt.Errorf("error creating identity service: %w", err)
+	}
+
+	pub, err := ap.NewService(cfg, pool, id, ap.WithoutWorkers())
+	if err != nil {
+		return fmt.Errorf("error creating activitypub service: %w", err)
+	}
+
+	user, err := id.GetUserByUsername(ctx, username)
+	if err != nil {
+		return fmt.Errorf("error getting user: %w", err)
+	}
+
+	return writeAccounts(ctx, w, pub, user, list)
+}
+
+// writeAccounts writes a list of a user's accounts as CSV.
+func writeAccounts(ctx context.Context, w io.Writer, pub *ap.Service, user identity.User, list AccountList) error {
+	switch list {
+	case Followers:
+		followers, err := pub.ListFollowers(ctx, user.ID)
+		if err != nil {
+			return fmt.Errorf("error listing followers: %w", err)
+		}
+
+		actorIDs := make([]string, 0, len(followers))
+		for _, f := range followers {
+			actorIDs = append(actorIDs, f.ActorID)
+		}
+
+		return mastodon.WriteFollowers(ctx, w, actorIDs, mastodon.Address) //nolint:wrapcheck
+	case Following:
+		following, err := pub.ListFollowing(ctx, user.ID)
+		if err != nil {
+			return fmt.Errorf("error listing following: %w", err)
+		}
+
+		return mastodon.WriteFollowing(ctx, w, following, mastodon.Address) //nolint:wrapcheck
+	default:
+		return fmt.Errorf("unknown account list: %q", list)
+	}
+}
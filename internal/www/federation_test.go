@@ -0,0 +1,991 @@
+package www
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	ap "github.com/jclem/jclem.me/internal/activitypub"
+	"github.com/jclem/jclem.me/internal/activitypub/fedtest"
+	"github.com/jclem/jclem.me/internal/activitypub/identity"
+	"github.com/jclem/jclem.me/internal/bench"
+	"github.com/jclem/jclem.me/internal/database"
+	"github.com/jclem/jclem.me/internal/events"
+	"github.com/jclem/jclem.me/internal/mastodon"
+	"github.com/jclem/jclem.me/internal/telemetry"
+	"github.com/jclem/jclem.me/internal/webfinger"
+)
+
+// workJobs works the jobs enqueued in the pub router's store, including those
+// enqueued by other jobs, and returns the first error.
+func (p testPub) workJobs(t *testing.T) error {
+	t.Helper()
+
+	for {
+		args, ok := p.store.NextJob()
+		if !ok {
+			return nil
+		}
+
+		if err := p.pub.WorkJob(context.Background(), p.id, args); err != nil {
+			return err //nolint:wrapcheck
+		}
+	}
+}
+
+func TestFederationFollowAcceptDeliver(t *testing.T) {
+	p := newTestPub(t)
+	ctx := context.Background()
+
+	srv := httptest.NewServer(p)
+	t.Cleanup(srv.Close)
+
+	remote := fedtest.NewServer(t, "bob")
+
+	follow, err := remote.Follow(ctx, srv.URL+"/inbox", p.site.ActorID(p.user))
+	if err != nil {
+		t.Fatalf("error following: %v", err)
+	}
+
+	if err := p.workJobs(t); err != nil {
+		t.Fatalf("error working jobs: %v", err)
+	}
+
+	followers, err := p.pub.ListFollowers(ctx, p.user.ID)
+	if err != nil || len(followers) != 1 || followers[0].ActorID != remote.ActorID() {
+		t.Fatalf("unexpected followers: %+v, %v", followers, err)
+	}
+
+	keys, err := p.id.GetPublicKeys(ctx, p.user.ID)
+	if err != nil {
+		t.Fatalf("error getting public keys: %v", err)
+	}
+
+	deliveries := remote.Deliveries()
+	if len(deliveries) != 1 {
+		t.Fatalf("expected 1 delivery, got %d", len(deliveries))
+	}
+
+	accept := deliveries[0]
+	if accept.Activity.Type != "Accept" || accept.Activity.Actor != p.site.ActorID(p.user) || string(accept.Activity.Object) != `"`+follow.ID+`"` {
+		t.Errorf("unexpected accept: %s", accept.Body)
+	}
+
+	if err := accept.Verify(keys[0].PEM); err != nil {
+		t.Errorf("expected accept to be signed: %v", err)
+	}
+
+	if !slices.Equal(accept.Activity.To, []string{remote.ActorID()}) || accept.Activity.Published == "" {
+		t.Errorf("expected the accept to be addressed to the follower and published, got %s", accept.Body)
+	}
+
+	// The Accept is recorded in the outbox, but not listed in it.
+	if ar, err := p.pub.GetActivityByID(ctx, p.user.ID, accept.Activity.ID); err != nil || ar.Mailbox != ap.Outbox || ar.Type != "Accept" {
+		t.Errorf("expected the accept to be recorded in the outbox, got %+v, %v", ar, err)
+	}
+
+	if _, total, err := p.pub.ListPublicOutbox(ctx, p.user.ID, 0, 0); err != nil || total != 0 {
+		t.Errorf("expected the outbox to list no activities, got %d, %v", total, err)
+	}
+
+	// A note addressed to followers is delivered to the follower.
+	if _, err := publishNote(ctx, p.pub, p.user, "Hello, Bob", []string{ap.PublicNS}, []string{p.site.ActorFollowers(p.user)}); err != nil {
+		t.Fatalf("error publishing note: %v", err)
+	}
+
+	if err := p.workJobs(t); err != nil {
+		t.Fatalf("error working jobs: %v", err)
+	}
+
+	deliveries = remote.Deliveries()
+	if len(deliveries) != 2 || deliveries[1].Activity.Type != "Create" {
+		t.Fatalf("expected a Create to be delivered, got %d deliveries", len(deliveries))
+	}
+
+	var note ap.Note
+	if err := json.Unmarshal(deliveries[1].Activity.Object, &note); err != nil || note.Content != "Hello, Bob" {
+		t.Errorf("unexpected note: %+v, %v", note, err)
+	}
+
+	// An Undo of the Follow removes the follower and is accepted.
+	if err := remote.Unfollow(ctx, srv.URL+"/inbox", follow); err != nil {
+		t.Fatalf("error unfollowing: %v", err)
+	}
+
+	if err := p.workJobs(t); err != nil {
+		t.Fatalf("error working jobs: %v", err)
+	}
+
+	if followers, err := p.pub.ListFollowers(ctx, p.user.ID); err != nil || len(followers) != 0 {
+		t.Errorf("expected no followers, got %+v, %v", followers, err)
+	}
+
+	if deliveries := remote.Deliveries(); len(deliveries) != 3 || deliveries[2].Activity.Type != "Accept" {
+		t.Errorf("expected the undo to be accepted, got %d deliveries", len(deliveries))
+	}
+}
+
+func TestFederationUndoFollow(t *testing.T) {
+	// undos return the Undo which each kind of server sends for a Follow.
+	undos := map[string]func(remote *fedtest.Server, follow fedtest.Activity) fedtest.Activity{
+		"mastodon": func(remote *fedtest.Server, follow fedtest.Activity) fedtest.Activity {
+			follow.Context = nil
+
+			return fedtest.Activity{
+				Context: ap.ActivityStreamsContext,
+				Type:    "Undo",
+				ID:      follow.ID + "/undo",
+				Actor:   remote.ActorID(),
+				Object:  follow,
+			}
+		},
+		"pleroma": func(remote *fedtest.Server, follow fedtest.Activity) fedtest.Activity {
+			return fedtest.Activity{
+				Context: []any{ap.ActivityStreamsContext, "https://pleroma.example/schemas/litepub-0.1.jsonld", map[string]string{"@language": "und"}},
+				Type:    "Undo",
+				ID:      remote.ActorID() + "/activities/undo",
+				Actor:   remote.ActorID(),
+				Object: map[string]any{
+					"@context": []any{ap.ActivityStreamsContext, "https://pleroma.example/schemas/litepub-0.1.jsonld"},
+					"type":     "Follow",
+					"id":       follow.ID,
+					"actor":    remote.ActorID(),
+					"object":   follow.Object,
+					"state":    "accept",
+					"to":       []string{follow.Object.(string)},
+					"cc":       []string{ap.PublicNS},
+				},
+			}
+		},
+		"misskey": func(remote *fedtest.Server, follow fedtest.Activity) fedtest.Activity {
+			return fedtest.Activity{
+				Context: []any{ap.ActivityStreamsContext, ap.SecurityContext, map[string]string{"misskey": "https://misskey-hub.net/ns#"}},
+				Type:    "Undo",
+				ID:      remote.ActorID() + "/undo",
+				Actor:   remote.ActorID(),
+				Object: map[string]any{
+					"type":   "Follow",
+					"id":     follow.ID,
+					"actor":  remote.ActorID(),
+					"object": follow.Object,
+				},
+			}
+		},
+		"by IRI": func(remote *fedtest.Server, follow fedtest.Activity) fedtest.Activity {
+			return fedtest.Activity{
+				Context: ap.ActivityStreamsContext,
+				Type:    "Undo",
+				ID:      follow.ID + "/undo",
+				Actor:   remote.ActorID(),
+				Object:  follow.ID,
+			}
+		},
+		"by ID and type": func(remote *fedtest.Server, follow fedtest.Activity) fedtest.Activity {
+			return fedtest.Activity{
+				Context: ap.ActivityStreamsContext,
+				Type:    "Undo",
+				ID:      follow.ID + "/undo",
+				Actor:   remote.ActorID(),
+				Object:  map[string]string{"type": "Follow", "id": follow.ID},
+			}
+		},
+	}
+
+	for name, undo := range undos {
+		t.Run(name, func(t *testing.T) {
+			p := newTestPub(t)
+			ctx := context.Background()
+
+			srv := httptest.NewServer(p)
+			t.Cleanup(srv.Close)
+
+			remote := fedtest.NewServer(t, "bob")
+
+			follow, err := remote.Follow(ctx, srv.URL+"/inbox", p.site.ActorID(p.user))
+			if err != nil {
+				t.Fatalf("error following: %v", err)
+			}
+
+			if err := remote.Send(ctx, srv.URL+"/inbox", undo(remote, follow)); err != nil {
+				t.Fatalf("error undoing follow: %v", err)
+			}
+
+			if err := p.workJobs(t); err != nil {
+				t.Fatalf("error working jobs: %v", err)
+			}
+
+			if followers, err := p.pub.ListFollowers(ctx, p.user.ID); err != nil || len(followers) != 0 {
+				t.Errorf("expected no followers, got %+v, %v", followers, err)
+			}
+
+			if deliveries := remote.Deliveries(); len(deliveries) != 2 || deliveries[1].Activity.Type != "Accept" {
+				t.Errorf("expected the undo to be accepted, got %d deliveries", len(deliveries))
+			}
+		})
+	}
+}
+
+func TestFederationUndoOtherActorsFollow(t *testing.T) {
+	p := newTestPub(t)
+	ctx := context.Background()
+
+	srv := httptest.NewServer(p)
+	t.Cleanup(srv.Close)
+
+	bob := fedtest.NewServer(t, "bob")
+	mallory := fedtest.NewServer(t, "mallory")
+
+	follow, err := bob.Follow(ctx, srv.URL+"/inbox", p.site.ActorID(p.user))
+	if err != nil {
+		t.Fatalf("error following: %v", err)
+	}
+
+	if err := p.workJobs(t); err != nil {
+		t.Fatalf("error working jobs: %v", err)
+	}
+
+	// An Undo of a follow by IRI is checked against the follow's actor.
+	if err := mallory.Send(ctx, srv.URL+"/inbox", fedtest.Activity{
+		Context: ap.ActivityStreamsContext,
+		Type:    "Undo",
+		ID:      mallory.ActorID() + "/undo",
+		Actor:   mallory.ActorID(),
+		Object:  follow.ID,
+	}); err != nil {
+		t.Fatalf("error sending undo: %v", err)
+	}
+
+	if err := p.workJobs(t); err == nil {
+		t.Error("expected the undo to be refused")
+	}
+
+	if followers, err := p.pub.ListFollowers(ctx, p.user.ID); err != nil || len(followers) != 1 {
+		t.Errorf("expected the follower to remain, got %+v, %v", followers, err)
+	}
+
+	// An Undo of an unknown activity is ignored.
+	if err := bob.Send(ctx, srv.URL+"/inbox", fedtest.Activity{
+		Context: ap.ActivityStreamsContext,
+		Type:    "Undo",
+		ID:      bob.ActorID() + "/undo",
+		Actor:   bob.ActorID(),
+		Object:  bob.ActorID() + "/likes/1",
+	}); err != nil {
+		t.Fatalf("error sending undo: %v", err)
+	}
+
+	if err := p.workJobs(t); err != nil {
+		t.Errorf("expected the undo to be ignored, got %v", err)
+	}
+}
+
+// TestFederationInboxPathsAgree sends each signed activity to one user's inbox
+// over HTTP, and the same body to another's through the Service and its
+// workers, so that the two ways of receiving an activity cannot diverge.
+func TestFederationInboxPathsAgree(t *testing.T) {
+	ctx := context.Background()
+	viaHTTP := newTestPub(t)
+	direct := newTestPub(t)
+	remote := fedtest.NewServer(t, "bob")
+
+	var (
+		mu   sync.Mutex
+		body []byte
+	)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, err := io.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		mu.Lock()
+		body = b
+		mu.Unlock()
+
+		r.Body = io.NopCloser(bytes.NewReader(b))
+		viaHTTP.ServeHTTP(w, r)
+	}))
+	t.Cleanup(srv.Close)
+
+	httpEvents, unsubscribe := viaHTTP.pub.Events().Subscribe()
+	t.Cleanup(unsubscribe)
+
+	directEvents, unsubscribe := direct.pub.Events().Subscribe()
+	t.Cleanup(unsubscribe)
+
+	// effects describes what receiving an activity stored and set off for the
+	// pub, other than IDs which are its own, such as those of records and of
+	// the Accepts it delivered.
+	effects := func(p testPub, received <-chan events.Event, activityID string) string {
+		t.Helper()
+
+		delivered := len(remote.Deliveries())
+
+		if err := p.workJobs(t); err != nil {
+			t.Fatalf("error working jobs: %v", err)
+		}
+
+		var b strings.Builder
+
+		ar, err := p.pub.GetActivityByID(ctx, p.user.ID, activityID)
+		if err != nil {
+			t.Fatalf("error getting activity: %v", err)
+		}
+
+		fmt.Fprintf(&b, "activity: %s %s %s\n", ar.Mailbox, ar.Type, ar.Data)
+
+		followers, err := p.pub.ListFollowers(ctx, p.user.ID)
+		if err != nil {
+			t.Fatalf("error listing followers: %v", err)
+		}
+
+		for _, f := range followers {
+			fmt.Fprintf(&b, "follower: %s %s\n", f.ActorID, f.ActivityID)
+		}
+
+		notifications, _, err := p.pub.ListNotifications(ctx, p.user.ID, false, 0, 0)
+		if err != nil {
+			t.Fatalf("error listing notifications: %v", err)
+		}
+
+		for _, n := range notifications {
+			fmt.Fprintf(&b, "notification: %s %s %s %s\n", n.Type, n.ActorID, n.ActivityID, n.ObjectID)
+		}
+
+		for _, d := range remote.Deliveries()[delivered:] {
+			fmt.Fprintf(&b, "delivery: %s %s %v\n", d.Activity.Type, d.Activity.Object, d.Activity.To)
+		}
+
+		for {
+			select {
+			case event := <-received:
+				fmt.Fprintf(&b, "event: %s %v\n", event.Type, event.Data["actor_id"])
+				continue
+			default:
+			}
+
+			break
+		}
+
+		return b.String()
+	}
+
+	follow := fedtest.Activity{
+		Context: ap.ActivityStreamsContext,
+		Type:    "Follow",
+		ID:      remote.ActorID() + "/follows/1",
+		Actor:   remote.ActorID(),
+		Object:  viaHTTP.site.ActorID(viaHTTP.user),
+	}
+
+	mention := fedtest.Activity{
+		Context: ap.ActivityStreamsContext,
+		Type:    "Create",
+		ID:      remote.ActorID() + "/notes/1/activity",
+		Actor:   remote.ActorID(),
+		Object: map[string]any{
+			"type":         "Note",
+			"id":           remote.ActorID() + "/notes/1",
+			"attributedTo": remote.ActorID(),
+			"content":      "<p>Hello, Alice</p>",
+			"to":           []string{viaHTTP.site.ActorID(viaHTTP.user)},
+		},
+	}
+
+	unfollow := fedtest.Activity{
+		Context: ap.ActivityStreamsContext,
+		Type:    "Undo",
+		ID:      remote.ActorID() + "/follows/1/undo",
+		Actor:   remote.ActorID(),
+		Object:  follow.ID,
+	}
+
+	for _, activity := range []fedtest.Activity{follow, mention, unfollow} {
+		if err := remote.Send(ctx, srv.URL+"/inbox", activity); err != nil {
+			t.Fatalf("error sending %s: %v", activity.Type, err)
+		}
+
+		mu.Lock()
+		received := body
+		mu.Unlock()
+
+		want := effects(viaHTTP, httpEvents, activity.ID)
+
+		var decoded ap.Activity[json.RawMessage]
+		if err := json.Unmarshal(received, &decoded); err != nil {
+			t.Fatalf("error decoding %s: %v", activity.Type, err)
+		}
+
+		if _, err := direct.pub.CreateActivity(ctx, direct.user.ID, ap.Inbox, decoded.Context.Base(), decoded.Type, decoded.ID, received); err != nil {
+			t.Fatalf("error creating %s: %v", activity.Type, err)
+		}
+
+		if got := effects(direct, directEvents, activity.ID); got != want {
+			t.Errorf("expected the %s to have the same effects by either path:\nHTTP:\n%s\ndirect:\n%s", activity.Type, want, got)
+		}
+	}
+}
+
+func TestFederationRejectsUnsignedActivity(t *testing.T) {
+	p := newTestPub(t)
+	remote := fedtest.NewServer(t, "bob")
+
+	body := `{"@context":"https://www.w3.org/ns/activitystreams","type":"Follow","id":"` + remote.ActorID() + `/follows/1","actor":"` + remote.ActorID() + `","object":"` + p.site.ActorID(p.user) + `"}`
+
+	if w := serve(p, http.MethodPost, "/inbox", "", body); w.Code != http.StatusUnauthorized {
+		t.Errorf("expected status 401, got %d: %s", w.Code, w.Body)
+	}
+
+	if jobs := p.store.Jobs(); len(jobs) != 0 {
+		t.Errorf("expected no jobs, got %d", len(jobs))
+	}
+}
+
+func TestFederationDeliveryFailure(t *testing.T) {
+	p := newTestPub(t)
+	ctx := context.Background()
+	remote := fedtest.NewServer(t, "bob")
+
+	if _, err := p.pub.CreateFollower(ctx, p.user.ID, remote.ActorID(), remote.ActorID()+"/follows/1"); err != nil {
+		t.Fatalf("error creating follower: %v", err)
+	}
+
+	if _, err := publishNote(ctx, p.pub, p.user, "Hello", []string{ap.PublicNS}, nil); err != nil {
+		t.Fatalf("error publishing note: %v", err)
+	}
+
+	// A server error is retried, so the job fails rather than being cancelled.
+	remote.SetInboxStatus(http.StatusServiceUnavailable)
+
+	if err := p.workJobs(t); err == nil {
+		t.Error("expected delivery to fail")
+	}
+
+	if deliveries := remote.Deliveries(); len(deliveries) != 1 {
+		t.Errorf("expected 1 delivery attempt, got %d", len(deliveries))
+	}
+}
+
+func TestFederationWebFinger(t *testing.T) {
+	remote := fedtest.NewServer(t, "bob")
+
+	actorID, err := webfinger.ResolveActor(context.Background(), remote.Address())
+	if err != nil || actorID != remote.ActorID() {
+		t.Errorf("expected %q, got %q, %v", remote.ActorID(), actorID, err)
+	}
+}
+
+func TestFederationInboxUnknownUsers(t *testing.T) {
+	a, p := newTestAdmin(t)
+	ctx := context.Background()
+
+	srv := httptest.NewServer(p)
+	t.Cleanup(srv.Close)
+
+	remote := fedtest.NewServer(t, "bob")
+
+	if _, _, err := p.id.CreateUser(ctx, identity.NewUser{Username: "carol"}); err != nil {
+		t.Fatalf("error creating user: %v", err)
+	}
+
+	if w := serve(a, http.MethodDelete, "/users/carol", "admin-key", ""); w.Code != http.StatusNoContent {
+		t.Fatalf("expected status 204, got %d: %s", w.Code, w.Body)
+	}
+
+	// Deliveries to users who never existed are not found, and to deleted
+	// users are gone, so that servers stop retrying them.
+	for username, status := range map[string]string{"nobody": "404", "carol": "410"} {
+		_, err := remote.Follow(ctx, srv.URL+"/~"+username+"/inbox", p.site.BaseURL+"/~"+username)
+		if err == nil || !strings.Contains(err.Error(), status) {
+			t.Errorf("%s: expected status %s, got %v", username, status, err)
+		}
+
+		if w := serve(p, http.MethodGet, "/~"+username, "", ""); !strings.HasPrefix(w.Result().Status, status) {
+			t.Errorf("%s: expected the actor to respond %s, got %d", username, status, w.Code)
+		}
+	}
+
+	if args, ok := p.store.NextJob(); ok {
+		t.Errorf("expected no jobs, got %+v", args)
+	}
+
+	if remote.ActorRequests() != 0 {
+		t.Errorf("expected no signatures to be verified, got %d actor requests", remote.ActorRequests())
+	}
+
+	if w := serve(a, http.MethodDelete, "/users/carol", "admin-key", ""); w.Code != http.StatusNotFound {
+		t.Errorf("expected a deleted user not to be found, got %d", w.Code)
+	}
+}
+
+func TestFederationUserDeletedInAnotherProcess(t *testing.T) {
+	p := newTestPub(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// Another process's identity service shares the store, and events are
+	// announced through a shared broker.
+	other := identity.NewServiceWithStore(p.idStore)
+	broker := events.NewBroker(nil)
+
+	p.id.Listen(ctx, broker)
+	other.Listen(ctx, broker)
+
+	// The user is cached once their actor is served.
+	if w := serve(p, http.MethodGet, "/", "", ""); w.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", w.Code)
+	}
+
+	if err := other.DeleteUser(ctx, p.user.ID); err != nil {
+		t.Fatalf("error deleting user: %v", err)
+	}
+
+	deadline := time.Now().Add(time.Second)
+
+	for {
+		w := serve(p, http.MethodGet, "/", "", "")
+		if w.Code == http.StatusGone {
+			break
+		}
+
+		if time.Now().After(deadline) {
+			t.Fatalf("expected the deleted user to be gone, got %d", w.Code)
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestFederationSignatureKeyOwner(t *testing.T) {
+	p := newTestPub(t)
+	ctx := context.Background()
+
+	srv := httptest.NewServer(p)
+	t.Cleanup(srv.Close)
+
+	bob := fedtest.NewServer(t, "bob")
+	mallory := fedtest.NewServer(t, "mallory")
+
+	// An activity signed with one actor's key cannot claim another actor.
+	err := mallory.Send(ctx, srv.URL+"/inbox", fedtest.Activity{
+		Context: ap.ActivityStreamsContext,
+		Type:    "Follow",
+		ID:      bob.ActorID() + "/follows/1",
+		Actor:   bob.ActorID(),
+		Object:  p.site.ActorID(p.user),
+	})
+	if err == nil || !strings.Contains(err.Error(), "401") {
+		t.Errorf("expected status 401, got %v", err)
+	}
+
+	if bob.ActorRequests() != 0 {
+		t.Errorf("expected the claimed actor not to be requested, got %d requests", bob.ActorRequests())
+	}
+
+	// The key is cached once it has verified a signature.
+	for i := 0; i < 2; i++ {
+		if _, err := bob.Follow(ctx, srv.URL+"/inbox", p.site.ActorID(p.user)); err != nil {
+			t.Fatalf("error following: %v", err)
+		}
+	}
+
+	if bob.ActorRequests() != 1 {
+		t.Errorf("expected the key to be requested once, got %d requests", bob.ActorRequests())
+	}
+}
+
+func TestFederationUnavailableKeysDoNotBan(t *testing.T) {
+	p := newTestPub(t)
+	ctx := context.Background()
+
+	p.inboxGuard.banThreshold, p.inboxGuard.banDuration = 2, time.Hour
+
+	srv := httptest.NewServer(p)
+	t.Cleanup(srv.Close)
+
+	// Servers send Deletes of deleted actors, whose keys are gone, through no
+	// fault of their own.
+	bob := fedtest.NewServer(t, "bob")
+	bob.SetActorStatus(http.StatusGone)
+
+	for i := 0; i < 5; i++ {
+		err := bob.Send(ctx, srv.URL+"/inbox", fedtest.Activity{
+			Context: ap.ActivityStreamsContext,
+			Type:    "Delete",
+			ID:      fmt.Sprintf("%s#delete-%d", bob.ActorID(), i),
+			Actor:   bob.ActorID(),
+			Object:  bob.ActorID(),
+		})
+		if err == nil || !strings.Contains(err.Error(), "401") {
+			t.Fatalf("expected status 401 rather than a ban, got %v", err)
+		}
+	}
+
+	// Signatures which fail against keys which were fetched do lead to bans.
+	mallory := fedtest.NewServer(t, "mallory")
+
+	for i, want := range []string{"401", "401", "429"} {
+		err := mallory.Send(ctx, srv.URL+"/inbox", fedtest.Activity{
+			Context: ap.ActivityStreamsContext,
+			Type:    "Follow",
+			ID:      fmt.Sprintf("%s/follows/%d", bob.ActorID(), i),
+			Actor:   bob.ActorID(),
+			Object:  p.site.ActorID(p.user),
+		})
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("%d: expected status %s, got %v", i, want, err)
+		}
+	}
+}
+
+func TestInspectSignature(t *testing.T) {
+	ctx := context.Background()
+	remote := fedtest.NewServer(t, "bob")
+
+	var (
+		captured *http.Request
+		body     []byte
+	)
+
+	inbox := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		captured = r
+		body, _ = io.ReadAll(r.Body)
+	}))
+	t.Cleanup(inbox.Close)
+
+	if _, err := remote.Follow(ctx, inbox.URL+"/inbox", "https://pub.example.com"); err != nil {
+		t.Fatalf("error following: %v", err)
+	}
+
+	report := ap.InspectSignature(ctx, captured, body, remote.ActorID())
+	if !report.Verified || !report.KeyFound || !report.DigestMatches || report.Algorithm != "rsa-sha256" {
+		t.Errorf("unexpected report: %+v", report)
+	}
+
+	if !strings.HasPrefix(report.SigningString, "(request-target): post /inbox\ndate: ") {
+		t.Errorf("unexpected signing string: %q", report.SigningString)
+	}
+
+	// The signature covers the Digest header, not the body itself.
+	report = ap.InspectSignature(ctx, captured, []byte("{}"), remote.ActorID())
+	if !report.Verified || report.DigestMatches {
+		t.Errorf("expected a verified signature whose digest does not match, got %+v", report)
+	}
+}
+
+func TestFederationEd25519Keys(t *testing.T) {
+	p := newTestPub(t)
+	ctx := context.Background()
+	remote := fedtest.NewServer(t, "bob")
+
+	if _, err := p.id.GenerateKeys(ctx, p.user.ID, identity.KeyAlgorithmRSA); !errors.Is(err, identity.ErrSigningKeysExist) {
+		t.Errorf("expected ErrSigningKeysExist, got %v", err)
+	}
+
+	// A user inserted without keys, as those created before keys were
+	// generated were.
+	carol, err := p.idStore.InsertUser(ctx, identity.User{ID: database.NewULID(), Username: "carol"}, nil, identity.APIKey{ID: database.NewULID()})
+	if err != nil {
+		t.Fatalf("error inserting user: %v", err)
+	}
+
+	if _, err := p.id.GenerateKeys(ctx, carol.ID, "dsa"); !errors.Is(err, identity.ErrInvalidKeyAlgorithm) {
+		t.Errorf("expected ErrInvalidKeyAlgorithm, got %v", err)
+	}
+
+	key, err := p.id.GenerateKeys(ctx, carol.ID, identity.KeyAlgorithmEd25519)
+	if err != nil {
+		t.Fatalf("error generating keys: %v", err)
+	}
+
+	if key.Version != 1 || !strings.HasPrefix(key.PEM, "-----BEGIN PUBLIC KEY-----") {
+		t.Errorf("unexpected key: %+v", key)
+	}
+
+	if _, err := p.pub.CreateFollower(ctx, carol.ID, remote.ActorID(), remote.ActorID()+"/follows/1"); err != nil {
+		t.Fatalf("error creating follower: %v", err)
+	}
+
+	if _, err := publishNote(ctx, p.pub, carol, "Hello", []string{ap.PublicNS}, nil); err != nil {
+		t.Fatalf("error publishing note: %v", err)
+	}
+
+	if err := p.workJobs(t); err != nil {
+		t.Fatalf("error working jobs: %v", err)
+	}
+
+	deliveries := remote.Deliveries()
+	if len(deliveries) != 1 {
+		t.Fatalf("expected 1 delivery, got %d", len(deliveries))
+	}
+
+	if err := deliveries[0].Verify(key.PEM); err != nil {
+		t.Errorf("expected delivery to be signed with the Ed25519 key: %v", err)
+	}
+}
+
+func TestFederationFanOut(t *testing.T) {
+	result, err := bench.FanOut(context.Background(), testConfig, bench.Options{Followers: 20, Hosts: 3, Workers: 4})
+	if err != nil {
+		t.Fatalf("error running fan-out: %v", err)
+	}
+
+	if result.Delivered != 20 || result.Failed != 0 {
+		t.Errorf("expected 20 deliveries and no failures, got %d and %d", result.Delivered, result.Failed)
+	}
+
+	inboxes := 0
+	for _, requests := range result.Requests {
+		inboxes += requests.Inboxes
+	}
+
+	if len(result.Requests) != 3 || inboxes != 20 || result.SharedInboxRequests != 3 {
+		t.Errorf("expected 20 deliveries to 3 hosts, got %+v", result.Requests)
+	}
+
+	result, err = bench.FanOut(context.Background(), testConfig, bench.Options{Followers: 2, Hosts: 1, Workers: 1, FailureRate: 1})
+	if err != nil {
+		t.Fatalf("error running fan-out: %v", err)
+	}
+
+	if result.Delivered != 0 || result.Failed != 2 {
+		t.Errorf("expected 2 failed deliveries, got %d delivered and %d failed", result.Delivered, result.Failed)
+	}
+}
+
+func TestFederationOutboxActivities(t *testing.T) {
+	p := newTestPub(t)
+	ctx := context.Background()
+
+	follower := fedtest.NewServer(t, "bob")
+	author := fedtest.NewServer(t, "carol")
+
+	if _, err := p.pub.CreateFollower(ctx, p.user.ID, follower.ActorID(), follower.ActorID()+"/follows/1"); err != nil {
+		t.Fatalf("error creating follower: %v", err)
+	}
+
+	send := func(activity any, typ, id string) error {
+		j, err := json.Marshal(activity)
+		if err != nil {
+			t.Fatalf("error encoding activity: %v", err)
+		}
+
+		if _, err := p.pub.CreateActivity(ctx, p.user.ID, ap.Outbox, ap.ActivityStreamsContext, typ, id, j); err != nil {
+			return err //nolint:wrapcheck
+		}
+
+		return p.workJobs(t)
+	}
+
+	noteID := author.ActorID() + "/notes/1"
+
+	// A Like is delivered only to the note's author.
+	like := ap.NewLikeActivity(p.site, p.user, noteID, author.ActorID())
+	if err := send(like, like.Type, like.ID); err != nil {
+		t.Fatalf("error sending like: %v", err)
+	}
+
+	if len(author.Deliveries()) != 1 || len(follower.Deliveries()) != 0 {
+		t.Errorf("expected the like to be delivered to the author alone, got %d and %d deliveries", len(author.Deliveries()), len(follower.Deliveries()))
+	}
+
+	// An Announce is delivered to the author and to followers.
+	announce := ap.NewAnnounceActivity(p.site, p.user, noteID, author.ActorID())
+	if err := send(announce, announce.Type, announce.ID); err != nil {
+		t.Fatalf("error sending announce: %v", err)
+	}
+
+	if len(author.Deliveries()) != 2 || len(follower.Deliveries()) != 1 || follower.Deliveries()[0].Activity.Type != "Announce" {
+		t.Errorf("expected the announce to be delivered to the author and follower, got %d and %d deliveries", len(author.Deliveries()), len(follower.Deliveries()))
+	}
+
+	// An Undo embeds the undone activity, and is delivered as it was.
+	undo := ap.NewUndoActivity(p.site, p.user, like)
+	if err := send(undo, undo.Type, undo.ID); err != nil {
+		t.Fatalf("error sending undo: %v", err)
+	}
+
+	deliveries := author.Deliveries()
+	if len(deliveries) != 3 || deliveries[2].Activity.Type != "Undo" || len(follower.Deliveries()) != 1 {
+		t.Fatalf("expected the undo to be delivered to the author alone, got %d and %d deliveries", len(deliveries), len(follower.Deliveries()))
+	}
+
+	var undone ap.Activity[string]
+	if err := json.Unmarshal(deliveries[2].Activity.Object, &undone); err != nil || undone.ID != like.ID || undone.Type != "Like" {
+		t.Errorf("expected the undo to embed the like, got %+v, %v", undone, err)
+	}
+
+	// A Follow is delivered to the followee.
+	follow := ap.NewFollowActivity(p.site, p.user, author.ActorID())
+	if err := send(follow, follow.Type, follow.ID); err != nil {
+		t.Fatalf("error sending follow: %v", err)
+	}
+
+	if deliveries := author.Deliveries(); len(deliveries) != 4 || deliveries[3].Activity.Type != "Follow" {
+		t.Errorf("expected the follow to be delivered to the followee, got %d deliveries", len(deliveries))
+	}
+
+	// Activities which fail validation are refused.
+	self := ap.NewFollowActivity(p.site, p.user, p.site.ActorID(p.user))
+	if err := send(self, self.Type, self.ID); err == nil {
+		t.Error("expected a follow of oneself to be refused")
+	}
+
+	received := ap.Activity[string]{Type: "Follow", ID: follower.ActorID() + "/follows/1", Actor: follower.ActorID(), Object: p.site.ActorID(p.user)}
+	if err := send(ap.NewUndoActivity(p.site, p.user, received), "Undo", p.site.ActorOutbox(p.user)+"/"+database.NewULID().String()); err == nil {
+		t.Error("expected an undo of an activity the user did not send to be refused")
+	}
+
+	unaddressed := ap.NewLikeActivity(p.site, p.user, noteID, author.ActorID())
+	unaddressed.To = nil
+
+	if err := send(unaddressed, unaddressed.Type, unaddressed.ID); err == nil {
+		t.Error("expected an unaddressed like to be refused")
+	}
+}
+
+func TestFederationImportExportFollowing(t *testing.T) {
+	a, p := newTestAdmin(t)
+
+	bob := fedtest.NewServer(t, "bob")
+	carol := fedtest.NewServer(t, "carol")
+
+	csv := "Account address,Show boosts,Notify on new posts,Languages\n" +
+		bob.Address() + ",true,false,\n" +
+		carol.ActorID() + ",true,false,\n" +
+		"nobody@127.0.0.1:1,true,false,\n"
+
+	w := serve(a, http.MethodPost, "/users/"+p.user.Username+"/following", "admin-key", csv)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", w.Code, w.Body)
+	}
+
+	if result, want := decode[mastodon.Result](t, w), (mastodon.Result{Following: 2, UnresolvedFollowing: 1}); result != want {
+		t.Errorf("expected %+v, got %+v", want, result)
+	}
+
+	if err := p.workJobs(t); err != nil {
+		t.Fatalf("error working jobs: %v", err)
+	}
+
+	for _, remote := range []*fedtest.Server{bob, carol} {
+		deliveries := remote.Deliveries()
+		if len(deliveries) != 1 || deliveries[0].Activity.Type != "Follow" || string(deliveries[0].Activity.Object) != `"`+remote.ActorID()+`"` {
+			t.Errorf("%s: unexpected deliveries: %+v", remote.Username, deliveries)
+		}
+	}
+
+	// Accounts are listed in the order of their actor IDs, whose ports differ.
+	first, second := bob, carol
+	if carol.ActorID() < bob.ActorID() {
+		first, second = carol, bob
+	}
+
+	following := decode[ap.OrderedCollection[string]](t, serve(p, http.MethodGet, "/following", "", ""))
+	if want := []string{first.ActorID(), second.ActorID()}; !slices.Equal(following.OrderedItems, want) {
+		t.Errorf("expected following %q, got %q", want, following.OrderedItems)
+	}
+
+	// Importing again follows no one twice.
+	w = serve(a, http.MethodPost, "/users/"+p.user.Username+"/following", "admin-key", csv)
+	if result := decode[mastodon.Result](t, w); result.Following != 0 || result.ExistingFollowing != 2 {
+		t.Errorf("unexpected result of importing again: %+v", result)
+	}
+
+	w = serve(a, http.MethodGet, "/users/"+p.user.Username+"/following.csv", "admin-key", "")
+	if w.Code != http.StatusOK || w.Header().Get("Content-Type") != "text/csv; charset=utf-8" {
+		t.Fatalf("unexpected response: %d %q", w.Code, w.Header().Get("Content-Type"))
+	}
+
+	want := "Account address,Show boosts,Notify on new posts,Languages\n" +
+		first.Address() + ",true,false,\n" +
+		second.Address() + ",true,false,\n"
+	if w.Body.String() != want {
+		t.Errorf("expected %q, got %q", want, w.Body.String())
+	}
+
+	if w := serve(a, http.MethodGet, "/users/nobody/followers.csv", "admin-key", ""); w.Code != http.StatusNotFound {
+		t.Errorf("expected status 404 for an unknown user, got %d", w.Code)
+	}
+}
+
+func TestFederationRemoteFollow(t *testing.T) {
+	p := newTestPub(t)
+
+	wr, err := newWebRouter(context.Background(), testConfig, nil, nil)
+	if err != nil {
+		t.Fatalf("error creating web router: %v", err)
+	}
+
+	p.view = wr.view
+
+	// Servers at non-public addresses are not asked for visitors' accounts.
+	loopback := httptest.NewTLSServer(http.NotFoundHandler())
+	defer loopback.Close()
+
+	loopbackDomain := strings.TrimPrefix(loopback.URL, "https://")
+	if _, err := webfinger.SubscribeURL(context.Background(), "bob@"+loopbackDomain, p.site.ActorID(p.user)); !errors.Is(err, telemetry.ErrNonPublicAddress) {
+		t.Errorf("expected a loopback address to be refused, got %v", err)
+	}
+
+	bob := fedtest.NewServer(t, "bob")
+
+	// Domains must be hostnames, with an optional port.
+	for _, account := range []string{
+		"bob@" + bob.Domain() + "/path?",
+		"bob@" + bob.Domain() + "#",
+		"bob@user@" + bob.Domain(),
+		"bob@" + bob.Domain() + ":99999",
+		"bob@",
+		"@" + bob.Domain(),
+	} {
+		if _, err := webfinger.SubscribeURL(context.Background(), account, p.site.ActorID(p.user)); !errors.Is(err, webfinger.ErrInvalidAddress) {
+			t.Errorf("%q: expected an invalid address, got %v", account, err)
+		}
+
+		if w := serve(p, http.MethodGet, "/follow?account="+url.QueryEscape(account), "", ""); w.Code != http.StatusUnprocessableEntity {
+			t.Errorf("%q: expected status 422, got %d", account, w.Code)
+		}
+	}
+
+	// Visitors are sent to their server's subscribe URL for the actor.
+	w := serve(p, http.MethodGet, "/follow?account=@"+bob.Address(), "", "")
+	if w.Code != http.StatusSeeOther {
+		t.Fatalf("expected status 303, got %d: %s", w.Code, w.Body)
+	}
+
+	if want := "https://" + bob.Domain() + "/authorize_interaction?uri=https%3A%2F%2Fpub.example.com"; w.Header().Get("Location") != want {
+		t.Errorf("expected location %q, got %q", want, w.Header().Get("Location"))
+	}
+
+	// Accounts which cannot be followed from are shown the profile again.
+	w = serve(p, http.MethodGet, "/follow?account=nobody@"+bob.Domain(), "", "")
+	if w.Code != http.StatusUnprocessableEntity || w.Header().Get("Content-Type") != htmlContentType {
+		t.Fatalf("expected an HTML page with status 422, got %d %q", w.Code, w.Header().Get("Content-Type"))
+	}
+
+	if !strings.Contains(w.Body.String(), `value="nobody@`+bob.Domain()+`"`) || !strings.Contains(w.Body.String(), `role="alert"`) {
+		t.Errorf("expected the account and an error in %s", w.Body)
+	}
+
+	// Visitors are not sent to other hosts.
+	bob.SetSubscribeTemplate("https://elsewhere.example.com/authorize_interaction?uri={uri}")
+
+	if w := serve(p, http.MethodGet, "/follow?account="+bob.Address(), "", ""); w.Code != http.StatusUnprocessableEntity {
+		t.Errorf("expected status 422 for a template on another host, got %d: %s", w.Code, w.Header().Get("Location"))
+	}
+}
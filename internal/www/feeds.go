@@ -0,0 +1,61 @@
+package www
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/jclem/jclem.me/internal/telemetry"
+	"github.com/jclem/jclem.me/internal/websub"
+	"github.com/jclem/jclem.me/internal/www/config"
+	"github.com/jclem/jclem.me/internal/www/view"
+)
+
+// feedPaths are the paths of every feed advertised to the WebSub hub.
+var feedPaths = []string{rssPath, dispatchesRSSPath, linksRSSPath} //nolint:gochecknoglobals
+
+// A feedPublisher notifies the WebSub hub when feeds change.
+type feedPublisher struct {
+	// ctx is the server's root context. Feeds are published in the
+	// background, after the requests which changed them, so their
+	// notifications are cancelled only when the server stops.
+	ctx context.Context //nolint:containedctx
+
+	hub  string
+	view *view.Service
+}
+
+// newFeedPublisher creates a feed publisher for the configured hub. Feeds are
+// only published in production, where their URLs are public.
+func newFeedPublisher(ctx context.Context, cfg config.Config, view *view.Service) *feedPublisher {
+	p := &feedPublisher{ctx: ctx, view: view}
+	if cfg.IsProd() {
+		p.hub = cfg.WebSubHub
+	}
+
+	return p
+}
+
+// publish notifies the hub in the background that the feeds at the given paths
+// may have changed. It does nothing if there is no hub.
+func (p *feedPublisher) publish(paths ...string) {
+	if p == nil || p.hub == "" {
+		return
+	}
+
+	go func() {
+		ctx, cancel := context.WithTimeout(p.ctx, 10*time.Second)
+		defer cancel()
+
+		for _, path := range paths {
+			topic := p.view.URL(path)
+
+			if err := websub.Publish(ctx, telemetry.HTTPClient, p.hub, topic); err != nil {
+				slog.Error("error publishing feed to websub hub", "error", err, "topic", topic)
+				continue
+			}
+
+			slog.Info("published feed to websub hub", "topic", topic)
+		}
+	}()
+}
@@ -0,0 +1,20 @@
+package www
+
+import "net/http"
+
+// fragmentRequestHeader is the header with which the site's scripts, and htmx,
+// request a fragment of a page, to replace part of a page which is already
+// shown, rather than the whole page.
+//
+// SEE https://htmx.org/reference/#request_headers
+const fragmentRequestHeader = "HX-Request"
+
+// wantsFragment returns true if the request is for a fragment of a page. Since
+// the same URL responds with either the page or a fragment of it, the response
+// varies by the header, so that caches keep them apart. Requests to restore a
+// page from history are for the whole page.
+func wantsFragment(w http.ResponseWriter, r *http.Request) bool {
+	w.Header().Add("Vary", fragmentRequestHeader)
+
+	return r.Header.Get(fragmentRequestHeader) == "true" && r.Header.Get("HX-History-Restore-Request") != "true"
+}
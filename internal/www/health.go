@@ -0,0 +1,82 @@
+package www
+
+import (
+	"context"
+	"net/http"
+	"time"
+)
+
+// readinessTimeout bounds the time spent on all readiness checks.
+const readinessTimeout = 2 * time.Second
+
+// healthcheck reports that the process is alive. It does not check
+// dependencies, so that a database outage does not cause instances to be
+// restarted.
+func (*Server) healthcheck(w http.ResponseWriter, _ *http.Request) {
+	w.WriteHeader(http.StatusOK)
+}
+
+type readinessCheck struct {
+	Status   string `json:"status"`
+	Error    string `json:"error,omitempty"`
+	Duration string `json:"duration"`
+}
+
+type readinessResponse struct {
+	// Status is "ready" if the server is serving and every check passed,
+	// "starting" or "stopping" if the server is booting or shutting down, and
+	// "unhealthy" if a check failed.
+	Status string                    `json:"status"`
+	Checks map[string]readinessCheck `json:"checks"`
+}
+
+// readiness reports whether the server can serve traffic, checking the
+// database, the job client, and the embedded templates and assets.
+//
+// It responds with 503 Service Unavailable unless the server is ready.
+func (s *Server) readiness(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), readinessTimeout)
+	defer cancel()
+
+	checks := map[string]func(context.Context) error{
+		"jobs":      s.pub.CheckJobs,
+		"templates": func(context.Context) error { return s.view.Check() },
+	}
+
+	// There is no database to check if data is kept in memory.
+	if s.pool != nil {
+		checks["database"] = s.pool.Ping
+	}
+
+	resp := readinessResponse{Status: "ready", Checks: make(map[string]readinessCheck, len(checks))}
+
+	for name, check := range checks {
+		start := time.Now()
+		result := readinessCheck{Status: "ok"}
+
+		if err := check(ctx); err != nil {
+			result.Status = "error"
+			result.Error = err.Error()
+			resp.Status = "unhealthy"
+		}
+
+		result.Duration = time.Since(start).String()
+		resp.Checks[name] = result
+	}
+
+	switch s.state.Load() {
+	case serverStarting:
+		resp.Status = "starting"
+	case serverStopping:
+		resp.Status = "stopping"
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+
+	if resp.Status != "ready" {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+
+	writeResponse(w, r, resp)
+}
@@ -0,0 +1,97 @@
+package www
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+
+	ap "github.com/jclem/jclem.me/internal/activitypub"
+	"github.com/jclem/jclem.me/internal/activitypub/identity"
+	"github.com/jclem/jclem.me/internal/database"
+	"github.com/jclem/jclem.me/internal/mastodon"
+	"github.com/jclem/jclem.me/internal/storage"
+	"github.com/jclem/jclem.me/internal/webfinger"
+	"github.com/jclem/jclem.me/internal/www/config"
+)
+
+// ImportMastodon imports a Mastodon archive and a CSV file of followers, either
+// of which may be nil, as the given user's without starting the server.
+//
+// Imported notes are not delivered to followers. If storage is not configured,
+// the archive's media is not imported.
+func ImportMastodon(ctx context.Context, cfg config.Config, username string, archive fs.FS, followers io.Reader) (mastodon.Result, error) {
+	pool, err := database.NewPool(ctx, cfg)
+	if err != nil {
+		return mastodon.Result{}, fmt.Errorf("failed to connect to database: %w", err)
+	}
+
+	defer pool.Close()
+
+	id, err := identity.NewService(pool)
+	if err != nil {
+		return mastodon.Result{}, fmt.Errorf("error creating identity service: %w", err)
+	}
+
+	pub, err := ap.NewService(cfg, pool, id, ap.WithoutWorkers())
+	if err != nil {
+		return mastodon.Result{}, fmt.Errorf("error creating activitypub service: %w", err)
+	}
+
+	var media mastodon.Uploader
+
+	spaces, err := newStorage(cfg)
+	if err == nil {
+		media = spaces
+	} else if !errors.Is(err, storage.ErrNotConfigured) {
+		return mastodon.Result{}, fmt.Errorf("error creating storage client: %w", err)
+	}
+
+	user, err := id.GetUserByUsername(ctx, username)
+	if err != nil {
+		return mastodon.Result{}, fmt.Errorf("error getting user: %w", err)
+	}
+
+	result, err := mastodon.New(pub, media, webfinger.ResolveActor).Import(ctx, user, archive, followers)
+	if err != nil {
+		return result, fmt.Errorf("error importing archive: %w", err)
+	}
+
+	return result, nil
+}
+
+// ImportFollowing sends a Follow from the given user to each account listed in
+// a CSV file of follows, such as one Mastodon exports, which the user does not
+// already follow, without starting the server. The Follows are delivered once
+// the server works its jobs.
+func ImportFollowing(ctx context.Context, cfg config.Config, username string, following io.Reader) (mastodon.Result, error) {
+	pool, err := database.NewPool(ctx, cfg)
+	if err != nil {
+		return mastodon.Result{}, fmt.Errorf("failed to connect to database: %w", err)
+	}
+
+	defer pool.Close()
+
+	id, err := identity.NewService(pool)
+	if err != nil {
+		return mastodon.Result{}, fmt.Errorf("error creating identity service: %w", err)
+	}
+
+	pub, err := ap.NewService(cfg, pool, id, ap.WithoutWorkers())
+	if err != nil {
+		return mastodon.Result{}, fmt.Errorf("error creating activitypub service: %w", err)
+	}
+
+	user, err := id.GetUserByUsername(ctx, username)
+	if err != nil {
+		return mastodon.Result{}, fmt.Errorf("error getting user: %w", err)
+	}
+
+	result, err := mastodon.New(pub, nil, webfinger.ResolveActor).ImportFollowing(ctx, user, following)
+	if err != nil {
+		return result, fmt.Errorf("error importing following: %w", err)
+	}
+
+	return result, nil
+}
@@ -0,0 +1,100 @@
+package www
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	ap "github.com/jclem/jclem.me/internal/activitypub"
+	"github.com/jclem/jclem.me/internal/mastodon"
+)
+
+const testOutbox = `{
+	"orderedItems": [
+		{
+			"type": "Create",
+			"actor": "https://mastodon.example.com/users/alice",
+			"object": {
+				"id": "https://mastodon.example.com/users/alice/statuses/1",
+				"type": "Note",
+				"content": "<p>Old news</p>",
+				"published": "2022-11-05T12:00:00Z",
+				"to": ["https://www.w3.org/ns/activitystreams#Public"],
+				"cc": ["https://mastodon.example.com/users/alice/followers"]
+			}
+		},
+		{
+			"type": "Create",
+			"actor": "https://mastodon.example.com/users/alice",
+			"object": {
+				"id": "https://mastodon.example.com/users/alice/statuses/2",
+				"type": "Note",
+				"content": "<p>Secret</p>",
+				"published": "2022-11-06T12:00:00Z",
+				"to": ["https://mastodon.example.com/users/bob"],
+				"cc": []
+			}
+		},
+		{
+			"type": "Announce",
+			"actor": "https://mastodon.example.com/users/alice",
+			"object": "https://mastodon.example.com/users/bob/statuses/3"
+		}
+	]
+}`
+
+func TestImportMastodon(t *testing.T) {
+	p := newTestPub(t)
+	ctx := context.Background()
+
+	resolve := func(_ context.Context, address string) (string, error) {
+		if address == "bob@remote.example.com" {
+			return "https://remote.example.com/users/bob", nil
+		}
+
+		return "", errors.New("not found")
+	}
+
+	importer := mastodon.New(p.pub, nil, resolve)
+	archive := fstest.MapFS{mastodon.OutboxFile: {Data: []byte(testOutbox)}}
+	followers := "Account address,Show boosts\nbob@remote.example.com,true\nnobody@gone.example.com,true\n"
+
+	result, err := importer.Import(ctx, p.user, archive, strings.NewReader(followers))
+	if err != nil {
+		t.Fatalf("error importing: %v", err)
+	}
+
+	if want := (mastodon.Result{Notes: 1, Skipped: 2, Followers: 1, UnresolvedFollowers: 1}); result != want {
+		t.Errorf("expected %+v, got %+v", want, result)
+	}
+
+	// Importing again finds the notes which were imported before.
+	if result, err := importer.Import(ctx, p.user, archive, nil); err != nil || result.Notes != 0 || result.Existing != 1 {
+		t.Errorf("unexpected result of importing again: %+v, %v", result, err)
+	}
+
+	if _, err := publishNote(ctx, p.pub, p.user, "New news", []string{ap.PublicNS}, nil); err != nil {
+		t.Fatalf("error publishing note: %v", err)
+	}
+
+	// The imported note keeps its published time and is addressed to the
+	// user's followers, and is ordered before notes published since.
+	page := decode[ap.OrderedCollectionPage[ap.Activity[ap.Note]]](t, serve(p, http.MethodGet, "/outbox?page=1", "", ""))
+	if len(page.OrderedItems) != 2 {
+		t.Fatalf("expected 2 outbox items, got %d", len(page.OrderedItems))
+	}
+
+	imported := page.OrderedItems[1].Object
+	if imported.Content != "<p>Old news</p>" || imported.Published != "Sat, 05 Nov 2022 12:00:00 GMT" || imported.Cc[0] != p.site.ActorFollowers(p.user) {
+		t.Errorf("unexpected imported note: %+v", imported)
+	}
+
+	records, err := p.pub.ListFollowers(ctx, p.user.ID)
+	if err != nil || len(records) != 1 || records[0].ActorID != "https://remote.example.com/users/bob" {
+		t.Errorf("unexpected followers: %+v, %v", records, err)
+	}
+
+}
@@ -0,0 +1,220 @@
+package www
+
+import (
+	"context"
+	"expvar"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/go-chi/httplog/v2"
+	"github.com/jclem/jclem.me/internal/ratelimit"
+)
+
+// maxInboxBytes is the largest activity which an inbox accepts. Activities are
+// rarely more than a few kilobytes, since attachments are linked rather than
+// embedded, so a larger one is likely abuse.
+const maxInboxBytes = 256 << 10
+
+// inboxBanWindow is how long an IP address's rejected inbox requests count
+// toward banning it.
+const inboxBanWindow = 10 * time.Minute
+
+// inboxRejections counts inbox requests which were rejected, by reason. It is
+// served with the other expvar variables on the debug port.
+var inboxRejections = expvar.NewMap("inbox_rejections") //nolint:gochecknoglobals
+
+// inboxRejectionReasons name the responses to inbox requests which are counted
+// as rejections. Inbox handlers may give a more specific reason with
+// setRejectionReason.
+//
+//nolint:gochecknoglobals
+var inboxRejectionReasons = map[int]string{
+	http.StatusBadRequest:            "malformed",
+	http.StatusUnauthorized:          "invalid_signature",
+	http.StatusRequestEntityTooLarge: "too_large",
+	http.StatusTooManyRequests:       "rate_limited",
+}
+
+// keyUnavailable is the reason for rejecting an activity whose signing key
+// could not be fetched, such as a Delete of an actor which is gone.
+const keyUnavailable = "key_unavailable"
+
+// inboxStrikeReasons are the rejections which count toward banning an IP
+// address: those of requests which are malformed, too large, or signed with
+// keys which do not verify them. Requests which are rate limited, or whose keys
+// could not be fetched, are not the sender's fault, and busy shared servers
+// would otherwise be banned for them.
+//
+//nolint:gochecknoglobals
+var inboxStrikeReasons = map[string]bool{
+	"malformed":         true,
+	"invalid_signature": true,
+	"too_large":         true,
+}
+
+// rejectionReasonKey is the context key of the reason an inbox handler gives
+// for rejecting a request.
+type rejectionReasonKey struct{}
+
+// setRejectionReason gives the reason an inbox request was rejected, if its
+// status does not.
+func setRejectionReason(r *http.Request, reason string) {
+	if p, ok := r.Context().Value(rejectionReasonKey{}).(*string); ok {
+		*p = reason
+	}
+}
+
+// An inboxGuard protects inboxes from abusive senders. Requests are limited
+// per IP address, and activities per actor and in size. An IP address whose
+// requests are rejected for inboxStrikeReasons banThreshold times within
+// inboxBanWindow is banned from inboxes for banDuration.
+type inboxGuard struct {
+	ips    *ratelimit.Limiter
+	actors *ratelimit.Limiter
+
+	banThreshold int
+	banDuration  time.Duration
+
+	mu      sync.Mutex
+	strikes map[string]strikes
+	bans    map[string]time.Time
+	swept   time.Time
+	now     func() time.Time
+}
+
+// strikes are an IP address's rejected requests since a time.
+type strikes struct {
+	count int
+	since time.Time
+}
+
+// newInboxGuard creates a guard limiting requests per IP address with ips, which
+// may be nil for no limit, and allowing perActor activities per minute, or any
+// number if it is zero. It bans IP addresses after banThreshold rejections, or
+// never if it is zero.
+func newInboxGuard(ips *ratelimit.Limiter, perActor, banThreshold int, banDuration time.Duration) *inboxGuard {
+	return &inboxGuard{
+		ips:          ips,
+		actors:       newLimiter(perActor),
+		banThreshold: banThreshold,
+		banDuration:  banDuration,
+		strikes:      map[string]strikes{},
+		bans:         map[string]time.Time{},
+		now:          time.Now,
+	}
+}
+
+// protect rejects requests from banned IP addresses, limits the rate and size
+// of the rest, and counts those which are rejected, by this or by the inbox.
+func (g *inboxGuard) protect(next http.Handler) http.Handler {
+	limited := rateLimit(g.ips, byIP)(limitBody(maxInboxBytes)(next))
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ip := byIP(r)
+
+		if remaining := g.banned(ip); remaining > 0 {
+			inboxRejections.Add("banned", 1)
+
+			w.Header().Set("Retry-After", strconv.Itoa(ceilSeconds(remaining)))
+			returnProblem(r.Context(), w, problem{Type: problemTypeRateLimited, Status: http.StatusTooManyRequests, Detail: "too many rejected requests"})
+
+			return
+		}
+
+		if r.ContentLength > maxInboxBytes {
+			g.reject(r, ip, inboxRejectionReasons[http.StatusRequestEntityTooLarge])
+			returnProblem(r.Context(), w, problem{Status: http.StatusRequestEntityTooLarge, Detail: "request body is too large"})
+
+			return
+		}
+
+		var reason string
+
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+		limited.ServeHTTP(ww, r.WithContext(context.WithValue(r.Context(), rejectionReasonKey{}, &reason)))
+
+		if reason == "" {
+			reason = inboxRejectionReasons[ww.Status()]
+		}
+
+		if reason != "" {
+			g.reject(r, ip, reason)
+		}
+	})
+}
+
+// allowActor takes a token from an actor's bucket, or, if there is none,
+// responds that the actor is rate limited and returns false.
+func (g *inboxGuard) allowActor(w http.ResponseWriter, r *http.Request, actor string) bool {
+	return allow(w, r, g.actors, "actor:"+actor)
+}
+
+// banned returns how much longer an IP address is banned, or zero if it is not.
+func (g *inboxGuard) banned(ip string) time.Duration {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	until, ok := g.bans[ip]
+	if !ok {
+		return 0
+	}
+
+	return max(until.Sub(g.now()), 0)
+}
+
+// reject counts a rejected request, and, if it was rejected for a reason which
+// counts toward banning, bans its IP address if it has made too many.
+func (g *inboxGuard) reject(r *http.Request, ip string, reason string) {
+	inboxRejections.Add(reason, 1)
+
+	if g.banThreshold == 0 || !inboxStrikeReasons[reason] {
+		return
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	now := g.now()
+	g.sweep(now)
+
+	s := g.strikes[ip]
+	if now.Sub(s.since) >= inboxBanWindow {
+		s = strikes{since: now}
+	}
+
+	s.count++
+	g.strikes[ip] = s
+
+	if s.count >= g.banThreshold {
+		g.bans[ip] = now.Add(g.banDuration)
+		delete(g.strikes, ip)
+
+		oplog := httplog.LogEntry(r.Context())
+		oplog.WarnContext(r.Context(), "banned inbox sender", "ip", ip, "duration", g.banDuration)
+	}
+}
+
+// sweep forgets expired strikes and bans, at most once per inboxBanWindow, so
+// that they do not grow without bound. The lock must be held.
+func (g *inboxGuard) sweep(now time.Time) {
+	if now.Sub(g.swept) < inboxBanWindow {
+		return
+	}
+
+	for ip, s := range g.strikes {
+		if now.Sub(s.since) >= inboxBanWindow {
+			delete(g.strikes, ip)
+		}
+	}
+
+	for ip, until := range g.bans {
+		if !now.Before(until) {
+			delete(g.bans, ip)
+		}
+	}
+
+	g.swept = now
+}
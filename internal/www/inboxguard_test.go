@@ -0,0 +1,110 @@
+package www
+
+import (
+	"expvar"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestInboxGuard(t *testing.T) {
+	g := newInboxGuard(newLimiter(100), 1, 3, time.Hour)
+
+	now := time.Now()
+	g.now = func() time.Time { return now }
+
+	inbox := g.protect(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Has("unsigned") {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		if r.URL.Query().Has("gone") {
+			setRejectionReason(r, keyUnavailable)
+			w.WriteHeader(http.StatusUnauthorized)
+
+			return
+		}
+
+		if !g.allowActor(w, r, "https://remote.example/actor") {
+			return
+		}
+
+		w.WriteHeader(http.StatusAccepted)
+	}))
+
+	post := func(target, ip, body string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodPost, target, strings.NewReader(body))
+		r.RemoteAddr = ip + ":1234"
+
+		w := httptest.NewRecorder()
+		inbox.ServeHTTP(w, r)
+
+		return w
+	}
+
+	rejections := func(reason string) int64 {
+		if v, ok := inboxRejections.Get(reason).(*expvar.Int); ok {
+			return v.Value()
+		}
+
+		return 0
+	}
+
+	unsigned, gone := rejections("invalid_signature"), rejections(keyUnavailable)
+
+	if w := post("/inbox", "192.0.2.1", "{}"); w.Code != http.StatusAccepted {
+		t.Errorf("expected the first activity to be accepted, got %d", w.Code)
+	}
+
+	if w := post("/inbox", "192.0.2.1", "{}"); w.Code != http.StatusTooManyRequests {
+		t.Errorf("expected the actor's second activity to be rate limited, got %d", w.Code)
+	}
+
+	if w := post("/inbox", "192.0.2.1", strings.Repeat(" ", maxInboxBytes+1)); w.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("expected a large activity to be rejected, got %d", w.Code)
+	}
+
+	if w := post("/inbox?unsigned", "192.0.2.1", "{}"); w.Code != http.StatusUnauthorized {
+		t.Errorf("expected an unsigned activity to be rejected, got %d", w.Code)
+	}
+
+	if n := rejections("invalid_signature") - unsigned; n != 1 {
+		t.Errorf("expected 1 unsigned activity to be counted, got %d", n)
+	}
+
+	// Rate limits do not count toward bans, so it is the third other rejection
+	// which bans the address.
+	if w := post("/inbox?unsigned", "192.0.2.1", "{}"); w.Code != http.StatusUnauthorized {
+		t.Errorf("expected an unsigned activity to be rejected, got %d", w.Code)
+	}
+
+	w := post("/inbox?unsigned", "192.0.2.1", "{}")
+	if w.Code != http.StatusTooManyRequests || w.Header().Get("Retry-After") != "3600" {
+		t.Errorf("expected a banned address to be refused for an hour, got %d with Retry-After %q", w.Code, w.Header().Get("Retry-After"))
+	}
+
+	if w := post("/inbox?unsigned", "192.0.2.2", "{}"); w.Code != http.StatusUnauthorized {
+		t.Errorf("expected another address not to be banned, got %d", w.Code)
+	}
+
+	now = now.Add(time.Hour)
+
+	if w := post("/inbox?unsigned", "192.0.2.1", "{}"); w.Code != http.StatusUnauthorized {
+		t.Errorf("expected the ban to expire, got %d", w.Code)
+	}
+
+	// Activities whose keys could not be fetched are counted, but not toward
+	// bans.
+	for i := 0; i < 5; i++ {
+		if w := post("/inbox?gone", "192.0.2.3", "{}"); w.Code != http.StatusUnauthorized {
+			t.Fatalf("expected an activity whose key is gone to be rejected but not banned, got %d", w.Code)
+		}
+	}
+
+	if n := rejections(keyUnavailable) - gone; n != 5 {
+		t.Errorf("expected 5 activities whose keys are gone to be counted, got %d", n)
+	}
+}
@@ -0,0 +1,91 @@
+package www
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+)
+
+// maxBodyBytes is the largest request body which is read, other than a
+// dispatch's upload, which is limited by maxUploadBytes. It is far larger than
+// any JSON or form which the server takes.
+const maxBodyBytes = 1 << 20
+
+// webfingerTimeout is how long handling a WebFinger request may take. Lookups
+// are only of users, so one which takes longer is failing.
+const webfingerTimeout = 2 * time.Second
+
+// limitBody limits the request body to n bytes. Reading more fails with an
+// *http.MaxBytesError, to which handlers respond with returnBodyError.
+func limitBody(n int64) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			r.Body = http.MaxBytesReader(w, r.Body, n)
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// extendDeadlines gives reading the request, and responding to it, d from now,
+// replacing the server's read and write timeouts, which are too short for
+// requests such as uploads and exports.
+func extendDeadlines(d time.Duration) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			rc := http.NewResponseController(w)
+			deadline := time.Now().Add(d)
+
+			if err := errors.Join(rc.SetReadDeadline(deadline), rc.SetWriteDeadline(deadline)); err != nil && !errors.Is(err, http.ErrNotSupported) {
+				logError(r.Context(), err, "error extending deadlines")
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// timeout responds with a 503 problem if handling the request takes longer than
+// d, and cancels its context. The response is buffered until the handler
+// returns, so it must not be used for streams.
+func timeout(d time.Duration) func(http.Handler) http.Handler {
+	body, _ := json.Marshal(problem{ //nolint:errchkjson
+		Type:   problemTypeBlank,
+		Title:  http.StatusText(http.StatusServiceUnavailable),
+		Status: http.StatusServiceUnavailable,
+		Detail: "request timed out",
+	})
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			// The handler writes its headers to a buffer, which replaces those
+			// already set, such as by activityPubContent, only once it returns.
+			// Those already set are copied to the buffer, and a response which
+			// times out is described as a problem instead.
+			contentType := w.Header().Get("Content-Type")
+			w.Header().Set("Content-Type", problemContentType)
+
+			buffered := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if contentType != "" {
+					w.Header().Set("Content-Type", contentType)
+				}
+
+				next.ServeHTTP(w, r)
+			})
+
+			http.TimeoutHandler(buffered, d, string(body)).ServeHTTP(w, r)
+		})
+	}
+}
+
+// returnBodyError responds to an error reading the request body: 413 if the
+// body is larger than its limit, or else 400 with the given detail.
+func returnBodyError(ctx context.Context, w http.ResponseWriter, err error, detail string) {
+	if errors.As(err, new(*http.MaxBytesError)) {
+		returnProblem(ctx, w, problem{Status: http.StatusRequestEntityTooLarge, Detail: "request body is too large"})
+		return
+	}
+
+	returnBadRequest(ctx, w, detail)
+}
@@ -0,0 +1,59 @@
+package www
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBodyLimits(t *testing.T) {
+	a, p := newTestAdmin(t)
+
+	large := `{"username":"` + strings.Repeat("a", maxBodyBytes) + `"}`
+
+	if w := serve(p, http.MethodPost, "/inbox", "", large); w.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("expected status 413 for a large activity, got %d", w.Code)
+	}
+
+	if w := serve(a, http.MethodPost, "/users", "admin-key", large); w.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("expected status 413 for a large user, got %d", w.Code)
+	}
+
+	// Dispatches may be larger, since they may have images.
+	if w := serve(a, http.MethodPost, "/dispatches", "admin-key", `{"body":"`+strings.Repeat("a", maxBodyBytes)+`"}`); w.Code == http.StatusRequestEntityTooLarge {
+		t.Errorf("expected a large dispatch to be read, got status %d", w.Code)
+	}
+}
+
+func TestTimeout(t *testing.T) {
+	withType := func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/jrd+json")
+			next.ServeHTTP(w, r)
+		})
+	}
+
+	fast := withType(timeout(time.Second)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("{}")) //nolint:errcheck
+	})))
+
+	w := httptest.NewRecorder()
+	fast.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	if w.Code != http.StatusOK || w.Header().Get("Content-Type") != "application/jrd+json" {
+		t.Errorf("expected a 200 JRD response, got %d %s", w.Code, w.Header().Get("Content-Type"))
+	}
+
+	slow := withType(timeout(time.Millisecond)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	})))
+
+	w = httptest.NewRecorder()
+	slow.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	if w.Code != http.StatusServiceUnavailable || w.Header().Get("Content-Type") != problemContentType {
+		t.Errorf("expected a 503 problem, got %d %s", w.Code, w.Header().Get("Content-Type"))
+	}
+}
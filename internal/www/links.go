@@ -0,0 +1,52 @@
+package www
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jclem/jclem.me/internal/database"
+	"github.com/jclem/jclem.me/internal/linkcheck"
+	"github.com/jclem/jclem.me/internal/www/config"
+)
+
+// checkLinks checks the links in every published post.
+func (wr *webRouter) checkLinks(ctx context.Context) linkcheck.Report {
+	list := wr.posts.List()
+	pages := make([]linkcheck.Page, 0, len(list))
+
+	for _, post := range list {
+		pages = append(pages, linkcheck.Page{
+			Path:    "/writing/" + post.Slug,
+			Content: string(post.Content),
+		})
+	}
+
+	return linkcheck.NewChecker(wr, wr.cfg.URLHostname()).Check(ctx, pages)
+}
+
+// CheckLinks checks the links in every published post without starting the
+// server. The database is only used if database posts are enabled.
+func CheckLinks(ctx context.Context, cfg config.Config) (linkcheck.Report, error) {
+	if !cfg.DatabasePosts {
+		wr, err := newWebRouter(ctx, cfg, nil, nil)
+		if err != nil {
+			return linkcheck.Report{}, fmt.Errorf("error creating web router: %w", err)
+		}
+
+		return wr.checkLinks(ctx), nil
+	}
+
+	pool, err := database.NewPool(ctx, cfg)
+	if err != nil {
+		return linkcheck.Report{}, fmt.Errorf("failed to connect to database: %w", err)
+	}
+
+	defer pool.Close()
+
+	wr, err := newWebRouter(ctx, cfg, pool, nil)
+	if err != nil {
+		return linkcheck.Report{}, fmt.Errorf("error creating web router: %w", err)
+	}
+
+	return wr.checkLinks(ctx), nil
+}
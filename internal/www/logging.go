@@ -0,0 +1,130 @@
+package www
+
+import (
+	"bytes"
+	"io"
+	"log/slog"
+	"math/rand"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/go-chi/httplog/v2"
+	"github.com/jclem/jclem.me/internal/analytics"
+)
+
+// redactedHeaders are request and response headers whose values are not
+// logged, since they are credentials, or, like signatures, could be replayed.
+// httplog also redacts cookies.
+//
+//nolint:gochecknoglobals
+var redactedHeaders = []string{"Authorization", "Proxy-Authorization", "Signature"}
+
+// maxLoggedBodyBytes is the most of a request's body which is logged.
+const maxLoggedBodyBytes = 16 << 10
+
+func newLogger(name string, prodLogger bool, w io.Writer) *httplog.Logger {
+	return httplog.NewLogger(name, httplog.Options{
+		JSON:            prodLogger,
+		LogLevel:        slog.LevelInfo,
+		Concise:         prodLogger,
+		RequestHeaders:  prodLogger,
+		ResponseHeaders: prodLogger,
+		// httplog lowercases these in place.
+		HideRequestHeaders: slices.Clone(redactedHeaders),
+		Writer:             w,
+	})
+}
+
+// requestLogger logs each request, except that only crawlerSampleRate of
+// crawlers' requests are logged, so that they don't flood the logs. The
+// requests of crawlers which aren't logged are still given a logger, with
+// which handlers log errors, and are logged if they fail with a server error.
+func requestLogger(logger *httplog.Logger, crawlerSampleRate float64) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		logged := httplog.RequestLogger(logger)(next)
+		unlogged := chi.Chain(middleware.RequestID, logFailures(logger), middleware.Recoverer).Handler(next)
+
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if analytics.IsBot(r.UserAgent()) && rand.Float64() >= crawlerSampleRate { //nolint:gosec
+				unlogged.ServeHTTP(w, r)
+				return
+			}
+
+			logged.ServeHTTP(w, r)
+		})
+	}
+}
+
+// logFailures gives each request a logger, like httplog's, but only logs the
+// request if it fails with a server error, such as after a panic.
+func logFailures(logger *httplog.Logger) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			entry := &httplog.RequestLoggerEntry{
+				Logger: *logger.Logger.With(slog.Group("httpRequest",
+					slog.String("method", r.Method),
+					slog.String("path", r.URL.Path),
+					slog.String("remoteIP", r.RemoteAddr),
+					slog.String("requestID", middleware.GetReqID(r.Context())),
+					slog.String("userAgent", r.UserAgent()),
+				)),
+				Options: logger.Options,
+			}
+
+			ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+			start := time.Now()
+
+			next.ServeHTTP(ww, middleware.WithLogEntry(r, entry))
+
+			if ww.Status() >= http.StatusInternalServerError {
+				entry.Write(ww.Status(), ww.BytesWritten(), ww.Header(), time.Since(start), nil)
+			}
+		})
+	}
+}
+
+// logRequestBodies logs the bodies of requests, as far as handlers read them,
+// up to maxLoggedBodyBytes, such as to debug the activities which other
+// servers deliver.
+func logRequestBodies(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Body == nil || r.Body == http.NoBody {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		body := &loggedBody{ReadCloser: r.Body}
+		r.Body = body
+
+		next.ServeHTTP(w, r)
+
+		if body.buf.Len() > 0 {
+			oplog := httplog.LogEntry(r.Context())
+			oplog.InfoContext(r.Context(), "request body",
+				"content_type", r.Header.Get("Content-Type"),
+				"body", body.buf.String(),
+				"truncated", body.truncated,
+			)
+		}
+	})
+}
+
+// A loggedBody keeps the first maxLoggedBodyBytes read from a request's body.
+type loggedBody struct {
+	io.ReadCloser
+	buf       bytes.Buffer
+	truncated bool
+}
+
+func (b *loggedBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+
+	keep := min(n, maxLoggedBodyBytes-b.buf.Len())
+	b.buf.Write(p[:keep])
+	b.truncated = b.truncated || keep < n
+
+	return n, err //nolint:wrapcheck
+}
@@ -0,0 +1,69 @@
+package www
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRequestLogger(t *testing.T) {
+	var buf bytes.Buffer
+
+	log := requestLogger(newLogger("test", true, &buf), 0)
+
+	handler := log(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/fail" {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+
+	serveAs := func(path, userAgent string) {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.Header.Set("User-Agent", userAgent)
+		req.Header.Set("Signature", `keyId="https://example.com/actor#main-key",signature="secret"`)
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	serveAs("/person", "Mozilla/5.0")
+
+	if !strings.Contains(buf.String(), `"/person"`) {
+		t.Errorf("expected a person's request to be logged, got %q", buf.String())
+	}
+
+	if strings.Contains(buf.String(), "secret") {
+		t.Errorf("expected the signature to be redacted, got %q", buf.String())
+	}
+
+	buf.Reset()
+	serveAs("/crawler", "Googlebot/2.1")
+
+	if buf.Len() != 0 {
+		t.Errorf("expected a crawler's request not to be logged, got %q", buf.String())
+	}
+
+	serveAs("/fail", "Googlebot/2.1")
+
+	if !strings.Contains(buf.String(), `"/fail"`) {
+		t.Errorf("expected a crawler's failed request to be logged, got %q", buf.String())
+	}
+}
+
+func TestLogRequestBodies(t *testing.T) {
+	var buf bytes.Buffer
+
+	log := requestLogger(newLogger("test", true, &buf), 1)
+
+	handler := log(logRequestBodies(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.Copy(io.Discard, r.Body) //nolint:errcheck
+	})))
+
+	body := `{"type":"Follow"}` + strings.Repeat(" ", maxLoggedBodyBytes)
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/inbox", strings.NewReader(body)))
+
+	if !strings.Contains(buf.String(), `{\"type\":\"Follow\"}`) || !strings.Contains(buf.String(), `"truncated":true`) {
+		t.Errorf("expected the truncated body to be logged, got %q", buf.String())
+	}
+}
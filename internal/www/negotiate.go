@@ -0,0 +1,114 @@
+package www
+
+import (
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+
+	ap "github.com/jclem/jclem.me/internal/activitypub"
+)
+
+const (
+	// ldJSONContentType is the JSON-LD content type with the ActivityStreams
+	// profile, which ActivityPub servers must serve to clients which ask for
+	// it.
+	//
+	// SEE https://www.w3.org/TR/activitypub/#retrieving-objects
+	ldJSONContentType = `application/ld+json; profile="https://www.w3.org/ns/activitystreams"`
+
+	// htmlContentType is the content type of pages.
+	htmlContentType = "text/html; charset=utf-8"
+
+	// jsonContentType is the content type with which ActivityPub documents are
+	// shown to browsers, which display it rather than downloading it.
+	jsonContentType = "application/json; charset=utf-8"
+)
+
+// negotiate returns the offered content type which the request's Accept header
+// prefers, by its quality values and then the order of offers, or the first
+// offer if it has no Accept header. It returns "" if none is acceptable.
+func negotiate(r *http.Request, offers ...string) string {
+	accept := r.Header.Get("Accept")
+	if accept == "" {
+		return offers[0]
+	}
+
+	best, bestQ := "", 0.0
+
+	for _, offer := range offers {
+		offerType, _, err := mime.ParseMediaType(offer)
+		if err != nil {
+			continue
+		}
+
+		if q := acceptQuality(accept, offerType); q > bestQ {
+			best, bestQ = offer, q
+		}
+	}
+
+	return best
+}
+
+// acceptQuality returns the quality value which an Accept header gives a media
+// type, from its most specific matching range, or zero if none matches.
+func acceptQuality(accept, mediaType string) float64 {
+	quality, specificity := 0.0, -1
+
+	for _, part := range strings.Split(accept, ",") {
+		rangeType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+
+		var s int
+
+		switch {
+		case rangeType == mediaType:
+			s = 2
+		case strings.HasSuffix(rangeType, "/*") && strings.HasPrefix(mediaType, strings.TrimSuffix(rangeType, "*")):
+			s = 1
+		case rangeType == "*/*":
+			s = 0
+		default:
+			continue
+		}
+
+		if s <= specificity {
+			continue
+		}
+
+		q := 1.0
+		if v, ok := params["q"]; ok {
+			if parsed, err := strconv.ParseFloat(v, 64); err == nil {
+				q = parsed
+			}
+		}
+
+		quality, specificity = q, s
+	}
+
+	return quality
+}
+
+// activityPubContent sets the content type of ActivityPub documents to the one
+// the client asks for: ActivityStreams JSON-LD, ActivityPub JSON, or, for
+// browsers, which prefer HTML, plain JSON, which they display. Clients which
+// accept none of them are also sent ActivityPub JSON. Handlers which render
+// pages for browsers, such as profiles, set their own content type.
+func activityPubContent(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Vary", "Accept")
+
+		switch negotiate(r, ap.ContentType, ldJSONContentType, htmlContentType) {
+		case ldJSONContentType:
+			w.Header().Set("Content-Type", ldJSONContentType)
+		case htmlContentType:
+			w.Header().Set("Content-Type", jsonContentType)
+		default:
+			w.Header().Set("Content-Type", ap.ContentType)
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,68 @@
+package www
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	ap "github.com/jclem/jclem.me/internal/activitypub"
+)
+
+func TestNegotiate(t *testing.T) {
+	offers := []string{ap.ContentType, ldJSONContentType, htmlContentType}
+
+	for _, tc := range []struct{ accept, want string }{
+		{"", ap.ContentType},
+		{"application/activity+json", ap.ContentType},
+		{"application/ld+json", ldJSONContentType},
+		{`application/ld+json; profile="https://www.w3.org/ns/activitystreams"`, ldJSONContentType},
+		{"application/activity+json, application/ld+json", ap.ContentType},
+		{"application/activity+json;q=0.5, application/ld+json", ldJSONContentType},
+		{"text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8", htmlContentType},
+		{"application/*, text/html;q=0.1", ap.ContentType},
+		{"*/*", ap.ContentType},
+		{"text/*, application/ld+json;q=0", htmlContentType},
+		{"image/png", ""},
+	} {
+		accept, want := tc.accept, tc.want
+
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		if accept != "" {
+			r.Header.Set("Accept", accept)
+		}
+
+		if got := negotiate(r, offers...); got != want {
+			t.Errorf("%q: expected %q, got %q", accept, want, got)
+		}
+	}
+}
+
+func TestActivityPubContentType(t *testing.T) {
+	p := newTestPub(t)
+
+	for accept, want := range map[string]string{
+		"application/activity+json": ap.ContentType,
+		"application/ld+json":       ldJSONContentType,
+		"text/html":                 jsonContentType,
+		"image/png":                 ap.ContentType,
+	} {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.Header.Set("Accept", accept)
+
+		w := httptest.NewRecorder()
+		p.ServeHTTP(w, r)
+
+		if ct := w.Header().Get("Content-Type"); ct != want {
+			t.Errorf("%q: expected content type %q, got %q", accept, want, ct)
+		}
+
+		if vary := w.Header().Values("Vary"); len(vary) == 0 || vary[0] != "Accept" {
+			t.Errorf("%q: expected responses to vary by Accept, got %q", accept, vary)
+		}
+	}
+
+	// Errors are described as problems, whatever was asked for.
+	if w := serve(p, http.MethodGet, "/notes/missing", "", ""); w.Header().Get("Content-Type") != problemContentType {
+		t.Errorf("expected a problem, got %q", w.Header().Get("Content-Type"))
+	}
+}
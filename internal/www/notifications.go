@@ -0,0 +1,98 @@
+package www
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+
+	ap "github.com/jclem/jclem.me/internal/activitypub"
+	"github.com/jclem/jclem.me/internal/activitypub/identity"
+	"github.com/jclem/jclem.me/internal/database"
+)
+
+// notificationsPageSize is the number of notifications on each page of a
+// user's notifications.
+const notificationsPageSize = 40
+
+type listNotificationsResponse struct {
+	Notifications []ap.NotificationRecord `json:"notifications"`
+
+	// Total is how many notifications there are in all, or, if only unread
+	// notifications were asked for, how many are unread.
+	Total int `json:"total"`
+}
+
+// listNotifications serves a page of the user's notifications, most recent
+// first. With unread=true, only unread notifications are listed.
+func (p *pubRouter) listNotifications(w http.ResponseWriter, r *http.Request) {
+	user := r.Context().Value(userContextKey).(identity.User) //nolint:forceTypeAssert
+	query := r.URL.Query()
+
+	page := 1
+
+	if param := query.Get("page"); param != "" {
+		var err error
+		if page, err = strconv.Atoi(param); err != nil || page < 1 {
+			returnValidationError(r.Context(), w, "invalid query", fieldError{Field: "page", Message: "must be a positive integer"})
+			return
+		}
+	}
+
+	unread := false
+
+	if param := query.Get("unread"); param != "" {
+		var err error
+		if unread, err = strconv.ParseBool(param); err != nil {
+			returnValidationError(r.Context(), w, "invalid query", fieldError{Field: "unread", Message: "must be true or false"})
+			return
+		}
+	}
+
+	notifications, total, err := p.pub.ListNotifications(r.Context(), user.ID, unread, notificationsPageSize, (page-1)*notificationsPageSize)
+	if err != nil {
+		returnError(r.Context(), w, err, "error listing notifications")
+		return
+	}
+
+	if notifications == nil {
+		notifications = []ap.NotificationRecord{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	writeResponse(w, r, listNotificationsResponse{Notifications: notifications, Total: total})
+}
+
+type markNotificationsReadRequest struct {
+	// IDs are the notifications to mark read. If there are none, every
+	// notification is marked read.
+	IDs []database.ULID `json:"ids"`
+}
+
+type markNotificationsReadResponse struct {
+	Marked int `json:"marked"`
+}
+
+// markNotificationsRead marks the user's notifications read: those given, or,
+// with an empty body, all of them.
+func (p *pubRouter) markNotificationsRead(w http.ResponseWriter, r *http.Request) {
+	user := r.Context().Value(userContextKey).(identity.User) //nolint:forceTypeAssert
+
+	var input markNotificationsReadRequest
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil && !errors.Is(err, io.EOF) {
+		returnBodyError(r.Context(), w, err, "invalid request body")
+		return
+	}
+
+	marked, err := p.pub.MarkNotificationsRead(r.Context(), user.ID, input.IDs)
+	if err != nil {
+		returnError(r.Context(), w, err, "error marking notifications read")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	writeResponse(w, r, markNotificationsReadResponse{Marked: marked})
+}
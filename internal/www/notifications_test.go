@@ -0,0 +1,105 @@
+package www
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+
+	ap "github.com/jclem/jclem.me/internal/activitypub"
+)
+
+func TestNotifications(t *testing.T) {
+	p := newTestPub(t)
+	ctx := context.Background()
+
+	activity, err := publishNote(ctx, p.pub, p.user, "Hello", []string{ap.PublicNS}, []string{p.site.ActorFollowers(p.user)})
+	if err != nil {
+		t.Fatalf("error publishing note: %v", err)
+	}
+
+	noteID := activity.Object.ID
+	bob := "https://remote.example.com/bob"
+
+	receive := func(typ, id string, object any) {
+		t.Helper()
+
+		data, err := json.Marshal(map[string]any{"@context": ap.ActivityStreamsContext, "type": typ, "id": id, "actor": bob, "object": object})
+		if err != nil {
+			t.Fatalf("error encoding activity: %v", err)
+		}
+
+		if _, err := p.pub.CreateActivity(ctx, p.user.ID, ap.Inbox, ap.ActivityStreamsContext, typ, id, data); err != nil {
+			t.Fatalf("error receiving %s: %v", typ, err)
+		}
+	}
+
+	receive("Follow", bob+"/follows/1", p.site.ActorID(p.user))
+	receive("Create", bob+"/creates/1", map[string]any{"id": bob + "/notes/1", "type": "Note", "inReplyTo": noteID})
+	receive("Create", bob+"/creates/2", map[string]any{"id": bob + "/notes/2", "type": "Note"})
+	receive("Like", bob+"/likes/1", noteID)
+	receive("Like", bob+"/likes/2", "https://remote.example.com/carol/notes/1")
+	receive("Announce", bob+"/announces/1", map[string]any{"id": noteID})
+
+	// An activity delivered again is notified once.
+	receive("Announce", bob+"/announces/1", map[string]any{"id": noteID})
+
+	w := serve(p, http.MethodGet, "/notifications", p.apiKey, "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", w.Code, w.Body)
+	}
+
+	list := decode[listNotificationsResponse](t, w)
+
+	var types []string
+	for _, n := range list.Notifications {
+		types = append(types, n.Type+" "+n.ObjectID)
+	}
+
+	want := []string{
+		"boost " + noteID,
+		"like " + noteID,
+		"mention " + bob + "/notes/2",
+		"reply " + noteID,
+		"follow ",
+	}
+
+	if list.Total != len(want) || fmt.Sprint(types) != fmt.Sprint(want) {
+		t.Fatalf("expected notifications %q, got %q (total %d)", want, types, list.Total)
+	}
+
+	body := fmt.Sprintf(`{"ids":[%q]}`, list.Notifications[0].RecordID)
+	if marked := decode[markNotificationsReadResponse](t, serve(p, http.MethodPost, "/notifications/read", p.apiKey, body)); marked.Marked != 1 {
+		t.Errorf("expected 1 notification marked read, got %d", marked.Marked)
+	}
+
+	if unread := decode[listNotificationsResponse](t, serve(p, http.MethodGet, "/notifications?unread=true", p.apiKey, "")); unread.Total != len(want)-1 {
+		t.Errorf("expected %d unread notifications, got %d", len(want)-1, unread.Total)
+	}
+
+	// An app which may only read may not mark notifications read.
+	token := p.appToken(t, "read")
+
+	if w := serve(p, http.MethodGet, "/notifications", token, ""); w.Code != http.StatusOK {
+		t.Errorf("expected status 200 with the read scope, got %d", w.Code)
+	}
+
+	if w := serve(p, http.MethodPost, "/notifications/read", token, ""); w.Code != http.StatusForbidden {
+		t.Errorf("expected status 403 without the write scope, got %d", w.Code)
+	}
+
+	if marked := decode[markNotificationsReadResponse](t, serve(p, http.MethodPost, "/notifications/read", p.apiKey, "")); marked.Marked != len(want)-1 {
+		t.Errorf("expected %d notifications marked read, got %d", len(want)-1, marked.Marked)
+	}
+
+	for _, target := range []string{"/notifications?page=0", "/notifications?unread=maybe"} {
+		if w := serve(p, http.MethodGet, target, p.apiKey, ""); w.Code != http.StatusUnprocessableEntity {
+			t.Errorf("%s: expected status 422, got %d", target, w.Code)
+		}
+	}
+
+	if w := serve(p, http.MethodGet, "/notifications", "", ""); w.Code != http.StatusUnauthorized {
+		t.Errorf("expected status 401 without a token, got %d", w.Code)
+	}
+}
@@ -0,0 +1,306 @@
+package www
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/jclem/jclem.me/internal/activitypub/identity"
+	"github.com/jclem/jclem.me/internal/www/view"
+)
+
+type oauthRouter struct {
+	*chi.Mux
+	id   *identity.Service
+	view *view.Service
+}
+
+func newOAuthRouter(id *identity.Service, view *view.Service) *oauthRouter {
+	r := chi.NewRouter()
+	o := &oauthRouter{Mux: r, id: id, view: view}
+	r.Post("/apps", o.createApp)
+	r.Get("/authorize", o.showAuthorize)
+	r.Post("/authorize", o.authorize)
+	r.Post("/token", o.token)
+	r.Post("/revoke", o.revoke)
+
+	return o
+}
+
+type appResponse struct {
+	ClientID     string   `json:"client_id"`
+	ClientSecret string   `json:"client_secret"`
+	Name         string   `json:"name"`
+	Website      string   `json:"website,omitempty"`
+	RedirectURIs []string `json:"redirect_uris"`
+	Scopes       string   `json:"scopes"`
+}
+
+func (o *oauthRouter) createApp(w http.ResponseWriter, r *http.Request) {
+	var input identity.NewApp
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		returnBodyError(r.Context(), w, err, "invalid request body")
+		return
+	}
+
+	app, err := o.id.CreateApp(r.Context(), input)
+	if err != nil {
+		if errors.Is(err, identity.ErrInvalidApp) {
+			returnValidationError(r.Context(), w, "invalid app",
+				fieldError{Field: "client_name", Message: "is required"},
+				fieldError{Field: "redirect_uris", Message: "must be absolute URIs"},
+			)
+			return
+		}
+
+		returnError(r.Context(), w, err, "error creating app")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+
+	writeResponse(w, r, appResponse{
+		ClientID:     app.ID.String(),
+		ClientSecret: app.ClientSecret,
+		Name:         app.Name,
+		Website:      app.Website,
+		RedirectURIs: app.RedirectURIs,
+		Scopes:       app.Scopes,
+	})
+}
+
+type authorizeData struct {
+	App                 identity.App
+	Action              string
+	RedirectURI         string
+	Scope               string
+	Scopes              []string
+	State               string
+	CodeChallenge       string
+	CodeChallengeMethod string
+}
+
+// parseAuthorizeRequest validates the parameters of an authorization request.
+//
+// Errors which occur before the redirect URI is known to be valid are returned
+// to the user agent directly rather than by redirect.
+//
+// SEE https://datatracker.ietf.org/doc/html/rfc6749#section-4.1.2.1
+func (o *oauthRouter) parseAuthorizeRequest(w http.ResponseWriter, r *http.Request, params url.Values) (authorizeData, bool) {
+	app, err := o.id.GetApp(r.Context(), params.Get("client_id"))
+	if err != nil {
+		if errors.Is(err, identity.ErrAppNotFound) {
+			returnBadRequest(r.Context(), w, "unknown client_id")
+			return authorizeData{}, false
+		}
+
+		returnError(r.Context(), w, err, "error getting app")
+		return authorizeData{}, false
+	}
+
+	redirectURI := params.Get("redirect_uri")
+	if !app.AllowsRedirectURI(redirectURI) {
+		returnBadRequest(r.Context(), w, "redirect_uri was not registered")
+		return authorizeData{}, false
+	}
+
+	data := authorizeData{
+		App:                 app,
+		Action:              r.URL.Path,
+		RedirectURI:         redirectURI,
+		Scope:               params.Get("scope"),
+		State:               params.Get("state"),
+		CodeChallenge:       params.Get("code_challenge"),
+		CodeChallengeMethod: params.Get("code_challenge_method"),
+	}
+
+	if data.Scope == "" {
+		data.Scope = identity.DefaultScopes
+	}
+
+	data.Scopes = strings.Fields(data.Scope)
+
+	if params.Get("response_type") != "code" {
+		redirectWithParams(w, r, redirectURI, url.Values{"error": {"unsupported_response_type"}, "state": {data.State}})
+		return authorizeData{}, false
+	}
+
+	if !app.AllowsScopes(data.Scope) {
+		redirectWithParams(w, r, redirectURI, url.Values{"error": {"invalid_scope"}, "state": {data.State}})
+		return authorizeData{}, false
+	}
+
+	return data, true
+}
+
+func (o *oauthRouter) showAuthorize(w http.ResponseWriter, r *http.Request) {
+	data, ok := o.parseAuthorizeRequest(w, r, r.URL.Query())
+	if !ok {
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+
+	if err := o.view.RenderHTML(w, "oauth/authorize", data, view.WithTitle("Authorize "+data.App.Name)); err != nil {
+		returnError(r.Context(), w, err, "error rendering page")
+		return
+	}
+}
+
+func (o *oauthRouter) authorize(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		returnBodyError(r.Context(), w, err, "invalid form")
+		return
+	}
+
+	data, ok := o.parseAuthorizeRequest(w, r, r.PostForm)
+	if !ok {
+		return
+	}
+
+	// Only the user's own keys may grant access, or an app could exchange its
+	// token for a grant with more scopes than it was given.
+	user, key, err := o.id.ValidateAPIKey(r.Context(), r.PostForm.Get("api_key"))
+	if err != nil || key.AppID != nil {
+		redirectWithParams(w, r, data.RedirectURI, url.Values{"error": {"access_denied"}, "state": {data.State}})
+		return
+	}
+
+	code, err := o.id.CreateAuthorizationCode(r.Context(), identity.AuthorizationRequest{
+		App:                 data.App,
+		UserID:              user.ID,
+		RedirectURI:         data.RedirectURI,
+		Scopes:              strings.Join(data.Scopes, " "),
+		CodeChallenge:       data.CodeChallenge,
+		CodeChallengeMethod: data.CodeChallengeMethod,
+	})
+	if err != nil {
+		if errors.Is(err, identity.ErrInvalidGrant) {
+			redirectWithParams(w, r, data.RedirectURI, url.Values{"error": {"invalid_request"}, "state": {data.State}})
+			return
+		}
+
+		returnError(r.Context(), w, err, "error creating authorization code")
+		return
+	}
+
+	redirectWithParams(w, r, data.RedirectURI, url.Values{"code": {code}, "state": {data.State}})
+}
+
+type tokenResponse struct {
+	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type"`
+	Scope       string `json:"scope"`
+	CreatedAt   int64  `json:"created_at"`
+}
+
+type oauthErrorResponse struct {
+	Error string `json:"error"`
+}
+
+func (o *oauthRouter) token(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+
+	if err := r.ParseForm(); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		writeResponse(w, r, oauthErrorResponse{Error: "invalid_request"})
+		return
+	}
+
+	if grantType := r.PostForm.Get("grant_type"); grantType != "authorization_code" {
+		w.WriteHeader(http.StatusBadRequest)
+		writeResponse(w, r, oauthErrorResponse{Error: "unsupported_grant_type"})
+		return
+	}
+
+	clientID, clientSecret, ok := r.BasicAuth()
+	if !ok {
+		clientID = r.PostForm.Get("client_id")
+		clientSecret = r.PostForm.Get("client_secret")
+	}
+
+	token, err := o.id.ExchangeAuthorizationCode(r.Context(), identity.TokenRequest{
+		ClientID:     clientID,
+		ClientSecret: clientSecret,
+		Code:         r.PostForm.Get("code"),
+		RedirectURI:  r.PostForm.Get("redirect_uri"),
+		CodeVerifier: r.PostForm.Get("code_verifier"),
+	})
+	if err != nil {
+		if errors.Is(err, identity.ErrInvalidClient) {
+			w.WriteHeader(http.StatusUnauthorized)
+			writeResponse(w, r, oauthErrorResponse{Error: "invalid_client"})
+			return
+		}
+
+		if errors.Is(err, identity.ErrInvalidGrant) {
+			w.WriteHeader(http.StatusBadRequest)
+			writeResponse(w, r, oauthErrorResponse{Error: "invalid_grant"})
+			return
+		}
+
+		returnError(r.Context(), w, err, "error exchanging authorization code")
+		return
+	}
+
+	writeResponse(w, r, tokenResponse{
+		AccessToken: token.Token,
+		TokenType:   "Bearer",
+		Scope:       token.Scopes,
+		CreatedAt:   token.CreatedAt.Unix(),
+	})
+}
+
+func (o *oauthRouter) revoke(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if err := r.ParseForm(); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		writeResponse(w, r, oauthErrorResponse{Error: "invalid_request"})
+		return
+	}
+
+	clientID, clientSecret, ok := r.BasicAuth()
+	if !ok {
+		clientID = r.PostForm.Get("client_id")
+		clientSecret = r.PostForm.Get("client_secret")
+	}
+
+	if err := o.id.RevokeAccessToken(r.Context(), clientID, clientSecret, r.PostForm.Get("token")); err != nil {
+		if errors.Is(err, identity.ErrInvalidClient) {
+			w.WriteHeader(http.StatusUnauthorized)
+			writeResponse(w, r, oauthErrorResponse{Error: "invalid_client"})
+			return
+		}
+
+		returnError(r.Context(), w, err, "error revoking access token")
+		return
+	}
+
+	writeResponse(w, r, struct{}{})
+}
+
+func redirectWithParams(w http.ResponseWriter, r *http.Request, uri string, params url.Values) {
+	u, err := url.Parse(uri)
+	if err != nil {
+		returnError(r.Context(), w, err, "error parsing redirect URI")
+		return
+	}
+
+	q := u.Query()
+
+	for k, v := range params {
+		if len(v) > 0 && v[0] != "" {
+			q[k] = v
+		}
+	}
+
+	u.RawQuery = q.Encode()
+
+	http.Redirect(w, r, u.String(), http.StatusFound)
+}
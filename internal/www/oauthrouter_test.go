@@ -0,0 +1,95 @@
+package www
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/jclem/jclem.me/internal/activitypub/identity"
+)
+
+func TestOAuthAuthorize(t *testing.T) {
+	p := newTestPub(t)
+	o := newOAuthRouter(p.id, nil)
+
+	app, err := p.id.CreateApp(context.Background(), identity.NewApp{Name: "app", RedirectURIs: []string{"https://app.example.com/callback"}, Scopes: "read write"})
+	if err != nil {
+		t.Fatalf("error creating app: %v", err)
+	}
+
+	authorize := func(apiKey, scope string) url.Values {
+		t.Helper()
+
+		form := url.Values{
+			"client_id":     {app.ID.String()},
+			"redirect_uri":  {"https://app.example.com/callback"},
+			"response_type": {"code"},
+			"scope":         {scope},
+			"state":         {"state"},
+			"api_key":       {apiKey},
+		}
+
+		req := httptest.NewRequest(http.MethodPost, "/authorize", strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+		w := httptest.NewRecorder()
+		o.ServeHTTP(w, req)
+
+		location, err := url.Parse(w.Header().Get("Location"))
+		if err != nil || w.Code != http.StatusFound {
+			t.Fatalf("expected a redirect, got %d: %s", w.Code, w.Body)
+		}
+
+		return location.Query()
+	}
+
+	// An app's token cannot authorize another grant, even for its own scopes.
+	if params := authorize(p.appToken(t, "read"), "read"); params.Get("error") != "access_denied" {
+		t.Errorf("expected access_denied for an app token, got %v", params)
+	}
+
+	params := authorize(p.apiKey, "read")
+	if params.Get("code") == "" || params.Get("state") != "state" {
+		t.Fatalf("expected a code, got %v", params)
+	}
+
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"client_id":     {app.ID.String()},
+		"client_secret": {app.ClientSecret},
+		"code":          {params.Get("code")},
+		"redirect_uri":  {"https://app.example.com/callback"},
+	}
+
+	exchange := func() *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/token", strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+		w := httptest.NewRecorder()
+		o.ServeHTTP(w, req)
+
+		return w
+	}
+
+	w := exchange()
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", w.Code, w.Body)
+	}
+
+	token := decode[tokenResponse](t, w)
+	if token.Scope != "read" {
+		t.Errorf("expected scope %q, got %q", "read", token.Scope)
+	}
+
+	if _, key, err := p.id.ValidateAPIKey(context.Background(), token.AccessToken); err != nil || key.HasScope(identity.WriteScope) {
+		t.Errorf("expected a valid read-only token, got %+v, %v", key, err)
+	}
+
+	// Authorization codes are single-use.
+	if w := exchange(); w.Code != http.StatusBadRequest {
+		t.Errorf("expected status 400 when reusing a code, got %d", w.Code)
+	}
+}
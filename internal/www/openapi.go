@@ -0,0 +1,534 @@
+package www
+
+import (
+	"net/http"
+	"slices"
+	"strconv"
+
+	ap "github.com/jclem/jclem.me/internal/activitypub"
+	"github.com/jclem/jclem.me/internal/activitypub/identity"
+	"github.com/jclem/jclem.me/internal/analytics"
+	"github.com/jclem/jclem.me/internal/bookmarks"
+	"github.com/jclem/jclem.me/internal/dispatches"
+	"github.com/jclem/jclem.me/internal/events"
+	"github.com/jclem/jclem.me/internal/linkcheck"
+	"github.com/jclem/jclem.me/internal/mastodon"
+	"github.com/jclem/jclem.me/internal/openapi"
+	"github.com/jclem/jclem.me/internal/posts"
+	"github.com/jclem/jclem.me/internal/www/view"
+)
+
+// openAPIPath is the path at which the API's OpenAPI document is served, and
+// apiDocsPath is the path of the page which documents it.
+const (
+	openAPIPath = "/openapi.json"
+	apiDocsPath = "/api"
+)
+
+// activityMediaType is the media type of ActivityPub objects, without the
+// parameters of ap.ContentType.
+const activityMediaType = "application/activity+json"
+
+// Security schemes of the API. The admin API is called with the server's API
+// key, and a user's outbox and notifications with one of the user's API keys or
+// OAuth tokens.
+const (
+	adminSecurity = "adminKey"
+	userSecurity  = "userToken"
+)
+
+// Tags group the API's operations in its documentation.
+const (
+	tagUsers         = "Users"
+	tagPosts         = "Posts"
+	tagShortLinks    = "Short links"
+	tagBookmarks     = "Bookmarks"
+	tagDispatches    = "Dispatches"
+	tagReports       = "Reports"
+	tagActivities    = "Activities"
+	tagNotifications = "Notifications"
+)
+
+// newAPIDocument describes the authenticated API, which is the admin API and
+// users' outboxes and notifications, and the followers collections which manage who receives
+// what users post.
+func newAPIDocument(view *view.Service, site ap.Site) *openapi.Document {
+	d := openapi.New(openapi.Info{
+		Title:       "jclem.me",
+		Description: "Manage users, posts, and dispatches, and publish notes to followers. Errors are RFC 7807 problem details.",
+		Version:     "1",
+	})
+
+	d.Servers = []openapi.Server{{URL: view.URL("/admin"), Description: "Admin API"}}
+	d.Security = []openapi.SecurityRequirement{{adminSecurity: {}}}
+	d.Components.SecuritySchemes = map[string]openapi.SecurityScheme{
+		adminSecurity: {Type: "http", Scheme: "bearer", Description: "The server's API key."},
+		userSecurity:  {Type: "http", Scheme: "bearer", Description: "One of the user's API keys, or an OAuth access token with the read scope to read notifications, or the write scope to post notes and mark notifications read."},
+	}
+
+	addAdminOperations(d)
+	addPubOperations(d, site)
+
+	// Every authenticated operation may be unauthorized.
+	for _, op := range d.Operations() {
+		if op.Security == nil || len(op.Security) > 0 {
+			op.Responses[strconv.Itoa(http.StatusUnauthorized)] = openapi.Response{
+				Description: http.StatusText(http.StatusUnauthorized),
+				Content:     d.Content(problemContentType, problem{}),
+			}
+		}
+	}
+
+	return d
+}
+
+func addAdminOperations(d *openapi.Document) {
+	username := pathParam("username", "The user's username.")
+	slug := pathParam("slug", "The post's slug.")
+	dispatchID := pathParam("id", "The dispatch's ID.")
+
+	d.Add(http.MethodPost, "/users", &openapi.Operation{
+		OperationID: "createUser",
+		Summary:     "Create a user",
+		Description: "Creates a user and returns the user's first API key, which is not shown again.",
+		Tags:        []string{tagUsers},
+		RequestBody: jsonBody(d, identity.NewUser{}, "username"),
+		Responses:   responses(d, http.StatusCreated, createUserResponse{}, http.StatusConflict, http.StatusUnprocessableEntity),
+	})
+
+	d.Add(http.MethodPatch, "/users/{username}", &openapi.Operation{
+		OperationID: "updateUser",
+		Summary:     "Update a user",
+		Tags:        []string{tagUsers},
+		Parameters:  []openapi.Parameter{username},
+		RequestBody: jsonBody(d, identity.UserUpdate{}),
+		Responses:   responses(d, http.StatusOK, identity.User{}, http.StatusNotFound, http.StatusUnprocessableEntity),
+	})
+
+	d.Add(http.MethodDelete, "/users/{username}", &openapi.Operation{
+		OperationID: "deleteUser",
+		Summary:     "Delete a user",
+		Description: "Deletes a user, whose actor and inbox then respond 410 Gone. Their data is kept, and their username is not reused.",
+		Tags:        []string{tagUsers},
+		Parameters:  []openapi.Parameter{username},
+		Responses: withProblems(d, map[string]openapi.Response{
+			"204": {Description: "The user was deleted."},
+		}, http.StatusNotFound),
+	})
+
+	d.Add(http.MethodPost, "/users/{username}/keys/rotate", &openapi.Operation{
+		OperationID: "rotateKeys",
+		Summary:     "Rotate a user's signing keys",
+		Description: "Creates a new signing key. The old key is still accepted for a grace period.",
+		Tags:        []string{tagUsers},
+		Parameters:  []openapi.Parameter{username},
+		Responses:   responses(d, http.StatusCreated, ap.PublicKey{}, http.StatusNotFound),
+	})
+
+	d.Add(http.MethodGet, "/users/{username}/export", &openapi.Operation{
+		OperationID: "exportUser",
+		Summary:     "Export a user's data",
+		Description: "Downloads a zip archive of the user's profile, notes, followers, dispatches, and posts.",
+		Tags:        []string{tagUsers},
+		Parameters:  []openapi.Parameter{username},
+		Responses: withProblems(d, map[string]openapi.Response{
+			"200": {Description: "The archive.", Content: map[string]openapi.MediaType{
+				"application/zip": {Schema: &openapi.Schema{Type: "string", Format: "binary"}},
+			}},
+		}, http.StatusNotFound),
+	})
+
+	csvContent := map[string]openapi.MediaType{
+		"text/csv": {Schema: &openapi.Schema{Type: "string"}},
+	}
+
+	d.Add(http.MethodGet, "/users/{username}/followers.csv", &openapi.Operation{
+		OperationID: "exportFollowers",
+		Summary:     "Export a user's followers",
+		Description: "Downloads the accounts which follow the user as CSV, in the format in which Mastodon exports them.",
+		Tags:        []string{tagUsers},
+		Parameters:  []openapi.Parameter{username},
+		Responses: withProblems(d, map[string]openapi.Response{
+			"200": {Description: "The followers.", Content: csvContent},
+		}, http.StatusNotFound),
+	})
+
+	d.Add(http.MethodGet, "/users/{username}/following.csv", &openapi.Operation{
+		OperationID: "exportFollowing",
+		Summary:     "Export the accounts a user follows",
+		Description: "Downloads the accounts which the user follows as CSV, which Mastodon imports.",
+		Tags:        []string{tagUsers},
+		Parameters:  []openapi.Parameter{username},
+		Responses: withProblems(d, map[string]openapi.Response{
+			"200": {Description: "The accounts.", Content: csvContent},
+		}, http.StatusNotFound),
+	})
+
+	d.Add(http.MethodPost, "/users/{username}/following", &openapi.Operation{
+		OperationID: "importFollowing",
+		Summary:     "Follow the accounts in a CSV file",
+		Description: "Sends a Follow to each account in a CSV file of follows, such as one Mastodon exports, which the user does not already follow. Accounts are listed by address or actor ID.",
+		Tags:        []string{tagUsers},
+		Parameters:  []openapi.Parameter{username},
+		RequestBody: &openapi.RequestBody{Required: true, Content: csvContent},
+		Responses:   responses(d, http.StatusOK, mastodon.Result{}, http.StatusBadRequest, http.StatusNotFound),
+	})
+
+	d.Add(http.MethodPost, "/posts", &openapi.Operation{
+		OperationID: "createPost",
+		Summary:     "Create a post",
+		Tags:        []string{tagPosts},
+		RequestBody: jsonBody(d, posts.NewPost{}, "slug", "title"),
+		Responses:   responses(d, http.StatusCreated, posts.Post{}, http.StatusConflict, http.StatusUnprocessableEntity, http.StatusNotImplemented),
+	})
+
+	d.Add(http.MethodPatch, "/posts/{slug}", &openapi.Operation{
+		OperationID: "updatePost",
+		Summary:     "Update a post",
+		Tags:        []string{tagPosts},
+		Parameters:  []openapi.Parameter{slug},
+		RequestBody: jsonBody(d, posts.PostUpdate{}),
+		Responses:   responses(d, http.StatusOK, posts.Post{}, http.StatusNotFound, http.StatusUnprocessableEntity, http.StatusNotImplemented),
+	})
+
+	d.Add(http.MethodPost, "/posts/{slug}/publish", &openapi.Operation{
+		OperationID: "publishPost",
+		Summary:     "Publish a post",
+		Tags:        []string{tagPosts},
+		Parameters:  []openapi.Parameter{slug},
+		Responses:   responses(d, http.StatusOK, posts.Post{}, http.StatusNotFound, http.StatusNotImplemented),
+	})
+
+	d.Add(http.MethodPost, "/short-links", &openapi.Operation{
+		OperationID: "createShortLink",
+		Summary:     "Create a short link",
+		Description: "Links a code to a URL, or to a post. If the code is empty, one is generated.",
+		Tags:        []string{tagShortLinks},
+		RequestBody: jsonBody(d, createShortLinkRequest{}),
+		Responses:   responses(d, http.StatusCreated, shortLinkResponse{}, http.StatusConflict, http.StatusUnprocessableEntity, http.StatusNotImplemented),
+	})
+
+	d.Add(http.MethodGet, "/short-links/{code}", &openapi.Operation{
+		OperationID: "getShortLink",
+		Summary:     "Get a short link",
+		Tags:        []string{tagShortLinks},
+		Parameters:  []openapi.Parameter{pathParam("code", "The link's code.")},
+		Responses:   responses(d, http.StatusOK, shortLinkResponse{}, http.StatusNotFound, http.StatusNotImplemented),
+	})
+
+	d.Add(http.MethodPost, "/bookmarks", &openapi.Operation{
+		OperationID: "createBookmark",
+		Summary:     "Create a bookmark",
+		Description: "Creates a bookmark, and shares it with the author's followers as a note if federate is true.",
+		Tags:        []string{tagBookmarks},
+		RequestBody: jsonBody(d, createBookmarkRequest{}, "url", "title"),
+		Responses:   responses(d, http.StatusCreated, bookmarks.Bookmark{}, http.StatusUnprocessableEntity, http.StatusNotImplemented),
+	})
+
+	d.Add(http.MethodGet, "/dispatches", &openapi.Operation{
+		OperationID: "listDispatches",
+		Summary:     "List dispatches",
+		Description: "Lists dispatches of any status, newest first. The next cursor is passed as before to list older dispatches.",
+		Tags:        []string{tagDispatches},
+		Parameters: []openapi.Parameter{
+			queryParam("type", "Only dispatches of this type.", &openapi.Schema{Type: "string", Enum: []any{dispatches.TypeImage, dispatches.TypeText, dispatches.TypeLink, dispatches.TypeCheckin}}),
+			queryParam("since", "Only dispatches on or after this date, as YYYY-MM-DD.", &openapi.Schema{Type: "string", Format: "date"}),
+			queryParam("until", "Only dispatches on or before this date, as YYYY-MM-DD.", &openapi.Schema{Type: "string", Format: "date"}),
+			queryParam("before", "Only dispatches older than the dispatch with this ID.", &openapi.Schema{Type: "string"}),
+			queryParam("author", "Only dispatches by this author.", &openapi.Schema{Type: "string"}),
+			queryParam("limit", "The most dispatches to list, up to "+strconv.Itoa(maxDispatchesLimit)+".", &openapi.Schema{Type: "integer"}),
+		},
+		Responses: responses(d, http.StatusOK, listDispatchesResponse{}, http.StatusBadRequest, http.StatusUnprocessableEntity),
+	})
+
+	dispatchBody := jsonBody(d, createDispatchRequest{})
+	dispatchBody.Content["multipart/form-data"] = openapi.MediaType{Schema: &openapi.Schema{
+		Type: "object",
+		Properties: map[string]*openapi.Schema{
+			"image":    {Type: "string", Format: "binary", Description: "A GIF, JPEG, or PNG image of up to 32 MB."},
+			"alt":      {Type: "string"},
+			"body":     {Type: "string"},
+			"author":   {Type: "string"},
+			"federate": {Type: "boolean"},
+		},
+		Required: []string{"image", "alt"},
+	}}
+
+	dispatchResponses := responses(d, http.StatusCreated, dispatches.Dispatch{}, http.StatusUnprocessableEntity, http.StatusNotImplemented)
+	dispatchResponses[strconv.Itoa(http.StatusAccepted)] = openapi.Response{
+		Description: "The dispatch is pending until its image is processed.",
+		Content:     d.JSON(dispatches.Dispatch{}),
+	}
+
+	d.Add(http.MethodPost, "/dispatches", &openapi.Operation{
+		OperationID: "createDispatch",
+		Summary:     "Create a dispatch",
+		Description: "Creates a dispatch from JSON, or an image dispatch from a multipart form, whose image is processed before it is published. It is shared with the author's followers as a note if federate is true.",
+		Tags:        []string{tagDispatches},
+		RequestBody: dispatchBody,
+		Responses:   dispatchResponses,
+	})
+
+	d.Add(http.MethodPost, "/dispatches/uploads", &openapi.Operation{
+		OperationID: "createDispatchUpload",
+		Summary:     "Upload a dispatch's image to storage",
+		Description: "Presigns a request which uploads an image straight to storage. Once it is uploaded, the upload is confirmed to create the dispatch.",
+		Tags:        []string{tagDispatches},
+		RequestBody: jsonBody(d, createDispatchUploadRequest{}, "contentType", "size"),
+		Responses:   responses(d, http.StatusCreated, createDispatchUploadResponse{}, http.StatusUnprocessableEntity, http.StatusNotImplemented),
+	})
+
+	confirmResponses := responses(d, http.StatusAccepted, dispatches.Dispatch{}, http.StatusNotFound, http.StatusUnprocessableEntity)
+
+	d.Add(http.MethodPost, "/dispatches/uploads/{id}/confirm", &openapi.Operation{
+		OperationID: "confirmDispatchUpload",
+		Summary:     "Create a dispatch from an uploaded image",
+		Tags:        []string{tagDispatches},
+		Parameters:  []openapi.Parameter{pathParam("id", "The upload's ID.")},
+		RequestBody: jsonBody(d, createDispatchRequest{}),
+		Responses:   confirmResponses,
+	})
+
+	d.Add(http.MethodPatch, "/dispatches/{id}", &openapi.Operation{
+		OperationID: "updateDispatch",
+		Summary:     "Update a dispatch",
+		Description: "Updates a dispatch, and its note if it was shared with followers.",
+		Tags:        []string{tagDispatches},
+		Parameters:  []openapi.Parameter{dispatchID},
+		RequestBody: jsonBody(d, dispatches.DispatchUpdate{}),
+		Responses:   responses(d, http.StatusOK, dispatches.Dispatch{}, http.StatusNotFound, http.StatusUnprocessableEntity),
+	})
+
+	d.Add(http.MethodDelete, "/dispatches/{id}", &openapi.Operation{
+		OperationID: "deleteDispatch",
+		Summary:     "Delete a dispatch",
+		Description: "Deletes a dispatch and its uploaded image, and its note if it was shared with followers.",
+		Tags:        []string{tagDispatches},
+		Parameters:  []openapi.Parameter{dispatchID},
+		Responses: withProblems(d, map[string]openapi.Response{
+			"204": {Description: "The dispatch was deleted."},
+		}, http.StatusNotFound),
+	})
+
+	d.Add(http.MethodGet, "/links", &openapi.Operation{
+		OperationID: "getLinkReport",
+		Summary:     "Get the latest link check",
+		Tags:        []string{tagReports},
+		Responses:   responses(d, http.StatusOK, linkcheck.Report{}, http.StatusNotFound, http.StatusNotImplemented),
+	})
+
+	d.Add(http.MethodGet, "/analytics", &openapi.Operation{
+		OperationID: "getAnalytics",
+		Summary:     "Summarize page views",
+		Tags:        []string{tagReports},
+		Parameters: []openapi.Parameter{
+			queryParam("days", "The number of days to summarize, including today. Defaults to "+strconv.Itoa(defaultAnalyticsDays)+".", &openapi.Schema{Type: "integer"}),
+		},
+		Responses: responses(d, http.StatusOK, analytics.Summary{}, http.StatusUnprocessableEntity, http.StatusNotImplemented),
+	})
+
+	d.Add(http.MethodGet, eventsPath, &openapi.Operation{
+		OperationID: "streamEvents",
+		Summary:     "Stream new content",
+		Description: "Streams server-sent events, named by their types, as notes, dispatches, followers, and replies arrive. Each event's data is the event as JSON. The web domain's " + eventsPath + " streams only public notes and dispatches.",
+		Tags:        []string{tagReports},
+		Responses: withProblems(d, map[string]openapi.Response{
+			"200": {Description: "A stream of events.", Content: d.Content(eventStreamType, events.Event{})},
+		}),
+	})
+}
+
+// addPubOperations adds the operations of the users' ActivityPub endpoints,
+// which are served from the site's own server. The default user's are also
+// served without the username.
+func addPubOperations(d *openapi.Document, site ap.Site) {
+	pub := []openapi.Server{{URL: site.BaseURL, Description: "ActivityPub"}}
+
+	// The outbox requires only a note's content, and the properties which
+	// identify it as a note.
+	d.Require(ap.Note{}, "@context", "type", "content")
+	username := pathParam("username", "The user's username.")
+
+	for _, prefix := range []string{"", "/~{username}"} {
+		var params []openapi.Parameter
+		suffix := ""
+
+		if prefix != "" {
+			params = []openapi.Parameter{username}
+			suffix = "ByUsername"
+		}
+
+		d.Add(http.MethodPost, prefix+"/outbox", &openapi.Operation{
+			OperationID: "postNote" + suffix,
+			Summary:     "Post a note",
+			Description: "Publishes a note in the user's outbox, which delivers it to the recipients in its to and cc, such as the user's followers. It returns the Create activity which published it.",
+			Tags:        []string{tagActivities},
+			Parameters:  params,
+			RequestBody: &openapi.RequestBody{Required: true, Content: d.Content(activityMediaType, ap.Note{})},
+			Responses: withProblems(d, map[string]openapi.Response{
+				"201": {Description: "The note was published.", Content: d.Content(activityMediaType, ap.Activity[ap.Note]{})},
+			}, http.StatusUnauthorized, http.StatusForbidden, http.StatusUnprocessableEntity, http.StatusTooManyRequests),
+			Security: []openapi.SecurityRequirement{{userSecurity: {}}},
+		})
+
+		d.Add(http.MethodGet, prefix+"/followers", &openapi.Operation{
+			OperationID: "listFollowers" + suffix,
+			Summary:     "List followers",
+			Description: "Lists the IDs of the actors which follow the user, and receive the notes it posts to its followers.",
+			Tags:        []string{tagActivities},
+			Parameters:  params,
+			Responses: withProblems(d, map[string]openapi.Response{
+				"200": {Description: "The followers collection.", Content: d.Content(activityMediaType, ap.OrderedCollection[string]{})},
+			}, http.StatusNotFound),
+			Security: []openapi.SecurityRequirement{},
+		})
+
+		d.Add(http.MethodGet, prefix+"/notifications", &openapi.Operation{
+			OperationID: "listNotifications" + suffix,
+			Summary:     "List notifications",
+			Description: "Lists a page of the user's notifications of follows, mentions, replies, likes, and boosts received in their inbox, most recent first, " + strconv.Itoa(notificationsPageSize) + " to a page.",
+			Tags:        []string{tagNotifications},
+			Parameters: append(slices.Clone(params),
+				queryParam("page", "The page to list. Defaults to 1.", &openapi.Schema{Type: "integer"}),
+				queryParam("unread", "Whether to list only unread notifications.", &openapi.Schema{Type: "boolean"}),
+			),
+			Responses: responses(d, http.StatusOK, listNotificationsResponse{}, http.StatusForbidden, http.StatusUnprocessableEntity),
+			Security:  []openapi.SecurityRequirement{{userSecurity: {}}},
+		})
+
+		d.Add(http.MethodPost, prefix+"/notifications/read", &openapi.Operation{
+			OperationID: "markNotificationsRead" + suffix,
+			Summary:     "Mark notifications read",
+			Description: "Marks the given unread notifications read, or, without any IDs, all of them, and returns how many were marked.",
+			Tags:        []string{tagNotifications},
+			Parameters:  params,
+			RequestBody: &openapi.RequestBody{Content: d.JSON(markNotificationsReadRequest{})},
+			Responses:   responses(d, http.StatusOK, markNotificationsReadResponse{}, http.StatusBadRequest, http.StatusForbidden),
+			Security:    []openapi.SecurityRequirement{{userSecurity: {}}},
+		})
+
+		d.Paths[prefix+"/outbox"].Servers = pub
+		d.Paths[prefix+"/followers"].Servers = pub
+		d.Paths[prefix+"/notifications"].Servers = pub
+		d.Paths[prefix+"/notifications/read"].Servers = pub
+	}
+}
+
+func pathParam(name, description string) openapi.Parameter {
+	return openapi.Parameter{Name: name, In: "path", Description: description, Required: true, Schema: &openapi.Schema{Type: "string"}}
+}
+
+func queryParam(name, description string, schema *openapi.Schema) openapi.Parameter {
+	return openapi.Parameter{Name: name, In: "query", Description: description, Schema: schema}
+}
+
+// jsonBody describes a JSON request body of v's type, a struct, with the given
+// required fields. Fields without omitempty are required of responses, since
+// they are always encoded, but not of requests, which may omit them.
+func jsonBody(d *openapi.Document, v any, required ...string) *openapi.RequestBody {
+	d.Require(v, required...)
+
+	return &openapi.RequestBody{Required: true, Content: d.JSON(v)}
+}
+
+// responses describes a successful JSON response of v's type, and problems
+// with the given statuses.
+func responses(d *openapi.Document, status int, v any, problemStatuses ...int) map[string]openapi.Response {
+	return withProblems(d, map[string]openapi.Response{
+		strconv.Itoa(status): {Description: http.StatusText(status), Content: d.JSON(v)},
+	}, problemStatuses...)
+}
+
+// withProblems adds problem responses with the given statuses, and a default
+// problem response for unexpected errors, to an operation's responses.
+func withProblems(d *openapi.Document, responses map[string]openapi.Response, statuses ...int) map[string]openapi.Response {
+	content := d.Content(problemContentType, problem{})
+
+	for _, status := range statuses {
+		responses[strconv.Itoa(status)] = openapi.Response{Description: http.StatusText(status), Content: content}
+	}
+
+	responses["default"] = openapi.Response{Description: "An unexpected error.", Content: content}
+
+	return responses
+}
+
+// serveOpenAPI serves the API's OpenAPI document, from which clients may be
+// generated.
+func (wr *webRouter) serveOpenAPI(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+
+	writeResponse(w, r, wr.api)
+}
+
+type apiDocsData struct {
+	Info       openapi.Info
+	SpecURL    string
+	Operations []apiDocsOperation
+	Schemas    []apiDocsSchema
+}
+
+type apiDocsOperation struct {
+	openapi.MethodOperation
+
+	// URL is the operation's path under the URL of its server.
+	URL string
+}
+
+type apiDocsSchema struct {
+	Name       string
+	Properties []apiDocsProperty
+}
+
+type apiDocsProperty struct {
+	Name     string
+	Schema   *openapi.Schema
+	Required bool
+}
+
+// showAPIDocs documents the operations and schemas of the API's OpenAPI
+// document.
+func (wr *webRouter) showAPIDocs(w http.ResponseWriter, r *http.Request) {
+	data := apiDocsData{Info: wr.api.Info, SpecURL: wr.view.URL(openAPIPath)}
+
+	for _, op := range wr.api.Operations() {
+		servers := wr.api.Paths[op.Path].Servers
+		if len(servers) == 0 {
+			servers = wr.api.Servers
+		}
+
+		data.Operations = append(data.Operations, apiDocsOperation{MethodOperation: op, URL: servers[0].URL + op.Path})
+	}
+
+	for _, name := range sortedKeys(wr.api.Components.Schemas) {
+		schema := wr.api.Components.Schemas[name]
+		doc := apiDocsSchema{Name: name}
+
+		for _, prop := range sortedKeys(schema.Properties) {
+			doc.Properties = append(doc.Properties, apiDocsProperty{
+				Name:     prop,
+				Schema:   schema.Properties[prop],
+				Required: slices.Contains(schema.Required, prop),
+			})
+		}
+
+		data.Schemas = append(data.Schemas, doc)
+	}
+
+	if err := wr.view.RenderHTML(w, "api/show", data, view.WithTitle("API"), view.WithTheme(view.RequestTheme(r)), view.WithCanonical(apiDocsPath)); err != nil {
+		wr.renderError(w, r, err, "error rendering API docs")
+		return
+	}
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+
+	slices.Sort(keys)
+
+	return keys
+}
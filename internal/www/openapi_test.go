@@ -0,0 +1,63 @@
+package www
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestOpenAPI(t *testing.T) {
+	s, err := New(context.Background(), testConfig)
+	if err != nil {
+		t.Fatalf("error creating server: %v", err)
+	}
+
+	w := serve(s, http.MethodGet, openAPIPath, "", "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", w.Code, w.Body)
+	}
+
+	doc := decode[map[string]any](t, w)
+
+	paths, _ := doc["paths"].(map[string]any)
+	for _, path := range []string{"/users/{username}/keys/rotate", "/dispatches", "/dispatches/{id}", "/outbox", "/~{username}/followers"} {
+		if _, ok := paths[path]; !ok {
+			t.Errorf("expected path %q", path)
+		}
+	}
+
+	schemas, _ := doc["components"].(map[string]any)["schemas"].(map[string]any)
+
+	dispatch, _ := schemas["Dispatch"].(map[string]any)
+	if props, _ := dispatch["properties"].(map[string]any); props["id"] == nil || props["body"] == nil {
+		t.Errorf("expected Dispatch schema to have id and body properties, got %v", dispatch)
+	}
+
+	// Every reference must resolve, or clients cannot be generated.
+	var check func(v any)
+	check = func(v any) {
+		switch v := v.(type) {
+		case map[string]any:
+			if ref, ok := v["$ref"].(string); ok {
+				if _, ok := schemas[strings.TrimPrefix(ref, "#/components/schemas/")]; !ok {
+					t.Errorf("unresolved reference %q", ref)
+				}
+			}
+
+			for _, child := range v {
+				check(child)
+			}
+		case []any:
+			for _, child := range v {
+				check(child)
+			}
+		}
+	}
+
+	check(doc)
+
+	if w := serve(s, http.MethodGet, apiDocsPath, "", ""); w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "POST http://localhost:8080/admin/dispatches") {
+		t.Errorf("expected the docs page to list operations, got %d: %s", w.Code, w.Body)
+	}
+}
@@ -0,0 +1,175 @@
+package www
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/go-chi/httplog/v2"
+	"github.com/jclem/jclem.me/internal/errorreport"
+)
+
+// problemContentType is the content type of problem details responses.
+const problemContentType = "application/problem+json"
+
+// Problem types identify classes of errors which clients may want to handle
+// specially. Errors which are fully described by their status code use
+// problemTypeBlank. Other types are resolved against the web domain by
+// problemTypeURI.
+//
+// SEE https://datatracker.ietf.org/doc/html/rfc7807#section-3.1
+const (
+	problemTypeBlank          = "about:blank"
+	problemTypeValidation     = "validation"
+	problemTypeUnauthorized   = "unauthorized"
+	problemTypeRateLimited    = "rate-limited"
+	problemTypeInvalidRequest = "invalid-request"
+)
+
+// A problemDoc documents a problem type. It is served at the type's URI.
+type problemDoc struct {
+	Title       string
+	Status      int
+	Description string
+	URI         string
+}
+
+// problemDocs document each problem type other than problemTypeBlank.
+var problemDocs = map[string]problemDoc{ //nolint:gochecknoglobals
+	problemTypeValidation: {
+		Title:       "Validation failed",
+		Status:      http.StatusUnprocessableEntity,
+		Description: "The request was well-formed, but one or more of its fields are invalid. The errors member lists each invalid field and why it is invalid.",
+	},
+	problemTypeUnauthorized: {
+		Title:       "Unauthorized",
+		Status:      http.StatusUnauthorized,
+		Description: "The request must bear a valid API key or access token in its Authorization header.",
+	},
+	problemTypeRateLimited: {
+		Title:       "Rate limited",
+		Status:      http.StatusTooManyRequests,
+		Description: "Too many requests were made. The Retry-After header says how many seconds to wait before trying again.",
+	},
+	problemTypeInvalidRequest: {
+		Title:       "Invalid request",
+		Status:      http.StatusBadRequest,
+		Description: "The request could not be read, such as a body which is not valid JSON.",
+	},
+}
+
+// problemDomainKey is the context key of the domain under which problem types
+// are documented.
+type problemDomainKey struct{}
+
+// problemDomain sets the domain under which the types of problems returned by
+// the handler are documented, which is the web domain.
+func problemDomain(domain string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), problemDomainKey{}, domain)))
+		})
+	}
+}
+
+// problemTypeURI returns the URI identifying the given problem type, under the
+// domain set by problemDomain. Without one, it is a relative reference.
+func problemTypeURI(ctx context.Context, typ string) string {
+	if typ == problemTypeBlank {
+		return typ
+	}
+
+	domain, ok := ctx.Value(problemDomainKey{}).(string)
+	if !ok || domain == "" {
+		return "/problems/" + typ
+	}
+
+	return "https://" + domain + "/problems/" + typ
+}
+
+// A problem is an RFC 7807 problem details object.
+//
+// SEE https://datatracker.ietf.org/doc/html/rfc7807
+type problem struct {
+	Type     string       `json:"type"`
+	Title    string       `json:"title"`
+	Status   int          `json:"status"`
+	Detail   string       `json:"detail,omitempty"`
+	Instance string       `json:"instance,omitempty"`
+	Errors   []fieldError `json:"errors,omitempty"`
+}
+
+// A fieldError describes why a single field of a request is invalid.
+type fieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// returnProblem writes a problem details response. The type defaults to
+// problemTypeBlank, the title to the status text, and the instance to the
+// request ID, so that a response can be correlated with the request's logs.
+func returnProblem(ctx context.Context, w http.ResponseWriter, p problem) {
+	if p.Type == "" {
+		p.Type = problemTypeBlank
+	}
+
+	p.Type = problemTypeURI(ctx, p.Type)
+
+	if p.Title == "" {
+		p.Title = http.StatusText(p.Status)
+	}
+
+	if reqID := middleware.GetReqID(ctx); reqID != "" && p.Instance == "" {
+		p.Instance = "urn:request:" + reqID
+	}
+
+	w.Header().Set("Content-Type", problemContentType)
+	w.WriteHeader(p.Status)
+
+	if err := json.NewEncoder(w).Encode(p); err != nil {
+		oplog := httplog.LogEntry(ctx)
+		oplog.ErrorContext(ctx, "error encoding error response", "error", err)
+	}
+}
+
+func returnCodeError(ctx context.Context, w http.ResponseWriter, code int, message string) {
+	returnProblem(ctx, w, problem{Status: code, Detail: message})
+}
+
+func returnError(ctx context.Context, w http.ResponseWriter, err error, message string) {
+	logError(ctx, err, message)
+	errorreport.Report(ctx, err, message)
+
+	// Errors are transient, so they must not be cached under the route's
+	// policy.
+	w.Header().Set("Cache-Control", "no-store")
+
+	returnProblem(ctx, w, problem{Status: http.StatusInternalServerError, Detail: "Internal server error"})
+}
+
+func returnBadRequest(ctx context.Context, w http.ResponseWriter, detail string) {
+	returnProblem(ctx, w, problem{Type: problemTypeInvalidRequest, Status: http.StatusBadRequest, Detail: detail})
+}
+
+func returnNotFound(ctx context.Context, w http.ResponseWriter, detail string) {
+	returnProblem(ctx, w, problem{Status: http.StatusNotFound, Detail: detail})
+}
+
+func returnUnauthorized(ctx context.Context, w http.ResponseWriter, detail string) {
+	w.Header().Set("WWW-Authenticate", "Bearer")
+	returnProblem(ctx, w, problem{Type: problemTypeUnauthorized, Status: http.StatusUnauthorized, Detail: detail})
+}
+
+func returnForbidden(ctx context.Context, w http.ResponseWriter, detail string) {
+	returnProblem(ctx, w, problem{Status: http.StatusForbidden, Detail: detail})
+}
+
+func returnValidationError(ctx context.Context, w http.ResponseWriter, detail string, errs ...fieldError) {
+	returnProblem(ctx, w, problem{
+		Type:   problemTypeValidation,
+		Status: http.StatusUnprocessableEntity,
+		Detail: detail,
+		Errors: errs,
+	})
+}
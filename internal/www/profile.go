@@ -0,0 +1,96 @@
+package www
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/go-chi/httplog/v2"
+	"github.com/jclem/jclem.me/internal/activitypub/identity"
+	"github.com/jclem/jclem.me/internal/timeline"
+	"github.com/jclem/jclem.me/internal/webfinger"
+	"github.com/jclem/jclem.me/internal/www/view"
+)
+
+// profileNotesLimit is the number of recent notes shown on a profile page.
+const profileNotesLimit = 20
+
+type profileData struct {
+	User    identity.User
+	Address string
+	Notes   []timeline.Item
+
+	// FollowAction is where the follow form is submitted, and Account and
+	// FollowError are the account it was last submitted with and why following
+	// from it failed.
+	FollowAction string
+	Account      string
+	FollowError  string
+}
+
+// renderProfile renders a user's profile page, which browsers are shown rather
+// than their actor, with the given status, and the account and error of a
+// follow which failed, if any.
+func (p *pubRouter) renderProfile(w http.ResponseWriter, r *http.Request, user identity.User, status int, account, followError string) {
+	notes, err := p.pub.ListPublicNotes(r.Context(), user.ID, profileNotesLimit)
+	if err != nil {
+		returnError(r.Context(), w, err, "error listing notes")
+		return
+	}
+
+	items := make([]timeline.Item, 0, len(notes))
+	for _, note := range notes {
+		items = append(items, timeline.Note{NoteRecord: note})
+	}
+
+	data := profileData{
+		User:         user,
+		Address:      "@" + user.Username + "@" + p.site.Domain,
+		Notes:        items,
+		FollowAction: p.site.ActorID(user) + "/follow",
+		Account:      account,
+		FollowError:  followError,
+	}
+
+	title := user.Name
+	if title == "" {
+		title = data.Address
+	}
+
+	w.Header().Set("Content-Type", htmlContentType)
+	w.WriteHeader(status)
+
+	if err := p.view.RenderHTML(w, "pub/profile", data, view.WithTitle(title)); err != nil {
+		oplog := httplog.LogEntry(r.Context())
+		oplog.ErrorContext(r.Context(), "error rendering profile", "error", err)
+	}
+}
+
+// remoteFollow sends a visitor who submits a profile page's follow form to their
+// own server, which follows the user. The server is found from the WebFinger
+// resource of the visitor's account.
+func (p *pubRouter) remoteFollow(w http.ResponseWriter, r *http.Request) {
+	user := r.Context().Value(userContextKey).(identity.User) //nolint:forceTypeAssert
+	account := strings.TrimPrefix(strings.TrimSpace(r.URL.Query().Get("account")), "@")
+
+	if account == "" {
+		returnValidationError(r.Context(), w, "invalid query", fieldError{Field: "account", Message: "is required"})
+		return
+	}
+
+	target, err := webfinger.SubscribeURL(r.Context(), account, p.site.ActorID(user))
+	if err != nil {
+		oplog := httplog.LogEntry(r.Context())
+		oplog.InfoContext(r.Context(), "error finding remote follow URL", "account", account, "error", err)
+
+		if p.view == nil {
+			returnValidationError(r.Context(), w, "invalid account", fieldError{Field: "account", Message: "could not be followed from"})
+			return
+		}
+
+		p.renderProfile(w, r, user, http.StatusUnprocessableEntity, account, "Your server could not be found, or does not support following from here.")
+
+		return
+	}
+
+	http.Redirect(w, r, target, http.StatusSeeOther)
+}
@@ -0,0 +1,112 @@
+package public
+
+import (
+	"fmt"
+	"strings"
+)
+
+// iconBaseURL is the location of the site's icon set.
+const iconBaseURL = "https://jclem.nyc3.cdn.digitaloceanspaces.com/profile/"
+
+// An Icon is an image in the site's icon set.
+type Icon struct {
+	Src   string `json:"src"`
+	Sizes string `json:"sizes"`
+	Type  string `json:"type"`
+}
+
+// Icons returns the site's icon set, from smallest to largest.
+func Icons() []Icon {
+	sizes := []int{16, 32, 64, 128, 256, 512}
+	icons := make([]Icon, 0, len(sizes))
+
+	for _, size := range sizes {
+		icons = append(icons, Icon{
+			Src:   fmt.Sprintf("%sprofile-%d.png", iconBaseURL, size),
+			Sizes: fmt.Sprintf("%dx%d", size, size),
+			Type:  "image/png",
+		})
+	}
+
+	return icons
+}
+
+// FaviconURL returns the URL of the icon served for /favicon.ico.
+func FaviconURL() string {
+	return iconBaseURL + "profile-32.png"
+}
+
+// AppleTouchIconURL returns the URL of the icon served for
+// /apple-touch-icon.png.
+func AppleTouchIconURL() string {
+	return iconBaseURL + "profile-apple-touch-icon.png"
+}
+
+// ShareImageURL returns the URL of the image shown in link previews of pages
+// which have no image of their own.
+func ShareImageURL() string {
+	return iconBaseURL + "profile-512.png"
+}
+
+// A Manifest is a web application manifest.
+//
+// SEE https://www.w3.org/TR/appmanifest/
+type Manifest struct {
+	Name            string `json:"name"`
+	ShortName       string `json:"short_name"`
+	StartURL        string `json:"start_url"`
+	Display         string `json:"display"`
+	BackgroundColor string `json:"background_color"`
+	ThemeColor      string `json:"theme_color"`
+	Icons           []Icon `json:"icons"`
+}
+
+// NewManifest returns the site's web application manifest.
+func NewManifest() Manifest {
+	return Manifest{
+		Name:            "Jonathan Clem",
+		ShortName:       "jclem.me",
+		StartURL:        "/",
+		Display:         "browser",
+		BackgroundColor: "#ffffff",
+		ThemeColor:      "#ffffff",
+		Icons:           Icons(),
+	}
+}
+
+// aiCrawlers are the user agents of crawlers which collect training data for
+// AI models.
+var aiCrawlers = []string{ //nolint:gochecknoglobals
+	"GPTBot",
+	"ChatGPT-User",
+	"CCBot",
+	"Google-Extended",
+	"Applebot-Extended",
+	"anthropic-ai",
+	"ClaudeBot",
+	"cohere-ai",
+	"PerplexityBot",
+	"Bytespider",
+	"Omgilibot",
+	"FacebookBot",
+}
+
+// Robots returns the contents of robots.txt, referencing the given sitemap.
+// If disallowAI is true, AI training crawlers are disallowed from the whole
+// site.
+func Robots(sitemapURL string, disallowAI bool) string {
+	var b strings.Builder
+
+	if disallowAI {
+		for _, agent := range aiCrawlers {
+			fmt.Fprintf(&b, "User-agent: %s\n", agent)
+		}
+
+		b.WriteString("Disallow: /\n\n")
+	}
+
+	b.WriteString("User-agent: *\nAllow: /\n\n")
+	fmt.Fprintf(&b, "Sitemap: %s\n", sitemapURL)
+
+	return b.String()
+}
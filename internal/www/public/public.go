@@ -1,10 +1,17 @@
 package public
 
 import (
+	"crypto/sha256"
 	"embed"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"io/fs"
+	"net/http"
+	"path"
+	"slices"
+	"strings"
+	"sync"
 )
 
 //go:embed scripts/*.js styles/*.css
@@ -12,42 +19,134 @@ var Content embed.FS
 
 var ErrNoStyles = errors.New("no styles found")
 
-func MustGetStyles() string {
-	styles, err := getStyles()
-	if err != nil {
-		panic(err)
-	}
+var ErrNoScripts = errors.New("no scripts found")
+
+// An AssetManifest lists the site's stylesheets and scripts by their
+// fingerprinted names, which include a hash of their content, such as
+// "styles/index.<sha256>.css", so that browsers may cache them forever.
+type AssetManifest struct {
+	fsys fs.FS
+
+	// assets maps fingerprinted names to the names of the files they are
+	// served from.
+	assets map[string]string
 
-	return styles
+	styles  []string
+	scripts []string
+
+	// themes maps the names of themes to the URLs of their stylesheets.
+	themes map[string]string
 }
 
-func MustGetScripts() string {
-	scripts, err := getScripts()
+// themePrefix begins the names of stylesheets which style a theme, such as
+// "styles/theme-dark.css", which are linked apart from the other stylesheets.
+const themePrefix = "theme-"
+
+// NewAssetManifest fingerprints the stylesheets and scripts in fsys, which are
+// in its "styles" and "scripts" directories. There must be at least one of
+// each, besides the stylesheets of themes.
+func NewAssetManifest(fsys fs.FS) (*AssetManifest, error) {
+	m := &AssetManifest{fsys: fsys, assets: map[string]string{}, themes: map[string]string{}}
+
+	styles, err := m.add("styles/*.css", ErrNoStyles)
 	if err != nil {
-		panic(err)
+		return nil, err
+	}
+
+	for _, url := range styles {
+		name := path.Base(m.assets[strings.TrimPrefix(url, "/public/")])
+		if theme, ok := strings.CutPrefix(name, themePrefix); ok {
+			m.themes[strings.TrimSuffix(theme, ".css")] = url
+			continue
+		}
+
+		m.styles = append(m.styles, url)
+	}
+
+	if len(m.styles) == 0 {
+		return nil, ErrNoStyles
 	}
 
-	return scripts
+	if m.scripts, err = m.add("scripts/*.js", ErrNoScripts); err != nil {
+		return nil, err
+	}
+
+	return m, nil
 }
 
-func getStyles() (string, error) {
-	styles, err := fs.Glob(Content, "styles/*.css")
+// add fingerprints the files matching pattern, returning their URLs in order
+// of their names.
+func (m *AssetManifest) add(pattern string, errNone error) ([]string, error) {
+	names, err := fs.Glob(m.fsys, pattern)
 	if err != nil {
-		return "", fmt.Errorf("failed to get styles: %w", err)
+		return nil, fmt.Errorf("error listing assets: %w", err)
 	}
 
-	if len(styles) == 0 {
-		return "", ErrNoStyles
+	if len(names) == 0 {
+		return nil, errNone
 	}
 
-	return "/public/" + styles[0], nil
+	slices.Sort(names)
+
+	urls := make([]string, 0, len(names))
+
+	for _, name := range names {
+		b, err := fs.ReadFile(m.fsys, name)
+		if err != nil {
+			return nil, fmt.Errorf("error reading asset: %w", err)
+		}
+
+		sum := sha256.Sum256(b)
+		ext := path.Ext(name)
+		fingerprinted := strings.TrimSuffix(name, ext) + "." + hex.EncodeToString(sum[:]) + ext
+
+		m.assets[fingerprinted] = name
+		urls = append(urls, "/public/"+fingerprinted)
+	}
+
+	return urls, nil
 }
 
-func getScripts() (string, error) {
-	scripts, err := fs.Glob(Content, "scripts/*.js")
-	if err != nil {
-		return "", fmt.Errorf("failed to get scripts: %w", err)
+// Styles returns the URLs of the stylesheets, other than those of themes, in
+// order of their names.
+func (m *AssetManifest) Styles() []string {
+	return m.styles
+}
+
+// Theme returns the URL of the stylesheet of a theme, such as "dark", if there
+// is one.
+func (m *AssetManifest) Theme(name string) (string, bool) {
+	url, ok := m.themes[name]
+	return url, ok
+}
+
+// Scripts returns the URLs of the scripts, in order of their names.
+func (m *AssetManifest) Scripts() []string {
+	return m.scripts
+}
+
+// ServeHTTP serves assets by their fingerprinted names, as requested under
+// /public/ with the prefix stripped. Other files are not found.
+func (m *AssetManifest) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	name, ok := m.assets[strings.TrimPrefix(r.URL.Path, "/")]
+	if !ok {
+		http.NotFound(w, r)
+		return
 	}
 
-	return "/public/" + scripts[0], nil
+	r = r.Clone(r.Context())
+	r.URL.Path = "/" + name
+
+	http.FileServer(http.FS(m.fsys)).ServeHTTP(w, r)
+}
+
+//nolint:gochecknoglobals
+var embedded = sync.OnceValues(func() (*AssetManifest, error) {
+	return NewAssetManifest(Content)
+})
+
+// Embedded returns the manifest of the assets embedded in the binary, which
+// are fingerprinted once.
+func Embedded() (*AssetManifest, error) {
+	return embedded()
 }
@@ -2,44 +2,68 @@ package www
 
 import (
 	"context"
-	"crypto"
-	"crypto/x509"
 	"encoding/json"
-	"encoding/pem"
 	"errors"
 	"fmt"
 	"io"
+	"mime"
 	"net/http"
+	"net/url"
+	"path"
 	"regexp"
+	"strconv"
 	"strings"
 
 	"github.com/go-chi/chi/v5"
-	"github.com/go-fed/httpsig"
+	"github.com/go-chi/httplog/v2"
 	"github.com/jackc/pgx/v5/pgxpool"
 	ap "github.com/jclem/jclem.me/internal/activitypub"
 	"github.com/jclem/jclem.me/internal/activitypub/identity"
+	"github.com/jclem/jclem.me/internal/cache"
 	"github.com/jclem/jclem.me/internal/database"
+	"github.com/jclem/jclem.me/internal/errorreport"
+	"github.com/jclem/jclem.me/internal/ratelimit"
 	"github.com/jclem/jclem.me/internal/webfinger"
 	"github.com/jclem/jclem.me/internal/www/config"
+	"github.com/jclem/jclem.me/internal/www/view"
 )
 
 type activityInput struct {
-	Context string `json:"@context"`
-	Type    string `json:"type"`
-	ID      string `json:"id"`
-	Actor   string `json:"actor"`
+	Context ap.Context `json:"@context"`
+	Type    string     `json:"type"`
+	ID      string     `json:"id"`
+	Actor   string     `json:"actor"`
 }
 
 type pubRouter struct {
 	*chi.Mux
-	id  *identity.Service
-	pub *ap.Service
+	cfg  config.Config
+	site ap.Site
+	id   *identity.Service
+	pub  *ap.Service
+
+	// view renders the profile pages which browsers are shown rather than
+	// actors. If it is nil, browsers are shown actors.
+	view *view.Service
+
+	inboxLimiter     *ratelimit.Limiter
+	inboxGuard       *inboxGuard
+	outboxLimiter    *ratelimit.Limiter
+	webfingerLimiter *ratelimit.Limiter
+
+	// responses caches actors, objects, and collections, if PubCacheTTL is
+	// positive.
+	responses *cache.Cache[string, cachedResponse]
 }
 
-func newPubRouter() (*pubRouter, error) {
-	pool, err := pgxpool.New(context.Background(), config.DatabaseURL())
-	if err != nil {
-		return nil, fmt.Errorf("failed to connect to database: %w", err)
+// newPubRouter creates a pub router whose services store data in the database.
+// If pool is nil, they keep it in memory, and jobs are recorded but not run.
+func newPubRouter(cfg config.Config, view *view.Service, pool *pgxpool.Pool, jobs ...ap.JobOpt) (*pubRouter, error) {
+	if pool == nil {
+		id := identity.NewServiceWithStore(identity.NewMemoryStore())
+		pub := ap.NewServiceWithStore(cfg, ap.NewMemoryStore())
+
+		return newPubRouterWithServices(cfg, view, id, pub), nil
 	}
 
 	id, err := identity.NewService(pool)
@@ -47,35 +71,88 @@ func newPubRouter() (*pubRouter, error) {
 		return nil, fmt.Errorf("error creating identity service: %w", err)
 	}
 
-	pub, err := ap.NewService(context.Background(), pool, id)
+	pub, err := ap.NewService(cfg, pool, id, jobs...)
 	if err != nil {
 		return nil, fmt.Errorf("error creating activitypub service: %w", err)
 	}
 
+	return newPubRouterWithServices(cfg, view, id, pub), nil
+}
+
+// newPubRouterWithServices creates a pub router which serves identities and
+// activities from the given services, such as services with in-memory stores.
+func newPubRouterWithServices(cfg config.Config, view *view.Service, id *identity.Service, pub *ap.Service) *pubRouter {
 	r := chi.NewRouter()
-	p := &pubRouter{Mux: r, id: id, pub: pub}
-	r.Use(p.setContentType)
-	r.Get("/.well-known/webfinger", p.handleWebfinger)
+	inboxLimiter := newLimiter(cfg.RateLimitInbox)
+	p := &pubRouter{
+		Mux:              r,
+		cfg:              cfg,
+		site:             pub.Site(),
+		id:               id,
+		pub:              pub,
+		view:             view,
+		inboxLimiter:     inboxLimiter,
+		inboxGuard:       newInboxGuard(inboxLimiter, cfg.RateLimitInboxActor, cfg.InboxBanThreshold, cfg.InboxBanDuration),
+		outboxLimiter:    newLimiter(cfg.RateLimitOutbox),
+		webfingerLimiter: newLimiter(cfg.RateLimitWebfinger),
+	}
+
+	if cfg.PubCacheTTL > 0 {
+		p.responses = cache.New[string, cachedResponse](cfg.PubCacheTTL)
+	}
+
+	r.Use(problemDomain(cfg.WebDomain))
+	r.Use(noIndex)
+	r.Use(limitBody(maxBodyBytes))
+
+	if cfg.LogRequestBodies {
+		r.Use(logRequestBodies)
+	}
+
+	r.Get("/.well-known/webfinger", p.webfinger())
+	r.Mount("/oauth", newOAuthRouter(id, view))
+	r.Mount("/~{username}", p.userRouter())
 	r.Mount("/", p.userRouter())
 
-	return p, nil
+	return p
 }
 
 func (p *pubRouter) userRouter() chi.Router { //nolint:ireturn
 	rr := chi.NewRouter()
 	rr.Use(p.ensureUser)
-	rr.Get("/", p.getUser)
-	rr.Get("/notes/{id}", p.getNote)
-	rr.Get("/outbox", p.getOutbox)
-	rr.Get("/followers", p.listFollowers)
-	rr.Get("/following", p.listFollowing)
-	rr.Post("/inbox", p.acceptActivity)
+
+	rr.Group(func(rr chi.Router) {
+		rr.Use(activityPubContent)
+		rr.Use(cacheControl(p.cfg, activityPubCachePolicy))
+		rr.Use(conditionalGet)
+		rr.Use(cacheResponses(p.responses))
+		rr.Get("/", p.getUser)
+		rr.Get("/keys/{version}", p.getPublicKey)
+		rr.Get("/notes/{id}", p.getNote)
+		rr.Get("/outbox", p.getOutbox)
+		rr.Get("/followers", p.listFollowers)
+		rr.Get("/following", p.listFollowing)
+	})
+
+	rr.With(rateLimit(p.webfingerLimiter, byIP), timeout(webfingerTimeout)).Get("/follow", p.remoteFollow)
+
+	rr.With(p.inboxGuard.protect, activityPubContent).Post("/inbox", p.acceptActivity)
 
 	rr.Group(func(rr chi.Router) {
 		rr.Use(p.verifyBearerToken)
+		rr.Use(activityPubContent)
+		rr.Use(rateLimit(p.outboxLimiter, byAPIKey))
+		rr.Use(requireScope(identity.WriteScope))
 		rr.Post("/outbox", p.createActivity)
 	})
 
+	rr.Group(func(rr chi.Router) {
+		rr.Use(p.verifyBearerToken)
+		rr.Use(requireScope(identity.ReadScope))
+		rr.Get("/notifications", p.listNotifications)
+		rr.With(requireScope(identity.WriteScope)).Post("/notifications/read", p.markNotificationsRead)
+	})
+
 	return rr
 }
 
@@ -84,45 +161,103 @@ func (p *pubRouter) createActivity(w http.ResponseWriter, r *http.Request) {
 
 	var note ap.Note
 	if err := json.NewDecoder(r.Body).Decode(&note); err != nil {
-		returnError(r.Context(), w, err, "error decoding note")
+		returnBodyError(r.Context(), w, err, "request body must be a JSON note")
 		return
 	}
 
+	var errs []fieldError
+
 	if note.Type != "Note" {
-		returnCodeError(r.Context(), w, http.StatusUnprocessableEntity, "only Note activities are supported")
-		return
+		errs = append(errs, fieldError{Field: "type", Message: "only Note objects are supported"})
 	}
 
 	if !note.Context.Contains(ap.ActivityStreamsContext) {
-		returnCodeError(r.Context(), w, http.StatusUnprocessableEntity, "only ActivityStreams context is supported")
+		errs = append(errs, fieldError{Field: "@context", Message: "must include the ActivityStreams context"})
+	}
+
+	if len(errs) > 0 {
+		returnValidationError(r.Context(), w, "invalid note", errs...)
+		return
+	}
+
+	a, err := publishNote(r.Context(), p.pub, user, note.Content, note.To, note.Cc)
+	if err != nil {
+		returnError(r.Context(), w, err, "error creating activity")
 		return
 	}
 
-	note = ap.NewNote(user, note.Content, note.To, note.Cc)
-	activity := ap.NewCreateActivity(user, note, note.Published, note.To, note.Cc)
+	w.Header().Set("Location", a.ID)
+	w.WriteHeader(http.StatusCreated)
+
+	writeResponse(w, r, a)
+}
+
+// publishNote creates a note in the user's outbox, which delivers it to the
+// user's followers.
+func publishNote(ctx context.Context, pub *ap.Service, user identity.User, content string, to, cc []string) (*ap.Activity[ap.Note], error) {
+	note := ap.NewNote(pub.Site(), user, content, to, cc)
+	activity := ap.NewCreateActivity(pub.Site(), user, note, note.Published, note.To, note.Cc)
 
 	j, err := json.Marshal(activity)
 	if err != nil {
-		returnError(r.Context(), w, err, "error encoding activity")
-		return
+		return nil, fmt.Errorf("error encoding activity: %w", err)
 	}
 
-	ar, err := p.pub.CreateActivity(r.Context(), user.ID, ap.Outbox, ap.ActivityStreamsContext, activity.Type, activity.ID, j)
+	ar, err := pub.CreateActivity(ctx, user.ID, ap.Outbox, ap.ActivityStreamsContext, activity.Type, activity.ID, j)
 	if err != nil {
-		returnError(r.Context(), w, err, "error creating activity")
-		return
+		return nil, fmt.Errorf("error creating activity: %w", err)
 	}
 
 	a, err := ap.ActivityRecordToActivity[ap.Note](ar)
 	if err != nil {
-		returnError(r.Context(), w, err, "error converting activity record to activity")
-		return
+		return nil, fmt.Errorf("error converting activity record to activity: %w", err)
 	}
 
-	w.Header().Set("Location", a.ID)
-	w.WriteHeader(http.StatusCreated)
+	return a, nil
+}
 
-	writeResponse(w, r, a)
+// publishNoteUpdate publishes an Update activity which replaces the content of
+// one of the user's notes.
+func publishNoteUpdate(ctx context.Context, pub *ap.Service, user identity.User, record ap.NoteRecord, content string) error {
+	note := ap.Note{
+		Context:      ap.NewContext(ap.ActivityStreamsContext, ap.MastodonContext),
+		Type:         "Note",
+		ID:           record.ObjectID,
+		AttributedTo: pub.Site().ActorID(user),
+		Content:      content,
+		Published:    record.Published.UTC().Format(http.TimeFormat),
+		To:           record.To,
+		Cc:           record.Cc,
+	}
+
+	activity := ap.NewUpdateActivity(pub.Site(), user, note, note.To, note.Cc)
+
+	j, err := json.Marshal(activity)
+	if err != nil {
+		return fmt.Errorf("error encoding activity: %w", err)
+	}
+
+	if _, err := pub.CreateActivity(ctx, user.ID, ap.Outbox, ap.ActivityStreamsContext, activity.Type, activity.ID, j); err != nil {
+		return fmt.Errorf("error creating activity: %w", err)
+	}
+
+	return nil
+}
+
+// publishNoteDelete publishes a Delete activity for one of the user's notes.
+func publishNoteDelete(ctx context.Context, pub *ap.Service, user identity.User, record ap.NoteRecord) error {
+	activity := ap.NewDeleteActivity(pub.Site(), user, record.ObjectID, record.To, record.Cc)
+
+	j, err := json.Marshal(activity)
+	if err != nil {
+		return fmt.Errorf("error encoding activity: %w", err)
+	}
+
+	if _, err := pub.CreateActivity(ctx, user.ID, ap.Outbox, ap.ActivityStreamsContext, activity.Type, activity.ID, j); err != nil {
+		return fmt.Errorf("error creating activity: %w", err)
+	}
+
+	return nil
 }
 
 func (p *pubRouter) acceptActivity(w http.ResponseWriter, r *http.Request) {
@@ -130,22 +265,47 @@ func (p *pubRouter) acceptActivity(w http.ResponseWriter, r *http.Request) {
 
 	b, err := io.ReadAll(r.Body)
 	if err != nil {
-		returnError(r.Context(), w, err, "error reading body")
+		returnBodyError(r.Context(), w, err, "error reading body")
 		return
 	}
 
 	var activity activityInput
 	if err := json.Unmarshal(b, &activity); err != nil {
-		returnError(r.Context(), w, err, "error decoding activity")
+		returnBadRequest(r.Context(), w, "request body must be a JSON activity")
+		return
+	}
+
+	// The signer is the owner of the signing key, which must be the actor the
+	// activity claims, so that no one can send activities as another.
+	signer, err := ap.VerifyRequest(r.Context(), r)
+	if err == nil && signer != activity.Actor {
+		err = fmt.Errorf("activity's actor %q is not the key's owner %q", activity.Actor, signer)
+	}
+
+	if err != nil {
+		oplog := httplog.LogEntry(r.Context())
+		oplog.InfoContext(r.Context(), "rejected request with invalid signature", "error", err)
+
+		if errors.Is(err, ap.ErrKeyUnavailable) {
+			setRejectionReason(r, keyUnavailable)
+		}
+
+		returnProblem(r.Context(), w, problem{
+			Type:   problemTypeUnauthorized,
+			Status: http.StatusUnauthorized,
+			Detail: "request must bear a valid HTTP signature from the activity's actor",
+		})
+
 		return
 	}
 
-	if err := p.verifySignedRequest(r, activity.Actor); err != nil {
-		returnError(r.Context(), w, err, "error verifying request")
+	// Actors are limited once their signatures are verified, so that no one
+	// can use up another's limit.
+	if !p.inboxGuard.allowActor(w, r, activity.Actor) {
 		return
 	}
 
-	ar, err := p.pub.CreateActivity(r.Context(), user.ID, ap.Inbox, activity.Context, activity.Type, activity.ID, b)
+	ar, err := p.pub.CreateActivity(r.Context(), user.ID, ap.Inbox, activity.Context.Base(), activity.Type, activity.ID, b)
 	if err != nil {
 		returnError(r.Context(), w, err, "error creating activity")
 		return
@@ -157,17 +317,19 @@ func (p *pubRouter) acceptActivity(w http.ResponseWriter, r *http.Request) {
 }
 
 func (p *pubRouter) getNote(w http.ResponseWriter, r *http.Request) {
+	user := r.Context().Value(userContextKey).(identity.User) //nolint:forceTypeAssert
+
 	id := chi.URLParam(r, "id")
 	ulid, err := database.ParseULID(id)
 	if err != nil {
-		returnCodeError(r.Context(), w, http.StatusBadRequest, "invalid note id")
+		returnBadRequest(r.Context(), w, "invalid note id")
 		return
 	}
 
-	note, err := p.pub.GetNoteByID(r.Context(), ulid)
+	note, err := p.pub.GetNoteByID(r.Context(), user.ID, ulid)
 	if err != nil {
 		if errors.Is(err, ap.ErrNoteNotFound) {
-			returnCodeError(r.Context(), w, http.StatusNotFound, "note not found")
+			returnNotFound(r.Context(), w, "note not found")
 			return
 		}
 
@@ -178,10 +340,40 @@ func (p *pubRouter) getNote(w http.ResponseWriter, r *http.Request) {
 	writeResponse(w, r, note)
 }
 
+// outboxPageSize is the number of activities on each page of an outbox.
+const outboxPageSize = 20
+
+// getOutbox serves a user's outbox. Without a page parameter, it serves the
+// collection, which links to its first page. Otherwise, it serves that page.
 func (p *pubRouter) getOutbox(w http.ResponseWriter, r *http.Request) {
 	user := r.Context().Value(userContextKey).(identity.User) //nolint:forceTypeAssert
+	outbox := p.site.ActorOutbox(user)
+
+	param := r.URL.Query().Get("page")
+	if param == "" {
+		_, total, err := p.pub.ListPublicOutbox(r.Context(), user.ID, 1, 0)
+		if err != nil {
+			returnError(r.Context(), w, err, "error listing outbox")
+			return
+		}
+
+		collection := ap.NewCollection[*ap.Activity[ap.Note]](outbox, nil)
+		collection.TotalItems = total
+		collection.First = outboxPage(outbox, 1)
 
-	items, err := p.pub.ListPublicOutbox(r.Context(), user.ID)
+		writeResponse(w, r, collection)
+		return
+	}
+
+	page, err := strconv.Atoi(param)
+	if err != nil || page < 1 {
+		returnBadRequest(r.Context(), w, "page must be a positive integer")
+		return
+	}
+
+	offset := (page - 1) * outboxPageSize
+
+	items, total, err := p.pub.ListPublicOutbox(r.Context(), user.ID, outboxPageSize, offset)
 	if err != nil {
 		returnError(r.Context(), w, err, "error listing outbox")
 		return
@@ -199,8 +391,22 @@ func (p *pubRouter) getOutbox(w http.ResponseWriter, r *http.Request) {
 		itemObjects = append(itemObjects, itemObject)
 	}
 
-	collection := ap.NewCollection(ap.ActorOutbox(user), itemObjects)
-	writeResponse(w, r, collection)
+	collectionPage := ap.NewCollectionPage(outboxPage(outbox, page), outbox, total, itemObjects)
+
+	if offset+len(items) < total {
+		collectionPage.Next = outboxPage(outbox, page+1)
+	}
+
+	if page > 1 {
+		collectionPage.Prev = outboxPage(outbox, page-1)
+	}
+
+	writeResponse(w, r, collectionPage)
+}
+
+// outboxPage returns the URL of a page of an outbox.
+func outboxPage(outbox string, page int) string {
+	return outbox + "?page=" + strconv.Itoa(page)
 }
 
 func (p *pubRouter) listFollowers(w http.ResponseWriter, r *http.Request) {
@@ -217,34 +423,49 @@ func (p *pubRouter) listFollowers(w http.ResponseWriter, r *http.Request) {
 		followerIDs = append(followerIDs, follower.ActorID)
 	}
 
-	collection := ap.NewCollection(ap.ActorFollowers(user), followerIDs)
+	collection := ap.NewCollection(p.site.ActorFollowers(user), followerIDs)
 	writeResponse(w, r, collection)
 }
 
 func (p *pubRouter) listFollowing(w http.ResponseWriter, r *http.Request) {
 	user := r.Context().Value(userContextKey).(identity.User) //nolint:forceTypeAssert
 
-	collection := ap.NewCollection(ap.ActorFollowing(user), []string{})
+	following, err := p.pub.ListFollowing(r.Context(), user.ID)
+	if err != nil {
+		returnError(r.Context(), w, err, "error listing following")
+		return
+	}
+
+	if following == nil {
+		following = []string{}
+	}
+
+	collection := ap.NewCollection(p.site.ActorFollowing(user), following)
 	writeResponse(w, r, collection)
 }
 
+// webfinger returns the rate-limited webfinger handler.
+func (p *pubRouter) webfinger() http.HandlerFunc {
+	return rateLimit(p.webfingerLimiter, byIP)(timeout(webfingerTimeout)(http.HandlerFunc(p.handleWebfinger))).ServeHTTP
+}
+
 var webfingerResourceRegex = regexp.MustCompile(`^acct:([^@]+)@([^@]+)$`)
 
 func (p *pubRouter) handleWebfinger(w http.ResponseWriter, r *http.Request) {
 	resource := r.URL.Query().Get("resource")
 	if resource == "" {
-		returnCodeError(r.Context(), w, http.StatusBadRequest, "missing resource parameter")
+		returnBadRequest(r.Context(), w, "missing resource parameter")
 		return
 	}
 
 	parts := webfingerResourceRegex.FindStringSubmatch(resource)
 	if len(parts) != 3 {
-		returnCodeError(r.Context(), w, http.StatusBadRequest, "invalid resource parameter")
+		returnBadRequest(r.Context(), w, "invalid resource parameter")
 		return
 	}
 
-	if domain := parts[2]; domain != ap.Domain {
-		returnCodeError(r.Context(), w, http.StatusNotFound, "user not found")
+	if domain := parts[2]; domain != p.site.Domain {
+		returnNotFound(r.Context(), w, "user not found")
 		return
 	}
 
@@ -253,7 +474,7 @@ func (p *pubRouter) handleWebfinger(w http.ResponseWriter, r *http.Request) {
 	user, err := p.id.GetUserByUsername(r.Context(), username)
 	if err != nil {
 		if errors.Is(err, identity.ErrUserNotFound) {
-			returnCodeError(r.Context(), w, http.StatusNotFound, fmt.Sprintf("user not found: %q", username))
+			returnNotFound(r.Context(), w, fmt.Sprintf("user not found: %q", username))
 			return
 		}
 
@@ -261,36 +482,82 @@ func (p *pubRouter) handleWebfinger(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	writeResponse(w, r, webfinger.JRD{
-		Subject: resource,
-		Aliases: []string{ap.ActorID(user)},
-		Links: []webfinger.Link{
-			{
-				Rel:  "self",
-				Type: ap.ContentType,
-				Href: ap.ActorID(user),
-			},
+	// The profile page is the actor, which is served as HTML to browsers.
+	links := []webfinger.Link{
+		{
+			Rel:  webfinger.SelfRel,
+			Type: ap.ContentType,
+			Href: p.site.ActorID(user),
 		},
-	})
-}
+		{
+			Rel:  webfinger.ProfilePageRel,
+			Type: "text/html",
+			Href: p.site.ActorID(user),
+		},
+	}
 
-func (p *pubRouter) setContentType(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Content-Type", ap.ContentType)
-		next.ServeHTTP(w, r)
-	})
+	if user.ImageURL != "" {
+		links = append(links, webfinger.Link{
+			Rel:  webfinger.AvatarRel,
+			Type: imageType(user.ImageURL),
+			Href: user.ImageURL,
+		})
+	}
+
+	jrd := webfinger.JRD{
+		Subject: resource,
+		Aliases: []string{p.site.ActorID(user)},
+		Links:   links,
+	}
+
+	w.Header().Set("Content-Type", webfinger.ContentType)
+
+	writeResponse(w, r, jrd.FilterLinks(r.URL.Query()["rel"]))
 }
 
-const username = "jclem"
+// imageType returns the media type of an image from its URL's extension, or
+// "" if it is unknown.
+func imageType(imageURL string) string {
+	u, err := url.Parse(imageURL)
+	if err != nil {
+		return ""
+	}
 
+	mediaType, _, _ := mime.ParseMediaType(mime.TypeByExtension(path.Ext(u.Path)))
+	if !strings.HasPrefix(mediaType, "image/") {
+		return ""
+	}
+
+	return mediaType
+}
+
+// ensureUser loads the user named in the path, or the default user if the
+// request is not for a specific user.
 func (p *pubRouter) ensureUser(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		username := chi.URLParam(r, "username")
+		if username == "" {
+			username = p.cfg.DefaultUser
+		}
+
+		// Deleted users are gone rather than not found, so that other servers
+		// stop delivering to them. Either way, nothing is accepted or queued.
 		user, err := p.id.GetUserByUsername(r.Context(), username)
 		if err != nil {
-			returnCodeError(r.Context(), w, http.StatusNotFound, fmt.Sprintf("user not found: %q", username))
+			switch {
+			case errors.Is(err, identity.ErrUserDeleted):
+				returnProblem(r.Context(), w, problem{Status: http.StatusGone, Detail: fmt.Sprintf("user deleted: %q", username)})
+			case errors.Is(err, identity.ErrUserNotFound):
+				returnNotFound(r.Context(), w, fmt.Sprintf("user not found: %q", username))
+			default:
+				returnError(r.Context(), w, err, "error getting user")
+			}
+
 			return
 		}
 
+		errorreport.SetUser(r.Context(), errorreport.User{ID: user.ID.String(), Username: user.Username})
+
 		ctx := context.WithValue(r.Context(), userContextKey, user)
 		next.ServeHTTP(w, r.WithContext(ctx))
 	})
@@ -299,100 +566,114 @@ func (p *pubRouter) ensureUser(next http.Handler) http.Handler {
 var bearerTokenRegex = regexp.MustCompile(`^Bearer (\S+)$`)
 var userContextKey = struct{}{} //nolint:gochecknoglobals
 
+type apiKeyContextKeyType struct{}
+
+var apiKeyContextKey = apiKeyContextKeyType{} //nolint:gochecknoglobals
+
 func (p *pubRouter) verifyBearerToken(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		auth := r.Header.Get("Authorization")
 		if auth == "" {
-			returnCodeError(r.Context(), w, http.StatusUnauthorized, "no authorization header")
+			returnUnauthorized(r.Context(), w, "no authorization header")
 			return
 		}
 
 		parts := bearerTokenRegex.FindStringSubmatch(auth)
 		if len(parts) != 2 {
-			returnCodeError(r.Context(), w, http.StatusUnauthorized, "invalid authorization header")
+			returnUnauthorized(r.Context(), w, "invalid authorization header")
 			return
 		}
 
-		user, err := p.id.ValidateAPIKey(r.Context(), parts[1])
+		user, key, err := p.id.ValidateAPIKey(r.Context(), parts[1])
 		if err != nil {
-			returnCodeError(r.Context(), w, http.StatusUnauthorized, "invalid authorization header")
+			returnUnauthorized(r.Context(), w, "invalid authorization header")
+			return
+		}
+
+		if pathUser, ok := r.Context().Value(userContextKey).(identity.User); ok && pathUser.ID != user.ID {
+			returnForbidden(r.Context(), w, "token does not belong to this user")
 			return
 		}
 
+		errorreport.SetUser(r.Context(), errorreport.User{ID: user.ID.String(), Username: user.Username})
+
 		ctx := context.WithValue(r.Context(), userContextKey, user)
+		ctx = context.WithValue(ctx, apiKeyContextKey, key)
 		next.ServeHTTP(w, r.WithContext(ctx))
 	})
 }
 
-func (p *pubRouter) verifySignedRequest(r *http.Request, actorID string) error {
-	actor, err := ap.GetActor(r.Context(), actorID)
-	if err != nil {
-		return fmt.Errorf("error getting actor: %w", err)
-	}
+// requireScope rejects requests whose verified bearer token was not granted the
+// given scope.
+func requireScope(scope string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			key, ok := r.Context().Value(apiKeyContextKey).(identity.APIKey)
+			if !ok || !key.HasScope(scope) {
+				returnForbidden(r.Context(), w, "token does not have the "+scope+" scope")
+				return
+			}
 
-	key, _ := pem.Decode([]byte(actor.PublicKey.PublicKeyPem))
-	if key == nil {
-		return errors.New("error decoding public key")
+			next.ServeHTTP(w, r)
+		})
 	}
+}
 
-	pkeyAny, err := x509.ParsePKIXPublicKey(key.Bytes)
-	if err != nil {
-		return fmt.Errorf("error parsing public key: %w", err)
-	}
+func (p *pubRouter) getUser(w http.ResponseWriter, r *http.Request) {
+	user := r.Context().Value(userContextKey).(identity.User) //nolint:forceTypeAssert
 
-	pubKey, knownAlgo := pkeyAny.(crypto.PublicKey)
-	if !knownAlgo {
-		return errors.New("error casting public key")
+	if p.view != nil && negotiate(r, ap.ContentType, ldJSONContentType, htmlContentType) == htmlContentType {
+		p.renderProfile(w, r, user, http.StatusOK, "", "")
+		return
 	}
 
-	verifier, err := httpsig.NewVerifier(r)
+	// Rotated keys are published until they expire, so that servers which
+	// verify signatures against the actor's keys accept requests which were
+	// signed before a rotation.
+	pubKeys, err := p.id.GetPublicKeys(r.Context(), user.ID)
 	if err != nil {
-		return fmt.Errorf("error creating verifier: %w", err)
-	}
-
-	if actor.PublicKey.ID != verifier.KeyId() {
-		return errors.New("invalid key id")
-	}
-
-	algorithmRegex := regexp.MustCompile(`algorithm="([^"]+)"`)
-	algorithm := algorithmRegex.FindStringSubmatch(r.Header.Get("Signature"))
-	if len(algorithm) != 2 {
-		return errors.New("invalid algorithm")
+		returnError(r.Context(), w, err, "error getting public keys")
+		return
 	}
 
-	algoName := strings.ToLower(algorithm[1])
-
-	algo, knownAlgo := map[string]httpsig.Algorithm{
-		"rsa-sha256": httpsig.RSA_SHA256,
-	}[algoName]
-
-	if !knownAlgo {
-		return errors.New("invalid algorithm")
+	actor, err := p.site.ActorFromUser(user, pubKeys...)
+	if err != nil {
+		returnNotFound(r.Context(), w, fmt.Sprintf("user not found: %q", user.Username))
+		return
 	}
 
-	if err := verifier.Verify(pubKey, algo); err != nil {
-		return fmt.Errorf("error verifying request: %w", err)
-	}
+	writeResponse(w, r, actor)
+}
 
-	return nil
+type publicKeyResponse struct {
+	Context ap.Context `json:"@context"`
+	ap.PublicKey
 }
 
-func (p *pubRouter) getUser(w http.ResponseWriter, r *http.Request) {
+func (p *pubRouter) getPublicKey(w http.ResponseWriter, r *http.Request) {
 	user := r.Context().Value(userContextKey).(identity.User) //nolint:forceTypeAssert
 
-	pubKey, err := p.id.GetPublicKey(r.Context(), user.ID)
+	version, err := strconv.Atoi(chi.URLParam(r, "version"))
 	if err != nil {
-		returnError(r.Context(), w, err, "error getting public key")
+		returnNotFound(r.Context(), w, "key not found")
 		return
 	}
 
-	actor, err := ap.ActorFromUser(user, pubKey)
+	pubKey, err := p.id.GetPublicKeyByVersion(r.Context(), user.ID, version)
 	if err != nil {
-		returnCodeError(r.Context(), w, http.StatusNotFound, fmt.Sprintf("user not found: %q", user.Username))
+		if errors.Is(err, identity.ErrSigningKeyNotFound) {
+			returnNotFound(r.Context(), w, "key not found")
+			return
+		}
+
+		returnError(r.Context(), w, err, "error getting public key")
 		return
 	}
 
-	writeResponse(w, r, actor)
+	writeResponse(w, r, publicKeyResponse{
+		Context:   ap.NewContext(ap.SecurityContext),
+		PublicKey: p.site.NewPublicKey(user, pubKey),
+	})
 }
 
 func writeResponse(w http.ResponseWriter, r *http.Request, resp interface{}) {
@@ -0,0 +1,491 @@
+package www
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	ap "github.com/jclem/jclem.me/internal/activitypub"
+	"github.com/jclem/jclem.me/internal/activitypub/identity"
+	"github.com/jclem/jclem.me/internal/client"
+	"github.com/jclem/jclem.me/internal/webfinger"
+	"github.com/jclem/jclem.me/internal/www/config"
+)
+
+//nolint:gochecknoglobals
+var testConfig = config.Config{
+	AppEnv:               config.Development,
+	Port:                 "8080",
+	PubDomain:            "pub.example.com",
+	WebDomain:            "www.example.com",
+	DefaultUser:          "alice",
+	APIKey:               "admin-key",
+	QueueInboxWorkers:    1,
+	QueueDeliveryWorkers: 1,
+	QueueMediaWorkers:    1,
+	QueuePeriodicWorkers: 1,
+}
+
+// testPub is a pub router whose services keep their data in memory.
+type testPub struct {
+	*pubRouter
+	store   *ap.MemoryStore
+	idStore *identity.MemoryStore
+	user    identity.User
+	apiKey  string
+}
+
+func newTestPub(t *testing.T) testPub {
+	t.Helper()
+
+	store := ap.NewMemoryStore()
+	idStore := identity.NewMemoryStore()
+	id := identity.NewServiceWithStore(idStore)
+
+	user, apiKey, err := id.CreateUser(context.Background(), identity.NewUser{Username: "alice", Name: "Alice"})
+	if err != nil {
+		t.Fatalf("error creating user: %v", err)
+	}
+
+	return testPub{
+		pubRouter: newPubRouterWithServices(testConfig, nil, id, ap.NewServiceWithStore(testConfig, store)),
+		store:     store,
+		idStore:   idStore,
+		user:      user,
+		apiKey:    apiKey,
+	}
+}
+
+// appToken issues an access token to a new OAuth app with the given scopes.
+func (p testPub) appToken(t *testing.T, scopes string) string {
+	t.Helper()
+
+	ctx := context.Background()
+
+	app, err := p.id.CreateApp(ctx, identity.NewApp{Name: "app", RedirectURIs: []string{"https://app.example.com/callback"}, Scopes: scopes})
+	if err != nil {
+		t.Fatalf("error creating app: %v", err)
+	}
+
+	code, err := p.id.CreateAuthorizationCode(ctx, identity.AuthorizationRequest{App: app, UserID: p.user.ID, RedirectURI: app.RedirectURIs[0], Scopes: scopes})
+	if err != nil {
+		t.Fatalf("error creating authorization code: %v", err)
+	}
+
+	token, err := p.id.ExchangeAuthorizationCode(ctx, identity.TokenRequest{ClientID: app.ID.String(), ClientSecret: app.ClientSecret, Code: code, RedirectURI: app.RedirectURIs[0]})
+	if err != nil {
+		t.Fatalf("error exchanging authorization code: %v", err)
+	}
+
+	return token.Token
+}
+
+func serve(h http.Handler, method, target, token, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+
+	return w
+}
+
+func decode[T any](t *testing.T, w *httptest.ResponseRecorder) T {
+	t.Helper()
+
+	var v T
+	if err := json.NewDecoder(w.Body).Decode(&v); err != nil {
+		t.Fatalf("error decoding response: %v", err)
+	}
+
+	return v
+}
+
+func TestWebfinger(t *testing.T) {
+	p := newTestPub(t)
+
+	w := serve(p, http.MethodGet, "/.well-known/webfinger?resource=acct:alice@pub.example.com", "", "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", w.Code, w.Body)
+	}
+
+	if ct := w.Header().Get("Content-Type"); ct != webfinger.ContentType {
+		t.Errorf("expected content type %q, got %q", webfinger.ContentType, ct)
+	}
+
+	jrd := decode[struct {
+		Links []struct {
+			Rel  string `json:"rel"`
+			Href string `json:"href"`
+		} `json:"links"`
+	}](t, w)
+
+	if len(jrd.Links) != 2 || jrd.Links[0].Rel != "self" || jrd.Links[0].Href != "https://pub.example.com" ||
+		jrd.Links[1].Rel != webfinger.ProfilePageRel || jrd.Links[1].Href != "https://pub.example.com" {
+		t.Errorf("unexpected links: %+v", jrd.Links)
+	}
+
+	imageURL := "https://cdn.example.com/alice.png"
+	if _, err := p.id.UpdateUser(context.Background(), p.user.ID, identity.UserUpdate{ImageURL: &imageURL}); err != nil {
+		t.Fatalf("error updating user: %v", err)
+	}
+
+	// Links are filtered by any rel parameters. The avatar's type is that of
+	// its extension.
+	for _, tc := range []struct {
+		query string
+		want  []string
+	}{
+		{"", []string{"self", webfinger.ProfilePageRel, webfinger.AvatarRel + " image/png"}},
+		{"&rel=self", []string{"self"}},
+		{"&rel=self&rel=" + webfinger.AvatarRel, []string{"self", webfinger.AvatarRel + " image/png"}},
+		{"&rel=https://example.com/unknown", []string{}},
+	} {
+		w := serve(p, http.MethodGet, "/.well-known/webfinger?resource=acct:alice@pub.example.com"+tc.query, "", "")
+
+		got := []string{}
+		for _, link := range decode[webfinger.JRD](t, w).Links {
+			if link.Rel == webfinger.AvatarRel {
+				got = append(got, link.Rel+" "+link.Type)
+			} else {
+				got = append(got, link.Rel)
+			}
+		}
+
+		if !slices.Equal(got, tc.want) {
+			t.Errorf("%q: expected links %q, got %q", tc.query, tc.want, got)
+		}
+	}
+
+	for resource, status := range map[string]int{
+		"acct:bob@pub.example.com":   http.StatusNotFound,
+		"acct:alice@elsewhere.com":   http.StatusNotFound,
+		"https://pub.example.com/~a": http.StatusBadRequest,
+	} {
+		if w := serve(p, http.MethodGet, "/.well-known/webfinger?resource="+resource, "", ""); w.Code != status {
+			t.Errorf("%s: expected status %d, got %d", resource, status, w.Code)
+		}
+	}
+}
+
+func TestGetUser(t *testing.T) {
+	p := newTestPub(t)
+
+	if _, err := p.id.RotateKeys(context.Background(), p.user.ID, identity.DefaultKeyGracePeriod); err != nil {
+		t.Fatalf("error rotating keys: %v", err)
+	}
+
+	w := serve(p, http.MethodGet, "/", "", "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", w.Code, w.Body)
+	}
+
+	actor := decode[ap.Actor](t, w)
+
+	if actor.ID != "https://pub.example.com" {
+		t.Errorf("expected actor ID %q, got %q", "https://pub.example.com", actor.ID)
+	}
+
+	// The rotated key is published until it expires.
+	if len(actor.PublicKey) != 2 {
+		t.Fatalf("expected 2 public keys, got %d", len(actor.PublicKey))
+	}
+
+	if !strings.HasSuffix(actor.PublicKey[0].ID, "/keys/2") {
+		t.Errorf("expected the current key first, got %q", actor.PublicKey[0].ID)
+	}
+
+	if w := serve(p, http.MethodGet, "/~bob", "", ""); w.Code != http.StatusNotFound {
+		t.Errorf("expected status 404 for unknown user, got %d", w.Code)
+	}
+}
+
+func TestRoutersUseTheirOwnConfig(t *testing.T) {
+	p := newTestPub(t)
+
+	cfg := testConfig
+	cfg.AppEnv = config.Production
+	cfg.PubDomain = "pub.example.org"
+	cfg.WebDomain = "www.example.org"
+	prod := newPubRouterWithServices(cfg, nil, p.id, ap.NewServiceWithStore(cfg, p.store))
+
+	for _, tt := range []struct {
+		router       http.Handler
+		actorID      string
+		cacheControl string
+		problemType  string
+	}{
+		{p, "https://pub.example.com", "no-cache", "https://www.example.com/problems/unauthorized"},
+		{prod, "https://pub.example.org", activityPubCachePolicy.String(), "https://www.example.org/problems/unauthorized"},
+	} {
+		w := serve(tt.router, http.MethodGet, "/", "", "")
+		if actor := decode[ap.Actor](t, w); actor.ID != tt.actorID {
+			t.Errorf("expected actor ID %q, got %q", tt.actorID, actor.ID)
+		}
+
+		if got := w.Header().Get("Cache-Control"); got != tt.cacheControl {
+			t.Errorf("expected Cache-Control %q, got %q", tt.cacheControl, got)
+		}
+
+		w = serve(tt.router, http.MethodPost, "/outbox", "", "{}")
+		if got := decode[problem](t, w).Type; got != tt.problemType {
+			t.Errorf("expected problem type %q, got %q", tt.problemType, got)
+		}
+	}
+}
+
+func TestGetUserProfile(t *testing.T) {
+	p := newTestPub(t)
+
+	wr, err := newWebRouter(context.Background(), testConfig, nil, nil)
+	if err != nil {
+		t.Fatalf("error creating web router: %v", err)
+	}
+
+	p.view = wr.view
+
+	if _, err := publishNote(context.Background(), p.pub, p.user, "Hello, world", []string{ap.PublicNS}, nil); err != nil {
+		t.Fatalf("error publishing note: %v", err)
+	}
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set("Accept", "text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8")
+
+	w := httptest.NewRecorder()
+	p.ServeHTTP(w, r)
+
+	if w.Code != http.StatusOK || w.Header().Get("Content-Type") != htmlContentType {
+		t.Fatalf("expected an HTML page, got %d %q: %s", w.Code, w.Header().Get("Content-Type"), w.Body)
+	}
+
+	for _, want := range []string{"Alice", "@alice@pub.example.com", "Hello, world", `action="https://pub.example.com/follow"`} {
+		if !strings.Contains(w.Body.String(), want) {
+			t.Errorf("expected %q in %s", want, w.Body)
+		}
+	}
+
+	// ActivityPub clients are still sent the actor.
+	r.Header.Set("Accept", ap.ContentType)
+
+	w = httptest.NewRecorder()
+	p.ServeHTTP(w, r)
+
+	if actor := decode[ap.Actor](t, w); actor.URL != actor.ID {
+		t.Errorf("expected the actor's URL to be its ID, got %q", actor.URL)
+	}
+
+	if w := serve(p, http.MethodGet, "/follow", "", ""); w.Code != http.StatusUnprocessableEntity {
+		t.Errorf("expected status 422 without an account, got %d", w.Code)
+	}
+}
+
+func TestActivityPubCaching(t *testing.T) {
+	p := newTestPub(t)
+
+	cfg := testConfig
+	cfg.PubCacheTTL = time.Minute
+	cached := newPubRouterWithServices(cfg, nil, p.id, p.pub)
+
+	w := serve(cached, http.MethodGet, "/followers", "", "")
+
+	etag := w.Header().Get("ETag")
+	if w.Code != http.StatusOK || etag == "" {
+		t.Fatalf("expected a 200 response with an ETag, got %d %q", w.Code, etag)
+	}
+
+	r := httptest.NewRequest(http.MethodGet, "/followers", nil)
+	r.Header.Set("If-None-Match", etag)
+
+	w = httptest.NewRecorder()
+	cached.ServeHTTP(w, r)
+
+	if w.Code != http.StatusNotModified {
+		t.Errorf("expected status 304 for a matching ETag, got %d", w.Code)
+	}
+
+	if _, err := p.pub.CreateFollower(context.Background(), p.user.ID, "https://remote.example.com/bob", "https://remote.example.com/follows/1"); err != nil {
+		t.Fatalf("error creating follower: %v", err)
+	}
+
+	// The cached collection is served until it expires.
+	if w := serve(cached, http.MethodGet, "/followers", "", ""); decode[ap.OrderedCollection[string]](t, w).TotalItems != 0 {
+		t.Error("expected the cached collection to be served")
+	}
+
+	if w := serve(p, http.MethodGet, "/followers", "", ""); w.Header().Get("ETag") == etag {
+		t.Error("expected the uncached collection's ETag to change")
+	}
+}
+
+func TestCreateActivity(t *testing.T) {
+	p := newTestPub(t)
+	ctx := context.Background()
+
+	if _, err := p.pub.CreateFollower(ctx, p.user.ID, "https://remote.example.com/bob", "https://remote.example.com/follows/1"); err != nil {
+		t.Fatalf("error creating follower: %v", err)
+	}
+
+	note := `{"@context":"https://www.w3.org/ns/activitystreams","type":"Note","content":"Hello","to":["https://www.w3.org/ns/activitystreams#Public"]}`
+
+	tests := []struct {
+		name   string
+		token  string
+		status int
+	}{
+		{"no token", "", http.StatusUnauthorized},
+		{"invalid token", "invalid.token", http.StatusUnauthorized},
+		{"app token without write scope", p.appToken(t, "read"), http.StatusForbidden},
+		{"app token with write scope", p.appToken(t, "read write"), http.StatusCreated},
+		{"user token", p.apiKey, http.StatusCreated},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if w := serve(p, http.MethodPost, "/outbox", tt.token, note); w.Code != tt.status {
+				t.Errorf("expected status %d, got %d: %s", tt.status, w.Code, w.Body)
+			}
+		})
+	}
+
+	notes, err := p.pub.ListNotes(ctx, p.user.ID)
+	if err != nil {
+		t.Fatalf("error listing notes: %v", err)
+	}
+
+	if len(notes) != 2 {
+		t.Fatalf("expected 2 notes, got %d", len(notes))
+	}
+
+	var deliveries int
+
+	for _, job := range p.store.Jobs() {
+		if args, ok := job.(ap.HandleOutboxArgs); ok && args.FollowerID == "https://remote.example.com/bob" {
+			deliveries++
+		}
+	}
+
+	if deliveries != 2 {
+		t.Errorf("expected 2 deliveries to the follower, got %d", deliveries)
+	}
+
+	outbox := decode[ap.OrderedCollection[json.RawMessage]](t, serve(p, http.MethodGet, "/outbox", "", ""))
+	if outbox.TotalItems != 2 {
+		t.Errorf("expected 2 outbox items, got %d", outbox.TotalItems)
+	}
+}
+
+func TestClientPostNote(t *testing.T) {
+	p := newTestPub(t)
+	srv := httptest.NewServer(p)
+	t.Cleanup(srv.Close)
+
+	to, cc, err := ap.VisibilityUnlisted.Addressing(p.site.ActorFollowers(p.user), nil)
+	if err != nil {
+		t.Fatalf("error addressing note: %v", err)
+	}
+
+	activity, err := client.New(p.site, srv.URL, p.apiKey).PostNote(context.Background(), p.user, ap.Note{Content: "<p>Hello</p>", To: to, Cc: cc})
+	if err != nil {
+		t.Fatalf("error posting note: %v", err)
+	}
+
+	if activity.Object.Content != "<p>Hello</p>" || !slices.Contains(activity.Object.Cc, ap.PublicNS) {
+		t.Errorf("unexpected note: %+v", activity.Object)
+	}
+
+	// Unlisted notes are not listed in the public outbox.
+	if outbox := decode[ap.OrderedCollection[json.RawMessage]](t, serve(p, http.MethodGet, "/outbox", "", "")); outbox.TotalItems != 0 {
+		t.Errorf("expected no outbox items, got %d", outbox.TotalItems)
+	}
+
+	var apiErr *client.Error
+	if _, err := client.New(p.site, srv.URL, "invalid.token").PostNote(context.Background(), p.user, ap.Note{Content: "<p>Hello</p>", To: to}); !errors.As(err, &apiErr) || apiErr.Status != http.StatusUnauthorized {
+		t.Errorf("expected a 401 error, got %v", err)
+	}
+}
+
+func TestListFollowers(t *testing.T) {
+	p := newTestPub(t)
+	ctx := context.Background()
+
+	for i, actorID := range []string{"https://remote.example.com/bob", "https://remote.example.com/carol", "https://remote.example.com/bob"} {
+		if _, err := p.pub.CreateFollower(ctx, p.user.ID, actorID, fmt.Sprintf("%s/follows/%d", actorID, i)); err != nil {
+			t.Fatalf("error creating follower: %v", err)
+		}
+	}
+
+	// A repeated follow replaces the follower's activity rather than adding
+	// another follower.
+	records, err := p.pub.ListFollowers(ctx, p.user.ID)
+	if err != nil {
+		t.Fatalf("error listing followers: %v", err)
+	}
+
+	if len(records) != 2 || records[0].ActivityID != "https://remote.example.com/bob/follows/2" {
+		t.Errorf("unexpected followers: %+v", records)
+	}
+
+	w := serve(p, http.MethodGet, "/followers", "", "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", w.Code, w.Body)
+	}
+
+	followers := decode[ap.OrderedCollection[string]](t, w)
+	if followers.TotalItems != 2 {
+		t.Errorf("expected 2 followers, got %d: %v", followers.TotalItems, followers.OrderedItems)
+	}
+
+	for _, want := range []bool{true, false} {
+		if deleted, err := p.pub.DeleteFollower(ctx, p.user.ID, "https://remote.example.com/carol"); err != nil || deleted != want {
+			t.Errorf("expected deleted to be %t, got %t, %v", want, deleted, err)
+		}
+	}
+}
+
+func TestGetOutbox(t *testing.T) {
+	p := newTestPub(t)
+	ctx := context.Background()
+
+	for i := 0; i < outboxPageSize+5; i++ {
+		if _, err := publishNote(ctx, p.pub, p.user, fmt.Sprintf("Note %d", i), []string{ap.PublicNS}, nil); err != nil {
+			t.Fatalf("error publishing note: %v", err)
+		}
+	}
+
+	// Notes which are not addressed to the public are not in the outbox.
+	if _, err := publishNote(ctx, p.pub, p.user, "Private", []string{p.site.ActorFollowers(p.user)}, nil); err != nil {
+		t.Fatalf("error publishing note: %v", err)
+	}
+
+	outbox := decode[ap.OrderedCollection[json.RawMessage]](t, serve(p, http.MethodGet, "/outbox", "", ""))
+	if outbox.TotalItems != outboxPageSize+5 || outbox.First != "https://pub.example.com/outbox?page=1" || len(outbox.OrderedItems) != 0 {
+		t.Errorf("unexpected outbox: %+v", outbox)
+	}
+
+	first := decode[ap.OrderedCollectionPage[ap.Activity[ap.Note]]](t, serve(p, http.MethodGet, "/outbox?page=1", "", ""))
+	if len(first.OrderedItems) != outboxPageSize || first.Next != "https://pub.example.com/outbox?page=2" || first.Prev != "" {
+		t.Errorf("unexpected first page: %d items, next %q, prev %q", len(first.OrderedItems), first.Next, first.Prev)
+	}
+
+	if content := first.OrderedItems[0].Object.Content; content != fmt.Sprintf("Note %d", outboxPageSize+4) {
+		t.Errorf("expected the most recent note first, got %q", content)
+	}
+
+	second := decode[ap.OrderedCollectionPage[ap.Activity[ap.Note]]](t, serve(p, http.MethodGet, "/outbox?page=2", "", ""))
+	if len(second.OrderedItems) != 5 || second.Next != "" || second.Prev != "https://pub.example.com/outbox?page=1" {
+		t.Errorf("unexpected second page: %d items, next %q, prev %q", len(second.OrderedItems), second.Next, second.Prev)
+	}
+
+	if w := serve(p, http.MethodGet, "/outbox?page=0", "", ""); w.Code != http.StatusBadRequest {
+		t.Errorf("expected status 400 for page 0, got %d", w.Code)
+	}
+}
@@ -0,0 +1,108 @@
+package www
+
+import (
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/jclem/jclem.me/internal/activitypub/identity"
+	"github.com/jclem/jclem.me/internal/ratelimit"
+)
+
+// newLimiter creates a limiter allowing perMinute requests per minute, or nil
+// if perMinute is not positive, which disables rate limiting.
+func newLimiter(perMinute int) *ratelimit.Limiter {
+	if perMinute <= 0 {
+		return nil
+	}
+
+	return ratelimit.New(perMinute, time.Minute)
+}
+
+// rateLimit limits requests using the given limiter, with each bucket
+// identified by the given key function.
+//
+// Responses include the RateLimit-* headers described by
+// https://datatracker.ietf.org/doc/draft-ietf-httpapi-ratelimit-headers/.
+func rateLimit(l *ratelimit.Limiter, key func(*http.Request) string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if l == nil {
+			return next
+		}
+
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if allow(w, r, l, key(r)) {
+				next.ServeHTTP(w, r)
+			}
+		})
+	}
+}
+
+// allow takes a token from the bucket for key, if l is not nil, and sets the
+// RateLimit-* headers. If none is available, it responds with a 429 problem
+// and returns false.
+func allow(w http.ResponseWriter, r *http.Request, l *ratelimit.Limiter, key string) bool {
+	if l == nil {
+		return true
+	}
+
+	res := l.Allow(key)
+
+	w.Header().Set("RateLimit-Limit", strconv.Itoa(res.Limit))
+	w.Header().Set("RateLimit-Remaining", strconv.Itoa(res.Remaining))
+	w.Header().Set("RateLimit-Reset", strconv.Itoa(ceilSeconds(res.Reset)))
+
+	if !res.Allowed {
+		w.Header().Set("Retry-After", strconv.Itoa(ceilSeconds(res.RetryAfter)))
+		returnProblem(r.Context(), w, problem{Type: problemTypeRateLimited, Status: http.StatusTooManyRequests, Detail: "rate limit exceeded"})
+
+		return false
+	}
+
+	return true
+}
+
+// flyClientIPHeader is set by Fly's proxy to the address of the client which
+// connected to it. Unlike X-Forwarded-For or X-Real-IP, it cannot be set by the
+// client.
+const flyClientIPHeader = "Fly-Client-IP"
+
+// realIP sets the remote address of each request to its client's address, as
+// reported by Fly's proxy. Other headers which report the client's address are
+// not trusted, since clients could set them to evade rate limits.
+func realIP(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if ip := net.ParseIP(r.Header.Get(flyClientIPHeader)); ip != nil {
+			r.RemoteAddr = ip.String()
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// byIP identifies requests by their remote IP address.
+func byIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+
+	return "ip:" + host
+}
+
+// byAPIKey identifies requests by the ID of the API key which verified them, or
+// by their remote IP address if none did. It must follow verifyBearerToken, so
+// that a client cannot claim another key's ID.
+func byAPIKey(r *http.Request) string {
+	key, ok := r.Context().Value(apiKeyContextKey).(identity.APIKey)
+	if !ok {
+		return byIP(r)
+	}
+
+	return "key:" + key.ID.String()
+}
+
+func ceilSeconds(d time.Duration) int {
+	return int((d + time.Second - 1) / time.Second)
+}
@@ -0,0 +1,85 @@
+package www
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/jclem/jclem.me/internal/errorreport"
+)
+
+type recordingReporter struct {
+	mu     sync.Mutex
+	events []errorreport.Event
+}
+
+func (r *recordingReporter) Report(event errorreport.Event) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.events = append(r.events, event)
+}
+
+func TestReportErrors(t *testing.T) {
+	reporter := &recordingReporter{}
+	t.Cleanup(errorreport.SetReporter(reporter))
+
+	r := chi.NewRouter()
+	r.Use(middleware.RequestID)
+	r.Use(middleware.Recoverer)
+	r.Use(reportErrors)
+
+	r.Get("/panic", func(w http.ResponseWriter, r *http.Request) {
+		errorreport.SetUser(r.Context(), errorreport.User{ID: "1", Username: "alice"})
+		panic("boom")
+	})
+
+	r.Get("/error", func(w http.ResponseWriter, r *http.Request) {
+		returnError(r.Context(), w, errors.New("broken"), "error doing something")
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/panic?token=secret", nil)
+	req.Header.Set(middleware.RequestIDHeader, "req-1")
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("expected status 500 for a panic, got %d", w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/error", nil))
+
+	if len(reporter.events) != 2 {
+		t.Fatalf("expected 2 events, got %d", len(reporter.events))
+	}
+
+	panicked := reporter.events[0]
+
+	if panicked.Error != "boom" || panicked.Request == nil || panicked.Request.ID != "req-1" {
+		t.Fatalf("expected the panic to be reported with its request ID, got %+v", panicked)
+	}
+
+	if panicked.Request.Path != "/panic" {
+		t.Errorf("expected the request's path without its query, got %q", panicked.Request.Path)
+	}
+
+	if panicked.User == nil || panicked.User.Username != "alice" {
+		t.Errorf("expected the panic to be reported with its user, got %+v", panicked.User)
+	}
+
+	failed := reporter.events[1]
+
+	if failed.Error != "broken" || failed.Message != "error doing something" || failed.User != nil {
+		t.Errorf("expected the error to be reported without a user, got %+v", failed)
+	}
+
+	if len(failed.Stack) == 0 || failed.Stack[len(failed.Stack)-1].Function != "github.com/jclem/jclem.me/internal/www.returnError" {
+		t.Errorf("expected the error's stack to end in returnError, got %+v", failed.Stack)
+	}
+}
@@ -2,3 +2,61 @@ window.copyNextCode = (el) => {
   const code = el.closest(".code-example").querySelector("pre").innerText;
   navigator.clipboard.writeText(code);
 };
+
+// Links and forms marked with data-fragment load the page they lead to as a
+// fragment, which the server renders when asked with the HX-Request header, as
+// htmx asks, and swap it into the page. A form's fragment replaces the contents
+// of the element its data-fragment selects, and a link's replaces the link.
+// Without this script, they are ordinary links and forms.
+const loadFragment = async (url, swap) => {
+  const response = await fetch(url, { headers: { "HX-Request": "true" } });
+  if (!response.ok) {
+    window.location.href = url;
+    return;
+  }
+
+  swap(await response.text());
+};
+
+document.addEventListener("click", (event) => {
+  const link = event.target.closest("a[data-fragment]");
+  if (!link || event.metaKey || event.ctrlKey || event.shiftKey) {
+    return;
+  }
+
+  event.preventDefault();
+  loadFragment(link.href, (html) => {
+    link.outerHTML = html;
+  });
+});
+
+document.addEventListener("submit", (event) => {
+  const form = event.target.closest("form[data-fragment]");
+  if (!form) {
+    return;
+  }
+
+  event.preventDefault();
+
+  const url = new URL(form.action);
+  url.search = new URLSearchParams(new FormData(form)).toString();
+
+  const target = document.querySelector(form.dataset.fragment);
+  loadFragment(url, (html) => {
+    target.innerHTML = html;
+    window.history.replaceState(null, "", url);
+  });
+});
+
+// Searching as one types submits the search form after a pause.
+let searchTimeout;
+
+document.addEventListener("input", (event) => {
+  const form = event.target.closest("form[data-fragment]");
+  if (!form || event.target.type !== "search") {
+    return;
+  }
+
+  clearTimeout(searchTimeout);
+  searchTimeout = setTimeout(() => form.requestSubmit(), 300);
+});
@@ -0,0 +1,173 @@
+package www
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	ap "github.com/jclem/jclem.me/internal/activitypub"
+	"github.com/jclem/jclem.me/internal/activitypub/identity"
+	"github.com/jclem/jclem.me/internal/database"
+	"github.com/jclem/jclem.me/internal/dispatches"
+	"github.com/jclem/jclem.me/internal/posts"
+	"github.com/jclem/jclem.me/internal/www/config"
+)
+
+// SeedResult describes the user created by Seed.
+type SeedResult struct {
+	User   identity.User `json:"user"`
+	APIKey string        `json:"api_key"`
+}
+
+// Seed fills an empty development database with a user and some of their
+// posts, notes, dispatches, and followers, without starting the server.
+//
+// Seeded posts are only served if database posts are enabled. Followers are on
+// example domains, so deliveries to them fail.
+func Seed(ctx context.Context, cfg config.Config, username string) (SeedResult, error) {
+	if cfg.IsProd() {
+		return SeedResult{}, errors.New("refusing to seed a production database")
+	}
+
+	if cfg.DatabaseURL == "" {
+		return SeedResult{}, errors.New("seeding requires a database")
+	}
+
+	pool, err := database.NewPool(ctx, cfg)
+	if err != nil {
+		return SeedResult{}, fmt.Errorf("failed to connect to database: %w", err)
+	}
+
+	defer pool.Close()
+
+	id, err := identity.NewService(pool)
+	if err != nil {
+		return SeedResult{}, fmt.Errorf("error creating identity service: %w", err)
+	}
+
+	pub, err := ap.NewService(cfg, pool, id, ap.WithoutWorkers())
+	if err != nil {
+		return SeedResult{}, fmt.Errorf("error creating activitypub service: %w", err)
+	}
+
+	images, err := newImages(ctx, cfg, pool)
+	if err != nil {
+		return SeedResult{}, err
+	}
+
+	s := seeder{id: id, pub: pub, dispatches: dispatches.New(pool), posts: posts.NewStore(pool, images)}
+
+	return s.seed(ctx, username)
+}
+
+// A seeder creates development data with the given services. If posts is nil,
+// no posts are created.
+type seeder struct {
+	id         *identity.Service
+	pub        *ap.Service
+	dispatches *dispatches.Service
+	posts      *posts.Store
+}
+
+//nolint:gochecknoglobals
+var (
+	seedPosts = []posts.NewPost{
+		{
+			Slug:    "hello-world",
+			Title:   "Hello, World",
+			Summary: "The first post.",
+			Body:    "Welcome to the site. This post was *seeded* for development.\n\n## Why\n\nSo that there is something to look at.",
+			Tags:    []string{"meta"},
+			ShowTOC: true,
+		},
+		{
+			Slug:    "notes-on-go",
+			Title:   "Notes on Go",
+			Summary: "Some things I've learned writing Go.",
+			Body:    "Accept interfaces, return structs.\n\n```go\nfmt.Println(\"hello\")\n```",
+			Tags:    []string{"go", "programming"},
+		},
+		{
+			Slug:    "a-draft",
+			Title:   "A Draft",
+			Summary: "This post is not published.",
+			Body:    "Work in progress.",
+		},
+	}
+
+	seedNotes = []string{
+		"<p>Hello, fediverse!</p>",
+		"<p>Trying out a new <em>espresso</em> machine this morning.</p>",
+		"<p>Reading a good book about distributed systems.</p>",
+	}
+
+	seedDispatches = []dispatches.NewDispatch{
+		{Body: "Just setting up my dispatches."},
+		{Body: "A good read on testing.", Link: &dispatches.Link{URL: "https://go.dev/doc/tutorial/add-a-test", Title: "Add a test"}},
+		{Body: "Coffee.", Checkin: &dispatches.Checkin{Name: "Blue Bottle Coffee", Latitude: 40.7421, Longitude: -74.0048}},
+	}
+
+	seedFollowers = []string{
+		"https://mastodon.example/users/ada",
+		"https://mastodon.example/users/grace",
+		"https://social.example/@linus",
+	}
+)
+
+func (s seeder) seed(ctx context.Context, username string) (SeedResult, error) {
+	user, apiKey, err := s.id.CreateUser(ctx, identity.NewUser{
+		Username: username,
+		Name:     "Development User",
+		Summary:  "A user seeded for development.",
+	})
+	if err != nil {
+		return SeedResult{}, fmt.Errorf("error creating user: %w", err)
+	}
+
+	if s.posts != nil {
+		for i, input := range seedPosts {
+			input.Author = username
+
+			if _, err := s.posts.Create(ctx, input); err != nil {
+				return SeedResult{}, fmt.Errorf("error creating post %q: %w", input.Slug, err)
+			}
+
+			// The last post is left as a draft.
+			if i == len(seedPosts)-1 {
+				continue
+			}
+
+			if _, err := s.posts.Publish(ctx, input.Slug); err != nil {
+				return SeedResult{}, fmt.Errorf("error publishing post %q: %w", input.Slug, err)
+			}
+		}
+	}
+
+	for _, content := range seedNotes {
+		if _, err := publishNote(ctx, s.pub, user, content, []string{ap.PublicNS}, []string{s.pub.Site().ActorFollowers(user)}); err != nil {
+			return SeedResult{}, err
+		}
+	}
+
+	for _, input := range seedDispatches {
+		input.Author = username
+
+		dispatch, err := s.dispatches.Create(ctx, input)
+		if err != nil {
+			return SeedResult{}, fmt.Errorf("error creating dispatch: %w", err)
+		}
+
+		if _, err := federateDispatch(ctx, s.pub, s.dispatches, user, dispatch); err != nil {
+			return SeedResult{}, err
+		}
+	}
+
+	// Followers are created last, so that nothing above is delivered to them.
+	for _, actorID := range seedFollowers {
+		if _, err := s.pub.CreateFollower(ctx, user.ID, actorID, actorID+"/follows/seed"); err != nil {
+			return SeedResult{}, fmt.Errorf("error creating follower: %w", err)
+		}
+	}
+
+	return SeedResult{User: user, APIKey: apiKey}, nil
+}
@@ -0,0 +1,50 @@
+package www
+
+import (
+	"context"
+	"testing"
+
+	"github.com/jclem/jclem.me/internal/dispatches"
+)
+
+func TestSeed(t *testing.T) {
+	p := newTestPub(t)
+	ctx := context.Background()
+	s := seeder{id: p.id, pub: p.pub, dispatches: dispatches.NewWithStore(dispatches.NewMemoryStore())}
+
+	result, err := s.seed(ctx, "bob")
+	if err != nil {
+		t.Fatalf("error seeding: %v", err)
+	}
+
+	if result.User.Username != "bob" || result.APIKey == "" {
+		t.Errorf("unexpected result: %+v", result)
+	}
+
+	notes, err := p.pub.ListNotes(ctx, result.User.ID)
+	if err != nil {
+		t.Fatalf("error listing notes: %v", err)
+	}
+
+	if len(notes) != len(seedNotes)+len(seedDispatches) {
+		t.Errorf("expected %d notes, got %d", len(seedNotes)+len(seedDispatches), len(notes))
+	}
+
+	followers, err := p.pub.ListFollowers(ctx, result.User.ID)
+	if err != nil {
+		t.Fatalf("error listing followers: %v", err)
+	}
+
+	if len(followers) != len(seedFollowers) {
+		t.Errorf("expected %d followers, got %d", len(seedFollowers), len(followers))
+	}
+
+	// Nothing is delivered to the seeded followers.
+	if jobs := p.store.Jobs(); len(jobs) != 0 {
+		t.Errorf("expected no jobs, got %v", jobs)
+	}
+
+	if _, err := s.seed(ctx, "bob"); err == nil {
+		t.Error("expected an error seeding an existing user")
+	}
+}
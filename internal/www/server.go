@@ -2,125 +2,378 @@ package www
 
 import (
 	"context"
-	"encoding/json"
+	"errors"
 	"fmt"
 	"log/slog"
+	"net"
 	"net/http"
+	"os"
+	"sync/atomic"
 	"time"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
 	"github.com/go-chi/hostrouter"
 	"github.com/go-chi/httplog/v2"
+	"github.com/jackc/pgx/v5/pgxpool"
 	ap "github.com/jclem/jclem.me/internal/activitypub"
+	"github.com/jclem/jclem.me/internal/activitypub/identity"
+	"github.com/jclem/jclem.me/internal/analytics"
+	"github.com/jclem/jclem.me/internal/database"
+	"github.com/jclem/jclem.me/internal/dispatches"
+	"github.com/jclem/jclem.me/internal/errorreport"
+	"github.com/jclem/jclem.me/internal/linkcheck"
+	"github.com/jclem/jclem.me/internal/telemetry"
+	"github.com/jclem/jclem.me/internal/webmention"
 	"github.com/jclem/jclem.me/internal/www/config"
+	"github.com/jclem/jclem.me/internal/www/view"
 )
 
 type Server struct {
 	*chi.Mux
-	port string
+	cfg   config.Config
+	pool  *pgxpool.Pool
+	id    *identity.Service
+	pub   *ap.Service
+	view  *view.Service
+	web   *webRouter
+	state atomic.Int32
+
+	// analytics counts page views. It is nil if analytics are disabled.
+	analytics *analytics.Recorder
 }
 
-const domain = "www.jclem.me"
+// Server states, as reported by the readiness check.
+const (
+	serverStarting int32 = iota
+	serverReady
+	serverStopping
+)
+
+// New creates a server. ctx is its root context, from which connecting to the
+// database, loading content, and work done in the background after requests,
+// such as publishing feeds, are derived, so that they are cancelled with it.
+func New(ctx context.Context, cfg config.Config) (*Server, error) {
+	pool, err := newPool(ctx, cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	var recorder *analytics.Recorder
+	if cfg.Analytics && pool != nil {
+		recorder = analytics.New(pool, cfg.URLHostname())
+	}
 
-func New() (*Server, error) {
-	webRouter, err := newWebRouter()
+	webRouter, err := newWebRouter(ctx, cfg, pool, recorder)
 	if err != nil {
 		return nil, fmt.Errorf("error creating web router: %w", err)
 	}
 
-	pubRouter, err := newPubRouter()
+	var links *linkcheck.Store
+	if pool != nil {
+		links = linkcheck.NewStore(pool)
+	}
+	federator := &dispatchFederator{dispatches: webRouter.dispatches, feeds: webRouter.feeds}
+	mentions := &webmentionNotifier{}
+
+	pubRouter, err := newPubRouter(cfg, webRouter.view, pool,
+		ap.WithWorker(linkcheck.NewWorker(webRouter.checkLinks, links)),
+		ap.WithPeriodicJob(linkcheck.PeriodicJob()),
+		ap.WithWorker(dispatches.NewProcessImageWorker(webRouter.dispatches, webRouter.images, federator.ready)),
+		ap.WithWorker(webmention.NewVerifyWorker(mentions.notify)),
+	)
 	if err != nil {
 		return nil, fmt.Errorf("error creating pub router: %w", err)
 	}
 
+	federator.pub.Store(pubRouter)
+	mentions.pub.Store(pubRouter)
+
+	// Webmentions are received on the web domain, but verified by the pub
+	// router's jobs.
+	webRouter.With(rateLimit(pubRouter.inboxLimiter, byIP)).Post(webmentionPath, pubRouter.receiveWebmention)
+
+	webRouter.timeline.AddSource(pubRouter.notesSource)
+
+	// Events are published by the pub router's service, but streamed, without
+	// those only the site's owner may see, on the web domain.
+	webRouter.Get(eventsPath, streamEvents(pubRouter.pub.Events(), publicEvents))
+
+	adminRouter := newAdminRouter(cfg, pubRouter, webRouter, links, recorder)
+
 	middleware.RequestIDHeader = "fly-request-id"
 
 	r := chi.NewRouter()
-	s := &Server{Mux: r, port: config.Port()}
-	r.Use(httplog.RequestLogger(newLogger("server", config.IsProd())))
+	s := &Server{Mux: r, cfg: cfg, pool: pool, id: pubRouter.id, pub: pubRouter.pub, view: webRouter.view, web: webRouter, analytics: recorder}
+	r.Use(telemetry.Middleware)
+	r.Use(requestLogger(newLogger("server", cfg.IsProd(), os.Stdout), cfg.LogCrawlerSampleRate))
 	r.Use(middleware.RequestID)
-	r.Use(middleware.RealIP)
+	r.Use(problemDomain(cfg.WebDomain))
+	r.Use(realIP)
 	r.Use(middleware.Recoverer)
+	r.Use(reportErrors)
 	r.Get("/meta/healthcheck", s.healthcheck)
+	r.Get("/meta/readiness", s.readiness)
+	r.Mount("/admin", adminRouter)
 
-	if config.IsProd() {
+	switch {
+	case cfg.SingleDomain:
+		// Webfinger must be served at the root of the handle's domain.
+		r.Get("/.well-known/webfinger", pubRouter.webfinger())
+		r.Mount(ap.PathPrefix, pubRouter)
+		r.Mount("/", webRouter)
+	case cfg.IsProd():
 		hr := hostrouter.New()
-		hr.Map(ap.Domain, pubRouter)
-		hr.Map(domain, webRouter)
+		hr.Map(pubRouter.site.Domain, pubRouter)
+		hr.Map(cfg.WebDomain, webRouter)
 		r.Mount("/", hr)
-	} else {
-		r.Mount("/pub", pubRouter)
+	default:
+		r.Mount(ap.PathPrefix, pubRouter)
 		r.Mount("/", webRouter)
 	}
 
 	return s, nil
 }
 
-func (s *Server) Start() error {
-	srv := &http.Server{
-		Addr:              fmt.Sprintf(":%s", s.port),
-		Handler:           s,
-		ReadTimeout:       1 * time.Second,
-		ReadHeaderTimeout: 500 * time.Millisecond,
-		WriteTimeout:      5 * time.Second,
+// newPool connects to the database and applies pending migrations if they are
+// applied at startup. In development, if no database is configured, it returns
+// a nil pool, and users, notes, and dispatches are kept in memory instead.
+func newPool(ctx context.Context, cfg config.Config) (*pgxpool.Pool, error) {
+	if cfg.DatabaseURL == "" {
+		if !cfg.IsDev() {
+			return nil, errors.New("database_url is required outside of development")
+		}
+
+		slog.Warn("no database configured, keeping data in memory")
+
+		return nil, nil //nolint:nilnil
 	}
 
-	slog.Info("listening on", slog.String("port", s.port))
+	pool, err := database.NewPool(ctx, cfg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to database: %w", err)
+	}
+
+	// Migrations must be applied before the job client, which depends on the
+	// job queue tables, is created.
+	if cfg.AutoMigrate {
+		applied, err := database.Migrate(ctx, pool)
+		if err != nil {
+			return nil, fmt.Errorf("failed to migrate database: %w", err)
+		}
 
-	if err := srv.ListenAndServe(); err != nil {
-		return fmt.Errorf("error starting server: %w", err)
+		for _, m := range applied {
+			slog.Info("applied migration", "version", m.Version, "name", m.Name)
+		}
 	}
 
-	return nil
+	return pool, nil
 }
 
-func (*Server) healthcheck(w http.ResponseWriter, _ *http.Request) {
-	w.WriteHeader(http.StatusOK)
+// readHeaderTimeout is how long reading a request's headers may take,
+// readTimeout how long reading the whole request may take, and writeTimeout
+// how long responding may take. Bodies are at most maxBodyBytes, so they are
+// read well within readTimeout. Routes which need longer, such as uploads,
+// exports, and event streams, extend their deadlines.
+const (
+	readHeaderTimeout = 500 * time.Millisecond
+	readTimeout       = 5 * time.Second
+	writeTimeout      = 5 * time.Second
+)
+
+// shutdownTimeout is how long in-flight requests are given to finish once the
+// server is asked to stop.
+const shutdownTimeout = 20 * time.Second
+
+// jobsShutdownTimeout is how long in-flight jobs are given to finish once the
+// server has stopped serving requests, after which they are cancelled.
+const jobsShutdownTimeout = 20 * time.Second
+
+// flushTimeout is how long the last page views are given to be recorded.
+const flushTimeout = 5 * time.Second
+
+// Start starts the server and blocks until ctx is done, at which point it stops
+// accepting new requests and waits for in-flight requests and jobs to finish.
+// In the worker run mode, it serves no requests, except on the debug port.
+func (s *Server) Start(ctx context.Context) error {
+	srv := s.newHTTPServer()
+
+	var servers []*http.Server
+
+	// A worker process only works jobs.
+	if s.cfg.ServesHTTP() {
+		servers = append(servers, srv)
+		slog.Info("listening on", slog.String("port", s.cfg.Port))
+	} else {
+		slog.Info("working jobs without serving requests")
+	}
+
+	if debugPort := s.cfg.DebugPort; debugPort != "" {
+		servers = append(servers, &http.Server{
+			Addr:              fmt.Sprintf(":%s", debugPort),
+			Handler:           newDebugRouter(s.cfg.APIKey),
+			ReadHeaderTimeout: 500 * time.Millisecond,
+		})
+
+		slog.Info("serving debug endpoints on", slog.String("port", debugPort))
+	}
+
+	listeners := make([]net.Listener, 0, len(servers))
+
+	for _, srv := range servers {
+		ln, err := net.Listen("tcp", srv.Addr)
+		if err != nil {
+			for _, ln := range listeners {
+				ln.Close() //nolint:errcheck
+			}
+
+			return fmt.Errorf("error starting server: %w", err)
+		}
+
+		listeners = append(listeners, ln)
+	}
+
+	// Jobs are worked once the server has booted, and are drained by shutdown
+	// rather than cancelled with ctx.
+	if err := s.pub.Start(context.WithoutCancel(ctx)); err != nil {
+		for _, ln := range listeners {
+			ln.Close() //nolint:errcheck
+		}
+
+		return fmt.Errorf("error starting jobs: %w", err)
+	}
+
+	serveErr := make(chan error, len(servers))
+
+	for i, srv := range servers {
+		go func(srv *http.Server, ln net.Listener) {
+			if err := srv.Serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				serveErr <- err
+			}
+		}(srv, listeners[i])
+	}
+
+	if s.cfg.ServesHTTP() {
+		go func() {
+			if err := s.web.watchContent(ctx); err != nil {
+				slog.Error("error watching content", "error", err)
+			}
+		}()
+
+		if s.analytics != nil {
+			go s.analytics.Run(ctx)
+		}
+
+		// Posts written in other processes are announced through events.
+		s.web.posts.Listen(ctx, s.pub.Events())
+	}
+
+	// Every process listens for events, so that users which are updated or
+	// deleted in one are not served from another's cache.
+	go s.pub.Events().Listen(ctx)
+
+	s.id.Listen(ctx, s.pub.Events())
+
+	s.state.Store(serverReady)
+
+	var err error
+
+	select {
+	case err = <-serveErr:
+		err = fmt.Errorf("error serving: %w", err)
+	case <-ctx.Done():
+	}
+
+	s.state.Store(serverStopping)
+	slog.Info("shutting down")
+
+	return errors.Join(err, s.shutdown(servers)) //nolint:contextcheck
 }
 
-type apiError struct {
-	Code    int    `json:"code"`
-	Reason  string `json:"reason"`
-	Message string `json:"message"`
+// newHTTPServer creates the HTTP server which serves requests. Event streams,
+// which last until their clients disconnect, are ended as it shuts down, so
+// that they do not hold shutdown open until it times out.
+func (s *Server) newHTTPServer() *http.Server {
+	srv := &http.Server{
+		Addr:              fmt.Sprintf(":%s", s.cfg.Port),
+		Handler:           s,
+		ReadTimeout:       readTimeout,
+		ReadHeaderTimeout: readHeaderTimeout,
+		WriteTimeout:      writeTimeout,
+	}
+
+	srv.RegisterOnShutdown(s.pub.Events().Close)
+
+	return srv
 }
 
-func returnCodeError(ctx context.Context, w http.ResponseWriter, code int, message string) {
-	w.WriteHeader(code)
-	w.Header().Set("Content-Type", "application/json")
+// shutdown stops the servers, the job queue, and the analytics recorder, and
+// closes the connection pool. Each is stopped regardless of whether those
+// before it stopped cleanly.
+func (s *Server) shutdown(servers []*http.Server) error {
+	var errs []error
 
-	if err := json.NewEncoder(w).Encode(apiError{
-		Code:    code,
-		Reason:  http.StatusText(code),
-		Message: message,
-	}); err != nil {
-		oplog := httplog.LogEntry(ctx)
-		oplog.ErrorContext(ctx, "error encoding error response", "error", err)
+	httpCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+
+	for _, srv := range servers {
+		if err := srv.Shutdown(httpCtx); err != nil {
+			errs = append(errs, fmt.Errorf("error shutting down server: %w", err))
+		}
 	}
-}
 
-func returnError(ctx context.Context, w http.ResponseWriter, err error, message string) {
-	w.WriteHeader(http.StatusInternalServerError)
-	w.Header().Set("Content-Type", "application/json")
+	jobsCtx, cancel := context.WithTimeout(context.Background(), jobsShutdownTimeout)
+	defer cancel()
 
-	oplog := httplog.LogEntry(ctx)
-	oplog.ErrorContext(ctx, fmt.Sprintf("unexpected error in request handler: %s", message), "error", err)
+	if err := s.pub.Stop(jobsCtx); err != nil {
+		errs = append(errs, fmt.Errorf("error stopping activitypub service: %w", err))
+	}
+
+	if s.analytics != nil {
+		flushCtx, cancel := context.WithTimeout(context.Background(), flushTimeout)
+		defer cancel()
+
+		if err := s.analytics.Flush(flushCtx); err != nil {
+			errs = append(errs, fmt.Errorf("error recording page views: %w", err))
+		}
+	}
 
-	if err := json.NewEncoder(w).Encode(apiError{
-		Code:    http.StatusInternalServerError,
-		Reason:  http.StatusText(http.StatusInternalServerError),
-		Message: "Internal server error",
-	}); err != nil {
-		oplog.ErrorContext(ctx, "error encoding error response", "error", err)
+	if s.pool != nil {
+		s.pool.Close()
 	}
+
+	return errors.Join(errs...)
 }
 
-func newLogger(name string, prodLogger bool) *httplog.Logger {
-	return httplog.NewLogger(name, httplog.Options{
-		JSON:            prodLogger,
-		LogLevel:        slog.LevelInfo,
-		Concise:         prodLogger,
-		RequestHeaders:  prodLogger,
-		ResponseHeaders: prodLogger,
+// reportErrors gives each request a scope for the errors it reports, with its
+// ID, and reports its panics, which are then recovered by middleware.Recoverer.
+func reportErrors(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := errorreport.WithScope(r.Context())
+
+		errorreport.SetRequest(ctx, errorreport.Request{
+			ID:     middleware.GetReqID(ctx),
+			Method: r.Method,
+			Host:   r.Host,
+			Path:   r.URL.Path,
+		})
+
+		defer func() {
+			if rvr := recover(); rvr != nil {
+				// An aborted handler is not a bug; see http.ErrAbortHandler.
+				if rvr != http.ErrAbortHandler { //nolint:errorlint
+					errorreport.ReportPanic(ctx, rvr)
+				}
+
+				panic(rvr)
+			}
+		}()
+
+		next.ServeHTTP(w, r.WithContext(ctx))
 	})
 }
+
+func logError(ctx context.Context, err error, message string) {
+	oplog := httplog.LogEntry(ctx)
+	oplog.ErrorContext(ctx, fmt.Sprintf("unexpected error in request handler: %s", message), "error", err)
+}
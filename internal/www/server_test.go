@@ -0,0 +1,69 @@
+package www
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestNewWithoutDatabase(t *testing.T) {
+	s, err := New(context.Background(), testConfig)
+	if err != nil {
+		t.Fatalf("error creating server: %v", err)
+	}
+
+	if w := serve(s, http.MethodGet, "/", "", ""); w.Code != http.StatusOK {
+		t.Errorf("expected status 200 for the home page, got %d", w.Code)
+	}
+
+	if w := serve(s, http.MethodPost, "/admin/users", "admin-key", `{"username":"alice"}`); w.Code != http.StatusCreated {
+		t.Errorf("expected status 201 creating a user, got %d: %s", w.Code, w.Body)
+	}
+
+	if w := serve(s, http.MethodPost, "/admin/dispatches", "admin-key", `{"body":"Hello"}`); w.Code != http.StatusCreated {
+		t.Errorf("expected status 201 creating a dispatch, got %d: %s", w.Code, w.Body)
+	}
+
+	if w := serve(s, http.MethodPost, "/admin/bookmarks", "admin-key", `{}`); w.Code != http.StatusNotImplemented {
+		t.Errorf("expected status 501 creating a bookmark, got %d", w.Code)
+	}
+}
+
+func TestShutdownEndsEventStreams(t *testing.T) {
+	s, err := New(context.Background(), testConfig)
+	if err != nil {
+		t.Fatalf("error creating server: %v", err)
+	}
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("error listening: %v", err)
+	}
+
+	srv := s.newHTTPServer()
+	go srv.Serve(ln) //nolint:errcheck
+
+	resp, err := http.Get("http://" + ln.Addr().String() + eventsPath)
+	if err != nil {
+		t.Fatalf("error requesting events: %v", err)
+	}
+	defer resp.Body.Close()
+
+	// The stream is open once its retry interval is read.
+	if _, err := bufio.NewReader(resp.Body).ReadString('\n'); err != nil {
+		t.Fatalf("error reading stream: %v", err)
+	}
+
+	start := time.Now()
+
+	if err := s.shutdown([]*http.Server{srv}); err != nil {
+		t.Errorf("error shutting down: %v", err)
+	}
+
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("expected shutdown to end the stream promptly, took %s", elapsed)
+	}
+}
@@ -0,0 +1,161 @@
+package www
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/jclem/jclem.me/internal/posts"
+)
+
+// sitemapMaxURLs is the most URLs listed in a single sitemap. Once there are
+// more, /sitemap.xml becomes a sitemap index of numbered sitemaps.
+//
+// SEE https://www.sitemaps.org/protocol.html#index
+const sitemapMaxURLs = 50000
+
+// A sitemapURL is an entry in a sitemap.
+type sitemapURL struct {
+	Loc        string
+	LastMod    time.Time
+	ChangeFreq string
+	Priority   string
+}
+
+// A sitemapRef is an entry in a sitemap index.
+type sitemapRef struct {
+	Loc     string
+	LastMod time.Time
+}
+
+// sitemapURLs lists every page which should be indexed, along with when it
+// last changed.
+func (wr *webRouter) sitemapURLs() []sitemapURL {
+	list := wr.posts.List(posts.WithAuthor(wr.cfg.DefaultUser))
+	latest := lastPublished(list)
+
+	urls := []sitemapURL{
+		{Loc: wr.view.URL("/"), ChangeFreq: "yearly", Priority: "1.0"},
+		{Loc: wr.view.URL("/writing"), LastMod: latest, ChangeFreq: "monthly"},
+		{Loc: wr.view.URL("/writing/tags"), LastMod: latest, ChangeFreq: "monthly"},
+		{Loc: wr.view.URL("/links"), ChangeFreq: "weekly"},
+		{Loc: wr.view.URL("/photos"), ChangeFreq: "weekly"},
+		{Loc: wr.view.URL("/dispatches"), ChangeFreq: "daily"},
+		{Loc: wr.view.URL("/projects"), ChangeFreq: "monthly"},
+		{Loc: wr.view.URL("/everything"), ChangeFreq: "daily"},
+	}
+
+	for _, year := range wr.posts.Archive(posts.WithAuthor(wr.cfg.DefaultUser)) {
+		urls = append(urls, sitemapURL{
+			Loc:        wr.view.URL(fmt.Sprintf("/writing/%d", year.Year)),
+			LastMod:    lastPublished(year.Posts),
+			ChangeFreq: "yearly",
+		})
+	}
+
+	for _, tag := range wr.posts.Tags(posts.WithAuthor(wr.cfg.DefaultUser)) {
+		tagged := wr.posts.List(posts.WithAuthor(wr.cfg.DefaultUser), posts.WithTag(tag.Name))
+
+		urls = append(urls, sitemapURL{
+			Loc:        wr.view.URL("/writing/tags/" + url.PathEscape(tag.Name)),
+			LastMod:    lastPublished(tagged),
+			ChangeFreq: "monthly",
+		})
+	}
+
+	for _, post := range list {
+		lastMod := post.PublishedAt
+		if post.UpdatedAt.After(lastMod) {
+			lastMod = post.UpdatedAt
+		}
+
+		urls = append(urls, sitemapURL{
+			Loc:        wr.view.URL("/writing/" + post.Slug),
+			LastMod:    lastMod,
+			ChangeFreq: "yearly",
+		})
+	}
+
+	return urls
+}
+
+// sitemap renders the sitemap, or, if there are too many URLs for one
+// sitemap, an index of numbered sitemaps.
+func (wr *webRouter) sitemap(w http.ResponseWriter, r *http.Request) {
+	list := wr.posts.List(posts.WithAuthor(wr.cfg.DefaultUser))
+	urls := wr.sitemapURLs()
+
+	w.Header().Set("Content-Type", "application/xml")
+	setLastModified(w, lastPublished(list))
+
+	if len(urls) <= sitemapMaxURLs {
+		if err := wr.view.RenderXML(w, "sitemap.xml", urls); err != nil {
+			wr.renderError(w, r, err, "error rendering sitemap")
+		}
+
+		return
+	}
+
+	refs := make([]sitemapRef, 0, len(urls)/sitemapMaxURLs+1)
+
+	for page := 1; (page-1)*sitemapMaxURLs < len(urls); page++ {
+		refs = append(refs, sitemapRef{
+			Loc:     wr.view.URL(fmt.Sprintf("/sitemap-%d.xml", page)),
+			LastMod: latestLastMod(sitemapPage(urls, page)),
+		})
+	}
+
+	if err := wr.view.RenderXML(w, "sitemap-index.xml", refs); err != nil {
+		wr.renderError(w, r, err, "error rendering sitemap index")
+	}
+}
+
+// sitemapPage renders one of the numbered sitemaps listed in the sitemap
+// index.
+func (wr *webRouter) sitemapPage(w http.ResponseWriter, r *http.Request) {
+	page, err := strconv.Atoi(chi.URLParam(r, "page"))
+	if err != nil {
+		wr.renderCodeError(w, r, http.StatusNotFound, "sitemap not found")
+
+		return
+	}
+
+	urls := sitemapPage(wr.sitemapURLs(), page)
+	if len(urls) == 0 {
+		wr.renderCodeError(w, r, http.StatusNotFound, "sitemap not found")
+
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/xml")
+
+	if err := wr.view.RenderXML(w, "sitemap.xml", urls); err != nil {
+		wr.renderError(w, r, err, "error rendering sitemap")
+	}
+}
+
+// sitemapPage returns the URLs in the given 1-indexed page of the sitemap.
+func sitemapPage(urls []sitemapURL, page int) []sitemapURL {
+	start := (page - 1) * sitemapMaxURLs
+	if page < 1 || start >= len(urls) {
+		return nil
+	}
+
+	return urls[start:min(start+sitemapMaxURLs, len(urls))]
+}
+
+// latestLastMod returns the latest modification time of the given URLs.
+func latestLastMod(urls []sitemapURL) time.Time {
+	var latest time.Time
+
+	for _, su := range urls {
+		if su.LastMod.After(latest) {
+			latest = su.LastMod
+		}
+	}
+
+	return latest
+}
@@ -0,0 +1,55 @@
+package www
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/jclem/jclem.me/internal/www/view"
+)
+
+// themeCookieMaxAge is how long a reader's chosen theme is kept.
+const themeCookieMaxAge = 365 * 24 * time.Hour
+
+// negotiateTheme asks browsers for their reader's preferred color scheme, on
+// which pages, like the theme cookie, depend. A request with a theme query
+// parameter, such as from a link to choose a theme, keeps the theme in a
+// cookie, or forgets it for "auto", and is redirected to the page without the
+// parameter.
+func (wr *webRouter) negotiateTheme(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Accept-CH", view.ColorSchemeHint)
+		w.Header().Add("Vary", view.ColorSchemeHint)
+		w.Header().Add("Vary", "Cookie")
+
+		query := r.URL.Query()
+
+		theme, ok := view.ParseTheme(query.Get("theme"))
+		if !ok || r.Method != http.MethodGet {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		cookie := &http.Cookie{
+			Name:     view.ThemeCookie,
+			Value:    string(theme),
+			Path:     "/",
+			MaxAge:   int(themeCookieMaxAge / time.Second),
+			Secure:   wr.cfg.URLUseHTTPS(),
+			HttpOnly: true,
+			SameSite: http.SameSiteLaxMode,
+		}
+
+		if theme == view.ThemeAuto {
+			cookie.Value, cookie.MaxAge = "", -1
+		}
+
+		http.SetCookie(w, cookie)
+
+		query.Del("theme")
+
+		u := *r.URL
+		u.RawQuery = query.Encode()
+
+		http.Redirect(w, r, u.RequestURI(), http.StatusSeeOther)
+	})
+}
@@ -0,0 +1,93 @@
+package view
+
+import (
+	"encoding/json"
+	"fmt"
+	html "html/template"
+	"net/http"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/jclem/jclem.me/internal/markdown"
+)
+
+// funcs returns the functions available to both HTML and XML templates,
+// besides those of the locale in which they are rendered.
+//
+// Functions which return markup return html.HTML and html.JS, so that HTML
+// templates do not escape it. XML templates do not escape anything, so they
+// treat these as strings.
+func (s *Service) funcs() map[string]any {
+	return map[string]any{
+		"url":      s.url(),
+		"markdown": renderMarkdown,
+		"truncate": truncate,
+		"json":     encodeJSON,
+	}
+}
+
+// formatDate formats a time with a Go layout, or one of these named layouts:
+//
+//   - "rss", as RSS and HTTP dates are written, such as "Mon, 02 Jan 2006
+//     15:04:05 GMT"
+//   - "iso", as RFC 3339 in UTC, such as "2006-01-02T15:04:05Z"
+//   - "day", such as "January 2, 2006"
+//
+// The zero time is formatted as an empty string, so that optional times can be
+// left out, such as with {{with date "iso" .UpdatedAt}}.
+func formatDate(layout string, t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+
+	switch layout {
+	case "rss":
+		return t.UTC().Format(http.TimeFormat)
+	case "iso":
+		return t.UTC().Format(time.RFC3339)
+	case "day":
+		return t.Format("January 2, 2006")
+	default:
+		return t.Format(layout)
+	}
+}
+
+// renderMarkdown converts Markdown, such as a summary or a bookmark's note, to
+// HTML.
+func renderMarkdown(source string) (html.HTML, error) {
+	doc, err := markdown.Render([]byte(source))
+	if err != nil {
+		return "", fmt.Errorf("error rendering markdown: %w", err)
+	}
+
+	return html.HTML(doc.Content), nil //nolint:gosec
+}
+
+// truncate shortens a string to at most n characters, at the end of a word if
+// there is one, ending it with an ellipsis.
+func truncate(n int, s string) string {
+	if utf8.RuneCountInString(s) <= n {
+		return s
+	}
+
+	runes := []rune(s)
+	cut := string(runes[:max(n-1, 0)])
+
+	if i := strings.LastIndexAny(cut, " \t\n"); i > 0 {
+		cut = cut[:i]
+	}
+
+	return strings.TrimRight(cut, " \t\n.,;:") + "…"
+}
+
+// encodeJSON encodes a value as JSON, such as for a script of JSON-LD. Its
+// "<", ">", and "&" are escaped, so it cannot close the script.
+func encodeJSON(v any) (html.JS, error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return "", fmt.Errorf("error encoding json: %w", err)
+	}
+
+	return html.JS(b), nil //nolint:gosec
+}
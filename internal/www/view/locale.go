@@ -0,0 +1,195 @@
+package view
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultLocale is the language in which pages are rendered unless a handler
+// gives another with WithLocale. Every locale falls back to its messages.
+const DefaultLocale = "en"
+
+// localesDir is the directory of the templates in which message catalogs are
+// kept, as "<tag>.json", such as "en.json".
+const localesDir = "locales"
+
+// A Locale is a language in which pages are rendered. Its catalog maps message
+// keys to messages, which templates look up with t, such as {{t
+// "post.minutes" .ReadingMinutes}}. Messages are formats for fmt.Sprintf when
+// they are given arguments.
+//
+// Some keys configure formatting rather than being shown:
+//
+//   - "date.day", the Go layout of the "day" date layout
+//   - "month.January" through "month.December", the names which replace
+//     English month names in formatted dates
+//   - "number.group", the separator of groups of thousands
+type Locale struct {
+	// Tag is the locale's BCP 47 language tag, such as "en", which is the
+	// lang of its pages.
+	Tag string
+
+	messages map[string]string
+	fallback *Locale
+}
+
+// loadLocales reads the message catalogs in the templates' locales directory.
+// The default locale is required, and is the fallback of the others.
+func loadLocales(tfs fs.FS) (map[string]*Locale, error) {
+	names, err := fs.Glob(tfs, localesDir+"/*.json")
+	if err != nil {
+		return nil, fmt.Errorf("error listing locales: %w", err)
+	}
+
+	locales := make(map[string]*Locale, len(names))
+
+	for _, name := range names {
+		b, err := fs.ReadFile(tfs, name)
+		if err != nil {
+			return nil, fmt.Errorf("error reading locale: %w", err)
+		}
+
+		l := &Locale{Tag: strings.TrimSuffix(path.Base(name), ".json")}
+		if err := json.Unmarshal(b, &l.messages); err != nil {
+			return nil, fmt.Errorf("error parsing locale %s: %w", l.Tag, err)
+		}
+
+		locales[l.Tag] = l
+	}
+
+	def, ok := locales[DefaultLocale]
+	if !ok {
+		return nil, fmt.Errorf("missing locale: %s", DefaultLocale)
+	}
+
+	for _, l := range locales {
+		if l != def {
+			l.fallback = def
+		}
+	}
+
+	return locales, nil
+}
+
+// funcs returns the template functions which depend on the locale, which are
+// bound to it when a page is composed.
+func (l *Locale) funcs() map[string]any {
+	return map[string]any{
+		"t":      l.Message,
+		"date":   l.Date,
+		"ago":    func(t time.Time) string { return l.Ago(t, time.Now()) },
+		"number": l.Number,
+	}
+}
+
+// Message returns the message for a key, formatted with args if there are
+// any. A key missing from the locale and its fallback is returned as it is, so
+// that it can be spotted on the page.
+func (l *Locale) Message(key string, args ...any) string {
+	msg, ok := l.lookup(key)
+	if !ok {
+		return key
+	}
+
+	if len(args) > 0 {
+		return fmt.Sprintf(msg, args...)
+	}
+
+	return msg
+}
+
+func (l *Locale) lookup(key string) (string, bool) {
+	if msg, ok := l.messages[key]; ok {
+		return msg, true
+	}
+
+	if l.fallback != nil {
+		return l.fallback.lookup(key)
+	}
+
+	return "", false
+}
+
+// Date formats a time as formatDate does, except that the "day" layout is the
+// locale's, and month names are the locale's if it names them.
+func (l *Locale) Date(layout string, t time.Time) string {
+	if layout == "day" {
+		if day, ok := l.lookup("date.day"); ok {
+			layout = day
+		}
+	}
+
+	s := formatDate(layout, t)
+
+	if name, ok := l.messages["month."+t.Month().String()]; ok {
+		s = strings.ReplaceAll(s, t.Month().String(), name)
+	}
+
+	return s
+}
+
+// Ago describes how long before now a time was, such as "3 hours ago". Times
+// more than a month before now are formatted as days.
+func (l *Locale) Ago(t, now time.Time) string {
+	d := now.Sub(t)
+
+	switch {
+	case d < time.Minute:
+		return l.Message("time.now")
+	case d < time.Hour:
+		return l.plural(int(d/time.Minute), "time.minute")
+	case d < 24*time.Hour:
+		return l.plural(int(d/time.Hour), "time.hour")
+	case d < 48*time.Hour:
+		return l.Message("time.yesterday")
+	case d < 30*24*time.Hour:
+		return l.plural(int(d/(24*time.Hour)), "time.day")
+	default:
+		return l.Date("day", t)
+	}
+}
+
+// plural returns the message for one, keyed "<key>.one", or for another
+// number, keyed "<key>.other".
+func (l *Locale) plural(n int, key string) string {
+	if n == 1 {
+		return l.Message(key+".one", n)
+	}
+
+	return l.Message(key+".other", n)
+}
+
+// Number formats an integer with the locale's separator between groups of
+// thousands, such as "12,345".
+func (l *Locale) Number(n int) string {
+	digits := strconv.Itoa(n)
+
+	sign := ""
+	if n < 0 {
+		sign, digits = "-", digits[1:]
+	}
+
+	sep, ok := l.lookup("number.group")
+	if !ok || len(digits) <= 3 {
+		return sign + digits
+	}
+
+	var b strings.Builder
+
+	b.WriteString(sign)
+
+	for i, digit := range digits {
+		if i > 0 && (len(digits)-i)%3 == 0 {
+			b.WriteString(sep)
+		}
+
+		b.WriteRune(digit)
+	}
+
+	return b.String()
+}
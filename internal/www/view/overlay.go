@@ -0,0 +1,70 @@
+package view
+
+import (
+	"errors"
+	"fmt"
+	html "html/template"
+	"io"
+	text "text/template"
+)
+
+// overlay is the page which shows an error in development. It is parsed apart
+// from the other templates, so that it is shown even if they are broken.
+//
+//nolint:gochecknoglobals
+var overlay = html.Must(html.New("overlay").Parse(`<!doctype html>
+<html lang="en">
+<head>
+	<meta charset="utf-8">
+	<title>Error: {{.Title}}</title>
+</head>
+<body style="margin: 0; padding: 2rem; font-family: ui-monospace, monospace; background: #1c1917; color: #fafaf9;">
+	<p style="color: #f87171;">{{.Title}}</p>
+	{{with .Location}}<p style="color: #a8a29e;">{{.}}</p>{{end}}
+	<pre style="white-space: pre-wrap;">{{.Message}}</pre>
+	<p style="color: #a8a29e;">This error is shown because templates are read from disk. Fix it, and reload the page.</p>
+</body>
+</html>
+`))
+
+type overlayData struct {
+	Title    string
+	Location string
+	Message  string
+}
+
+// RenderOverlay writes a page showing an error, such as a template which could
+// not be parsed or executed, for development.
+func (s *Service) RenderOverlay(w io.Writer, err error) error {
+	data := overlayData{Title: "Internal server error", Message: err.Error()}
+
+	var execErr text.ExecError
+	var htmlErr *html.Error
+
+	switch {
+	case errors.As(err, &execErr):
+		data.Title = "Template error"
+		data.Location = "in template " + execErr.Name
+	case errors.As(err, &htmlErr):
+		data.Title = "Template error"
+		if htmlErr.Name != "" {
+			data.Location = fmt.Sprintf("in %s, line %d", htmlErr.Name, htmlErr.Line)
+		}
+	case s.parseFailed():
+		data.Title = "Template error"
+	}
+
+	if err := overlay.Execute(w, data); err != nil {
+		return fmt.Errorf("error executing template: %w", err)
+	}
+
+	return nil
+}
+
+// parseFailed returns true if templates could not be parsed when they were last
+// reloaded.
+func (s *Service) parseFailed() bool {
+	_, _, err := s.templates()
+
+	return err != nil
+}
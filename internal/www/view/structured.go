@@ -0,0 +1,119 @@
+package view
+
+import (
+	"time"
+
+	"github.com/jclem/jclem.me/internal/posts"
+	"github.com/jclem/jclem.me/internal/www/public"
+)
+
+// Structured data describes a page to search engines, as schema.org types
+// encoded as JSON-LD. Handlers build it from what the page shows, and render it
+// with WithStructuredData.
+//
+// SEE https://developers.google.com/search/docs/appearance/structured-data
+
+const schemaContext = "https://schema.org"
+
+// The site's author, whom the home page describes.
+const (
+	authorName     = "Jonathan Clem"
+	authorJobTitle = "Principal Software Engineer"
+	authorImageURL = "https://jclem.nyc3.cdn.digitaloceanspaces.com/profile/profile-1024.webp"
+)
+
+// authorProfiles are the author's profiles elsewhere, which the home page
+// links.
+//
+//nolint:gochecknoglobals
+var authorProfiles = []string{
+	"https://github.com/jclem",
+	"https://hachyderm.io/@jtc",
+	"https://www.threads.net/@jotclem",
+	"https://twitter.com/_clem",
+}
+
+// A Person is a schema.org Person.
+//
+// SEE https://schema.org/Person
+type Person struct {
+	Context  string        `json:"@context,omitempty"`
+	Type     string        `json:"@type"`
+	Name     string        `json:"name"`
+	URL      string        `json:"url,omitempty"`
+	Image    string        `json:"image,omitempty"`
+	JobTitle string        `json:"jobTitle,omitempty"`
+	WorksFor *Organization `json:"worksFor,omitempty"`
+	SameAs   []string      `json:"sameAs,omitempty"`
+}
+
+// An Organization is a schema.org Organization.
+//
+// SEE https://schema.org/Organization
+type Organization struct {
+	Type string `json:"@type"`
+	Name string `json:"name"`
+	URL  string `json:"url,omitempty"`
+}
+
+// A BlogPosting is a schema.org BlogPosting.
+//
+// SEE https://schema.org/BlogPosting
+type BlogPosting struct {
+	Context          string   `json:"@context"`
+	Type             string   `json:"@type"`
+	Headline         string   `json:"headline"`
+	Description      string   `json:"description,omitempty"`
+	URL              string   `json:"url"`
+	MainEntityOfPage string   `json:"mainEntityOfPage"`
+	Image            string   `json:"image"`
+	DatePublished    string   `json:"datePublished"`
+	DateModified     string   `json:"dateModified"`
+	Author           Person   `json:"author"`
+	Keywords         []string `json:"keywords,omitempty"`
+	WordCount        int      `json:"wordCount,omitempty"`
+}
+
+// author returns the site's author, as an article's author.
+func (s *Service) author() Person {
+	return Person{Type: "Person", Name: authorName, URL: s.URL("/")}
+}
+
+// PersonData returns the site's author, as the home page describes them, with
+// their profiles elsewhere and any others given, such as their actor.
+func (s *Service) PersonData(profiles ...string) Person {
+	person := s.author()
+	person.Context = schemaContext
+	person.Image = authorImageURL
+	person.JobTitle = authorJobTitle
+	person.WorksFor = &Organization{Type: "Organization", Name: "GitHub", URL: "https://github.com"}
+	person.SameAs = append(append([]string{}, authorProfiles...), profiles...)
+
+	return person
+}
+
+// PostData returns a post as a BlogPosting. A post which has not been revised
+// was last modified when it was published.
+func (s *Service) PostData(post posts.Post) BlogPosting {
+	url := s.URL("/writing/" + post.Slug)
+
+	modified := post.UpdatedAt
+	if modified.IsZero() {
+		modified = post.PublishedAt
+	}
+
+	return BlogPosting{
+		Context:          schemaContext,
+		Type:             "BlogPosting",
+		Headline:         post.Title,
+		Description:      post.Summary,
+		URL:              url,
+		MainEntityOfPage: url,
+		Image:            public.ShareImageURL(),
+		DatePublished:    post.PublishedAt.UTC().Format(time.RFC3339),
+		DateModified:     modified.UTC().Format(time.RFC3339),
+		Author:           s.author(),
+		Keywords:         post.Tags,
+		WordCount:        post.WordCount,
+	}
+}
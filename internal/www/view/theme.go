@@ -0,0 +1,103 @@
+package view
+
+import (
+	"net/http"
+	"strings"
+)
+
+// A Theme is the color scheme in which pages are shown.
+type Theme string
+
+const (
+	// ThemeAuto follows the reader's system preference, by linking every
+	// theme's stylesheet for the color scheme it styles.
+	ThemeAuto  Theme = "auto"
+	ThemeLight Theme = "light"
+	ThemeDark  Theme = "dark"
+)
+
+// Themes are the themes which a reader may choose, other than ThemeAuto.
+//
+//nolint:gochecknoglobals
+var Themes = []Theme{ThemeLight, ThemeDark}
+
+// ThemeCookie is the cookie in which a reader's chosen theme is kept.
+const ThemeCookie = "theme"
+
+// ColorSchemeHint is the client hint with which browsers send their reader's
+// preferred color scheme, once asked to with Accept-CH.
+//
+// SEE https://wicg.github.io/user-preference-media-features-headers/
+const ColorSchemeHint = "Sec-CH-Prefers-Color-Scheme"
+
+// ParseTheme returns the theme with the given name, if there is one.
+func ParseTheme(name string) (Theme, bool) {
+	switch theme := Theme(strings.ToLower(name)); theme {
+	case ThemeAuto, ThemeLight, ThemeDark:
+		return theme, true
+	default:
+		return "", false
+	}
+}
+
+// RequestTheme returns the theme in which to render a page for a request: the
+// one given by its theme query parameter, or else kept in its theme cookie, or
+// else the color scheme its browser hints that the reader prefers, or else
+// ThemeAuto.
+func RequestTheme(r *http.Request) Theme {
+	if theme, ok := ParseTheme(r.URL.Query().Get("theme")); ok {
+		return theme
+	}
+
+	if cookie, err := r.Cookie(ThemeCookie); err == nil {
+		if theme, ok := ParseTheme(cookie.Value); ok {
+			return theme
+		}
+	}
+
+	// The hint's value is a structured header string, such as "dark" with its
+	// quotes.
+	if theme, ok := ParseTheme(strings.Trim(r.Header.Get(ColorSchemeHint), `"`)); ok {
+		return theme
+	}
+
+	return ThemeAuto
+}
+
+// WithTheme renders the page in a theme. The default is ThemeAuto.
+func WithTheme(theme Theme) RenderOpt {
+	return func(opts *renderOpts) {
+		opts.theme = theme
+	}
+}
+
+// A themeStyle is a theme's stylesheet, as linked from a page, with the media
+// query for which it applies, if it does not always.
+type themeStyle struct {
+	URL   string
+	Media string
+}
+
+// themeStyles returns the stylesheets to link for a theme: its own, or, for
+// ThemeAuto, each theme's for the color scheme it styles.
+func (s *Service) themeStyles(theme Theme) []themeStyle {
+	assets := s.Assets()
+
+	if theme != ThemeAuto {
+		if url, ok := assets.Theme(string(theme)); ok {
+			return []themeStyle{{URL: url}}
+		}
+
+		return nil
+	}
+
+	styles := make([]themeStyle, 0, len(Themes))
+
+	for _, theme := range Themes {
+		if url, ok := assets.Theme(string(theme)); ok {
+			styles = append(styles, themeStyle{URL: url, Media: "(prefers-color-scheme: " + string(theme) + ")"})
+		}
+	}
+
+	return styles
+}
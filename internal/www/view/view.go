@@ -6,7 +6,13 @@ import (
 	"fmt"
 	html "html/template"
 	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
 	text "text/template"
+	"time"
 
 	"github.com/jclem/jclem.me/internal/pages"
 	"github.com/jclem/jclem.me/internal/posts"
@@ -14,22 +20,55 @@ import (
 )
 
 //go:embed templates
-var fs embed.FS
+var templatesFS embed.FS
 
 type Service struct {
 	pages    *pages.Service
 	posts    *posts.Service
-	html     *html.Template
-	xml      *text.Template
 	useHTTPS bool
 	hostname string
+
+	// dir is the directory from which templates are read, and assetDir the
+	// directory from which assets are, if they are not read from the binary.
+	dir      string
+	assetDir string
+
+	// mu guards the templates and assets, which are replaced when they are
+	// reloaded, and the error from reloading them.
+	mu       sync.RWMutex
+	html     *html.Template
+	xml      *text.Template
+	assets   *public.AssetManifest
+	locales  map[string]*Locale
+	parseErr error
+
+	// composed holds each page composed with its layout and slots, by page,
+	// layout, and locale. The HTML templates are never executed themselves, so
+	// that they can be cloned to compose pages.
+	composed map[pageKey]*html.Template
+}
+
+type pageKey struct {
+	name   string
+	layout string
+	locale string
 }
 
 type renderOpts struct {
 	title       string
 	description string
 	layout      string
-	noRoot      bool
+	image       string
+	canonical   string
+	pageType    string
+	publishedAt time.Time
+	modifiedAt  time.Time
+	scripts     []string
+	stylesheets []string
+	structured  []any
+	locale      string
+	alternates  []Alternate
+	theme       Theme
 }
 
 type RenderOpt func(*renderOpts)
@@ -46,121 +85,578 @@ func WithDescription(description string) RenderOpt {
 	}
 }
 
+// WithLayout renders the page within a layout, such as "writing/layout/show",
+// which is rendered within the root template. A layout renders the page with
+// {{template "content" .Data}}, and may use the page's title and other
+// metadata, as the root template does.
 func WithLayout(layout string) RenderOpt {
 	return func(opts *renderOpts) {
 		opts.layout = layout
 	}
 }
 
-func WithNoRoot() RenderOpt {
+// WithImage sets the image shown in link previews of the page.
+func WithImage(url string) RenderOpt {
+	return func(opts *renderOpts) {
+		opts.image = url
+	}
+}
+
+// WithCanonical sets the path of the page's canonical URL, which is always on
+// the site's own domain, so that search engines index the page once however
+// it is reached, such as with a query or from another host.
+func WithCanonical(path string) RenderOpt {
+	return func(opts *renderOpts) {
+		opts.canonical = path
+	}
+}
+
+// WithType sets the Open Graph type of the page, such as "article". The
+// default is "website".
+//
+// SEE https://ogp.me/#types
+func WithType(pageType string) RenderOpt {
+	return func(opts *renderOpts) {
+		opts.pageType = pageType
+	}
+}
+
+// WithPublishedTime sets the time an article was published.
+func WithPublishedTime(t time.Time) RenderOpt {
+	return func(opts *renderOpts) {
+		opts.publishedAt = t
+	}
+}
+
+// WithModifiedTime sets the time an article was last modified.
+func WithModifiedTime(t time.Time) RenderOpt {
+	return func(opts *renderOpts) {
+		opts.modifiedAt = t
+	}
+}
+
+// WithScript adds a script to the page's head, after the site's own, such as
+// a library which only the page uses. Scripts are deferred, so they run in
+// order once the page is parsed.
+func WithScript(url string) RenderOpt {
+	return func(opts *renderOpts) {
+		opts.scripts = append(opts.scripts, url)
+	}
+}
+
+// WithStylesheet adds a stylesheet to the page's head, after the site's own.
+func WithStylesheet(url string) RenderOpt {
 	return func(opts *renderOpts) {
-		opts.noRoot = true
+		opts.stylesheets = append(opts.stylesheets, url)
 	}
 }
 
+// WithStructuredData adds structured data describing the page, such as a
+// BlogPosting, which is encoded as JSON-LD in the page's head.
+func WithStructuredData(data any) RenderOpt {
+	return func(opts *renderOpts) {
+		opts.structured = append(opts.structured, data)
+	}
+}
+
+// WithLocale renders the page in a locale other than the default, by its tag,
+// such as "de".
+func WithLocale(tag string) RenderOpt {
+	return func(opts *renderOpts) {
+		opts.locale = tag
+	}
+}
+
+// An Alternate is a version of a page in another language.
+type Alternate struct {
+	Lang string
+	URL  string
+}
+
+// WithAlternate links a version of the page in another language, by its
+// locale's tag and its path, so that search engines show readers the version
+// in their language.
+//
+// SEE https://developers.google.com/search/docs/specialty/international/localized-versions
+func WithAlternate(tag, path string) RenderOpt {
+	return func(opts *renderOpts) {
+		opts.alternates = append(opts.alternates, Alternate{Lang: tag, URL: path})
+	}
+}
+
+// A renderedPage is the data with which the root template and layouts are
+// rendered. The page itself, and its slots, are rendered with Data.
 type renderedPage struct {
-	Title       string
-	Description string
-	Content     html.HTML
+	Lang         string
+	Theme        Theme
+	ColorScheme  string
+	ThemeStyles  []themeStyle
+	Title        string
+	Description  string
+	Image        string
+	CanonicalURL string
+	Type         string
+	PublishedAt  time.Time
+	ModifiedAt   time.Time
+	TwitterCard  string
+	Scripts      []string
+	Stylesheets  []string
+	Structured   []any
+	Alternates   []Alternate
+	Data         any
 }
 
+// Slots are the templates which a page may define to fill the root template's
+// blocks of the same names, by defining them after its own name, such as
+// "writing/show/head".
+//
+//nolint:gochecknoglobals
+var slots = []string{"head", "scripts"}
+
+// RenderHTML renders the named page within the root template, and within a
+// layout if one is given, in the default locale unless another is given.
 func (s *Service) RenderHTML(w io.Writer, name string, data any, opts ...RenderOpt) error {
-	ropts := &renderOpts{}
+	ropts := &renderOpts{locale: DefaultLocale, theme: ThemeAuto}
 	for _, opt := range opts {
 		opt(ropts)
 	}
 
-	var tbuf bytes.Buffer
-	if err := s.html.ExecuteTemplate(&tbuf, name, data); err != nil {
-		return fmt.Errorf("error executing template: %w", err)
+	page, err := s.page(name, ropts.layout, ropts.locale)
+	if err != nil {
+		return err
 	}
 
-	if ropts.layout != "" {
-		var lbuf bytes.Buffer
-		if err := s.html.ExecuteTemplate(&lbuf, ropts.layout, html.HTML(tbuf.String())); err != nil { //nolint:gosec
-			return fmt.Errorf("error executing template: %w", err)
-		}
+	return s.renderRoot(page, w, ropts, data)
+}
 
-		return s.renderRoot(w, ropts.title, ropts.description, html.HTML(lbuf.String())) //nolint:gosec
+// RenderFragment renders a template alone, without a layout or the root
+// template, such as to replace part of a page which is already shown. Of its
+// options, only its locale applies.
+func (s *Service) RenderFragment(w io.Writer, name string, data any, opts ...RenderOpt) error {
+	ropts := &renderOpts{locale: DefaultLocale, theme: ThemeAuto}
+	for _, opt := range opts {
+		opt(ropts)
 	}
 
-	if ropts.noRoot {
-		if _, err := w.Write(tbuf.Bytes()); err != nil {
-			return fmt.Errorf("error writing template: %w", err)
-		}
+	page, err := s.page(name, "", ropts.locale)
+	if err != nil {
+		return err
+	}
 
-		return nil
+	// The fragment is rendered before it is written, so that an error does
+	// not leave half of it swapped into the page.
+	var buf bytes.Buffer
+	if err := page.ExecuteTemplate(&buf, "content", data); err != nil {
+		return fmt.Errorf("error executing template: %w", err)
+	}
+
+	if _, err := w.Write(buf.Bytes()); err != nil {
+		return fmt.Errorf("error writing template: %w", err)
 	}
 
-	return s.renderRoot(w, ropts.title, ropts.description, html.HTML(tbuf.String())) //nolint:gosec
+	return nil
 }
 
 func (s *Service) RenderXML(w io.Writer, name string, data any) error {
-	if err := s.xml.ExecuteTemplate(w, name, data); err != nil {
+	_, xmltmpl, _ := s.templates()
+
+	if err := xmltmpl.ExecuteTemplate(w, name, data); err != nil {
 		return fmt.Errorf("error executing template: %w", err)
 	}
 
 	return nil
 }
 
-func (s *Service) renderRoot(w io.Writer, title, description string, content html.HTML) error {
-	if err := s.html.ExecuteTemplate(w, "root", renderedPage{
-		Title:       title,
-		Description: description,
-		Content:     content,
-	}); err != nil {
+func (s *Service) renderRoot(htmltmpl *html.Template, w io.Writer, ropts *renderOpts, data any) error {
+	var canonicalURL string
+	if ropts.canonical != "" {
+		canonicalURL = s.URL(ropts.canonical)
+	}
+
+	// A page with versions in other languages lists itself among them.
+	var alternates []Alternate
+	if len(ropts.alternates) > 0 && canonicalURL != "" {
+		alternates = append(alternates, Alternate{Lang: ropts.locale, URL: canonicalURL})
+	}
+
+	for _, alt := range ropts.alternates {
+		alternates = append(alternates, Alternate{Lang: alt.Lang, URL: s.URL(alt.URL)})
+	}
+
+	// Browsers draw their own controls, such as scrollbars, in the colors of
+	// the page's theme.
+	colorScheme := string(ropts.theme)
+	if ropts.theme == ThemeAuto {
+		colorScheme = "light dark"
+	}
+
+	page := renderedPage{
+		Lang:         ropts.locale,
+		Theme:        ropts.theme,
+		ColorScheme:  colorScheme,
+		ThemeStyles:  s.themeStyles(ropts.theme),
+		Title:        ropts.title,
+		Description:  ropts.description,
+		Image:        ropts.image,
+		CanonicalURL: canonicalURL,
+		Type:         ropts.pageType,
+		PublishedAt:  ropts.publishedAt,
+		ModifiedAt:   ropts.modifiedAt,
+		Scripts:      ropts.scripts,
+		Stylesheets:  ropts.stylesheets,
+		Structured:   ropts.structured,
+		Alternates:   alternates,
+		Data:         data,
+	}
+
+	// Pages with their own image show it large in link previews.
+	page.TwitterCard = "summary_large_image"
+	if page.Image == "" {
+		page.Image = public.ShareImageURL()
+		page.TwitterCard = "summary"
+	}
+
+	if page.Type == "" {
+		page.Type = "website"
+	}
+
+	// The page is rendered before it is written, so that an error does not
+	// leave half of it written.
+	var buf bytes.Buffer
+	if err := htmltmpl.ExecuteTemplate(&buf, "root", page); err != nil {
 		return fmt.Errorf("error executing template: %w", err)
 	}
 
+	if _, err := w.Write(buf.Bytes()); err != nil {
+		return fmt.Errorf("error writing template: %w", err)
+	}
+
 	return nil
 }
 
-func New(pages *pages.Service, posts *posts.Service, useHTTPS bool, hostname string) (*Service, error) {
-	svc := Service{pages: pages, posts: posts, useHTTPS: useHTTPS, hostname: hostname}
+// page returns the root template composed with the named page as its content,
+// the named layout, if any, as its layout, and the page's slots, with the
+// functions of the locale with the given tag. Composed pages are kept until
+// templates are reloaded.
+func (s *Service) page(name, layout, tag string) (*html.Template, error) {
+	key := pageKey{name: name, layout: layout, locale: tag}
+
+	s.mu.RLock()
+	base, page, locale, err := s.html, s.composed[key], s.locales[tag], s.parseErr
+	s.mu.RUnlock()
+
+	if err != nil {
+		return nil, err
+	}
+
+	if page != nil {
+		return page, nil
+	}
+
+	if locale == nil {
+		return nil, fmt.Errorf("unknown locale: %s", tag)
+	}
+
+	page, err = compose(base, name, layout, locale)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// If templates were reloaded meanwhile, the page is composed of the old
+	// ones, so it is used but not kept.
+	if s.html == base {
+		s.composed[key] = page
+	}
+
+	return page, nil
+}
+
+// compose clones the templates, binds the named page, layout, and slots to
+// the blocks of the root template which they fill, and binds the locale's
+// functions.
+func compose(base *html.Template, name, layout string, locale *Locale) (*html.Template, error) {
+	page, err := base.Clone()
+	if err != nil {
+		return nil, fmt.Errorf("error cloning templates: %w", err)
+	}
+
+	page.Funcs(locale.funcs())
+
+	// A block is replaced by one which renders the template bound to it,
+	// rather than by the template itself, so that errors name the template.
+	bind := func(block, name string) error {
+		if page.Lookup(name) == nil {
+			return fmt.Errorf("missing template: %s", name)
+		}
+
+		if _, err := page.New(block).Parse(fmt.Sprintf("{{template %q .}}", name)); err != nil {
+			return fmt.Errorf("error binding template %s: %w", name, err)
+		}
+
+		return nil
+	}
+
+	if err := bind("content", name); err != nil {
+		return nil, err
+	}
+
+	if layout != "" {
+		if err := bind("layout", layout); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, slot := range slots {
+		if page.Lookup(name+"/"+slot) == nil {
+			continue
+		}
+
+		if err := bind(slot, name+"/"+slot); err != nil {
+			return nil, err
+		}
+	}
+
+	return page, nil
+}
+
+// An Option configures a Service.
+type Option func(*Service)
+
+// WithTemplateDir reads templates from a directory on disk, such as
+// "internal/www/view/templates", rather than from the binary, so that they can
+// be reloaded while they are edited.
+func WithTemplateDir(dir string) Option {
+	return func(s *Service) {
+		s.dir = dir
+	}
+}
+
+// WithAssetDir reads stylesheets and scripts from a directory on disk, such as
+// "internal/www/public", rather than from the binary, so that they can be
+// reloaded as they are rebuilt.
+func WithAssetDir(dir string) Option {
+	return func(s *Service) {
+		s.assetDir = dir
+	}
+}
+
+func New(pages *pages.Service, posts *posts.Service, useHTTPS bool, hostname string, opts ...Option) (*Service, error) {
+	svc := &Service{pages: pages, posts: posts, useHTTPS: useHTTPS, hostname: hostname}
+	for _, opt := range opts {
+		opt(svc)
+	}
 
-	htmltmpl, err := html.New("").Funcs(html.FuncMap{
-		"mustGetStyles":  public.MustGetStyles,
-		"mustGetScripts": public.MustGetScripts,
-		"url":            svc.url(),
-	}).ParseFS(fs, "templates/*.html.tmpl")
+	htmltmpl, xmltmpl, locales, err := svc.parse()
 	if err != nil {
-		return nil, fmt.Errorf("error parsing html templates: %w", err)
+		return nil, err
 	}
 
-	svc.html = htmltmpl
+	assets, err := svc.loadAssets()
+	if err != nil {
+		return nil, err
+	}
+
+	svc.html, svc.xml, svc.assets, svc.locales = htmltmpl, xmltmpl, assets, locales
+	svc.composed = map[pageKey]*html.Template{}
+
+	return svc, nil
+}
+
+// parse parses the HTML and XML templates, and loads the locales. Templates
+// are parsed with the default locale's functions, which XML templates are
+// rendered with, and which HTML pages replace with those of their own locale.
+func (s *Service) parse() (*html.Template, *text.Template, map[string]*Locale, error) {
+	tfs, err := fs.Sub(templatesFS, "templates")
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("error reading templates: %w", err)
+	}
+
+	if s.dir != "" {
+		tfs = os.DirFS(s.dir)
+	}
 
-	subdirs, err := fs.ReadDir("templates")
+	locales, err := loadLocales(tfs)
 	if err != nil {
-		return nil, fmt.Errorf("error reading html templates directory: %w", err)
+		return nil, nil, nil, err
+	}
+
+	localeFuncs := locales[DefaultLocale].funcs()
+
+	htmltmpl, err := html.New("").Funcs(s.funcs()).Funcs(localeFuncs).Funcs(html.FuncMap{
+		"styles":         func() []string { return s.Assets().Styles() },
+		"scripts":        func() []string { return s.Assets().Scripts() },
+		"icons":          public.Icons,
+		"appleTouchIcon": public.AppleTouchIconURL,
+	}).ParseFS(tfs, "*.html.tmpl")
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("error parsing html templates: %w", err)
+	}
+
+	subdirs, err := fs.ReadDir(tfs, ".")
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("error reading html templates directory: %w", err)
 	}
 
 	for _, subdir := range subdirs {
-		if !subdir.IsDir() {
+		if !subdir.IsDir() || subdir.Name() == localesDir {
 			continue
 		}
 
-		_, err := htmltmpl.ParseFS(fs, "templates/"+subdir.Name()+"/*.tmpl")
+		_, err := htmltmpl.ParseFS(tfs, subdir.Name()+"/*.tmpl")
+		if err != nil {
+			return nil, nil, nil, fmt.Errorf("error parsing html templates: %w", err)
+		}
+	}
+
+	xmltmpl, err := text.New("").Funcs(s.funcs()).Funcs(localeFuncs).ParseFS(tfs, "*.xml.tmpl")
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("error parsing xml templates: %w", err)
+	}
+
+	return htmltmpl, xmltmpl, locales, nil
+}
+
+// loadAssets fingerprints the stylesheets and scripts.
+func (s *Service) loadAssets() (*public.AssetManifest, error) {
+	if s.assetDir == "" {
+		assets, err := public.Embedded()
+		if err != nil {
+			return nil, fmt.Errorf("error loading assets: %w", err)
+		}
+
+		return assets, nil
+	}
+
+	assets, err := public.NewAssetManifest(os.DirFS(s.assetDir))
+	if err != nil {
+		return nil, fmt.Errorf("error loading assets: %w", err)
+	}
+
+	return assets, nil
+}
+
+// Assets returns the manifest of the current stylesheets and scripts, which
+// serves them.
+func (s *Service) Assets() *public.AssetManifest {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.assets
+}
+
+// Live returns true if templates or assets are read from disk, and may be
+// reloaded.
+func (s *Service) Live() bool {
+	return s.dir != "" || s.assetDir != ""
+}
+
+// Dirs returns the directories from which templates and assets are read, for
+// watching, or nothing if they are read from the binary.
+func (s *Service) Dirs() ([]string, error) {
+	var dirs []string
+
+	if s.dir != "" {
+		entries, err := os.ReadDir(s.dir)
 		if err != nil {
-			return nil, fmt.Errorf("error parsing html templates: %w", err)
+			return nil, fmt.Errorf("error reading templates directory: %w", err)
+		}
+
+		dirs = append(dirs, s.dir)
+
+		for _, entry := range entries {
+			if entry.IsDir() {
+				dirs = append(dirs, filepath.Join(s.dir, entry.Name()))
+			}
 		}
 	}
 
+	if s.assetDir != "" {
+		dirs = append(dirs, filepath.Join(s.assetDir, "styles"), filepath.Join(s.assetDir, "scripts"))
+	}
+
+	return dirs, nil
+}
+
+// Reload parses templates and locales, and fingerprints assets, from disk
+// again. If they cannot be, the previous ones are kept, but rendering an HTML
+// page returns the error until they are fixed, so that it is shown rather than
+// a stale page.
+func (s *Service) Reload() error {
+	htmltmpl, xmltmpl, locales, err := s.parse()
+
+	var assets *public.AssetManifest
+	if err == nil {
+		assets, err = s.loadAssets()
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.parseErr = err
 	if err != nil {
-		return nil, fmt.Errorf("error parsing templates: %w", err)
+		return err
 	}
 
-	xmltmpl, err := text.New("").Funcs(text.FuncMap{"url": svc.url()}).ParseFS(fs, "templates/*.xml.tmpl")
+	s.html, s.xml, s.assets, s.locales = htmltmpl, xmltmpl, assets, locales
+	s.composed = map[pageKey]*html.Template{}
+
+	return nil
+}
+
+// templates returns the current templates, or the error from parsing them.
+func (s *Service) templates() (*html.Template, *text.Template, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.html, s.xml, s.parseErr
+}
+
+// Required templates are those which every page or feed depends on.
+//
+//nolint:gochecknoglobals
+var (
+	requiredHTMLTemplates = []string{"root", "error"}
+	requiredXMLTemplates  = []string{"rss.xml", "links.xml", "dispatches.xml", "sitemap.xml", "sitemap-index.xml"}
+)
+
+// Check returns an error if a required template is missing. Missing assets are
+// an error when the service is created.
+func (s *Service) Check() error {
+	htmltmpl, xmltmpl, err := s.templates()
 	if err != nil {
-		return nil, fmt.Errorf("error parsing xml templates: %w", err)
+		return err
+	}
+
+	for _, name := range requiredHTMLTemplates {
+		if htmltmpl.Lookup(name) == nil {
+			return fmt.Errorf("missing template: %s", name)
+		}
+	}
+
+	for _, name := range requiredXMLTemplates {
+		if xmltmpl.Lookup(name) == nil {
+			return fmt.Errorf("missing template: %s", name)
+		}
 	}
 
-	svc.xml = xmltmpl
+	return nil
+}
 
-	return &svc, nil
+// URL returns the absolute URL for the given path. URLs which are already
+// absolute, such as those of images on another host, are returned as they are.
+func (s *Service) URL(path string) string {
+	return s.url()(path)
 }
 
 func (s *Service) url() func(path string) string {
 	return func(path string) string {
+		if strings.HasPrefix(path, "http://") || strings.HasPrefix(path, "https://") {
+			return path
+		}
+
 		proto := "http://"
 		if s.useHTTPS {
 			proto = "https://"
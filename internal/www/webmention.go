@@ -0,0 +1,70 @@
+package www
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync/atomic"
+
+	"github.com/jclem/jclem.me/internal/telemetry"
+	"github.com/jclem/jclem.me/internal/webhooks"
+	"github.com/jclem/jclem.me/internal/webmention"
+)
+
+const webmentionPath = "/webmention"
+
+// errNotifierNotReady is returned when notifying of a webmention before the pub
+// router exists.
+var errNotifierNotReady = errors.New("webmention notification is not ready")
+
+// A webmentionNotifier emits a webhook for each verified webmention.
+//
+// As with dispatchFederator, the pub router is set once it is created, and
+// until then jobs which notify fail and are retried.
+type webmentionNotifier struct {
+	pub atomic.Pointer[pubRouter]
+}
+
+// notify implements webmention.NotifyFunc.
+func (n *webmentionNotifier) notify(ctx context.Context, mention webmention.Mention) error {
+	pub := n.pub.Load()
+	if pub == nil {
+		return errNotifierNotReady
+	}
+
+	return pub.pub.EmitWebhook(ctx, webhooks.NewEvent(webhooks.WebmentionReceived, map[string]any{ //nolint:wrapcheck
+		"source": mention.Source,
+		"target": mention.Target,
+	}))
+}
+
+// receiveWebmention accepts a webmention, which is verified by a job before
+// anyone is notified of it.
+//
+// SEE https://www.w3.org/TR/webmention/#receiving-webmentions
+func (p *pubRouter) receiveWebmention(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		returnBodyError(r.Context(), w, err, "invalid form")
+		return
+	}
+
+	mention := webmention.Mention{Source: r.PostForm.Get("source"), Target: r.PostForm.Get("target")}
+
+	if err := mention.Validate(p.cfg.URLHostname()); err != nil {
+		switch {
+		case errors.Is(err, webmention.ErrInvalidSource):
+			returnValidationError(r.Context(), w, "invalid webmention", fieldError{Field: "source", Message: "must be an absolute http or https URL"})
+		default:
+			returnValidationError(r.Context(), w, "invalid webmention", fieldError{Field: "target", Message: "must be another page on this site"})
+		}
+
+		return
+	}
+
+	if err := p.pub.InsertJob(r.Context(), webmention.VerifyArgs{Mention: mention, Trace: telemetry.Inject(r.Context())}); err != nil {
+		returnError(r.Context(), w, err, "error enqueueing webmention")
+		return
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+}
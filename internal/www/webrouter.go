@@ -1,17 +1,37 @@
 package www
 
 import (
+	"bytes"
+	"context"
 	"errors"
 	"fmt"
 	"html/template"
+	"io/fs"
 	"net/http"
+	"os"
+	"path/filepath"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/go-chi/chi/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	ap "github.com/jclem/jclem.me/internal/activitypub"
+	"github.com/jclem/jclem.me/internal/analytics"
+	"github.com/jclem/jclem.me/internal/bookmarks"
+	"github.com/jclem/jclem.me/internal/dispatches"
+	"github.com/jclem/jclem.me/internal/images"
+	"github.com/jclem/jclem.me/internal/openapi"
 	"github.com/jclem/jclem.me/internal/pages"
 	"github.com/jclem/jclem.me/internal/posts"
+	"github.com/jclem/jclem.me/internal/projects"
+	"github.com/jclem/jclem.me/internal/shortlinks"
+	"github.com/jclem/jclem.me/internal/storage"
+	"github.com/jclem/jclem.me/internal/timeline"
+	"github.com/jclem/jclem.me/internal/watch"
+	"github.com/jclem/jclem.me/internal/websub"
 	"github.com/jclem/jclem.me/internal/www/config"
+	"github.com/jclem/jclem.me/internal/www/public"
 	"github.com/jclem/jclem.me/internal/www/view"
 	"github.com/yuin/goldmark"
 	"github.com/yuin/goldmark/extension"
@@ -19,26 +39,159 @@ import (
 	"go.abhg.dev/goldmark/frontmatter"
 )
 
+// newImages creates the images service. Variants of new images are only
+// generated if storage is configured, and are only stored if database posts
+// are enabled, since embedded posts use the embedded manifest.
+func newImages(ctx context.Context, cfg config.Config, pool *pgxpool.Pool) (*images.Service, error) {
+	spaces, err := newStorage(cfg)
+	if err != nil && !errors.Is(err, storage.ErrNotConfigured) {
+		return nil, fmt.Errorf("error creating storage client: %w", err)
+	}
+
+	if !cfg.DatabasePosts {
+		pool = nil
+	}
+
+	images, err := images.New(pool, spaces)
+	if err != nil {
+		return nil, fmt.Errorf("error creating images service: %w", err)
+	}
+
+	if err := images.Start(ctx); err != nil {
+		return nil, fmt.Errorf("error starting images service: %w", err)
+	}
+
+	return images, nil
+}
+
+// newPosts creates and starts the posts service. Posts are also read from the
+// database if database posts are enabled.
+func newPosts(ctx context.Context, cfg config.Config, pool *pgxpool.Pool, images *images.Service) (*posts.Service, error) {
+	_, postsFS, _ := contentFS(cfg)
+
+	var store *posts.Store
+	if cfg.DatabasePosts && pool != nil {
+		store = posts.NewStore(pool, images)
+	}
+
+	posts := posts.New(postsFS, cfg.DefaultUser, store, images)
+	if err := posts.Start(ctx); err != nil {
+		return nil, fmt.Errorf("error starting posts service: %w", err)
+	}
+
+	return posts, nil
+}
+
+func newStorage(cfg config.Config) (*storage.Client, error) {
+	return storage.New(storage.Config{ //nolint:wrapcheck
+		KeyID:        cfg.SpacesKeyID,
+		Secret:       cfg.SpacesSecret,
+		Endpoint:     cfg.SpacesEndpoint,
+		Bucket:       cfg.SpacesBucket,
+		PublicURL:    cfg.SpacesPublicURL,
+		ACL:          cfg.SpacesACL,
+		CacheControl: cfg.SpacesCacheControl,
+	})
+}
+
 type webRouter struct {
 	*chi.Mux
-	md    goldmark.Markdown
-	pages *pages.Service
-	posts *posts.Service
-	view  *view.Service
+	cfg      config.Config
+	site     ap.Site
+	md       goldmark.Markdown
+	pages    *pages.Service
+	posts    *posts.Service
+	projects *projects.Service
+	images   *images.Service
+	view     *view.Service
+
+	// shortLinks, bookmarks, and dispatches are nil if there is no database.
+	shortLinks *shortlinks.Service
+	bookmarks  *bookmarks.Service
+	dispatches *dispatches.Service
+
+	// timeline interleaves every kind of content.
+	timeline *timeline.Service
+
+	// feeds notifies the WebSub hub when feeds change.
+	feeds *feedPublisher
+
+	// api is the OpenAPI document of the authenticated API.
+	api *openapi.Document
+}
+
+// contentFS returns the file systems from which pages, posts, and projects are
+// read. In development, if a content directory is configured, they are read
+// from disk.
+func contentFS(cfg config.Config) (fs.FS, fs.FS, fs.FS) {
+	if dir := liveContentDir(cfg); dir != "" {
+		return os.DirFS(filepath.Join(dir, "pages")),
+			os.DirFS(filepath.Join(dir, "posts")),
+			os.DirFS(filepath.Join(dir, "projects"))
+	}
+
+	return pages.Content, posts.Content, projects.Content
+}
+
+func liveContentDir(cfg config.Config) string {
+	if !cfg.IsDev() {
+		return ""
+	}
+
+	return cfg.ContentDir
+}
+
+func liveTemplateDir(cfg config.Config) string {
+	if !cfg.IsDev() {
+		return ""
+	}
+
+	return cfg.TemplateDir
+}
+
+func liveAssetDir(cfg config.Config) string {
+	if !cfg.IsDev() {
+		return ""
+	}
+
+	return cfg.AssetDir
 }
 
-func newWebRouter() (*webRouter, error) {
-	pages := pages.New()
+// newWebRouter creates the web router. Page views are counted by the given
+// recorder, if it is not nil.
+func newWebRouter(ctx context.Context, cfg config.Config, pool *pgxpool.Pool, recorder *analytics.Recorder) (*webRouter, error) {
+	pagesFS, _, projectsFS := contentFS(cfg)
+
+	pages := pages.New(pagesFS)
 	if err := pages.Start(); err != nil {
 		return nil, fmt.Errorf("error starting pages service: %w", err)
 	}
 
-	posts := posts.New()
-	if err := posts.Start(); err != nil {
-		return nil, fmt.Errorf("error starting posts service: %w", err)
+	projects := projects.New(projectsFS)
+	if err := projects.Start(); err != nil {
+		return nil, fmt.Errorf("error starting projects service: %w", err)
 	}
 
-	view, err := view.New(pages, posts, config.URLUseHTTPS(), config.URLHostname())
+	images, err := newImages(ctx, cfg, pool)
+	if err != nil {
+		return nil, err
+	}
+
+	posts, err := newPosts(ctx, cfg, pool, images)
+	if err != nil {
+		return nil, err
+	}
+
+	var viewOpts []view.Option
+	if dir := liveTemplateDir(cfg); dir != "" {
+		viewOpts = append(viewOpts, view.WithTemplateDir(dir))
+	}
+
+	if dir := liveAssetDir(cfg); dir != "" {
+		viewOpts = append(viewOpts, view.WithAssetDir(dir))
+	}
+
+	view, err := view.New(pages, posts, cfg.URLUseHTTPS(), cfg.URLHostname(), viewOpts...)
 	if err != nil {
 		return nil, fmt.Errorf("error creating view service: %w", err)
 	}
@@ -56,30 +209,156 @@ func newWebRouter() (*webRouter, error) {
 	)
 
 	r := chi.NewRouter()
-	w := &webRouter{Mux: r, md: md, pages: pages, posts: posts, view: view}
-	r.Get("/", w.renderHome)
-	r.Get("/writing", w.listPosts)
-	r.Get("/writing/{slug}", w.showPost)
-	r.Get("/sitemap.xml", w.sitemap)
-	r.Get("/rss.xml", w.rss)
-	r.Handle("/public/*", http.StripPrefix("/public/", http.FileServer(http.Dir("internal/www/public"))))
+	w := &webRouter{Mux: r, cfg: cfg, site: ap.NewSite(cfg), md: md, pages: pages, posts: posts, projects: projects, images: images, view: view, feeds: newFeedPublisher(ctx, cfg, view)}
+
+	// Without a database, dispatches are kept in memory, and there are no short
+	// links or bookmarks.
+	if pool != nil {
+		w.shortLinks = shortlinks.New(pool)
+		w.bookmarks = bookmarks.New(pool)
+		w.dispatches = dispatches.New(pool)
+	} else {
+		w.dispatches = dispatches.NewWithStore(dispatches.NewMemoryStore())
+	}
+
+	w.timeline = w.newTimeline()
+	w.api = newAPIDocument(view, w.site)
+
+	r.Use(problemDomain(cfg.WebDomain))
+
+	if recorder != nil {
+		r.Use(recorder.Middleware)
+	}
+
+	r.Use(canonicalPath)
+	r.Use(limitBody(maxBodyBytes))
+
+	r.Group(func(r chi.Router) {
+		r.Use(w.negotiateTheme)
+		r.Use(conditionalGet)
+		r.With(cacheControl(cfg, htmlCachePolicy)).Get("/", w.renderHome)
+		r.With(cacheControl(cfg, htmlCachePolicy)).Get("/writing", w.listPosts)
+		r.With(cacheControl(cfg, htmlCachePolicy)).Get("/writing/tags", w.listTags)
+		r.With(cacheControl(cfg, htmlCachePolicy)).Get("/writing/tags/{tag}", w.listTaggedPosts)
+		r.With(cacheControl(cfg, htmlCachePolicy)).Get("/writing/{year:[0-9]{4}}", w.listPeriodPosts)
+		r.With(cacheControl(cfg, htmlCachePolicy)).Get("/writing/{year:[0-9]{4}}/{month:[0-9]{2}}", w.listPeriodPosts)
+		r.With(cacheControl(cfg, htmlCachePolicy)).Get("/writing/{slug}", w.showPost)
+		r.With(cacheControl(cfg, feedCachePolicy)).Get("/sitemap.xml", w.sitemap)
+		r.With(cacheControl(cfg, feedCachePolicy)).Get("/sitemap-{page:[0-9]+}.xml", w.sitemapPage)
+		r.With(cacheControl(cfg, feedCachePolicy)).Get(rssPath, w.rss)
+		r.With(cacheControl(cfg, htmlCachePolicy)).Get("/links", w.listBookmarks)
+		r.With(cacheControl(cfg, htmlCachePolicy)).Get("/photos", w.listPhotos)
+		r.With(cacheControl(cfg, htmlCachePolicy)).Get("/dispatches", w.listDispatches)
+		r.With(cacheControl(cfg, feedCachePolicy)).Get(dispatchesRSSPath, w.dispatchesRSS)
+		r.With(cacheControl(cfg, htmlCachePolicy)).Get("/projects", w.listProjects)
+		r.With(cacheControl(cfg, htmlCachePolicy)).Get("/everything", w.listEverything)
+		r.With(cacheControl(cfg, feedCachePolicy)).Get(linksRSSPath, w.bookmarksRSS)
+		r.With(cacheControl(cfg, htmlCachePolicy)).Get("/problems/{type}", w.showProblem)
+		r.With(cacheControl(cfg, htmlCachePolicy)).Get(apiDocsPath, w.showAPIDocs)
+	})
+	r.Group(func(r chi.Router) {
+		r.Use(cacheControl(cfg, staticCachePolicy))
+		r.Get("/robots.txt", w.robots)
+		r.Get("/site.webmanifest", w.manifest)
+		r.Get(openAPIPath, w.serveOpenAPI)
+		r.Get("/favicon.ico", redirectTo(public.FaviconURL()))
+		r.Get("/apple-touch-icon.png", redirectTo(public.AppleTouchIconURL()))
+	})
+	r.Get("/s/{code}", w.followShortLink)
+	r.NotFound(w.notFound)
+	r.MethodNotAllowed(w.methodNotAllowed)
+	r.With(assetCacheControl(cfg)).Handle("/public/*", http.StripPrefix("/public/", http.HandlerFunc(w.serveAsset)))
+
+	// Embedded posts can only change when a new binary boots. Posts, dispatches,
+	// and links in the database are published by the admin API as they change.
+	w.feeds.publish(feedPaths...)
 
 	return w, nil
 }
 
+const rssPath = "/rss.xml"
+
+// watchContent reloads pages, posts, projects, and templates whenever they
+// change on disk, until ctx is done. It does nothing unless they are read from
+// disk.
+func (wr *webRouter) watchContent(ctx context.Context) error {
+	var dirs []string
+
+	dir := liveContentDir(wr.cfg)
+	if dir != "" {
+		dirs = append(dirs, filepath.Join(dir, "pages"), filepath.Join(dir, "posts"), filepath.Join(dir, "projects"))
+	}
+
+	templateDirs, err := wr.view.Dirs()
+	if err != nil {
+		return fmt.Errorf("error listing template directories: %w", err)
+	}
+
+	dirs = append(dirs, templateDirs...)
+	if len(dirs) == 0 {
+		return nil
+	}
+
+	//nolint:wrapcheck
+	return watch.Watch(ctx, func(ctx context.Context) error {
+		if wr.view.Live() {
+			if err := wr.view.Reload(); err != nil {
+				return fmt.Errorf("error reloading templates: %w", err)
+			}
+		}
+
+		if dir == "" {
+			return nil
+		}
+
+		if err := wr.pages.Reload(); err != nil {
+			return fmt.Errorf("error reloading pages: %w", err)
+		}
+
+		if err := wr.posts.Reload(ctx); err != nil {
+			return fmt.Errorf("error reloading posts: %w", err)
+		}
+
+		if err := wr.projects.Reload(); err != nil {
+			return fmt.Errorf("error reloading projects: %w", err)
+		}
+
+		return nil
+	}, dirs...)
+}
+
+type homeData struct {
+	Content   template.HTML
+	PubDomain string
+	PubURL    string
+	PubHandle string
+
+	// Recent is the most recent activity of every kind.
+	Recent []timeline.Item
+}
+
 func (wr *webRouter) renderHome(w http.ResponseWriter, r *http.Request) {
 	page, err := wr.pages.Get("about")
 	if err != nil {
-		returnError(r.Context(), w, err, "error getting page")
+		wr.renderError(w, r, err, "error getting page")
 
 		return
 	}
 
-	if err := wr.view.RenderHTML(w, "home", struct{ Content template.HTML }{Content: page.Content},
+	if err := wr.view.RenderHTML(w, "home", homeData{
+		Content:   page.Content,
+		PubDomain: wr.site.Domain,
+		PubURL:    wr.site.BaseURL,
+		PubHandle: fmt.Sprintf("@%s@%s", wr.site.DefaultUser, wr.site.Domain),
+		Recent:    wr.recentActivity(r.Context()),
+	},
 		view.WithTitle(page.Title),
+		view.WithTheme(view.RequestTheme(r)),
 		view.WithDescription(page.Description),
+		view.WithCanonical("/"),
+		view.WithStructuredData(wr.view.PersonData(wr.site.BaseURL)),
 	); err != nil {
-		returnError(r.Context(), w, err, "error rendering page")
+		wr.renderError(w, r, err, "error rendering page")
 
 		return
 	}
@@ -91,77 +370,487 @@ type listPostsData struct {
 	Posts       []posts.Post
 }
 
+type archiveData struct {
+	Years []posts.Year
+}
+
 func (wr *webRouter) listPosts(w http.ResponseWriter, r *http.Request) {
-	posts := wr.posts.List()
+	setLastModified(w, lastPublished(wr.posts.List(posts.WithAuthor(wr.cfg.DefaultUser))))
 
-	if err := wr.view.RenderHTML(w, "writing/index", listPostsData{Posts: posts},
+	if err := wr.view.RenderHTML(w, "writing/archive", archiveData{Years: wr.posts.Archive(posts.WithAuthor(wr.cfg.DefaultUser))},
 		view.WithTitle("Writing Archive"),
+		view.WithTheme(view.RequestTheme(r)),
 		view.WithDescription("A collection of articles and blog posts by Jonathan Clem"),
 		view.WithLayout("writing/layout/index"),
+		view.WithCanonical("/writing"),
+	); err != nil {
+		wr.renderError(w, r, err, "error rendering page")
+
+		return
+	}
+}
+
+// listPeriodPosts lists the posts published in a year, or in a month of a
+// year.
+func (wr *webRouter) listPeriodPosts(w http.ResponseWriter, r *http.Request) {
+	year, err := strconv.Atoi(chi.URLParam(r, "year"))
+	if err != nil {
+		wr.renderCodeError(w, r, http.StatusNotFound, "invalid year")
+
+		return
+	}
+
+	var month time.Month
+
+	title := fmt.Sprintf("Posts from %d", year)
+
+	if param := chi.URLParam(r, "month"); param != "" {
+		m, err := strconv.Atoi(param)
+		if err != nil || m < 1 || m > 12 {
+			wr.renderCodeError(w, r, http.StatusNotFound, "invalid month")
+
+			return
+		}
+
+		month = time.Month(m)
+		title = fmt.Sprintf("Posts from %s %d", month, year)
+	}
+
+	posts := wr.posts.List(posts.WithAuthor(wr.cfg.DefaultUser), posts.WithPublishedIn(year, month))
+	if len(posts) == 0 {
+		wr.renderCodeError(w, r, http.StatusNotFound, "no posts were published in this period")
+
+		return
+	}
+
+	setLastModified(w, lastPublished(posts))
+
+	if err := wr.view.RenderHTML(w, "writing/index", listPostsData{Title: title, Posts: posts},
+		view.WithTitle(title),
+		view.WithTheme(view.RequestTheme(r)),
+		view.WithDescription("Articles and blog posts by Jonathan Clem"),
+		view.WithLayout("writing/layout/show"),
+		view.WithCanonical(r.URL.Path),
+	); err != nil {
+		wr.renderError(w, r, err, "error rendering page")
+
+		return
+	}
+}
+
+func (wr *webRouter) listTaggedPosts(w http.ResponseWriter, r *http.Request) {
+	tag := strings.ToLower(chi.URLParam(r, "tag"))
+
+	posts := wr.posts.List(posts.WithAuthor(wr.cfg.DefaultUser), posts.WithTag(tag))
+	if len(posts) == 0 {
+		wr.renderCodeError(w, r, http.StatusNotFound, fmt.Sprintf("tag not found: %s", tag))
+
+		return
+	}
+
+	setLastModified(w, lastPublished(posts))
+
+	title := fmt.Sprintf("Posts tagged #%s", tag)
+
+	if err := wr.view.RenderHTML(w, "writing/index", listPostsData{Title: title, Posts: posts},
+		view.WithTitle(title),
+		view.WithTheme(view.RequestTheme(r)),
+		view.WithDescription(fmt.Sprintf("Articles and blog posts by Jonathan Clem tagged #%s", tag)),
+		view.WithLayout("writing/layout/show"),
+		view.WithCanonical("/writing/tags/"+tag),
+	); err != nil {
+		wr.renderError(w, r, err, "error rendering page")
+
+		return
+	}
+}
+
+type listTagsData struct {
+	Tags []posts.Tag
+}
+
+func (wr *webRouter) listTags(w http.ResponseWriter, r *http.Request) {
+	tags := wr.posts.Tags(posts.WithAuthor(wr.cfg.DefaultUser))
+	setLastModified(w, lastPublished(wr.posts.List(posts.WithAuthor(wr.cfg.DefaultUser))))
+
+	if err := wr.view.RenderHTML(w, "writing/tags", listTagsData{Tags: tags},
+		view.WithTitle("Tags"),
+		view.WithTheme(view.RequestTheme(r)),
+		view.WithDescription("Topics of articles and blog posts by Jonathan Clem"),
+		view.WithLayout("writing/layout/show"),
+		view.WithCanonical("/writing/tags"),
 	); err != nil {
-		returnError(r.Context(), w, err, "error rendering page")
+		wr.renderError(w, r, err, "error rendering page")
 
 		return
 	}
 }
 
+// mathJaxURL is the script which typesets the math in posts which have any.
+// It is configured by the post's head.
+const mathJaxURL = "https://cdn.jsdelivr.net/npm/mathjax@3/es5/tex-mml-svg.min.js"
+
+type showPostData struct {
+	posts.Post
+	Related []posts.Post
+}
+
 func (wr *webRouter) showPost(w http.ResponseWriter, r *http.Request) {
 	slug := chi.URLParam(r, "slug")
 
 	post, err := wr.posts.Get(slug)
+	if err == nil && post.Author != wr.cfg.DefaultUser {
+		err = posts.PostNotFoundError{Slug: slug}
+	}
+
 	if err != nil {
 		if errors.As(err, &posts.PostNotFoundError{}) {
-			returnCodeError(r.Context(), w, http.StatusNotFound, fmt.Sprintf("post not found: %s", slug))
+			if to, ok := wr.posts.Redirect(slug); ok {
+				http.Redirect(w, r, "/writing/"+to, http.StatusMovedPermanently)
+				return
+			}
+
+			wr.renderCodeError(w, r, http.StatusNotFound, fmt.Sprintf("post not found: %s", slug))
 
 			return
 		}
 
-		returnError(r.Context(), w, err, "error getting post")
+		wr.renderError(w, r, err, "error getting post")
 
 		return
 	}
 
-	if err := wr.view.RenderHTML(w, "writing/show", post,
+	setLastModified(w, post.PublishedAt)
+
+	opts := []view.RenderOpt{
 		view.WithTitle(post.Title),
+		view.WithTheme(view.RequestTheme(r)),
 		view.WithDescription(post.Summary),
-		view.WithLayout("writing/layout/show")); err != nil {
-		returnError(r.Context(), w, err, "error rendering page")
+		view.WithLayout("writing/layout/show"),
+		view.WithType("article"),
+		view.WithCanonical("/writing/" + post.Slug),
+		view.WithStructuredData(wr.view.PostData(post)),
+		view.WithPublishedTime(post.PublishedAt),
+		view.WithModifiedTime(post.UpdatedAt),
+	}
+
+	if post.HasMath {
+		opts = append(opts, view.WithScript(mathJaxURL))
+	}
+
+	if err := wr.view.RenderHTML(w, "writing/show", showPostData{Post: post, Related: wr.posts.Related(post.Slug)}, opts...); err != nil {
+		wr.renderError(w, r, err, "error rendering page")
 
 		return
 	}
 }
 
-func (wr *webRouter) sitemap(w http.ResponseWriter, r *http.Request) {
-	posts := wr.posts.List()
+type rssData struct {
+	BuildDate time.Time
+	Hub       string
+	Posts     []posts.Post
+}
+
+func (wr *webRouter) rss(w http.ResponseWriter, r *http.Request) {
+	posts := wr.posts.List(posts.WithAuthor(wr.cfg.DefaultUser))
+	now := time.Now()
+
+	// The build date is the date of the latest post so that the feed's
+	// content, and therefore its ETag, only changes when a post is published.
+	buildDate := lastPublished(posts)
+	if buildDate.IsZero() {
+		buildDate = now
+	}
 
 	w.Header().Set("Content-Type", "application/xml")
+	setLastModified(w, buildDate)
 
-	if err := wr.view.RenderXML(w, "sitemap.xml", posts); err != nil {
-		returnError(r.Context(), w, err, "error rendering sitemap")
+	if hub := wr.cfg.WebSubHub; hub != "" {
+		w.Header().Set("Link", websub.LinkHeader(hub, wr.view.URL(rssPath)))
+	}
+
+	if err := wr.view.RenderXML(w, "rss.xml", rssData{
+		BuildDate: buildDate,
+		Hub:       wr.cfg.WebSubHub,
+		Posts:     posts,
+	}); err != nil {
+		wr.renderError(w, r, err, "error rendering rss")
 
 		return
 	}
 }
 
-type rssData struct {
-	BuildDate     string
-	CopyrightYear string
-	Posts         []posts.Post
+// photosPerPage is the number of photos on each page of the gallery.
+const photosPerPage = 24
+
+type photosData struct {
+	Photos []dispatches.Dispatch
+
+	// Next is the URL of the next page of older photos, if there is one.
+	Next string
 }
 
-func (wr *webRouter) rss(w http.ResponseWriter, r *http.Request) {
-	posts := wr.posts.List()
-	now := time.Now()
+// listPhotos renders the default user's dispatches which have images as a
+// gallery, paginated by the ID of the last dispatch on the previous page.
+func (wr *webRouter) listPhotos(w http.ResponseWriter, r *http.Request) {
+	var data photosData
+
+	photos, next, err := wr.listDispatchPage(r, photosPerPage, dispatches.WithType(dispatches.TypeImage))
+	if err != nil {
+		var qerr dispatchQueryError
+		if errors.As(err, &qerr) {
+			wr.renderCodeError(w, r, http.StatusBadRequest, qerr.Error())
+
+			return
+		}
+
+		wr.renderError(w, r, err, "error listing photos")
+
+		return
+	}
+
+	data.Photos, data.Next = photos, next
+
+	if err := wr.view.RenderHTML(w, "photos/index", data,
+		view.WithTitle("Photos"),
+		view.WithTheme(view.RequestTheme(r)),
+		view.WithDescription("Photos by Jonathan Clem"),
+		view.WithLayout("writing/layout/index"),
+		view.WithCanonical("/photos"),
+	); err != nil {
+		wr.renderError(w, r, err, "error rendering page")
+
+		return
+	}
+}
+
+func (wr *webRouter) listProjects(w http.ResponseWriter, r *http.Request) {
+	if err := wr.view.RenderHTML(w, "projects/index", wr.projects.List(),
+		view.WithTitle("Projects"),
+		view.WithTheme(view.RequestTheme(r)),
+		view.WithDescription("Projects by Jonathan Clem"),
+		view.WithLayout("writing/layout/index"),
+		view.WithCanonical("/projects"),
+	); err != nil {
+		wr.renderError(w, r, err, "error rendering page")
+
+		return
+	}
+}
+
+const linksRSSPath = "/links/rss.xml"
+
+// listRecentBookmarks lists the default user's most recent bookmarks, or none
+// if there is no database.
+func (wr *webRouter) listRecentBookmarks(ctx context.Context) ([]bookmarks.Bookmark, error) {
+	if wr.bookmarks == nil {
+		return nil, nil
+	}
+
+	return wr.bookmarks.List(ctx, wr.cfg.DefaultUser, bookmarks.DefaultLimit) //nolint:wrapcheck
+}
+
+func (wr *webRouter) listBookmarks(w http.ResponseWriter, r *http.Request) {
+	list, err := wr.listRecentBookmarks(r.Context())
+	if err != nil {
+		wr.renderError(w, r, err, "error listing bookmarks")
+
+		return
+	}
+
+	if len(list) > 0 {
+		setLastModified(w, list[0].CreatedAt)
+	}
+
+	if err := wr.view.RenderHTML(w, "links/index", list,
+		view.WithTitle("Links"),
+		view.WithTheme(view.RequestTheme(r)),
+		view.WithDescription("Links shared by Jonathan Clem"),
+		view.WithLayout("writing/layout/index"),
+		view.WithCanonical("/links"),
+	); err != nil {
+		wr.renderError(w, r, err, "error rendering page")
+
+		return
+	}
+}
+
+type bookmarksRSSData struct {
+	BuildDate time.Time
+	Hub       string
+	Bookmarks []bookmarks.Bookmark
+}
+
+func (wr *webRouter) bookmarksRSS(w http.ResponseWriter, r *http.Request) {
+	list, err := wr.listRecentBookmarks(r.Context())
+	if err != nil {
+		wr.renderError(w, r, err, "error listing bookmarks")
+
+		return
+	}
+
+	// As with the posts feed, the build date is the date of the latest
+	// bookmark so that the feed only changes when a bookmark is added.
+	buildDate := time.Now()
+	if len(list) > 0 {
+		buildDate = list[0].CreatedAt
+	}
 
 	w.Header().Set("Content-Type", "application/xml")
+	setLastModified(w, buildDate)
 
-	if err := wr.view.RenderXML(w, "rss.xml", rssData{
-		BuildDate:     now.UTC().Format(http.TimeFormat),
-		CopyrightYear: strconv.Itoa(now.Year() - 1),
-		Posts:         posts,
+	if hub := wr.cfg.WebSubHub; hub != "" {
+		w.Header().Set("Link", websub.LinkHeader(hub, wr.view.URL(linksRSSPath)))
+	}
+
+	if err := wr.view.RenderXML(w, "links.xml", bookmarksRSSData{
+		BuildDate: buildDate,
+		Hub:       wr.cfg.WebSubHub,
+		Bookmarks: list,
 	}); err != nil {
-		returnError(r.Context(), w, err, "error rendering rss")
+		wr.renderError(w, r, err, "error rendering rss")
+
+		return
+	}
+}
+
+func (wr *webRouter) robots(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Write([]byte(public.Robots(wr.view.URL("/sitemap.xml"), wr.cfg.RobotsDisallowAI))) //nolint:errcheck
+}
+
+func (wr *webRouter) manifest(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/manifest+json")
+	writeResponse(w, r, public.NewManifest())
+}
+
+// followShortLink redirects to the URL of a short link. The redirect is
+// temporary so that every click is counted.
+func (wr *webRouter) followShortLink(w http.ResponseWriter, r *http.Request) {
+	if wr.shortLinks == nil {
+		wr.notFound(w, r)
+		return
+	}
+
+	target, err := wr.shortLinks.Follow(r.Context(), chi.URLParam(r, "code"))
+	if err != nil {
+		if errors.Is(err, shortlinks.ErrLinkNotFound) {
+			wr.notFound(w, r)
+			return
+		}
+
+		wr.renderError(w, r, err, "error following short link")
+
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	http.Redirect(w, r, target, http.StatusFound)
+}
+
+// serveAsset serves a fingerprinted stylesheet or script, as the view's
+// current manifest lists it.
+func (wr *webRouter) serveAsset(w http.ResponseWriter, r *http.Request) {
+	wr.view.Assets().ServeHTTP(w, r)
+}
+
+func redirectTo(url string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, url, http.StatusFound)
+	}
+}
+
+// showProblem documents the problem type whose URI was requested, so that the
+// types of problem details responses are dereferenceable.
+func (wr *webRouter) showProblem(w http.ResponseWriter, r *http.Request) {
+	typ := chi.URLParam(r, "type")
+
+	doc, ok := problemDocs[typ]
+	if !ok {
+		wr.notFound(w, r)
+		return
+	}
+
+	doc.URI = problemTypeURI(r.Context(), typ)
+
+	if err := wr.view.RenderHTML(w, "problems/show", doc, view.WithTitle(doc.Title), view.WithTheme(view.RequestTheme(r)), view.WithCanonical(r.URL.Path)); err != nil {
+		wr.renderError(w, r, err, "error rendering problem")
+		return
+	}
+}
+
+func (wr *webRouter) notFound(w http.ResponseWriter, r *http.Request) {
+	wr.renderCodeError(w, r, http.StatusNotFound, "There is nothing at this address.")
+}
+
+func (wr *webRouter) methodNotAllowed(w http.ResponseWriter, r *http.Request) {
+	wr.renderCodeError(w, r, http.StatusMethodNotAllowed, fmt.Sprintf("This address does not support %s requests.", r.Method))
+}
+
+type errorData struct {
+	Code    int
+	Title   string
+	Message string
+}
+
+// acceptsHTML returns true if the client accepts HTML responses, as browsers
+// do.
+func acceptsHTML(r *http.Request) bool {
+	return strings.Contains(r.Header.Get("Accept"), "text/html")
+}
+
+// renderCodeError responds with an error page to browsers, and with a JSON
+// error to other clients.
+func (wr *webRouter) renderCodeError(w http.ResponseWriter, r *http.Request, code int, message string) {
+	if !acceptsHTML(r) {
+		returnCodeError(r.Context(), w, code, message)
+		return
+	}
+
+	wr.renderErrorPage(w, r, code, message)
+}
+
+// renderError logs an unexpected error and responds with an internal server
+// error page to browsers, and with a JSON error to other clients.
+func (wr *webRouter) renderError(w http.ResponseWriter, r *http.Request, err error, message string) {
+	if !acceptsHTML(r) {
+		returnError(r.Context(), w, err, message)
+		return
+	}
+
+	logError(r.Context(), err, message)
+	w.Header().Set("Cache-Control", "no-store")
+
+	// While templates are edited, the error itself is shown, since the error
+	// page may be what is broken.
+	if wr.view.Live() {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.WriteHeader(http.StatusInternalServerError)
+
+		if err := wr.view.RenderOverlay(w, fmt.Errorf("%s: %w", message, err)); err != nil {
+			logError(r.Context(), err, "error rendering error overlay")
+		}
 
 		return
 	}
+
+	wr.renderErrorPage(w, r, http.StatusInternalServerError, "Something went wrong. Please try again later.")
+}
+
+func (wr *webRouter) renderErrorPage(w http.ResponseWriter, r *http.Request, code int, message string) {
+	title := http.StatusText(code)
+
+	// The page is rendered to a buffer first so that a template error can
+	// still be reported with the right status code.
+	var buf bytes.Buffer
+	if err := wr.view.RenderHTML(&buf, "error", errorData{Code: code, Title: title, Message: message}, view.WithTitle(title), view.WithTheme(view.RequestTheme(r))); err != nil {
+		logError(r.Context(), err, "error rendering error page")
+		http.Error(w, title, code)
+
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(code)
+	w.Write(buf.Bytes()) //nolint:errcheck
 }
@@ -0,0 +1,509 @@
+package www
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jclem/jclem.me/internal/posts"
+	"github.com/jclem/jclem.me/internal/www/view"
+)
+
+// copyTemplates copies the templates to a temporary directory, which is
+// returned, so that they can be edited.
+func copyTemplates(t *testing.T) string {
+	t.Helper()
+
+	dir := t.TempDir()
+
+	err := filepath.WalkDir("view/templates", func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel("view/templates", path)
+		if err != nil {
+			return err //nolint:wrapcheck
+		}
+
+		if d.IsDir() {
+			return os.MkdirAll(filepath.Join(dir, rel), 0o755) //nolint:wrapcheck
+		}
+
+		b, err := os.ReadFile(path)
+		if err != nil {
+			return err //nolint:wrapcheck
+		}
+
+		return os.WriteFile(filepath.Join(dir, rel), b, 0o600) //nolint:wrapcheck
+	})
+	if err != nil {
+		t.Fatalf("error copying templates: %v", err)
+	}
+
+	return dir
+}
+
+func TestTemplateReload(t *testing.T) {
+	dir := copyTemplates(t)
+
+	cfg := testConfig
+	cfg.TemplateDir = dir
+
+	wr, err := newWebRouter(context.Background(), cfg, nil, nil)
+	if err != nil {
+		t.Fatalf("error creating web router: %v", err)
+	}
+
+	get := func() *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/problems/validation", nil)
+		req.Header.Set("Accept", "text/html")
+
+		w := httptest.NewRecorder()
+		wr.ServeHTTP(w, req)
+
+		return w
+	}
+
+	template := filepath.Join(dir, "problems", "show.html.tmpl")
+
+	if err := os.WriteFile(template, []byte(`{{define "problems/show"}}<h1>Edited {{.Title}}</h1>{{end}}`), 0o600); err != nil {
+		t.Fatalf("error writing template: %v", err)
+	}
+
+	if err := wr.view.Reload(); err != nil {
+		t.Fatalf("error reloading templates: %v", err)
+	}
+
+	if w := get(); w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "Edited Validation failed") {
+		t.Errorf("expected the edited template, got %d: %s", w.Code, w.Body)
+	}
+
+	if err := os.WriteFile(template, []byte(`{{define "problems/show"}}{{.Title}`), 0o600); err != nil {
+		t.Fatalf("error writing template: %v", err)
+	}
+
+	if err := wr.view.Reload(); err == nil {
+		t.Fatal("expected an error reloading a broken template")
+	}
+
+	w := get()
+	if w.Code != http.StatusInternalServerError || !strings.Contains(w.Body.String(), "Template error") || !strings.Contains(w.Body.String(), "show.html.tmpl") {
+		t.Errorf("expected the error overlay, got %d: %s", w.Code, w.Body)
+	}
+
+	if err := os.WriteFile(template, []byte(`{{define "problems/show"}}{{.Missing}}{{end}}`), 0o600); err != nil {
+		t.Fatalf("error writing template: %v", err)
+	}
+
+	if err := wr.view.Reload(); err != nil {
+		t.Fatalf("error reloading templates: %v", err)
+	}
+
+	if w := get(); w.Code != http.StatusInternalServerError || !strings.Contains(w.Body.String(), "in template problems/show") {
+		t.Errorf("expected the error overlay to locate the error, got %d: %s", w.Code, w.Body)
+	}
+}
+
+func TestTemplateFuncs(t *testing.T) {
+	dir := copyTemplates(t)
+
+	cfg := testConfig
+	cfg.TemplateDir = dir
+
+	wr, err := newWebRouter(context.Background(), cfg, nil, nil)
+	if err != nil {
+		t.Fatalf("error creating web router: %v", err)
+	}
+
+	tmpl := `{{define "problems/show"}}` +
+		`<p>{{truncate 12 "A rather long sentence"}}</p>` +
+		`{{markdown "Some *emphasis*"}}` +
+		`<script type="application/ld+json">{{json .}}</script>` +
+		`<a href="{{url "https://example.com/a"}}">{{url "/b"}}</a>` +
+		`{{end}}`
+
+	if err := os.WriteFile(filepath.Join(dir, "problems", "show.html.tmpl"), []byte(tmpl), 0o600); err != nil {
+		t.Fatalf("error writing template: %v", err)
+	}
+
+	if err := wr.view.Reload(); err != nil {
+		t.Fatalf("error reloading templates: %v", err)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/problems/validation", nil)
+	req.Header.Set("Accept", "text/html")
+
+	w := httptest.NewRecorder()
+	wr.ServeHTTP(w, req)
+
+	for _, want := range []string{
+		"<p>A rather…</p>",
+		"<p>Some <em>emphasis</em></p>",
+		`<script type="application/ld+json">{"Title":"Validation failed"`,
+		`<a href="https://example.com/a">` + wr.view.URL("/b") + `</a>`,
+	} {
+		if !strings.Contains(w.Body.String(), want) {
+			t.Errorf("expected %q in %s", want, w.Body)
+		}
+	}
+}
+
+func TestRSSDates(t *testing.T) {
+	wr, err := newWebRouter(context.Background(), testConfig, nil, nil)
+	if err != nil {
+		t.Fatalf("error creating web router: %v", err)
+	}
+
+	w := httptest.NewRecorder()
+	wr.ServeHTTP(w, httptest.NewRequest(http.MethodGet, rssPath, nil))
+
+	lastModified, err := http.ParseTime(w.Header().Get("Last-Modified"))
+	if err != nil {
+		t.Fatalf("error parsing Last-Modified: %v", err)
+	}
+
+	body := w.Body.String()
+
+	if want := "<lastBuildDate>" + lastModified.Format(http.TimeFormat) + "</lastBuildDate>"; !strings.Contains(body, want) {
+		t.Errorf("expected %q in %s", want, body)
+	}
+
+	if want := fmt.Sprintf("All rights reserved %d,", lastModified.Year()); !strings.Contains(body, want) {
+		t.Errorf("expected %q in %s", want, body)
+	}
+
+	if !strings.Contains(body, "<pubDate>"+lastModified.Format(http.TimeFormat)+"</pubDate>") {
+		t.Errorf("expected the latest post's pubDate in %s", body)
+	}
+}
+
+func TestEverythingFragments(t *testing.T) {
+	wr, err := newWebRouter(context.Background(), testConfig, nil, nil)
+	if err != nil {
+		t.Fatalf("error creating web router: %v", err)
+	}
+
+	get := func(target string, fragment bool) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, target, nil)
+		req.Header.Set("Accept", "text/html")
+
+		if fragment {
+			req.Header.Set("HX-Request", "true")
+		}
+
+		w := httptest.NewRecorder()
+		wr.ServeHTTP(w, req)
+
+		return w
+	}
+
+	w := get("/everything?kind=post", false)
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "<html") || !strings.Contains(w.Body.String(), `id="everything-page"`) {
+		t.Fatalf("expected the whole page, got %d: %s", w.Code, w.Body)
+	}
+
+	w = get("/everything?kind=post", true)
+	if w.Code != http.StatusOK || strings.Contains(w.Body.String(), "<html") || !strings.Contains(w.Body.String(), "/writing/") {
+		t.Fatalf("expected a fragment of posts, got %d: %s", w.Code, w.Body)
+	}
+
+	if vary := w.Header().Values("Vary"); !slices.Contains(vary, "HX-Request") {
+		t.Errorf("expected the response to vary by HX-Request, got %v", vary)
+	}
+
+	if w := get("/everything?kind=post&q=zzzunmatched", true); !strings.Contains(w.Body.String(), "Nothing here.") {
+		t.Errorf("expected no search results, got %s", w.Body)
+	}
+
+	if w := get("/everything?kind=note&page=1000", true); w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "Nothing here.") {
+		t.Errorf("expected an empty page, got %d: %s", w.Code, w.Body)
+	}
+
+	for _, target := range []string{"/everything?kind=other", "/everything?page=0"} {
+		if w := get(target, true); w.Code != http.StatusNotFound {
+			t.Errorf("expected %s to be not found, got %d", target, w.Code)
+		}
+	}
+}
+
+func TestPageSlots(t *testing.T) {
+	wr, err := newWebRouter(context.Background(), testConfig, nil, nil)
+	if err != nil {
+		t.Fatalf("error creating web router: %v", err)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/writing/pan-zoom-canvas-react", nil)
+	req.Header.Set("Accept", "text/html")
+
+	w := httptest.NewRecorder()
+	wr.ServeHTTP(w, req)
+
+	head, body, ok := strings.Cut(w.Body.String(), "</head>")
+	if w.Code != http.StatusOK || !ok {
+		t.Fatalf("expected a page, got %d: %s", w.Code, w.Body)
+	}
+
+	if !strings.Contains(head, "window.MathJax") || !strings.Contains(head, `<script src="`+mathJaxURL+`" defer>`) {
+		t.Errorf("expected the post's head and script in the head, got %s", head)
+	}
+
+	if main, _, _ := strings.Cut(body, "</main>"); !strings.Contains(main, "← Writing Archive") || !strings.Contains(main, "<h1>Building a Pannable") {
+		t.Errorf("expected the post within its layout, got %s", body)
+	}
+}
+
+func TestAssets(t *testing.T) {
+	wr, err := newWebRouter(context.Background(), testConfig, nil, nil)
+	if err != nil {
+		t.Fatalf("error creating web router: %v", err)
+	}
+
+	get := func(target string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		wr.ServeHTTP(w, httptest.NewRequest(http.MethodGet, target, nil))
+
+		return w
+	}
+
+	page := get("/writing").Body.String()
+
+	assets := append(wr.view.Assets().Styles(), wr.view.Assets().Scripts()...)
+	for _, asset := range assets {
+		if !strings.Contains(page, `"`+asset+`"`) {
+			t.Errorf("expected the page to link to %s", asset)
+		}
+
+		w := get(asset)
+		if w.Code != http.StatusOK || w.Body.Len() == 0 {
+			t.Errorf("expected %s to be served, got %d", asset, w.Code)
+		}
+
+		// Outside of development, fingerprinted assets are cached as
+		// immutable.
+		if !fingerprintRegex.MatchString(asset) {
+			t.Errorf("expected %s to be fingerprinted", asset)
+		}
+	}
+
+	for _, target := range []string{"/public/styles/index.css", "/public/public.go"} {
+		if w := get(target); w.Code != http.StatusNotFound {
+			t.Errorf("expected %s not to be served, got %d", target, w.Code)
+		}
+	}
+}
+
+func TestCanonicalURLs(t *testing.T) {
+	wr, err := newWebRouter(context.Background(), testConfig, nil, nil)
+	if err != nil {
+		t.Fatalf("error creating web router: %v", err)
+	}
+
+	redirects := map[string]string{
+		"/writing/":        "/writing",
+		"/Writing/Tags":    "/writing/tags",
+		"/writing/?page=2": "/writing?page=2",
+		"/s/AbC/":          "/s/AbC",
+	}
+
+	for target, want := range redirects {
+		w := httptest.NewRecorder()
+		wr.ServeHTTP(w, httptest.NewRequest(http.MethodGet, target, nil))
+
+		if w.Code != http.StatusMovedPermanently || w.Header().Get("Location") != want {
+			t.Errorf("expected %s to redirect to %s, got %d %s", target, want, w.Code, w.Header().Get("Location"))
+		}
+	}
+
+	w := httptest.NewRecorder()
+	wr.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/writing?utm_source=feed", nil))
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", w.Code)
+	}
+
+	if link := `<link rel="canonical" href="` + wr.view.URL("/writing") + `" />`; !strings.Contains(w.Body.String(), link) {
+		t.Errorf("expected the page to link to its canonical URL, got %s", w.Body.String())
+	}
+
+	// The pub domain's actors and notes are shown on the web domain.
+	pub := newTestPub(t)
+	w = httptest.NewRecorder()
+	pub.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	if got := w.Header().Get("X-Robots-Tag"); got != "noindex" {
+		t.Errorf("expected pub responses not to be indexed, got %q", got)
+	}
+}
+
+func TestStructuredData(t *testing.T) {
+	wr, err := newWebRouter(context.Background(), testConfig, nil, nil)
+	if err != nil {
+		t.Fatalf("error creating web router: %v", err)
+	}
+
+	post := wr.posts.List()[0]
+
+	structured := func(target string) map[string]any {
+		t.Helper()
+
+		w := httptest.NewRecorder()
+		wr.ServeHTTP(w, httptest.NewRequest(http.MethodGet, target, nil))
+
+		_, script, ok := strings.Cut(w.Body.String(), `<script type="application/ld+json">`)
+		if !ok {
+			t.Fatalf("expected %s to have structured data", target)
+		}
+
+		script, _, _ = strings.Cut(script, "</script>")
+
+		var data map[string]any
+		if err := json.Unmarshal([]byte(script), &data); err != nil {
+			t.Fatalf("error decoding structured data of %s: %v", target, err)
+		}
+
+		return data
+	}
+
+	posting := structured("/writing/" + post.Slug)
+	if posting["@type"] != "BlogPosting" || posting["headline"] != post.Title || posting["url"] != wr.view.URL("/writing/"+post.Slug) {
+		t.Errorf("expected a BlogPosting of %s, got %v", post.Slug, posting)
+	}
+
+	if posting["datePublished"] != post.PublishedAt.UTC().Format("2006-01-02T15:04:05Z07:00") {
+		t.Errorf("expected the post's publication date, got %v", posting["datePublished"])
+	}
+
+	if person := structured("/"); person["@type"] != "Person" || person["name"] != "Jonathan Clem" {
+		t.Errorf("expected the home page to describe a Person, got %v", person)
+	}
+}
+
+func TestLocales(t *testing.T) {
+	dir := copyTemplates(t)
+
+	cfg := testConfig
+	cfg.TemplateDir = dir
+
+	wr, err := newWebRouter(context.Background(), cfg, nil, nil)
+	if err != nil {
+		t.Fatalf("error creating web router: %v", err)
+	}
+
+	catalog := `{"date.day": "2. January 2006", "month.March": "März", "number.group": ".", "post.minutes": "%d Min. Lesezeit"}`
+	if err := os.WriteFile(filepath.Join(dir, "locales", "de.json"), []byte(catalog), 0o600); err != nil {
+		t.Fatalf("error writing locale: %v", err)
+	}
+
+	if err := wr.view.Reload(); err != nil {
+		t.Fatalf("error reloading templates: %v", err)
+	}
+
+	post := wr.posts.List()[0]
+	post.WordCount, post.ReadingMinutes = 12345, 9
+	post.PublishedAt = time.Date(2024, time.March, 5, 12, 0, 0, 0, time.UTC)
+
+	var b strings.Builder
+
+	err = wr.view.RenderHTML(&b, "writing/show", showPostData{Post: post},
+		view.WithLocale("de"),
+		view.WithCanonical("/de/writing/"+post.Slug),
+		view.WithAlternate("en", "/writing/"+post.Slug),
+	)
+	if err != nil {
+		t.Fatalf("error rendering page: %v", err)
+	}
+
+	for _, want := range []string{
+		`<html lang="de"`,
+		`<link rel="alternate" hreflang="de" href="` + wr.view.URL("/de/writing/"+post.Slug) + `" />`,
+		`<link rel="alternate" hreflang="en" href="` + wr.view.URL("/writing/"+post.Slug) + `" />`,
+		// Messages missing from the catalog fall back to the default locale's.
+		"12.345 words · 9 Min. Lesezeit",
+	} {
+		if !strings.Contains(b.String(), want) {
+			t.Errorf("expected %q in %s", want, b.String())
+		}
+	}
+
+	b.Reset()
+
+	if err := wr.view.RenderHTML(&b, "writing/index", listPostsData{Posts: []posts.Post{post}}, view.WithLocale("de")); err != nil {
+		t.Fatalf("error rendering page: %v", err)
+	}
+
+	if !strings.Contains(b.String(), "5. März 2024") {
+		t.Errorf("expected a date in the locale's layout in %s", b.String())
+	}
+
+	if err := wr.view.RenderHTML(&b, "writing/show", showPostData{Post: post}, view.WithLocale("fr")); err == nil {
+		t.Error("expected an error rendering in an unknown locale")
+	}
+}
+
+func TestThemes(t *testing.T) {
+	wr, err := newWebRouter(context.Background(), testConfig, nil, nil)
+	if err != nil {
+		t.Fatalf("error creating web router: %v", err)
+	}
+
+	light, _ := wr.view.Assets().Theme("light")
+	dark, _ := wr.view.Assets().Theme("dark")
+
+	get := func(target string, header http.Header) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, target, nil)
+		for k, v := range header {
+			req.Header.Set(k, v[0])
+		}
+
+		w := httptest.NewRecorder()
+		wr.ServeHTTP(w, req)
+
+		return w
+	}
+
+	w := get("/writing", nil)
+	if w.Header().Get("Accept-CH") != view.ColorSchemeHint {
+		t.Errorf("expected the color scheme hint to be asked for, got %q", w.Header().Get("Accept-CH"))
+	}
+
+	for _, want := range []string{
+		`data-theme="auto"`,
+		`<link rel="stylesheet" href="` + light + `" media="(prefers-color-scheme: light)" />`,
+		`<link rel="stylesheet" href="` + dark + `" media="(prefers-color-scheme: dark)" />`,
+	} {
+		if !strings.Contains(w.Body.String(), want) {
+			t.Errorf("expected %q in %s", want, w.Body)
+		}
+	}
+
+	w = get("/writing", http.Header{view.ColorSchemeHint: {`"dark"`}})
+	if body := w.Body.String(); !strings.Contains(body, `data-theme="dark"`) || strings.Contains(body, light) {
+		t.Errorf("expected only the dark theme for the hint, got %s", body)
+	}
+
+	w = get("/writing?theme=light&page=2", nil)
+	if w.Code != http.StatusSeeOther || w.Header().Get("Location") != "/writing?page=2" {
+		t.Errorf("expected choosing a theme to redirect to the page, got %d %s", w.Code, w.Header().Get("Location"))
+	}
+
+	cookies := w.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].Name != view.ThemeCookie || cookies[0].Value != "light" {
+		t.Fatalf("expected the theme to be kept in a cookie, got %v", cookies)
+	}
+
+	// A chosen theme takes precedence over the browser's hint.
+	w = get("/writing", http.Header{"Cookie": {cookies[0].String()}, view.ColorSchemeHint: {`"dark"`}})
+	if body := w.Body.String(); !strings.Contains(body, `data-theme="light"`) || strings.Contains(body, dark) {
+		t.Errorf("expected only the light theme for the cookie, got %s", body)
+	}
+}
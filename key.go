@@ -0,0 +1,128 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+
+	ap "github.com/jclem/jclem.me/internal/activitypub"
+	"github.com/jclem/jclem.me/internal/activitypub/identity"
+	"github.com/jclem/jclem.me/internal/database"
+	"github.com/jclem/jclem.me/internal/www/config"
+)
+
+func runKey(cfg config.Config, args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("usage: key rotate|generate [flags]")
+	}
+
+	switch args[0] {
+	case "rotate":
+		return runKeyRotate(cfg, args[1:])
+	case "generate":
+		return runKeyGenerate(cfg, args[1:])
+	default:
+		return fmt.Errorf("unknown key command: %q", args[0])
+	}
+}
+
+// runKeyRotate replaces a user's signing keypair, and prints the new public
+// key.
+func runKeyRotate(cfg config.Config, args []string) error {
+	var username string
+
+	flags := flag.NewFlagSet("key rotate", flag.ContinueOnError)
+	flags.StringVar(&username, "user", cfg.DefaultUser, "the username of the user whose keys to rotate")
+	grace := flags.Duration("grace", identity.DefaultKeyGracePeriod, "how long the previous public key is still served")
+
+	if err := flags.Parse(args); err != nil {
+		return fmt.Errorf("error parsing flags: %w", err)
+	}
+
+	ctx := context.Background()
+
+	pool, err := database.NewPool(ctx, cfg)
+	if err != nil {
+		return fmt.Errorf("failed to connect to database: %w", err)
+	}
+
+	defer pool.Close()
+
+	id, err := identity.NewService(pool)
+	if err != nil {
+		return fmt.Errorf("error creating identity service: %w", err)
+	}
+
+	user, err := id.GetUserByUsername(ctx, username)
+	if err != nil {
+		return fmt.Errorf("error getting user: %w", err)
+	}
+
+	key, err := id.RotateKeys(ctx, user.ID, *grace)
+	if err != nil {
+		return fmt.Errorf("error rotating keys: %w", err)
+	}
+
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "\t")
+
+	if err := enc.Encode(ap.NewSite(cfg).NewPublicKey(user, key)); err != nil {
+		return fmt.Errorf("error encoding key: %w", err)
+	}
+
+	return nil
+}
+
+// runKeyGenerate generates a signing keypair for a user who has none, and
+// prints the public key.
+func runKeyGenerate(cfg config.Config, args []string) error {
+	var username, algorithm string
+
+	flags := flag.NewFlagSet("key generate", flag.ContinueOnError)
+	flags.StringVar(&username, "user", cfg.DefaultUser, "the username of the user whose keys to generate")
+	flags.StringVar(&algorithm, "algorithm", string(identity.KeyAlgorithmRSA), `the keys' algorithm: "rsa" or "ed25519"`)
+
+	if err := flags.Parse(args); err != nil {
+		return fmt.Errorf("error parsing flags: %w", err)
+	}
+
+	ctx := context.Background()
+
+	pool, err := database.NewPool(ctx, cfg)
+	if err != nil {
+		return fmt.Errorf("failed to connect to database: %w", err)
+	}
+
+	defer pool.Close()
+
+	id, err := identity.NewService(pool)
+	if err != nil {
+		return fmt.Errorf("error creating identity service: %w", err)
+	}
+
+	user, err := id.GetUserByUsername(ctx, username)
+	if err != nil {
+		return fmt.Errorf("error getting user: %w", err)
+	}
+
+	key, err := id.GenerateKeys(ctx, user.ID, identity.KeyAlgorithm(algorithm))
+	if errors.Is(err, identity.ErrSigningKeysExist) {
+		return fmt.Errorf("%w; use key rotate to replace them", err)
+	}
+
+	if err != nil {
+		return fmt.Errorf("error generating keys: %w", err)
+	}
+
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "\t")
+
+	if err := enc.Encode(ap.NewSite(cfg).NewPublicKey(user, key)); err != nil {
+		return fmt.Errorf("error encoding key: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/jclem/jclem.me/internal/www"
+	"github.com/jclem/jclem.me/internal/www/config"
+)
+
+var errBrokenLinks = errors.New("found broken links")
+
+func runLinks(cfg config.Config, args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("usage: links check [flags]")
+	}
+
+	switch args[0] {
+	case "check":
+		return runLinksCheck(cfg, args[1:])
+	default:
+		return fmt.Errorf("unknown links command: %q", args[0])
+	}
+}
+
+// runLinksCheck checks the links in every published post and prints the
+// report, failing if any are broken.
+func runLinksCheck(cfg config.Config, args []string) error {
+	flags := flag.NewFlagSet("links check", flag.ContinueOnError)
+
+	if err := flags.Parse(args); err != nil {
+		return fmt.Errorf("error parsing flags: %w", err)
+	}
+
+	report, err := www.CheckLinks(context.Background(), cfg)
+	if err != nil {
+		return fmt.Errorf("error checking links: %w", err)
+	}
+
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "\t")
+
+	if err := enc.Encode(report); err != nil {
+		return fmt.Errorf("error encoding report: %w", err)
+	}
+
+	if len(report.Broken) > 0 {
+		return fmt.Errorf("%w: %d of %d", errBrokenLinks, len(report.Broken), report.Checked)
+	}
+
+	return nil
+}
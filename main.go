@@ -1,22 +1,139 @@
 package main
 
 import (
+	"context"
+	"flag"
 	"fmt"
 	"log"
+	"os"
+	"os/signal"
+	"syscall"
 
+	"github.com/jclem/jclem.me/internal/errorreport"
+	"github.com/jclem/jclem.me/internal/telemetry"
 	"github.com/jclem/jclem.me/internal/www"
 	"github.com/jclem/jclem.me/internal/www/config"
 )
 
 func main() {
-	if _, err := config.LoadConfig(); err != nil {
+	cfg, err := config.LoadConfig()
+	if err != nil {
 		log.Fatal(fmt.Errorf("error loading config: %w", err))
 	}
 
-	server, err := www.New()
+	if err := run(cfg, os.Args[1:]); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func run(cfg config.Config, args []string) error {
+	if len(args) == 0 {
+		return start(cfg, nil)
+	}
+
+	switch args[0] {
+	case "start", "serve":
+		return start(cfg, args[1:])
+	case "user":
+		return runUser(cfg, args[1:])
+	case "images":
+		return runImages(cfg, args[1:])
+	case "links":
+		return runLinks(cfg, args[1:])
+	case "migrate":
+		return runMigrate(cfg, args[1:])
+	case "export":
+		return runExport(cfg, args[1:])
+	case "seed":
+		return runSeed(cfg, args[1:])
+	case "key", "keys":
+		return runKey(cfg, args[1:])
+	case "post":
+		return runPost(cfg, args[1:])
+	case "import":
+		return runImport(cfg, args[1:])
+	case "fed":
+		return runFed(cfg, args[1:])
+	case "bench":
+		return runBench(cfg, args[1:])
+	case "help", "-h", "-help", "--help":
+		fmt.Print(usage)
+		return nil
+	default:
+		return fmt.Errorf("unknown command: %q\n\n%s", args[0], usage)
+	}
+}
+
+// usage lists the commands. Each command's flags are listed with -h.
+const usage = `usage: www <command> [flags]
+
+Commands:
+  serve                         serve requests and work jobs (the default; also "start")
+  migrate up|status|baseline    manage the database schema
+  user create                   create a user and print their API key
+  key rotate                    replace a user's signing keys
+  key generate                  create signing keys for a user who has none
+  post note                     post a note through the API
+  images generate               resize the images in embedded posts
+  links check                   check links in posts and pages
+  export                        write an archive of a user's data
+  export followers|following    write a user's accounts as Mastodon CSV
+  import mastodon               import a Mastodon archive and followers
+  import following              follow the accounts in a Mastodon CSV
+  fed debug <command>           fetch actors, verify signatures, and dry-run deliveries
+  bench fanout                  measure delivery of a note to many simulated followers
+  seed                          fill a development database with example data
+  help                          print this message
+`
+
+// start runs the server until it is interrupted. The -mode flag overrides the
+// configured run mode, so that web and worker processes can share an
+// environment.
+func start(cfg config.Config, args []string) error {
+	mode := string(cfg.RunMode)
+
+	flags := flag.NewFlagSet("start", flag.ContinueOnError)
+	flags.StringVar(&mode, "mode", mode, `what to run: "all", "web", or "worker"`)
+
+	if err := flags.Parse(args); err != nil {
+		return fmt.Errorf("error parsing flags: %w", err)
+	}
+
+	cfg.RunMode = config.RunMode(mode)
+
+	if err := cfg.Validate(); err != nil {
+		return fmt.Errorf("invalid config:\n%w", err)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	shutdownTracing, err := telemetry.Setup(ctx, cfg)
+	if err != nil {
+		return fmt.Errorf("error setting up tracing: %w", err)
+	}
+
+	defer func() {
+		if err := shutdownTracing(context.Background()); err != nil {
+			log.Printf("error shutting down tracing: %s", err)
+		}
+	}()
+
+	shutdownErrorReporting, err := errorreport.Setup(cfg)
+	if err != nil {
+		return fmt.Errorf("error setting up error reporting: %w", err)
+	}
+
+	defer func() {
+		if err := shutdownErrorReporting(context.Background()); err != nil {
+			log.Printf("error shutting down error reporting: %s", err)
+		}
+	}()
+
+	server, err := www.New(ctx, cfg)
 	if err != nil {
-		log.Fatal(fmt.Errorf("error creating server: %w", err))
+		return fmt.Errorf("error creating server: %w", err)
 	}
 
-	log.Fatal(server.Start())
+	return server.Start(ctx) //nolint:wrapcheck
 }
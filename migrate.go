@@ -0,0 +1,134 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/jclem/jclem.me/internal/database"
+	"github.com/jclem/jclem.me/internal/www/config"
+)
+
+func runMigrate(cfg config.Config, args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("usage: migrate up|status|baseline [flags]")
+	}
+
+	switch args[0] {
+	case "up":
+		return runMigrateUp(cfg, args[1:])
+	case "status":
+		return runMigrateStatus(cfg, args[1:])
+	case "baseline":
+		return runMigrateBaseline(cfg, args[1:])
+	default:
+		return fmt.Errorf("unknown migrate command: %q", args[0])
+	}
+}
+
+// runMigrateUp creates or updates the job queue tables and applies every
+// pending migration.
+func runMigrateUp(cfg config.Config, args []string) error {
+	flags := flag.NewFlagSet("migrate up", flag.ContinueOnError)
+
+	if err := flags.Parse(args); err != nil {
+		return fmt.Errorf("error parsing flags: %w", err)
+	}
+
+	ctx := context.Background()
+
+	pool, err := database.NewPool(ctx, cfg)
+	if err != nil {
+		return fmt.Errorf("failed to connect to database: %w", err)
+	}
+
+	defer pool.Close()
+
+	applied, err := database.Migrate(ctx, pool)
+	if err != nil {
+		return fmt.Errorf("error migrating database: %w", err)
+	}
+
+	for _, m := range applied {
+		fmt.Printf("applied %03d_%s\n", m.Version, m.Name)
+	}
+
+	if len(applied) == 0 {
+		fmt.Println("no pending migrations")
+	}
+
+	return nil
+}
+
+// runMigrateStatus prints each migration and when it was applied.
+func runMigrateStatus(cfg config.Config, args []string) error {
+	flags := flag.NewFlagSet("migrate status", flag.ContinueOnError)
+
+	if err := flags.Parse(args); err != nil {
+		return fmt.Errorf("error parsing flags: %w", err)
+	}
+
+	ctx := context.Background()
+
+	pool, err := database.NewPool(ctx, cfg)
+	if err != nil {
+		return fmt.Errorf("failed to connect to database: %w", err)
+	}
+
+	defer pool.Close()
+
+	statuses, err := database.Status(ctx, pool)
+	if err != nil {
+		return fmt.Errorf("error getting migration status: %w", err)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+
+	for _, s := range statuses {
+		applied := "pending"
+		if s.AppliedAt != nil {
+			applied = s.AppliedAt.Format(time.RFC3339)
+		}
+
+		fmt.Fprintf(w, "%03d\t%s\t%s\n", s.Version, s.Name, applied)
+	}
+
+	if err := w.Flush(); err != nil {
+		return fmt.Errorf("error writing status: %w", err)
+	}
+
+	return nil
+}
+
+// runMigrateBaseline records migrations as applied without applying them, for
+// databases whose schema was changed by hand.
+func runMigrateBaseline(cfg config.Config, args []string) error {
+	flags := flag.NewFlagSet("migrate baseline", flag.ContinueOnError)
+	version := flags.Int("version", 0, "the last migration already applied by hand (required)")
+
+	if err := flags.Parse(args); err != nil {
+		return fmt.Errorf("error parsing flags: %w", err)
+	}
+
+	if *version < 1 {
+		return fmt.Errorf("usage: migrate baseline -version N")
+	}
+
+	ctx := context.Background()
+
+	pool, err := database.NewPool(ctx, cfg)
+	if err != nil {
+		return fmt.Errorf("failed to connect to database: %w", err)
+	}
+
+	defer pool.Close()
+
+	if err := database.Baseline(ctx, pool, *version); err != nil {
+		return fmt.Errorf("error recording baseline: %w", err)
+	}
+
+	return nil
+}
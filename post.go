@@ -0,0 +1,129 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"html"
+	"io"
+	"os"
+	"strings"
+
+	ap "github.com/jclem/jclem.me/internal/activitypub"
+	"github.com/jclem/jclem.me/internal/activitypub/identity"
+	"github.com/jclem/jclem.me/internal/client"
+	"github.com/jclem/jclem.me/internal/www/config"
+)
+
+func runPost(cfg config.Config, args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("usage: post note [flags] [content]")
+	}
+
+	switch args[0] {
+	case "note":
+		return runPostNote(cfg, args[1:])
+	default:
+		return fmt.Errorf("unknown post command: %q", args[0])
+	}
+}
+
+// runPostNote posts a note to the outbox of the configured server, and prints
+// the activity which created it.
+//
+// The note's content is the command's arguments, or else is read from stdin.
+// It is plain text, whose paragraphs are separated by blank lines, unless
+// -html is given.
+func runPostNote(cfg config.Config, args []string) error {
+	var (
+		username   string
+		visibility string
+		isHTML     bool
+		mentions   []string
+	)
+
+	flags := flag.NewFlagSet("post note", flag.ContinueOnError)
+	flags.StringVar(&username, "user", cfg.DefaultUser, "the username of the user posting the note")
+	flags.StringVar(&visibility, "visibility", string(ap.VisibilityPublic), `who may see the note: "public", "unlisted", "followers", or "direct"`)
+	flags.BoolVar(&isHTML, "html", false, "post the content as HTML rather than plain text")
+	flags.Func("mention", "the ID of an actor to address the note to (repeatable)", func(id string) error {
+		mentions = append(mentions, id)
+		return nil
+	})
+
+	if err := flags.Parse(args); err != nil {
+		return fmt.Errorf("error parsing flags: %w", err)
+	}
+
+	if cfg.ClientAPIKey == "" {
+		return errors.New("client_api_key is required to post")
+	}
+
+	content := strings.Join(flags.Args(), " ")
+	if content == "" {
+		b, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			return fmt.Errorf("error reading content: %w", err)
+		}
+
+		content = string(b)
+	}
+
+	content = strings.TrimSpace(content)
+	if content == "" {
+		return errors.New("content is required")
+	}
+
+	if !isHTML {
+		content = textToHTML(content)
+	}
+
+	site := ap.NewSite(cfg)
+	actor := identity.User{Username: username}
+
+	to, cc, err := ap.Visibility(visibility).Addressing(site.ActorFollowers(actor), mentions)
+	if err != nil {
+		return err //nolint:wrapcheck
+	}
+
+	baseURL := cfg.ClientURL
+	if baseURL == "" {
+		baseURL = site.BaseURL
+	}
+
+	activity, err := client.New(site, baseURL, cfg.ClientAPIKey).PostNote(context.Background(), actor, ap.Note{Content: content, To: to, Cc: cc})
+	if err != nil {
+		return fmt.Errorf("error posting note: %w", err)
+	}
+
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "\t")
+
+	if err := enc.Encode(activity); err != nil {
+		return fmt.Errorf("error encoding activity: %w", err)
+	}
+
+	return nil
+}
+
+// textToHTML escapes plain text and wraps each of its paragraphs, separated by
+// blank lines, in a <p> element. Line breaks within a paragraph become <br>
+// elements.
+func textToHTML(text string) string {
+	var b strings.Builder
+
+	for _, para := range strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n\n") {
+		para = strings.TrimSpace(para)
+		if para == "" {
+			continue
+		}
+
+		b.WriteString("<p>")
+		b.WriteString(strings.ReplaceAll(html.EscapeString(para), "\n", "<br>"))
+		b.WriteString("</p>")
+	}
+
+	return b.String()
+}
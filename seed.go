@@ -0,0 +1,39 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/jclem/jclem.me/internal/www"
+	"github.com/jclem/jclem.me/internal/www/config"
+)
+
+// runSeed fills an empty development database with example data, and prints
+// the seeded user and their API key.
+func runSeed(cfg config.Config, args []string) error {
+	var username string
+
+	flags := flag.NewFlagSet("seed", flag.ContinueOnError)
+	flags.StringVar(&username, "user", cfg.DefaultUser, "the username of the user to create")
+
+	if err := flags.Parse(args); err != nil {
+		return fmt.Errorf("error parsing flags: %w", err)
+	}
+
+	result, err := www.Seed(context.Background(), cfg, username)
+	if err != nil {
+		return fmt.Errorf("error seeding: %w", err)
+	}
+
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "\t")
+
+	if err := enc.Encode(result); err != nil {
+		return fmt.Errorf("error encoding user: %w", err)
+	}
+
+	return nil
+}
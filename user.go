@@ -0,0 +1,72 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/jclem/jclem.me/internal/activitypub/identity"
+	"github.com/jclem/jclem.me/internal/database"
+	"github.com/jclem/jclem.me/internal/www/config"
+)
+
+func runUser(cfg config.Config, args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("usage: user create [flags]")
+	}
+
+	switch args[0] {
+	case "create":
+		return runUserCreate(cfg, args[1:])
+	default:
+		return fmt.Errorf("unknown user command: %q", args[0])
+	}
+}
+
+func runUserCreate(cfg config.Config, args []string) error {
+	var input identity.NewUser
+
+	flags := flag.NewFlagSet("user create", flag.ContinueOnError)
+	flags.StringVar(&input.Username, "username", "", "the user's username (required)")
+	flags.StringVar(&input.Email, "email", "", "the user's email address")
+	flags.StringVar(&input.Name, "name", "", "the user's display name")
+	flags.StringVar(&input.Summary, "summary", "", "the user's profile summary")
+	flags.StringVar(&input.ImageURL, "image-url", "", "the URL of the user's avatar")
+
+	if err := flags.Parse(args); err != nil {
+		return fmt.Errorf("error parsing flags: %w", err)
+	}
+
+	ctx := context.Background()
+
+	pool, err := database.NewPool(ctx, cfg)
+	if err != nil {
+		return fmt.Errorf("failed to connect to database: %w", err)
+	}
+
+	defer pool.Close()
+
+	id, err := identity.NewService(pool)
+	if err != nil {
+		return fmt.Errorf("error creating identity service: %w", err)
+	}
+
+	user, apiKey, err := id.CreateUser(ctx, input)
+	if err != nil {
+		return fmt.Errorf("error creating user: %w", err)
+	}
+
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "\t")
+
+	if err := enc.Encode(struct {
+		User   identity.User `json:"user"`
+		APIKey string        `json:"api_key"`
+	}{User: user, APIKey: apiKey}); err != nil {
+		return fmt.Errorf("error encoding user: %w", err)
+	}
+
+	return nil
+}